@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// aggregateSite is one instance polled, keeping the last document it served
+// for while it can't be reached.
+type aggregateSite struct {
+	URL      string             `json:"url"`
+	Site     string             `json:"site"`
+	Stats    *tui.StatsDocument `json:"stats,omitempty"`
+	LastSeen *time.Time         `json:"last_seen,omitempty"`
+	Stale    bool               `json:"stale"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// aggregateSummary is the merged view, written by --export. Loss is over
+// every probe settled at every site, and the average weighted by replies.
+type aggregateSummary struct {
+	Time     time.Time        `json:"time"`
+	Sites    []*aggregateSite `json:"sites"`
+	Count    int              `json:"count"`
+	AvgMs    float64          `json:"avg_ms"`
+	Sent     int              `json:"sent"`
+	Lost     int              `json:"lost"`
+	LossPct  float64          `json:"loss_pct"`
+	Alerting int              `json:"alerting"`
+	Stale    int              `json:"stale"`
+}
+
+type aggregator struct {
+	sites  []*aggregateSite
+	client *http.Client
+	// staleAfter is how old a site's document can get before it's shown
+	// stale, even when it still answers.
+	staleAfter time.Duration
+}
+
+func aggregateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "aggregate",
+		Usage: "poll the stats of instances run with --stats-listen and show them as one table",
+		UsageText: `network-test aggregate --from url [--from url...] [options]
+
+Each site is named by its site label, given to it with --label site=name, or
+otherwise by the address it's polled at.
+
+Examples:
+   network-test aggregate --from http://site-a:8080/stats --from http://site-b:8080/stats
+   network-test aggregate --from http://site-a:8080 --every 30s --export sites.json
+   network-test aggregate --from http://site-a:8080/stats --once`,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "from",
+				Usage:    "stats URL of an instance, or just its address, may be repeated",
+				Required: true,
+			},
+			&cli.GenericFlag{
+				Name:  "every",
+				Value: duration.New(10*time.Second, time.Second),
+				Usage: "how often to poll each instance; a bare number is seconds",
+			},
+			&cli.GenericFlag{
+				Name:  "stale-after",
+				Value: duration.New(time.Minute, time.Second),
+				Usage: "how old an instance's stats can get before it's shown stale, even if it still answers; a bare number is seconds",
+			},
+			&cli.StringFlag{
+				Name:  "export",
+				Usage: "write the merged summary as JSON to this file after every poll",
+			},
+			&cli.BoolFlag{
+				Name:  "once",
+				Usage: "poll once, print the table and exit, failing if any instance is stale",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			a, err := newAggregator(c.StringSlice("from"), durationOf(c, "stale-after"))
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			repaint := !c.Bool("once") && tui.DetectTerminal().StdoutTTY
+			ticker := time.NewTicker(durationOf(c, "every"))
+			defer ticker.Stop()
+			for {
+				a.poll(ctx, time.Now())
+				summary := a.summary(time.Now())
+				if repaint {
+					fmt.Print("\x1b[H\x1b[2J")
+				}
+				fmt.Println(strings.Join(a.table(summary), "\n"))
+
+				if path := c.String("export"); path != "" {
+					if err := writeAggregate(path, summary); err != nil {
+						return err
+					}
+				}
+
+				if c.Bool("once") {
+					if summary.Stale > 0 {
+						return cli.Exit(fmt.Sprintf("%d of %d instances are stale", summary.Stale, len(a.sites)), 1)
+					}
+					return nil
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
+
+// newAggregator takes each --from as a URL, with http:// and /stats added to
+// a bare address.
+func newAggregator(from []string, staleAfter time.Duration) (*aggregator, error) {
+	a := &aggregator{client: &http.Client{Timeout: tui.AGGREGATE_TIMEOUT}, staleAfter: staleAfter}
+	for _, value := range from {
+		if !strings.Contains(value, "://") {
+			value = "http://" + value
+		}
+
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid --from %q, expected a URL such as http://site-a:8080/stats", value)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = tui.STATS_PATH
+		}
+
+		a.sites = append(a.sites, &aggregateSite{URL: u.String(), Site: u.Host})
+	}
+
+	return a, nil
+}
+
+// poll fetches every site at once, keeping what a site last served when it
+// doesn't answer or serves something that can't be read.
+func (a *aggregator) poll(ctx context.Context, now time.Time) {
+	var wg sync.WaitGroup
+	for _, site := range a.sites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			document, err := a.fetch(ctx, site.URL)
+			if err != nil {
+				site.Error = err.Error()
+				return
+			}
+
+			site.Stats, site.Error = document, ""
+			seen := now
+			site.LastSeen = &seen
+			if name := document.Labels[tui.AGGREGATE_SITE_LABEL]; name != "" {
+				site.Site = name
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, site := range a.sites {
+		site.Stale = site.Error != "" || site.Stats == nil || now.Sub(site.Stats.Updated) > a.staleAfter
+	}
+}
+
+func (a *aggregator) fetch(ctx context.Context, address string) (*tui.StatsDocument, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", address, response.Status)
+	}
+
+	var document tui.StatsDocument
+	if err := json.NewDecoder(io.LimitReader(response.Body, tui.AGGREGATE_MAX_DOCUMENT)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to parse stats from %s: %s", address, err)
+	}
+
+	switch {
+	case document.Schema == 0:
+		return nil, fmt.Errorf("%s doesn't serve network-test stats, expected an instance run with --stats-listen", address)
+	case document.Schema != tui.STATS_SCHEMA:
+		return nil, fmt.Errorf("%s serves stats schema %d, but this version reads %d; run the same version everywhere", address, document.Schema, tui.STATS_SCHEMA)
+	}
+
+	return &document, nil
+}
+
+// summary merges the sites' last documents, stale ones included, since a
+// site that stopped answering mid-incident still had that incident.
+func (a *aggregator) summary(now time.Time) aggregateSummary {
+	summary := aggregateSummary{Time: now, Sites: a.sites}
+
+	var weighted float64
+	for _, site := range a.sites {
+		if site.Stale {
+			summary.Stale++
+		}
+		if site.Stats == nil {
+			continue
+		}
+
+		summary.Count += site.Stats.Count
+		summary.Sent += site.Stats.Sent
+		summary.Lost += site.Stats.Lost
+		weighted += site.Stats.AvgMs * float64(site.Stats.Count)
+		if len(site.Stats.Alerts) > 0 {
+			summary.Alerting++
+		}
+	}
+
+	if summary.Count > 0 {
+		summary.AvgMs = weighted / float64(summary.Count)
+	}
+	if summary.Sent > 0 {
+		summary.LossPct = float64(summary.Lost) / float64(summary.Sent) * 100
+	}
+
+	return summary
+}
+
+// table is a row per site, then the merged totals.
+func (a *aggregator) table(summary aggregateSummary) []string {
+	rows := [][]string{{"SITE", "TARGET", "LOSS", "AVG", "ALERT", "SEEN"}}
+	for _, site := range summary.Sites {
+		row := []string{site.Site, "-", "-", "-", "-", "never seen"}
+		if s := site.Stats; s != nil {
+			row[1] = s.Target
+			row[2] = fmt.Sprintf("%.1f%%", s.LossPct)
+			row[3] = stats.FormatMillis(s.AvgMs)
+			row[4] = describeAlerts(s.Alerts)
+		}
+		if site.LastSeen != nil {
+			row[5] = site.LastSeen.Local().Format(time.TimeOnly)
+		}
+		if site.Stale && site.LastSeen != nil {
+			row[5] = "stale, seen " + row[5]
+		} else if site.Stale {
+			row[5] = "stale, never seen"
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, []string{
+		"all",
+		fmt.Sprintf("%d sites, %d stale", len(summary.Sites), summary.Stale),
+		fmt.Sprintf("%.1f%%", summary.LossPct),
+		stats.FormatMillis(summary.AvgMs),
+		fmt.Sprintf("%d alerting", summary.Alerting),
+		summary.Time.Local().Format(time.TimeOnly),
+	})
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	var lines []string
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+
+	for _, site := range summary.Sites {
+		if site.Error != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", site.Site, site.Error))
+		}
+	}
+
+	return lines
+}
+
+func describeAlerts(alerts []stats.Incident) string {
+	if len(alerts) == 0 {
+		return "ok"
+	}
+
+	kinds := make([]string, len(alerts))
+	for i, alert := range alerts {
+		kinds[i] = alert.Kind
+		if alert.Acknowledged() {
+			kinds[i] += " (acked)"
+		}
+	}
+
+	return strings.Join(kinds, ", ")
+}
+
+func writeAggregate(path string, summary aggregateSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode merged summary: %s", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write merged summary: %s", err)
+	}
+
+	return os.Rename(tmp, path)
+}
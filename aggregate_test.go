@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// TestAggregate polls instances serving stats, one that serves a
+// schema it can't read and one that goes away, checking the merged totals
+// and that a site that stops answering is kept, shown stale.
+func TestAggregate(t *testing.T) {
+	now := time.Now()
+	site := func(name string, count int, avg int, sent int, lost int, alerts []stats.Incident) *httptest.Server {
+		s := &tui.StatsServer{}
+		s.Publish(tui.StatsDocument{Schema: tui.STATS_SCHEMA, Target: "icmp " + name, Labels: map[string]string{tui.AGGREGATE_SITE_LABEL: name}, Updated: now, Count: count, AvgMs: float64(avg), Sent: sent, Lost: lost, LossPct: float64(lost) / float64(sent) * 100, Alerts: alerts})
+		return httptest.NewServer(http.HandlerFunc(s.Handle))
+	}
+
+	a := site("site-a", 90, 10, 100, 10, nil)
+	defer a.Close()
+	b := site("site-b", 10, 110, 10, 0, []stats.Incident{{Kind: "latency"}})
+	defer b.Close()
+	future := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"schema": 2, "target": "icmp 1.1.1.1"}`))
+	}))
+	defer future.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer other.Close()
+
+	empty := httptest.NewRecorder()
+	(&tui.StatsServer{}).Handle(empty, httptest.NewRequest(http.MethodGet, tui.STATS_PATH, nil))
+	if empty.Code != http.StatusServiceUnavailable {
+		t.Fatalf("stats before the run has any: expected 503, got %v", empty.Code)
+	}
+
+	aggregator, err := newAggregator([]string{a.URL, strings.TrimPrefix(b.URL, "http://"), future.URL + tui.STATS_PATH, other.URL}, time.Minute)
+	if err != nil {
+		t.Fatalf("--from takes URLs and bare addresses: expected no error, got %v", err)
+	}
+	if aggregator.sites[1].URL != b.URL+tui.STATS_PATH {
+		t.Fatalf("a bare --from address: expected %q%q, got %q", b.URL, tui.STATS_PATH, aggregator.sites[1].URL)
+	}
+	if _, err := newAggregator([]string{"http://"}, time.Minute); err == nil {
+		t.Fatalf("--from without a host: expected an error, got accepted")
+	}
+
+	aggregator.poll(context.Background(), now)
+	summary := aggregator.summary(now)
+	if names := []string{aggregator.sites[0].Site, aggregator.sites[1].Site}; !slices.Equal(names, []string{"site-a", "site-b"}) {
+		t.Fatalf("sites are named by their site label: expected site-a, site-b, got %q", strings.Join(names, ", "))
+	}
+	if !strings.Contains(aggregator.sites[2].Error, "schema 2") || !strings.Contains(aggregator.sites[3].Error, "doesn't serve network-test stats") || aggregator.sites[2].Stats != nil {
+		t.Fatalf("documents of another schema are refused: expected schema 2 and not network-test stats, got %q | %q", aggregator.sites[2].Error, aggregator.sites[3].Error)
+	}
+	if summary.Count != 100 || summary.AvgMs != 20 || summary.Sent != 110 || summary.Lost != 10 || summary.Alerting != 1 || summary.Stale != 2 {
+		t.Fatalf("merged totals weigh each site by its probes: expected 100 replies avg 20ms, 10/110 lost, 1 alerting, 2 stale, got %d replies avg %gms, %d/%d lost, %d alerting, %d stale", summary.Count, summary.AvgMs, summary.Lost, summary.Sent, summary.Alerting, summary.Stale)
+	}
+
+	table := aggregator.table(summary)
+	if !strings.HasPrefix(table[2], "site-b") || !strings.Contains(table[2], "latency") || !strings.Contains(table[3], "stale, never seen") || !strings.HasPrefix(table[5], "all") {
+		t.Fatalf("a row per site and one for them all: expected site-b alerting on latency, the schema 2 site never seen, got %q", strings.Join(table, "\n"))
+	}
+
+	b.Close()
+	later := now.Add(10 * time.Second)
+	aggregator.poll(context.Background(), later)
+	gone := aggregator.sites[1]
+	if !gone.Stale || gone.Stats == nil || gone.LastSeen == nil || !gone.LastSeen.Equal(now) || gone.Error == "" {
+		t.Fatalf("an instance that stops answering: expected stale, keeping what it last served, got stale %v, stats %v, last seen %v, error %q", gone.Stale, gone.Stats != nil, gone.LastSeen, gone.Error)
+	}
+	if summary := aggregator.summary(later); summary.Count != 100 || summary.Stale != 3 {
+		t.Fatalf("a stale site still counts: expected 100 replies, 3 stale, got %d replies, %d stale", summary.Count, summary.Stale)
+	}
+	if row := aggregator.table(aggregator.summary(later))[2]; !strings.Contains(row, "stale, seen "+now.Local().Format(time.TimeOnly)) {
+		t.Fatalf("a stale site's row: expected when it was last seen, got %q", row)
+	}
+
+	aggregator.poll(context.Background(), now.Add(2*time.Minute))
+	if !aggregator.sites[0].Stale || aggregator.sites[0].Error != "" {
+		t.Fatalf("an instance that answers with stats older than --stale-after: expected stale, got stale %v, error %q", aggregator.sites[0].Stale, aggregator.sites[0].Error)
+	}
+}
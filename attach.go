@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+func attachCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "attach",
+		Usage: "show a running instance's display, streamed over its control socket",
+		UsageText: `network-test attach --socket path [options]
+
+The instance has to be run with --control-socket. The display is rebuilt
+from a snapshot of the run, then kept up to date from the samples, pauses
+and events as they happen, reconnecting if the instance restarts. Keys that
+change the run are turned off unless --allow-control is given, when they're
+passed on to the instance as ctl would.
+
+Examples:
+   network-test --plain --control-socket /run/nettest/nettest.sock example.com
+   network-test attach --socket /run/nettest/nettest.sock
+   network-test attach --socket /run/nettest/nettest.sock --allow-control`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "socket",
+				Usage:    "control socket of the running instance",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "allow-control",
+				Usage: "pass the ack, pause and mark-change keys on to the instance, rather than only watching",
+			},
+			&cli.BoolFlag{
+				Name:  "force-tui",
+				Usage: "use the interactive display even if the terminal looks unsuitable",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "config file to read the keys section from (default: network-test/config.yaml in the XDG config dir)",
+			},
+			&cli.StringFlag{
+				Name:  "theme",
+				Value: "default",
+				Usage: "colour theme, one of: " + strings.Join(theme.Names(), ", "),
+			},
+			&cli.StringFlag{
+				Name:  "time-format",
+				Value: stats.TIME_LOCAL,
+				Usage: "how times are shown, one of: " + strings.Join(stats.TIME_FORMATS, ", ") + " (relative counts from the start of the run)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if _, err := stats.NewTimeFormat(c.String("time-format"), time.Now(), time.Local); err != nil {
+				return err
+			}
+
+			t, err := theme.Get(c.String("theme"))
+			if err != nil {
+				return err
+			}
+
+			file, err := loadSettings(c.String("config"))
+			if err != nil {
+				return err
+			}
+			keys, err := tui.NewKeyMap(file.Keys)
+			if err != nil {
+				return err
+			}
+
+			if ok, reason := tui.UseTUI(tui.DetectTerminal(), c.Bool("force-tui")); !ok {
+				return fmt.Errorf("attach needs the interactive display: %s", reason)
+			}
+
+			f := tui.NewFollower(c.String("socket"), c.Bool("allow-control"), c.String("time-format"))
+			return attach(c.Context, f, t, keys)
+		},
+	}
+}
+
+func attach(ctx context.Context, f *tui.Follower, t theme.Theme, keys tui.KeyMap) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go f.Run(ctx)
+
+	m, err := tui.NewFollowModel(ctx, f, t, keys)
+	if err != nil {
+		return err
+	}
+
+	final, err := tea.NewProgram(m).Run()
+	if err != nil {
+		return err
+	}
+
+	return final.(tui.Model).Err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// bindingsOf reads --source and --interface. Either given more than once
+// runs a panel for each, paired with the other when it's given once, so the
+// same host can be compared over each path in one screen.
+func bindingsOf(c *cli.Context) ([]ping.Binding, error) {
+	var sources []netip.Addr
+	for _, source := range c.StringSlice("source") {
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --source %q, expected an address of this machine", source)
+		}
+		sources = append(sources, addr)
+	}
+	ifaces := c.StringSlice("interface")
+
+	switch {
+	case len(sources) > 1 && len(ifaces) > 1:
+		return nil, fmt.Errorf("--source and --interface can't both be given more than once, as there'd be no telling which go together")
+	case len(sources) > 1:
+		bindings := make([]ping.Binding, len(sources))
+		for i, source := range sources {
+			bindings[i] = ping.Binding{Source: source}
+			if len(ifaces) == 1 {
+				bindings[i].Interface = ifaces[0]
+			}
+		}
+		return bindings, nil
+	case len(ifaces) > 1:
+		bindings := make([]ping.Binding, len(ifaces))
+		for i, iface := range ifaces {
+			bindings[i] = ping.Binding{Interface: iface}
+			if len(sources) == 1 {
+				bindings[i].Source = sources[0]
+			}
+		}
+		return bindings, nil
+	}
+
+	var binding ping.Binding
+	if len(sources) == 1 {
+		binding.Source = sources[0]
+	}
+	if len(ifaces) == 1 {
+		binding.Interface = ifaces[0]
+	}
+	if binding.IsZero() {
+		return nil, nil
+	}
+	return []ping.Binding{binding}, nil
+}
+
+// firstBinding is the binding of a run of one panel, if it has one.
+func firstBinding(bindings []ping.Binding) ping.Binding {
+	if len(bindings) == 0 {
+		return ping.Binding{}
+	}
+
+	return bindings[0]
+}
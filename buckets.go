@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/duration"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// parseBuckets reads --buckets: rising durations separated by commas, with
+// bare numbers taken as milliseconds, or auto to fit them to the run.
+func parseBuckets(value string) ([]time.Duration, bool, error) {
+	switch strings.TrimSpace(value) {
+	case "":
+		return stats.DEFAULT_THRESHOLDS, false, nil
+	case stats.AUTO_BUCKETS:
+		return stats.DEFAULT_THRESHOLDS, true, nil
+	}
+
+	var thresholds []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		threshold, err := duration.Parse(part, time.Millisecond)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid bucket %q in --buckets: %s", strings.TrimSpace(part), err)
+		}
+		if threshold <= 0 {
+			return nil, false, fmt.Errorf("invalid bucket %q in --buckets: must be more than zero", strings.TrimSpace(part))
+		}
+		if len(thresholds) > 0 && threshold <= thresholds[len(thresholds)-1] {
+			return nil, false, fmt.Errorf("--buckets must rise from one to the next, but %s follows %s", stats.FormatThreshold(threshold), stats.FormatThreshold(thresholds[len(thresholds)-1]))
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	return thresholds, false, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestBuckets reads --buckets, sorts sub-millisecond samples and ones
+// past the last bucket, reads an overflow back from files written before it
+// was counted, and fits buckets to a run with --buckets auto, checking that
+// re-binning never gains or loses a sample.
+func TestBuckets(t *testing.T) {
+	thresholds, auto, err := parseBuckets("0.5ms,1ms,5ms,25ms,100ms")
+	if err != nil || auto || stats.FormatThresholds(thresholds) != "0.5/1/5/25/100ms" {
+		t.Fatalf("--buckets takes durations: expected 0.5/1/5/25/100ms, got %s, %v", stats.FormatThresholds(thresholds), err)
+	}
+	if bare, _, err := parseBuckets("1, 2.5, 10"); err != nil || stats.FormatThresholds(bare) != "1/2.5/10ms" {
+		t.Fatalf("bare numbers in --buckets are milliseconds: expected 1/2.5/10ms, got %s, %v", stats.FormatThresholds(bare), err)
+	}
+	for _, bad := range []string{"1ms,1ms", "5ms,1ms", "0,1ms", "fast"} {
+		if _, _, err := parseBuckets(bad); err == nil {
+			t.Fatalf("--buckets must be rising durations: expected %q refused, got accepted", bad)
+		}
+	}
+
+	s := stats.New(time.Second, time.Minute, thresholds)
+	for range 10 {
+		s.Update(200 * time.Microsecond)
+	}
+	s.Update(300 * time.Millisecond)
+	if s.Histogram.Buckets()[0] != 10 || s.Histogram.Overflow() != 1 || s.Histogram.Total() != 11 {
+		t.Fatalf("sub-millisecond samples are bucketed and slow ones overflow: expected 10 under 0.5ms, 1 past 100ms, got %v with %d over", s.Histogram.Buckets(), s.Histogram.Overflow())
+	}
+	if line := strings.Split(s.PrintHistogram(theme.Theme{}, stats.HistogramLayout{Terminal: 80}), "\n")[6]; !strings.HasPrefix(line, " >100ms : ") {
+		t.Fatalf("the overflow gets a row of its own: expected a >100ms row, got %q", line)
+	}
+
+	restored := stats.HistogramStateOf(&s.Histogram).Histogram()
+	if !slices.Equal(restored.Thresholds(), thresholds) || !slices.Equal(restored.Buckets(), s.Histogram.Buckets()) || restored.Overflow() != 1 {
+		t.Fatalf("a histogram reads back as it was written: expected %v %v +1, got %v %v +%d", thresholds, s.Histogram.Buckets(), restored.Thresholds(), restored.Buckets(), restored.Overflow())
+	}
+	var old stats.HistogramState
+	err = json.Unmarshal([]byte(`{"thresholds": [1, 10], "buckets": [3, 4], "total": 9}`), &old)
+	if older := old.Histogram(); err != nil || older.Overflow() != 2 {
+		t.Fatalf("an older file's overflow is what its buckets don't account for: expected 2, got %d, %v", older.Overflow(), err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	h := stats.NewHistogram(stats.DEFAULT_THRESHOLDS)
+	for range 1000 {
+		h.Update(time.Duration(rng.ExpFloat64() * float64(200*time.Millisecond)))
+	}
+	if same := h.Rebin(stats.DEFAULT_THRESHOLDS, 5*time.Second); !slices.Equal(same.Buckets(), h.Buckets()) || same.Overflow() != h.Overflow() {
+		t.Fatalf("re-binning into the same buckets changes nothing: expected %v +%d, got %v +%d", h.Buckets(), h.Overflow(), same.Buckets(), same.Overflow())
+	}
+	for _, into := range [][]time.Duration{stats.MillisecondThresholds(3, 7, 30, 300), stats.FitThresholds(100*time.Microsecond, 3*time.Second), stats.MillisecondThresholds(5000)} {
+		rebinned := rebinnedTotal(h.Rebin(into, 5*time.Second))
+		if rebinned != h.Total() {
+			t.Fatalf("re-binning keeps every sample: expected %d into %s, got %v", h.Total(), stats.FormatThresholds(into), rebinned)
+		}
+	}
+	halves := stats.NewHistogram(stats.MillisecondThresholds(10, 20, 30, 40))
+	for _, ms := range []int64{5, 5, 15, 25, 25, 25, 35, 45} {
+		halves.Update(time.Duration(ms) * time.Millisecond)
+	}
+	if merged := halves.Rebin(stats.MillisecondThresholds(20, 40), 50*time.Millisecond); !slices.Equal(merged.Buckets(), []int{3, 4}) || merged.Overflow() != 1 {
+		t.Fatalf("buckets that line up merge exactly: expected [3 4] +1, got %v +%d", merged.Buckets(), merged.Overflow())
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s = stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = now
+	s.AutoBuckets = &stats.AutoBuckets{}
+	feed := func(latencies ...time.Duration) {
+		for _, latency := range latencies {
+			now = now.Add(time.Second)
+			s.Update(latency)
+		}
+	}
+
+	feed(200*time.Microsecond, 300*time.Microsecond, 250*time.Microsecond, 400*time.Microsecond, 350*time.Microsecond)
+	if !slices.Equal(s.Histogram.Thresholds(), stats.DEFAULT_THRESHOLDS) {
+		t.Fatalf("buckets stay as they are through the first window: expected %q, got %q", stats.FormatThresholds(stats.DEFAULT_THRESHOLDS), stats.FormatThresholds(s.Histogram.Thresholds()))
+	}
+	feed(300 * time.Microsecond)
+	fitted := s.Histogram.Thresholds()
+	if len(fitted) != stats.AUTO_BUCKET_COUNT || fitted[0] > 100*time.Microsecond || fitted[len(fitted)-1] < 800*time.Microsecond || fitted[len(fitted)-1] > time.Millisecond {
+		t.Fatalf("buckets are fitted to the first window: expected %d buckets from 0.1ms to 0.8ms, got %q", stats.AUTO_BUCKET_COUNT, stats.FormatThresholds(fitted))
+	}
+	if s.Histogram.Total() != 6 || rebinnedTotal(s.Histogram) != 6 || s.Rolling.Total() != len(s.Recent) || s.Histogram.Buckets()[0] != 0 {
+		t.Fatalf("fitting keeps every sample and rebuilds the window: expected 6 samples, none in the first bucket, got %d (%v +%d), window %d of %d", s.Histogram.Total(), s.Histogram.Buckets(), s.Histogram.Overflow(), s.Rolling.Total(), len(s.Recent))
+	}
+	if !strings.Contains(s.PrintLastEvent(theme.Theme{}), "histogram fitted to 0.1ms-0.8ms") {
+		t.Fatalf("fitting is logged: expected histogram fitted to 0.1ms-0.8ms, got %q", s.PrintLastEvent(theme.Theme{}))
+	}
+
+	feed(50*time.Millisecond, 300*time.Microsecond, 300*time.Microsecond, 300*time.Microsecond)
+	if !slices.Equal(s.Histogram.Thresholds(), fitted) {
+		t.Fatalf("buckets are only refitted at the end of a window: expected %q, got %q", stats.FormatThresholds(fitted), stats.FormatThresholds(s.Histogram.Thresholds()))
+	}
+	feed(300 * time.Microsecond)
+	refitted := s.Histogram.Thresholds()
+	if refitted[len(refitted)-1] < 100*time.Millisecond || s.Histogram.Total() != 11 || rebinnedTotal(s.Histogram) != 11 || s.Histogram.Overflow() != 0 {
+		t.Fatalf("a sample past the last bucket refits them, keeping every sample: expected up to 100ms, 11 samples, no overflow, got %s, %d samples (%v +%d)", stats.FormatThresholds(refitted), s.Histogram.Total(), s.Histogram.Buckets(), s.Histogram.Overflow())
+	}
+
+	feed(300*time.Microsecond, 300*time.Microsecond, 300*time.Microsecond, 300*time.Microsecond, 300*time.Microsecond, 300*time.Microsecond)
+	if !slices.Equal(s.Histogram.Thresholds(), refitted) {
+		t.Fatalf("buckets that fit aren't refitted: expected %q, got %q", stats.FormatThresholds(refitted), stats.FormatThresholds(s.Histogram.Thresholds()))
+	}
+}
+
+func rebinnedTotal(h stats.Histogram) int {
+	total := h.Overflow()
+	for _, count := range h.Buckets() {
+		total += count
+	}
+
+	return total
+}
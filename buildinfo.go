@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+func printVersion(out io.Writer, asJSON bool) error {
+	info := tui.CurrentBuild()
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	revision := info.Revision
+	if revision == "" {
+		revision = "unknown"
+	}
+	if info.Dirty {
+		revision += " (dirty)"
+	}
+
+	var backends []string
+	for _, b := range info.Backends {
+		switch {
+		case !b.Available:
+			backends = append(backends, fmt.Sprintf("%s (unavailable: %s)", b.Name, b.Detail))
+		case b.Detail != "":
+			backends = append(backends, fmt.Sprintf("%s (%s)", b.Name, b.Detail))
+		default:
+			backends = append(backends, b.Name)
+		}
+	}
+
+	fmt.Fprintf(out, "network-test %s\n", info.Version)
+	fmt.Fprintf(out, "Revision: %s\n", revision)
+	fmt.Fprintf(out, "Go:       %s %s/%s\n", info.GoVersion, info.OS, info.Arch)
+	fmt.Fprintf(out, "Features: %s\n", strings.Join(info.Features, ", "))
+	fmt.Fprintf(out, "Backends: %s\n", strings.Join(backends, ", "))
+
+	return nil
+}
+
+func versionCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "version",
+		Usage: "print the build and which probe backends work here, for bug reports",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print it as JSON, as --version --json does",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return printVersion(os.Stdout, c.Bool("json"))
+		},
+	}
+}
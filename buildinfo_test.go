@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// TestVersion runs the app with --version --json and checks what
+// it prints is the documented JSON, every column there and nothing else, and
+// that /healthz serves the same build.
+func TestVersion(t *testing.T) {
+	var buffer bytes.Buffer
+	app := newApp()
+	app.Writer = &buffer
+	if err := app.Run([]string{"network-test", "--version", "--json"}); err != nil {
+		t.Fatalf("--version --json runs: expected no error, got %v", err)
+	}
+	out := buffer.Bytes()
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("--version --json prints a JSON object: expected an object, got %q", string(out))
+	}
+	for _, column := range tui.VERSION_COLUMNS {
+		if _, ok := fields[column.Name]; !ok && column.Name != "revision" {
+			t.Fatalf("--version --json has every documented field: expected %q, got %q", column.Name, string(out))
+		}
+		delete(fields, column.Name)
+	}
+	for name := range fields {
+		t.Fatalf("--version --json has only documented fields: expected nothing more, got %q", name)
+	}
+
+	var info stats.BuildInfo
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&info); err != nil {
+		t.Fatalf("--version --json parses as the build: expected no error, got %v", err)
+	}
+	if info.GoVersion != runtime.Version() || info.OS != runtime.GOOS || len(info.Backends) == 0 {
+		t.Fatalf("--version --json describes this build: expected %s on %s, with backends, got %s on %s, %d backends", runtime.Version(), runtime.GOOS, info.GoVersion, info.OS, len(info.Backends))
+	}
+
+	recorder := httptest.NewRecorder()
+	tui.ServeHealth(recorder, httptest.NewRequest("GET", tui.HEALTHZ_PATH, nil))
+	var health struct {
+		Status string          `json:"status"`
+		Build  stats.BuildInfo `json:"build"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil || health.Status != "ok" || health.Build.GoVersion != info.GoVersion || health.Build.Revision != info.Revision {
+		t.Fatalf("/healthz serves the build:\nexpected:\n%s\ngot:\n%s", string(out), recorder.Body.String())
+	}
+}
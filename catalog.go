@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/catalog"
+	"ponglehub.co.uk/nettest/pkg/schedule"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+type catalogModel struct {
+	ctx      context.Context
+	name     string
+	entries  []catalog.Entry
+	interval time.Duration
+	theme    theme.Theme
+	stats    []*stats.Stats
+	failures []int
+	probes   []int
+	last     []checkResult
+	sampler  *schedule.Sampler
+	started  time.Time
+
+	window    time.Duration
+	groupBy   string
+	groups    []catalogGroup
+	groupedAt time.Time
+	collapsed bool
+	sort      int
+	filter    string
+	keys      tui.KeyMap
+
+	invalid      []int
+	alertInvalid float64
+}
+
+type catalogConfig struct {
+	name     string
+	path     string
+	interval time.Duration
+	window   time.Duration
+	theme    theme.Theme
+	sampler  *schedule.Sampler
+	groupBy  string
+	filter   string
+	summary  string
+	keys     tui.KeyMap
+	// alertInvalid is the share of probes failing validation, as a
+	// fraction, past which an endpoint is in alert.
+	alertInvalid float64
+}
+
+type catalogResults []checkResult
+
+func newCatalogModel(ctx context.Context, entries []catalog.Entry, cfg catalogConfig) catalogModel {
+	m := catalogModel{
+		ctx:      ctx,
+		name:     cfg.name,
+		entries:  entries,
+		interval: cfg.interval,
+		theme:    cfg.theme,
+		failures: make([]int, len(entries)),
+		probes:   make([]int, len(entries)),
+		last:     make([]checkResult, len(entries)),
+		sampler:  cfg.sampler,
+		started:  time.Now(),
+
+		window:  cfg.window,
+		groupBy: cfg.groupBy,
+		filter:  cfg.filter,
+		keys:    cfg.keys,
+
+		invalid:      make([]int, len(entries)),
+		alertInvalid: cfg.alertInvalid,
+	}
+
+	for range entries {
+		s := stats.New(cfg.interval, cfg.window, stats.DEFAULT_THRESHOLDS)
+		m.stats = append(m.stats, &s)
+	}
+
+	return m
+}
+
+// probeAll probes every entry, or the subset the sampler picks for this tick.
+// Results carry the entry's index in Line.
+func (m catalogModel) probeAll() tea.Msg {
+	var picked []int
+	if m.sampler != nil {
+		picked = m.sampler.Pick(len(m.entries), m.interval)
+	} else {
+		for i := range m.entries {
+			picked = append(picked, i)
+		}
+	}
+
+	targets := make([]checkTarget, len(picked))
+	for j, i := range picked {
+		entry := m.entries[i]
+		targets[j] = checkTarget{Line: i, Mode: entry.Mode, Host: entry.Host, Port: entry.Port, Send: entry.Send, ExpectPrefix: entry.ExpectPrefix}
+	}
+
+	results := make(catalogResults, 0, len(targets))
+	check(m.ctx, targets, m.interval, len(targets), false, func(r checkResult) {
+		results = append(results, r)
+	})
+
+	return results
+}
+
+func (m catalogModel) Init() tea.Cmd {
+	return m.probeAll
+}
+
+func (m catalogModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == tui.RESERVED_KEY {
+			return m, tea.Quit
+		}
+		switch m.keys.Action(tui.KEYS_CATALOG, msg.String()) {
+		case "quit":
+			return m, tea.Quit
+		case "collapse":
+			if m.groupBy != "" {
+				m.collapsed = !m.collapsed
+			}
+		case "sort":
+			m.sort = (m.sort + 1) % len(CATALOG_SORTS)
+		}
+	case catalogResults:
+		if m.ctx.Err() != nil {
+			return m, tea.Quit
+		}
+
+		for _, result := range msg {
+			i := result.Line
+			m.probes[i]++
+			m.last[i] = result
+			if result.OK {
+				m.stats[i].Update(time.Duration(result.RTTMs * float64(time.Millisecond)))
+			} else {
+				m.failures[i]++
+			}
+			if result.Degraded {
+				m.invalid[i]++
+			}
+		}
+
+		if m.groupBy != "" && (m.groups == nil || time.Since(m.groupedAt) >= m.window) {
+			m.regroup()
+		}
+
+		return m, tea.Tick(m.interval, func(time.Time) tea.Msg { return m.probeAll() })
+	}
+
+	return m, nil
+}
+
+// degraded flags an endpoint whose latest probe failed or whose recent
+// average has drifted well above the best it has managed this run.
+func (m catalogModel) degraded(i int) bool {
+	if !m.last[i].OK {
+		return true
+	}
+
+	if m.alertInvalid > 0 && m.probes[i] > 0 && float64(m.invalid[i])/float64(m.probes[i]) > m.alertInvalid {
+		return true
+	}
+
+	s := m.stats[i]
+	if s.Totals.Count < 3 {
+		return false
+	}
+
+	recent := s.Window
+	if recent.Count == 0 {
+		recent = s.LastWindow
+	}
+
+	return recent.Average() > 2*s.Totals.Min+20*time.Millisecond
+}
+
+func (m catalogModel) View() string {
+	header := fmt.Sprintf("CATALOGUE: %s (%d endpoints, interval: %s)", m.name, len(m.entries), m.interval)
+	if m.sampler != nil {
+		header += fmt.Sprintf(", sampling %.3g probes/s per endpoint", m.sampler.PerHostRate(len(m.entries), m.interval))
+	}
+
+	controls := "sort: " + CATALOG_SORTS[m.sort] + " (" + m.keys.Label("sort") + ")"
+	if m.groupBy != "" {
+		controls += ", grouped by " + m.groupBy + " (" + m.keys.Label("collapse") + " to collapse)"
+	}
+	if m.filter != "" {
+		controls += ", filter: " + m.filter
+	}
+
+	columns := fmt.Sprintf("%-28s %-36s %8s %8s %8s %8s %6s %6s", "Endpoint", "Target", "Last", "Min", "Avg", "Max", "Fails", "Loss")
+	validating := m.validating()
+	if validating {
+		columns += fmt.Sprintf(" %6s", "Degr")
+	}
+	if m.sampler != nil {
+		columns += fmt.Sprintf(" %8s", "Rate")
+	}
+
+	lines := []string{
+		m.theme.Header.Render(header),
+		m.theme.Muted.Render(controls),
+		"",
+		columns,
+	}
+	elapsed := time.Since(m.started).Seconds()
+
+	var bad []string
+	probed := false
+	for i := range m.entries {
+		if m.last[i].Mode != "" {
+			probed = true
+			if m.degraded(i) {
+				bad = append(bad, m.entries[i].Label)
+			}
+		}
+	}
+
+	for _, r := range m.visibleRows() {
+		if r.group != nil {
+			style := m.theme.Header
+			if r.group.Alerting > 0 {
+				style = m.theme.Bad
+			}
+			lines = append(lines, style.Render(m.groupRow(*r.group)))
+			continue
+		}
+
+		i, entry := r.entry, m.entries[r.entry]
+		target := entry.Mode + " " + entry.Host
+		if entry.Port != "" {
+			target += ":" + entry.Port
+		}
+
+		last := "-"
+		style := m.theme.Muted
+		if m.last[i].Mode != "" {
+			style = m.theme.Good
+			if m.last[i].OK {
+				last = fmt.Sprintf("%.1fms", m.last[i].RTTMs)
+			} else {
+				last = m.last[i].Failure
+			}
+			if m.last[i].Degraded {
+				style = m.theme.Warn
+			}
+			if m.degraded(i) {
+				style = m.theme.Bad
+			}
+		}
+
+		totals := m.stats[i].Totals
+		loss := "-"
+		if m.probes[i] > 0 {
+			loss = fmt.Sprintf("%.1f%%", m.lossPercent(i))
+		}
+		row := fmt.Sprintf("%-28s %-36s %8s %8s %8s %8s %6d %6s", entry.Label, target, last, stats.FormatLatency(totals.Min), stats.FormatLatency(totals.Average()), stats.FormatLatency(totals.Max), m.failures[i], loss)
+		if validating {
+			row += fmt.Sprintf(" %6d", m.invalid[i])
+		}
+		if m.sampler != nil && elapsed > 0 {
+			row += fmt.Sprintf(" %6.2f/s", float64(m.probes[i])/elapsed)
+		}
+		lines = append(lines, style.Render(row))
+	}
+
+	lines = append(lines, "")
+	switch {
+	case !probed:
+		lines = append(lines, "Waiting for the first round of probes...")
+	case len(bad) == len(m.entries):
+		lines = append(lines, m.theme.Alert.Render("Every endpoint is degraded - the problem is most likely local to your connection."))
+	case len(bad) > 0:
+		lines = append(lines, m.theme.Warn.Render("Degradation looks path-specific: "+strings.Join(bad, ", ")))
+	default:
+		lines = append(lines, m.theme.Good.Render("All endpoints look healthy."))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// validating is true when any endpoint checks its responses, which is when
+// the degraded column is worth its space.
+func (m catalogModel) validating() bool {
+	for _, entry := range m.entries {
+		if entry.Send != "" || entry.ExpectPrefix != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func runCatalog(ctx context.Context, cfg catalogConfig) error {
+	entries, err := catalog.Load(cfg.name, cfg.path)
+	if err != nil {
+		return err
+	}
+
+	final, err := tea.NewProgram(newCatalogModel(ctx, entries, cfg)).Run()
+	if err != nil {
+		return err
+	}
+
+	if cfg.summary != "" {
+		return final.(catalogModel).writeSummary(cfg.summary)
+	}
+
+	return nil
+}
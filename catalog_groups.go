@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/catalog"
+	"ponglehub.co.uk/nettest/pkg/history"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const GROUP_BY_PREFIX = "prefix"
+
+var CATALOG_SORTS = []string{"order", "loss", "avg"}
+
+// catalogGroup aggregates the endpoints sharing a grouping key. It is
+// recomputed at each window rollover rather than on every probe.
+type catalogGroup struct {
+	Name        string  `json:"name"`
+	Hosts       int     `json:"hosts"`
+	WorstLoss   float64 `json:"worst_loss_pct"`
+	MedianAvgMs float64 `json:"median_avg_ms"`
+	Alerting    int     `json:"alerting"`
+	members     []int
+}
+
+// groupKey is the label prefix up to the first space, or the value of the
+// tag named by, e.g. "dc=ams".
+func groupKey(entry catalog.Entry, by string) string {
+	if by == GROUP_BY_PREFIX {
+		prefix, _, _ := strings.Cut(entry.Label, " ")
+		return prefix
+	}
+
+	if value, ok := entry.Tags[by]; ok {
+		return by + "=" + value
+	}
+
+	return "(no " + by + ")"
+}
+
+// lossPercent is the share of probes sent to entry i that failed.
+func (m catalogModel) lossPercent(i int) float64 {
+	if m.probes[i] == 0 {
+		return 0
+	}
+
+	return float64(m.failures[i]) / float64(m.probes[i]) * 100
+}
+
+// recentAverage prefers the window in progress, then the last complete one.
+func (m catalogModel) recentAverage(i int) time.Duration {
+	s := m.stats[i]
+	for _, w := range []stats.Window{s.Window, s.LastWindow, s.Totals} {
+		if w.Count > 0 {
+			return w.Average()
+		}
+	}
+
+	return 0
+}
+
+func (m *catalogModel) regroup() {
+	var groups []catalogGroup
+	index := map[string]int{}
+
+	for i, entry := range m.entries {
+		key := groupKey(entry, m.groupBy)
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, catalogGroup{Name: key})
+		}
+		groups[g].members = append(groups[g].members, i)
+	}
+
+	for g := range groups {
+		group := &groups[g]
+		group.Hosts = len(group.members)
+
+		var averages []int64
+		for _, i := range group.members {
+			group.WorstLoss = max(group.WorstLoss, m.lossPercent(i))
+			if m.stats[i].Totals.Count > 0 {
+				averages = append(averages, int64(m.recentAverage(i)))
+			}
+			if m.last[i].Mode != "" && m.degraded(i) {
+				group.Alerting++
+			}
+		}
+		group.MedianAvgMs = stats.Milliseconds(time.Duration(history.Median(averages)))
+	}
+
+	m.groups = groups
+	m.groupedAt = time.Now()
+}
+
+// sortEntries orders endpoint indexes by the current sort key, worst first,
+// keeping catalogue order among equals.
+func (m catalogModel) sortEntries(indexes []int) []int {
+	sorted := slices.Clone(indexes)
+	switch CATALOG_SORTS[m.sort] {
+	case "loss":
+		slices.SortStableFunc(sorted, func(a, b int) int { return compareDesc(m.lossPercent(a), m.lossPercent(b)) })
+	case "avg":
+		slices.SortStableFunc(sorted, func(a, b int) int { return compareDesc(m.recentAverage(a), m.recentAverage(b)) })
+	}
+
+	return sorted
+}
+
+func (m catalogModel) sortGroups(groups []catalogGroup) []catalogGroup {
+	sorted := slices.Clone(groups)
+	switch CATALOG_SORTS[m.sort] {
+	case "loss":
+		slices.SortStableFunc(sorted, func(a, b catalogGroup) int { return compareDesc(a.WorstLoss, b.WorstLoss) })
+	case "avg":
+		slices.SortStableFunc(sorted, func(a, b catalogGroup) int { return compareDesc(a.MedianAvgMs, b.MedianAvgMs) })
+	}
+
+	return sorted
+}
+
+func compareDesc[T time.Duration | float64](a T, b T) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m catalogModel) matches(name string) bool {
+	return m.filter == "" || strings.Contains(strings.ToLower(name), strings.ToLower(m.filter))
+}
+
+// visibleRows lists what the table shows: groups alone when collapsed, or
+// each group followed by its members. Sorting and the filter apply to
+// whichever level is showing.
+func (m catalogModel) visibleRows() []catalogRow {
+	var rows []catalogRow
+
+	if m.groupBy == "" {
+		var indexes []int
+		for i, entry := range m.entries {
+			if m.matches(entry.Label) {
+				indexes = append(indexes, i)
+			}
+		}
+		for _, i := range m.sortEntries(indexes) {
+			rows = append(rows, catalogRow{entry: i})
+		}
+		return rows
+	}
+
+	for _, group := range m.sortGroups(m.groups) {
+		if m.collapsed {
+			if m.matches(group.Name) {
+				rows = append(rows, catalogRow{group: &group, entry: -1})
+			}
+			continue
+		}
+
+		var members []int
+		for _, i := range group.members {
+			if m.matches(m.entries[i].Label) {
+				members = append(members, i)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+
+		rows = append(rows, catalogRow{group: &group, entry: -1})
+		for _, i := range m.sortEntries(members) {
+			rows = append(rows, catalogRow{entry: i})
+		}
+	}
+
+	return rows
+}
+
+type catalogRow struct {
+	group *catalogGroup
+	entry int
+}
+
+func (m catalogModel) groupRow(group catalogGroup) string {
+	marker := "▾ "
+	if m.collapsed {
+		marker = "▸ "
+	}
+
+	summary := fmt.Sprintf("%d hosts, %d in alert", group.Hosts, group.Alerting)
+	return fmt.Sprintf("%-28s %-36s %8s %8s %8s %8s %6s %5.1f%%", marker+group.Name, summary, "", "", stats.FormatMillis(group.MedianAvgMs), "", "", group.WorstLoss)
+}
+
+type catalogHost struct {
+	Label    string            `json:"label"`
+	Host     string            `json:"host"`
+	Mode     string            `json:"mode"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Group    string            `json:"group,omitempty"`
+	Probes   int               `json:"probes"`
+	Failures int               `json:"failures"`
+	LossPct  float64           `json:"loss_pct"`
+	Totals   stats.Window      `json:"totals"`
+}
+
+type catalogSummary struct {
+	Name    string         `json:"name"`
+	Started time.Time      `json:"started"`
+	Ended   time.Time      `json:"ended"`
+	GroupBy string         `json:"group_by,omitempty"`
+	Hosts   []catalogHost  `json:"hosts"`
+	Groups  []catalogGroup `json:"groups,omitempty"`
+}
+
+func (m catalogModel) writeSummary(path string) error {
+	summary := catalogSummary{Name: m.name, Started: m.started, Ended: time.Now(), GroupBy: m.groupBy}
+	if m.groupBy != "" {
+		m.regroup()
+		summary.Groups = m.groups
+	}
+
+	for i, entry := range m.entries {
+		host := catalogHost{
+			Label:    entry.Label,
+			Host:     entry.Host,
+			Mode:     entry.Mode,
+			Tags:     entry.Tags,
+			Probes:   m.probes[i],
+			Failures: m.failures[i],
+			LossPct:  m.lossPercent(i),
+			Totals:   m.stats[i].Totals,
+		}
+		if m.groupBy != "" {
+			host.Group = groupKey(entry, m.groupBy)
+		}
+		summary.Hosts = append(summary.Hosts, host)
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode catalogue summary: %s", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write catalogue summary: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+const DEFAULT_READ_TIMEOUT = 2 * time.Second
+
+type checkTarget struct {
+	Line int    `json:"line"`
+	Mode string `json:"mode"`
+	Host string `json:"host"`
+	Port string `json:"port,omitempty"`
+
+	// Send and ExpectPrefix validate what a tcp endpoint says once
+	// connected, waiting up to ReadTimeout for it regardless of how long
+	// the connect took.
+	Send         string        `json:"-"`
+	ExpectPrefix string        `json:"-"`
+	ReadTimeout  time.Duration `json:"-"`
+}
+
+type checkResult struct {
+	checkTarget
+	OK      bool    `json:"ok"`
+	RTTMs   float64 `json:"rtt_ms,omitempty"`
+	Failure string  `json:"failure,omitempty"`
+	Error   string  `json:"error,omitempty"`
+	// Degraded probes connected, so have a latency, but failed validation.
+	Degraded   bool   `json:"degraded,omitempty"`
+	Validation string `json:"validation,omitempty"`
+}
+
+func checkCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "check",
+		Usage: "probe each target read from stdin once and report the results",
+		UsageText: `network-test check [options] < targets.txt
+
+Each line of input is "icmp host" or "tcp host port".
+
+Examples:
+   printf 'icmp 1.1.1.1\ntcp example.com 443\n' | network-test check
+   network-test check --timeout 2s --format json --fail-fast < targets.txt
+   echo 'tcp redis.internal 6379' | network-test check --send 'PING\r\n' --expect-prefix '+PONG'`,
+		Flags: []cli.Flag{
+			&cli.GenericFlag{
+				Name:  "timeout",
+				Value: duration.New(2*time.Second, time.Second),
+				Usage: "timeout for each probe; a bare number is seconds",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: "output format, text or json",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Value: 16,
+				Usage: "maximum number of probes in flight",
+			},
+			&cli.BoolFlag{
+				Name:  "fail-fast",
+				Usage: "stop at the first failed target, reporting those left unprobed as not checked rather than failed",
+			},
+			&cli.StringFlag{
+				Name:  "send",
+				Usage: "bytes to send to tcp targets once connected, with Go escapes such as \\r\\n",
+			},
+			&cli.StringFlag{
+				Name:  "expect-prefix",
+				Usage: "tcp targets whose response doesn't start with this are reported degraded, with Go escapes",
+			},
+			&cli.GenericFlag{
+				Name:  "read-timeout",
+				Value: duration.New(DEFAULT_READ_TIMEOUT, time.Second),
+				Usage: "how long to wait for a tcp response to validate, separate from the connect timeout; a bare number is seconds",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			format := c.String("format")
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unknown format %q, expected text or json", format)
+			}
+
+			targets, err := readTargets(os.Stdin)
+			if err != nil {
+				return err
+			}
+
+			send, err := unescape(c.String("send"))
+			if err != nil {
+				return err
+			}
+			prefix, err := unescape(c.String("expect-prefix"))
+			if err != nil {
+				return err
+			}
+			for i := range targets {
+				if targets[i].Mode == "tcp" {
+					targets[i].Send, targets[i].ExpectPrefix, targets[i].ReadTimeout = send, prefix, durationOf(c, "read-timeout")
+				}
+			}
+
+			degraded := 0
+			failed, unchecked := check(c.Context, targets, durationOf(c, "timeout"), c.Int("concurrency"), c.Bool("fail-fast"), func(r checkResult) {
+				if r.Degraded {
+					degraded++
+				}
+				printCheckResult(os.Stdout, format, r)
+			})
+
+			if failed > 0 || degraded > 0 || unchecked > 0 {
+				message := fmt.Sprintf("%d of %d targets failed, %d degraded", failed, len(targets), degraded)
+				if unchecked > 0 {
+					message += fmt.Sprintf(", %d not checked", unchecked)
+				}
+				return cli.Exit(message, 1)
+			}
+
+			return nil
+		},
+	}
+}
+
+func readTargets(r io.Reader) ([]checkTarget, error) {
+	var targets []checkTarget
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		target := checkTarget{Line: line, Mode: fields[0]}
+
+		switch {
+		case target.Mode == "icmp" && len(fields) == 2:
+			target.Host = fields[1]
+		case target.Mode == "tcp" && len(fields) == 3:
+			target.Host = fields[1]
+			target.Port = fields[2]
+		default:
+			return nil, fmt.Errorf("line %d: expected 'icmp host' or 'tcp host port', got %q", line, text)
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, scanner.Err()
+}
+
+// probeTarget probes a single target. It is a variable so that tests can
+// substitute a fake.
+var probeTarget = probeOnce
+
+// check probes every target using a bounded pool and emits the results in
+// input order, returning the number of failures and of targets cancelled
+// before they were checked, such as by --fail-fast.
+func check(ctx context.Context, targets []checkTarget, timeout time.Duration, concurrency int, failFast bool, emit func(checkResult)) (int, int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]chan checkResult, len(targets))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		results[i] = make(chan checkResult, 1)
+
+		wg.Add(1)
+		go func(target checkTarget, out chan checkResult) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				out <- checkResult{checkTarget: target, Failure: "cancelled"}
+				return
+			}
+
+			out <- probeTarget(ctx, target, timeout)
+		}(target, results[i])
+	}
+
+	failed, unchecked := 0, 0
+	for _, result := range results {
+		r := <-result
+		emit(r)
+
+		switch {
+		case r.OK:
+		case r.Failure == "cancelled":
+			unchecked++
+		default:
+			failed++
+			if failFast {
+				cancel()
+			}
+		}
+	}
+
+	wg.Wait()
+
+	return failed, unchecked
+}
+
+func probeOnce(ctx context.Context, target checkTarget, timeout time.Duration) checkResult {
+	result := checkResult{checkTarget: target}
+
+	var rtt time.Duration
+	var err error
+
+	switch target.Mode {
+	case "icmp":
+		rtt, err = ping.Once(ctx, target.Host, timeout)
+	case "tcp":
+		dialer := net.Dialer{Timeout: timeout}
+		start := time.Now()
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.Host, target.Port))
+		rtt = time.Since(start)
+		if err == nil {
+			result.Validation = validateTCP(conn, target)
+			conn.Close()
+		}
+	}
+
+	if err != nil {
+		result.Failure = classifyFailure(ctx, err)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.OK = true
+	result.RTTMs = float64(rtt.Microseconds()) / 1000
+	result.Degraded = result.Validation != ""
+
+	return result
+}
+
+// validateTCP sends the target's payload and checks the start of the reply,
+// returning why it failed, or nothing if it passed or there's nothing to
+// check.
+func validateTCP(conn net.Conn, target checkTarget) string {
+	if target.Send == "" && target.ExpectPrefix == "" {
+		return ""
+	}
+
+	timeout := target.ReadTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_READ_TIMEOUT
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if target.Send != "" {
+		if _, err := io.WriteString(conn, target.Send); err != nil {
+			return "send failed: " + err.Error()
+		}
+	}
+
+	if target.ExpectPrefix == "" {
+		return ""
+	}
+
+	reply := make([]byte, len(target.ExpectPrefix))
+	n, err := io.ReadFull(conn, reply)
+	if string(reply[:n]) == target.ExpectPrefix {
+		return ""
+	}
+
+	var netErr net.Error
+	switch {
+	case n == 0 && errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Sprintf("no response within %s", timeout)
+	case n == 0:
+		return "closed without a response"
+	default:
+		return fmt.Sprintf("expected %q, got %q", target.ExpectPrefix, reply[:n])
+	}
+}
+
+// unescape reads Go escape sequences, so that a flag can carry \r\n.
+func unescape(text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+
+	unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(text, `"`, `\"`) + `"`)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %q, escapes must be valid Go escapes such as \\r\\n", text)
+	}
+
+	return unquoted, nil
+}
+
+func classifyFailure(ctx context.Context, err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var permErr *ping.PermissionError
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return "cancelled"
+	case errors.As(err, &permErr):
+		return "permission"
+	case errors.As(err, &dnsErr):
+		return "unresolved"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH), errors.Is(err, ping.ErrUnreachable):
+		return "unreachable"
+	case errors.Is(err, ping.ErrNoReply), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case strings.Contains(err.Error(), "unknown host"), strings.Contains(err.Error(), "Name or service not known"):
+		return "unresolved"
+	default:
+		return "error"
+	}
+}
+
+func printCheckResult(w io.Writer, format string, r checkResult) {
+	if format == "json" {
+		data, _ := json.Marshal(r)
+		fmt.Fprintln(w, string(data))
+		return
+	}
+
+	target := r.Mode + " " + r.Host
+	if r.Port != "" {
+		target += " " + r.Port
+	}
+
+	if r.Degraded {
+		fmt.Fprintf(w, "DEGR %s %.2fms %s\n", target, r.RTTMs, r.Validation)
+	} else if r.OK {
+		fmt.Fprintf(w, "OK   %s %.2fms\n", target, r.RTTMs)
+	} else if r.Failure == "cancelled" {
+		fmt.Fprintf(w, "SKIP %s not checked\n", target)
+	} else {
+		fmt.Fprintf(w, "FAIL %s %s\n", target, r.Failure)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidation probes a local listener that answers PING with
+// +PONG, anything else with an error, and SLOW not at all, checking each is
+// classified and that the read timeout is separate from the connect one.
+func TestValidation(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: expected no error, got %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				request := make([]byte, 6)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				switch string(request) {
+				case "PING\r\n":
+					io.WriteString(conn, "+PONG\r\n")
+				case "SLOW\r\n":
+					time.Sleep(time.Second)
+				default:
+					io.WriteString(conn, "-ERR\r\n")
+				}
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	cases := []struct {
+		send       string
+		degraded   bool
+		validation string
+	}{
+		{"PING\r\n", false, ""},
+		{"HELO\r\n", true, `expected "+PONG", got "-ERR\r"`},
+		{"SLOW\r\n", true, "no response within 200ms"},
+	}
+
+	for _, c := range cases {
+		target := checkTarget{Mode: "tcp", Host: host, Port: port, Send: c.send, ExpectPrefix: "+PONG", ReadTimeout: 200 * time.Millisecond}
+		result := probeOnce(context.Background(), target, 5*time.Second)
+
+		if !result.OK || result.Degraded != c.degraded || result.Validation != c.validation {
+			t.Fatalf("probe sending %q: expected ok, degraded %t, %q, got ok %t, degraded %t, %q", c.send, c.degraded, c.validation, result.OK, result.Degraded, result.Validation)
+		}
+	}
+}
+
+// TestFailFast fails the first of four targets, with the next still being
+// probed and the rest waiting on it, and checks that with --fail-fast the
+// others are counted as not checked rather than as failures.
+func TestFailFast(t *testing.T) {
+	probe := probeTarget
+	defer func() { probeTarget = probe }()
+	probeTarget = func(ctx context.Context, target checkTarget, timeout time.Duration) checkResult {
+		if target.Line == 1 {
+			return checkResult{checkTarget: target, Failure: "refused"}
+		}
+		<-ctx.Done()
+		return checkResult{checkTarget: target, Failure: classifyFailure(ctx, ctx.Err())}
+	}
+
+	var targets []checkTarget
+	for line := 1; line <= 4; line++ {
+		targets = append(targets, checkTarget{Line: line, Mode: "tcp", Host: "192.0.2.1", Port: "80"})
+	}
+
+	var out strings.Builder
+	failed, unchecked := check(context.Background(), targets, time.Second, 2, true, func(r checkResult) { printCheckResult(&out, "text", r) })
+	if failed != 1 || unchecked != 3 {
+		t.Fatalf("--fail-fast: expected 1 failed, 3 not checked, got %d failed, %d not checked", failed, unchecked)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 4 || lines[0] != "FAIL tcp 192.0.2.1 80 refused" || lines[3] != "SKIP tcp 192.0.2.1 80 not checked" {
+		t.Fatalf("--fail-fast: expected a FAIL then SKIPs, got %q", lines)
+	}
+}
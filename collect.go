@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+	"ponglehub.co.uk/nettest/pkg/history"
+	"ponglehub.co.uk/nettest/pkg/tui"
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+const (
+	COLLECT_MAX_BATCH = 16 << 20
+	COLLECT_SOURCES   = "/sources"
+	COLLECT_AGGREGATE = "/aggregate"
+	// COLLECT_FILE_SUFFIX is the file each source's batches are kept in,
+	// a line each, under --data.
+	COLLECT_FILE_SUFFIX = ".jsonl"
+)
+
+// collectedBatch is a batch as it's kept on disk, with when it arrived.
+type collectedBatch struct {
+	Received time.Time `json:"received"`
+	tui.ForwardBatch
+}
+
+// collectedRun is one run a source has forwarded, tracked by its run ID.
+type collectedRun struct {
+	RunID   string    `json:"run_id"`
+	Target  string    `json:"target"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Batches int       `json:"batches"`
+	Samples int       `json:"samples"`
+	Dropped int       `json:"dropped_samples,omitempty"`
+}
+
+// collectedSource is everything a source has forwarded: its latest stats
+// and each of its runs, newest last.
+type collectedSource struct {
+	Source   string             `json:"source"`
+	Stats    *tui.StatsDocument `json:"stats"`
+	LastSeen time.Time          `json:"last_seen"`
+	Stale    bool               `json:"stale"`
+	Runs     []collectedRun     `json:"runs"`
+}
+
+// collector takes batches from instances run with --forward, keeping each
+// source's in a file of its own under dir so that they survive a restart.
+type collector struct {
+	dir        string
+	secret     []byte
+	staleAfter time.Duration
+
+	mu      sync.Mutex
+	sources map[string]*collectedSource
+	// notify is told of each new source and run, for the command to print.
+	notify func(string)
+}
+
+func collectCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "collect",
+		Usage: "take the stats forwarded by instances run with --forward, keep them, and serve them for all of them together",
+		UsageText: `network-test collect --listen address --secret-env NAME [options]
+
+Instances forward to it with --forward and the same secret:
+   network-test --forward collector:9400 --forward-secret-env NETTEST_SECRET --label site=site-a example.com
+
+It serves:
+   /sources          every source with its latest stats and runs
+   /aggregate        the merged summary, as aggregate --export writes it
+   /stats/<source>   a source's latest stats, for aggregate --from
+
+Examples:
+   network-test collect --listen :9400 --secret-env NETTEST_SECRET
+   network-test aggregate --from http://collector:9400/stats/site-a --from http://collector:9400/stats/site-b`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "listen",
+				Usage:    "address to take batches on and serve from, such as :9400",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "secret-env",
+				Usage:    "environment variable holding the secret shared with the instances, which every batch has to be signed with",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "data",
+				Usage: "directory batches are kept in (default: network-test/collector in the XDG data dir)",
+			},
+			&cli.GenericFlag{
+				Name:  "stale-after",
+				Value: duration.New(time.Minute, time.Second),
+				Usage: "how long a source can go without forwarding before it's shown stale; a bare number is seconds",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			secret := os.Getenv(c.String("secret-env"))
+			if secret == "" {
+				return fmt.Errorf("--secret-env names %s, but it is not set", c.String("secret-env"))
+			}
+
+			dir := c.String("data")
+			if dir == "" {
+				path, err := history.DefaultPath()
+				if err != nil {
+					return err
+				}
+				dir = filepath.Join(filepath.Dir(path), "collector")
+			}
+
+			col, err := newCollector(dir, []byte(secret), durationOf(c, "stale-after"))
+			if err != nil {
+				return err
+			}
+			col.notify = func(message string) { fmt.Println(message) }
+
+			server, address, err := col.listen(c.String("listen"))
+			if err != nil {
+				return err
+			}
+			defer server.Close()
+			fmt.Printf("collecting on %s, keeping batches in %s\n", address, dir)
+
+			ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			<-ctx.Done()
+
+			return nil
+		},
+	}
+}
+
+// newCollector reads back the batches already kept in dir.
+func newCollector(dir string, secret []byte, staleAfter time.Duration) (*collector, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create collector data directory: %s", err)
+	}
+
+	c := &collector{dir: dir, secret: secret, staleAfter: staleAfter, sources: map[string]*collectedSource{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+COLLECT_FILE_SUFFIX))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collected batches: %s", err)
+	}
+	for _, path := range files {
+		if err := c.replay(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// replay reads a source's file, skipping a last line cut short by the
+// collector stopping mid-write.
+func (c *collector) replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read collected batches: %s", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, COLLECT_MAX_BATCH)
+	for scanner.Scan() {
+		var batch collectedBatch
+		if err := json.Unmarshal(scanner.Bytes(), &batch); err != nil {
+			continue
+		}
+		c.record(batch)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read collected batches from %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// record takes a batch into the source and run it belongs to.
+func (c *collector) record(batch collectedBatch) {
+	source := c.sources[batch.Source]
+	if source == nil {
+		source = &collectedSource{Source: batch.Source}
+		c.sources[batch.Source] = source
+		c.tell(fmt.Sprintf("%s: first batch", batch.Source))
+	}
+
+	stats := batch.Stats
+	source.Stats, source.LastSeen = &stats, batch.Received
+
+	i := slices.IndexFunc(source.Runs, func(r collectedRun) bool { return r.RunID == stats.RunID })
+	if i < 0 {
+		source.Runs = append(source.Runs, collectedRun{RunID: stats.RunID, Target: stats.Target, First: batch.Received})
+		i = len(source.Runs) - 1
+		c.tell(fmt.Sprintf("%s: run %s probing %s", batch.Source, stats.RunID, stats.Target))
+	}
+
+	run := &source.Runs[i]
+	run.Last = batch.Received
+	run.Batches++
+	run.Samples += len(batch.Samples)
+	run.Dropped += batch.Dropped
+}
+
+func (c *collector) tell(message string) {
+	if c.notify != nil {
+		c.notify(message)
+	}
+}
+
+func (c *collector) listen(address string) (*http.Server, string, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen for --listen: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+tui.FORWARD_PATH, c.ingest)
+	mux.HandleFunc("GET "+COLLECT_SOURCES, c.serveSources)
+	mux.HandleFunc("GET "+tui.HEALTHZ_PATH, tui.ServeHealth)
+	mux.HandleFunc("GET "+COLLECT_AGGREGATE, c.serveAggregate)
+	mux.HandleFunc("GET "+tui.STATS_PATH+"/{source}", c.serveStats)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(listener)
+
+	return server, listener.Addr().String(), nil
+}
+
+// ingest checks a batch's signature against the body as sent, then keeps
+// it. It's only acknowledged once it's written, so that a sender spools
+// what the collector failed to keep.
+func (c *collector) ingest(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, COLLECT_MAX_BATCH))
+	if err != nil {
+		http.Error(w, "failed to read batch", http.StatusBadRequest)
+		return
+	}
+
+	signature, _ := strings.CutPrefix(r.Header.Get(webhook.SIGNATURE_HEADER), "sha256=")
+	if !hmac.Equal([]byte(signature), []byte(webhook.Sign(c.secret, body))) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+
+	batch, err := decodeBatch(body, r.Header.Get("Content-Encoding") == "gzip")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.keep(collectedBatch{Received: time.Now(), ForwardBatch: batch}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeBatch(body []byte, compressed bool) (tui.ForwardBatch, error) {
+	var batch tui.ForwardBatch
+	reader := io.Reader(bytes.NewReader(body))
+	if compressed {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return batch, fmt.Errorf("failed to decompress batch: %s", err)
+		}
+		reader = io.LimitReader(gz, COLLECT_MAX_BATCH)
+	}
+
+	if err := json.NewDecoder(reader).Decode(&batch); err != nil {
+		return batch, fmt.Errorf("failed to parse batch: %s", err)
+	}
+
+	switch {
+	case batch.Schema == 0:
+		return batch, errors.New("not a network-test batch, expected one sent by --forward")
+	case batch.Schema != tui.FORWARD_SCHEMA:
+		return batch, fmt.Errorf("batch schema %d, but this collector reads %d; run the same version everywhere", batch.Schema, tui.FORWARD_SCHEMA)
+	}
+
+	return batch, tui.CheckSource(batch.Source)
+}
+
+func (c *collector) keep(batch collectedBatch) error {
+	line, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %s", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file, err := os.OpenFile(filepath.Join(c.dir, batch.Source+COLLECT_FILE_SUFFIX), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to keep batch: %s", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to keep batch: %s", err)
+	}
+
+	c.record(batch)
+	return nil
+}
+
+// snapshot is every source, by name, marked stale if it's gone quiet.
+func (c *collector) snapshot(now time.Time) []collectedSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sources := make([]collectedSource, 0, len(c.sources))
+	for _, source := range c.sources {
+		copied := *source
+		copied.Runs = slices.Clone(source.Runs)
+		copied.Stale = now.Sub(source.LastSeen) > c.staleAfter
+		sources = append(sources, copied)
+	}
+	slices.SortFunc(sources, func(a collectedSource, b collectedSource) int { return strings.Compare(a.Source, b.Source) })
+
+	return sources
+}
+
+// summary merges the sources as the aggregate command merges the sites it
+// polls.
+func (c *collector) summary(now time.Time) aggregateSummary {
+	a := &aggregator{}
+	for _, source := range c.snapshot(now) {
+		seen := source.LastSeen
+		a.sites = append(a.sites, &aggregateSite{URL: tui.STATS_PATH + "/" + source.Source, Site: source.Source, Stats: source.Stats, LastSeen: &seen, Stale: source.Stale})
+	}
+
+	return a.summary(now)
+}
+
+func (c *collector) serveSources(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, c.snapshot(time.Now()))
+}
+
+func (c *collector) serveAggregate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, c.summary(time.Now()))
+}
+
+func (c *collector) serveStats(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	var stats *tui.StatsDocument
+	if source := c.sources[r.PathValue("source")]; source != nil {
+		stats = source.Stats
+	}
+	c.mu.Unlock()
+
+	if stats == nil {
+		http.Error(w, "no such source", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, stats)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
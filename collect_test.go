@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/tui"
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+
+	secret := []byte("shared secret")
+	data := filepath.Join(dir, "data")
+	col, err := newCollector(data, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("the collector starts: expected no error, got %v", err)
+	}
+	server, address, err := col.listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("the collector listens: expected no error, got %v", err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Two probes forward a window each, site-a with its samples.
+	now := time.Now()
+	for i, site := range []string{"site-a", "site-b"} {
+		f, err := tui.NewForwarder(address, secret, filepath.Join(dir, site), site, i == 0)
+		if err != nil {
+			t.Fatalf("a bare collector address is taken: expected no error, got %v", err)
+		}
+
+		m := tui.NewModel(nil, stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS))
+		m.Host, m.Target = "example.com", target.Target{Mode: target.ICMP, Host: "example.com"}
+		m.Labels, m.Forward = map[string]string{tui.AGGREGATE_SITE_LABEL: site}, f
+		m.Stats.RunID = site + "-run"
+		m.Stats.Loss.Observe(f.Observe)
+		for seq, ms := range []int{10, 20, 30} {
+			result := ping.Result{Seq: seq, Duration: time.Duration(ms*(i+1)) * time.Millisecond}
+			m.Stats.Observe(result)
+			m.Stats.Update(result.Duration)
+			m.ExportSamples(&result)
+		}
+		m.WindowComplete(stats.ClosedWindow{Start: now.Add(-5 * time.Second), End: now, Window: m.Stats.Window})
+
+		go f.Sender.Run(ctx)
+	}
+
+	for {
+		if sources := col.snapshot(time.Now()); len(sources) == 2 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("both probes' batches arrive: expected 2 sources, got %v", len(col.snapshot(time.Now())))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	get := func(path string, into any) error {
+		response, err := http.Get("http://" + address + path)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s answered %s", path, response.Status)
+		}
+		return json.NewDecoder(response.Body).Decode(into)
+	}
+
+	var summary aggregateSummary
+	if err := get(COLLECT_AGGREGATE, &summary); err != nil || summary.Count != 6 || summary.AvgMs != 30 || len(summary.Sites) != 2 || summary.Stale != 0 {
+		t.Fatalf("the collector merges its sources: expected 2 sites, 6 replies averaging 30ms, got %+v, %v", summary, err)
+	}
+
+	var sources []collectedSource
+	if err := get(COLLECT_SOURCES, &sources); err != nil || len(sources) != 2 || sources[0].Source != "site-a" || len(sources[0].Runs) != 1 || sources[0].Runs[0].RunID != "site-a-run" || sources[0].Runs[0].Samples != 3 || sources[1].Runs[0].Samples != 0 {
+		t.Fatalf("each source's runs are tracked, with the samples forwarded: expected site-a-run with 3 samples, site-b-run with none, got %+v, %v", sources, err)
+	}
+
+	var document tui.StatsDocument
+	if err := get(tui.STATS_PATH+"/site-b", &document); err != nil || document.RunID != "site-b-run" || document.Count != 3 {
+		t.Fatalf("a source's stats are served for the aggregate command: expected site-b-run with 3 replies, got %+v, %v", document, err)
+	}
+
+	forged, _ := json.Marshal(tui.ForwardBatch{Schema: tui.FORWARD_SCHEMA, Source: "site-c"})
+	request, _ := http.NewRequest(http.MethodPost, "http://"+address+tui.FORWARD_PATH, bytes.NewReader(forged))
+	request.Header.Set(webhook.SIGNATURE_HEADER, "sha256="+webhook.Sign([]byte("wrong secret"), forged))
+	if response, err := http.DefaultClient.Do(request); err != nil || response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("a batch signed with another secret is refused: expected 401, got %q", fmt.Sprint(response.Status, err))
+	}
+
+	request, _ = http.NewRequest(http.MethodPost, "http://"+address+tui.FORWARD_PATH, bytes.NewReader(forged))
+	request.Header.Set(webhook.SIGNATURE_HEADER, "sha256="+webhook.Sign(secret, forged))
+	if response, err := http.DefaultClient.Do(request); err != nil || response.StatusCode != http.StatusNoContent {
+		t.Fatalf("an uncompressed batch signed with the secret is kept: expected 204, got %q", fmt.Sprint(response.Status, err))
+	}
+
+	restarted, err := newCollector(data, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("the collector restarts from its data: expected no error, got %v", err)
+	}
+	again := restarted.snapshot(time.Now())
+	if len(again) != 3 || again[0].Runs[0].Samples != 3 || again[1].Stats.Count != 3 {
+		t.Fatalf("batches survive a restart: expected 3 sources as before, got %+v", again)
+	}
+
+	if _, err := tui.NewForwarder(address, secret, dir, "../etc", false); err == nil {
+		t.Fatalf("a source name that isn't safe as a file name: expected an error, got accepted")
+	}
+}
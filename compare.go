@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// comparison follows two hosts probed side by side, such as the router and
+// somewhere out on the internet, to tell whether latency is added close to
+// home or beyond it. Both Stats roll their windows on one ticker, so each
+// delta is between windows covering the same time.
+type comparison struct {
+	window time.Duration
+	last   *windowDelta
+}
+
+// windowDelta is one window of each host: the average round trip, as a
+// float of milliseconds, and the loss over it.
+type windowDelta struct {
+	average [2]float64
+	loss    [2]float64
+	samples [2]int
+}
+
+type compareWindowMsg time.Time
+
+// newComparison starts both hosts' windows together, leaving them to be
+// rolled by roll instead of by their samples.
+func newComparison(panels []*hostPanel, window time.Duration, now time.Time) *comparison {
+	for _, p := range panels {
+		p.stats.SharedWindow = true
+		p.stats.WindowStart = now
+	}
+
+	return &comparison{window: window}
+}
+
+func (c *comparison) tick() tea.Cmd {
+	return tea.Tick(c.window, func(at time.Time) tea.Msg { return compareWindowMsg(at) })
+}
+
+// roll closes the window under way for both hosts at now.
+func (c *comparison) roll(panels []*hostPanel, now time.Time) windowDelta {
+	var delta windowDelta
+	for i, p := range panels[:2] {
+		delta.loss[i], _, _ = p.stats.Loss.Rolling(now)
+		p.stats.RollWindow(now)
+		delta.average[i] = p.stats.LastWindow.Mean
+		delta.samples[i] = p.stats.LastWindow.Count
+	}
+	c.last = &delta
+
+	return delta
+}
+
+func (d windowDelta) complete() bool {
+	return d.samples[0] > 0 && d.samples[1] > 0
+}
+
+// signed is a difference with its sign, which formatLatency leaves off.
+func signed(ms float64) string {
+	if ms < 0 {
+		return "-" + stats.FormatLatency(stats.FromMilliseconds(-ms))
+	}
+	return "+" + stats.FormatLatency(stats.FromMilliseconds(ms))
+}
+
+// legs splits the far host's round trip into the part the near one accounts
+// for and the rest, which only holds while the near host is on the way to
+// the far one and answers faster.
+func (d windowDelta) legs() (near float64, beyond float64, ok bool) {
+	if !d.complete() || d.average[1] <= 0 || d.average[0] > d.average[1] {
+		return 0, 0, false
+	}
+
+	return d.average[0], d.average[1] - d.average[0], true
+}
+
+// view is the delta column between the two hosts.
+func (c *comparison) view(t theme.Theme, hosts [2]string) string {
+	lines := []string{t.Header.Render(fmt.Sprintf("Delta (%s - %s)", hosts[1], hosts[0]))}
+	if c.last == nil {
+		return strings.Join(append(lines, fmt.Sprintf("Waiting for the first %s window...", c.window)), "\n")
+	}
+
+	d := *c.last
+	if !d.complete() {
+		return strings.Join(append(lines, t.Warn.Render("A host had no replies over the last window, so there's nothing to compare")), "\n")
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("%-7s %s", "Average", signed(d.average[1]-d.average[0])),
+		fmt.Sprintf("%-7s %+.1f points", "Loss", (d.loss[1]-d.loss[0])*100),
+		"",
+	)
+
+	near, beyond, ok := d.legs()
+	if !ok {
+		return strings.Join(append(lines, t.Muted.Render(fmt.Sprintf("%s answers no faster than %s, so it isn't on the way there", hosts[0], hosts[1]))), "\n")
+	}
+
+	legs := []struct {
+		label string
+		ms    float64
+	}{
+		{"to " + hosts[0], near},
+		{"beyond " + hosts[0], beyond},
+	}
+	worst := 0
+	if beyond > near {
+		worst = 1
+	}
+	for i, leg := range legs {
+		line := fmt.Sprintf("%-24s %8s %3.0f%%", leg.label, stats.FormatLatency(stats.FromMilliseconds(leg.ms)), leg.ms/d.average[1]*100)
+		if i == worst {
+			line = t.Warn.Render(line + " ← most of the latency")
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// plainLine is the delta for plain output, one per window.
+func (c *comparison) plainLine(hosts [2]string) string {
+	d := *c.last
+	if !d.complete() {
+		return "delta none, a host had no replies over the window"
+	}
+
+	line := fmt.Sprintf("delta average %s, loss %+.1f points", signed(d.average[1]-d.average[0]), (d.loss[1]-d.loss[0])*100)
+	near, beyond, ok := d.legs()
+	switch {
+	case !ok:
+		line += fmt.Sprintf(", %s isn't on the way to %s", hosts[0], hosts[1])
+	case beyond > near:
+		line += fmt.Sprintf(", most of the latency is beyond %s (%.0f%%)", hosts[0], beyond/d.average[1]*100)
+	default:
+		line += fmt.Sprintf(", most of the latency is on the way to %s (%.0f%%)", hosts[0], near/d.average[1]*100)
+	}
+
+	return line
+}
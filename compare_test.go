@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestCompare probes a near and a far host out of step with each
+// other, and checks their windows still close together on the comparison's
+// ticker, with the delta and the leg adding most of the latency taken from
+// windows covering the same time.
+func TestCompare(t *testing.T) {
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	var panels []*hostPanel
+	for _, host := range []string{"router.local", "google.co.uk"} {
+		s := stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS)
+		s.Clock = func() time.Time { return now }
+		s.Started = start
+		panels = append(panels, &hostPanel{host: host, stats: &s})
+	}
+	compare := newComparison(panels, 10*time.Second, start)
+
+	// The far host answers 300ms after the near one, which would have each
+	// roll its window on a different sample if left to Update.
+	for seq := 1; seq <= 10; seq++ {
+		now = start.Add(time.Duration(seq) * time.Second)
+		panels[0].receive(ping.Result{Seq: seq, Epoch: 1, Duration: 4 * time.Millisecond})
+		now = now.Add(300 * time.Millisecond)
+		if seq == 3 {
+			panels[1].receive(ping.Result{Seq: seq, Epoch: 1, Lost: true, Reason: ping.LOSS_UNREACHABLE})
+			continue
+		}
+		if panels[1].receive(ping.Result{Seq: seq, Epoch: 1, Duration: 24 * time.Millisecond}) {
+			t.Fatalf("a compared host's window isn't rolled by its samples: expected no roll, got rolled at seq %d", seq)
+		}
+	}
+	if panels[0].stats.LastWindow.Count != 0 {
+		t.Fatalf("a compared host's window isn't rolled by its samples: expected no roll, got %d samples in the last window", panels[0].stats.LastWindow.Count)
+	}
+
+	now = start.Add(10*time.Second + 500*time.Millisecond)
+	compare.roll(panels, now)
+	for _, p := range panels {
+		if !p.stats.WindowStart.Equal(now) {
+			t.Fatalf("both windows roll at the tick: expected %s, got %s", now, p.stats.WindowStart)
+		}
+	}
+	if counts := [2]int{panels[0].stats.LastWindow.Count, panels[1].stats.LastWindow.Count}; counts != [2]int{10, 9} {
+		t.Fatalf("each window holds the samples up to the tick: expected [10 9], got %v", counts)
+	}
+
+	hosts := [2]string{"router.local", "google.co.uk"}
+	view := compare.view(theme.Theme{}, hosts)
+	for _, expected := range []string{"Average +20.0ms", "beyond router.local        20.0ms  83% ← most of the latency", "to router.local            4.00ms  17%"} {
+		if !strings.Contains(view, expected) {
+			t.Fatalf("the delta column shows the difference and which leg dominates:\nexpected:\n%s\ngot:\n%s", expected, view)
+		}
+	}
+	if !strings.Contains(view, "Loss    +10.0 points") {
+		t.Fatalf("the loss delta is over the same window: expected Loss    +10.0 points, got %q", view)
+	}
+	if line := compare.plainLine(hosts); !strings.HasPrefix(line, "delta average +20.0ms, loss +10.0 points, most of the latency is beyond router.local (83%)") {
+		t.Fatalf("plain output says the same: expected delta average +20.0ms, loss +10.0 points, most of the latency is beyond router.local (83%%), got %q", line)
+	}
+
+	now = now.Add(10 * time.Second)
+	panels[0].receive(ping.Result{Seq: 11, Epoch: 1, Duration: 4 * time.Millisecond})
+	compare.roll(panels, now)
+	if view := compare.view(theme.Theme{}, hosts); !strings.Contains(view, "nothing to compare") {
+		t.Fatalf("a window one host had no replies in isn't compared: expected nothing to compare, got %q", view)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/history"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+func checkpointDir(c *cli.Context) (string, error) {
+	if dir := c.String("checkpoint-dir"); dir != "" {
+		return dir, nil
+	}
+
+	path, err := history.DefaultPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(path), tui.CHECKPOINT_DIR), nil
+}
+
+func recoverCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "recover",
+		Usage: "finalise runs that panicked or were killed, from their last checkpoint",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "checkpoint-dir",
+				Usage: "directory checkpoints are read from (default: network-test/checkpoints in the XDG data dir)",
+			},
+			&cli.StringFlag{
+				Name:  "history-file",
+				Usage: "history file recovered runs are added to (default: network-test/history.jsonl in the XDG data dir)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-history",
+				Usage: "don't add recovered runs to the history",
+			},
+			&cli.StringFlag{
+				Name:  "state",
+				Usage: "write the recovered summary, still marked incomplete, to this file; needs a single run to recover",
+			},
+			&cli.BoolFlag{
+				Name:  "discard",
+				Usage: "delete the checkpoints without recording them",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			dir, err := checkpointDir(c)
+			if err != nil {
+				return err
+			}
+
+			found, err := tui.AbandonedCheckpoints(dir, time.Now())
+			if err != nil {
+				return err
+			}
+
+			if len(found) == 0 {
+				fmt.Println("nothing to recover")
+				return nil
+			}
+
+			if c.String("state") != "" && len(found) > 1 {
+				return fmt.Errorf("--state needs a single run to recover, found %d", len(found))
+			}
+
+			path := ""
+			if !c.Bool("no-history") && !c.Bool("discard") {
+				path, err = historyPath(c)
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, checkpoint := range found {
+				if !c.Bool("discard") {
+					if path != "" && checkpoint.State.Totals.Count > 0 {
+						if err := history.Append(path, checkpoint.HistoryRun()); err != nil {
+							return err
+						}
+					}
+
+					if state := c.String("state"); state != "" {
+						if err := stats.WriteState(state, checkpoint.State); err != nil {
+							return err
+						}
+					}
+				}
+
+				if err := os.Remove(checkpoint.Path); err != nil {
+					return fmt.Errorf("failed to remove checkpoint: %s", err)
+				}
+
+				if c.Bool("discard") {
+					fmt.Println("discarded " + checkpoint.String())
+				} else {
+					fmt.Println("recovered " + checkpoint.String())
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/control"
+)
+
+func ctlCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ctl",
+		Usage: "send a command to a running instance's control socket",
+		UsageText: `network-test ctl --socket path command [args...]
+
+Commands:
+   ack [note]           acknowledge the active alert
+   mark-change [note]   time how long the connection takes to recover from a change
+   pause [reason]       pause probing
+   resume [reason]      resume probing
+
+Examples:
+   network-test ctl --socket /tmp/nettest.sock ack "ISP ticket 1234 raised"
+   network-test ctl --socket /tmp/nettest.sock mark-change "switched to VPN"`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "socket",
+				Usage:    "control socket of the running instance",
+				Required: true,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if !c.Args().Present() {
+				return fmt.Errorf("missing command")
+			}
+
+			reply, err := control.Send(c.String("socket"), strings.Join(c.Args().Slice(), " "))
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(reply)
+			if strings.HasPrefix(reply, "error:") {
+				return cli.Exit("", 1)
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// dnsOptionsOf reads --record and --server, asking the system's first
+// nameserver when none are given.
+func dnsOptionsOf(c *cli.Context) (ping.DNSOptions, error) {
+	options := ping.DNSOptions{Record: strings.ToUpper(c.String("record"))}
+	if _, ok := ping.DNS_RECORDS[options.Record]; !ok {
+		return options, fmt.Errorf("unknown record type %q, expected one of: A, AAAA, CNAME, MX, NS, SOA, TXT", c.String("record"))
+	}
+
+	for _, value := range c.StringSlice("server") {
+		for _, server := range strings.Split(value, ",") {
+			address, err := ping.ServerAddress(strings.TrimSpace(server))
+			if err != nil {
+				return options, err
+			}
+			options.Servers = append(options.Servers, address)
+		}
+	}
+
+	if len(options.Servers) == 0 {
+		servers, err := ping.SystemServers()
+		if err != nil {
+			return options, err
+		}
+		options.Servers = servers[:1]
+	}
+
+	return options, nil
+}
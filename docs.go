@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const APP_EXAMPLES = `Examples:
+
+   Ping a host, showing 10 second windows:
+      network-test --window 10 google.co.uk
+
+   Track a latency objective and keep the run in a state file:
+      network-test --slo "99%<80ms/30d" --state run.json 1.1.1.1
+
+   Compare a catalogue of well-known endpoints:
+      network-test --catalog cdn`
+
+func docsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "docs",
+		Usage: "generate a man page or markdown reference for every command and flag",
+		UsageText: `network-test docs [--format man|markdown] [--output path]
+
+Examples:
+   network-test docs --format man --output network-test.8
+   network-test docs --format markdown > REFERENCE.md`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "markdown",
+				Usage: "output format, man or markdown",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "file to write to instead of stdout",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := checkDocumented(c.App); err != nil {
+				return err
+			}
+
+			var doc string
+			var err error
+			switch c.String("format") {
+			case "man":
+				doc, err = c.App.ToMan()
+			case "markdown":
+				doc, err = c.App.ToMarkdown()
+			default:
+				return fmt.Errorf("unknown format %q, expected man or markdown", c.String("format"))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to generate docs: %s", err)
+			}
+
+			if path := c.String("output"); path != "" {
+				return os.WriteFile(path, []byte(doc), 0o644)
+			}
+
+			fmt.Print(doc)
+			return nil
+		},
+	}
+}
+
+// checkDocumented refuses to generate docs while any command or flag is
+// missing a usage string, subcommands' included, so new flags can't ship
+// undocumented.
+func checkDocumented(app *cli.App) error {
+	var missing []string
+
+	check := func(scope string, flags []cli.Flag) {
+		for _, flag := range flags {
+			doc, ok := flag.(cli.DocGenerationFlag)
+			if !ok || doc.GetUsage() == "" {
+				missing = append(missing, scope+" --"+flag.Names()[0])
+			}
+		}
+	}
+
+	var walk func(scope string, commands []*cli.Command)
+	walk = func(scope string, commands []*cli.Command) {
+		for _, command := range commands {
+			name := scope + " " + command.Name
+			if command.Usage == "" {
+				missing = append(missing, name)
+			}
+			check(name, command.Flags)
+			walk(name, command.Subcommands)
+		}
+	}
+
+	check(app.Name, app.Flags)
+	walk(app.Name, app.Commands)
+
+	if len(missing) > 0 {
+		return fmt.Errorf("undocumented: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// docFormat is how a rendering of the docs heads each command's section,
+// a level deeper for each subcommand, and marks up a flag.
+type docFormat struct {
+	name     string
+	render   func(app *cli.App) (string, error)
+	headings []string
+	flag     string
+}
+
+var DOC_FORMATS = []docFormat{
+	{"markdown", (*cli.App).ToMarkdown, []string{"# ", "## ", "### "}, "**--"},
+	{"man", (*cli.App).ToMan, []string{".SH ", ".SH ", ".SS "}, `\fB--`},
+}
+
+// section is the text under the first heading after from, up to the next
+// heading of any level, and the line it starts at.
+func (f docFormat) section(lines []string, from int, heading string) (int, string) {
+	for i := from; i < len(lines); i++ {
+		if lines[i] != heading {
+			continue
+		}
+
+		end := i + 1
+		for end < len(lines) && !f.isHeading(lines[end]) {
+			end++
+		}
+		return i, strings.Join(lines[i+1:end], "\n")
+	}
+
+	return -1, ""
+}
+
+func (f docFormat) isHeading(line string) bool {
+	for _, prefix := range f.headings {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestDocumented fails as soon as a command or flag ships without a usage
+// string, rather than when someone next runs nettest docs, and checks that
+// every flag a command shows, a subcommand's such as config show's too,
+// makes it into both the markdown and the man page under that command.
+func TestDocumented(t *testing.T) {
+	if err := checkDocumented(newApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newApp()
+	app.Flags = append(app.Flags, &cli.BoolFlag{Name: "undocumented"})
+	if err := checkDocumented(app); err == nil {
+		t.Fatal("expected a flag without usage to be refused")
+	}
+
+	app = newApp()
+	for _, command := range app.Commands {
+		if command.Name == "config" {
+			command.Subcommands[0].Flags = append(command.Subcommands[0].Flags, &cli.BoolFlag{Name: "undocumented"})
+		}
+	}
+	if err := checkDocumented(app); err == nil || !strings.Contains(err.Error(), "network-test config show --undocumented") {
+		t.Fatalf("a subcommand's flag without usage: expected it refused by name, got %v", err)
+	}
+
+	for _, format := range DOC_FORMATS {
+		app := newApp()
+		doc, err := format.render(app)
+		if err != nil {
+			t.Fatalf("%s: expected it rendered, got %v", format.name, err)
+		}
+		lines := strings.Split(doc, "\n")
+
+		expectFlags := func(where string, text string, flags []cli.Flag) {
+			for _, flag := range flags {
+				if visible, ok := flag.(cli.VisibleFlag); ok && !visible.IsVisible() {
+					continue
+				}
+				if name := flag.Names()[0]; !strings.Contains(text, format.flag+name) {
+					t.Fatalf("%s: expected --%s under %s, got it missing", format.name, name, where)
+				}
+			}
+		}
+
+		var walk func(path string, from int, depth int, commands []*cli.Command)
+		walk = func(path string, from int, depth int, commands []*cli.Command) {
+			for _, command := range commands {
+				if command.Hidden || command.Name == "help" {
+					continue
+				}
+
+				where := strings.TrimSpace(path + " " + command.Name)
+				heading := format.headings[depth] + strings.Join(command.Names(), ", ")
+				at, text := format.section(lines, from, heading)
+				if at < 0 {
+					t.Fatalf("%s: expected a section for %s, got none", format.name, where)
+				}
+				expectFlags(where, text, command.Flags)
+				walk(where, at+1, depth+1, command.Subcommands)
+			}
+		}
+
+		_, global := format.section(lines, 0, format.headings[0]+"GLOBAL OPTIONS")
+		expectFlags("the global options", global, app.Flags)
+		walk("", 0, 1, app.Commands)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+)
+
+// WHOLE_SECOND_FLAGS take durations like the rest, but are still counted in
+// whole seconds, as the windows are.
+var WHOLE_SECOND_FLAGS = []string{"window"}
+
+// durationOf reads a flag declared with a duration.Value, as every
+// duration-ish flag is so that they all take the same forms.
+func durationOf(c *cli.Context, name string) time.Duration {
+	return c.Generic(name).(*duration.Value).Duration
+}
+
+// checkWholeSeconds reports a WHOLE_SECOND_FLAGS value that has a fraction,
+// worded like the errors for values that don't parse.
+func checkWholeSeconds(c *cli.Context) error {
+	for _, name := range WHOLE_SECOND_FLAGS {
+		if d := durationOf(c, name); d < time.Second || d%time.Second != 0 {
+			return fmt.Errorf("invalid value %q for flag -%s: must be a whole number of seconds, at least 1s", c.Generic(name), name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+)
+
+// TestDurationFlags parses the same inputs through every duration
+// flag of the app, each in an app of its own, checking bare numbers take the
+// flag's unit and that bad values name the flag. No flag may be left using
+// urfave's own duration parsing.
+func TestDurationFlags(t *testing.T) {
+	var found []*cli.GenericFlag
+	var legacy []string
+	var walk func(flags []cli.Flag, commands []*cli.Command)
+	walk = func(flags []cli.Flag, commands []*cli.Command) {
+		for _, flag := range flags {
+			switch flag := flag.(type) {
+			case *cli.GenericFlag:
+				if _, ok := flag.Value.(*duration.Value); ok {
+					found = append(found, flag)
+				}
+			case *cli.DurationFlag:
+				legacy = append(legacy, flag.Name)
+			}
+		}
+		for _, command := range commands {
+			walk(command.Flags, command.Subcommands)
+		}
+	}
+	app := newApp()
+	walk(app.Flags, app.Commands)
+
+	if len(found) == 0 {
+		t.Fatalf("duration flags found: expected some, got none")
+	}
+	if len(legacy) > 0 {
+		t.Fatalf("every duration flag parsed the same way: expected none left as cli.DurationFlag, got %q", strings.Join(legacy, ", "))
+	}
+
+	parse := func(flags []cli.Flag, args []string, read func(c *cli.Context) error) error {
+		app := &cli.App{Flags: flags, Action: read, Writer: io.Discard, ErrWriter: io.Discard, HideHelp: true}
+		app.OnUsageError = func(c *cli.Context, err error, isSubcommand bool) error { return err }
+		return app.Run(append([]string{"selftest"}, args...))
+	}
+
+	for _, flag := range found {
+		unit := flag.Value.(*duration.Value).Unit
+		cases := []struct {
+			input    string
+			expected time.Duration
+		}{
+			{"1", unit},
+			{"2.5", unit * 5 / 2},
+			{"250ms", 250 * time.Millisecond},
+			{"1.5s", 1500 * time.Millisecond},
+			{"1m", time.Minute},
+			{"2d", 48 * time.Hour},
+		}
+
+		for _, c := range cases {
+			var actual time.Duration
+			err := parse([]cli.Flag{&cli.GenericFlag{Name: flag.Name, Value: duration.New(0, unit)}}, []string{"--" + flag.Name, c.input}, func(ctx *cli.Context) error {
+				actual = durationOf(ctx, flag.Name)
+				return nil
+			})
+			if err != nil || actual != c.expected {
+				t.Fatalf("--%s %s: expected %q, got %s, %v", flag.Name, c.input, c.expected.String(), actual, err)
+			}
+		}
+
+		for _, input := range []string{"abc", "-1s", "NaN"} {
+			err := parse([]cli.Flag{&cli.GenericFlag{Name: flag.Name, Value: duration.New(0, unit)}}, []string{"--" + flag.Name, input}, func(*cli.Context) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), "flag -"+flag.Name+":") {
+				t.Fatalf("--%s %s: expected an error naming the flag, got %v", flag.Name, input, err)
+			}
+		}
+	}
+
+	for _, name := range WHOLE_SECOND_FLAGS {
+		flags := []cli.Flag{}
+		for _, other := range WHOLE_SECOND_FLAGS {
+			flags = append(flags, &cli.GenericFlag{Name: other, Value: duration.New(time.Second, time.Second)})
+		}
+
+		err := parse(flags, []string{"--" + name, "1.5"}, checkWholeSeconds)
+		if err == nil || !strings.Contains(err.Error(), "flag -"+name+":") {
+			t.Fatalf("--%s 1.5: expected an error naming the flag, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/evidence"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+func keygenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "keygen",
+		Usage: "create an ed25519 key pair for signing evidence bundles",
+		UsageText: `network-test keygen [--out path]
+
+The private key is written readable only by its owner, and the public key
+beside it with .pub added, to hand to whoever checks the bundles.
+
+Examples:
+   network-test keygen --out evidence.key
+   network-test --sign-key evidence.key google.co.uk`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "out",
+				Value: "nettest.key",
+				Usage: "where to write the private key, which mustn't exist already",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			public, private, err := evidence.GenerateKey()
+			if err != nil {
+				return fmt.Errorf("failed to generate key: %s", err)
+			}
+
+			path := c.String("out")
+			if err := evidence.WriteKeys(path, public, private); err != nil {
+				return err
+			}
+
+			fmt.Printf("wrote %s and %s.pub, fingerprint %s\n", path, path, evidence.Fingerprint(public))
+			return nil
+		},
+	}
+}
+
+func verifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "verify",
+		Usage: "check an evidence bundle's signature and print its summary",
+		UsageText: `network-test verify [--key path.pub] bundle.zip
+
+Without --key, the bundle is checked against the public key it carries,
+which proves it hasn't changed since signing but not who signed it, so
+compare the fingerprint printed with the one keygen gave.
+
+Examples:
+   network-test verify evidence-1234.zip
+   network-test verify --key evidence.key.pub evidence-1234.zip`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "public key the bundle must have been signed with",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() != 1 {
+				return fmt.Errorf("expected one bundle to verify")
+			}
+
+			var trusted ed25519.PublicKey
+			if path := c.String("key"); path != "" {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read public key: %s", err)
+				}
+				trusted, err = evidence.ParsePublicKey(data)
+				if err != nil {
+					return err
+				}
+			}
+
+			bundle, err := evidence.Verify(c.Args().First(), trusted)
+			if err != nil {
+				fmt.Printf("FAILED: %s\n", err)
+				return cli.Exit("", 1)
+			}
+
+			var state stats.RunState
+			if err := json.Unmarshal(bundle.Files[tui.EVIDENCE_SUMMARY], &state); err != nil {
+				return fmt.Errorf("failed to read summary: %s", err)
+			}
+
+			fmt.Printf("OK: signed by %s\n", evidence.Fingerprint(bundle.PublicKey))
+			fmt.Printf("Run:       %s, bundled %s\n", bundle.Manifest.RunID, bundle.Manifest.Created.Format(time.RFC3339))
+			fmt.Printf("Samples:   %d\n", state.Samples)
+			fmt.Printf("Totals:    %s\n", stats.RenderWindow(&state.Totals, nil, nil))
+			fmt.Printf("Loss:      %.1f%%\n", state.LossPct)
+			if state.ProbedS > 0 {
+				fmt.Printf("Available: %.2f%% over %s probed, %s paused\n", state.AvailabilityPct, time.Duration(state.ProbedS*float64(time.Second)).Round(time.Second), time.Duration(state.PausedS*float64(time.Second)).Round(time.Second))
+			}
+			fmt.Printf("Events:    %d\n", len(state.Events))
+			fmt.Printf("Incidents: %d\n", len(state.Incidents))
+
+			return nil
+		},
+	}
+}
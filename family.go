@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+const FAMILY_CHECK_TIMEOUT = 5 * time.Second
+
+// familyOf reads --ipv4 and --ipv6, refusing a host that resolves but has no
+// address in the family asked for up front, rather than leaving ping to fail
+// over and over. One that doesn't resolve yet is left to the run, as it would
+// be without either.
+func familyOf(c *cli.Context, targets []target.Target) (string, error) {
+	family := ""
+	switch {
+	case c.Bool("ipv4") && c.Bool("ipv6"):
+		return "", fmt.Errorf("--ipv4 and --ipv6 can't be used together")
+	case c.Bool("ipv4"):
+		family = ping.IPV4
+	case c.Bool("ipv6"):
+		family = ping.IPV6
+	default:
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context, FAMILY_CHECK_TIMEOUT)
+	defer cancel()
+
+	for _, t := range targets {
+		if t.Mode != target.ICMP {
+			return "", fmt.Errorf("--%s only applies to icmp for now, not %s", family, t.Mode)
+		}
+		var familyErr *ping.FamilyError
+		if _, err := ping.Resolve(ctx, t.Host, family); errors.As(err, &familyErr) {
+			return "", err
+		}
+	}
+
+	return family, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// forwardSource names this instance to the collector: its site label, or
+// otherwise the machine's name.
+func forwardSource(labels map[string]string) (string, error) {
+	if site := labels[tui.AGGREGATE_SITE_LABEL]; site != "" {
+		return site, nil
+	}
+
+	name, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to name this instance to the collector, set --label %s=name: %s", tui.AGGREGATE_SITE_LABEL, err)
+	}
+
+	return name, nil
+}
+
+func forwardSecret(env string) ([]byte, error) {
+	if env == "" {
+		return nil, fmt.Errorf("--forward needs --forward-secret-env, naming the environment variable holding the secret the collector checks")
+	}
+
+	value := os.Getenv(env)
+	if value == "" {
+		return nil, fmt.Errorf("--forward-secret-env names %s, but it is not set", env)
+	}
+
+	return []byte(value), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+	"ponglehub.co.uk/nettest/pkg/history"
+)
+
+func historyPath(c *cli.Context) (string, error) {
+	if path := c.String("history-file"); path != "" {
+		return path, nil
+	}
+
+	return history.DefaultPath()
+}
+
+func historyCommand() *cli.Command {
+	fileFlag := &cli.StringFlag{
+		Name:  "history-file",
+		Usage: "history file to read (default: network-test/history.jsonl in the XDG data dir)",
+	}
+
+	return &cli.Command{
+		Name:  "history",
+		Usage: "list or prune the summaries kept from previous runs",
+		UsageText: `network-test history list [--host host] [--mode mode]
+network-test history prune [--older-than age]
+
+Examples:
+   network-test history list --host google.co.uk
+   network-test history prune --older-than 90`,
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "show past runs, oldest first",
+				Flags: []cli.Flag{
+					fileFlag,
+					&cli.StringFlag{
+						Name:  "host",
+						Usage: "only show runs against this host",
+					},
+					&cli.StringFlag{
+						Name:  "mode",
+						Usage: "only show runs in this probe mode",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					path, err := historyPath(c)
+					if err != nil {
+						return err
+					}
+
+					runs, err := history.Load(path)
+					if err != nil {
+						return err
+					}
+
+					fmt.Printf("%-20s %-24s %-5s %9s %7s %7s %7s %7s %6s\n", "Start", "Host", "Mode", "Duration", "Min", "Avg", "Max", "p95", "Loss")
+					for _, run := range runs {
+						if (c.IsSet("host") && run.Host != c.String("host")) || (c.IsSet("mode") && run.Mode != c.String("mode")) {
+							continue
+						}
+
+						incomplete := ""
+						if run.Incomplete {
+							incomplete = " (incomplete)"
+						}
+
+						fmt.Printf("%-20s %-24s %-5s %9s %7s %7s %7s %7s %5.1f%%%s\n",
+							run.Start.In(time.Local).Format(time.DateTime), run.Host, run.Mode, run.End.Sub(run.Start).Round(time.Second),
+							history.FormatMs(run.MinMs), history.FormatMs(run.AvgMs), history.FormatMs(run.MaxMs), history.FormatMs(run.P95Ms), run.LossPct, incomplete)
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "prune",
+				Usage: "remove runs older than a number of days",
+				Flags: []cli.Flag{
+					fileFlag,
+					&cli.GenericFlag{
+						Name:  "older-than",
+						Value: duration.New(90*duration.DAY, duration.DAY),
+						Usage: "age past which runs are removed, such as 90d or 36h; a bare number is days",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					path, err := historyPath(c)
+					if err != nil {
+						return err
+					}
+
+					removed, err := history.Prune(path, time.Now().Add(-durationOf(c, "older-than")))
+					if err != nil {
+						return err
+					}
+
+					fmt.Printf("removed %d runs\n", removed)
+					return nil
+				},
+			},
+		},
+	}
+}
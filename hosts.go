@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// HOST_COLUMN_WIDTH is the narrowest a host's column may get before the
+// hosts are stacked instead of shown side by side.
+const HOST_COLUMN_WIDTH = 56
+
+type hostsConfig struct {
+	hosts      []string
+	interval   time.Duration
+	window     int64
+	theme      theme.Theme
+	native     bool
+	family     string
+	size       int
+	df         bool
+	bindings   []ping.Binding
+	compare    bool
+	noFailover bool
+	output     string
+	forceTUI   bool
+	histWidth  int
+	timeFormat stats.TimeFormat
+	keys       tui.KeyMap
+	headline   string
+	levels     stats.Levels
+	// resolved is the host that hosts are the addresses of, under --all-ips.
+	resolved string
+}
+
+// hostPanel is one host of a multi-host run, with a pinger and stats of its
+// own, so that each is reported as if it were the only one.
+type hostPanel struct {
+	host   string
+	pinger *ping.Pinger
+	pings  <-chan ping.Result
+	errs   <-chan error
+	stats  *stats.Stats
+	last   ping.Result
+	err    error
+}
+
+// hostMsg tags what one host's pinger produced with the host's index.
+type hostMsg struct {
+	index int
+	msg   tea.Msg
+}
+
+type hostsModel struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	interval  time.Duration
+	theme     theme.Theme
+	histWidth int
+	width     int
+	panels    []*hostPanel
+	keys      tui.KeyMap
+	compare   *comparison
+}
+
+func newHostPanels(ctx context.Context, cfg hostsConfig) ([]*hostPanel, error) {
+	bindings := cfg.bindings
+	if len(bindings) == 0 {
+		bindings = []ping.Binding{{}}
+	}
+
+	var panels []*hostPanel
+	for _, host := range cfg.hosts {
+		for _, binding := range bindings {
+			p, err := newHostPanel(ctx, cfg, host, binding)
+			if err != nil {
+				return nil, err
+			}
+			panels = append(panels, p)
+		}
+	}
+
+	return panels, nil
+}
+
+func newHostPanel(ctx context.Context, cfg hostsConfig, host string, binding ping.Binding) (*hostPanel, error) {
+	pinger := ping.NewPinger(host, cfg.interval).Failover(!cfg.noFailover).Native(cfg.native).Family(cfg.family).Bind(binding).Size(cfg.size).DontFragment(cfg.df)
+	if err := pinger.CheckInterval(); err != nil {
+		return nil, err
+	}
+	if err := pinger.CheckPacket(); err != nil {
+		return nil, err
+	}
+	if err := pinger.CheckBinding(); err != nil {
+		return nil, err
+	}
+	pings, errs := pinger.Run(ctx)
+	s := stats.New(cfg.interval, time.Duration(cfg.window)*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Times = cfg.timeFormat
+	s.Headline = cfg.headline
+	s.Levels = cfg.levels
+	label := host
+	if cfg.resolved != "" {
+		label = cfg.resolved + " at " + host
+	}
+	if !binding.IsZero() {
+		label += " " + binding.String()
+	}
+
+	return &hostPanel{host: label, pinger: pinger, pings: pings, errs: errs, stats: &s}, nil
+}
+
+// wait returns a command that waits on this host's pinger alone, so that a
+// host that is slow to answer never holds up the others.
+func (p *hostPanel) wait(ctx context.Context, index int) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case result, ok := <-p.pings:
+			if !ok {
+				return nil
+			}
+			return hostMsg{index, result}
+		case notice := <-p.pinger.Notices():
+			return hostMsg{index, notice}
+		case err := <-p.errs:
+			return hostMsg{index, err}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// receive records a result and reports whether it closed a window.
+func (p *hostPanel) receive(result ping.Result) bool {
+	closed := len(p.stats.Observe(result)) > 0
+	if result.Lost {
+		return closed
+	}
+
+	p.stats.SampleIndex++
+	p.last = result
+	return len(p.stats.UpdateAt(result.Duration, result.At)) > 0 || closed
+}
+
+func (p *hostPanel) loss(t theme.Theme) string {
+	rolling, _, _ := p.stats.Loss.Rolling(p.stats.Now())
+	line := fmt.Sprintf("Loss: window %s, total %s", p.stats.RenderLoss(t, rolling), p.stats.RenderLoss(t, p.stats.Loss.Cumulative()))
+	if p.stats.Unreachable > 0 {
+		line += fmt.Sprintf(", %d unreachable", p.stats.Unreachable)
+	}
+
+	return line
+}
+
+func (p *hostPanel) view(t theme.Theme, layout stats.HistogramLayout) string {
+	if p.err != nil {
+		return t.Bad.Render(p.host) + "\n" + t.Bad.Render(fmt.Sprintf("stopped: %s", p.err))
+	}
+
+	last := "Waiting for the first reply..."
+	if p.stats.Totals.Count > 0 {
+		last = "Last: " + p.stats.RenderLatency(t, p.last.Duration)
+	}
+
+	lines := []string{
+		t.Header.Render(p.host),
+		p.stats.PrintHeadline(t),
+		last,
+		fmt.Sprintf("%-7s %s", "Window", p.stats.RenderLastWindow(t)),
+		fmt.Sprintf("%-7s %s", "Totals", p.stats.RenderTotals(t)),
+		p.loss(t),
+		"",
+		p.stats.PrintHistogram(t, layout),
+	}
+	if event := p.stats.PrintLastEvent(t); event != "" {
+		lines = append(lines, "", event)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m hostsModel) Init() tea.Cmd {
+	cmds := []tea.Cmd{m.lossTick()}
+	for i, p := range m.panels {
+		cmds = append(cmds, p.wait(m.ctx, i))
+	}
+	if m.compare != nil {
+		cmds = append(cmds, m.compare.tick())
+	}
+
+	return tea.Batch(cmds...)
+}
+
+func (m hostsModel) lossTick() tea.Cmd {
+	return tea.Tick(m.interval, func(time.Time) tea.Msg { return tui.LossMsg{} })
+}
+
+func (m hostsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == tui.RESERVED_KEY || m.keys.Action(tui.KEYS_ANYWHERE, msg.String()) == "quit" {
+			m.cancel()
+			return m, tea.Quit
+		}
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case tui.LossMsg:
+		// Windows close on this tick too, checked at every interval, so that
+		// a host gone quiet still has its windows close.
+		for _, p := range m.panels {
+			p.stats.AdvanceLoss()
+			p.stats.CloseWindows(p.stats.Now())
+		}
+		return m, m.lossTick()
+	case compareWindowMsg:
+		m.compare.roll(m.panels, time.Time(msg))
+		return m, m.compare.tick()
+	case hostMsg:
+		p := m.panels[msg.index]
+		switch inner := msg.msg.(type) {
+		case ping.Result:
+			p.receive(inner)
+		case ping.Notice:
+			p.stats.AddEvent(inner.Kind, inner.Message)
+		case error:
+			p.err = inner
+			for _, other := range m.panels {
+				if other.err == nil {
+					return m, nil
+				}
+			}
+			return m, tea.Quit
+		}
+		return m, p.wait(m.ctx, msg.index)
+	}
+
+	return m, nil
+}
+
+func (m hostsModel) View() string {
+	header := m.theme.Header.Render(fmt.Sprintf("PING: %d hosts (interval: %s)", len(m.panels), m.interval))
+	if m.compare != nil {
+		header = m.theme.Header.Render(fmt.Sprintf("PING: %s against %s (interval: %s, window: %s)", m.panels[0].host, m.panels[1].host, m.interval, m.compare.window))
+	}
+	controls := m.theme.Muted.Render(m.keys.Label("quit") + " to quit")
+
+	columns := len(m.panels)
+	if m.compare != nil {
+		columns++
+	}
+	column := 0
+	if m.width > 0 {
+		column = m.width/columns - 2
+	}
+	sideBySide := m.width == 0 || column >= HOST_COLUMN_WIDTH
+
+	var blocks []string
+	for _, p := range m.panels {
+		layout := stats.HistogramLayout{Terminal: m.width, Limit: m.histWidth}
+		if sideBySide {
+			layout.Terminal = column
+		}
+		block := p.view(m.theme, layout)
+		if sideBySide {
+			block = lipgloss.NewStyle().PaddingRight(2).Render(block)
+		}
+		blocks = append(blocks, block)
+	}
+	if m.compare != nil {
+		blocks = append(blocks, m.compare.view(m.theme, [2]string{m.panels[0].host, m.panels[1].host}))
+	}
+
+	body := strings.Join(blocks, "\n\n")
+	if sideBySide {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, blocks...)
+	}
+
+	return strings.Join([]string{header, controls, "", body}, "\n")
+}
+
+// runHostsPlain prints a line per sample and per completed window for every
+// host, taking each host's results as they come.
+func runHostsPlain(ctx context.Context, panels []*hostPanel, compare *comparison, times stats.TimeFormat, out io.Writer) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stamp := func() string { return times.Stamp(time.Now()) }
+
+	msgs := make(chan hostMsg)
+	for i, p := range panels {
+		wait := p.wait(ctx, i)
+		go func() {
+			for {
+				msg, ok := wait().(hostMsg)
+				if !ok {
+					return
+				}
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					return
+				}
+				if _, failed := msg.msg.(error); failed {
+					return
+				}
+			}
+		}()
+	}
+
+	interval := max(time.Duration(panels[0].stats.Interval), time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Compared hosts' windows close together, and only then are printed.
+	var windows <-chan time.Time
+	if compare != nil {
+		windowTicker := time.NewTicker(compare.window)
+		defer windowTicker.Stop()
+		windows = windowTicker.C
+	}
+
+	failed := 0
+	for {
+		select {
+		case <-ticker.C:
+			for _, p := range panels {
+				p.stats.AdvanceLoss()
+				if len(p.stats.CloseWindows(p.stats.Now())) > 0 {
+					fmt.Fprintf(out, "%s %s window %s, %s\n", stamp(), p.host, p.stats.RenderLastWindow(theme.Theme{}), p.stats.PrintLoss(theme.Theme{}))
+				}
+			}
+		case now := <-windows:
+			compare.roll(panels, now)
+			for _, p := range panels {
+				fmt.Fprintf(out, "%s %s window %s, %s\n", stamp(), p.host, p.stats.RenderLastWindow(theme.Theme{}), p.stats.PrintLoss(theme.Theme{}))
+			}
+			fmt.Fprintf(out, "%s %s\n", stamp(), compare.plainLine([2]string{panels[0].host, panels[1].host}))
+		case msg := <-msgs:
+			p := panels[msg.index]
+			switch inner := msg.msg.(type) {
+			case ping.Result:
+				rolled := p.receive(inner)
+				if inner.Lost {
+					continue
+				}
+				if rolled {
+					fmt.Fprintf(out, "%s %s window %s, %s\n", stamp(), p.host, p.stats.RenderLastWindow(theme.Theme{}), p.stats.PrintLoss(theme.Theme{}))
+				}
+				fmt.Fprintf(out, "%s %s %s\n", stamp(), p.host, stats.FormatLatency(inner.Duration))
+			case ping.Notice:
+				fmt.Fprintf(out, "%s %s %s %s\n", stamp(), p.host, inner.Kind, inner.Message)
+			case error:
+				p.err = inner
+				fmt.Fprintf(out, "%s %s stopped: %s\n", stamp(), p.host, inner)
+				failed++
+				if failed == len(panels) {
+					return fmt.Errorf("every host failed, %s with: %s", panels[0].host, panels[0].err)
+				}
+			}
+		case <-ctx.Done():
+			for _, p := range panels {
+				fmt.Fprintf(out, "%s %s totals %s, %s\n", stamp(), p.host, p.stats.TotalsString(), p.stats.PrintLoss(theme.Theme{}))
+			}
+			return nil
+		}
+	}
+}
+
+func runHosts(ctx context.Context, cfg hostsConfig) error {
+	if !slices.Contains(OUTPUTS, cfg.output) {
+		return fmt.Errorf("unknown output %q, expected one of: %s", cfg.output, strings.Join(OUTPUTS, ", "))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	panels, err := newHostPanels(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	var compare *comparison
+	if cfg.compare {
+		compare = newComparison(panels, time.Duration(cfg.window)*time.Second, time.Now())
+	}
+
+	info := tui.DetectTerminal()
+	if cfg.output != "tui" {
+		return runHostsPlain(ctx, panels, compare, cfg.timeFormat, os.Stdout)
+	}
+	if ok, reason := tui.UseTUI(info, cfg.forceTUI); !ok {
+		fmt.Fprintf(os.Stderr, "using plain output: %s\n", reason)
+		return runHostsPlain(ctx, panels, compare, cfg.timeFormat, os.Stdout)
+	}
+
+	m := hostsModel{
+		ctx:       ctx,
+		cancel:    cancel,
+		interval:  cfg.interval,
+		theme:     cfg.theme,
+		histWidth: cfg.histWidth,
+		width:     info.Width,
+		panels:    panels,
+		keys:      cfg.keys,
+		compare:   compare,
+	}
+
+	if _, err := tea.NewProgram(m).Run(); err != nil {
+		return err
+	}
+
+	for _, p := range panels {
+		if p.err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("every host failed, %s with: %s", panels[0].host, panels[0].err)
+}
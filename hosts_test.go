@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestHosts feeds a two-host run by hand, with one host never
+// answering, and checks that the other's results still arrive and land in
+// its own stats, and that the hosts are drawn side by side when there's room.
+func TestHosts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var panels []*hostPanel
+	var pings []chan ping.Result
+	for _, host := range []string{"fast.example", "silent.example"} {
+		s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+		pings = append(pings, make(chan ping.Result, 1))
+		panels = append(panels, &hostPanel{host: host, pinger: ping.NewPinger(host, time.Second), pings: pings[len(pings)-1], errs: make(chan error, 1), stats: &s})
+	}
+	m := hostsModel{ctx: ctx, cancel: cancel, interval: time.Second, theme: theme.Theme{}, width: 140, panels: panels}
+
+	msgs := make(chan tea.Msg, 2)
+	for i, p := range panels {
+		go func() { msgs <- p.wait(ctx, i)() }()
+	}
+
+	for seq := 1; seq <= 3; seq++ {
+		pings[0] <- ping.Result{Seq: seq, Duration: 12 * time.Millisecond}
+
+		var msg tea.Msg
+		select {
+		case msg = <-msgs:
+		case <-time.After(time.Second):
+			t.Fatalf("a silent host doesn't hold up the others: expected a result from fast.example, got nothing within a second")
+		}
+		if tagged, ok := msg.(hostMsg); !ok || tagged.index != 0 {
+			t.Fatalf("results are tagged with their host: expected a result for host 0, got %#v", msg)
+		}
+
+		updated, cmd := m.Update(msg)
+		m = updated.(hostsModel)
+		go func() { msgs <- cmd() }()
+	}
+
+	if panels[0].stats.Totals.Count != 3 || panels[1].stats.Totals.Count != 0 {
+		t.Fatalf("each host keeps stats of its own: expected 3 samples for fast.example, none for silent.example, got %d and %d", panels[0].stats.Totals.Count, panels[1].stats.Totals.Count)
+	}
+
+	view := strings.Split(m.View(), "\n")
+	if len(view) < 4 || !strings.Contains(view[3], "fast.example") || !strings.Contains(view[3], "silent.example") {
+		t.Fatalf("hosts are drawn side by side at 140 columns: expected both hosts on the first line of the body, got %q", strings.Join(view[:min(len(view), 5)], " / "))
+	}
+
+	m.width = 80
+	view = strings.Split(m.View(), "\n")
+	if len(view) < 4 || strings.Contains(view[3], "silent.example") {
+		t.Fatalf("hosts are stacked at 80 columns: expected fast.example alone on the first line of the body, got %q", view[min(len(view)-1, 3)])
+	}
+}
+
+// TestSeveralHostsFlags checks that the flags only a single host's run
+// acts on are refused with several hosts, rather than silently ignored.
+func TestSeveralHostsFlags(t *testing.T) {
+	cases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--count", "5", "--host", "192.0.2.1,192.0.2.2"}, "--count and --duration only end a single host's run for now"},
+		{[]string{"--duration", "1m", "--compare", "192.0.2.1,192.0.2.2"}, "--count and --duration only end a single host's run for now"},
+		{[]string{"--max-p99", "200ms", "--trace", "192.0.2.1"}, "--max-avg, --max-p99 and --max-loss only judge a single host's run for now"},
+		{[]string{"--max-loss", "2%", "--all-ips", "192.0.2.1"}, "--max-avg, --max-p99 and --max-loss only judge a single host's run for now"},
+		{[]string{"--expect", "12ms", "192.0.2.1", "192.0.2.2"}, "--expect only applies to a single host for now"},
+	}
+
+	for _, c := range cases {
+		err := newApp().Run(append([]string{"network-test"}, c.args...))
+		if err == nil || err.Error() != c.err {
+			t.Fatalf("%s: expected %q, got %v", strings.Join(c.args, " "), c.err, err)
+		}
+	}
+}
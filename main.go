@@ -1,251 +1,1079 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"net/netip"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
 	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/schedule"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/tui"
 )
 
 func main() {
-	app := &cli.App{
-		Name:  "network-test",
-		Usage: "A simple network testing CLI",
+	err := newApp().Run(os.Args)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// newApp is the command line, with every command and flag.
+func newApp() *cli.App {
+	return &cli.App{
+		Name:        "network-test",
+		Usage:       "A simple network testing CLI",
+		ArgsUsage:   "[host | host:port | url]",
+		Description: APP_EXAMPLES,
+		Commands: []*cli.Command{
+			checkCommand(),
+			selftestCommand(),
+			docsCommand(),
+			serveCommand(),
+			reflectCommand(),
+			ctlCommand(),
+			attachCommand(),
+			keygenCommand(),
+			verifyCommand(),
+			historyCommand(),
+			recoverCommand(),
+			schemaCommand(),
+			aggregateCommand(),
+			configCommand(),
+			profilesCommand(),
+			collectCommand(),
+			recordCommand(),
+			replayCommand(),
+			versionCommand(),
+		},
 		Flags: []cli.Flag{
-			&cli.IntFlag{
+			&cli.GenericFlag{
 				Name:    "interval",
-				Value:   1,
-				Usage:   "Interval in seconds",
+				Value:   duration.New(time.Second, time.Second),
+				Usage:   "Interval between probes, such as 1s or 200ms; a bare number is seconds",
 				Aliases: []string{"d"},
 			},
-			&cli.Int64Flag{
+			&cli.GenericFlag{
 				Name:    "window",
-				Value:   5,
-				Usage:   "Window size for stats calculation",
+				Value:   duration.New(5*time.Second, time.Second),
+				Usage:   "Window size for stats calculation, in whole seconds; a bare number is seconds",
 				Aliases: []string{"w"},
 			},
+			&cli.IntFlag{
+				Name:    "count",
+				Usage:   "stop after this many probes of a single host have been replied to or lost, printing a summary (default: run until quit)",
+				Aliases: []string{"c"},
+			},
+			&cli.GenericFlag{
+				Name:  "duration",
+				Value: duration.New(0, time.Second),
+				Usage: "stop a single host's run once it has gone on this long, such as 5m, printing a summary (default: run until quit)",
+			},
+			&cli.GenericFlag{
+				Name:  "max-avg",
+				Value: duration.New(0, time.Millisecond),
+				Usage: "with --count or --duration, exit 1 if a single host's run has an average latency over this, such as 50ms; a bare number is milliseconds",
+			},
+			&cli.GenericFlag{
+				Name:  "max-p99",
+				Value: duration.New(0, time.Millisecond),
+				Usage: "with --count or --duration, exit 1 if a single host's run has a p99 latency over this, such as 200ms; a bare number is milliseconds",
+			},
+			&cli.StringFlag{
+				Name:  "max-loss",
+				Usage: "with --count or --duration, exit 1 if a single host's run has loss over this, e.g. 2%",
+			},
+			&cli.GenericFlag{
+				Name:  "warn",
+				Value: duration.New(stats.DEFAULT_WARN_LATENCY, time.Millisecond),
+				Usage: "colour latencies over this as a warning in the TUI, and tint histogram buckets past --crit; a bare number is milliseconds, and 0 turns it off. Colours follow NO_COLOR and what the terminal supports",
+			},
+			&cli.GenericFlag{
+				Name:  "crit",
+				Value: duration.New(stats.DEFAULT_CRIT_LATENCY, time.Millisecond),
+				Usage: "colour latencies over this as critical in the TUI; a bare number is milliseconds, and 0 turns it off",
+			},
 			&cli.StringFlag{
+				Name:  "warn-loss",
+				Value: stats.DEFAULT_WARN_LOSS,
+				Usage: "colour loss over this as a warning in the TUI, e.g. 1%; 0 turns it off",
+			},
+			&cli.StringFlag{
+				Name:  "crit-loss",
+				Value: stats.DEFAULT_CRIT_LOSS,
+				Usage: "colour loss over this as critical in the TUI, e.g. 5%; 0 turns it off",
+			},
+			&cli.StringSliceFlag{
 				Name:  "host",
-				Value: "google.co.uk",
-				Usage: "hostname to ping",
+				Value: cli.NewStringSlice("google.co.uk"),
+				Usage: "hostname to ping; repeat it, or separate hosts with commas, to ping several side by side",
+			},
+			&cli.StringSliceFlag{
+				Name:  "compare",
+				Usage: "two hosts to ping side by side with the difference between them, nearest first, such as router.local,google.co.uk to see whether latency is added by the local network or beyond it",
+			},
+			&cli.BoolFlag{
+				Name:  "trace",
+				Usage: "trace the route to the host with traceroute or tracepath and ping every hop on it, a row each, to see where along the way latency or loss starts",
+			},
+			&cli.GenericFlag{
+				Name:  "retrace",
+				Value: duration.New(0, time.Minute),
+				Usage: "with --trace, trace the route again this often, such as 10m, starting over the rows of hops that changed; a bare number is minutes (default: only at the start)",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "probe mode, one of: " + strings.Join(target.MODES, ", ") + " (inferred from the target if not set)",
+			},
+			&cli.StringFlag{
+				Name:  "url",
+				Usage: "URL to GET every interval in http mode, timing each request to its first response byte",
+			},
+			&cli.BoolFlag{
+				Name:  "no-keepalive",
+				Usage: "open a new connection for every http request, so that each pays for DNS, the handshake and TLS",
+			},
+			&cli.BoolFlag{
+				Name:  "follow-redirects",
+				Usage: "follow http redirects rather than counting them as failed requests",
+			},
+			&cli.StringFlag{
+				Name:  "record",
+				Value: "A",
+				Usage: "record type to query in dns mode, one of: A, AAAA, CNAME, MX, NS, SOA, TXT",
+			},
+			&cli.StringSliceFlag{
+				Name:  "server",
+				Usage: "DNS server to query in dns mode, such as 8.8.8.8:53; repeat it to take the servers in turn and compare them (default: the system's)",
+			},
+			&cli.IntFlag{
+				Name:  "port",
+				Usage: "port to time TCP handshakes to, with --mode tcp, or that network-test reflect listens on, with --mode udp; given alone, it switches a host being pinged to tcp",
+			},
+			&cli.StringFlag{
+				Name:  "catalog",
+				Usage: "compare a built-in catalogue of well-known endpoints, e.g. cdn",
+			},
+			&cli.StringFlag{
+				Name:  "catalog-file",
+				Usage: "JSON file of endpoints to compare instead of a built-in catalogue",
+			},
+			&cli.Float64Flag{
+				Name:  "sample-fraction",
+				Usage: "with a catalogue, probe this random fraction of endpoints each interval",
+			},
+			&cli.StringFlag{
+				Name:  "sample-rate",
+				Usage: "with a catalogue, probe random endpoints at this overall rate, e.g. 50/s",
+			},
+			&cli.StringFlag{
+				Name:  "group-by",
+				Usage: "with a catalogue, add subtotal rows grouping endpoints by this tag, or by label prefix with \"" + GROUP_BY_PREFIX + "\"",
+			},
+			&cli.StringFlag{
+				Name:  "filter",
+				Usage: "with a catalogue, only show endpoints, or groups when collapsed, whose name contains this",
+			},
+			&cli.StringFlag{
+				Name:  "alert-degraded-rate",
+				Usage: "with a catalogue, put endpoints in alert once more than this share of probes fail response validation, e.g. 5%",
+			},
+			&cli.StringFlag{
+				Name:  "catalog-summary",
+				Usage: "with a catalogue, write per-endpoint and per-group totals as JSON to this file on exit",
+			},
+			&cli.StringFlag{
+				Name:  "run-id",
+				Usage: "identifier for this run, generated if not set",
+			},
+			&cli.StringFlag{
+				Name:  "state",
+				Usage: "path of a state file to persist the run to",
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "continue the run saved in the state file",
+			},
+			&cli.StringFlag{
+				Name:  "slo",
+				Usage: "latency objective to track, e.g. 99%<80ms/30d",
+			},
+			&cli.StringFlag{
+				Name:  "sparkline",
+				Value: stats.SPARK_SAMPLES,
+				Usage: "what the sparkline tab draws, one of: " + strings.Join(stats.SPARK_MODES, ", "),
+			},
+			&cli.IntFlag{
+				Name:  "outage-after",
+				Value: stats.DEFAULT_OUTAGE_PROBES,
+				Usage: "count this many probes lost in a row as an outage, timed until the next reply; 0 doesn't track outages",
+			},
+			&cli.IntFlag{
+				Name:  "worst-minutes",
+				Value: stats.DEFAULT_WORST_MINUTES,
+				Usage: "keep the samples, events and interface readings from a minute either side of this many windows that set a record for loss or p95, the worst of them, in the results and stats summaries; 0 keeps none",
+			},
+			&cli.IntFlag{
+				Name:  "window-history",
+				Value: stats.DEFAULT_WINDOW_HISTORY,
+				Usage: "keep this many of the last windows completed, with their start, min, avg, max and loss, for the windows tab and the results summary; 0 keeps none",
+			},
+			&cli.IntFlag{
+				Name:  "alert-consecutive-loss",
+				Usage: "alert when this many probes in a row are lost",
+			},
+			&cli.StringFlag{
+				Name:  "alert-window-loss",
+				Usage: "alert when loss over --alert-loss-window goes above this, e.g. 1%",
+			},
+			&cli.GenericFlag{
+				Name:  "alert-loss-window",
+				Value: duration.New(stats.DEFAULT_ALERT_LOSS_WINDOW, time.Second),
+				Usage: "window --alert-window-loss is measured over; a bare number is seconds",
+			},
+			&cli.StringFlag{
+				Name:  "alert-cmd",
+				Usage: "run this shell command each time a window's average crosses --warn or --crit, or its loss --max-loss, and again when it recovers, with NT_HOST, NT_STATE, NT_PREVIOUS_STATE, NT_REASON, NT_AVG_MS, NT_LOSS_PCT and NT_RUN_ID set",
+			},
+			&cli.BoolFlag{
+				Name:  "bell",
+				Usage: "ring the terminal bell each time a window's average crosses --warn or --crit, or its loss --max-loss, and again when it recovers",
+			},
+			&cli.BoolFlag{
+				Name:  "detect-rate-limit",
+				Usage: "warn when loss looks like a router rate-limiting ICMP rather than a network problem",
+			},
+			&cli.GenericFlag{
+				Name:  "expect",
+				Value: duration.New(0, time.Millisecond),
+				Usage: "expected latency to compare each window's --headline against, e.g. 12ms; a bare number is milliseconds. A single host only for now",
+			},
+			&cli.StringFlag{
+				Name:  "headline",
+				Value: stats.HEADLINE_MEAN,
+				Usage: "the figure each window and the run are summed up by, in the headline, the one-line output, the window webhook and against --expect, one of: " + strings.Join(stats.HEADLINES, ", "),
+			},
+			&cli.BoolFlag{
+				Name:  "call-quality",
+				Usage: "estimate each window's call quality as a MOS, with the E-model",
+			},
+			&cli.StringFlag{
+				Name:  "call-codec",
+				Value: stats.DEFAULT_CODEC,
+				Usage: "codec the --call-quality estimate assumes, one of: g711, g729, g723",
+			},
+			&cli.GenericFlag{
+				Name:  "jitter-buffer",
+				Value: duration.New(stats.DEFAULT_JITTER_BUFFER, time.Millisecond),
+				Usage: "jitter buffer the --call-quality estimate assumes, discarding packets later than it; 0 sizes it to the jitter instead; a bare number is milliseconds",
+			},
+			&cli.StringFlag{
+				Name:  "reference",
+				Usage: "JSON summary, state or results file from a known-good run to draw the histogram against",
+			},
+			&cli.StringFlag{
+				Name:  "reference-alert",
+				Usage: "alert when a window's latency distribution is further than this from --reference's, the largest gap between their cumulative shares, e.g. 20%",
+			},
+			&cli.BoolFlag{
+				Name:  "burst-on-incident",
+				Usage: "probe every --burst-interval while an alert or outage is open, and for --burst-tail after",
+			},
+			&cli.BoolFlag{
+				Name:  "adaptive",
+				Usage: "probe every --burst-interval for 30s after any probe lost or over --warn, so that a glitch shorter than --interval isn't missed, then go back once a whole window is clean",
+			},
+			&cli.GenericFlag{
+				Name:  "burst-interval",
+				Value: duration.New(stats.DEFAULT_BURST_INTERVAL, time.Second),
+				Usage: "probe interval used by --burst-on-incident and --adaptive; a bare number is seconds",
+			},
+			&cli.GenericFlag{
+				Name:  "burst-tail",
+				Value: duration.New(stats.DEFAULT_BURST_TAIL, time.Second),
+				Usage: "how long --burst-on-incident keeps probing fast after the last incident closes; a bare number is seconds",
+			},
+			&cli.BoolFlag{
+				Name:  "resolve-each",
+				Usage: "resolve the host before every probe and time DNS separately",
+			},
+			&cli.GenericFlag{
+				Name:  "re-resolve",
+				Value: duration.New(0, time.Minute),
+				Usage: "look the host up again this often, e.g. 5m, logging an event when its addresses change; a bare number is minutes",
+			},
+			&cli.BoolFlag{
+				Name:  "follow-dns",
+				Usage: "move probing to the host's new address once --re-resolve finds the one probed gone from its answers",
+			},
+			&cli.BoolFlag{
+				Name:  "all-ips",
+				Usage: "probe every address the host resolves to, each with stats of its own, to tell a slow one apart",
+			},
+			&cli.StringFlag{
+				Name:  "record-to",
+				Usage: "write every probe result to this file as it comes, for replay to play back",
+			},
+			&cli.BoolFlag{
+				Name:  "with-gateway",
+				Usage: "also ping the default gateway and show latency beyond it",
+			},
+			&cli.BoolFlag{
+				Name:  "no-enrich",
+				Usage: "skip reverse DNS and RDAP lookups of the target",
+			},
+			&cli.BoolFlag{
+				Name:  "daily-reset",
+				Usage: "write a summary and reset the totals once a day",
+			},
+			&cli.StringFlag{
+				Name:  "reset-at",
+				Value: "00:00",
+				Usage: "local time of day for --daily-reset",
+			},
+			&cli.StringFlag{
+				Name:  "summary-dir",
+				Value: ".",
+				Usage: "directory daily summaries are written to",
+			},
+			&cli.GenericFlag{
+				Name:  "reack-after",
+				Value: duration.New(0, time.Second),
+				Usage: "how long an acknowledged alert stays quiet before it notifies again; a bare number is seconds",
+			},
+			&cli.StringFlag{
+				Name:  "control-socket",
+				Usage: "unix socket path accepting commands from network-test ctl",
+			},
+			&cli.GenericFlag{
+				Name:  "loss-half-life",
+				Value: duration.New(stats.DEFAULT_LOSS_HALF_LIFE, time.Second),
+				Usage: "half-life of the smoothed loss figure; a bare number is seconds",
+			},
+			&cli.IntFlag{
+				Name:  "top-n",
+				Value: stats.DEFAULT_TOP_N,
+				Usage: "number of slowest samples kept per window and for the run",
+			},
+			&cli.GenericFlag{
+				Name:  "baseline-horizon",
+				Value: duration.New(10*time.Minute, time.Second),
+				Usage: "how far back the minimum RTT used as the queueing baseline looks, 0 to disable; a bare number is seconds",
+			},
+			&cli.BoolFlag{
+				Name:  "interface-counters",
+				Usage: "show the probe interface's throughput alongside latency",
+			},
+			&cli.StringFlag{
+				Name:  "window-webhook",
+				Usage: "URL each completed window's summary is POSTed to as gzipped JSON",
+			},
+			&cli.StringFlag{
+				Name:  "webhook-secret-env",
+				Usage: "environment variable holding the secret used to sign webhook bodies",
+			},
+			&cli.StringFlag{
+				Name:  "webhook-spool",
+				Usage: "directory undelivered webhook payloads are kept in (default: user cache dir)",
+			},
+			&cli.StringFlag{
+				Name:  "forward",
+				Usage: "collector address, such as collector:9400, each window's stats are forwarded to, for the collect command",
+			},
+			&cli.StringFlag{
+				Name:  "forward-secret-env",
+				Usage: "environment variable holding the secret shared with the collector, which --forward signs its batches with",
+			},
+			&cli.BoolFlag{
+				Name:  "forward-samples",
+				Usage: "forward every sample as well as each window's stats",
+			},
+			&cli.StringFlag{
+				Name:  "forward-spool",
+				Usage: "directory batches are kept in while the collector can't be reached (default: user cache dir)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "label",
+				Usage: "key=value label added to webhook payloads, --stats-listen and --forward, with site naming the instance to the aggregate and collect commands, may be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "history-file",
+				Usage: "file each run's summary is added to and compared against (default: network-test/history.jsonl in the XDG data dir)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-history",
+				Usage: "don't compare against or record to the run history",
+			},
+			&cli.StringFlag{
+				Name:  "wide-csv",
+				Usage: "write every probe to this CSV file, joined with the latest Wi-Fi, interface and event state (see the schema command)",
+			},
+			&cli.StringFlag{
+				Name:  "status-fd",
+				Usage: "write NDJSON status frames to this file descriptor number, or named pipe path, for a wrapping program (see the schema command)",
+			},
+			&cli.StringFlag{
+				Name:  "stats-listen",
+				Usage: "serve the run's stats as JSON at /stats on this address, such as :8080, for the aggregate command to poll",
+			},
+			&cli.StringFlag{
+				Name:  "serve",
+				Usage: "serve a live dashboard on this address, such as :8080, to check on the run from another machine or a phone, with its stats as JSON at " + tui.DASHBOARD_API + "; alongside the TUI, or instead of it with --plain",
+			},
+			&cli.IntFlag{
+				Name:  "memory-budget",
+				Usage: "MiB of heap the run should stay within, logging an event as it nears it (default: no budget)",
+			},
+			&cli.StringFlag{
+				Name:  "results",
+				Usage: "stream every sample to this file, with a summary written on exit (see the schema command)",
+			},
+			&cli.StringFlag{
+				Name:  "results-format",
+				Usage: "format of the --results file: csv, json or jsonl (default: from the file extension, otherwise jsonl)",
+			},
+			&cli.BoolFlag{
+				Name:  "results-append",
+				Usage: "add to an existing --results file rather than replacing it",
+			},
+			&cli.StringFlag{
+				Name:  "sign-key",
+				Usage: "sign an evidence bundle of the run's summary, windows and events with this ed25519 key on exit (see the keygen and verify commands)",
+			},
+			&cli.StringFlag{
+				Name:  "bundle",
+				Usage: "where --sign-key writes the evidence bundle (default: evidence-<run id>.zip)",
+			},
+			&cli.IntFlag{
+				Name:  "hist-width",
+				Usage: "longest a histogram bar may get, or the tallest column when vertical, in cells (default: fit the terminal, up to 25)",
+			},
+			&cli.BoolFlag{
+				Name:  "hist-vertical",
+				Usage: "draw the histogram as columns with the buckets along the bottom, toggled with v on the histogram tab",
+			},
+			&cli.StringFlag{
+				Name:  "buckets",
+				Usage: "upper bounds of the histogram buckets as rising durations, such as 0.5ms,1ms,5ms,25ms,100ms, or auto to fit them on a log scale to the latency seen over the first window (default: 1ms to 1000ms)",
+			},
+			&cli.StringFlag{
+				Name:  "checkpoint-dir",
+				Usage: "directory the run is checkpointed to every window, so it can be recovered if killed (default: network-test/checkpoints in the XDG data dir)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-checkpoint",
+				Usage: "don't checkpoint the run or look for unfinished ones",
+			},
+			&cli.StringSliceFlag{
+				Name:  "source",
+				Usage: "address of this machine to send icmp probes from; given more than once, each gets a panel of its own",
+			},
+			&cli.StringSliceFlag{
+				Name:  "interface",
+				Usage: "interface to send icmp probes out of, such as wlan0; given more than once, each gets a panel of its own",
+			},
+			&cli.IntFlag{
+				Name:  "size",
+				Value: ping.DEFAULT_PAYLOAD_SIZE,
+				Usage: "bytes of payload each icmp echo request carries, up to the path MTU less 28 to fit unfragmented",
+			},
+			&cli.BoolFlag{
+				Name:  "df",
+				Usage: "send icmp probes with don't-fragment set, so those too big for the path are counted lost rather than split up (needs the system ping)",
+			},
+			&cli.IntFlag{
+				Name:  "max-in-flight",
+				Usage: "probes allowed to await a reply at once when each is sent separately, beyond which ticks are skipped (default: timeout/interval)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-failover",
+				Usage: "keep restarting the first probe backend instead of switching when it keeps failing",
+			},
+			&cli.IntFlag{
+				Name:  "max-restarts",
+				Usage: "give up after the prober has been restarted this many times without a reply in between (default: keep restarting until quit)",
+			},
+			&cli.IntFlag{
+				Name:  "recovery-probes",
+				Usage: "after t or ctl mark-change, count the connection recovered at this many replies in a row rather than at the first window meeting the thresholds",
+			},
+			&cli.BoolFlag{
+				Name:  "pause-on-metered",
+				Usage: "stop probing while the connection is metered, going by NetworkManager or a phone hotspot's gateway, or looks like a captive portal; p resumes by hand until the network changes",
+			},
+			&cli.BoolFlag{
+				Name:  "native",
+				Usage: "send ICMP echo requests directly rather than running the system ping, which becomes the fallback; used anyway when there is no ping to run",
+			},
+			&cli.BoolFlag{
+				Name:    "ipv4",
+				Aliases: []string{"4"},
+				Usage:   "only ping the host's IPv4 address",
+			},
+			&cli.BoolFlag{
+				Name:    "ipv6",
+				Aliases: []string{"6"},
+				Usage:   "only ping the host's IPv6 address, with ping -6, or ping6 on macOS",
+			},
+			&cli.BoolFlag{
+				Name:  "low-power",
+				Usage: "for running on battery: redraw once a second rather than 60 times, check the route and network every 5m rather than every 30s and 10s, and only save state on exit, so a crash loses it. Probing every second, that's about 190 wakeups a minute rather than 3700 (see BenchmarkLowPower), with the figures the same",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Value: "tui",
+				Usage: "display to use: tui, line (a single self-updating line) or plain (a line per sample)",
+			},
+			&cli.BoolFlag{
+				Name:  "plain",
+				Usage: "shorthand for --output plain, for logging to a file or running over a dumb terminal",
+			},
+			&cli.BoolFlag{
+				Name:  "force-tui",
+				Usage: "use the interactive display even if the terminal looks unsuitable",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "config file to read, such as for the keys section rebinding the TUI's keys or the profiles section (default: network-test/config.yaml in the XDG config dir)",
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "profile from the config file to take flags from, such as home-wifi, with those given on the command line taking precedence (see the profiles command)",
+			},
+			&cli.StringFlag{
+				Name:  "theme",
+				Value: "default",
+				Usage: "colour theme, one of: " + strings.Join(theme.Names(), ", "),
+			},
+			&cli.StringFlag{
+				Name:  "time-format",
+				Value: stats.TIME_LOCAL,
+				Usage: "how times are shown, one of: " + strings.Join(stats.TIME_FORMATS, ", ") + " (relative counts from the start of the run); files always store UTC",
+			},
+			&cli.BoolFlag{
+				Name:  "version",
+				Usage: "print the build and which probe backends work here, then exit",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "with --version, print it as JSON",
 			},
 		},
 		Action: func(c *cli.Context) error {
-			host := c.String("host")
-			interval := c.Int("interval")
-			window := c.Int64("window")
+			if c.Bool("version") {
+				return printVersion(c.App.Writer, c.Bool("json"))
+			}
 
-			return test(c.Context, host, interval, window)
-		},
-	}
+			file, err := loadSettings(c.String("config"))
+			if err != nil {
+				return err
+			}
+			if err := applyProfile(c, file); err != nil {
+				return err
+			}
 
-	err := app.Run(os.Args)
-	if err != nil {
-		fmt.Println(err)
-	}
-}
+			if err := checkWholeSeconds(c); err != nil {
+				return err
+			}
 
-type Window struct {
-	Min   int64
-	Max   int64
-	Total int64
-	Count int
-}
+			times, err := stats.NewTimeFormat(c.String("time-format"), time.Now(), time.Local)
+			if err != nil {
+				return err
+			}
 
-func (w *Window) Update(duration int64) {
-	if w.Min == 0 || duration < w.Min {
-		w.Min = duration
-	}
+			keys, err := tui.NewKeyMap(file.Keys)
+			if err != nil {
+				return err
+			}
 
-	if duration > w.Max {
-		w.Max = duration
-	}
+			if name := c.String("catalog"); name != "" || c.String("catalog-file") != "" {
+				t, err := theme.Get(c.String("theme"))
+				if err != nil {
+					return err
+				}
 
-	w.Total += duration
-	w.Count++
-}
+				var sampler *schedule.Sampler
+				switch {
+				case c.IsSet("sample-fraction") && c.IsSet("sample-rate"):
+					return fmt.Errorf("--sample-fraction and --sample-rate can't be used together")
+				case c.IsSet("sample-fraction"):
+					sampler, err = schedule.NewFractionSampler(c.Float64("sample-fraction"), time.Now().UnixNano())
+				case c.IsSet("sample-rate"):
+					sampler, err = schedule.NewRateSampler(c.String("sample-rate"), time.Now().UnixNano())
+				}
+				if err != nil {
+					return err
+				}
 
-func (w *Window) Reset() {
-	w.Min = 0
-	w.Max = 0
-	w.Total = 0
-	w.Count = 0
-}
+				var alertInvalid float64
+				if c.IsSet("alert-degraded-rate") {
+					alertInvalid, err = stats.ParsePercent(c.String("alert-degraded-rate"))
+					if err != nil {
+						return err
+					}
+				}
 
-func (w *Window) Average() int {
-	if w.Count == 0 {
-		return 0
-	}
+				return runCatalog(c.Context, catalogConfig{
+					name:     name,
+					path:     c.String("catalog-file"),
+					interval: durationOf(c, "interval"),
+					window:   durationOf(c, "window"),
+					theme:    t,
+					sampler:  sampler,
+					groupBy:  c.String("group-by"),
+					filter:   c.String("filter"),
+					summary:  c.String("catalog-summary"),
+					keys:     keys,
 
-	return int(w.Total) / w.Count
-}
+					alertInvalid: alertInvalid,
+				})
+			}
 
-func (w *Window) String() string {
-	return fmt.Sprintf("Min: %dms, Max: %dms, Avg: %dms", w.Min, w.Max, w.Average())
-}
+			hosts := c.StringSlice("host")
+			compare := c.IsSet("compare")
+			if compare {
+				if c.IsSet("host") || c.IsSet("url") || c.Args().Present() {
+					return fmt.Errorf("--compare names both hosts itself, so can't be used with --host, --url or a target argument")
+				}
+				hosts = c.StringSlice("compare")
+				if len(hosts) != 2 {
+					return fmt.Errorf("--compare takes two hosts, such as router.local,google.co.uk, not %d", len(hosts))
+				}
+			}
 
-type Histogram struct {
-	thresholds []int64
-	buckets    []int
-	total      int
-}
+			var targets []target.Target
+			for _, host := range hosts {
+				if err := target.CheckZone(host); err != nil {
+					return err
+				}
+				targets = append(targets, target.Target{Mode: target.ICMP, Host: host})
+			}
+			if c.IsSet("url") {
+				if c.Args().Present() {
+					return fmt.Errorf("--url can't be used with a target argument")
+				}
+				parsed, err := target.Parse(c.String("url"))
+				if err != nil {
+					return err
+				}
+				if parsed.Mode != target.HTTP {
+					return fmt.Errorf("--url must be an http or https URL, got %q", c.String("url"))
+				}
+				targets = []target.Target{parsed}
+			}
+			if c.Args().Present() {
+				targets = nil
+				for _, arg := range c.Args().Slice() {
+					parsed, err := target.Parse(arg)
+					if err != nil {
+						return err
+					}
+					targets = append(targets, parsed)
+				}
+			}
 
-func NewHistogram(thresholds []int64) Histogram {
-	return Histogram{
-		thresholds: thresholds,
-		buckets:    make([]int, len(thresholds)),
-	}
-}
+			for i := range targets {
+				mode := c.String("mode")
+				if c.IsSet("port") {
+					port := c.Int("port")
+					if port < 1 || port > 65535 {
+						return fmt.Errorf("invalid port %d", port)
+					}
+					targets[i].Port = port
+					if mode == "" && targets[i].Mode == target.ICMP {
+						mode = target.TCP
+					}
+				}
 
-func (h *Histogram) Update(duration int64) {
-	for i, threshold := range h.thresholds {
-		if duration <= threshold {
-			h.buckets[i]++
-			break
-		}
-	}
+				var err error
+				targets[i], err = targets[i].WithMode(mode)
+				if err != nil {
+					return err
+				}
 
-	h.total++
-}
+				if targets[i].Mode != target.ICMP && len(targets) > 1 {
+					return fmt.Errorf("several hosts can only be pinged over icmp for now")
+				}
+			}
 
-type Stats struct {
-	windowSize  time.Duration
-	windowStart time.Time
-	window      Window
-	lastWindow  Window
-	totals      Window
-	histogram   Histogram
-}
+			family, err := familyOf(c, targets)
+			if err != nil {
+				return err
+			}
 
-func (s *Stats) Update(duration int64) {
-	s.window.Update(duration)
-	s.totals.Update(duration)
-	s.histogram.Update(duration)
+			output := c.String("output")
+			if c.Bool("plain") {
+				if c.IsSet("output") && output != "plain" {
+					return fmt.Errorf("--plain can't be used with --output %s", output)
+				}
+				output = "plain"
+			}
 
-	if time.Now().Sub(s.windowStart).Seconds() > s.windowSize.Seconds() {
-		s.lastWindow = s.window
-		s.window.Reset()
-		s.windowStart = time.Now()
-	}
-}
+			if headline := c.String("headline"); !slices.Contains(stats.HEADLINES, headline) {
+				return fmt.Errorf("unknown headline %q, expected one of: %s", headline, strings.Join(stats.HEADLINES, ", "))
+			}
 
-func (s *Stats) String() string {
-	return fmt.Sprintf("Last %d seconds - %s\nTotals - %s", int(s.windowSize.Seconds()), s.lastWindow.String(), s.totals.String())
-}
+			colours, err := levelsOf(c)
+			if err != nil {
+				return err
+			}
 
-func (s *Stats) PrintHistogram() string {
-	var lines []string
+			bindings, err := bindingsOf(c)
+			if err != nil {
+				return err
+			}
+			for _, t := range targets {
+				if len(bindings) > 0 && t.Mode != target.ICMP {
+					return fmt.Errorf("--source and --interface only apply to icmp for now, not %s", t.Mode)
+				}
+			}
 
-	max := 0
-	for _, count := range s.histogram.buckets {
-		if count > max {
-			max = count
-		}
-	}
+			if (compare || len(targets) > 1 || len(bindings) > 1) && (c.IsSet("alert-cmd") || c.Bool("bell")) {
+				return fmt.Errorf("--alert-cmd and --bell only watch a single host for now")
+			}
+			if (compare || len(targets) > 1 || len(bindings) > 1) && c.IsSet("max-restarts") {
+				return fmt.Errorf("--max-restarts only applies to a single host for now")
+			}
+			if (c.Bool("trace") || compare || len(targets) > 1 || len(bindings) > 1) && c.IsSet("serve") {
+				return fmt.Errorf("--serve only shows a single host for now")
+			}
 
-	lines = append(lines, fmt.Sprintf("Histogram, Total: %d", s.histogram.total))
+			if compare && len(bindings) > 1 {
+				return fmt.Errorf("--compare can't be used with more than one --source or --interface")
+			}
 
-	for i, threshold := range s.histogram.thresholds {
-		length := float64(s.histogram.buckets[i]) / float64(max) * 100
-		lines = append(lines, fmt.Sprintf("%5dms : %-50s : %.2f%%", threshold, strings.Repeat("█", int(length/2.0)), length*float64(max)/float64(s.histogram.total)))
-	}
+			tracing := c.Bool("trace")
+			if !tracing && c.IsSet("retrace") {
+				return fmt.Errorf("--retrace only applies with --trace")
+			}
+			if tracing {
+				switch {
+				case compare || len(targets) > 1:
+					return fmt.Errorf("--trace follows a single host")
+				case targets[0].Mode != target.ICMP:
+					return fmt.Errorf("--trace only pings the hops over icmp for now, not %s", targets[0].Mode)
+				case len(bindings) > 0:
+					return fmt.Errorf("--trace can't be used with --source or --interface for now")
+				case c.IsSet("alert-cmd") || c.Bool("bell") || c.IsSet("max-restarts"):
+					return fmt.Errorf("--alert-cmd, --bell and --max-restarts only watch a single host, not the hops of --trace")
+				}
+			}
 
-	return strings.Join(lines, "\n")
-}
+			allIPs := c.Bool("all-ips")
+			if allIPs {
+				switch {
+				case tracing || compare || len(targets) > 1:
+					return fmt.Errorf("--all-ips splits a single host into its addresses")
+				case targets[0].Mode != target.ICMP:
+					return fmt.Errorf("--all-ips only pings over icmp for now, not %s", targets[0].Mode)
+				}
+			}
 
-type model struct {
-	ctx      context.Context
-	host     string
-	interval int
-	window   int64
-	pings    chan time.Duration
-	errs     chan error
-	stats    Stats
-}
+			if tracing || compare || allIPs || len(targets) > 1 || len(bindings) > 1 {
+				if c.IsSet("re-resolve") || c.Bool("follow-dns") {
+					return fmt.Errorf("--re-resolve and --follow-dns only watch a single host for now")
+				}
+				if c.IsSet("record-to") {
+					return fmt.Errorf("--record-to only records a single host for now")
+				}
+				if c.IsSet("count") || c.IsSet("duration") {
+					return fmt.Errorf("--count and --duration only end a single host's run for now")
+				}
+				if c.IsSet("max-avg") || c.IsSet("max-p99") || c.IsSet("max-loss") {
+					return fmt.Errorf("--max-avg, --max-p99 and --max-loss only judge a single host's run for now")
+				}
+				if c.IsSet("expect") {
+					return fmt.Errorf("--expect only applies to a single host for now")
+				}
 
-type initParams struct {
-	pings chan time.Duration
-	errs  chan error
-}
+				hosts := make([]string, len(targets))
+				for i, t := range targets {
+					hosts[i] = t.Host
+				}
+				resolved := ""
+				if allIPs {
+					addrs, err := ping.ResolveAll(c.Context, targets[0].Host, family)
+					if err != nil {
+						return err
+					}
+					hosts, resolved = tui.AddressStrings(addrs), targets[0].Host
+				}
 
-func (m model) tick() tea.Msg {
-	select {
-	case duration := <-m.pings:
-		return duration
-	case err := <-m.errs:
-		return err
-	case <-m.ctx.Done():
-		return tea.Quit
-	}
-}
+				t, err := theme.Get(c.String("theme"))
+				if err != nil {
+					return err
+				}
 
-func (m model) Init() tea.Cmd {
-	pings, err := ping.NewPinger(m.host, m.interval).Run(m.ctx)
+				cfg := hostsConfig{
+					hosts:      hosts,
+					resolved:   resolved,
+					interval:   durationOf(c, "interval"),
+					window:     int64(durationOf(c, "window") / time.Second),
+					theme:      t,
+					native:     c.Bool("native"),
+					family:     family,
+					size:       c.Int("size"),
+					df:         c.Bool("df"),
+					bindings:   bindings,
+					compare:    compare,
+					noFailover: c.Bool("no-failover"),
+					output:     output,
+					forceTUI:   c.Bool("force-tui"),
+					histWidth:  c.Int("hist-width"),
+					timeFormat: times,
+					keys:       keys,
+					headline:   c.String("headline"),
+					levels:     colours,
+				}
+				if tracing {
+					return runTrace(c.Context, cfg, durationOf(c, "retrace"))
+				}
+				return runHosts(c.Context, cfg)
+			}
 
-	return func() tea.Msg {
-		return initParams{
-			pings: pings,
-			errs:  err,
-		}
-	}
-}
+			t := targets[0]
 
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		if msg.String() == "q" || msg.String() == "esc" || msg.String() == "ctrl+c" {
-			return m, tea.Quit
-		}
-	case initParams:
-		m.pings = msg.pings
-		m.errs = msg.errs
-		return m, m.tick
-	case time.Duration:
-		m.stats.Update(msg.Milliseconds())
-		return m, m.tick
-	case error:
-		return m, tea.Quit
-	}
+			var dnsOptions ping.DNSOptions
+			if t.Mode == target.DNS {
+				dnsOptions, err = dnsOptionsOf(c)
+				if err != nil {
+					return err
+				}
+			}
 
-	return m, nil
-}
+			cfg := tui.Config{
+				Target:    t,
+				Host:      t.Host,
+				Interval:  durationOf(c, "interval"),
+				Window:    int64(durationOf(c, "window") / time.Second),
+				RunID:     c.String("run-id"),
+				StatePath: c.String("state"),
+				Resume:    c.Bool("resume"),
+				Expect:    durationOf(c, "expect"),
+				Baseline:  durationOf(c, "baseline-horizon"),
+				Counters:  c.Bool("interface-counters"),
+				RateLimit: c.Bool("detect-rate-limit"),
+				HalfLife:  durationOf(c, "loss-half-life"),
+				TopN:      c.Int("top-n"),
+				Enrich:    !c.Bool("no-enrich"),
 
-func (m model) View() string {
-	return strings.Join([]string{
-		"PING: " + m.host + " (interval: " + fmt.Sprintf("%d", m.interval) + "s)",
-		"",
-		m.stats.String(),
-		"",
-		m.stats.PrintHistogram(),
-	}, "\n")
-}
+				ResolveEach:  c.Bool("resolve-each"),
+				ReResolve:    durationOf(c, "re-resolve"),
+				FollowDNS:    c.Bool("follow-dns"),
+				RecordPath:   c.String("record-to"),
+				LowPower:     c.Bool("low-power"),
+				NoFailover:   c.Bool("no-failover"),
+				MaxRestarts:  c.Int("max-restarts"),
+				Native:       c.Bool("native"),
+				Family:       family,
+				MaxInFlight:  c.Int("max-in-flight"),
+				WithGateway:  c.Bool("with-gateway"),
+				Size:         c.Int("size"),
+				DontFragment: c.Bool("df"),
+				Binding:      firstBinding(bindings),
 
-func test(ctx context.Context, host string, interval int, window int64) error {
-	model := model{
-		ctx:      ctx,
-		host:     host,
-		interval: interval,
-		window:   window,
-		stats: Stats{
-			windowSize:  time.Duration(window) * time.Second,
-			windowStart: time.Now(),
-			window:      Window{},
-			lastWindow:  Window{},
-			totals:      Window{},
-			histogram:   NewHistogram([]int64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}),
-		},
-	}
+				ReackAfter:    durationOf(c, "reack-after"),
+				RecoverAfter:  c.Int("recovery-probes"),
+				PauseMetered:  c.Bool("pause-on-metered"),
+				ControlSocket: c.String("control-socket"),
+				ForceTUI:      c.Bool("force-tui"),
+				Output:        output,
+				HistWidth:     c.Int("hist-width"),
+				HistVertical:  c.Bool("hist-vertical"),
+				Keys:          keys,
+				WideCSV:       c.String("wide-csv"),
+				StatusFD:      c.String("status-fd"),
+				StatsListen:   c.String("stats-listen"),
+				Serve:         c.String("serve"),
+				MemoryBudget:  c.Int("memory-budget"),
+				Outages:       c.Int("outage-after"),
+				WorstMinutes:  c.Int("worst-minutes"),
+				Levels:        colours,
+				WindowHistory: c.Int("window-history"),
+				AlertCmd:      c.String("alert-cmd"),
+				Bell:          c.Bool("bell"),
+				Sparkline:     c.String("sparkline"),
+				Headline:      c.String("headline"),
+				Count:         c.Int("count"),
+				Duration:      durationOf(c, "duration"),
+				Exit:          stats.ExitThresholds{MaxAvg: durationOf(c, "max-avg"), MaxP99: durationOf(c, "max-p99")},
+				ResultsPath:   c.String("results"),
+				ResultsFormat: c.String("results-format"),
+				ResultsAppend: c.Bool("results-append"),
+				SignKey:       c.String("sign-key"),
+				BundlePath:    c.String("bundle"),
 
-	p := tea.NewProgram(model)
-	_, err := p.Run()
-	if err != nil {
-		return err
-	}
+				HTTPOptions: ping.HTTPOptions{URL: t.URL, KeepAlive: !c.Bool("no-keepalive"), FollowRedirects: c.Bool("follow-redirects")},
+				TimeFormat:  times,
+				DNSOptions:  dnsOptions,
+			}
+
+			if !c.Bool("no-history") {
+				cfg.HistoryPath, err = historyPath(c)
+				if err != nil {
+					return err
+				}
+			}
+
+			if !c.Bool("no-checkpoint") {
+				cfg.CheckpointDir, err = checkpointDir(c)
+				if err != nil {
+					return err
+				}
+			}
+
+			if !slices.Contains(OUTPUTS, cfg.Output) {
+				return fmt.Errorf("unknown output %q, expected one of: %s", cfg.Output, strings.Join(OUTPUTS, ", "))
+			}
+
+			if !slices.Contains(stats.SPARK_MODES, cfg.Sparkline) {
+				return fmt.Errorf("unknown sparkline %q, expected one of: %s", cfg.Sparkline, strings.Join(stats.SPARK_MODES, ", "))
+			}
+
+			cfg.Theme, err = theme.Get(c.String("theme"))
+			if err != nil {
+				return err
+			}
 
-	return nil
+			cfg.Labels, err = parseLabels(c.StringSlice("label"))
+			if err != nil {
+				return err
+			}
+
+			if address := c.String("forward"); address != "" {
+				secret, err := forwardSecret(c.String("forward-secret-env"))
+				if err != nil {
+					return err
+				}
+				source, err := forwardSource(cfg.Labels)
+				if err != nil {
+					return err
+				}
+				cfg.Forward, err = tui.NewForwarder(address, secret, c.String("forward-spool"), source, c.Bool("forward-samples"))
+				if err != nil {
+					return err
+				}
+			}
+
+			if url := c.String("window-webhook"); url != "" {
+				cfg.Webhook, err = newWindowWebhook(url, c.String("webhook-secret-env"), c.String("webhook-spool"))
+				if err != nil {
+					return err
+				}
+			}
+
+			if c.Bool("daily-reset") {
+				cfg.Daily, err = tui.NewDailyReset(c.String("reset-at"), c.String("summary-dir"), time.Now())
+				if err != nil {
+					return err
+				}
+			}
+
+			cfg.Thresholds, cfg.AutoBuckets, err = parseBuckets(c.String("buckets"))
+			if err != nil {
+				return err
+			}
+
+			if path := c.String("reference"); path != "" {
+				if cfg.AutoBuckets {
+					return fmt.Errorf("--reference can't be used with --buckets auto, since the buckets change during the run; give them with --buckets instead")
+				}
+				cfg.Reference, err = stats.LoadReference(path, cfg.Thresholds)
+				if err != nil {
+					return err
+				}
+				if text := c.String("reference-alert"); text != "" {
+					cfg.Reference.Threshold, err = stats.ParsePercent(text)
+					if err != nil {
+						return err
+					}
+				}
+			} else if c.String("reference-alert") != "" {
+				return fmt.Errorf("--reference-alert needs a --reference to compare against")
+			}
+
+			if c.Bool("adaptive") {
+				switch {
+				case c.Bool("burst-on-incident"):
+					return fmt.Errorf("--adaptive and --burst-on-incident each set the rate, so only one can be used")
+				case c.IsSet("burst-tail"):
+					return fmt.Errorf("--burst-tail only applies to --burst-on-incident")
+				}
+				cfg.Burst, err = stats.NewAdaptiveControl(durationOf(c, "burst-interval"), durationOf(c, "interval"))
+				if err != nil {
+					return err
+				}
+			}
+			if c.Bool("burst-on-incident") {
+				cfg.Burst, err = stats.NewBurstControl(durationOf(c, "burst-interval"), durationOf(c, "burst-tail"), durationOf(c, "interval"))
+				if err != nil {
+					return err
+				}
+			}
+
+			if cfg.FollowDNS {
+				switch {
+				case cfg.ReResolve == 0:
+					return fmt.Errorf("--follow-dns needs --re-resolve to notice the host's addresses change")
+				case cfg.ResolveEach:
+					return fmt.Errorf("--follow-dns can't be used with --resolve-each, which looks the host up for every probe anyway")
+				case t.Mode == target.HTTP || t.Mode == target.DNS:
+					return fmt.Errorf("--follow-dns only applies to icmp, tcp and udp, not %s, which looks the host up with each request", t.Mode)
+				}
+			}
+			if _, err := netip.ParseAddr(t.Host); err == nil && cfg.ReResolve > 0 {
+				return fmt.Errorf("--re-resolve needs a name to look up, not the address %s", t.Host)
+			}
+
+			cfg.LossAlerts = stats.LossCriteria{Consecutive: c.Int("alert-consecutive-loss"), Window: durationOf(c, "alert-loss-window")}
+			if text := c.String("alert-window-loss"); text != "" {
+				cfg.LossAlerts.WindowLoss, err = stats.ParsePercent(text)
+				if err != nil {
+					return err
+				}
+			}
+
+			if text := c.String("max-loss"); text != "" {
+				cfg.Exit.MaxLoss, err = stats.ParsePercent(text)
+				if err != nil {
+					return err
+				}
+			}
+			// --max-loss is also what --alert-cmd and --bell go off on, so it
+			// doesn't need the run to end.
+			alerting := cfg.AlertCmd != "" || cfg.Bell
+			if (cfg.Exit.MaxAvg > 0 || cfg.Exit.MaxP99 > 0 || (cfg.Exit.MaxLoss > 0 && !alerting)) && cfg.Count <= 0 && cfg.Duration <= 0 {
+				return fmt.Errorf("--max-avg, --max-p99 and --max-loss need --count or --duration to end the run they check")
+			}
+
+			if c.Bool("call-quality") {
+				if t.Mode == target.HTTP || t.Mode == target.DNS {
+					return fmt.Errorf("--call-quality needs an icmp, tcp or udp target, since %s probes time more than the path", t.Mode)
+				}
+				cfg.Call, err = tui.ParseCallEstimator(c.String("call-codec"), durationOf(c, "jitter-buffer"))
+				if err != nil {
+					return err
+				}
+			}
+
+			if spec := c.String("slo"); spec != "" {
+				slo, err := stats.ParseSLO(spec)
+				if err != nil {
+					return err
+				}
+				cfg.SLO = &slo
+			}
+
+			return tui.Run(c.Context, cfg)
+		},
+	}
 }
+
+var OUTPUTS = []string{"tui", "line", "plain"}
@@ -0,0 +1,63 @@
+package catalog
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+//go:embed *.json
+var builtin embed.FS
+
+type Entry struct {
+	Label string `json:"label"`
+	Host  string `json:"host"`
+	Mode  string `json:"mode"`
+	Port  string `json:"port,omitempty"`
+	// Send and ExpectPrefix validate the response of tcp endpoints, which
+	// are reported degraded when it doesn't match.
+	Send         string `json:"send,omitempty"`
+	ExpectPrefix string `json:"expect_prefix,omitempty"`
+	// Tags are free-form key/value labels, e.g. "dc": "ams", that
+	// endpoints can be grouped by.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Load returns the named built-in catalogue, or the contents of path when it
+// is set so that users can supply their own endpoints.
+func Load(name string, path string) ([]Entry, error) {
+	var data []byte
+	var err error
+
+	if path != "" {
+		data, err = os.ReadFile(path)
+	} else {
+		data, err = builtin.ReadFile(name + ".json")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalogue %s: %s", name, err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse catalogue %s: %s", name, err)
+	}
+
+	for i, entry := range entries {
+		if entry.Host == "" {
+			return nil, fmt.Errorf("catalogue entry %d has no host", i)
+		}
+		if entry.Mode == "" {
+			entries[i].Mode = "icmp"
+		}
+		if entry.Mode == "tcp" && entry.Port == "" {
+			return nil, fmt.Errorf("catalogue entry %q needs a port for tcp mode", entry.Label)
+		}
+		if entry.Label == "" {
+			entries[i].Label = entry.Host
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,155 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type Command struct {
+	Name     string
+	Args     string
+	reply    chan string
+	conn     net.Conn
+	streamed chan struct{}
+}
+
+// Reply answers the client that sent the command. It must be called exactly
+// once for every command received, unless Stream is called instead.
+func (c Command) Reply(message string) {
+	c.reply <- message
+}
+
+// Stream takes the connection over in place of a reply, to write to for as
+// long as the client stays, closing it when done.
+func (c Command) Stream() io.WriteCloser {
+	c.conn.SetDeadline(time.Time{})
+	c.streamed <- struct{}{}
+	return c.conn
+}
+
+type Server struct {
+	path     string
+	listener net.Listener
+	commands chan Command
+}
+
+func Listen(path string) (*Server, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is already in use", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %s", err)
+	}
+
+	return &Server{
+		path:     path,
+		listener: listener,
+		commands: make(chan Command),
+	}, nil
+}
+
+func (s *Server) Commands() chan Command {
+	return s.commands
+}
+
+func (s *Server) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(ctx, conn)
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	streaming := false
+	defer func() {
+		if !streaming {
+			conn.Close()
+		}
+	}()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) && line == "" {
+		return
+	}
+
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	command := Command{Name: name, Args: args, reply: make(chan string, 1), conn: conn, streamed: make(chan struct{}, 1)}
+
+	select {
+	case s.commands <- command:
+	case <-ctx.Done():
+		return
+	}
+
+	select {
+	case reply := <-command.reply:
+		fmt.Fprintln(conn, reply)
+	case <-command.streamed:
+		streaming = true
+	case <-ctx.Done():
+	}
+}
+
+func (s *Server) Close() error {
+	defer os.Remove(s.path)
+	return s.listener.Close()
+}
+
+func Send(path string, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to control socket: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("no reply from control socket: %s", err)
+	}
+
+	return strings.TrimSpace(reply), nil
+}
+
+// Subscribe sends a command the instance answers with a stream, for the
+// caller to read until the instance goes away or the caller closes it.
+func Subscribe(path string, command string) (io.ReadCloser, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket: %s", err)
+	}
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe: %s", err)
+	}
+
+	return conn, nil
+}
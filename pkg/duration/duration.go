@@ -0,0 +1,85 @@
+package duration
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DAY = 24 * time.Hour
+
+var UNIT_NAMES = map[time.Duration]string{
+	time.Millisecond: "milliseconds",
+	time.Second:      "seconds",
+	time.Minute:      "minutes",
+	time.Hour:        "hours",
+	DAY:              "days",
+}
+
+// Parse reads a Go duration such as 1.5s or 250ms, a number of days such as
+// 30d, or a bare number taken in unit. Bare numbers are what several flags
+// took before they took durations, so they keep meaning what they did.
+func Parse(text string, unit time.Duration) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	invalid := fmt.Errorf("expected a duration such as 1.5s or 250ms, or a number of %s", UNIT_NAMES[unit])
+
+	var d time.Duration
+	if value, err := strconv.ParseFloat(text, 64); err == nil {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, invalid
+		}
+		d = time.Duration(value * float64(unit))
+	} else if days, ok := strings.CutSuffix(text, "d"); ok {
+		value, err := strconv.ParseFloat(days, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, invalid
+		}
+		d = time.Duration(value * float64(DAY))
+	} else {
+		d, err = time.ParseDuration(text)
+		if err != nil {
+			return 0, invalid
+		}
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+
+	return d, nil
+}
+
+// Value is a flag.Value for a duration, with the unit bare numbers are taken
+// in.
+type Value struct {
+	Unit     time.Duration
+	Duration time.Duration
+}
+
+func New(d time.Duration, unit time.Duration) *Value {
+	return &Value{Unit: unit, Duration: d}
+}
+
+func (v *Value) Set(text string) error {
+	d, err := Parse(text, v.Unit)
+	if err != nil {
+		return err
+	}
+
+	v.Duration = d
+	return nil
+}
+
+func (v *Value) String() string {
+	if v == nil {
+		return ""
+	}
+
+	if v.Unit == DAY && v.Duration%DAY == 0 {
+		return fmt.Sprintf("%dd", v.Duration/DAY)
+	}
+
+	return v.Duration.String()
+}
@@ -0,0 +1,329 @@
+package echo
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	IDLE_TIMEOUT    = time.Minute
+	MAX_UDP_PAYLOAD = 1472
+	MAX_UDP_CLIENTS = 4096
+	// MIN_UDP_SOURCE_PORT is the lowest port echoes are sent back to. Real
+	// clients send from ephemeral ports, and the services on well-known ones
+	// are what datagrams spoofed from them would turn the reflector on.
+	MIN_UDP_SOURCE_PORT = 1024
+)
+
+// UDPLimits cap the echoes the reflector sends a second, to each client
+// address and in all, so that datagrams spoofed from a victim's address
+// can't have it flood them. Zero is no limit.
+type UDPLimits struct {
+	PerClient float64
+	Total     float64
+}
+
+var DEFAULT_UDP_LIMITS = UDPLimits{PerClient: 50, Total: 1000}
+
+// bucket lets through rate datagrams a second, and a second's worth at once
+// after a pause.
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool
+}
+
+func (b *bucket) take(rate float64, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+
+	burst := max(rate, 1)
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// udpLimiter applies the limits, keeping a bucket per client address for up
+// to MAX_UDP_CLIENTS of them. Past that, new clients are turned away until
+// those idle long enough to have a full bucket again are cleared out.
+type udpLimiter struct {
+	limits  UDPLimits
+	total   bucket
+	clients map[string]*bucket
+}
+
+func newUDPLimiter(limits UDPLimits) *udpLimiter {
+	return &udpLimiter{limits: limits, clients: map[string]*bucket{}}
+}
+
+// allow is whether to echo a datagram from client now, with the message to
+// log when the client has just been limited or let through again.
+func (l *udpLimiter) allow(client string, now time.Time) (bool, string) {
+	b := l.clients[client]
+	if b == nil {
+		if len(l.clients) >= MAX_UDP_CLIENTS {
+			l.sweep(now)
+		}
+		if len(l.clients) >= MAX_UDP_CLIENTS {
+			return false, ""
+		}
+		b = &bucket{}
+		l.clients[client] = b
+	}
+
+	if !b.take(l.limits.PerClient, now) {
+		if b.limited {
+			return false, ""
+		}
+		b.limited = true
+		return false, fmt.Sprintf("over %g echoes a second, dropping the rest", l.limits.PerClient)
+	}
+	if !l.total.take(l.limits.Total, now) {
+		if l.total.limited {
+			return false, ""
+		}
+		l.total.limited = true
+		return false, fmt.Sprintf("over %g echoes a second in all, dropping the rest", l.limits.Total)
+	}
+
+	message := ""
+	if b.limited {
+		message = "echoing again"
+	}
+	b.limited = false
+	l.total.limited = false
+
+	return true, message
+}
+
+func (l *udpLimiter) sweep(now time.Time) {
+	// A bucket that's had time to fill again is as good as new.
+	idle := time.Second
+	if rate := l.limits.PerClient; rate > 0 && rate < 1 {
+		idle = time.Duration(float64(time.Second) / rate)
+	}
+
+	for client, b := range l.clients {
+		if now.Sub(b.last) >= idle {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// Logger receives one line per access, in the order they happen.
+type Logger func(proto string, client string, message string)
+
+// limiter caps how many connections or requests a single client address may
+// have open at once.
+type limiter struct {
+	max    int
+	lock   sync.Mutex
+	active map[string]int
+}
+
+func newLimiter(max int) *limiter {
+	return &limiter{max: max, active: map[string]int{}}
+}
+
+func (l *limiter) acquire(client string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.max > 0 && l.active[client] >= l.max {
+		return false
+	}
+
+	l.active[client]++
+	return true
+}
+
+func (l *limiter) release(client string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.active[client]--
+	if l.active[client] <= 0 {
+		delete(l.active, client)
+	}
+}
+
+func host(addr net.Addr) string {
+	h, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return h
+}
+
+// ServeTCP echoes back whatever each connection sends until it goes idle.
+func ServeTCP(ctx context.Context, address string, perClient int, log Logger) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for tcp: %s", err)
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	limits := newLimiter(perClient)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept tcp connection: %s", err)
+		}
+
+		client := host(conn.RemoteAddr())
+		if !limits.acquire(client) {
+			log("tcp", conn.RemoteAddr().String(), "rejected, too many connections")
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer limits.release(client)
+			defer conn.Close()
+
+			log("tcp", conn.RemoteAddr().String(), "connected")
+			n, err := copyWithIdle(conn)
+			if err != nil && err != io.EOF {
+				log("tcp", conn.RemoteAddr().String(), fmt.Sprintf("closed after %d bytes: %s", n, err))
+				return
+			}
+			log("tcp", conn.RemoteAddr().String(), fmt.Sprintf("closed after %d bytes", n))
+		}()
+	}
+}
+
+func copyWithIdle(conn net.Conn) (int64, error) {
+	var total int64
+	buffer := make([]byte, 4096)
+
+	for {
+		conn.SetDeadline(time.Now().Add(IDLE_TIMEOUT))
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			if _, werr := conn.Write(buffer[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// ServeUDP listens on address and reflects datagrams as ReflectUDP does.
+func ServeUDP(ctx context.Context, address string, limits UDPLimits, log Logger) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for udp: %s", err)
+	}
+
+	return ReflectUDP(ctx, conn, limits, log)
+}
+
+// ReflectUDP reflects each datagram back to its sender, with the time it was
+// received appended as big-endian unix nanoseconds, up to the limits. The
+// reply goes to whichever address the datagram came from, so NAT rebinding
+// doesn't matter. Only the first datagram from each client is logged, and
+// the times it's limited.
+func ReflectUDP(ctx context.Context, conn net.PacketConn, limits UDPLimits, log Logger) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	limiter := newUDPLimiter(limits)
+	seen := map[string]bool{}
+	buffer := make([]byte, MAX_UDP_PAYLOAD+8)
+	for {
+		n, addr, err := conn.ReadFrom(buffer[:MAX_UDP_PAYLOAD])
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read udp: %s", err)
+		}
+
+		if udp, ok := addr.(*net.UDPAddr); ok && udp.Port < MIN_UDP_SOURCE_PORT {
+			continue
+		}
+		now := time.Now()
+		allowed, message := limiter.allow(host(addr), now)
+		if message != "" {
+			log("udp", addr.String(), message)
+		}
+		if !allowed {
+			continue
+		}
+
+		if !seen[addr.String()] {
+			if len(seen) >= MAX_UDP_CLIENTS {
+				seen = map[string]bool{}
+			}
+			seen[addr.String()] = true
+			log("udp", addr.String(), "first datagram")
+		}
+
+		binary.BigEndian.PutUint64(buffer[n:], uint64(now.UnixNano()))
+		conn.WriteTo(buffer[:n+8], addr)
+	}
+}
+
+// ServeHTTP answers every request with 204 No Content.
+func ServeHTTP(ctx context.Context, address string, perClient int, log Logger) error {
+	limits := newLimiter(perClient)
+
+	server := &http.Server{
+		Addr:        address,
+		IdleTimeout: IDLE_TIMEOUT,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				client = r.RemoteAddr
+			}
+
+			if !limits.acquire(client) {
+				log("http", r.RemoteAddr, fmt.Sprintf("%s %s 429", r.Method, r.URL.Path))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			defer limits.release(client)
+
+			log("http", r.RemoteAddr, fmt.Sprintf("%s %s 204", r.Method, r.URL.Path))
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to serve http: %s", err)
+	}
+
+	return nil
+}
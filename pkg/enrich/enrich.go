@@ -0,0 +1,222 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TIMEOUT   = 5 * time.Second
+	CACHE_TTL = 24 * time.Hour
+	RDAP_URL  = "https://rdap.org/ip/"
+)
+
+type Info struct {
+	Address   string    `json:"address"`
+	PTR       string    `json:"ptr,omitempty"`
+	Org       string    `json:"org,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+func (i Info) String() string {
+	parts := []string{i.Address}
+	if i.PTR != "" {
+		parts = append(parts, i.PTR)
+	}
+	if i.Org != "" {
+		parts = append(parts, i.Org)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+var (
+	cacheLock sync.Mutex
+	cache     map[string]Info
+)
+
+func cachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "network-test", "enrich.json"), nil
+}
+
+func loadCache() {
+	cache = map[string]Info{}
+
+	path, err := cachePath()
+	if err != nil {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	json.Unmarshal(data, &cache)
+}
+
+func storeCache() {
+	path, err := cachePath()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+
+	os.WriteFile(path, data, 0o644)
+}
+
+func cached(address string) (Info, bool) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	if cache == nil {
+		loadCache()
+	}
+
+	info, ok := cache[address]
+	if !ok || time.Since(info.FetchedAt) > CACHE_TTL {
+		return Info{}, false
+	}
+
+	return info, true
+}
+
+func remember(info Info) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	cache[info.Address] = info
+	storeCache()
+}
+
+// Lookup resolves the host and describes the address it points at using
+// reverse DNS and RDAP. Partial results are returned if either lookup fails.
+func Lookup(ctx context.Context, host string) (Info, error) {
+	ctx, cancel := context.WithTimeout(ctx, TIMEOUT)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to resolve %s: %s", host, err)
+	}
+	if len(addrs) == 0 {
+		return Info{}, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	address := addrs[0].IP.String()
+	if info, ok := cached(address); ok {
+		return info, nil
+	}
+
+	info := Info{
+		Address:   address,
+		FetchedAt: time.Now(),
+	}
+
+	if names, err := net.DefaultResolver.LookupAddr(ctx, address); err == nil && len(names) > 0 {
+		info.PTR = strings.TrimSuffix(names[0], ".")
+	}
+
+	if org, err := rdapOrg(ctx, address); err == nil {
+		info.Org = org
+	}
+
+	if info.PTR != "" || info.Org != "" {
+		remember(info)
+	}
+
+	return info, nil
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+}
+
+type rdapResponse struct {
+	Name     string       `json:"name"`
+	Entities []rdapEntity `json:"entities"`
+}
+
+func rdapOrg(ctx context.Context, address string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, RDAP_URL+address, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("rdap lookup returned %s", res.Status)
+	}
+
+	var body rdapResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse rdap response: %s", err)
+	}
+
+	for _, entity := range body.Entities {
+		for _, role := range entity.Roles {
+			if role != "registrant" {
+				continue
+			}
+
+			if name := vcardName(entity.VCardArray); name != "" {
+				return name, nil
+			}
+		}
+	}
+
+	return body.Name, nil
+}
+
+func vcardName(raw json.RawMessage) string {
+	var vcard []any
+	if err := json.Unmarshal(raw, &vcard); err != nil || len(vcard) < 2 {
+		return ""
+	}
+
+	properties, ok := vcard[1].([]any)
+	if !ok {
+		return ""
+	}
+
+	for _, property := range properties {
+		fields, ok := property.([]any)
+		if !ok || len(fields) < 4 || fields[0] != "fn" {
+			continue
+		}
+
+		if name, ok := fields[3].(string); ok {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,320 @@
+package evidence
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	MANIFEST   = "manifest.json"
+	SIGNATURE  = "manifest.sig"
+	PUBLIC_KEY = "public.pem"
+
+	PRIVATE_KEY_TYPE = "PRIVATE KEY"
+	PUBLIC_KEY_TYPE  = "PUBLIC KEY"
+)
+
+// Manifest lists the SHA-256 of every file in a bundle. It is the part
+// that's signed, in its canonical form, so changing any file breaks the
+// signature.
+type Manifest struct {
+	RunID   string            `json:"run_id"`
+	Created time.Time         `json:"created"`
+	Files   map[string]string `json:"files"`
+}
+
+type Bundle struct {
+	Manifest  Manifest
+	Files     map[string][]byte
+	PublicKey ed25519.PublicKey
+}
+
+// Canonicalize re-encodes JSON with object keys sorted, no insignificant
+// whitespace and numbers kept exactly as written, so that equal documents
+// always serialise, and so hash, the same.
+func Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %s", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("failed to parse JSON: more than one value")
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	// Maps are encoded with their keys sorted.
+	if err := encoder.Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %s", err)
+	}
+
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// WriteKeys saves the private key to path, readable only by its owner, and
+// the public key beside it as path.pub, both PEM encoded.
+func WriteKeys(path string, public ed25519.PublicKey, private ed25519.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %s", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create private key: %s", err)
+	}
+	if err := pem.Encode(file, &pem.Block{Type: PRIVATE_KEY_TYPE, Bytes: der}); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write private key: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write private key: %s", err)
+	}
+
+	encoded, err := encodePublicKey(public)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path+".pub", encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write public key: %s", err)
+	}
+
+	return nil
+}
+
+func encodePublicKey(public ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %s", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: PUBLIC_KEY_TYPE, Bytes: der}), nil
+}
+
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %s", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != PRIVATE_KEY_TYPE {
+		return nil, fmt.Errorf("failed to read signing key: %s isn't a PEM private key", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %s", err)
+	}
+
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to read signing key: %s isn't an ed25519 key", path)
+	}
+
+	return private, nil
+}
+
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != PUBLIC_KEY_TYPE {
+		return nil, fmt.Errorf("failed to read public key: not a PEM public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %s", err)
+	}
+
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to read public key: not an ed25519 key")
+	}
+
+	return public, nil
+}
+
+// Fingerprint is the SHA-256 of the public key, for checking a bundle's key
+// against one handed over some other way.
+func Fingerprint(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:])
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Write zips files together with a manifest of their hashes, its signature
+// and the public key to check it with. JSON files are stored canonicalised,
+// so they hash the same however they were produced.
+func Write(path string, runID string, files map[string][]byte, private ed25519.PrivateKey) error {
+	manifest := Manifest{RunID: runID, Created: time.Now().UTC(), Files: map[string]string{}}
+
+	stored := map[string][]byte{}
+	for name, data := range files {
+		if len(name) > 5 && name[len(name)-5:] == ".json" {
+			canonical, err := Canonicalize(data)
+			if err != nil {
+				return fmt.Errorf("failed to canonicalise %s: %s", name, err)
+			}
+			data = canonical
+		}
+		stored[name] = data
+		manifest.Files[name] = hash(data)
+	}
+
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %s", err)
+	}
+	canonical, err := Canonicalize(encoded)
+	if err != nil {
+		return err
+	}
+
+	public, err := encodePublicKey(private.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+
+	stored[MANIFEST] = canonical
+	stored[SIGNATURE] = []byte(hex.EncodeToString(ed25519.Sign(private, canonical)) + "\n")
+	stored[PUBLIC_KEY] = public
+
+	var names []string
+	for name := range stored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	for _, name := range names {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: manifest.Created})
+		if err != nil {
+			return fmt.Errorf("failed to write bundle: %s", err)
+		}
+		if _, err := w.Write(stored[name]); err != nil {
+			return fmt.Errorf("failed to write bundle: %s", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %s", err)
+	}
+
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write bundle: %s", err)
+	}
+
+	return nil
+}
+
+// Verify opens a bundle and checks its signature, then every file against
+// the manifest, with no file allowed that the manifest doesn't list. With
+// trusted set, the bundle must also have been signed with that key rather
+// than just the one inside it.
+func Verify(path string, trusted ed25519.PublicKey) (Bundle, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("failed to open bundle: %s", err)
+	}
+	defer archive.Close()
+
+	contents := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			return Bundle{}, fmt.Errorf("failed to read %s: %s", file.Name, err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return Bundle{}, fmt.Errorf("failed to read %s: %s", file.Name, err)
+		}
+		if _, ok := contents[file.Name]; ok {
+			return Bundle{}, fmt.Errorf("bundle holds %s twice", file.Name)
+		}
+		contents[file.Name] = data
+	}
+
+	for _, name := range []string{MANIFEST, SIGNATURE, PUBLIC_KEY} {
+		if _, ok := contents[name]; !ok {
+			return Bundle{}, fmt.Errorf("bundle has no %s", name)
+		}
+	}
+
+	public, err := ParsePublicKey(contents[PUBLIC_KEY])
+	if err != nil {
+		return Bundle{}, err
+	}
+	if trusted != nil && !public.Equal(trusted) {
+		return Bundle{}, fmt.Errorf("bundle was signed with key %s, not the trusted %s", Fingerprint(public), Fingerprint(trusted))
+	}
+
+	signature, err := hex.DecodeString(string(bytes.TrimSpace(contents[SIGNATURE])))
+	if err != nil {
+		return Bundle{}, fmt.Errorf("failed to read signature: %s", err)
+	}
+
+	// The stored manifest must already be canonical, so that what was
+	// signed is exactly what's there.
+	canonical, err := Canonicalize(contents[MANIFEST])
+	if err != nil || !bytes.Equal(canonical, contents[MANIFEST]) {
+		return Bundle{}, fmt.Errorf("manifest isn't in canonical form")
+	}
+	if !ed25519.Verify(public, canonical, signature) {
+		return Bundle{}, fmt.Errorf("signature doesn't match the manifest")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(canonical, &manifest); err != nil {
+		return Bundle{}, fmt.Errorf("failed to parse manifest: %s", err)
+	}
+
+	bundle := Bundle{Manifest: manifest, Files: map[string][]byte{}, PublicKey: public}
+	for name, data := range contents {
+		if name == MANIFEST || name == SIGNATURE || name == PUBLIC_KEY {
+			continue
+		}
+
+		expected, ok := manifest.Files[name]
+		if !ok {
+			return Bundle{}, fmt.Errorf("%s isn't in the manifest", name)
+		}
+		if hash(data) != expected {
+			return Bundle{}, fmt.Errorf("%s has been changed since it was signed", name)
+		}
+		bundle.Files[name] = data
+	}
+
+	for name := range manifest.Files {
+		if _, ok := bundle.Files[name]; !ok {
+			return Bundle{}, fmt.Errorf("%s is missing from the bundle", name)
+		}
+	}
+
+	return bundle, nil
+}
@@ -0,0 +1,209 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	FILE_NAME        = "history.jsonl"
+	BASELINE_HORIZON = 30 * 24 * time.Hour
+)
+
+// Run is the summary kept for each finished run, one JSON object per line.
+// Latencies are in milliseconds, to the microsecond, where older lines have
+// them whole.
+type Run struct {
+	RunID   string    `json:"run_id"`
+	Host    string    `json:"host"`
+	Mode    string    `json:"mode"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Count   int       `json:"count"`
+	MinMs   float64   `json:"min_ms"`
+	AvgMs   float64   `json:"avg_ms"`
+	MaxMs   float64   `json:"max_ms"`
+	P95Ms   float64   `json:"p95_ms"`
+	LossPct float64   `json:"loss_pct"`
+	// Incomplete runs were recovered from a checkpoint after the program
+	// died, so End is the last checkpoint rather than when probing stopped.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Milliseconds is a latency as a Run keeps it.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// FormatMs is a latency kept in milliseconds, in microseconds below one.
+func FormatMs(ms float64) string {
+	switch {
+	case ms < 1:
+		return fmt.Sprintf("%.0fµs", ms*1000)
+	case ms < 10:
+		return fmt.Sprintf("%.2fms", ms)
+	case ms < 100:
+		return fmt.Sprintf("%.1fms", ms)
+	}
+
+	return fmt.Sprintf("%.0fms", ms)
+}
+
+// DefaultPath is the history file under the XDG data directory, falling
+// back to ~/.local/share when XDG_DATA_HOME isn't set.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find a data directory for the history: %s", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dir, "network-test", FILE_NAME), nil
+}
+
+// Load reads every run in the history file. A missing file is an empty
+// history, and lines that don't parse are skipped rather than failing the
+// whole read.
+func Load(path string) ([]Run, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %s", err)
+	}
+	defer file.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %s", err)
+	}
+
+	return runs, nil
+}
+
+func Append(path string, run Run) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %s", err)
+	}
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %s", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %s", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %s", err)
+	}
+
+	return nil
+}
+
+// Prune drops runs that ended before the cutoff, rewriting the file in
+// place, and returns how many were removed.
+func Prune(path string, before time.Time) (int, error) {
+	runs, err := Load(path)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := slices.DeleteFunc(slices.Clone(runs), func(run Run) bool { return run.End.Before(before) })
+	if len(kept) == len(runs) {
+		return 0, nil
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rewrite history: %s", err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, run := range kept {
+		if err := encoder.Encode(run); err != nil {
+			file.Close()
+			return 0, fmt.Errorf("failed to rewrite history: %s", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("failed to rewrite history: %s", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("failed to rewrite history: %s", err)
+	}
+
+	return len(runs) - len(kept), nil
+}
+
+// Baseline is the typical p95 over previous runs against the same host in
+// the same mode.
+type Baseline struct {
+	Runs      int
+	MedianP95 float64
+	Horizon   time.Duration
+}
+
+func Compare(runs []Run, host string, mode string, now time.Time, horizon time.Duration) Baseline {
+	var p95s []float64
+	for _, run := range runs {
+		if run.Host == host && run.Mode == mode && run.Count > 0 && !run.End.Before(now.Add(-horizon)) {
+			p95s = append(p95s, run.P95Ms)
+		}
+	}
+
+	return Baseline{Runs: len(p95s), MedianP95: Median(p95s), Horizon: horizon}
+}
+
+func Median[T int64 | float64](values []T) T {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
+
+func (b Baseline) String() string {
+	return fmt.Sprintf("%d-day median p95 %s over %d runs", int(b.Horizon.Hours()/24), FormatMs(b.MedianP95), b.Runs)
+}
+
+// Deviation describes how the run's p95 compares to the baseline.
+func (b Baseline) Deviation(p95 float64) string {
+	line := fmt.Sprintf("today p95 %s vs %d-day median %s", FormatMs(p95), int(b.Horizon.Hours()/24), FormatMs(b.MedianP95))
+	if b.MedianP95 > 0 {
+		line += fmt.Sprintf(" (%+.0f%%)", (p95-b.MedianP95)/b.MedianP95*100)
+	}
+
+	return line
+}
@@ -0,0 +1,187 @@
+package ifstat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoPlatform = fmt.Errorf("interface counters are not supported on %s", runtime.GOOS)
+
+type Counters struct {
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+}
+
+// Read returns the cumulative counters for an interface. It is a variable so
+// that callers can substitute a fake.
+var Read = func(ctx context.Context, iface string) (Counters, error) {
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/net/dev")
+		if err != nil {
+			return Counters{}, fmt.Errorf("failed to read interface counters: %s", err)
+		}
+		return parseProcNetDev(data, iface)
+	case "darwin", "freebsd", "openbsd":
+		out, err := exec.CommandContext(ctx, "netstat", "-ibn", "-I", iface).Output()
+		if err != nil {
+			return Counters{}, fmt.Errorf("failed to read interface counters: %s", err)
+		}
+		return parseNetstat(out, iface)
+	default:
+		return Counters{}, ErrNoPlatform
+	}
+}
+
+func parseProcNetDev(data []byte, iface string) (Counters, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) != iface {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 10 {
+			return Counters{}, fmt.Errorf("unexpected /proc/net/dev line for %s", iface)
+		}
+
+		return Counters{
+			RxBytes:   parseUint(fields[0]),
+			RxPackets: parseUint(fields[1]),
+			TxBytes:   parseUint(fields[8]),
+			TxPackets: parseUint(fields[9]),
+		}, nil
+	}
+
+	return Counters{}, fmt.Errorf("interface %s not found in /proc/net/dev", iface)
+}
+
+// parseNetstat reads the link-level row of `netstat -ibn`, which is the only
+// one carrying the full byte counts.
+func parseNetstat(out []byte, iface string) (Counters, error) {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 2 {
+		return Counters{}, fmt.Errorf("unexpected netstat output for %s", iface)
+	}
+
+	header := strings.Fields(lines[0])
+	column := map[string]int{}
+	for i, name := range header {
+		column[name] = i
+	}
+
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) || fields[0] != iface || !strings.HasPrefix(fields[column["Network"]], "<Link") {
+			continue
+		}
+
+		return Counters{
+			RxBytes:   parseUint(fields[column["Ibytes"]]),
+			RxPackets: parseUint(fields[column["Ipkts"]]),
+			TxBytes:   parseUint(fields[column["Obytes"]]),
+			TxPackets: parseUint(fields[column["Opkts"]]),
+		}, nil
+	}
+
+	return Counters{}, fmt.Errorf("interface %s not found in netstat output", iface)
+}
+
+func parseUint(value string) uint64 {
+	n, _ := strconv.ParseUint(value, 10, 64)
+	return n
+}
+
+// Sampler turns successive counter readings into throughput. A reading that
+// goes backwards after a counter reset, or is for a different interface,
+// starts over.
+type Sampler struct {
+	iface  string
+	last   Counters
+	lastAt time.Time
+
+	RxRate float64
+	TxRate float64
+
+	windowRx    uint64
+	windowTx    uint64
+	windowStart time.Time
+}
+
+func (s *Sampler) Add(iface string, counters Counters, now time.Time) {
+	if iface != s.iface || counters.RxBytes < s.last.RxBytes || counters.TxBytes < s.last.TxBytes {
+		s.iface = iface
+		s.last = counters
+		s.lastAt = now
+		s.RxRate = 0
+		s.TxRate = 0
+		return
+	}
+
+	rx := counters.RxBytes - s.last.RxBytes
+	tx := counters.TxBytes - s.last.TxBytes
+	if elapsed := now.Sub(s.lastAt).Seconds(); elapsed > 0 {
+		s.RxRate = float64(rx) * 8 / elapsed
+		s.TxRate = float64(tx) * 8 / elapsed
+	}
+
+	if s.windowStart.IsZero() {
+		s.windowStart = s.lastAt
+	}
+	s.windowRx += rx
+	s.windowTx += tx
+
+	s.last = counters
+	s.lastAt = now
+}
+
+func (s *Sampler) Interface() string {
+	return s.iface
+}
+
+// Updated is when the rates were last worked out.
+func (s *Sampler) Updated() time.Time {
+	return s.lastAt
+}
+
+// TakeWindow returns the average rx and tx rates in bits per second since
+// the previous call, and starts a new window.
+func (s *Sampler) TakeWindow() (float64, float64, bool) {
+	start := s.windowStart
+	rx, tx := s.windowRx, s.windowTx
+
+	s.windowRx = 0
+	s.windowTx = 0
+	s.windowStart = s.lastAt
+
+	elapsed := s.lastAt.Sub(start).Seconds()
+	if start.IsZero() || elapsed <= 0 {
+		return 0, 0, false
+	}
+
+	return float64(rx) * 8 / elapsed, float64(tx) * 8 / elapsed, true
+}
+
+func FormatRate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.1f Gbit/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.1f Mbit/s", bps/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.0f kbit/s", bps/1e3)
+	default:
+		return fmt.Sprintf("%.0f bit/s", bps)
+	}
+}
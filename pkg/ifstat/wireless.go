@@ -0,0 +1,67 @@
+package ifstat
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Wireless is the link quality and signal level the driver reports for a
+// Wi-Fi interface.
+type Wireless struct {
+	LinkQuality float64
+	SignalDBm   float64
+}
+
+// ReadWireless returns the current Wi-Fi reading for an interface. It is a
+// variable so that callers can substitute a fake.
+var ReadWireless = func(iface string) (Wireless, error) {
+	if runtime.GOOS != "linux" {
+		return Wireless{}, fmt.Errorf("wi-fi readings are not supported on %s", runtime.GOOS)
+	}
+
+	data, err := os.ReadFile("/proc/net/wireless")
+	if err != nil {
+		return Wireless{}, fmt.Errorf("failed to read wi-fi status: %s", err)
+	}
+
+	return parseProcNetWireless(data, iface)
+}
+
+// parseProcNetWireless reads a line such as
+//
+//	wlan0: 0000   70.  -40.  -256        0      0      0      0      0        0
+//
+// where the values after the status are the link quality and signal level.
+func parseProcNetWireless(data []byte, iface string) (Wireless, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) != iface {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 3 {
+			return Wireless{}, fmt.Errorf("unexpected /proc/net/wireless line for %s", iface)
+		}
+
+		quality, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "."), 64)
+		if err != nil {
+			return Wireless{}, fmt.Errorf("failed to parse link quality for %s: %s", iface, err)
+		}
+
+		signal, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		if err != nil {
+			return Wireless{}, fmt.Errorf("failed to parse signal level for %s: %s", iface, err)
+		}
+
+		return Wireless{LinkQuality: quality, SignalDBm: signal}, nil
+	}
+
+	return Wireless{}, fmt.Errorf("interface %s is not a wi-fi interface", iface)
+}
@@ -0,0 +1,49 @@
+package ping
+
+import (
+	"net/netip"
+	"os/exec"
+)
+
+// BackendStatus is whether a backend can probe from here, and if not, why.
+type BackendStatus struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Available reports which backends can probe from here: the exec ones need a
+// ping binary on the path, and native an ICMP socket it's allowed to open,
+// which is tried by opening one. The tcp, udp, http and dns probes need nothing.
+func Available() []BackendStatus {
+	var statuses []BackendStatus
+
+	_, lookErr := exec.LookPath("ping")
+	for _, b := range BACKENDS {
+		status := BackendStatus{Name: b.name, Available: true}
+		switch b.name {
+		case "native":
+			conn, err := listenICMP(netip.IPv4Unspecified(), netip.Addr{})
+			if err != nil {
+				status.Available, status.Detail = false, err.Error()
+			} else {
+				status.Detail = "raw socket"
+				if !conn.raw {
+					status.Detail = "datagram socket"
+				}
+				conn.conn.Close()
+			}
+		default:
+			if lookErr != nil {
+				status.Available, status.Detail = false, "no ping binary on the path"
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, name := range []string{"tcp", "http", "dns"} {
+		statuses = append(statuses, BackendStatus{Name: name, Available: true})
+	}
+
+	return statuses
+}
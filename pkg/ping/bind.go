@@ -0,0 +1,242 @@
+package ping
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"runtime"
+	"strings"
+)
+
+// Binding is where probes are sent from: an address of this machine, an
+// interface, or both, for comparing the paths of a multi-homed machine.
+type Binding struct {
+	Source    netip.Addr
+	Interface string
+}
+
+func (b Binding) IsZero() bool {
+	return !b.Source.IsValid() && b.Interface == ""
+}
+
+func (b Binding) String() string {
+	var parts []string
+	if b.Source.IsValid() {
+		parts = append(parts, "from "+b.Source.String())
+	}
+	if b.Interface != "" {
+		parts = append(parts, "via "+b.Interface)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// BindError is a binding this machine can't send from, which running the
+// pinger again won't change.
+type BindError struct {
+	Message string
+}
+
+func (e *BindError) Error() string {
+	return e.Message
+}
+
+func bindError(format string, args ...any) error {
+	return &BindError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Bind has the probes sent from the binding. A source address settles the
+// family when it hasn't been chosen, since it can only reach hosts in its
+// own.
+func (p *Pinger) Bind(b Binding) *Pinger {
+	p.binding = b
+	if p.family == "" && b.Source.IsValid() {
+		p.family = familyFlag(b.Source)
+	}
+	return p
+}
+
+// familyFlag is the family an address is in, as --ipv4 and --ipv6 name it.
+func familyFlag(addr netip.Addr) string {
+	if addr.Unmap().Is4() {
+		return IPV4
+	}
+
+	return IPV6
+}
+
+func (p *Pinger) Binding() Binding {
+	return p.binding
+}
+
+// CheckBinding reports an interface that isn't there or is down, or a
+// source that isn't one of its addresses or this machine's, up front,
+// rather than leaving every probe to fail on it.
+func (p *Pinger) CheckBinding() error {
+	if p.binding.IsZero() {
+		return nil
+	}
+	if !p.icmp() {
+		return fmt.Errorf("--source and --interface only apply to icmp for now")
+	}
+
+	if err := checkBinding(p.binding, p.family); err != nil {
+		return err
+	}
+	if addr, err := netip.ParseAddr(p.host); err == nil && p.binding.Source.IsValid() && FamilyOf(addr) != FamilyOf(p.binding.Source) {
+		return fmt.Errorf("%s is an %s address, so can't be reached from %s", p.host, FamilyOf(addr), p.binding.Source)
+	}
+	if p.Backend() == "native" {
+		return nil
+	}
+
+	_, err := BindArgs(p.host, p.family, p.binding, runtime.GOOS)
+	return err
+}
+
+func checkBinding(b Binding, family string) error {
+	if b.Source.IsValid() && family != "" && family != familyFlag(b.Source) {
+		return fmt.Errorf("--source %s is an %s address, so can't be used with --%s", b.Source, FamilyOf(b.Source), family)
+	}
+
+	var addrs []net.Addr
+	var err error
+	if b.Interface != "" {
+		var iface *net.Interface
+		iface, err = net.InterfaceByName(b.Interface)
+		if err != nil {
+			return fmt.Errorf("no interface named %q, expected one of: %s", b.Interface, strings.Join(interfaceNames(), ", "))
+		}
+		if iface.Flags&net.FlagUp == 0 {
+			return fmt.Errorf("interface %s is down", b.Interface)
+		}
+		addrs, err = iface.Addrs()
+	} else {
+		addrs, err = net.InterfaceAddrs()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list addresses: %s", err)
+	}
+
+	if !b.Source.IsValid() {
+		return nil
+	}
+	for _, addr := range addrs {
+		if local, ok := prefixAddr(addr); ok && local == b.Source.WithZone("").Unmap() {
+			return nil
+		}
+	}
+	if b.Interface != "" {
+		return fmt.Errorf("%s isn't an address of %s", b.Source, b.Interface)
+	}
+	return fmt.Errorf("%s isn't an address of this machine", b.Source)
+}
+
+func interfaceNames() []string {
+	ifaces, _ := net.Interfaces()
+	names := make([]string, len(ifaces))
+	for i, iface := range ifaces {
+		names[i] = iface.Name
+	}
+
+	return names
+}
+
+func prefixAddr(addr net.Addr) (netip.Addr, bool) {
+	prefix, ok := addr.(*net.IPNet)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	local, ok := netip.AddrFromSlice(prefix.IP)
+	return local.Unmap(), ok
+}
+
+// BindArgs are the system ping's options for the binding, which each
+// platform spells its own way, or an error for what it can't do. iputils
+// takes one -I, so given both it goes by the interface, which the source was
+// checked to be on.
+func BindArgs(host string, family string, b Binding, goos string) ([]string, error) {
+	if b.IsZero() {
+		return nil, nil
+	}
+
+	switch goos {
+	case "linux":
+		if b.Interface != "" {
+			return []string{"-I", b.Interface}, nil
+		}
+		return []string{"-I", b.Source.String()}, nil
+	case "darwin":
+		var args []string
+		if b.Interface != "" {
+			flag := "-b"
+			if wantsIPv6(host, family) {
+				flag = "-I"
+			}
+			args = append(args, flag, b.Interface)
+		}
+		if b.Source.IsValid() {
+			args = append(args, "-S", b.Source.String())
+		}
+		return args, nil
+	case "freebsd", "windows":
+		if b.Interface != "" {
+			return nil, fmt.Errorf("--interface isn't supported by the system ping on %s; give --source one of its addresses instead, or use --native", goos)
+		}
+		return []string{"-S", b.Source.String()}, nil
+	}
+
+	return nil, fmt.Errorf("--source and --interface aren't supported by the system ping on %s; use --native", goos)
+}
+
+// localAddr is the address the native backend's socket is bound to for the
+// family of the target: the source, or the interface's own address, with
+// a link-local one used only if it has no other.
+func (p *Pinger) localAddr(v6 bool) (netip.Addr, error) {
+	if p.binding.Source.IsValid() {
+		return p.binding.Source, nil
+	}
+	if p.binding.Interface == "" {
+		return netip.Addr{}, nil
+	}
+
+	iface, err := net.InterfaceByName(p.binding.Interface)
+	if err != nil {
+		return netip.Addr{}, bindError("interface %s has gone: %s", p.binding.Interface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to list the addresses of %s: %s", p.binding.Interface, err)
+	}
+
+	var linkLocal netip.Addr
+	for _, addr := range addrs {
+		local, ok := prefixAddr(addr)
+		if !ok || local.Is6() != v6 {
+			continue
+		}
+		if !local.IsLinkLocalUnicast() {
+			return local, nil
+		}
+		if !linkLocal.IsValid() {
+			linkLocal = local.WithZone(p.binding.Interface)
+		}
+	}
+	if linkLocal.IsValid() {
+		return linkLocal, nil
+	}
+
+	family := "IPv4"
+	if v6 {
+		family = "IPv6"
+	}
+	return netip.Addr{}, bindError("interface %s has no %s address to send from", p.binding.Interface, family)
+}
+
+// execOptions are the system ping's options for the payload and binding,
+// left out for a combination the checks would have refused.
+func (p *Pinger) execOptions() []string {
+	packet, _ := PacketArgs(p.host, p.family, p.size, p.dontFragment, runtime.GOOS)
+	bind, _ := BindArgs(p.host, p.family, p.binding, runtime.GOOS)
+	return append(packet, bind...)
+}
@@ -0,0 +1,220 @@
+package ping
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	LOSS_RCODE = "rcode"
+
+	DNS_PORT        = "53"
+	DNS_BUFFER_SIZE = 4096
+	RESOLV_CONF     = "/etc/resolv.conf"
+)
+
+var DNS_RECORDS = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+	"SOA":   dnsmessage.TypeSOA,
+}
+
+type DNSOptions struct {
+	Record string
+	// Servers are taken in turn, one per probe, so that resolvers can be
+	// compared over the same run.
+	Servers []string
+}
+
+// DNS makes the pinger time DNS queries for its host instead of sending echo
+// requests, asking the servers directly so that which one answers is known.
+func (p *Pinger) DNS(options DNSOptions) *Pinger {
+	p.dns = &options
+	return p
+}
+
+// ServerAddress adds the DNS port to a server given without one.
+func ServerAddress(server string) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server, nil
+	}
+
+	if net.ParseIP(strings.Trim(server, "[]")) == nil {
+		return "", fmt.Errorf("invalid DNS server %q, expected an address such as 8.8.8.8 or 8.8.8.8:53", server)
+	}
+
+	return net.JoinHostPort(strings.Trim(server, "[]"), DNS_PORT), nil
+}
+
+// SystemServers reads the nameservers the system resolver uses, for when none
+// are given.
+func SystemServers() ([]string, error) {
+	file, err := os.Open(RESOLV_CONF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the system's DNS servers, give one with --server: %s", err)
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			if server, err := ServerAddress(fields[1]); err == nil {
+				servers = append(servers, server)
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s, give one with --server", RESOLV_CONF)
+	}
+
+	return servers, nil
+}
+
+func (p *Pinger) runDNS(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	record, ok := DNS_RECORDS[strings.ToUpper(p.dns.Record)]
+	if !ok {
+		return fmt.Errorf("unknown DNS record type %q", p.dns.Record)
+	}
+	name, err := dnsmessage.NewName(dnsName(p.host))
+	if err != nil {
+		return fmt.Errorf("invalid DNS name %q: %s", p.host, err)
+	}
+
+	ticker := p.pace(ctx)
+	defer ticker.Stop()
+	defer p.probes.Wait()
+
+	seq := 0
+	for {
+		probe := seq + 1
+		server := p.dns.Servers[seq%len(p.dns.Servers)]
+		if p.probes.Launch(func() {
+			result := p.query(ctx, server, name, record)
+			beat()
+			if ctx.Err() != nil {
+				return
+			}
+			result.Epoch = epoch
+			result.Seq = probe
+			result.Server = server
+			p.deliver(pings, result)
+		}) {
+			seq = probe
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+
+	return host + "."
+}
+
+// query sends one question over UDP and waits for the answer to it, ignoring
+// stray packets. A truncated answer still counts, since it was an answer.
+func (p *Pinger) query(ctx context.Context, server string, name dnsmessage.Name, record dnsmessage.Type) Result {
+	id := uint16(rand.Intn(1 << 16))
+	message := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: record, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := message.Pack()
+	if err != nil {
+		return Result{Lost: true, Reason: LOSS_ERROR, Error: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.probeTimeout())
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return Result{Lost: true, Reason: LOSS_ERROR, Error: err.Error()}
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(packet); err != nil {
+		return Result{Lost: true, Reason: dnsLoss(err), Error: err.Error()}
+	}
+
+	buffer := make([]byte, DNS_BUFFER_SIZE)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return Result{Lost: true, Reason: dnsLoss(err), Error: err.Error()}
+		}
+
+		var parser dnsmessage.Parser
+		header, err := parser.Start(buffer[:n])
+		if err != nil || !header.Response || header.ID != id {
+			continue
+		}
+
+		result := Result{Duration: time.Since(start), Rcode: rcodeName(header.RCode)}
+		if header.RCode != dnsmessage.RCodeSuccess {
+			result.Lost = true
+			result.Reason = LOSS_RCODE
+			result.Error = rcodeName(header.RCode)
+		}
+
+		return result
+	}
+}
+
+// rcodeName drops the RCode prefix dnsmessage gives, for the names in the
+// RFCs, such as NXDOMAIN.
+func rcodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return rcode.String()
+	}
+}
+
+func dnsLoss(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return LOSS_TIMEOUT
+	}
+
+	return LOSS_ERROR
+}
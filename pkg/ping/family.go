@@ -0,0 +1,136 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+)
+
+const (
+	IPV4 = "ipv4"
+	IPV6 = "ipv6"
+)
+
+// FamilyError is a host that resolves, but not in the family asked for.
+type FamilyError struct {
+	Host   string
+	Has    string
+	Wanted string
+	// Address is set when the host was an address rather than a name.
+	Address bool
+}
+
+func (e *FamilyError) Error() string {
+	if e.Address {
+		return fmt.Sprintf("%s is an %s address, so can't be probed with --%s", e.Host, e.Has, e.Wanted)
+	}
+
+	return fmt.Sprintf("%s only has %s addresses, so can't be probed with --%s", e.Host, e.Has, e.Wanted)
+}
+
+// Family makes the pinger probe over one address family, IPV4 or IPV6, or
+// over whichever the host resolves to when it's empty.
+func (p *Pinger) Family(family string) *Pinger {
+	p.family = family
+	return p
+}
+
+// FamilyOf names the family of an address as the header shows it.
+func FamilyOf(addr netip.Addr) string {
+	if addr.Unmap().Is4() {
+		return "IPv4"
+	}
+
+	return "IPv6"
+}
+
+// Resolve finds the address host is probed at in family, preferring IPv4
+// when either will do, as the system ping does. An address is taken as
+// given, keeping any zone on it that a lookup would drop.
+func Resolve(ctx context.Context, host string, family string) (netip.Addr, error) {
+	return ResolveWith(ctx, net.DefaultResolver, host, family)
+}
+
+// ResolveWith is Resolve looking names up with resolver.
+func ResolveWith(ctx context.Context, resolver Resolver, host string, family string) (netip.Addr, error) {
+	addrs, err := ResolveAllWith(ctx, resolver, host, family)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addrs[0], nil
+}
+
+// ResolveAll is every address host has in family, in the order Resolve
+// prefers them: IPv4 first when either will do, and otherwise as the
+// resolver gave them.
+func ResolveAll(ctx context.Context, host string, family string) ([]netip.Addr, error) {
+	return ResolveAllWith(ctx, net.DefaultResolver, host, family)
+}
+
+// ResolveAllWith is ResolveAll looking names up with resolver.
+func ResolveAllWith(ctx context.Context, resolver Resolver, host string, family string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.Unmap()
+		if !inFamily(addr, family) {
+			return nil, &FamilyError{Host: host, Has: FamilyOf(addr), Wanted: family, Address: true}
+		}
+		return []netip.Addr{addr}, nil
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %s", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("failed to resolve %s: no addresses", host)
+	}
+
+	var found []netip.Addr
+	for _, preferred := range []string{IPV4, IPV6} {
+		for _, addr := range addrs {
+			if addr = addr.Unmap(); inFamily(addr, preferred) && inFamily(addr, family) && !slices.Contains(found, addr) {
+				found = append(found, addr)
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil, &FamilyError{Host: host, Has: FamilyOf(addrs[0]), Wanted: family}
+	}
+
+	return found, nil
+}
+
+func inFamily(addr netip.Addr, family string) bool {
+	switch family {
+	case IPV4:
+		return addr.Is4()
+	case IPV6:
+		return addr.Is6()
+	default:
+		return true
+	}
+}
+
+// familyArgs asks the system ping for the family wanted, or for IPv6 when
+// host is an IPv6 address, zone and all, rather than leaving it to work out
+// what fe80::1%eth0 is. macOS has a separate ping6 instead, and its ping
+// only does IPv4.
+func familyArgs(host string, family string, goos string) []string {
+	if addr, err := netip.ParseAddr(host); err == nil && family == "" && addr.Is6() && !addr.Is4In6() {
+		family = IPV6
+	}
+
+	switch {
+	case goos == "darwin" && family == IPV6:
+		return []string{"ping6"}
+	case goos == "darwin" || family == "":
+		return []string{"ping"}
+	case family == IPV6:
+		return []string{"ping", "-6"}
+	default:
+		return []string{"ping", "-4"}
+	}
+}
@@ -0,0 +1,54 @@
+package ping
+
+import "fmt"
+
+// INITIAL_TTLS are the starting TTLs used by common network stacks.
+var INITIAL_TTLS = []int{32, 64, 128, 255}
+
+// MAX_PLAUSIBLE_HOPS bounds which initial TTLs are considered for a reply;
+// real paths are rarely longer.
+const MAX_PLAUSIBLE_HOPS = 40
+
+type HopEstimate struct {
+	Min int
+	Max int
+}
+
+// EstimateHops works out how far away the sender of a reply is from the TTL
+// it arrived with. When more than one initial TTL gives a plausible distance
+// the estimate is a range.
+func EstimateHops(ttl int) (HopEstimate, bool) {
+	if ttl <= 0 {
+		return HopEstimate{}, false
+	}
+
+	estimate := HopEstimate{Min: -1}
+	for _, initial := range INITIAL_TTLS {
+		hops := initial - ttl
+		if hops < 0 {
+			continue
+		}
+
+		if estimate.Min < 0 {
+			estimate = HopEstimate{Min: hops, Max: hops}
+			continue
+		}
+		if hops <= MAX_PLAUSIBLE_HOPS {
+			estimate.Max = hops
+		}
+	}
+
+	return estimate, estimate.Min >= 0
+}
+
+func (h HopEstimate) Range() string {
+	if h.Min == h.Max {
+		return fmt.Sprintf("%d", h.Min)
+	}
+
+	return fmt.Sprintf("%d–%d", h.Min, h.Max)
+}
+
+func (h HopEstimate) String() string {
+	return "≈ " + h.Range() + " hops away"
+}
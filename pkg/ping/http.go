@@ -0,0 +1,170 @@
+package ping
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"time"
+)
+
+const (
+	LOSS_STATUS = "status"
+	LOSS_ERROR  = "error"
+
+	// HTTP_DRAIN_LIMIT is as much of a body as is read to let the connection
+	// be reused, past which it's closed instead.
+	HTTP_DRAIN_LIMIT = 1 << 20
+)
+
+type HTTPOptions struct {
+	URL string
+	// KeepAlive reuses connections between requests, so that only the first
+	// pays for DNS, the handshake and TLS.
+	KeepAlive       bool
+	FollowRedirects bool
+}
+
+// HTTP makes the pinger GET a URL instead of sending echo requests, timing
+// each to its first response byte.
+func (p *Pinger) HTTP(options HTTPOptions) *Pinger {
+	p.http = &options
+	return p
+}
+
+func (p *Pinger) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = !p.http.KeepAlive
+
+	client := &http.Client{Transport: transport, Timeout: p.probeTimeout()}
+	if !p.http.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+
+	return client
+}
+
+// runHTTP requests the URL once per interval. Responses other than 2xx and
+// failed requests are lost probes, with the status or error in Reason, and
+// never stop the backend.
+func (p *Pinger) runHTTP(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	client := p.httpClient()
+	defer client.CloseIdleConnections()
+
+	ticker := p.pace(ctx)
+	defer ticker.Stop()
+	defer p.probes.Wait()
+
+	seq := 0
+	for {
+		probe := seq + 1
+		if p.probes.Launch(func() {
+			result := p.request(ctx, client)
+			beat()
+			if ctx.Err() != nil {
+				return
+			}
+			result.Epoch = epoch
+			result.Seq = probe
+			p.deliver(pings, result)
+		}) {
+			seq = probe
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// httpTimes are when each step of a request happened, as httptrace reports
+// them. Steps a reused connection skips stay zero.
+type httpTimes struct {
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn, wroteRequest     time.Time
+	firstByte                 time.Time
+}
+
+func (t *httpTimes) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { t.connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { t.connectDone = time.Now() },
+		TLSHandshakeStart:    func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.tlsDone = time.Now() },
+		GotConn:              func(httptrace.GotConnInfo) { t.gotConn = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { t.firstByte = time.Now() },
+	}
+}
+
+func between(start time.Time, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+
+	return end.Sub(start)
+}
+
+func (t *httpTimes) phases() []Phase {
+	return []Phase{
+		{Name: "dns", Duration: between(t.dnsStart, t.dnsDone)},
+		{Name: "connect", Duration: between(t.connectStart, t.connectDone)},
+		{Name: "tls", Duration: between(t.tlsStart, t.tlsDone)},
+		{Name: "send", Duration: between(t.gotConn, t.wroteRequest)},
+		{Name: "wait", Duration: between(t.wroteRequest, t.firstByte)},
+	}
+}
+
+func (p *Pinger) request(ctx context.Context, client *http.Client) Result {
+	var times httpTimes
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, times.trace()), http.MethodGet, p.http.URL, nil)
+	if err != nil {
+		return Result{Lost: true, Reason: LOSS_ERROR, Error: err.Error()}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Lost: true, Reason: httpLoss(err), Error: err.Error()}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, HTTP_DRAIN_LIMIT))
+	resp.Body.Close()
+
+	result := Result{Duration: between(start, times.firstByte), Phases: times.phases(), Status: resp.StatusCode}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Lost = true
+		result.Reason = LOSS_STATUS
+		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+
+	return result
+}
+
+// httpLoss tells a request that timed out, which is left to the loss
+// tracker like any other unanswered probe, from one that failed outright.
+func httpLoss(err error) string {
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return LOSS_TIMEOUT
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return LOSS_TIMEOUT
+	}
+
+	if reason := tcpLoss(err); reason != LOSS_TIMEOUT {
+		return reason
+	}
+
+	return LOSS_ERROR
+}
@@ -0,0 +1,252 @@
+package ping
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	ICMP_ECHO_REPLY         = 0
+	ICMP_DEST_UNREACHABLE   = 3
+	ICMP_ECHO_REQUEST       = 8
+	ICMP_TIME_EXCEEDED      = 11
+	ICMPV6_DEST_UNREACHABLE = 1
+	ICMPV6_PACKET_TOO_BIG   = 2
+	ICMPV6_TIME_EXCEEDED    = 3
+	ICMPV6_ECHO_REQUEST     = 128
+	ICMPV6_ECHO_REPLY       = 129
+
+	// ICMP_FRAG_NEEDED is the destination unreachable code for a packet too
+	// big for the next hop with don't-fragment set.
+	ICMP_FRAG_NEEDED = 4
+
+	ICMP_HEADER_LEN = 8
+	IPV4_HEADER_LEN = 20
+	IPV6_HEADER_LEN = 40
+)
+
+type ICMPKind int
+
+const (
+	// ICMP_OTHER is anything that's neither an echo reply nor an error
+	// quoting an echo request to the target, such as redirects, requests and
+	// errors about other traffic.
+	ICMP_OTHER ICMPKind = iota
+	ICMP_REPLY
+	ICMP_ERROR
+	ICMP_MALFORMED
+)
+
+// ICMPPacket is what the native backend makes of a packet its socket read:
+// an echo reply, or the echo request an error quotes.
+type ICMPPacket struct {
+	Kind ICMPKind
+	ID   int
+	Seq  int
+	// Data is the reply's payload, or as much of the request's as the error
+	// quotes, which may be none of it.
+	Data []byte
+	// MTU is set for an error saying the request was too big for the path,
+	// to what the router said would fit, which may be zero.
+	TooBig bool
+	MTU    int
+}
+
+// ParseICMP reads a packet as the socket hands it over, without the IP
+// header in front. Only the first byte is looked at for the types the
+// backend has no use for, and anything short or inconsistent is malformed
+// rather than read past its end.
+func ParseICMP(packet []byte, v6 bool, target netip.Addr) ICMPPacket {
+	if len(packet) < ICMP_HEADER_LEN {
+		return ICMPPacket{Kind: ICMP_MALFORMED}
+	}
+
+	reply, unreachable, exceeded, tooBig := byte(ICMP_ECHO_REPLY), byte(ICMP_DEST_UNREACHABLE), byte(ICMP_TIME_EXCEEDED), byte(ICMP_DEST_UNREACHABLE)
+	if v6 {
+		reply, unreachable, exceeded, tooBig = ICMPV6_ECHO_REPLY, ICMPV6_DEST_UNREACHABLE, ICMPV6_TIME_EXCEEDED, ICMPV6_PACKET_TOO_BIG
+	}
+
+	switch packet[0] {
+	case reply:
+	case unreachable, exceeded, tooBig:
+	default:
+		return ICMPPacket{Kind: ICMP_OTHER}
+	}
+
+	// The kernel checks ICMPv6 checksums, which cover an IPv6 pseudo-header,
+	// but not ICMP ones on a raw socket.
+	if !v6 && checksum(packet) != 0 {
+		return ICMPPacket{Kind: ICMP_MALFORMED}
+	}
+
+	if packet[0] == reply {
+		if packet[1] != 0 {
+			return ICMPPacket{Kind: ICMP_MALFORMED}
+		}
+		return ICMPPacket{Kind: ICMP_REPLY, ID: int(binary.BigEndian.Uint16(packet[4:])), Seq: int(binary.BigEndian.Uint16(packet[6:])), Data: packet[ICMP_HEADER_LEN:]}
+	}
+
+	quoted, ok := quotedEcho(packet[ICMP_HEADER_LEN:], v6, target)
+	if !ok {
+		return ICMPPacket{Kind: ICMP_OTHER}
+	}
+	quoted.Kind = ICMP_ERROR
+	// The MTU follows the code and checksum, in the low half of the unused
+	// word for IPv4 and as all of it for IPv6.
+	switch {
+	case packet[0] == tooBig && v6:
+		quoted.TooBig, quoted.MTU = true, int(binary.BigEndian.Uint32(packet[4:]))
+	case packet[0] == tooBig && packet[1] == ICMP_FRAG_NEEDED:
+		quoted.TooBig, quoted.MTU = true, int(binary.BigEndian.Uint16(packet[6:]))
+	}
+	return quoted
+}
+
+// quotedEcho reads the echo request to target an ICMP error quotes, after
+// the original IP header. Errors about any other traffic aren't ours.
+func quotedEcho(data []byte, v6 bool, target netip.Addr) (ICMPPacket, bool) {
+	var header int
+	var dst netip.Addr
+	var request byte
+	if v6 {
+		if len(data) < IPV6_HEADER_LEN || data[0]>>4 != 6 || data[6] != ICMPV6_PROTOCOL {
+			return ICMPPacket{}, false
+		}
+		header, request = IPV6_HEADER_LEN, ICMPV6_ECHO_REQUEST
+		dst = netip.AddrFrom16([16]byte(data[24:40]))
+	} else {
+		if len(data) < IPV4_HEADER_LEN || data[0]>>4 != 4 || data[9] != ICMP_PROTOCOL {
+			return ICMPPacket{}, false
+		}
+		header, request = int(data[0]&0x0f)*4, ICMP_ECHO_REQUEST
+		dst = netip.AddrFrom4([4]byte(data[16:20]))
+	}
+
+	if header < IPV4_HEADER_LEN || len(data) < header+ICMP_HEADER_LEN || dst != target.WithZone("").Unmap() {
+		return ICMPPacket{}, false
+	}
+
+	echo := data[header:]
+	if echo[0] != request || echo[1] != 0 {
+		return ICMPPacket{}, false
+	}
+
+	return ICMPPacket{ID: int(binary.BigEndian.Uint16(echo[4:])), Seq: int(binary.BigEndian.Uint16(echo[6:])), Data: echo[ICMP_HEADER_LEN:]}, true
+}
+
+// checksum is the internet checksum over data, which comes to zero over a
+// packet carrying the right one.
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	return ^uint16(sum)
+}
+
+// Matcher hands the packets the native backend reads to the probes they
+// answer. A raw socket sees every process's echo traffic, so there the
+// identifier the requests went out with has to match before the payload is
+// looked at; a datagram socket's kernel picks the identifier itself and
+// only passes on what's meant for it.
+type Matcher struct {
+	token  Token
+	target netip.Addr
+	v6     bool
+	id     int
+	raw    bool
+
+	mu      sync.Mutex
+	waiting map[int64]*nativeProbe
+}
+
+func NewMatcher(token Token, target netip.Addr, id int, raw bool) *Matcher {
+	return &Matcher{token: token, target: target, v6: target.Is6(), id: id, raw: raw, waiting: map[int64]*nativeProbe{}}
+}
+
+// Await registers the probe with the given sample index as sent now, for
+// the result it gets until Done.
+func (m *Matcher) Await(index int64, seq int) <-chan Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	probe := &nativeProbe{seq: seq, sent: time.Now(), reply: make(chan Result, 1)}
+	m.waiting[index] = probe
+	return probe.reply
+}
+
+func (m *Matcher) Done(index int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.waiting, index)
+}
+
+// Packet matches a packet read at the given time to the probe it answers,
+// reporting how it was classed. REPLY_OTHER is anything that isn't a reply
+// or an error about our probes at all.
+func (m *Matcher) Packet(packet []byte, ttl int, at time.Time) ReplyClass {
+	parsed := ParseICMP(packet, m.v6, m.target)
+	switch parsed.Kind {
+	case ICMP_MALFORMED:
+		return REPLY_MALFORMED
+	case ICMP_OTHER:
+		return REPLY_OTHER
+	}
+	if m.raw && parsed.ID != m.id {
+		return REPLY_OTHER
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if parsed.Kind == ICMP_REPLY {
+		index, class := ClassifyReply(parsed.Data, m.token, func(index int64) bool { return m.waiting[index] != nil })
+		if class == REPLY_OK {
+			probe := m.waiting[index]
+			answer(probe, Result{Seq: probe.seq, TTL: ttl, Duration: at.Sub(probe.sent), At: at})
+		}
+		return class
+	}
+
+	// An error quoting enough of the request is matched on its payload, as
+	// a reply is. Routers need only quote the ICMP header, which leaves the
+	// sequence number.
+	if len(parsed.Data) >= PAYLOAD_SIZE {
+		index, class := ClassifyReply(parsed.Data, m.token, func(index int64) bool { return m.waiting[index] != nil })
+		if class != REPLY_OK {
+			return REPLY_OTHER
+		}
+		answer(m.waiting[index], errorResult(parsed))
+		return REPLY_OK
+	}
+
+	class := REPLY_OTHER
+	for _, probe := range m.waiting {
+		if probe.seq == parsed.Seq {
+			answer(probe, errorResult(parsed))
+			class = REPLY_OK
+		}
+	}
+
+	return class
+}
+
+// errorResult is the loss an ICMP error about a probe makes it.
+func errorResult(parsed ICMPPacket) Result {
+	if parsed.TooBig {
+		return Result{Seq: parsed.Seq, Lost: true, Reason: LOSS_FRAGMENTATION, Error: fmt.Sprintf("too big for the path, mtu %d", parsed.MTU)}
+	}
+
+	return Result{Seq: parsed.Seq, Lost: true, Reason: LOSS_UNREACHABLE}
+}
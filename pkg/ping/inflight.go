@@ -0,0 +1,67 @@
+package ping
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InFlight caps how many probes may be outstanding at once. A tick that
+// finds the cap reached is skipped rather than queued, and counted so that
+// it isn't mistaken for loss.
+type InFlight struct {
+	max     int
+	active  atomic.Int64
+	skipped atomic.Int64
+	wg      sync.WaitGroup
+}
+
+func NewInFlight(max int) *InFlight {
+	return &InFlight{max: max}
+}
+
+// DefaultInFlight allows probes to overlap for as long as each may wait for
+// its reply.
+func DefaultInFlight(timeout time.Duration, interval time.Duration) int {
+	if interval <= 0 {
+		return 1
+	}
+
+	return max(1, int((timeout+interval-1)/interval))
+}
+
+// Launch runs probe in its own goroutine unless the cap is reached, and
+// reports whether it did.
+func (f *InFlight) Launch(probe func()) bool {
+	if f.active.Load() >= int64(f.max) {
+		f.skipped.Add(1)
+		return false
+	}
+
+	f.active.Add(1)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer f.active.Add(-1)
+		probe()
+	}()
+
+	return true
+}
+
+func (f *InFlight) Max() int {
+	return f.max
+}
+
+func (f *InFlight) Active() int {
+	return int(f.active.Load())
+}
+
+func (f *InFlight) Skipped() int64 {
+	return f.skipped.Load()
+}
+
+// Wait blocks until every launched probe has returned.
+func (f *InFlight) Wait() {
+	f.wg.Wait()
+}
@@ -0,0 +1,53 @@
+package ping
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestInFlight launches probes at a hung target, which never answer
+// until cancelled, checking that ticks past the cap are skipped rather than
+// piling up and that every probe goroutine is gone afterwards.
+func TestInFlight(t *testing.T) {
+	if limit := DefaultInFlight(5*time.Second, time.Second); limit != 5 {
+		t.Fatalf("default cap for a 5s timeout at 1s: expected 5, got %v", limit)
+	}
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	probes := NewInFlight(3)
+
+	launched := 0
+	for tick := 0; tick < 20; tick++ {
+		if probes.Launch(func() { <-ctx.Done() }) {
+			launched++
+		}
+	}
+
+	if launched != 3 || probes.Active() != 3 || probes.Skipped() != 17 {
+		cancel()
+		probes.Wait()
+		t.Fatalf("launched, in flight and skipped after 20 ticks: expected 3, 3, 17, got %d, %d, %d", launched, probes.Active(), probes.Skipped())
+	}
+
+	cancel()
+	probes.Wait()
+	if probes.Active() != 0 {
+		t.Fatalf("in flight once the target is given up on: expected 0, got %v", probes.Active())
+	}
+
+	if !probes.Launch(func() {}) {
+		t.Fatalf("probe launched once there is room again: expected launched, got skipped")
+	}
+	probes.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("goroutines left behind: expected %v, got %v", before, after)
+	}
+}
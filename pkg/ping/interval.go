@@ -0,0 +1,40 @@
+package ping
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// MIN_INTERVAL is the shortest interval probed at all. The native backend,
+// and tcp, udp, http and dns probing, manage anything down to it.
+const MIN_INTERVAL = 2 * time.Millisecond
+
+// EXEC_MIN_INTERVALS are the shortest intervals the system ping allows
+// anyone but root, below which it refuses to start.
+var EXEC_MIN_INTERVALS = map[string]time.Duration{
+	"linux":  200 * time.Millisecond,
+	"darwin": 100 * time.Millisecond,
+}
+
+// CheckInterval reports an interval the pinger's backend can't probe at, up
+// front, rather than leaving the system ping to fail on it once started.
+func (p *Pinger) CheckInterval() error {
+	return CheckInterval(p.interval, p.Backend(), runtime.GOOS, os.Geteuid() == 0)
+}
+
+func CheckInterval(interval time.Duration, backend string, goos string, root bool) error {
+	if interval < MIN_INTERVAL {
+		return fmt.Errorf("--interval %s is under the %s minimum", interval, MIN_INTERVAL)
+	}
+
+	if backend != "exec" && backend != "exec-once" || root {
+		return nil
+	}
+	if least, ok := EXEC_MIN_INTERVALS[goos]; ok && interval < least {
+		return fmt.Errorf("--interval %s is under the %s the system ping allows anyone but root; use --native for intervals down to %s, or run as root", interval, least, MIN_INTERVAL)
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	ICMP_PROTOCOL   = 1
+	ICMPV6_PROTOCOL = 58
+	MAX_PACKET_SIZE = 1500
+)
+
+// Native makes the pinger start with the native backend, which sends echo
+// requests itself, rather than running the system ping.
+func (p *Pinger) Native(enabled bool) *Pinger {
+	p.native = enabled
+	return p
+}
+
+// Ignored tallies the replies the native backend kept out of the results.
+func (p *Pinger) Ignored() ReplyCounts {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.ignored
+}
+
+type nativeProbe struct {
+	seq   int
+	sent  time.Time
+	reply chan Result
+}
+
+// icmpConn wraps an ICMP socket, which is either an unprivileged datagram
+// "ping" socket or a raw one.
+type icmpConn struct {
+	conn *icmp.PacketConn
+	dst  net.Addr
+	v6   bool
+	raw  bool
+}
+
+// listenICMP tries an unprivileged datagram socket first, as the system ping
+// does where it's allowed, and falls back to a raw socket. The socket is
+// bound to local, when it's given, so that probes leave from it.
+func listenICMP(addr netip.Addr, local netip.Addr) (*icmpConn, error) {
+	zone, err := ZoneIndex(addr.Zone())
+	if err != nil {
+		return nil, err
+	}
+
+	networks := []string{"udp4", "ip4:icmp"}
+	listen := "0.0.0.0"
+	if addr.Is6() {
+		networks = []string{"udp6", "ip6:ipv6-icmp"}
+		listen = "::"
+	}
+	if local.IsValid() {
+		listen = local.Unmap().String()
+	}
+
+	for _, network := range networks {
+		var conn *icmp.PacketConn
+		conn, err = icmp.ListenPacket(network, listen)
+		if err != nil {
+			continue
+		}
+
+		c := &icmpConn{conn: conn, v6: addr.Is6(), raw: network[:3] != "udp"}
+		if c.raw {
+			c.dst = &net.IPAddr{IP: addr.AsSlice(), Zone: zone}
+		} else {
+			c.dst = &net.UDPAddr{IP: addr.AsSlice(), Zone: zone}
+		}
+
+		// TTLs are a nicety, so a socket that won't report them is kept.
+		if c.v6 {
+			conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+		} else {
+			conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+		}
+
+		return c, nil
+	}
+
+	return nil, permissionError(err, "")
+}
+
+func (c *icmpConn) send(seq int, payload []byte) error {
+	var kind icmp.Type = ipv4.ICMPTypeEcho
+	if c.v6 {
+		kind = ipv6.ICMPTypeEchoRequest
+	}
+
+	// Datagram sockets have the kernel pick the ID, so replies are matched
+	// on the payload rather than on it.
+	message := icmp.Message{Type: kind, Body: &icmp.Echo{ID: echoID(), Seq: seq, Data: payload}}
+	packet, err := message.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.WriteTo(packet, c.dst)
+	return err
+}
+
+// echoID is the identifier echo requests go out with on a raw socket.
+func echoID() int {
+	return os.Getpid() & 0xffff
+}
+
+func (c *icmpConn) read(buffer []byte) (int, int, error) {
+	if c.v6 {
+		n, cm, _, err := c.conn.IPv6PacketConn().ReadFrom(buffer)
+		if cm != nil {
+			return n, cm.HopLimit, err
+		}
+		return n, 0, err
+	}
+
+	n, cm, _, err := c.conn.IPv4PacketConn().ReadFrom(buffer)
+	if cm != nil {
+		return n, cm.TTL, err
+	}
+	return n, 0, err
+}
+
+// ZoneIndex is the interface index a zone names, as the socket wants it,
+// whether it was given as a name such as eth0 or as the index itself.
+func ZoneIndex(zone string) (string, error) {
+	if zone == "" {
+		return "", nil
+	}
+	if index, err := strconv.Atoi(zone); err == nil && index > 0 {
+		return zone, nil
+	}
+
+	iface, err := net.InterfaceByName(zone)
+	if err != nil {
+		return "", fmt.Errorf("failed to find interface %q named in the address's zone: %s", zone, err)
+	}
+
+	return strconv.Itoa(iface.Index), nil
+}
+
+// runNative sends echo requests over its own ICMP socket, matching replies to
+// probes by the token and index in their payload. A probe with no reply by
+// its timeout is reported lost, so that an outage still produces results.
+func (p *Pinger) runNative(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	addr, err := p.lookup(ctx)
+	if err != nil {
+		return err
+	}
+
+	local, err := p.localAddr(addr.Is6())
+	if err != nil {
+		return err
+	}
+	conn, err := listenICMP(addr, local)
+	if err != nil {
+		return err
+	}
+	defer p.probes.Wait()
+	defer conn.conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.conn.Close() })
+	defer stop()
+
+	token := NewToken()
+	matcher := NewMatcher(token, addr, echoID(), conn.raw)
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- p.readReplies(conn, matcher, beat)
+	}()
+
+	ticker := p.pace(ctx)
+	defer ticker.Stop()
+
+	var index int64
+	for {
+		next := index + 1
+		if p.probes.Launch(func() {
+			seq := int(next & 0xffff)
+			reply := matcher.Await(next, seq)
+			defer matcher.Done(next)
+			err := conn.send(seq, EncodePayload(token, next, p.PayloadSize()))
+
+			result := Result{Seq: seq, Lost: true, Reason: LOSS_TIMEOUT}
+			if tooBig(err) {
+				result = Result{Seq: seq, Lost: true, Reason: LOSS_FRAGMENTATION, Error: err.Error()}
+			}
+			if err == nil {
+				select {
+				case result = <-reply:
+				case <-time.After(p.probeTimeout()):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			beat()
+			result.Epoch = epoch
+			p.deliver(pings, result)
+		}) {
+			index = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return fmt.Errorf("failed to read ICMP reply: %s", err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// readReplies hands echo replies and the errors quoting our requests to the
+// probes they answer, and counts the replies that aren't ours.
+func (p *Pinger) readReplies(conn *icmpConn, matcher *Matcher, beat func()) error {
+	buffer := make([]byte, max(MAX_PACKET_SIZE, p.PayloadSize()+IPV4_HEADER_LEN+ICMP_HEADER_LEN))
+	for {
+		n, ttl, err := conn.read(buffer)
+		if err != nil {
+			return err
+		}
+
+		switch class := matcher.Packet(buffer[:n], ttl, time.Now()); class {
+		case REPLY_OK:
+			beat()
+		case REPLY_OTHER:
+		default:
+			p.mu.Lock()
+			p.ignored.Add(class)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// answer settles a probe with its first reply, dropping any duplicates.
+func answer(probe *nativeProbe, result Result) {
+	select {
+	case probe.reply <- result:
+	default:
+	}
+}
@@ -0,0 +1,171 @@
+package ping
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// icmpPacket is an ICMP message as the native backend's socket would read
+// it, with its checksum.
+func icmpPacket(kind icmp.Type, body icmp.MessageBody) []byte {
+	packet, _ := (&icmp.Message{Type: kind, Body: body}).Marshal(nil)
+	return packet
+}
+
+// quotedIP is the IP header an ICMP error quotes in front of the start of
+// the packet it's about.
+func quotedIP(proto byte, dst netip.Addr, packet []byte) []byte {
+	if dst.Is6() {
+		header := make([]byte, IPV6_HEADER_LEN)
+		header[0], header[6] = 0x60, proto
+		copy(header[24:], dst.AsSlice())
+		return append(header, packet...)
+	}
+
+	header := make([]byte, IPV4_HEADER_LEN)
+	header[0], header[9] = 0x45, proto
+	copy(header[16:], dst.AsSlice())
+	return append(header, packet...)
+}
+
+// fuzzSeeds are our reply and errors quoting our request, whole and as
+// routers cut them short, for each family.
+func fuzzSeeds(token Token) [][]byte {
+	var seeds [][]byte
+	for _, addr := range []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")} {
+		var reply, request, unreachable icmp.Type = ipv4.ICMPTypeEchoReply, ipv4.ICMPTypeEcho, ipv4.ICMPTypeDestinationUnreachable
+		proto := byte(ICMP_PROTOCOL)
+		if addr.Is6() {
+			reply, request, unreachable = ipv6.ICMPTypeEchoReply, ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeDestinationUnreachable
+			proto = ICMPV6_PROTOCOL
+		}
+
+		echo := &icmp.Echo{ID: 1234, Seq: 7, Data: EncodePayload(token, 7, DEFAULT_PAYLOAD_SIZE)}
+		seeds = append(seeds,
+			icmpPacket(reply, echo),
+			icmpPacket(unreachable, &icmp.DstUnreach{Data: quotedIP(proto, addr, icmpPacket(request, echo))}),
+			icmpPacket(unreachable, &icmp.DstUnreach{Data: quotedIP(proto, addr, icmpPacket(request, echo)[:8])}),
+		)
+	}
+
+	return seeds
+}
+
+// classify has a matcher for the family of addr, awaiting probe 7, take a
+// packet.
+func classify(token Token, addr netip.Addr, data []byte) ReplyClass {
+	matcher := NewMatcher(token, addr, 1234, true)
+	matcher.Await(7, 7)
+	defer matcher.Done(7)
+
+	return matcher.Packet(data, 64, time.Now())
+}
+
+// TestShortReplies cuts our reply short at every length, checking that
+// short of the token and index it's never taken for ours.
+func TestShortReplies(t *testing.T) {
+	token := NewToken()
+	for _, addr := range []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")} {
+		var reply icmp.Type = ipv4.ICMPTypeEchoReply
+		if addr.Is6() {
+			reply = ipv6.ICMPTypeEchoReply
+		}
+		ours := icmpPacket(reply, &icmp.Echo{ID: 1234, Seq: 7, Data: EncodePayload(token, 7, DEFAULT_PAYLOAD_SIZE)})
+
+		for n := range ICMP_HEADER_LEN + PAYLOAD_SIZE {
+			if class := classify(token, addr, ours[:n]); class == REPLY_OK {
+				t.Errorf("a %s reply cut to %d of its %d bytes, short of the token and index, isn't taken for ours: expected not ok, got %s", addr, n, len(ours), class)
+			}
+		}
+		if class := classify(token, addr, ours); class != REPLY_OK {
+			t.Errorf("a whole %s reply is ours: expected ok, got %s", addr, class)
+		}
+	}
+}
+
+// FuzzPacket has the native backend's matcher take whatever a raw socket
+// might read, for each family, checking it never panics.
+func FuzzPacket(f *testing.F) {
+	token := NewToken()
+	for _, seed := range fuzzSeeds(token) {
+		f.Add(seed)
+		f.Add(seed[:len(seed)/2])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		classify(token, netip.MustParseAddr("192.0.2.1"), data)
+		classify(token, netip.MustParseAddr("2001:db8::1"), data)
+	})
+}
+
+// TestICMPInjection sends the native backend's matcher the ICMP
+// traffic a raw socket sees besides our own, and checks none of it reaches
+// a probe, before our reply and an error quoting our request do.
+func TestICMPInjection(t *testing.T) {
+	addr, elsewhere := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("198.51.100.1")
+	token := NewToken()
+	matcher := NewMatcher(token, addr, 1234, true)
+	results := matcher.Await(7, 7)
+
+	ours := EncodePayload(token, 7, DEFAULT_PAYLOAD_SIZE)
+	request := func(id int, seq int, data []byte) []byte {
+		return icmpPacket(ipv4.ICMPTypeEcho, &icmp.Echo{ID: id, Seq: seq, Data: data})
+	}
+	unreachable := func(quoted []byte) []byte {
+		return icmpPacket(ipv4.ICMPTypeDestinationUnreachable, &icmp.DstUnreach{Data: quoted})
+	}
+	udp := make([]byte, 8)
+	corrupt := icmpPacket(ipv4.ICMPTypeEchoReply, &icmp.Echo{ID: 1234, Seq: 7, Data: ours})
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	cases := []struct {
+		name     string
+		packet   []byte
+		expected ReplyClass
+	}{
+		{"another process's reply", icmpPacket(ipv4.ICMPTypeEchoReply, &icmp.Echo{ID: 999, Seq: 7, Data: ours}), REPLY_OTHER},
+		{"an echo request to us", request(1234, 7, ours), REPLY_OTHER},
+		{"a redirect", icmpPacket(ipv4.ICMPTypeRedirect, &icmp.RawBody{Data: make([]byte, 32)}), REPLY_OTHER},
+		{"an unreachable about a UDP packet", unreachable(quotedIP(17, addr, udp)), REPLY_OTHER},
+		{"an unreachable about a request to another host", unreachable(quotedIP(ICMP_PROTOCOL, elsewhere, request(1234, 7, ours))), REPLY_OTHER},
+		{"a time exceeded about another process's request", icmpPacket(ipv4.ICMPTypeTimeExceeded, &icmp.TimeExceeded{Data: quotedIP(ICMP_PROTOCOL, addr, request(999, 7, nil))}), REPLY_OTHER},
+		{"an unreachable about another run's request", unreachable(quotedIP(ICMP_PROTOCOL, addr, request(1234, 7, EncodePayload(NewToken(), 7, DEFAULT_PAYLOAD_SIZE)))), REPLY_OTHER},
+		{"another run's reply", icmpPacket(ipv4.ICMPTypeEchoReply, &icmp.Echo{ID: 1234, Seq: 7, Data: EncodePayload(NewToken(), 7, DEFAULT_PAYLOAD_SIZE)}), REPLY_FOREIGN},
+		{"a reply to a probe not in flight", icmpPacket(ipv4.ICMPTypeEchoReply, &icmp.Echo{ID: 1234, Seq: 8, Data: EncodePayload(token, 8, DEFAULT_PAYLOAD_SIZE)}), REPLY_UNEXPECTED},
+		{"a reply with a bad checksum", corrupt, REPLY_MALFORMED},
+		{"garbage", []byte{0, 0, 1}, REPLY_MALFORMED},
+	}
+	for _, c := range cases {
+		if class := matcher.Packet(c.packet, 64, time.Now()); class != c.expected {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.expected, class)
+		}
+		select {
+		case result := <-results:
+			t.Fatalf("%s doesn't reach the probe: expected no result, got %+v", c.name, result)
+		default:
+		}
+	}
+
+	sent := time.Now()
+	if class := matcher.Packet(icmpPacket(ipv4.ICMPTypeEchoReply, &icmp.Echo{ID: 1234, Seq: 7, Data: ours}), 57, sent.Add(20*time.Millisecond)); class != REPLY_OK {
+		t.Fatalf("our reply is taken after all that: expected ok, got %q", class.String())
+	}
+	if result := <-results; result.Lost || result.TTL != 57 || result.Duration < 20*time.Millisecond {
+		t.Fatalf("our reply reaches the probe: expected a reply with a TTL of 57 after 20ms or more, got %+v", result)
+	}
+
+	// Routers need only quote the header of the request, which leaves its
+	// identifier and sequence number to go by.
+	results = matcher.Await(8, 8)
+	if class := matcher.Packet(unreachable(quotedIP(ICMP_PROTOCOL, addr, request(1234, 8, nil))), 57, time.Now()); class != REPLY_OK {
+		t.Fatalf("an unreachable quoting our request's header is ours: expected ok, got %q", class.String())
+	}
+	if result := <-results; !result.Lost || result.Reason != LOSS_UNREACHABLE || result.Seq != 8 {
+		t.Fatalf("an unreachable quoting our request settles it as unreachable: expected seq 8 lost as unreachable, got %+v", result)
+	}
+}
@@ -0,0 +1,107 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errRepaced is how a backend that can't change rate as it runs stops for
+// SetInterval, so that it's started again at the new one rather than failed.
+var errRepaced = errors.New("probe interval changed")
+
+// Burst lets SetInterval go as fast as interval, sizing the in-flight cap
+// for it so that an outage's unanswered probes don't hold faster ones back.
+func (p *Pinger) Burst(interval time.Duration) *Pinger {
+	p.probes = NewInFlight(DefaultInFlight(p.probeTimeout(), min(interval, p.interval)))
+	return p
+}
+
+// SetInterval changes how often probes are sent, leaving how long each may
+// wait for a reply as it was. The system ping is given its rate when it
+// starts, so it's restarted at the new one, and SetInterval reports whether
+// that's about to happen.
+func (p *Pinger) SetInterval(interval time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if interval <= 0 || interval == p.rate {
+		return false
+	}
+
+	p.rate = interval
+	close(p.paced)
+	p.paced = make(chan struct{})
+
+	return p.running == "exec"
+}
+
+// Interval is how often probes are being sent.
+func (p *Pinger) Interval() time.Duration {
+	interval, _ := p.pacing()
+	return interval
+}
+
+// pacing returns the current interval and a channel closed when it changes.
+func (p *Pinger) pacing() (time.Duration, chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.rate, p.paced
+}
+
+func (p *Pinger) setRunning(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running = name
+}
+
+// pacer ticks at the pinger's current interval. When the interval shortens
+// it ticks straight away, rather than waiting out the slower tick, since
+// that's when the extra resolution is wanted.
+type pacer struct {
+	C    chan time.Time
+	stop context.CancelFunc
+}
+
+func (p *Pinger) pace(ctx context.Context) *pacer {
+	ctx, stop := context.WithCancel(ctx)
+	t := &pacer{C: make(chan time.Time, 1), stop: stop}
+
+	go func() {
+		interval, changed := p.pacing()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				t.tick(now)
+			case <-changed:
+				previous := interval
+				interval, changed = p.pacing()
+				ticker.Reset(interval)
+				if interval < previous {
+					t.tick(time.Now())
+				}
+			}
+		}
+	}()
+
+	return t
+}
+
+// tick drops ticks the backend isn't ready for, as a time.Ticker does.
+func (t *pacer) tick(now time.Time) {
+	select {
+	case t.C <- now:
+	default:
+	}
+}
+
+func (t *pacer) Stop() {
+	t.stop()
+}
@@ -0,0 +1,73 @@
+package ping
+
+import "context"
+
+// Pause stops probing until Resume. The backend is stopped rather than left
+// running, so that nothing at all is sent while paused.
+func (p *Pinger) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return
+	}
+
+	p.paused = true
+	p.resumed = make(chan struct{})
+	if p.stopRun != nil {
+		p.stopRun()
+	}
+}
+
+func (p *Pinger) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return
+	}
+
+	p.paused = false
+	close(p.resumed)
+}
+
+func (p *Pinger) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+// waitResumed blocks while the pinger is paused, and reports whether it may
+// go on, which it may not once ctx is done.
+func (p *Pinger) waitResumed(ctx context.Context) bool {
+	p.mu.Lock()
+	resumed := p.resumed
+	paused := p.paused
+	p.mu.Unlock()
+
+	if !paused {
+		return ctx.Err() == nil
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// runContext is the context a backend runs under, which Pause cancels.
+func (p *Pinger) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	p.stopRun = cancel
+	if p.paused {
+		cancel()
+	}
+
+	return ctx, cancel
+}
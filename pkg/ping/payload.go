@@ -0,0 +1,112 @@
+package ping
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+)
+
+const (
+	TOKEN_SIZE   = 8
+	PAYLOAD_SIZE = TOKEN_SIZE + 8
+)
+
+// Token identifies this run's probes, so that replies meant for another
+// sender behind the same NAT, or spoofed and reflected ones, can be told
+// apart from our own.
+type Token [TOKEN_SIZE]byte
+
+func NewToken() Token {
+	var token Token
+	rand.Read(token[:])
+	return token
+}
+
+type ReplyClass int
+
+const (
+	REPLY_OK ReplyClass = iota
+	REPLY_FOREIGN
+	REPLY_UNEXPECTED
+	REPLY_MALFORMED
+	REPLY_LATE
+	REPLY_DUPLICATE
+	REPLY_OTHER
+)
+
+func (c ReplyClass) String() string {
+	switch c {
+	case REPLY_OK:
+		return "ok"
+	case REPLY_FOREIGN:
+		return "foreign"
+	case REPLY_UNEXPECTED:
+		return "unexpected"
+	case REPLY_LATE:
+		return "late"
+	case REPLY_DUPLICATE:
+		return "duplicate"
+	case REPLY_OTHER:
+		return "other"
+	default:
+		return "malformed"
+	}
+}
+
+// EncodePayload builds an echo payload carrying the token and the global
+// sample index, padded to size.
+func EncodePayload(token Token, index int64, size int) []byte {
+	payload := make([]byte, max(size, PAYLOAD_SIZE))
+	copy(payload, token[:])
+	binary.BigEndian.PutUint64(payload[TOKEN_SIZE:], uint64(index))
+	return payload
+}
+
+// ClassifyReply checks an echo reply's payload against the token and the
+// probes still awaiting a reply. Only REPLY_OK replies should reach the
+// latency stats; the rest are counted separately.
+func ClassifyReply(payload []byte, token Token, inFlight func(index int64) bool) (int64, ReplyClass) {
+	if len(payload) < PAYLOAD_SIZE {
+		return 0, REPLY_MALFORMED
+	}
+
+	if !bytes.Equal(payload[:TOKEN_SIZE], token[:]) {
+		return 0, REPLY_FOREIGN
+	}
+
+	index := int64(binary.BigEndian.Uint64(payload[TOKEN_SIZE:PAYLOAD_SIZE]))
+	if !inFlight(index) {
+		return index, REPLY_UNEXPECTED
+	}
+
+	return index, REPLY_OK
+}
+
+// ReplyCounts tallies the replies kept out of the latency stats. Only the
+// udp backend tells late and duplicated replies from other unexpected ones.
+type ReplyCounts struct {
+	Foreign    int64
+	Unexpected int64
+	Malformed  int64
+	Late       int64
+	Duplicate  int64
+}
+
+func (c *ReplyCounts) Add(class ReplyClass) {
+	switch class {
+	case REPLY_FOREIGN:
+		c.Foreign++
+	case REPLY_UNEXPECTED:
+		c.Unexpected++
+	case REPLY_MALFORMED:
+		c.Malformed++
+	case REPLY_LATE:
+		c.Late++
+	case REPLY_DUPLICATE:
+		c.Duplicate++
+	}
+}
+
+func (c ReplyCounts) Total() int64 {
+	return c.Foreign + c.Unexpected + c.Malformed + c.Late + c.Duplicate
+}
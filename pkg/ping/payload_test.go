@@ -0,0 +1,30 @@
+package ping
+
+import (
+	"testing"
+)
+
+// TestPayload crafts replies from another run, for a probe that isn't
+// outstanding and with a truncated payload, and checks none pass as ours.
+func TestPayload(t *testing.T) {
+	token := NewToken()
+	other := NewToken()
+	inFlight := func(index int64) bool { return index == 7 }
+
+	cases := []struct {
+		name     string
+		payload  []byte
+		expected ReplyClass
+	}{
+		{"our reply", EncodePayload(token, 7, 56), REPLY_OK},
+		{"another run's reply", EncodePayload(other, 7, 56), REPLY_FOREIGN},
+		{"reply to a probe not in flight", EncodePayload(token, 8, 56), REPLY_UNEXPECTED},
+		{"truncated reply", EncodePayload(token, 7, 56)[:10], REPLY_MALFORMED},
+	}
+
+	for _, c := range cases {
+		if _, class := ClassifyReply(c.payload, token, inFlight); class != c.expected {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.expected, class)
+		}
+	}
+}
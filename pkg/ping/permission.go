@@ -0,0 +1,88 @@
+package ping
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// PermissionError is returned when the prober isn't allowed to open an ICMP
+// socket, and carries a platform-specific explanation of how to fix it.
+type PermissionError struct {
+	Errno  syscall.Errno
+	Detail string
+	Hint   string
+}
+
+func (e *PermissionError) Error() string {
+	return e.Detail + "\n" + e.Hint
+}
+
+func (e *PermissionError) Unwrap() error {
+	return e.Errno
+}
+
+var PERMISSION_MESSAGES = map[string]syscall.Errno{
+	"operation not permitted": syscall.EPERM,
+	"permission denied":       syscall.EACCES,
+}
+
+// permissionError recognises a permission failure either from the errno of a
+// socket call or from the message ping printed before exiting.
+func permissionError(err error, stderr string) error {
+	var errno syscall.Errno
+	if errors.As(err, &errno) && (errno == syscall.EPERM || errno == syscall.EACCES) {
+		return &PermissionError{Errno: errno, Detail: err.Error(), Hint: PermissionHint(runtime.GOOS, errno)}
+	}
+
+	lower := strings.ToLower(stderr)
+	for message, errno := range PERMISSION_MESSAGES {
+		if strings.Contains(lower, message) {
+			return &PermissionError{Errno: errno, Detail: strings.TrimSpace(stderr), Hint: PermissionHint(runtime.GOOS, errno)}
+		}
+	}
+
+	return err
+}
+
+func PermissionHint(goos string, errno syscall.Errno) string {
+	switch goos {
+	case "linux":
+		if errno == syscall.EACCES {
+			return "Unprivileged ICMP sockets are disabled for your group. Allow them with: sudo sysctl -w net.ipv4.ping_group_range=\"0 2147483647\""
+		}
+		return "ping needs raw socket access. Grant it with: sudo setcap cap_net_raw+ep $(command -v ping), or allow unprivileged ICMP with: sudo sysctl -w net.ipv4.ping_group_range=\"0 2147483647\""
+	case "darwin", "freebsd", "openbsd":
+		return "ping normally runs setuid root. Check its permissions with: ls -l $(command -v ping), or run network-test with sudo"
+	case "windows":
+		return "Raw ICMP sockets need elevated privileges. Run network-test from a terminal opened with \"Run as administrator\""
+	default:
+		return "Opening an ICMP socket was refused. Run network-test with privileges that allow raw sockets"
+	}
+}
+
+// Unprivileged reports whether the system ping will use an ICMP datagram
+// socket rather than a raw one, which Linux allows for the groups in
+// net.ipv4.ping_group_range. It is a variable so that callers can substitute
+// a fake.
+var Unprivileged = func() bool {
+	if runtime.GOOS != "linux" || os.Geteuid() == 0 {
+		return false
+	}
+
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ping_group_range")
+	if err != nil {
+		return false
+	}
+
+	var low, high int
+	if _, err := fmt.Sscan(string(data), &low, &high); err != nil {
+		return false
+	}
+
+	gid := os.Getgid()
+	return low <= gid && gid <= high
+}
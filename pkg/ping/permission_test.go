@@ -0,0 +1,84 @@
+package ping
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestPermissionHint checks the fix suggested for each platform, with
+// Linux telling a missing capability from unprivileged ICMP being off.
+func TestPermissionHint(t *testing.T) {
+	cases := []struct {
+		goos     string
+		errno    syscall.Errno
+		contains string
+	}{
+		{"linux", syscall.EPERM, "setcap cap_net_raw+ep"},
+		{"linux", syscall.EACCES, "ping_group_range"},
+		{"darwin", syscall.EPERM, "setuid root"},
+		{"freebsd", syscall.EACCES, "setuid root"},
+		{"windows", syscall.EPERM, "Run as administrator"},
+		{"plan9", syscall.EPERM, "privileges that allow raw sockets"},
+	}
+
+	for _, c := range cases {
+		if hint := PermissionHint(c.goos, c.errno); !strings.Contains(hint, c.contains) {
+			t.Fatalf("%s with %s: expected a hint mentioning %q, got %q", c.goos, c.errno, c.contains, hint)
+		}
+	}
+
+	if PermissionHint("linux", syscall.EACCES) == PermissionHint("linux", syscall.EPERM) {
+		t.Fatalf("linux: expected EACCES and EPERM to get different hints, got the same")
+	}
+}
+
+// TestPermissionError recognises a refused socket call by its errno and a
+// ping that exited complaining by its stderr, in either case, and leaves
+// other failures alone.
+func TestPermissionError(t *testing.T) {
+	exited := &exec.ExitError{ProcessState: &os.ProcessState{}}
+	cases := []struct {
+		name   string
+		err    error
+		stderr string
+		errno  syscall.Errno
+		detail string
+	}{
+		{"a socket call refused", &os.SyscallError{Syscall: "socket", Err: syscall.EPERM}, "", syscall.EPERM, "socket: operation not permitted"},
+		{"a socket call denied", &os.SyscallError{Syscall: "socket", Err: syscall.EACCES}, "", syscall.EACCES, "socket: permission denied"},
+		{"ping refused", exited, "ping: socket: Operation not permitted\n", syscall.EPERM, "ping: socket: Operation not permitted"},
+		{"ping denied", exited, "ping: socktype: SOCK_RAW\nping: socket: Permission denied\n", syscall.EACCES, "ping: socktype: SOCK_RAW\nping: socket: Permission denied"},
+		{"ping failing otherwise", exited, "ping: unknown host example.invalid\n", 0, ""},
+		{"another errno", syscall.ECONNREFUSED, "", 0, ""},
+	}
+
+	for _, c := range cases {
+		err := permissionError(c.err, c.stderr)
+
+		var permErr *PermissionError
+		if !errors.As(err, &permErr) {
+			if c.errno != 0 {
+				t.Fatalf("%s: expected a permission error, got %v", c.name, err)
+			}
+			if err != c.err {
+				t.Fatalf("%s: expected the error passed through, got %v", c.name, err)
+			}
+			continue
+		}
+
+		if c.errno == 0 {
+			t.Fatalf("%s: expected the error passed through, got a permission error %q", c.name, permErr.Detail)
+		}
+		if permErr.Errno != c.errno || !errors.Is(err, c.errno) || permErr.Detail != c.detail || permErr.Hint != PermissionHint(runtime.GOOS, c.errno) {
+			t.Fatalf("%s: expected %s with %q and this platform's hint, got %s with %q and %q", c.name, c.errno, c.detail, permErr.Errno, permErr.Detail, permErr.Hint)
+		}
+		if !strings.HasPrefix(err.Error(), c.detail+"\n") {
+			t.Fatalf("%s: expected the message to give the detail then the hint, got %q", c.name, err.Error())
+		}
+	}
+}
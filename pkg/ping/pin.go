@@ -0,0 +1,50 @@
+package ping
+
+import "net/netip"
+
+// Pin makes the pinger probe addr rather than whatever the host resolves to
+// each time a backend starts, so that it stays on the one address however
+// the answers change. An invalid address leaves it resolving the host.
+func (p *Pinger) Pin(addr netip.Addr) *Pinger {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pinned = addr
+	return p
+}
+
+// Repin moves probing to addr, stopping the backend running so that it's
+// started again against the new one, and reports whether it had to.
+func (p *Pinger) Repin(addr netip.Addr) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if addr == p.pinned {
+		return false
+	}
+
+	p.pinned = addr
+	if p.stopRun != nil {
+		p.stopRun()
+	}
+	return true
+}
+
+// Pinned is the address probed under Pin, invalid while the host is looked
+// up instead.
+func (p *Pinger) Pinned() netip.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pinned
+}
+
+// destination is what the system ping is told to probe, the address pinned
+// or else the host for it to look up itself.
+func (p *Pinger) destination() string {
+	if pinned := p.Pinned(); pinned.IsValid() {
+		return pinned.String()
+	}
+
+	return p.host
+}
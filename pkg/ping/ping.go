@@ -3,96 +3,458 @@ package ping
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net/netip"
 	"os/exec"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	BUFFER_SIZE = 256
+	// DEFAULT_PAYLOAD_SIZE is what the system ping sends when not told
+	// otherwise.
+	DEFAULT_PAYLOAD_SIZE = 56
+)
+
+type Result struct {
+	Index    int64
+	Epoch    int
+	Seq      int
+	TTL      int
+	Duration time.Duration
+	DNS      time.Duration
+	Phases   []Phase
+	// At is when the reply came in, or when the probe was given up on.
+	At time.Time
+	// Lost is set when ping reported the probe failing, rather than it
+	// simply going unanswered, with Reason saying how.
+	Lost   bool
+	Reason string
+	// Status is the HTTP response code and Rcode the DNS one, with Error
+	// saying what went wrong with a failed request and Server which DNS
+	// server was asked.
+	Status int
+	Rcode  string
+	Error  string
+	Server string
+}
+
+// Phase is one step of a probe that has several, such as an HTTP request.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
 type Pinger struct {
-	host     string
-	interval time.Duration
+	host        string
+	interval    time.Duration
+	resolveEach bool
+	family      string
+	failover    bool
+	native      bool
+	// size is the payload of each echo request, zero for the default.
+	size         int
+	dontFragment bool
+	binding      Binding
+	port         int
+	udpPort      int
+	http         *HTTPOptions
+	dns          *DNSOptions
+	resolver     Resolver
+	dropped      atomic.Int64
+	notices      chan Notice
+	probes       *InFlight
+
+	mu         sync.Mutex
+	ignored    ReplyCounts
+	resolution Resolution
+	pinned     netip.Addr
+	paused     bool
+	resumed    chan struct{}
+	stopRun    context.CancelFunc
+	// epoch counts the backends started, across runs.
+	epoch int
+	// rate is how often probes are sent, which SetInterval can change from
+	// interval, closing paced to tell the backend.
+	rate    time.Duration
+	paced   chan struct{}
+	running string
 }
 
-func NewPinger(host string, interval int) *Pinger {
-	return &Pinger{
+func NewPinger(host string, interval time.Duration) *Pinger {
+	p := &Pinger{
 		host:     host,
-		interval: time.Duration(interval) * time.Second,
+		interval: interval,
+		failover: true,
+		notices:  make(chan Notice, NOTICE_BUFFER_SIZE),
+		paced:    make(chan struct{}),
+	}
+	p.rate = p.interval
+	p.probes = NewInFlight(DefaultInFlight(p.probeTimeout(), p.interval))
+
+	return p
+}
+
+// MaxInFlight caps how many probes may await a reply at once, for backends
+// that can overlap them. Zero keeps the default.
+func (p *Pinger) MaxInFlight(n int) *Pinger {
+	if n > 0 {
+		p.probes = NewInFlight(n)
 	}
+	return p
+}
+
+// Probes exposes the in-flight count and skipped ticks.
+func (p *Pinger) Probes() *InFlight {
+	return p.probes
 }
 
-var PING_LINE = regexp.MustCompile(`^\d+ bytes from \d+.\d+.\d+.\d+: icmp_seq=\d+ ttl=\d+ time=(\d+.\d+) ms$`)
+// PING_LINE is a reply as iputils, macOS and BusyBox print it, from an
+// IPv4 or IPv6 address or a name with the address after it in brackets.
+// BusyBox says seq rather than icmp_seq, macOS's ping6 hlim rather than ttl
+// and a comma after the address, and a time may have no decimals or be given as under a bound, as in
+// time<1 ms. The ttl is matched whatever its case, as some macOS releases
+// capitalise it. Duplicate replies end in (DUP!) and are left out.
+var PING_LINE = regexp.MustCompile(`^\d+ bytes from (?:\S+ \()?\S+?\)?[:,]\s+(?:icmp_)?seq=(\d+)\s+(?i:ttl|hlim)=(\d+)\s+time[=<]\s*(\d+(?:\.\d+)?)\s*ms$`)
+
+const (
+	LOSS_TIMEOUT     = "timeout"
+	LOSS_UNREACHABLE = "unreachable"
+)
 
-func processLine(line string) (time.Duration, error) {
+// LOSS_LINES are what ping prints about probes that didn't get a reply: a
+// timeout on macOS, no answer yet on linux with -O, and an ICMP error from a
+// router on either, which for a probe too big for the path says so after
+// the sequence number, as kept for the result's error.
+var LOSS_LINES = map[string]*regexp.Regexp{
+	LOSS_TIMEOUT:       regexp.MustCompile(`^(?:Request timeout for icmp_seq |no answer yet for icmp_seq=)(\d+)$`),
+	LOSS_UNREACHABLE:   regexp.MustCompile(`^From \S+(?: \S+)? icmp_seq=(\d+) Destination (?:Host|Net|Port|Protocol) Unreachable`),
+	LOSS_FRAGMENTATION: regexp.MustCompile(`^From \S+(?: \S+)? icmp_seq=(\d+) ((?i:Frag needed and DF set|Packet too big).*)$`),
+}
+
+var ErrUnreachable = errors.New("destination unreachable")
+
+// ResolveEach makes the pinger look the host up before every probe and time
+// that lookup separately, instead of leaving resolution to ping at startup.
+func (p *Pinger) ResolveEach(enabled bool) *Pinger {
+	p.resolveEach = enabled
+	return p
+}
+
+// ParseLine reads one line of ping output, which is either a reply or a
+// report of a probe that failed.
+func ParseLine(line string) (Result, error) {
 	matches := PING_LINE.FindStringSubmatch(line)
-	if len(matches) < 2 {
-		return 0, fmt.Errorf("failed to parse line: %s", line)
+	if len(matches) < 4 {
+		for reason, pattern := range LOSS_LINES {
+			if matches := pattern.FindStringSubmatch(line); matches != nil {
+				seq, _ := strconv.Atoi(matches[1])
+				result := Result{Seq: seq, Lost: true, Reason: reason}
+				if len(matches) > 2 {
+					result.Error = matches[2]
+				}
+				return result, nil
+			}
+		}
+		return Result{}, fmt.Errorf("failed to parse line: %s", line)
 	}
 
-	return time.ParseDuration(fmt.Sprintf("%sms", matches[1]))
+	seq, _ := strconv.Atoi(matches[1])
+	ttl, _ := strconv.Atoi(matches[2])
+	// A time under a bound is taken as the bound, the most it could be.
+	ms, err := strconv.ParseFloat(matches[3], 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Duration: time.Duration(math.Round(ms * float64(time.Millisecond))), Seq: seq, TTL: ttl}, nil
+}
+
+func (p *Pinger) Dropped() int64 {
+	return p.dropped.Load()
 }
 
-func (p *Pinger) Run(ctx context.Context) (chan time.Duration, chan error) {
-	pings := make(chan time.Duration)
-	errs := make(chan error)
+// deliver never blocks the prober: when the consumer has fallen a whole
+// buffer behind, the oldest queued sample is discarded to make room.
+func (p *Pinger) deliver(pings chan Result, result Result) {
+	if result.At.IsZero() {
+		result.At = time.Now()
+	}
+	for {
+		select {
+		case pings <- result:
+			return
+		default:
+		}
+
+		select {
+		case <-pings:
+			p.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (p *Pinger) Run(ctx context.Context) (<-chan Result, <-chan error) {
+	if p.resolveEach && p.icmp() {
+		return p.runResolving(ctx)
+	}
+
+	pings := make(chan Result, BUFFER_SIZE)
+	errs := make(chan error, 1)
 
 	go func() {
 		defer close(pings)
 		defer close(errs)
 
-		cmd := exec.Command("ping", p.host, "-i", fmt.Sprintf("%d", p.interval/time.Second))
-		stdout, err := cmd.StdoutPipe()
+		errs <- p.supervise(ctx, pings)
+	}()
 
-		if err != nil {
-			errs <- err
-			return
+	return pings, errs
+}
+
+// StreamArgs is the system ping command run to probe host every interval
+// until it's stopped.
+func StreamArgs(host string, family string, interval time.Duration, goos string, options []string) []string {
+	args := append(append(familyArgs(host, family, goos), options...), host, "-i", strconv.FormatFloat(interval.Seconds(), 'f', -1, 64))
+	if goos == "linux" {
+		// Report each unanswered probe, as other platforms do by default,
+		// so that an outage still produces output.
+		args = append(args, "-O")
+	}
+
+	return args
+}
+
+// OnceArgs is the system ping command run for a single probe.
+func OnceArgs(host string, family string, seconds int, goos string, options []string) []string {
+	return append(append(familyArgs(host, family, goos), options...), "-c", "1", "-W", strconv.Itoa(seconds), host)
+}
+
+// runStream runs a single long-lived ping process until it exits or the
+// context is cancelled.
+func (p *Pinger) runStream(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	interval, changed := p.pacing()
+	argv := StreamArgs(p.destination(), p.family, interval, runtime.GOOS, p.execOptions())
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.WaitDelay = time.Second
+	stderr := &stderrWatch{line: p.localMTU()}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Killing ping doesn't unblock the read if something else still holds
+	// the pipe open, so close it from this side too.
+	stop := context.AfterFunc(ctx, func() { stdout.Close() })
+	defer stop()
+
+	var repaced atomic.Bool
+	go func() {
+		select {
+		case <-changed:
+			repaced.Store(true)
+			cmd.Process.Kill()
+		case <-ctx.Done():
 		}
+	}()
 
-		if err := cmd.Start(); err != nil {
-			errs <- err
-			return
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		beat()
+		line := scanner.Text()
+		if len(line) < 1 {
+			continue
 		}
 
-		go func() {
-			scanner := bufio.NewScanner(stdout)
+		if strings.HasPrefix(line, "PING") {
+			continue
+		}
 
-			for scanner.Scan() {
-				line := scanner.Text()
-				if len(line) < 1 {
-					continue
-				}
+		result, err := ParseLine(line)
+		if err != nil {
+			continue
+		}
 
-				if strings.HasPrefix(line, "PING") {
-					continue
-				}
+		result.Epoch = epoch
+		p.deliver(pings, result)
+	}
 
-				duration, err := processLine(line)
-				if err != nil {
-					// fmt.Printf("failed to process line: %s\n", err)
-					continue
-				}
+	err = cmd.Wait()
+	if repaced.Load() {
+		return errRepaced
+	}
+	if err != nil {
+		return permissionError(err, stderr.String())
+	}
 
-				pings <- duration
-			}
-		}()
+	return fmt.Errorf("ping exited")
+}
 
-		finished := make(chan error)
-		go func() {
-			defer close(errs)
+// runEach starts a fresh ping for every probe, slower than streaming but
+// immune to a long-running ping process misbehaving. Probes to a slow target
+// overlap up to the in-flight cap, past which ticks are skipped.
+func (p *Pinger) runEach(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	ticker := p.pace(ctx)
+	defer ticker.Stop()
 
-			if err := cmd.Wait(); err != nil {
-				finished <- err
-			}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer p.probes.Wait()
+	defer cancel(nil)
 
-			return
-		}()
+	seq := 0
+	for {
+		probe := seq + 1
+		if p.probes.Launch(func() {
+			result, err := once(ctx, p.destination(), p.family, p.probeTimeout(), p.execOptions())
+			beat()
+			var permErr *PermissionError
+			if errors.As(err, &permErr) {
+				cancel(err)
+				return
+			}
+			if err == nil {
+				result.Epoch = epoch
+				result.Seq = probe
+				p.deliver(pings, result)
+			}
+		}) {
+			seq = probe
+		}
 
 		select {
 		case <-ctx.Done():
-			errs <- nil
-		case err := <-finished:
+			var permErr *PermissionError
+			if err := context.Cause(ctx); errors.As(err, &permErr) {
+				return err
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+var ErrNoReply = errors.New("no reply")
+
+func Once(ctx context.Context, host string, timeout time.Duration) (time.Duration, error) {
+	result, err := once(ctx, host, "", timeout, nil)
+	if err == nil && result.Lost {
+		return 0, ErrUnreachable
+	}
+	return result.Duration, err
+}
+
+func once(ctx context.Context, host string, family string, timeout time.Duration, options []string) (Result, error) {
+	seconds := int(timeout.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	argv := OnceArgs(host, family, seconds, runtime.GOOS, options)
+	out, err := exec.CommandContext(ctx, argv[0], argv[1:]...).Output()
+
+	// An unreachable or too big reply only counts if no echo reply came as
+	// well.
+	var unreachable *Result
+	for _, line := range strings.Split(string(out), "\n") {
+		result, err := ParseLine(line)
+		switch {
+		case err != nil:
+		case !result.Lost:
+			return result, nil
+		case result.Reason == LOSS_UNREACHABLE, result.Reason == LOSS_FRAGMENTATION:
+			unreachable = &result
+		}
+	}
+	if unreachable != nil {
+		return *unreachable, nil
+	}
+
+	if ctx.Err() != nil {
+		return Result{}, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if len(exitErr.Stderr) > 0 {
+			return Result{}, permissionError(errors.New(strings.TrimSpace(string(exitErr.Stderr))), string(exitErr.Stderr))
+		}
+		return Result{}, ErrNoReply
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{}, ErrNoReply
+}
+
+func (p *Pinger) runResolving(ctx context.Context) (<-chan Result, <-chan error) {
+	pings := make(chan Result, BUFFER_SIZE)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(pings)
+		defer close(errs)
+
+		if err := p.awaitResolved(ctx); err != nil || ctx.Err() != nil {
 			errs <- err
+			return
+		}
+
+		ticker := p.pace(ctx)
+		defer ticker.Stop()
+
+		// There's no backend to restart here, but the results still carry
+		// the run's epoch, as every backend's do.
+		p.epoch++
+		epoch := p.epoch
+
+		seq := 0
+		for {
+			if !p.waitResumed(ctx) {
+				errs <- nil
+				return
+			}
+
+			seq++
+			start := time.Now()
+			addr, err := p.lookup(ctx)
+			dns := time.Since(start)
+
+			if err == nil {
+				result, err := once(ctx, addr.String(), p.family, p.probeTimeout(), p.execOptions())
+				var permErr *PermissionError
+				if errors.As(err, &permErr) {
+					errs <- err
+					return
+				}
+				if err == nil {
+					result.Seq = seq
+					result.Epoch = epoch
+					result.DNS = dns
+					p.deliver(pings, result)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				errs <- nil
+				return
+			case <-ticker.C:
+			}
 		}
 	}()
 
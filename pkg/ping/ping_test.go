@@ -0,0 +1,131 @@
+package ping
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestLossLines parses what ping prints about failed probes on linux
+// and macOS, checking that each becomes a lost result for the right probe.
+func TestLossLines(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected string
+	}{
+		{"64 bytes from 1.1.1.1: icmp_seq=3 ttl=57 time=12.5 ms", "seq 3, lost false"},
+		{"Request timeout for icmp_seq 41", "seq 41, lost true (timeout)"},
+		{"no answer yet for icmp_seq=7", "seq 7, lost true (timeout)"},
+		{"From 192.168.1.1 icmp_seq=9 Destination Host Unreachable", "seq 9, lost true (unreachable)"},
+		{"From router.lan (10.0.0.1) icmp_seq=2 Destination Net Unreachable", "seq 2, lost true (unreachable)"},
+		{"92 bytes from 10.0.0.1: Destination Host Unreachable", "not parsed"},
+	}
+
+	for _, c := range cases {
+		actual := "not parsed"
+		if result, err := ParseLine(c.line); err == nil {
+			actual = fmt.Sprintf("seq %d, lost %t", result.Seq, result.Lost)
+			if result.Lost {
+				actual += fmt.Sprintf(" (%s)", result.Reason)
+			}
+		}
+		if actual != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.line, c.expected, actual)
+		}
+	}
+}
+
+// TestReplyLines parses replies as iputils, macOS and BusyBox print
+// them, over IPv4 and IPv6 and from named hosts, and the lines around them
+// that aren't replies.
+func TestReplyLines(t *testing.T) {
+	cases := []struct {
+		platform string
+		line     string
+		expected string
+	}{
+		{"iputils", "64 bytes from 1.1.1.1: icmp_seq=1 ttl=57 time=12.3 ms", "seq 1, ttl 57, 12.3ms"},
+		{"iputils", "64 bytes from one.one.one.one (1.1.1.1): icmp_seq=2 ttl=57 time=11.8 ms", "seq 2, ttl 57, 11.8ms"},
+		{"iputils", "64 bytes from 2606:4700:4700::1111: icmp_seq=3 ttl=58 time=9.87 ms", "seq 3, ttl 58, 9.87ms"},
+		{"iputils", "64 bytes from lhr25s34-in-x0e.1e100.net (2a00:1450:4009:81f::200e): icmp_seq=4 ttl=117 time=14.1 ms", "seq 4, ttl 117, 14.1ms"},
+		{"iputils", "64 bytes from fe80::1%eth0: icmp_seq=5 ttl=64 time=0.412 ms", "seq 5, ttl 64, 412µs"},
+		{"iputils", "64 bytes from localhost (::1): icmp_seq=6 ttl=64 time=0.045 ms", "seq 6, ttl 64, 45µs"},
+		{"iputils", "64 bytes from 10.0.0.1: icmp_seq=7 ttl=64 time<1 ms", "seq 7, ttl 64, 1ms"},
+		{"iputils", "1408 bytes from 1.1.1.1: icmp_seq=8 ttl=57 time=13.5 ms", "seq 8, ttl 57, 13.5ms"},
+		{"macOS", "1408 bytes from 1.1.1.1: icmp_seq=9 ttl=57 time=14.2 ms", "seq 9, ttl 57, 14.2ms"},
+		{"iputils", "64 bytes from 1.1.1.1: icmp_seq=8 ttl=57 time=12.3 ms (DUP!)", "not parsed"},
+		{"macOS", "64 bytes from 142.250.1.1: icmp_seq=0 ttl=115 time=12.345 ms", "seq 0, ttl 115, 12.345ms"},
+		{"macOS", "64 bytes from 192.168.1.1: icmp_seq=12 ttl=64 time=3.021 ms", "seq 12, ttl 64, 3.021ms"},
+		{"macOS", "16 bytes from 2a00:1450:4009:81f::200e, icmp_seq=0 hlim=117 time=15.125 ms", "seq 0, ttl 117, 15.125ms"},
+		{"macOS", "16 bytes from ::1, icmp_seq=1 hlim=64 time=0.067 ms", "seq 1, ttl 64, 67µs"},
+		{"macOS", "64 bytes from 192.168.1.1: icmp_seq=13 TTL=64 time=2.877 ms", "seq 13, ttl 64, 2.877ms"},
+		{"BusyBox", "64 bytes from 8.8.8.8: seq=0 ttl=118 time=10.594 ms", "seq 0, ttl 118, 10.594ms"},
+		{"BusyBox", "64 bytes from 8.8.8.8: seq=1 ttl=118 time=12 ms", "seq 1, ttl 118, 12ms"},
+		{"BusyBox", "64 bytes from 2001:4860:4860::8888: seq=2 ttl=117 time=11.201 ms", "seq 2, ttl 117, 11.201ms"},
+		{"any", "PING 1.1.1.1 (1.1.1.1) 56(84) bytes of data.", "not parsed"},
+		{"any", "--- 1.1.1.1 ping statistics ---", "not parsed"},
+		{"any", "round-trip min/avg/max = 10.594/11.297/12.000 ms", "not parsed"},
+	}
+
+	for _, c := range cases {
+		actual := "not parsed"
+		if result, err := ParseLine(c.line); err == nil && !result.Lost {
+			actual = fmt.Sprintf("seq %d, ttl %d, %s", result.Seq, result.TTL, result.Duration)
+		}
+		if actual != c.expected {
+			t.Errorf("%s: %s: expected %q, got %q", c.platform, c.line, c.expected, actual)
+		}
+	}
+}
+
+// TestDeliver has the consumer read a few results then stop, as the
+// display does when it's stuck, checking that the prober is never held up,
+// the newest results are the ones kept and every one thrown away is counted.
+func TestDeliver(t *testing.T) {
+	p := NewPinger("example.com", time.Second)
+	pings := make(chan Result, BUFFER_SIZE)
+
+	const read, sent = 10, BUFFER_SIZE + 100
+	for seq := range sent {
+		p.deliver(pings, Result{Seq: seq})
+		if seq < read {
+			<-pings
+		}
+	}
+
+	if dropped := p.Dropped(); dropped != sent-read-BUFFER_SIZE {
+		t.Fatalf("only the overflow is dropped: expected %d, got %d", sent-read-BUFFER_SIZE, dropped)
+	}
+	if len(pings) != BUFFER_SIZE {
+		t.Fatalf("the buffer is kept full: expected %d queued, got %d", BUFFER_SIZE, len(pings))
+	}
+	for want := sent - BUFFER_SIZE; want < sent; want++ {
+		if result := <-pings; result.Seq != want || result.At.IsZero() {
+			t.Fatalf("the newest results are kept in order: expected seq %d stamped, got seq %d at %s", want, result.Seq, result.At)
+		}
+	}
+
+	// With the consumer reading now and then alongside, every result is
+	// either read or counted as dropped, and those read stay in order.
+	p = NewPinger("example.com", time.Second)
+	pings = make(chan Result, BUFFER_SIZE)
+	done := make(chan []int)
+	go func() {
+		var seqs []int
+		for result := range pings {
+			seqs = append(seqs, result.Seq)
+			time.Sleep(10 * time.Microsecond)
+		}
+		done <- seqs
+	}()
+	for seq := range 20 * BUFFER_SIZE {
+		p.deliver(pings, Result{Seq: seq})
+	}
+	close(pings)
+
+	seqs := <-done
+	if int64(len(seqs))+p.Dropped() != 20*BUFFER_SIZE || !slices.IsSorted(seqs) || seqs[len(seqs)-1] != 20*BUFFER_SIZE-1 {
+		t.Fatalf("each result is read or dropped, in order, ending with the newest: expected %d in all, got %d read and %d dropped", 20*BUFFER_SIZE, len(seqs), p.Dropped())
+	}
+}
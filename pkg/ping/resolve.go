@@ -0,0 +1,141 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	// RESOLVE_RETRY_MIN and RESOLVE_RETRY_MAX bound the backoff between
+	// attempts at a host that has yet to resolve.
+	RESOLVE_RETRY_MIN = time.Second
+	RESOLVE_RETRY_MAX = 30 * time.Second
+
+	RESOLVE_NOTICE = "resolve"
+)
+
+// Resolver looks names up as net.DefaultResolver does, which is what's used
+// unless another is given.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error)
+}
+
+// Resolution is how looking the host up has gone over the run.
+type Resolution struct {
+	// Address is what the host last resolved to, which probing carries on
+	// at while it's failing.
+	Address  netip.Addr
+	Failures int64
+	Failing  bool
+	Err      string
+	// Retry is when the next attempt is, while the host has yet to resolve
+	// at all.
+	Retry time.Time
+}
+
+// Resolver makes the pinger look the host up with r rather than the
+// system's resolver.
+func (p *Pinger) Resolver(r Resolver) *Pinger {
+	p.resolver = r
+	return p
+}
+
+func (p *Pinger) Resolution() Resolution {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.resolution
+}
+
+// resolvable is whether the pinger probes a host it has to look up, where
+// HTTP and DNS probing leave that to the request.
+func (p *Pinger) resolvable() bool {
+	return p.http == nil && p.dns == nil
+}
+
+// lookup resolves the host, falling back on the address it last resolved
+// to when that fails, so that the resolver going down mid-run doesn't stop
+// probing. It only fails while the host has never resolved. A pinned address
+// is never looked up.
+func (p *Pinger) lookup(ctx context.Context) (netip.Addr, error) {
+	if pinned := p.Pinned(); pinned.IsValid() {
+		return pinned, nil
+	}
+
+	resolver := p.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addr, err := ResolveWith(ctx, resolver, p.host, p.family)
+	if ctx.Err() != nil {
+		return addr, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := &p.resolution
+	if err == nil {
+		switch {
+		case r.Failing && r.Address.IsValid():
+			p.notify(RESOLVE_NOTICE, fmt.Sprintf("%s resolves again, to %s", p.host, addr))
+		case r.Failing:
+			p.notify(RESOLVE_NOTICE, fmt.Sprintf("%s resolved to %s after %d failed attempts", p.host, addr, r.Failures))
+		}
+		r.Address, r.Failing, r.Err = addr, false, ""
+		return addr, nil
+	}
+
+	r.Failures++
+	r.Err = err.Error()
+	if !r.Address.IsValid() {
+		r.Failing = true
+		return addr, err
+	}
+
+	if !r.Failing {
+		r.Failing = true
+		p.notify(RESOLVE_NOTICE, fmt.Sprintf("%s, carrying on probing %s, where it last resolved", err, r.Address))
+	}
+	return r.Address, nil
+}
+
+// awaitResolved holds probing back until the host first resolves, retrying
+// with a backoff rather than ending the run over a resolver that's down at
+// startup. Only a host with no address in the family asked for ends it.
+func (p *Pinger) awaitResolved(ctx context.Context) error {
+	if !p.resolvable() {
+		return nil
+	}
+
+	delay := RESOLVE_RETRY_MIN
+	for {
+		_, err := p.lookup(ctx)
+		var familyErr *FamilyError
+		if err == nil || errors.As(err, &familyErr) || ctx.Err() != nil {
+			p.mu.Lock()
+			p.resolution.Retry = time.Time{}
+			p.mu.Unlock()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		p.mu.Lock()
+		p.resolution.Retry = time.Now().Add(delay)
+		p.mu.Unlock()
+		p.notify(RESOLVE_NOTICE, fmt.Sprintf("%s, retrying in %s", err, delay))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, RESOLVE_RETRY_MAX)
+	}
+}
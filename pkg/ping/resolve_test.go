@@ -0,0 +1,109 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyResolver resolves every name to 127.0.0.1, except on the lookups,
+// counted from one, that fail says to fail.
+type flakyResolver struct {
+	mu    sync.Mutex
+	calls int
+	fail  func(call int) bool
+}
+
+func (r *flakyResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.fail(r.calls) {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+}
+
+// TestResolution probes a local listener by a name that fails to
+// resolve at first, checking probing waits for it instead of giving up, and
+// then by one that stops resolving mid-run, checking probing carries on at
+// the last address until it resolves again.
+func TestResolution(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: expected no error, got %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	probe := func(pinger *Pinger, want int) ([]Result, []string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		pings, errs := pinger.Run(ctx)
+		var results []Result
+		var notices []string
+		for len(results) < want {
+			select {
+			case result := <-pings:
+				results = append(results, result)
+			case notice := <-pinger.Notices():
+				notices = append(notices, notice.Message)
+			case err := <-errs:
+				return results, notices, fmt.Errorf("stopped early: %v", err)
+			case <-ctx.Done():
+				return results, notices, ctx.Err()
+			}
+		}
+		for len(pinger.Notices()) > 0 {
+			notices = append(notices, (<-pinger.Notices()).Message)
+		}
+
+		return results, notices, nil
+	}
+
+	atStart := NewPinger("probe.test", time.Second).TCP(port).Resolver(&flakyResolver{fail: func(call int) bool { return call == 1 }})
+	results, notices, err := probe(atStart, 1)
+	if err != nil || results[0].Lost {
+		t.Fatalf("a host that resolves on the second attempt is probed: expected a reply, got %q", fmt.Sprint(results, err))
+	}
+	if r := atStart.Resolution(); r.Failures != 1 || r.Failing || r.Address.String() != "127.0.0.1" {
+		t.Fatalf("the failed attempt at startup is counted: expected 1 failure, resolved to 127.0.0.1, got %+v", r)
+	}
+	if len(notices) != 2 || !strings.HasSuffix(notices[0], "no such host, retrying in 1s") || notices[1] != "probe.test resolved to 127.0.0.1 after 1 failed attempts" {
+		t.Fatalf("the failure and the retry that resolved are logged: expected the retry, then the address, got %q", notices)
+	}
+
+	midRun := NewPinger("probe.test", time.Second).TCP(port).ResolveEach(true).Resolver(&flakyResolver{fail: func(call int) bool { return call == 2 }})
+	results, notices, err = probe(midRun, 3)
+	if err != nil {
+		t.Fatalf("probing a host that stops resolving mid-run: expected 3 probes, got %v", err)
+	}
+	for i, result := range results {
+		if result.Lost {
+			t.Fatalf("probing carries on at the last address while the host doesn't resolve: expected every probe answered, got probe %d lost", i+1)
+		}
+	}
+	if r := midRun.Resolution(); r.Failures != 1 || r.Failing {
+		t.Fatalf("the failure mid-run is counted and clears: expected 1 failure, not failing, got %+v", r)
+	}
+	if len(notices) != 2 || !strings.HasSuffix(notices[0], "carrying on probing 127.0.0.1, where it last resolved") || notices[1] != "probe.test resolves again, to 127.0.0.1" {
+		t.Fatalf("the failure mid-run and the recovery are logged: expected the failure, then the recovery, got %q", notices)
+	}
+}
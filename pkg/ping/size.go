@@ -0,0 +1,161 @@
+package ping
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+const (
+	// MIN_PAYLOAD_SIZE is the least the system ping needs to carry the
+	// timestamp it times replies by.
+	MIN_PAYLOAD_SIZE = 16
+	// MAX_PAYLOAD_SIZE is the most an echo request can carry: an IPv4
+	// packet's 65535 bytes, less its header and the ICMP one.
+	MAX_PAYLOAD_SIZE = 65535 - IPV4_HEADER_LEN - ICMP_HEADER_LEN
+
+	// LOSS_FRAGMENTATION is a probe too big for the path that wasn't allowed
+	// to be fragmented, or for IPv6, which routers never fragment.
+	LOSS_FRAGMENTATION = "fragmentation"
+)
+
+// LOCAL_MTU_LINE is what iputils prints on stderr for a probe too big for
+// the interface it would leave by, which it doesn't number.
+var LOCAL_MTU_LINE = regexp.MustCompile(`local error: [Mm]essage too long, mtu[=:] ?(\d+)`)
+
+// Size sets how many bytes each echo request carries, rather than the
+// system ping's DEFAULT_PAYLOAD_SIZE.
+func (p *Pinger) Size(size int) *Pinger {
+	p.size = size
+	return p
+}
+
+// DontFragment has the echo requests sent with don't-fragment set, so that
+// one too big for the path is refused rather than split up.
+func (p *Pinger) DontFragment(enabled bool) *Pinger {
+	p.dontFragment = enabled
+	return p
+}
+
+// PayloadSize is how many bytes each echo request carries.
+func (p *Pinger) PayloadSize() int {
+	if p.size == 0 {
+		return DEFAULT_PAYLOAD_SIZE
+	}
+
+	return p.size
+}
+
+// CheckPacket reports a payload size or don't-fragment the backend can't do,
+// up front, rather than leaving the probes to fail on it.
+func (p *Pinger) CheckPacket() error {
+	size := p.PayloadSize()
+	if size < MIN_PAYLOAD_SIZE || size > MAX_PAYLOAD_SIZE {
+		return fmt.Errorf("--size %d is out of range, which is %d to %d bytes", size, MIN_PAYLOAD_SIZE, MAX_PAYLOAD_SIZE)
+	}
+	if !p.icmp() {
+		if size != DEFAULT_PAYLOAD_SIZE || p.dontFragment {
+			return fmt.Errorf("--size and --df only apply to icmp probes")
+		}
+		return nil
+	}
+
+	if !p.dontFragment {
+		return nil
+	}
+	if p.Backend() == "native" {
+		return fmt.Errorf("--df needs the system ping, as the native backend can't set don't-fragment; drop --native, or install ping")
+	}
+	_, err := PacketArgs(p.host, p.family, size, true, runtime.GOOS)
+	return err
+}
+
+// PacketArgs are the system ping's options for the payload size and
+// don't-fragment, which each platform spells its own way, or an error for
+// one it can't do. A default payload is left for ping to choose.
+func PacketArgs(host string, family string, size int, dontFragment bool, goos string) ([]string, error) {
+	var args []string
+	if size != 0 && size != DEFAULT_PAYLOAD_SIZE {
+		flag := "-s"
+		if goos == "windows" {
+			flag = "-l"
+		}
+		args = append(args, flag, strconv.Itoa(size))
+	}
+	if !dontFragment {
+		return args, nil
+	}
+
+	switch goos {
+	case "linux":
+		return append(args, "-M", "do"), nil
+	case "darwin":
+		if wantsIPv6(host, family) {
+			return nil, fmt.Errorf("--df isn't supported by macOS's ping6; IPv6 routers never fragment, so drop it to see the same thing")
+		}
+		return append(args, "-D"), nil
+	case "freebsd":
+		return append(args, "-D"), nil
+	case "windows":
+		return append(args, "-f"), nil
+	}
+
+	return nil, fmt.Errorf("--df isn't supported by the system ping on %s", goos)
+}
+
+// tooBig reports a send refused for a probe bigger than the interface it
+// would leave by allows.
+func tooBig(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
+
+// wantsIPv6 is whether ping is asked for IPv6, by the family or by host
+// being an IPv6 address.
+func wantsIPv6(host string, family string) bool {
+	if family != "" {
+		return family == IPV6
+	}
+
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.Is6() && !addr.Is4In6()
+}
+
+// localMTU tells of probes too big for the interface as ping reports them,
+// once for each MTU it gives, since it does so for every probe.
+func (p *Pinger) localMTU() func(string) {
+	last := ""
+	return func(line string) {
+		matches := LOCAL_MTU_LINE.FindStringSubmatch(line)
+		if matches == nil || matches[1] == last {
+			return
+		}
+		last = matches[1]
+		p.notify(LOSS_FRAGMENTATION, fmt.Sprintf("probes of %d bytes don't fit the interface's %s byte MTU and --df stops them being split, so none are sent", p.PayloadSize(), last))
+	}
+}
+
+// stderrWatch keeps what ping prints on stderr, for the error it exits
+// with, handing each line to line as it comes.
+type stderrWatch struct {
+	bytes.Buffer
+	partial []byte
+	line    func(string)
+}
+
+func (w *stderrWatch) Write(data []byte) (int, error) {
+	w.Buffer.Write(data)
+	w.partial = append(w.partial, data...)
+	for {
+		end := bytes.IndexByte(w.partial, '\n')
+		if end < 0 {
+			return len(data), nil
+		}
+		w.line(string(w.partial[:end]))
+		w.partial = w.partial[end+1:]
+	}
+}
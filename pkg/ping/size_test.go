@@ -0,0 +1,117 @@
+package ping
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// TestPacketSize checks --size and --df are asked of each platform's
+// ping in its own way, or refused where they can't be, and that a probe too
+// big for the path is settled as such, from ping's output and from the ICMP
+// errors the native backend reads.
+func TestPacketSize(t *testing.T) {
+	args := []struct {
+		host         string
+		size         int
+		dontFragment bool
+		goos         string
+		expected     string
+	}{
+		{"1.1.1.1", DEFAULT_PAYLOAD_SIZE, false, "linux", ""},
+		{"1.1.1.1", 1400, false, "linux", "-s 1400"},
+		{"1.1.1.1", 1400, true, "linux", "-s 1400 -M do"},
+		{"1.1.1.1", 0, true, "linux", "-M do"},
+		{"1.1.1.1", 1400, true, "darwin", "-s 1400 -D"},
+		{"1.1.1.1", 1400, true, "freebsd", "-s 1400 -D"},
+		{"1.1.1.1", 1400, true, "windows", "-l 1400 -f"},
+		{"2606:4700::1111", 1400, true, "darwin", "error: --df isn't supported by macOS's ping6"},
+		{"1.1.1.1", 1400, true, "plan9", "error: --df isn't supported by the system ping on plan9"},
+	}
+	for _, c := range args {
+		packet, err := PacketArgs(c.host, "", c.size, c.dontFragment, c.goos)
+		actual := strings.Join(packet, " ")
+		if err != nil {
+			actual = "error: " + err.Error()
+		}
+		if !strings.HasPrefix(actual, c.expected) || (c.expected == "" && actual != "") {
+			t.Fatalf("--size %d, --df %t to %s on %s: expected %q, got %q", c.size, c.dontFragment, c.host, c.goos, c.expected, actual)
+		}
+	}
+	packet, _ := PacketArgs("1.1.1.1", "", 1400, true, "linux")
+	if argv := strings.Join(StreamArgs("1.1.1.1", "", time.Second, "linux", packet), " "); argv != "ping -s 1400 -M do 1.1.1.1 -i 1 -O" {
+		t.Fatalf("the packet options come before the host: expected ping -s 1400 -M do 1.1.1.1 -i 1 -O, got %q", argv)
+	}
+
+	refused := []struct {
+		name     string
+		pinger   *Pinger
+		expected string
+	}{
+		{"too small", NewPinger("1.1.1.1", time.Second).Size(8), "--size 8 is out of range"},
+		{"too big", NewPinger("1.1.1.1", time.Second).Size(70000), "--size 70000 is out of range"},
+		{"over tcp", NewPinger("1.1.1.1", time.Second).TCP(443).DontFragment(true), "--size and --df only apply to icmp probes"},
+		{"natively", NewPinger("1.1.1.1", time.Second).Native(true).DontFragment(true), "--df needs the system ping"},
+	}
+	for _, c := range refused {
+		if err := c.pinger.CheckPacket(); err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("--df or --size %s is refused: expected %q, got %v", c.name, c.expected, err)
+		}
+	}
+	if err := NewPinger("1.1.1.1", time.Second).Native(true).Size(1400).CheckPacket(); err != nil {
+		t.Fatalf("the native backend takes --size: expected no error, got %v", err)
+	}
+
+	lines := []struct {
+		line     string
+		expected string
+	}{
+		{"From 10.0.0.1 icmp_seq=3 Frag needed and DF set (mtu = 1400)", "seq 3 fragmentation: Frag needed and DF set (mtu = 1400)"},
+		{"From router.lan (10.0.0.1) icmp_seq=4 Frag needed and DF set (mtu = 1400)", "seq 4 fragmentation: Frag needed and DF set (mtu = 1400)"},
+		{"From 2001:db8::1 icmp_seq=5 Packet too big: mtu=1280", "seq 5 fragmentation: Packet too big: mtu=1280"},
+	}
+	for _, c := range lines {
+		actual := "not parsed"
+		if result, err := ParseLine(c.line); err == nil && result.Lost {
+			actual = fmt.Sprintf("seq %d %s: %s", result.Seq, result.Reason, result.Error)
+		}
+		if actual != c.expected {
+			t.Fatalf("%s: expected %q, got %q", c.line, c.expected, actual)
+		}
+	}
+	if matches := LOCAL_MTU_LINE.FindStringSubmatch("ping: local error: message too long, mtu=1500"); matches == nil || matches[1] != "1500" {
+		t.Fatalf("iputils refusing to send a probe too big for the interface is seen: expected mtu 1500, got %v", matches)
+	}
+
+	token := NewToken()
+	v4, v6 := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")
+	request := icmpPacket(ipv4.ICMPTypeEcho, &icmp.Echo{ID: 1234, Seq: 7, Data: EncodePayload(token, 7, 1400)})
+	fragNeeded, _ := (&icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: ICMP_FRAG_NEEDED, Body: &icmp.RawBody{Data: append([]byte{0, 0, 0x05, 0x78}, quotedIP(ICMP_PROTOCOL, v4, request)...)}}).Marshal(nil)
+	request6 := icmpPacket(ipv6.ICMPTypeEchoRequest, &icmp.Echo{ID: 1234, Seq: 7, Data: EncodePayload(token, 7, 1400)})
+	tooBig := icmpPacket(ipv6.ICMPTypePacketTooBig, &icmp.PacketTooBig{MTU: 1280, Data: quotedIP(ICMPV6_PROTOCOL, v6, request6)})
+	natives := []struct {
+		name     string
+		addr     netip.Addr
+		packet   []byte
+		expected string
+	}{
+		{"frag needed", v4, fragNeeded, "too big for the path, mtu 1400"},
+		{"IPv6's packet too big", v6, tooBig, "too big for the path, mtu 1280"},
+	}
+	for _, c := range natives {
+		matcher := NewMatcher(token, c.addr, 1234, true)
+		results := matcher.Await(7, 7)
+		if class := matcher.Packet(c.packet, 57, time.Now()); class != REPLY_OK {
+			t.Fatalf("%s quoting our request is ours: expected ok, got %q", c.name, class.String())
+		}
+		if result := <-results; !result.Lost || result.Reason != LOSS_FRAGMENTATION || result.Error != c.expected {
+			t.Fatalf("%s settles the probe as too big: expected lost to fragmentation: %q, got %+v", c.name, c.expected, result)
+		}
+	}
+}
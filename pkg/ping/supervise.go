@@ -0,0 +1,204 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+const (
+	MAX_RESTARTS       = 3
+	RESTART_WINDOW     = time.Minute
+	RESTART_DELAY      = time.Second
+	RESTART_DELAY_MAX  = 30 * time.Second
+	NOTICE_BUFFER_SIZE = 16
+)
+
+// Notice reports something the prober did on its own, such as restarting or
+// switching backend, so that it can be logged as an event.
+type Notice struct {
+	Kind    string
+	Message string
+}
+
+type backend struct {
+	name string
+	run  func(p *Pinger, ctx context.Context, epoch int, pings chan Result, beat func()) error
+}
+
+// BACKENDS are tried in order of preference, unless the native one is asked
+// for or there's no system ping to run.
+var BACKENDS = []backend{
+	{name: "exec", run: (*Pinger).runStream},
+	{name: "exec-once", run: (*Pinger).runEach},
+	{name: "native", run: (*Pinger).runNative},
+}
+
+// icmp reports whether the pinger sends echo requests, rather than probing
+// over tcp, udp, http or dns.
+func (p *Pinger) icmp() bool {
+	return p.port == 0 && p.udpPort == 0 && p.http == nil && p.dns == nil
+}
+
+// backends orders BACKENDS for this pinger. TCP, UDP, HTTP and DNS probing
+// have just the one each.
+func (p *Pinger) backends() []backend {
+	if p.dns != nil {
+		return []backend{{name: "dns", run: (*Pinger).runDNS}}
+	}
+	if p.http != nil {
+		return []backend{{name: "http", run: (*Pinger).runHTTP}}
+	}
+	if p.port > 0 {
+		return []backend{{name: "tcp", run: (*Pinger).runTCP}}
+	}
+	if p.udpPort > 0 {
+		return []backend{{name: "udp", run: (*Pinger).runUDP}}
+	}
+
+	native := BACKENDS[len(BACKENDS)-1]
+	if _, err := exec.LookPath("ping"); err != nil {
+		return []backend{native}
+	}
+
+	if p.native {
+		return append([]backend{native}, BACKENDS[:len(BACKENDS)-1]...)
+	}
+	// Only the system ping can set don't-fragment.
+	if p.dontFragment {
+		return BACKENDS[:len(BACKENDS)-1]
+	}
+
+	return BACKENDS
+}
+
+// Failover controls whether a backend that keeps dying is replaced with the
+// next one, rather than restarted until the run gives up.
+func (p *Pinger) Failover(enabled bool) *Pinger {
+	p.failover = enabled
+	return p
+}
+
+// Backend names the backend probing starts with.
+func (p *Pinger) Backend() string {
+	if p.resolveEach && p.icmp() {
+		return "exec-once"
+	}
+
+	return p.backends()[0].name
+}
+
+func (p *Pinger) Notices() <-chan Notice {
+	return p.notices
+}
+
+func (p *Pinger) notify(kind string, message string) {
+	select {
+	case p.notices <- Notice{Kind: kind, Message: message}:
+	default:
+	}
+}
+
+// Fatal is whether the pinger gave up for a reason running it again won't
+// change: no permission to probe whichever way it tried, no address in the
+// family asked for, or none to send from.
+func Fatal(err error) bool {
+	var permErr *PermissionError
+	var familyErr *FamilyError
+	var bindErr *BindError
+	return errors.As(err, &permErr) || errors.As(err, &familyErr) || errors.As(err, &bindErr)
+}
+
+// supervise restarts the current backend when it exits, or when the watchdog
+// kills it for going quiet, backing off from RESTART_DELAY, and stops it
+// while paused. Each start is a new
+// epoch, carried on from the last run if the pinger is run again, since
+// sequence numbers begin again with every process. Too many
+// restarts within RESTART_WINDOW, or a permission error, move on to the next
+// backend, and an error is only returned once there is none left.
+func (p *Pinger) supervise(ctx context.Context, pings chan Result) error {
+	backends := p.backends()
+	current := 0
+	var restarts []time.Time
+
+	if err := p.awaitResolved(ctx); err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	for {
+		if !p.waitResumed(ctx) {
+			return nil
+		}
+
+		p.epoch++
+		epoch := p.epoch
+		p.setRunning(backends[current].name)
+		runCtx, stop := p.runContext(ctx)
+		err := Watch(runCtx, p.watchdogTimeout(), func(ctx context.Context, beat func()) error {
+			return backends[current].run(p, ctx, epoch, pings, beat)
+		})
+		paused := runCtx.Err() != nil
+		stop()
+		if ctx.Err() != nil {
+			return nil
+		}
+		// A backend stopped by Pause, or to change its rate, hasn't failed.
+		if paused || errors.Is(err, errRepaced) {
+			continue
+		}
+
+		now := time.Now()
+		recent := restarts[:0]
+		for _, at := range restarts {
+			if now.Sub(at) < RESTART_WINDOW {
+				recent = append(recent, at)
+			}
+		}
+		restarts = append(recent, now)
+
+		// A terminal's ctrl+c reaches ping too, so wait before reporting in
+		// case the context is about to be cancelled.
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(RESTART_DELAY):
+		}
+
+		var permErr *PermissionError
+		if len(restarts) <= MAX_RESTARTS && !errors.As(err, &permErr) {
+			delay := RestartDelay(len(restarts))
+			if errors.Is(err, ErrStalled) {
+				p.notify("stall", fmt.Sprintf("critical: %s backend %s, killed and restarting it in %s", backends[current].name, err, delay))
+			} else {
+				p.notify("restart", fmt.Sprintf("%s backend stopped (%s), restarting in %s", backends[current].name, err, delay))
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay - RESTART_DELAY):
+			}
+		} else if p.failover && current+1 < len(backends) {
+			p.notify("failover", fmt.Sprintf("%s backend failed (%s), switching to %s", backends[current].name, err, backends[current+1].name))
+			current++
+			restarts = nil
+		} else {
+			return err
+		}
+	}
+}
+
+// RestartDelay is how long the attempt-th restart in a row waits, doubling
+// from RESTART_DELAY up to RESTART_DELAY_MAX.
+func RestartDelay(attempt int) time.Duration {
+	delay := RESTART_DELAY
+	for range attempt - 1 {
+		if delay >= RESTART_DELAY_MAX/2 {
+			return RESTART_DELAY_MAX
+		}
+		delay *= 2
+	}
+
+	return delay
+}
@@ -0,0 +1,101 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const LOSS_REFUSED = "refused"
+
+// TCP makes the pinger time TCP handshakes to port instead of sending echo
+// requests, for networks that block ICMP. Zero keeps it pinging.
+func (p *Pinger) TCP(port int) *Pinger {
+	p.port = port
+	return p
+}
+
+// runTCP connects once per interval, closing each connection as soon as it's
+// made. A refused connection or one that times out is a lost probe, not a
+// failure: the backend only stops if the host has never resolved. The host
+// is looked up once per start, so that the handshake is all that's timed,
+// unless every probe is to resolve it afresh.
+func (p *Pinger) runTCP(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	address := ""
+	if !p.resolveEach {
+		addr, err := p.lookup(ctx)
+		if err != nil {
+			return err
+		}
+		address = addr.String()
+	}
+
+	ticker := p.pace(ctx)
+	defer ticker.Stop()
+	defer p.probes.Wait()
+
+	seq := 0
+	for {
+		probe := seq + 1
+		if p.probes.Launch(func() {
+			result := p.connect(ctx, address)
+			beat()
+			if ctx.Err() != nil {
+				return
+			}
+			result.Epoch = epoch
+			result.Seq = probe
+			p.deliver(pings, result)
+		}) {
+			seq = probe
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pinger) connect(ctx context.Context, address string) Result {
+	var result Result
+	if address == "" {
+		start := time.Now()
+		addr, err := p.lookup(ctx)
+		result.DNS = time.Since(start)
+		if err != nil {
+			return Result{Lost: true, Reason: LOSS_UNREACHABLE, DNS: result.DNS}
+		}
+		address = addr.String()
+	}
+
+	dialer := net.Dialer{Timeout: p.probeTimeout()}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(p.port)))
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Lost = true
+		result.Reason = tcpLoss(err)
+		return result
+	}
+	conn.Close()
+
+	return result
+}
+
+// tcpLoss says how a connection failed, in the terms of the loss lines ping
+// prints.
+func tcpLoss(err error) string {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return LOSS_REFUSED
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return LOSS_UNREACHABLE
+	default:
+		return LOSS_TIMEOUT
+	}
+}
@@ -0,0 +1,248 @@
+package ping
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// UDP_PROBE_SIZE is the token, the sample index and the send time in
+	// unix nanoseconds, which the reflector sends back as they came.
+	UDP_PROBE_SIZE = PAYLOAD_SIZE + 8
+	// UDP_SETTLED is how many of the latest probes settled are remembered,
+	// so that a reply arriving for one can be told late from duplicated.
+	UDP_SETTLED = 1024
+	// UDP_READ_FAILURES is how many reads in a row may fail before the
+	// socket is given up on.
+	UDP_READ_FAILURES = 16
+)
+
+// UDP makes the pinger time echoes of datagrams sent to port, where
+// network-test reflect is running, instead of sending echo requests. Zero
+// keeps it pinging.
+func (p *Pinger) UDP(port int) *Pinger {
+	p.udpPort = port
+	return p
+}
+
+// EncodeProbe is a udp probe with the sample index given, sent at sent,
+// padded to size.
+func EncodeProbe(token Token, index int64, sent time.Time, size int) []byte {
+	probe := EncodePayload(token, index, max(size, UDP_PROBE_SIZE))
+	binary.BigEndian.PutUint64(probe[PAYLOAD_SIZE:], uint64(sent.UnixNano()))
+	return probe
+}
+
+// udpMatcher hands the echoes the udp backend reads to the probes they
+// answer, by the token and index they carry. Whatever address an echo comes
+// from, it's the token that says it's ours, since a NAT on either side may
+// have moved the reflector's replies to another port.
+type udpMatcher struct {
+	token Token
+
+	mu      sync.Mutex
+	waiting map[int64]*nativeProbe
+	// settled are the latest probes that were answered, true, or given up
+	// on, false.
+	settled map[int64]bool
+}
+
+func newUDPMatcher(token Token) *udpMatcher {
+	return &udpMatcher{token: token, waiting: map[int64]*nativeProbe{}, settled: map[int64]bool{}}
+}
+
+// Await registers the probe with the given sample index as sent at sent,
+// for the result it gets until Done.
+func (m *udpMatcher) Await(index int64, seq int, sent time.Time) <-chan Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	probe := &nativeProbe{seq: seq, sent: sent, reply: make(chan Result, 1)}
+	m.waiting[index] = probe
+	return probe.reply
+}
+
+// Done settles the probe, as given up on unless it was answered.
+func (m *udpMatcher) Done(index int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.waiting[index]; ok {
+		delete(m.waiting, index)
+		m.settle(index, false)
+	}
+}
+
+func (m *udpMatcher) settle(index int64, answered bool) {
+	m.settled[index] = answered
+	delete(m.settled, index-UDP_SETTLED)
+}
+
+// Packet matches an echo read at the given time to the probe it answers,
+// reporting how it was classed. The latency is timed from when the probe
+// was sent by this side's clock, the time in the echo only having to agree.
+func (m *udpMatcher) Packet(packet []byte, at time.Time) ReplyClass {
+	if len(packet) < UDP_PROBE_SIZE {
+		return REPLY_MALFORMED
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, class := ClassifyReply(packet, m.token, func(index int64) bool { return m.waiting[index] != nil })
+	switch {
+	case class == REPLY_UNEXPECTED:
+		answered, ok := m.settled[index]
+		switch {
+		case ok && answered:
+			return REPLY_DUPLICATE
+		case ok:
+			return REPLY_LATE
+		}
+		return REPLY_UNEXPECTED
+	case class != REPLY_OK:
+		return class
+	}
+
+	probe := m.waiting[index]
+	if int64(binary.BigEndian.Uint64(packet[PAYLOAD_SIZE:])) != probe.sent.UnixNano() {
+		return REPLY_MALFORMED
+	}
+
+	delete(m.waiting, index)
+	m.settle(index, true)
+	answer(probe, Result{Seq: probe.seq, Duration: at.Sub(probe.sent), At: at})
+
+	return REPLY_OK
+}
+
+// runUDP sends a datagram to the reflector every interval over a socket of
+// its own, left unconnected so that echoes are taken from whatever address
+// they come back from. A probe with no echo by its timeout is lost. As over
+// tcp, the host is looked up once per start unless every probe is to
+// resolve it afresh.
+func (p *Pinger) runUDP(ctx context.Context, epoch int, pings chan Result, beat func()) error {
+	var addr netip.Addr
+	if !p.resolveEach {
+		var err error
+		addr, err = p.lookup(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return fmt.Errorf("failed to open a udp socket: %s", err)
+	}
+	defer p.probes.Wait()
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	matcher := newUDPMatcher(NewToken())
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- p.readEchoes(conn, matcher, beat)
+	}()
+
+	ticker := p.pace(ctx)
+	defer ticker.Stop()
+
+	var index int64
+	for {
+		next := index + 1
+		if p.probes.Launch(func() {
+			result := p.echo(ctx, conn, matcher, addr, next)
+			beat()
+			if ctx.Err() != nil {
+				return
+			}
+			result.Epoch = epoch
+			p.deliver(pings, result)
+		}) {
+			index = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return fmt.Errorf("failed to read udp echo: %s", err)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pinger) echo(ctx context.Context, conn *net.UDPConn, matcher *udpMatcher, addr netip.Addr, index int64) Result {
+	seq := int(index)
+	var dns time.Duration
+	if !addr.IsValid() {
+		start := time.Now()
+		var err error
+		addr, err = p.lookup(ctx)
+		dns = time.Since(start)
+		if err != nil {
+			return Result{Seq: seq, Lost: true, Reason: LOSS_UNREACHABLE, DNS: dns}
+		}
+	}
+
+	destination, err := net.ResolveUDPAddr("udp", net.JoinHostPort(addr.String(), strconv.Itoa(p.udpPort)))
+	if err != nil {
+		return Result{Seq: seq, Lost: true, Reason: LOSS_UNREACHABLE, DNS: dns, Error: err.Error()}
+	}
+
+	sent := time.Now()
+	reply := matcher.Await(index, seq, sent)
+	defer matcher.Done(index)
+	if _, err := conn.WriteToUDP(EncodeProbe(matcher.token, index, sent, p.size), destination); err != nil {
+		return Result{Seq: seq, Lost: true, Reason: tcpLoss(err), DNS: dns, Error: err.Error()}
+	}
+
+	result := Result{Seq: seq, Lost: true, Reason: LOSS_TIMEOUT}
+	select {
+	case result = <-reply:
+	case <-time.After(p.probeTimeout()):
+	case <-ctx.Done():
+	}
+	result.DNS = dns
+
+	return result
+}
+
+// readEchoes hands the echoes read to the probes they answer, and counts
+// those kept out of the results.
+func (p *Pinger) readEchoes(conn *net.UDPConn, matcher *udpMatcher, beat func()) error {
+	buffer := make([]byte, MAX_PACKET_SIZE)
+	failures := 0
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		// Windows reports the port unreachable a datagram got back on the
+		// next read, even unconnected, which loses that probe and no more.
+		if err != nil && !errors.Is(err, net.ErrClosed) && failures < UDP_READ_FAILURES {
+			failures++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		failures = 0
+
+		switch class := matcher.Packet(buffer[:n], time.Now()); class {
+		case REPLY_OK:
+			beat()
+		default:
+			p.mu.Lock()
+			p.ignored.Add(class)
+			p.mu.Unlock()
+		}
+	}
+}
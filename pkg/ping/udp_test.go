@@ -0,0 +1,161 @@
+package ping
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/echo"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+// fakeReflector echoes each datagram to a local UDP port back after delay,
+// as many times as given and from another port, as a reflector behind a NAT
+// that moved it would.
+func fakeReflector(delay time.Duration, times int) (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	rebound, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer rebound.Close()
+		buffer := make([]byte, echo.MAX_UDP_PAYLOAD)
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			packet := slices.Clone(buffer[:n])
+			time.AfterFunc(delay, func() {
+				for range times {
+					rebound.WriteTo(packet, from)
+				}
+			})
+		}
+	}()
+
+	return conn, nil
+}
+
+// TestUDP probes the reflector network-test reflect runs, then fakes
+// that answer from another port, twice over or too late, and checks the
+// reflector's limit on a client sending faster than it allows.
+func TestUDP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if _, err := (target.Target{Mode: target.ICMP, Host: "example.com"}).WithMode(target.UDP); err == nil {
+		t.Fatalf("udp mode needs the reflector's port: expected an error, got accepted")
+	}
+
+	reflector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start the reflector: expected no error, got %v", err)
+	}
+	go echo.ReflectUDP(ctx, reflector, echo.UDPLimits{}, func(string, string, string) {})
+
+	probe := func(conn net.PacketConn, count int) ([]Result, *Pinger) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		pinger := NewPinger("127.0.0.1", 200*time.Millisecond).UDP(conn.LocalAddr().(*net.UDPAddr).Port)
+		pings, _ := pinger.Run(ctx)
+		var results []Result
+		for result := range pings {
+			results = append(results, result)
+			if len(results) == count {
+				break
+			}
+		}
+		return results, pinger
+	}
+
+	results, _ := probe(reflector, 3)
+	if len(results) != 3 {
+		t.Fatalf("probes are echoed by the reflector: expected 3 results, got %v", len(results))
+	}
+	for _, result := range results {
+		if result.Lost || result.Duration <= 0 || result.Duration > time.Second || result.Seq < 1 {
+			t.Fatalf("each echo is timed from its own probe: expected a reply under a second, got %+v", result)
+		}
+	}
+
+	rebinding, err := fakeReflector(0, 2)
+	if err != nil {
+		t.Fatalf("start the fake reflector: expected no error, got %v", err)
+	}
+	defer rebinding.Close()
+	results, pinger := probe(rebinding, 3)
+	for _, result := range results {
+		if result.Lost {
+			t.Fatalf("echoes from another port are still ours: expected no loss, got %+v", result)
+		}
+	}
+	if ignored := pinger.Ignored(); ignored.Duplicate == 0 || ignored.Late+ignored.Foreign+ignored.Malformed > 0 {
+		t.Fatalf("an echo repeated is counted as a duplicate and nothing else: expected duplicates only, got %+v", ignored)
+	}
+
+	slow, err := fakeReflector(1500*time.Millisecond, 1)
+	if err != nil {
+		t.Fatalf("start the slow reflector: expected no error, got %v", err)
+	}
+	defer slow.Close()
+	// The first echo comes back half a second after its probe was given up
+	// on, by when the next few have been too.
+	results, pinger = probe(slow, 6)
+	if !results[0].Lost || results[0].Reason != LOSS_TIMEOUT {
+		t.Fatalf("a probe not echoed by its timeout is lost: expected lost to a timeout, got %+v", results[0])
+	}
+	if ignored := pinger.Ignored(); ignored.Late == 0 || ignored.Duplicate > 0 {
+		t.Fatalf("an echo after its probe was given up on is counted late: expected late only, got %+v", ignored)
+	}
+
+	limited, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start the limited reflector: expected no error, got %v", err)
+	}
+	var mu sync.Mutex
+	var logged []string
+	go echo.ReflectUDP(ctx, limited, echo.UDPLimits{PerClient: 2}, func(_ string, _ string, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, message)
+	})
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("open a client socket: expected no error, got %v", err)
+	}
+	defer client.Close()
+	for index := range int64(5) {
+		client.WriteTo(EncodeProbe(NewToken(), index, time.Now(), 0), limited.LocalAddr())
+	}
+	echoes := 0
+	buffer := make([]byte, echo.MAX_UDP_PAYLOAD+8)
+	for {
+		client.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		n, _, err := client.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		if n != UDP_PROBE_SIZE+8 {
+			t.Fatalf("the echo is the datagram with the reflector's time after it: expected %v, got %v", UDP_PROBE_SIZE+8, n)
+		}
+		echoes++
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if echoes != 2 || !slices.ContainsFunc(logged, func(line string) bool { return strings.Contains(line, "over 2 echoes a second") }) {
+		t.Fatalf("the reflector stops echoing a client over its rate, and says so: expected 2 echoes and a line logged, got %d echoes, logged %q", echoes, logged)
+	}
+}
@@ -0,0 +1,67 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const WATCHDOG_INTERVALS = 5
+
+var ErrStalled = errors.New("stalled")
+
+// probeTimeout is how long a single probe is given to answer.
+func (p *Pinger) probeTimeout() time.Duration {
+	return max(p.interval, time.Second)
+}
+
+// watchdogTimeout allows several missed probes plus one probe's timeout, so
+// it grows with the interval. Backends produce output for lost probes too,
+// so an outage alone never trips it.
+func (p *Pinger) watchdogTimeout() time.Duration {
+	return WATCHDOG_INTERVALS*p.interval + p.probeTimeout()
+}
+
+// Watch runs a prober, cancelling it if it goes longer than timeout without
+// calling beat. A prober stopped that way returns ErrStalled, whatever it
+// returned itself.
+func Watch(ctx context.Context, timeout time.Duration, run func(ctx context.Context, beat func()) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	beats := make(chan struct{}, 1)
+	beat := func() {
+		select {
+		case beats <- struct{}{}:
+		default:
+		}
+	}
+
+	var stalled atomic.Bool
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-beats:
+				timer.Reset(timeout)
+			case <-timer.C:
+				stalled.Store(true)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err := run(ctx, beat)
+	if stalled.Load() {
+		return fmt.Errorf("%w: nothing produced for %s", ErrStalled, timeout)
+	}
+
+	return err
+}
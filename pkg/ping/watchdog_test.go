@@ -0,0 +1,53 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWatchdog runs simulated probers under the watchdog: one that
+// wedges after a few results must be stopped soon after the timeout, while
+// one with steady output, or one stopped by its caller, must not be
+// reported as stalled.
+func TestWatchdog(t *testing.T) {
+	timeout := 100 * time.Millisecond
+
+	started := time.Now()
+	err := Watch(context.Background(), timeout, func(ctx context.Context, beat func()) error {
+		for i := 0; i < 3; i++ {
+			beat()
+			time.Sleep(timeout / 4)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrStalled) {
+		t.Fatalf("wedged prober: expected stalled, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*timeout {
+		t.Fatalf("wedged prober stopped within the timeout of its last result: expected under %s, got %q", 2*timeout, elapsed.String())
+	}
+
+	err = Watch(context.Background(), timeout, func(ctx context.Context, beat func()) error {
+		for i := 0; i < 20; i++ {
+			beat()
+			time.Sleep(timeout / 4)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("steady prober: expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout/2)
+	defer cancel()
+	err = Watch(ctx, timeout, func(ctx context.Context, beat func()) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if errors.Is(err, ErrStalled) {
+		t.Fatalf("prober cancelled by its caller: expected not stalled, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package probe
+
+import (
+	"context"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// Prober is what the display takes its results from: the pinger, or anything
+// standing in for it. Run probes until ctx is done or it gives up, closing
+// both channels once it has, the error channel first with why it gave up, if
+// it was anything but being stopped. Run may be called again after that.
+type Prober interface {
+	Run(ctx context.Context) (<-chan ping.Result, <-chan error)
+	Notices() <-chan ping.Notice
+	Pause()
+	Resume()
+}
+
+var _ Prober = (*ping.Pinger)(nil)
@@ -0,0 +1,53 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// HOTSPOT_GATEWAYS are the addresses phones hand out as the gateway when
+// tethering, which are a fair sign of a metered connection where nothing
+// better is known.
+var HOTSPOT_GATEWAYS = map[string]string{
+	"172.20.10.1":  "an iPhone hotspot",
+	"192.168.43.1": "an Android hotspot",
+}
+
+// Metered reports whether the connection over iface is metered, and how
+// that was decided. On linux NetworkManager is asked first; elsewhere, and
+// when it can't say, the gateway is compared with HOTSPOT_GATEWAYS. It is a
+// variable so that callers can substitute a fake.
+var Metered = func(ctx context.Context, iface string, gateway string) (bool, string, error) {
+	if runtime.GOOS == "linux" && iface != "" {
+		if metered, known, err := networkManagerMetered(ctx, iface); err == nil && known {
+			return metered, "NetworkManager says so", nil
+		}
+	}
+
+	if hotspot, ok := HOTSPOT_GATEWAYS[gateway]; ok {
+		return true, fmt.Sprintf("the gateway %s looks like %s", gateway, hotspot), nil
+	}
+
+	return false, "", nil
+}
+
+// networkManagerMetered reads the device's metered flag, which is yes, no or
+// unknown, the first two possibly followed by "(guessed)".
+func networkManagerMetered(ctx context.Context, iface string) (bool, bool, error) {
+	out, err := exec.CommandContext(ctx, "nmcli", "-t", "-g", "GENERAL.METERED", "device", "show", iface).Output()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to ask NetworkManager: %s", err)
+	}
+
+	switch value := strings.TrimSpace(string(out)); {
+	case strings.HasPrefix(value, "yes"):
+		return true, true, nil
+	case strings.HasPrefix(value, "no"):
+		return false, true, nil
+	default:
+		return false, false, nil
+	}
+}
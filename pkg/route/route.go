@@ -0,0 +1,78 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var VPN_PREFIXES = []string{"wg", "tun", "utun", "tap", "ppp", "ipsec"}
+
+var (
+	LINUX_DEV     = regexp.MustCompile(`\bdev (\S+)`)
+	DARWIN_DEV    = regexp.MustCompile(`(?m)^\s*interface: (\S+)$`)
+	ErrNoPlatform = fmt.Errorf("route lookup is not supported on %s", runtime.GOOS)
+)
+
+// Lookup returns the name of the interface the kernel would use to reach the
+// address. A scoped IPv6 address names it itself, after the %. It is a
+// variable so that callers can substitute a fake.
+var Lookup = func(ctx context.Context, address string) (string, error) {
+	if i := strings.LastIndex(address, "%"); i >= 0 {
+		return address[i+1:], nil
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return lookupWith(ctx, LINUX_DEV, "ip", "route", "get", address)
+	case "darwin", "freebsd", "openbsd":
+		return lookupWith(ctx, DARWIN_DEV, "route", "-n", "get", address)
+	default:
+		return "", ErrNoPlatform
+	}
+}
+
+func lookupWith(ctx context.Context, pattern *regexp.Regexp, name string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up route: %s", err)
+	}
+
+	matches := pattern.FindStringSubmatch(string(out))
+	if len(matches) < 2 {
+		return "", fmt.Errorf("unexpected route output: %s", strings.TrimSpace(string(out)))
+	}
+
+	return matches[1], nil
+}
+
+func IsVPN(iface string) bool {
+	for _, prefix := range VPN_PREFIXES {
+		if strings.HasPrefix(iface, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	LINUX_GATEWAY  = regexp.MustCompile(`\bvia (\S+)`)
+	DARWIN_GATEWAY = regexp.MustCompile(`(?m)^\s*gateway: (\S+)$`)
+)
+
+// Gateway returns the address of the default gateway, the first hop for any
+// off-link target. Like Lookup it can be replaced with a fake.
+var Gateway = func(ctx context.Context) (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return lookupWith(ctx, LINUX_GATEWAY, "ip", "route", "show", "default")
+	case "darwin", "freebsd", "openbsd":
+		return lookupWith(ctx, DARWIN_GATEWAY, "route", "-n", "get", "default")
+	default:
+		return "", ErrNoPlatform
+	}
+}
@@ -0,0 +1,78 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var RATE_SPEC = regexp.MustCompile(`^(\d+(?:\.\d+)?)/(s|m|h)$`)
+
+// Sampler picks which hosts to probe on each tick when probing them all is
+// too expensive. Every host is equally likely to be picked on every tick, so
+// per-host loss computed over the probes actually sent stays unbiased.
+type Sampler struct {
+	fraction float64
+	rate     float64
+	carry    float64
+	rng      *rand.Rand
+}
+
+func NewFractionSampler(fraction float64, seed int64) (*Sampler, error) {
+	if fraction <= 0 || fraction > 1 {
+		return nil, fmt.Errorf("sample fraction must be above 0 and at most 1, got %g", fraction)
+	}
+
+	return &Sampler{fraction: fraction, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// NewRateSampler probes a fixed number of hosts per second across the whole
+// set, given as something like "50/s" or "600/m".
+func NewRateSampler(spec string, seed int64) (*Sampler, error) {
+	matches := RATE_SPEC.FindStringSubmatch(spec)
+	if len(matches) < 3 {
+		return nil, fmt.Errorf("failed to parse sample rate %q, expected something like 50/s", spec)
+	}
+
+	count, _ := strconv.ParseFloat(matches[1], 64)
+	unit := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[matches[2]]
+	if count <= 0 {
+		return nil, fmt.Errorf("sample rate must be above zero")
+	}
+
+	return &Sampler{rate: count / unit.Seconds(), rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// Pick returns the indexes of the hosts to probe this tick. Fractional picks
+// carry over between ticks so that the long-run rate is exact.
+func (s *Sampler) Pick(hosts int, tick time.Duration) []int {
+	want := s.carry
+	if s.rate > 0 {
+		want += s.rate * tick.Seconds()
+	} else {
+		want += s.fraction * float64(hosts)
+	}
+
+	count := min(int(want), hosts)
+	s.carry = want - float64(count)
+	if s.carry > float64(hosts) {
+		s.carry = float64(hosts)
+	}
+
+	return s.rng.Perm(hosts)[:count]
+}
+
+// PerHostRate is the expected number of probes each host gets per second.
+func (s *Sampler) PerHostRate(hosts int, tick time.Duration) float64 {
+	if hosts == 0 {
+		return 0
+	}
+
+	if s.rate > 0 {
+		return min(s.rate/float64(hosts), 1/tick.Seconds())
+	}
+
+	return s.fraction / tick.Seconds()
+}
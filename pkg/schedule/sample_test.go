@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestSampling simulates sampled probing of a large host set where a
+// known share of hosts drop 30% of probes, and checks that every host gets its
+// fair share of probes and that loss measured over probes sent is unbiased.
+func TestSampling(t *testing.T) {
+	const hosts, ticks, lossy = 2000, 2000, 100
+
+	sampler, _ := NewFractionSampler(0.1, 1)
+	rng := rand.New(rand.NewSource(2))
+	probes := make([]int, hosts)
+	lost := make([]int, hosts)
+
+	for tick := 0; tick < ticks; tick++ {
+		for _, i := range sampler.Pick(hosts, time.Second) {
+			probes[i]++
+			if i < lossy && rng.Float64() < 0.3 {
+				lost[i]++
+			}
+		}
+	}
+
+	expected := 0.1 * ticks
+	tolerance := 5 * math.Sqrt(expected*0.9)
+	sent, dropped := 0, 0
+	for i := range probes {
+		if math.Abs(float64(probes[i])-expected) > tolerance {
+			t.Fatalf("host %d probe count: expected %.0f ± %.0f, got %v", i, expected, tolerance, probes[i])
+		}
+		if i < lossy {
+			sent += probes[i]
+			dropped += lost[i]
+		}
+	}
+
+	if loss := float64(dropped) / float64(sent); math.Abs(loss-0.3) > 0.01 {
+		t.Fatalf("loss over probed samples: expected 30.0%% ± 1%%, got %.1f%%", loss*100)
+	}
+
+	rated, _ := NewRateSampler("50/s", 1)
+	picked := 0
+	for tick := 0; tick < 100; tick++ {
+		picked += len(rated.Pick(hosts, 300*time.Millisecond))
+	}
+	if picked < 1499 || picked > 1500 {
+		t.Fatalf("fixed rate over 30s: expected 1500 probes, got %v", picked)
+	}
+}
@@ -0,0 +1,169 @@
+package settings
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// Value is a flag's value as the config file gives it, a string or a bare
+// number, which the flag then reads as it would from the command line.
+type Value string
+
+func (v *Value) UnmarshalYAML(node *yaml.Node) error {
+	switch {
+	case node.Kind != yaml.ScalarNode, node.Tag == "!!bool", node.Tag == "!!null":
+		return fmt.Errorf("line %d: expected a string or a number", node.Line)
+	}
+	*v = Value(node.Value)
+
+	return nil
+}
+
+// Profile is a named set of flags for a run made over and over, such as the
+// same hosts at the same interval with the same thresholds. Each field is
+// the flag of the same name, which the command line takes precedence over.
+type Profile struct {
+	Hosts    []string `yaml:"hosts,omitempty"`
+	Mode     Value    `yaml:"mode,omitempty"`
+	Port     Value    `yaml:"port,omitempty"`
+	Interval Value    `yaml:"interval,omitempty"`
+	Window   Value    `yaml:"window,omitempty"`
+	Buckets  Value    `yaml:"buckets,omitempty"`
+
+	Warn     Value `yaml:"warn,omitempty"`
+	Crit     Value `yaml:"crit,omitempty"`
+	WarnLoss Value `yaml:"warn_loss,omitempty"`
+	CritLoss Value `yaml:"crit_loss,omitempty"`
+
+	MaxAvg  Value `yaml:"max_avg,omitempty"`
+	MaxP99  Value `yaml:"max_p99,omitempty"`
+	MaxLoss Value `yaml:"max_loss,omitempty"`
+
+	AlertConsecutiveLoss Value `yaml:"alert_consecutive_loss,omitempty"`
+	AlertWindowLoss      Value `yaml:"alert_window_loss,omitempty"`
+	AlertLossWindow      Value `yaml:"alert_loss_window,omitempty"`
+
+	SLO Value `yaml:"slo,omitempty"`
+
+	Theme   Value `yaml:"theme,omitempty"`
+	Output  Value `yaml:"output,omitempty"`
+	Results Value `yaml:"results,omitempty"`
+}
+
+// Setting is a flag a profile gives, with the values it would be given on
+// the command line, more than one only for a flag that may be repeated.
+type Setting struct {
+	Flag   string
+	Values []string
+}
+
+func (s Setting) String() string {
+	parts := make([]string, len(s.Values))
+	for i, value := range s.Values {
+		parts[i] = fmt.Sprintf("--%s %s", s.Flag, value)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Settings are the flags the profile gives, in the order of its fields.
+func (p Profile) Settings() []Setting {
+	var settings []Setting
+	if len(p.Hosts) > 0 {
+		settings = append(settings, Setting{"host", slices.Clone(p.Hosts)})
+	}
+	for _, field := range []struct {
+		flag  string
+		value Value
+	}{
+		{"mode", p.Mode},
+		{"port", p.Port},
+		{"interval", p.Interval},
+		{"window", p.Window},
+		{"buckets", p.Buckets},
+		{"warn", p.Warn},
+		{"crit", p.Crit},
+		{"warn-loss", p.WarnLoss},
+		{"crit-loss", p.CritLoss},
+		{"max-avg", p.MaxAvg},
+		{"max-p99", p.MaxP99},
+		{"max-loss", p.MaxLoss},
+		{"alert-consecutive-loss", p.AlertConsecutiveLoss},
+		{"alert-window-loss", p.AlertWindowLoss},
+		{"alert-loss-window", p.AlertLossWindow},
+		{"slo", p.SLO},
+		{"theme", p.Theme},
+		{"output", p.Output},
+		{"results", p.Results},
+	} {
+		if field.value != "" {
+			settings = append(settings, Setting{field.flag, []string{string(field.value)}})
+		}
+	}
+
+	return settings
+}
+
+// Unset are the settings for the flags isSet says the command line didn't
+// give, which are all a profile gets to fill in.
+func Unset(settings []Setting, isSet func(flag string) bool) []Setting {
+	var unset []Setting
+	for _, setting := range settings {
+		if !isSet(setting.Flag) {
+			unset = append(unset, setting)
+		}
+	}
+
+	return unset
+}
+
+func (p Profile) check() error {
+	if len(p.Settings()) == 0 {
+		return fmt.Errorf("sets nothing")
+	}
+	for _, host := range p.Hosts {
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("hosts: empty host")
+		}
+	}
+	if p.Mode != "" && !slices.Contains(target.MODES, string(p.Mode)) {
+		return fmt.Errorf("mode: unknown mode %q, expected one of: %s", p.Mode, strings.Join(target.MODES, ", "))
+	}
+	if p.Theme != "" {
+		if _, err := theme.Get(string(p.Theme)); err != nil {
+			return fmt.Errorf("theme: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// ProfileNames are the profiles defined, in order.
+func (f File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Profile is the profile named, or an error saying which there are.
+func (f File) Profile(name string) (Profile, error) {
+	profile, ok := f.Profiles[name]
+	if ok {
+		return profile, nil
+	}
+	if len(f.Profiles) == 0 {
+		return Profile{}, fmt.Errorf("no profile named %q, the config file defines none", name)
+	}
+
+	return Profile{}, fmt.Errorf("no profile named %q, expected one of: %s", name, strings.Join(f.ProfileNames(), ", "))
+}
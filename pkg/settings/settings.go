@@ -0,0 +1,84 @@
+package settings
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const FILE_NAME = "config.yaml"
+
+// File is what the config file holds. Keys it doesn't know fail the load,
+// so that a misspelt setting is noticed rather than silently ignored.
+type File struct {
+	// Keys binds TUI actions to the keys that trigger them, replacing the
+	// defaults for each action named.
+	Keys map[string]KeyList `yaml:"keys,omitempty"`
+	// Profiles are named sets of flags, --profile choosing one.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// KeyList is the keys bound to an action, given as one key or a list of
+// them. An empty list leaves the action unbound.
+type KeyList []string
+
+func (k *KeyList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*k = KeyList{node.Value}
+		return nil
+	}
+
+	var keys []string
+	if err := node.Decode(&keys); err != nil {
+		return fmt.Errorf("line %d: expected a key or a list of keys", node.Line)
+	}
+	*k = keys
+
+	return nil
+}
+
+// DefaultPath is the config file under the XDG config directory, falling
+// back to ~/.config when XDG_CONFIG_HOME isn't set.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find a config directory: %s", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "network-test", FILE_NAME), nil
+}
+
+// Load reads the config file at path. A missing file is an empty config
+// unless it was asked for by name, when it's an error.
+func Load(path string, required bool) (File, error) {
+	var file File
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return file, fmt.Errorf("failed to parse config file %s: %s", path, err)
+	}
+	for _, name := range file.ProfileNames() {
+		if err := file.Profiles[name].check(); err != nil {
+			return file, fmt.Errorf("profile %q in %s: %s", name, path, err)
+		}
+	}
+
+	return file, nil
+}
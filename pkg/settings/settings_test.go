@@ -0,0 +1,235 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		name     string
+		config   string
+		profile  string
+		set      []string
+		expected string
+	}{
+		{
+			name: "a profile gives its flags in order",
+			config: `
+profiles:
+  home:
+    interval: 500ms
+    hosts: [router.local, 1.1.1.1]
+    warn: 30
+`,
+			profile:  "home",
+			expected: "--host router.local --host 1.1.1.1 --interval 500ms --warn 30",
+		},
+		{
+			name: "flags on the command line take precedence",
+			config: `
+profiles:
+  home:
+    hosts: [router.local]
+    interval: 500ms
+    window: 5s
+`,
+			profile:  "home",
+			set:      []string{"interval", "host"},
+			expected: "--window 5s",
+		},
+		{
+			name: "a profile can track an slo",
+			config: `
+profiles:
+  home:
+    hosts: [router.local]
+    slo: 99%<80ms/30d
+`,
+			profile:  "home",
+			expected: "--host router.local --slo 99%<80ms/30d",
+		},
+		{
+			name: "a profile picks a theme, which the command line overrides",
+			config: `
+profiles:
+  home:
+    theme: mono
+    window: 5s
+`,
+			profile:  "home",
+			set:      []string{"theme"},
+			expected: "--window 5s",
+		},
+		{
+			name: "a profile's theme is one there is",
+			config: `
+profiles:
+  home:
+    theme: dark
+`,
+			profile:  "home",
+			expected: `error: profile "home" in`,
+		},
+		{
+			name:     "json is still read, being yaml",
+			config:   `{"profiles": {"home": {"crit": "100ms", "max_p99": 250}}}`,
+			profile:  "home",
+			expected: "--crit 100ms --max-p99 250",
+		},
+		{
+			name: "every flag given leaves the profile nothing",
+			config: `
+profiles:
+  home:
+    crit: 100ms
+`,
+			profile:  "home",
+			set:      []string{"crit"},
+			expected: "",
+		},
+		{
+			name: "an unknown key in a profile is named",
+			config: `
+profiles:
+  home:
+    hosts: [router.local]
+    intervall: 1s
+`,
+			profile:  "home",
+			expected: "error: field intervall not found",
+		},
+		{
+			name: "an unknown key at the top is named",
+			config: `
+profile:
+  home: {}
+`,
+			profile:  "home",
+			expected: "error: field profile not found",
+		},
+		{
+			name: "an unknown profile lists those there are",
+			config: `
+profiles:
+  home:
+    window: 5s
+  office:
+    window: 5s
+`,
+			profile:  "cafe",
+			expected: `error: no profile named "cafe", expected one of: home, office`,
+		},
+		{
+			name:     "an empty file defines no profiles",
+			config:   "",
+			profile:  "home",
+			expected: `error: no profile named "home", the config file defines none`,
+		},
+		{
+			name: "an unknown mode names the profile",
+			config: `
+profiles:
+  home:
+    mode: quic
+`,
+			profile:  "home",
+			expected: `error: profile "home"`,
+		},
+		{
+			name: "a profile setting nothing is refused",
+			config: `
+profiles:
+  home: {}
+`,
+			profile:  "home",
+			expected: `error: profile "home"`,
+		},
+		{
+			name: "a value is a string or a number",
+			config: `
+profiles:
+  home:
+    interval: true
+`,
+			profile:  "home",
+			expected: "error: line 4: expected a string or a number",
+		},
+	}
+
+	for i, tc := range cases {
+		path := filepath.Join(dir, fmt.Sprintf("config-%d.yaml", i))
+		if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+			t.Fatalf("a config file can be written: expected no error, got %v", err)
+		}
+
+		got := ""
+		file, err := Load(path, true)
+		var profile Profile
+		if err == nil {
+			profile, err = file.Profile(tc.profile)
+		}
+		if err != nil {
+			got = "error: " + err.Error()
+		} else {
+			var flags []string
+			for _, setting := range Unset(profile.Settings(), func(flag string) bool { return slices.Contains(tc.set, flag) }) {
+				flags = append(flags, setting.String())
+			}
+			got = strings.Join(flags, " ")
+		}
+
+		if strings.HasPrefix(tc.expected, "error: ") && strings.Contains(got, strings.TrimPrefix(tc.expected, "error: ")) {
+			continue
+		}
+		if got != tc.expected {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{"one key or a list of them", "keys:\n  pause: P\n  quit: [ctrl+q, x]\n", "map[pause:[P] quit:[ctrl+q x]]"},
+		{"an empty list leaves the action unbound", "keys:\n  waterfall: []\n", "map[waterfall:[]]"},
+		{"a key is a key or a list", "keys:\n  quit:\n    key: q\n", "error: line 3: expected a key or a list of keys"},
+	}
+
+	for i, tc := range cases {
+		path := filepath.Join(dir, fmt.Sprintf("keys-%d.yaml", i))
+		if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+			t.Fatalf("a config file can be written: expected no error, got %v", err)
+		}
+
+		file, err := Load(path, true)
+		got := fmt.Sprint(file.Keys)
+		if err != nil {
+			got = "error: " + err.Error()
+		}
+		if strings.HasPrefix(tc.expected, "error: ") && strings.Contains(got, strings.TrimPrefix(tc.expected, "error: ")) {
+			continue
+		}
+		if got != tc.expected {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml"), false); err != nil {
+		t.Fatalf("a missing default config is empty: expected no error, got %v", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml"), true); err == nil {
+		t.Fatalf("a missing config asked for by name fails: expected an error, got none")
+	}
+}
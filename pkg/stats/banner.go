@@ -0,0 +1,76 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunMetadata describes what a run is actually measuring. The startup banner
+// is rendered from it and it is saved with the run's state, so the two
+// always agree.
+type RunMetadata struct {
+	Target       string   `json:"target"`
+	Address      string   `json:"address,omitempty"`
+	Family       string   `json:"family,omitempty"`
+	AddressClass string   `json:"address_class,omitempty"`
+	Mode         string   `json:"mode"`
+	Backend      string   `json:"backend"`
+	IntervalS    float64  `json:"interval_s"`
+	TimeoutMs    int64    `json:"loss_timeout_ms"`
+	PayloadBytes int      `json:"payload_bytes"`
+	DontFragment bool     `json:"dont_fragment,omitempty"`
+	MaxInFlight  int      `json:"max_in_flight"`
+	Headline     string   `json:"headline"`
+	Interface    string   `json:"interface,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	Caveats      []string `json:"caveats,omitempty"`
+	// Addresses are all the host resolved to, Address among them, when it
+	// had more than the one.
+	Addresses []string `json:"addresses,omitempty"`
+	// Build is what was running, for runs saved before they recorded it.
+	Build *BuildInfo `json:"build,omitempty"`
+}
+
+func (r RunMetadata) Banner() []string {
+	target := r.Target
+	if r.Address != "" {
+		about := []string{r.Address}
+		if others := DescribeOthers(r.Address, r.Addresses); others != "" {
+			about = append(about, others)
+		}
+		if r.Family != "" {
+			about = append(about, r.Family)
+		}
+		if r.AddressClass != "" {
+			about = append(about, r.AddressClass)
+		}
+		target += " (" + strings.Join(about, ", ") + ")"
+	}
+	if r.Source != "" {
+		target += " from " + r.Source
+	}
+	if r.Interface != "" {
+		target += " via " + r.Interface
+	}
+
+	payload := ""
+	if r.PayloadBytes > 0 {
+		payload = fmt.Sprintf("%d byte payload, ", r.PayloadBytes)
+		if r.DontFragment {
+			payload = fmt.Sprintf("%d byte payload with don't-fragment set, ", r.PayloadBytes)
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("%-9s %s", "Target:", target),
+		fmt.Sprintf("%-9s %s using the %s backend, every %s, counted lost after %s, %sup to %d in flight",
+			"Probe:", r.Mode, r.Backend, time.Duration(r.IntervalS*float64(time.Second)), time.Duration(r.TimeoutMs)*time.Millisecond, payload, r.MaxInFlight),
+	}
+
+	for _, caveat := range r.Caveats {
+		lines = append(lines, fmt.Sprintf("%-9s %s", "Caveat:", caveat))
+	}
+
+	return lines
+}
@@ -0,0 +1,136 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	AUTO_BUCKETS      = "auto"
+	AUTO_BUCKET_COUNT = 10
+	// AUTO_BUCKET_HEADROOM is how far beyond the fastest and slowest samples
+	// seen fitted buckets reach, so that they aren't refitted for every new
+	// extreme.
+	AUTO_BUCKET_HEADROOM = 2
+)
+
+func MillisecondThresholds(ms ...int64) []time.Duration {
+	thresholds := make([]time.Duration, len(ms))
+	for i, m := range ms {
+		thresholds[i] = time.Duration(m) * time.Millisecond
+	}
+
+	return thresholds
+}
+
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// AutoBuckets fits the histogram's buckets to the latency seen, spread
+// logarithmically from below the fastest sample to beyond the slowest.
+type AutoBuckets struct {
+	low  time.Duration
+	high time.Duration
+	// fitted is set once the first window has been seen, until when the
+	// default buckets are kept.
+	fitted bool
+}
+
+func (a *AutoBuckets) observe(latency time.Duration) {
+	latency = max(latency, time.Microsecond)
+	if a.low == 0 || latency < a.low {
+		a.low = latency
+	}
+	a.high = max(a.high, latency)
+}
+
+// FitThresholds spaces AUTO_BUCKET_COUNT bounds evenly on a log scale
+// between low and high, with headroom either side, each rounded to two
+// significant figures to keep the labels readable.
+func FitThresholds(low time.Duration, high time.Duration) []time.Duration {
+	from := max(float64(low)/AUTO_BUCKET_HEADROOM, float64(time.Microsecond))
+	to := max(float64(high)*AUTO_BUCKET_HEADROOM, from*AUTO_BUCKET_HEADROOM)
+	ratio := math.Pow(to/from, 1/float64(AUTO_BUCKET_COUNT-1))
+
+	var thresholds []time.Duration
+	for i := range AUTO_BUCKET_COUNT {
+		value := from * math.Pow(ratio, float64(i))
+		scale := math.Pow(10, math.Floor(math.Log10(value))-1)
+		threshold := time.Duration(math.Round(value/scale) * scale)
+		if len(thresholds) == 0 || threshold > thresholds[len(thresholds)-1] {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+
+	return thresholds
+}
+
+// rescaleBuckets fits the buckets once the first window is over, and again
+// whenever a sample falls outside them. The histogram is rebuilt from the
+// samples while the window still holds all of them, and otherwise what it
+// already holds is shared out between the new buckets.
+func (s *Stats) rescaleBuckets() {
+	a := s.AutoBuckets
+	current := s.Histogram.Thresholds()
+	if a.high == 0 || a.fitted && a.low >= current[0] && a.high <= current[len(current)-1] {
+		return
+	}
+
+	thresholds := FitThresholds(a.low, a.high)
+	if slices.Equal(thresholds, current) {
+		a.fitted = true
+		return
+	}
+
+	exact := s.Histogram.Total() == len(s.Recent)
+	if !exact {
+		s.Histogram = s.Histogram.Rebin(thresholds, a.high)
+	}
+	s.Rolling = NewHistogram(thresholds)
+	for _, sample := range s.Recent {
+		s.Rolling.Update(sample.Duration)
+	}
+	if exact {
+		s.Histogram = s.Rolling.Clone()
+	}
+
+	verb := "fitted"
+	if a.fitted {
+		verb = "refitted"
+	}
+	a.fitted = true
+	s.AddEvent("buckets", fmt.Sprintf("histogram %s to %s-%s, for latency seen from %s to %s", verb, FormatThreshold(thresholds[0]), FormatThreshold(thresholds[len(thresholds)-1]), FormatLatency(a.low), FormatLatency(a.high)))
+}
+
+// state is h as it's written to files, with its bounds in milliseconds.
+func HistogramStateOf(h *Histogram) HistogramState {
+	thresholds := make([]float64, len(h.Thresholds()))
+	for i, threshold := range h.Thresholds() {
+		thresholds[i] = Milliseconds(threshold)
+	}
+
+	return HistogramState{
+		Thresholds: thresholds,
+		Buckets:    h.Buckets(),
+		Overflow:   h.Overflow(),
+		Total:      h.Total(),
+	}
+}
+
+func (state HistogramState) Bounds() []time.Duration {
+	thresholds := make([]time.Duration, len(state.Thresholds))
+	for i, ms := range state.Thresholds {
+		thresholds[i] = time.Duration(math.Round(ms * float64(time.Millisecond)))
+	}
+
+	return thresholds
+}
+
+// Histogram reads a histogram back, which has to have a count for each of
+// its thresholds.
+func (state HistogramState) Histogram() Histogram {
+	return RestoreHistogram(state.Bounds(), state.Buckets, state.Overflow, state.Total)
+}
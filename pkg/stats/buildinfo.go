@@ -0,0 +1,17 @@
+package stats
+
+import (
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// BuildInfo is what was built and what it can probe with, for bug reports.
+type BuildInfo struct {
+	Version   string               `json:"version"`
+	Revision  string               `json:"revision,omitempty"`
+	Dirty     bool                 `json:"dirty"`
+	GoVersion string               `json:"go_version"`
+	OS        string               `json:"os"`
+	Arch      string               `json:"arch"`
+	Features  []string             `json:"features"`
+	Backends  []ping.BackendStatus `json:"backends"`
+}
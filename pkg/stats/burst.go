@@ -0,0 +1,194 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+const (
+	DEFAULT_BURST_INTERVAL = 200 * time.Millisecond
+	DEFAULT_BURST_TAIL     = time.Minute
+	// ADAPTIVE_HOLD is how long --adaptive probes fast after the last probe
+	// lost or over --warn, before it looks for a clean window to stop at.
+	ADAPTIVE_HOLD = 30 * time.Second
+)
+
+// BurstControl probes faster while an incident is open, and for a tail
+// after the last one closes, for a closer look at exactly the time that
+// matters. With --adaptive it's a probe lost or over --warn that sets it
+// off instead, for a glitch too short to open an incident.
+type BurstControl struct {
+	Interval time.Duration
+	tail     time.Duration
+	Active   bool
+	// until is when the tail runs out, zero while an incident is open.
+	until   time.Time
+	changed time.Time
+	pinger  *ping.Pinger
+	// restarting is set while the prober restarts to change rate, so that
+	// the probes the old one had in flight aren't counted lost.
+	restarting bool
+
+	Adaptive bool
+	// lost and slow are seen since the last check, bad when the last of
+	// either was, and closed when the last window to close started.
+	lost   bool
+	slow   bool
+	bad    time.Time
+	closed time.Time
+}
+
+func NewBurstControl(interval time.Duration, tail time.Duration, normal time.Duration) (*BurstControl, error) {
+	if interval <= 0 || interval >= normal {
+		return nil, fmt.Errorf("--burst-interval must be shorter than the %s --interval", normal)
+	}
+
+	return &BurstControl{Interval: interval, tail: tail}, nil
+}
+
+func NewAdaptiveControl(interval time.Duration, normal time.Duration) (*BurstControl, error) {
+	b, err := NewBurstControl(interval, ADAPTIVE_HOLD, normal)
+	if err != nil {
+		return nil, err
+	}
+	b.Adaptive = true
+
+	return b, nil
+}
+
+// Observe is told each probe's fate, to burst on any lost.
+func (b *BurstControl) Observe(seq int, lost bool) {
+	if lost {
+		b.lost = true
+	}
+}
+
+// weight is what a reply counts for in the averages, the share of the
+// normal interval it stands for, so that a burst's many replies don't
+// outweigh the slower ones either side of it.
+func (s *Stats) weight() float64 {
+	if s.Interval <= 0 {
+		return 1
+	}
+
+	return float64(s.ProbeInterval()) / float64(s.Interval)
+}
+
+// Attach is given the pinger whose rate changes, which may already have
+// to be faster when a resumed run has an incident open.
+func (b *BurstControl) Attach(pinger *ping.Pinger) {
+	if b == nil {
+		return
+	}
+
+	b.pinger = pinger
+	if b.Active {
+		pinger.SetInterval(b.Interval)
+	}
+}
+
+// ProbeInterval is how often probes are being sent.
+func (s *Stats) ProbeInterval() time.Duration {
+	if s.Burst != nil && s.Burst.Active {
+		return s.Burst.Interval
+	}
+
+	return s.Interval
+}
+
+// checkBurst speeds probing up when an incident opens, and slows it down
+// again once the tail after the last one has passed.
+func (s *Stats) checkBurst() {
+	b := s.Burst
+	if b == nil {
+		return
+	}
+
+	now := s.Now()
+	if b.Adaptive {
+		s.checkAdaptive(now)
+		return
+	}
+
+	open := s.ActiveIncidentOf("") != nil
+	switch {
+	case open && !b.Active:
+		b.Active = true
+		b.until = time.Time{}
+		s.setProbeInterval(now, b.Interval, fmt.Sprintf("incident open, probing every %s until %s after it closes", b.Interval, b.tail))
+	case open:
+		b.until = time.Time{}
+	case b.Active && b.until.IsZero():
+		b.until = now.Add(b.tail)
+	case b.Active && !now.Before(b.until):
+		b.Active = false
+		s.setProbeInterval(now, s.Interval, fmt.Sprintf("no incident for %s, back to probing every %s", b.tail, s.Interval))
+	}
+}
+
+// checkAdaptive speeds probing up on a probe lost or over --warn, and
+// slows it down again once ADAPTIVE_HOLD has passed since the last and a
+// whole window has closed clean after it, with no probe from it still
+// awaiting a reply.
+func (s *Stats) checkAdaptive(now time.Time) {
+	b := s.Burst
+	reason := ""
+	switch {
+	case b.lost:
+		reason = "a probe lost"
+	case b.slow:
+		reason = fmt.Sprintf("a reply over the %s --warn", s.Levels.Warn)
+	}
+	b.lost, b.slow = false, false
+
+	switch {
+	case reason != "":
+		b.bad = now
+		b.until = now.Add(b.tail)
+		if !b.Active {
+			b.Active = true
+			s.setProbeInterval(now, b.Interval, fmt.Sprintf("%s, probing every %s until a window is clean", reason, b.Interval))
+		}
+	case b.Active && !now.Before(b.until) && !b.closed.Before(b.bad) && s.Loss.InFlight() == 0:
+		b.Active = false
+		s.setProbeInterval(now, s.Interval, fmt.Sprintf("a whole window clean, back to probing every %s", s.Interval))
+	}
+}
+
+func (s *Stats) setProbeInterval(now time.Time, interval time.Duration, message string) {
+	s.Loss.SetInterval(now, interval)
+	if s.Outages != nil {
+		s.Outages.SetInterval(interval)
+	}
+	if s.RateLimit != nil {
+		s.RateLimit.Reset()
+	}
+	s.Burst.changed = now
+	if s.Burst.pinger != nil {
+		s.Burst.restarting = s.Burst.pinger.SetInterval(interval)
+	}
+	s.AddEvent("rate", message)
+}
+
+// expectedProbes is how many probes should have been sent since from,
+// allowing for the rate having changed since.
+func (s *Stats) expectedProbes(from time.Time, now time.Time) int {
+	interval := s.ProbeInterval()
+	if interval <= 0 {
+		return 0
+	}
+
+	b := s.Burst
+	if b == nil || !b.changed.After(from) {
+		return int(now.Sub(from) / interval)
+	}
+
+	before := b.Interval
+	if b.Active {
+		before = s.Interval
+	}
+
+	return int(b.changed.Sub(from)/before) + int(now.Sub(b.changed)/interval)
+}
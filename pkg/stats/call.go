@@ -0,0 +1,233 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// E_MODEL_R0 is the E-model's rating with every impairment at its ITU-T
+	// G.107 default, which is the best a call over a narrowband handset gets.
+	E_MODEL_R0 = 93.2
+	// E_MODEL_DELAY_KNEE is the one-way delay past which the delay impairment
+	// climbs steeply, in milliseconds.
+	E_MODEL_DELAY_KNEE = 177.3
+
+	DEFAULT_CODEC         = "g711"
+	DEFAULT_JITTER_BUFFER = 40 * time.Millisecond
+)
+
+// Codec is what the E-model needs of a codec: its equipment impairment Ie
+// and robustness to random loss Bpl, from ITU-T G.113 Appendix I, and the
+// delay it adds filling a packet.
+type Codec struct {
+	Name  string
+	Ie    float64
+	Bpl   float64
+	Delay time.Duration
+}
+
+var CODECS = map[string]Codec{
+	// G.711 with packet loss concealment, in 20ms packets.
+	"g711": {Name: "g711", Ie: 0, Bpl: 25.1, Delay: 20 * time.Millisecond},
+	// G.729A in 20ms packets, with its 5ms look-ahead.
+	"g729": {Name: "g729", Ie: 11, Bpl: 19, Delay: 25 * time.Millisecond},
+	// G.723.1 at 6.3kbit/s in 30ms packets, with its 7.5ms look-ahead.
+	"g723": {Name: "g723", Ie: 15, Bpl: 16.1, Delay: 37500 * time.Microsecond},
+}
+
+func ParseCodec(name string) (Codec, error) {
+	codec, ok := CODECS[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(CODECS))
+		for name := range CODECS {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return Codec{}, fmt.Errorf("unknown codec %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+
+	return codec, nil
+}
+
+// RFactor is the simplified E-model's transmission rating for a call with
+// the given one-way delay and loss, as a fraction, taking loss as random.
+// The delay impairment is Cole and Rosenbluth's approximation of G.107's.
+func RFactor(delay time.Duration, loss float64, codec Codec) float64 {
+	d := float64(delay.Microseconds()) / 1000
+	id := 0.024 * d
+	if d > E_MODEL_DELAY_KNEE {
+		id += 0.11 * (d - E_MODEL_DELAY_KNEE)
+	}
+
+	ppl := math.Max(loss, 0) * 100
+	ie := codec.Ie + (95-codec.Ie)*ppl/(ppl+codec.Bpl)
+
+	return E_MODEL_R0 - id - ie
+}
+
+// MOS is the mean opinion score predicted for a G.711 call over a path with
+// the given average round trip, jitter and loss, as a percentage, through an
+// adaptive jitter buffer: half the round trip each way, held up by the
+// buffer and the codec, and impaired by the loss taken as random. It's what
+// --call-quality estimates with its defaults, short of packets arriving too
+// late for the buffer.
+func MOS(avg time.Duration, jitter time.Duration, lossPct float64) float64 {
+	codec := CODECS[DEFAULT_CODEC]
+	return MOSFromR(RFactor(avg/2+jitter+codec.Delay, lossPct/100, codec))
+}
+
+// MOSFromR converts a rating to the mean opinion score it predicts, from 1
+// to 4.5, as G.107 Annex B does.
+func MOSFromR(r float64) float64 {
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+
+	return 1 + 0.035*r + r*(r-60)*(100-r)*7e-6
+}
+
+// CallRating names a rating by the G.107 band of user satisfaction it falls
+// in.
+func CallRating(r float64) string {
+	switch {
+	case r >= 90:
+		return "excellent"
+	case r >= 80:
+		return "good"
+	case r >= 70:
+		return "fair"
+	case r >= 60:
+		return "poor"
+	default:
+		return "bad"
+	}
+}
+
+// CallQuality is the estimate for a call over a window, or the run.
+type CallQuality struct {
+	R   float64
+	MOS float64
+	// Delay is one way, mouth to ear: half the round trip, the jitter buffer
+	// and the codec's own.
+	Delay time.Duration
+	// Loss is of the packets the network lost or the jitter buffer discarded
+	// for arriving too late, and Late of just the latter.
+	Loss float64
+	Late float64
+}
+
+func (q CallQuality) Rating() string {
+	return CallRating(q.R)
+}
+
+type callCounts struct {
+	received int
+	late     int
+}
+
+// CallEstimator scores each window for a call carried over the path, by
+// running what the replies saw through a jitter buffer and the E-model. A
+// buffer of zero is adaptive, sized each window to twice the one-way jitter
+// and so never discarding. A fixed one discards any packet whose delay is
+// more than its size over the fastest seen lately, with each direction taken
+// as half the round trip.
+type CallEstimator struct {
+	codec  Codec
+	buffer time.Duration
+
+	base       time.Duration
+	windowBase time.Duration
+	window     callCounts
+	totals     callCounts
+
+	last   CallQuality
+	scored bool
+}
+
+func NewCallEstimator(codec Codec, buffer time.Duration) *CallEstimator {
+	return &CallEstimator{codec: codec, buffer: buffer}
+}
+
+func (e *CallEstimator) Codec() Codec {
+	return e.codec
+}
+
+func (e *CallEstimator) Buffer() time.Duration {
+	return e.buffer
+}
+
+func (e *CallEstimator) Observe(rtt time.Duration) {
+	if e.windowBase == 0 || rtt < e.windowBase {
+		e.windowBase = rtt
+	}
+	if e.base == 0 || rtt < e.base {
+		e.base = rtt
+	}
+
+	late := e.buffer > 0 && (rtt-e.base)/2 > e.buffer
+	for _, counts := range []*callCounts{&e.window, &e.totals} {
+		counts.received++
+		if late {
+			counts.late++
+		}
+	}
+}
+
+// Window scores the window just ended from its average round trip, jitter
+// and loss, and starts the next one measuring against the fastest reply of
+// this one, so that a path that's got slower isn't all discarded.
+func (e *CallEstimator) Window(avg time.Duration, jitter time.Duration, loss float64) CallQuality {
+	e.last = e.score(avg, jitter, loss, e.window)
+	e.scored = true
+
+	e.window = callCounts{}
+	if e.windowBase > 0 {
+		e.base = e.windowBase
+	}
+	e.windowBase = 0
+
+	return e.last
+}
+
+// Totals scores the run as a whole.
+func (e *CallEstimator) Totals(avg time.Duration, jitter time.Duration, loss float64) CallQuality {
+	return e.score(avg, jitter, loss, e.totals)
+}
+
+func (e *CallEstimator) ResetTotals() {
+	e.totals = callCounts{}
+}
+
+// Last is the score for the last window, once there has been one.
+func (e *CallEstimator) Last() (CallQuality, bool) {
+	return e.last, e.scored
+}
+
+func (e *CallEstimator) score(avg time.Duration, jitter time.Duration, loss float64, counts callCounts) CallQuality {
+	buffer := e.buffer
+	if buffer == 0 {
+		buffer = jitter
+	}
+
+	var late float64
+	if counts.received > 0 {
+		late = float64(counts.late) / float64(counts.received)
+	}
+
+	q := CallQuality{
+		Delay: avg/2 + buffer + e.codec.Delay,
+		Loss:  loss + (1-loss)*late,
+		Late:  late,
+	}
+	q.R = RFactor(q.Delay, q.Loss, e.codec)
+	q.MOS = MOSFromR(q.R)
+
+	return q
+}
@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// CallSummary is a call quality estimate as the summaries and exports carry
+// it.
+type CallSummary struct {
+	MOS     float64 `json:"mos"`
+	R       float64 `json:"r"`
+	Rating  string  `json:"rating"`
+	DelayMs float64 `json:"delay_ms"`
+	LossPct float64 `json:"loss_pct"`
+	LatePct float64 `json:"late_pct"`
+}
+
+func newCallSummary(q CallQuality) *CallSummary {
+	return &CallSummary{
+		MOS:     math.Round(q.MOS*100) / 100,
+		R:       math.Round(q.R*10) / 10,
+		Rating:  q.Rating(),
+		DelayMs: float64(q.Delay.Microseconds()) / 1000,
+		LossPct: q.Loss * 100,
+		LatePct: q.Late * 100,
+	}
+}
+
+// scoreCall scores the window just closed, taking its loss from the loss
+// window ending now.
+func (s *Stats) scoreCall(now time.Time) {
+	var loss float64
+	if s.Loss != nil {
+		loss, _, _ = s.Loss.Rolling(now)
+	}
+
+	s.Call.Window(s.LastWindow.Average(), s.LastWindow.Jitter(), loss)
+}
+
+// LastCall is the last window's estimate, for the window summaries.
+func (s *Stats) LastCall() *CallSummary {
+	if s.Call == nil {
+		return nil
+	}
+
+	q, ok := s.Call.Last()
+	if !ok {
+		return nil
+	}
+
+	return newCallSummary(q)
+}
+
+// CallTotals is the estimate for the run as a whole.
+func (s *Stats) CallTotals() *CallSummary {
+	if s.Call == nil || s.Totals.Count == 0 {
+		return nil
+	}
+
+	var loss float64
+	if s.Loss != nil {
+		loss = s.Loss.Cumulative()
+	}
+
+	return newCallSummary(s.Call.Totals(s.Totals.Average(), s.Totals.Jitter(), loss))
+}
+
+func (s *Stats) PrintCall(t theme.Theme) string {
+	q, ok := s.Call.Last()
+	if !ok {
+		return "Est. call quality: -"
+	}
+
+	buffer := "an adaptive jitter buffer"
+	if s.Call.Buffer() > 0 {
+		buffer = fmt.Sprintf("a %s jitter buffer", FormatLatency(s.Call.Buffer()))
+	}
+
+	line := fmt.Sprintf("Est. call quality: %s (R %.0f, %s with %s, %s one way", renderMOS(t, q.MOS, q.Rating()), q.R, s.Call.Codec().Name, buffer, FormatLatency(q.Delay))
+	if q.Late > 0 {
+		line += fmt.Sprintf(", %.1f%% late", q.Late*100)
+	}
+	line += ")"
+	if totals := s.CallTotals(); totals != nil {
+		line += ", " + renderMOS(t, totals.MOS, totals.Rating) + " over the run"
+	}
+
+	return line
+}
+
+// renderMOS is a score with its rating, coloured by how a call would go.
+func renderMOS(t theme.Theme, mos float64, rating string) string {
+	style := t.Good
+	switch rating {
+	case "fair":
+		style = t.Warn
+	case "poor", "bad":
+		style = t.Bad
+	}
+
+	return style.Render(fmt.Sprintf("%.1f (%s)", mos, rating))
+}
@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCallQuality checks the E-model against the published values:
+// G.107's MOS for a rating and its default rating, and G.113's effective
+// equipment impairment under random loss. It then runs windows through a
+// fixed jitter buffer, checking that packets later than it are discarded.
+func TestCallQuality(t *testing.T) {
+	near := func(actual float64, expected float64, tolerance float64) bool {
+		return math.Abs(actual-expected) <= tolerance
+	}
+
+	// G.107 Annex B: the MOS each rating predicts.
+	for _, c := range []struct{ r, mos float64 }{{0, 1}, {50, 2.58}, {60, 3.10}, {70, 3.60}, {80, 4.02}, {90, 4.34}, {E_MODEL_R0, 4.41}, {100, 4.5}} {
+		if mos := MOSFromR(c.r); !near(mos, c.mos, 0.005) {
+			t.Fatalf("R %.1f converts to the G.107 MOS: expected %.2f, got %.3f", c.r, c.mos, mos)
+		}
+	}
+
+	g711, g729 := CODECS["g711"], CODECS["g729"]
+	if r := RFactor(0, 0, g711); r != E_MODEL_R0 {
+		t.Fatalf("G.711 with no delay or loss rates the G.107 default: expected %v, got %v", E_MODEL_R0, r)
+	}
+	// Ie,eff = Ie + (95 - Ie) * Ppl / (Ppl + Bpl), with G.113's Ie and Bpl.
+	for _, c := range []struct {
+		codec    Codec
+		loss, ie float64
+	}{{g711, 0.01, 3.640}, {g711, 0.05, 15.78}, {g729, 0.02, 19}} {
+		if r := RFactor(0, c.loss, c.codec); !near(E_MODEL_R0-r, c.ie, 0.01) {
+			t.Fatalf("%s at %.0f%% random loss is impaired as G.113 has it: expected %.2f, got %.3f", c.codec.Name, c.loss*100, c.ie, E_MODEL_R0-r)
+		}
+	}
+	// Id = 0.024d, plus 0.11(d - 177.3) past the knee.
+	for _, c := range []struct {
+		delay time.Duration
+		id    float64
+	}{{100 * time.Millisecond, 2.4}, {300 * time.Millisecond, 20.697}} {
+		if r := RFactor(c.delay, 0, g711); !near(E_MODEL_R0-r, c.id, 0.001) {
+			t.Fatalf("%s one way is impaired by the delay: expected %.3f, got %.3f", c.delay, c.id, E_MODEL_R0-r)
+		}
+	}
+	if rating := CallRating(82); rating != "good" {
+		t.Fatalf("R 82 is in G.107's satisfied band: expected good, got %q", rating)
+	}
+
+	e := NewCallEstimator(g711, 40*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		rtt := 20 * time.Millisecond
+		if i%10 == 9 {
+			// 50ms later one way, past the 40ms buffer.
+			rtt = 120 * time.Millisecond
+		}
+		e.Observe(rtt)
+	}
+	q := e.Window(30*time.Millisecond, 0, 0)
+	if !near(q.Late, 0.1, 1e-9) || !near(q.Loss, 0.1, 1e-9) {
+		t.Fatalf("a fixed buffer discards the replies later than it: expected 10%% late and lost, got %.1f%% late, %.1f%% lost", q.Late*100, q.Loss*100)
+	}
+	if q.Delay != 15*time.Millisecond+40*time.Millisecond+g711.Delay {
+		t.Fatalf("the delay is half the round trip, the buffer and the codec's: expected 75ms, got %q", q.Delay.String())
+	}
+
+	for i := 0; i < 10; i++ {
+		e.Observe(60 * time.Millisecond)
+	}
+	if q := e.Window(60*time.Millisecond, 0, 0.02); q.Late != 0 || !near(q.Loss, 0.02, 1e-9) {
+		t.Fatalf("a window within the buffer of the fastest reply discards nothing, leaving the network's loss: expected 0%% late, 2%% lost, got %.1f%% late, %.1f%% lost", q.Late*100, q.Loss*100)
+	}
+
+	adaptive := NewCallEstimator(g711, 0)
+	adaptive.Observe(20 * time.Millisecond)
+	adaptive.Observe(200 * time.Millisecond)
+	if q := adaptive.Window(110*time.Millisecond, 30*time.Millisecond, 0); q.Late != 0 || q.Delay != 55*time.Millisecond+30*time.Millisecond+g711.Delay {
+		t.Fatalf("an adaptive buffer is sized to the jitter and discards nothing: expected 0%% late, 105ms one way, got %.1f%% late, %s one way", q.Late*100, q.Delay)
+	}
+
+	// The estimate from the average, jitter and loss alone, worked through
+	// by hand from the constants above.
+	for _, c := range []struct {
+		avg, jitter time.Duration
+		lossPct     float64
+		mos         float64
+	}{
+		{20 * time.Millisecond, 2 * time.Millisecond, 0, 4.394},
+		{20 * time.Millisecond, 2 * time.Millisecond, 1, 4.308},
+		{150 * time.Millisecond, 30 * time.Millisecond, 2, 4.139},
+		{40 * time.Millisecond, 5 * time.Millisecond, 20, 2.575},
+		{600 * time.Millisecond, 100 * time.Millisecond, 10, 1.583},
+	} {
+		if mos := MOS(c.avg, c.jitter, c.lossPct); !near(mos, c.mos, 0.001) {
+			t.Fatalf("MOS for %s average, %s jitter and %.0f%% loss: expected %.3f, got %.3f", c.avg, c.jitter, c.lossPct, c.mos, mos)
+		}
+	}
+	if q := adaptive.Totals(110*time.Millisecond, 30*time.Millisecond, 0.02); !near(q.MOS, MOS(110*time.Millisecond, 30*time.Millisecond, 2), 1e-9) {
+		t.Fatalf("MOS agrees with the default estimate: expected %.3f, got %.3f", MOS(110*time.Millisecond, 30*time.Millisecond, 2), q.MOS)
+	}
+
+	if _, err := ParseCodec("speex"); err == nil || !strings.Contains(err.Error(), "g711, g723, g729") {
+		t.Fatalf("an unknown codec lists the known ones: expected an error naming g711, g723, g729, got %v", err)
+	}
+}
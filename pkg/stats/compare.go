@@ -0,0 +1,10 @@
+package stats
+
+import (
+	"math"
+	"time"
+)
+
+func FromMilliseconds(ms float64) time.Duration {
+	return time.Duration(math.Round(ms * float64(time.Millisecond)))
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// dnsServer is how one of the servers being rotated between has done.
+type dnsServer struct {
+	latency Window
+	lost    int
+}
+
+// observeDNS tallies answers by rcode and by the server asked, logging an
+// event when queries start failing a new way or recover.
+func (s *Stats) observeDNS(result ping.Result) {
+	if s.servers == nil {
+		s.servers = map[string]*dnsServer{}
+		s.rcodes = map[string]int{}
+	}
+	server, ok := s.servers[result.Server]
+	if !ok {
+		server = &dnsServer{}
+		s.servers[result.Server] = server
+	}
+
+	if result.Lost {
+		server.lost++
+	} else {
+		server.latency.Update(result.Duration)
+	}
+
+	switch {
+	case result.Rcode != "":
+		s.rcodes[result.Rcode]++
+		if result.Lost {
+			s.noteFailure("dns", result.Error+" from "+result.Server)
+		} else {
+			s.noteFailure("dns", "")
+		}
+	case result.Reason == ping.LOSS_ERROR:
+		s.requestErrors++
+		s.noteFailure("dns", result.Error)
+	}
+}
+
+// PrintDNS tallies answers by rcode, then compares the servers asked.
+func (s *Stats) PrintDNS(t theme.Theme) string {
+	if len(s.servers) == 0 {
+		return "DNS: no answers yet"
+	}
+
+	var rcodes []string
+	for rcode := range s.rcodes {
+		rcodes = append(rcodes, rcode)
+	}
+	sort.Strings(rcodes)
+
+	var parts []string
+	for _, rcode := range rcodes {
+		part := fmt.Sprintf("%s x%d", rcode, s.rcodes[rcode])
+		if rcode != "NOERROR" {
+			part = t.Bad.Render(part)
+		}
+		parts = append(parts, part)
+	}
+	if s.requestErrors > 0 {
+		parts = append(parts, t.Bad.Render(fmt.Sprintf("%d failed queries", s.requestErrors)))
+	}
+
+	line := "DNS: " + strings.Join(parts, ", ")
+	if s.lastFailure != "" {
+		line += t.Bad.Render(" (failing: " + s.lastFailure + ")")
+	}
+	lines := []string{line}
+
+	var names []string
+	for name := range s.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > 1 {
+		for _, name := range names {
+			server := s.servers[name]
+			lines = append(lines, fmt.Sprintf("  %-22s %s, %d lost", name, RenderWindow(&server.latency, nil, nil), server.lost))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,134 @@
+package stats
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// fakeDNS answers queries for ok.test, fails broken.test and says nothing
+// else exists, from a local UDP port.
+func fakeDNS() (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err := query.Unpack(buffer[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+
+			reply := dnsmessage.Message{Header: dnsmessage.Header{ID: query.ID, Response: true}, Questions: query.Questions}
+			switch query.Questions[0].Name.String() {
+			case "ok.test.":
+				reply.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+					Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+				}}
+			case "broken.test.":
+				reply.RCode = dnsmessage.RCodeServerFailure
+			default:
+				reply.RCode = dnsmessage.RCodeNameError
+			}
+
+			if packet, err := reply.Pack(); err == nil {
+				conn.WriteTo(packet, from)
+			}
+		}
+	}()
+
+	return conn, nil
+}
+
+// TestDNS queries a fake server for names that resolve, fail and
+// don't exist, and rotates between it and a server that never answers,
+// checking each comes back as a reply or a loss with its rcode, per server.
+func TestDNS(t *testing.T) {
+	server, err := fakeDNS()
+	if err != nil {
+		t.Fatalf("start fake DNS server: expected no error, got %v", err)
+	}
+	defer server.Close()
+
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start silent DNS server: expected no error, got %v", err)
+	}
+	defer silent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cases := map[string][]string{
+		"ok.test":      {server.LocalAddr().String(), silent.LocalAddr().String()},
+		"broken.test":  {server.LocalAddr().String()},
+		"missing.test": {server.LocalAddr().String()},
+	}
+
+	var mu sync.Mutex
+	results := map[string][]ping.Result{}
+	var wg sync.WaitGroup
+	for host, servers := range cases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pings, _ := ping.NewPinger(host, time.Second).DNS(ping.DNSOptions{Record: "A", Servers: servers}).Run(ctx)
+			var got []ping.Result
+			for result := range pings {
+				got = append(got, result)
+				if len(got) == len(servers) {
+					break
+				}
+			}
+			mu.Lock()
+			results[host] = got
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for host, servers := range cases {
+		if len(results[host]) != len(servers) {
+			t.Fatalf("results for %s: expected %v, got %v", host, len(servers), len(results[host]))
+		}
+	}
+
+	rotated := results["ok.test"]
+	if answered := rotated[0]; answered.Lost || answered.Rcode != "NOERROR" || answered.Server != server.LocalAddr().String() {
+		t.Fatalf("a query the first server answers: expected NOERROR from %q, got %+v", server.LocalAddr().String(), answered)
+	}
+	if unanswered := rotated[1]; !unanswered.Lost || unanswered.Reason != ping.LOSS_TIMEOUT || unanswered.Server != silent.LocalAddr().String() {
+		t.Fatalf("the next query, to the silent server: expected a timeout from %q, got %+v", silent.LocalAddr().String(), unanswered)
+	}
+	if broken := results["broken.test"][0]; !broken.Lost || broken.Reason != ping.LOSS_RCODE || broken.Error != "SERVFAIL" {
+		t.Fatalf("a failing name: expected lost with SERVFAIL, got %+v", broken)
+	}
+	if missing := results["missing.test"][0]; !missing.Lost || missing.Error != "NXDOMAIN" {
+		t.Fatalf("a missing name: expected lost with NXDOMAIN, got %+v", missing)
+	}
+
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	for _, result := range append(rotated, results["broken.test"][0]) {
+		s.Observe(result)
+	}
+	view := s.PrintDNS(theme.Theme{})
+	if !strings.Contains(view, "NOERROR x1, SERVFAIL x1") || strings.Count(view, "\n") != 2 || s.servers[silent.LocalAddr().String()].lost != 1 {
+		t.Fatalf("the dns view: expected rcode tallies and a line per server, got %q", view)
+	}
+}
@@ -0,0 +1,21 @@
+package stats
+
+import (
+	"strings"
+)
+
+// DescribeOthers lists the candidates besides the address probed, for the
+// header and the banner.
+func DescribeOthers(address string, candidates []string) string {
+	var others []string
+	for _, candidate := range candidates {
+		if candidate != address {
+			others = append(others, candidate)
+		}
+	}
+	if len(others) == 0 {
+		return ""
+	}
+
+	return "also " + strings.Join(others, " ")
+}
@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatLatency scales to µs, ms or s and keeps roughly three significant
+// figures, so that values stay readable and columns don't jitter.
+func FormatLatency(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.0fµs", float64(d)/float64(time.Microsecond))
+	case d < 10*time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	case d < 100*time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.0fms", float64(d)/float64(time.Millisecond))
+	case d < 10*time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	default:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+}
+
+// FormatThreshold is a bucket's bound in milliseconds, as precisely as it
+// was given, such as 0.5ms or 100ms.
+func FormatThreshold(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64) + "ms"
+}
+
+// RenderWindow is w's min, max, average, deviation and jitter, each padded
+// to its column. A style given has the average, padded, passed through it,
+// and a clock given has when the min and max were after them.
+func RenderWindow(w *Window, style func(avg time.Duration, text string) string, clock func(time.Time) string) string {
+	if w.Count == 0 {
+		return fmt.Sprintf("Min: %8s, Max: %8s, Avg: %8s, SD: %8s, Jitter: %8s", "-", "-", "-", "-", "-")
+	}
+
+	extreme := func(d time.Duration, at time.Time) string {
+		text := fmt.Sprintf("%8s", FormatLatency(d))
+		if clock != nil && !at.IsZero() {
+			text += " at " + clock(at)
+		}
+		return text
+	}
+	avg := w.Average()
+	text := fmt.Sprintf("%8s", FormatLatency(avg))
+	if style != nil {
+		text = style(avg, text)
+	}
+
+	return fmt.Sprintf("Min: %s, Max: %s, Avg: %s, SD: %8s, Jitter: %8s", extreme(w.Min, w.MinAt), extreme(w.Max, w.MaxAt), text, FormatLatency(w.StdDev()), FormatLatency(w.Jitter()))
+}
+
+// Bar draws bucket i of h scaled so the fullest bucket spans width cells,
+// along with the percentage of all samples that landed in it.
+func Bar(h *Histogram, i int, width int) (string, float64) {
+	if h.Total() == 0 {
+		return strings.Repeat(" ", width), 0
+	}
+
+	length := h.Scaled(i, width)
+	return strings.Repeat("█", length) + strings.Repeat(" ", width-length), h.Share(i) * 100
+}
+
+// RenderHistogram is a row for each of h's buckets, labelled by its bound,
+// its bar width cells at the longest, and the overflow's once anything's in
+// it.
+func RenderHistogram(h *Histogram, width int) []string {
+	thresholds := h.Thresholds()
+	buckets := len(thresholds)
+	if h.Overflow() > 0 {
+		buckets++
+	}
+
+	lines := make([]string, 0, buckets)
+	for i := range buckets {
+		label := ">" + FormatThreshold(thresholds[len(thresholds)-1])
+		if i < len(thresholds) {
+			label = FormatThreshold(thresholds[i])
+		}
+		bar, percent := Bar(h, i, width)
+		lines = append(lines, fmt.Sprintf("%7s : %s %6.2f%%", label, bar, percent))
+	}
+
+	return lines
+}
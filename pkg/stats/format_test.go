@@ -0,0 +1,71 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFormatLatency(t *testing.T) {
+	cases := []struct {
+		latency  time.Duration
+		expected string
+	}{
+		{0, "0µs"},
+		{350 * time.Microsecond, "350µs"},
+		{time.Millisecond, "1.00ms"},
+		{9994 * time.Microsecond, "9.99ms"},
+		{12345 * time.Microsecond, "12.3ms"},
+		{123456 * time.Microsecond, "123ms"},
+		{1500 * time.Millisecond, "1.50s"},
+		{12345 * time.Millisecond, "12.3s"},
+	}
+
+	for _, c := range cases {
+		if actual := FormatLatency(c.latency); actual != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.latency, c.expected, actual)
+		}
+	}
+}
+
+// TestRenderWindow renders windows across the ranges a LAN, a broadband
+// line and a satellite link see, and one with nothing in it, checking each
+// column starts in the same place whatever the values.
+func TestRenderWindow(t *testing.T) {
+	windows := []struct {
+		name    string
+		samples []time.Duration
+	}{
+		{"empty", nil},
+		{"loopback", []time.Duration{45 * time.Microsecond, 80 * time.Microsecond, 350 * time.Microsecond}},
+		{"lan", []time.Duration{800 * time.Microsecond, 1200 * time.Microsecond, 2500 * time.Microsecond}},
+		{"broadband", []time.Duration{11 * time.Millisecond, 14 * time.Millisecond, 61 * time.Millisecond}},
+		{"satellite", []time.Duration{580 * time.Millisecond, 650 * time.Millisecond, 1400 * time.Millisecond}},
+		{"stalled", []time.Duration{2 * time.Second, 15 * time.Second}},
+	}
+
+	var lines []string
+	for _, window := range windows {
+		var w Window
+		for _, sample := range window.samples {
+			w.Update(sample)
+		}
+		lines = append(lines, RenderWindow(&w, nil, nil))
+	}
+
+	for _, column := range []string{"Max:", "Avg:", "SD:", "Jitter:"} {
+		at := columnOf(lines[0], column)
+		for i, line := range lines {
+			if actual := columnOf(line, column); actual != at {
+				t.Errorf("%s starts in the same place for the %s window: expected %d, got %d", column, windows[i].name, at, actual)
+			}
+		}
+	}
+	golden(t, "windows", strings.Join(lines, "\n")+"\n")
+}
+
+// columnOf is the terminal column a label starts in.
+func columnOf(line string, label string) int {
+	return utf8.RuneCountInString(line[:strings.Index(line, label)])
+}
@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExitThresholds are what --max-avg, --max-p99 and --max-loss hold the
+// run's totals to once --count or --duration has ended it, a zero one
+// being left unchecked.
+type ExitThresholds struct {
+	MaxAvg  time.Duration
+	MaxP99  time.Duration
+	MaxLoss float64
+}
+
+func (t ExitThresholds) set() bool {
+	return t.MaxAvg > 0 || t.MaxP99 > 0 || t.MaxLoss > 0
+}
+
+// Breached is why the run's totals fail t, naming the first threshold
+// they're over, or nothing when they pass.
+func (s *Stats) Breached(t ExitThresholds) string {
+	if t.MaxLoss > 0 && s.Loss != nil {
+		if loss := s.Loss.Cumulative(); Over(loss, t.MaxLoss) {
+			sent, lost := s.Loss.Settled()
+			return fmt.Sprintf("loss %.2f%% (%d/%d) over the --max-loss of %.2f%%", loss*100, lost, sent, t.MaxLoss*100)
+		}
+	}
+
+	if t.MaxAvg <= 0 && t.MaxP99 <= 0 {
+		return ""
+	}
+	if s.Totals.Count == 0 {
+		return "no replies to measure latency against --max-avg or --max-p99"
+	}
+
+	if avg := s.Totals.Average(); Over(avg, t.MaxAvg) {
+		return fmt.Sprintf("average %s over the --max-avg of %s", FormatLatency(avg), FormatLatency(t.MaxAvg))
+	}
+	if p99 := s.Percentile(99); Over(p99, t.MaxP99) {
+		return fmt.Sprintf("p99 %s over the --max-p99 of %s", FormatLatency(p99), FormatLatency(t.MaxP99))
+	}
+
+	return ""
+}
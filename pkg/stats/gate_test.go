@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// TestExitThresholds checks each of --max-avg, --max-p99 and
+// --max-loss against totals just under and just over it.
+func TestExitThresholds(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(time.Second, time.Minute, DEFAULT_THRESHOLDS)
+	for i := 1; i <= 100; i++ {
+		latency := 20 * time.Millisecond
+		if i > 98 {
+			latency = 300 * time.Millisecond
+		}
+		s.Update(latency)
+		if i != 50 {
+			s.Loss.Reply(i, start.Add(time.Duration(i)*time.Second))
+		}
+	}
+	s.Loss.Advance(start.Add(101 * time.Second))
+
+	cases := []struct {
+		name       string
+		thresholds ExitThresholds
+		breach     string
+	}{
+		{"none set", ExitThresholds{}, ""},
+		{"average under", ExitThresholds{MaxAvg: 30 * time.Millisecond}, ""},
+		{"average over", ExitThresholds{MaxAvg: 25 * time.Millisecond}, "average 25.6ms over the --max-avg of 25.0ms"},
+		{"p99 under", ExitThresholds{MaxP99: 300 * time.Millisecond}, ""},
+		{"p99 over", ExitThresholds{MaxP99: 200 * time.Millisecond}, "p99 300ms over the --max-p99 of 200ms"},
+		{"loss under", ExitThresholds{MaxLoss: 0.01}, ""},
+		{"loss over", ExitThresholds{MaxLoss: 0.005}, "loss 1.00% (1/100) over the --max-loss of 0.50%"},
+	}
+	for _, c := range cases {
+		if breach := s.Breached(c.thresholds); breach != c.breach {
+			t.Fatalf("thresholds %s: expected %q, got %q", c.name, c.breach, breach)
+		}
+	}
+
+	empty := New(time.Second, time.Minute, DEFAULT_THRESHOLDS)
+	if empty.Breached(ExitThresholds{MaxP99: time.Second}) == "" {
+		t.Fatalf("a run with no replies has no latency to pass: expected a breach, got passed")
+	}
+}
@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	HEADLINE_MEAN   = "mean"
+	HEADLINE_MEDIAN = "median"
+	HEADLINE_P90    = "p90"
+	HEADLINE_P95    = "p95"
+	HEADLINE_P99    = "p99"
+)
+
+var HEADLINES = []string{HEADLINE_MEAN, HEADLINE_MEDIAN, HEADLINE_P90, HEADLINE_P95, HEADLINE_P99}
+
+// HeadlinePercentile is the percentile a headline takes, or zero for the
+// mean, which is also what an unset one means.
+func HeadlinePercentile(headline string) float64 {
+	switch headline {
+	case HEADLINE_MEDIAN:
+		return 50
+	case HEADLINE_P90:
+		return 90
+	case HEADLINE_P95:
+		return 95
+	case HEADLINE_P99:
+		return 99
+	}
+
+	return 0
+}
+
+// HeadlineLabel is how a headline figure is introduced, avg for the mean as
+// the figures always were.
+func HeadlineLabel(headline string) string {
+	if HeadlinePercentile(headline) == 0 {
+		return "avg"
+	}
+
+	return headline
+}
+
+// headlineOf is the headline of w, the window under way or just closed: its
+// mean, or the percentile over the samples in the rolling
+// window, which are the window's own.
+func (s *Stats) headlineOf(w *Window) time.Duration {
+	if p := HeadlinePercentile(s.Headline); p > 0 {
+		return s.WindowPercentile(p)
+	}
+
+	return w.Average()
+}
+
+// WindowHeadline is the headline of the window under way, or of the last one
+// until it's had a sample, and false before there's been any.
+func (s *Stats) WindowHeadline() (time.Duration, bool) {
+	switch {
+	case s.Window.Count > 0:
+		return s.headlineOf(&s.Window), true
+	case s.LastWindow.Count > 0:
+		return s.LastHeadline, true
+	}
+
+	return 0, false
+}
+
+// totalsHeadline is the headline over the run so far.
+func (s *Stats) totalsHeadline() time.Duration {
+	if p := HeadlinePercentile(s.Headline); p > 0 {
+		return s.Percentile(p)
+	}
+
+	return s.Totals.Average()
+}
+
+// PrintHeadline is the figure the run is summed up by, for the window and
+// for the run so far.
+func (s *Stats) PrintHeadline(t theme.Theme) string {
+	window, ok := s.WindowHeadline()
+	if !ok {
+		return t.Header.Render(fmt.Sprintf("Headline %s: waiting for samples", HeadlineLabel(s.Headline)))
+	}
+
+	figure := func(d time.Duration) string {
+		return s.Levels.Latency(t, d).Inherit(t.Header).Render(FormatLatency(d))
+	}
+	return t.Header.Render(fmt.Sprintf("Headline %s: ", HeadlineLabel(s.Headline))) + figure(window) + t.Header.Render(" this window, ") + figure(s.totalsHeadline()) + t.Header.Render(" over the run")
+}
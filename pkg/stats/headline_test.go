@@ -0,0 +1,70 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestHeadline checks each --headline sums a window up by its own
+// statistic, and that --expect is held to it.
+func TestHeadline(t *testing.T) {
+	cases := []struct {
+		headline string
+		expected time.Duration
+		versus   string
+	}{
+		{HEADLINE_MEAN, 0, ""},
+		{HEADLINE_MEDIAN, 10 * time.Millisecond, "median 10.0ms, -50% vs expected 20ms"},
+		{HEADLINE_P90, 10 * time.Millisecond, "p90 10.0ms, -50% vs expected 20ms"},
+		{HEADLINE_P95, 200 * time.Millisecond, "p95 200ms, +900% vs expected 20ms"},
+		{HEADLINE_P99, 200 * time.Millisecond, "p99 200ms, +900% vs expected 20ms"},
+	}
+
+	for _, c := range cases {
+		start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+		now := start
+		s := New(time.Second, 10*time.Second, DEFAULT_THRESHOLDS)
+		s.Clock = func() time.Time { return now }
+		s.WindowStart, s.Started = start, start
+		s.Headline = c.headline
+		s.Expected = 20 * time.Millisecond
+
+		// A window of 10ms replies with one slow one in the middle, closed
+		// by the ticker after its eleventh.
+		for i := range 11 {
+			now = start.Add(time.Duration(i) * time.Second)
+			rtt := 10 * time.Millisecond
+			if i == 5 {
+				rtt = 200 * time.Millisecond
+			}
+			s.Observe(ping.Result{Seq: i, Duration: rtt, Epoch: 1})
+			s.Update(rtt)
+		}
+		now = start.Add(11 * time.Second)
+		s.CloseWindows(now)
+		if s.LastWindow.Count == 0 {
+			t.Fatalf("the window closes: expected a last window, got none")
+		}
+
+		expected := c.expected
+		if c.headline == HEADLINE_MEAN {
+			expected = s.LastWindow.Average()
+		}
+		if s.LastHeadline != expected {
+			t.Fatalf("the %s headline is the window's %s: expected %q, got %q", c.headline, c.headline, FormatLatency(expected), FormatLatency(s.LastHeadline))
+		}
+
+		versus := c.versus
+		if versus == "" {
+			versus = fmt.Sprintf("avg %s, %+.0f%% vs expected 20ms", FormatLatency(expected), (Milliseconds(expected)-20)/20*100)
+		}
+		if line := s.PrintExpectation(theme.Theme{}); !strings.HasPrefix(line, versus) {
+			t.Fatalf("--expect is held to the %s headline: expected %q, got %q", c.headline, versus, line)
+		}
+	}
+}
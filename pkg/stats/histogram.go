@@ -0,0 +1,284 @@
+package stats
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// HISTOGRAM_PERCENTILES are the percentiles Markers places.
+var HISTOGRAM_PERCENTILES = []int{50, 90, 99}
+
+// HISTOGRAM_MARKER_MIN_SAMPLES is how many samples there must be before the
+// percentiles are estimated from the buckets.
+const HISTOGRAM_MARKER_MIN_SAMPLES = 20
+
+// Histogram counts samples into buckets, each holding those up to its
+// threshold and above the one before. Those slower than the last threshold
+// go in an overflow bucket, index len(thresholds) to anything indexing by
+// bucket, so that every sample in the total is in some bucket.
+type Histogram struct {
+	thresholds []time.Duration
+	buckets    []int
+	overflow   int
+	total      int
+}
+
+// NewHistogram buckets by thresholds, which are in ascending order.
+func NewHistogram(thresholds []time.Duration) Histogram {
+	return Histogram{
+		thresholds: thresholds,
+		buckets:    make([]int, len(thresholds)),
+	}
+}
+
+// RestoreHistogram is a histogram as it was saved, which has to have a
+// count for each of its thresholds. One saved from before the overflow was
+// counted still has it, as whatever the buckets don't account for.
+func RestoreHistogram(thresholds []time.Duration, buckets []int, overflow int, total int) Histogram {
+	h := Histogram{thresholds: thresholds, buckets: slices.Clone(buckets), overflow: overflow, total: total}
+
+	counted := h.overflow
+	for _, count := range h.buckets {
+		counted += count
+	}
+	if h.overflow == 0 && counted < h.total {
+		h.overflow = h.total - counted
+	}
+
+	return h
+}
+
+// Clone is h with counts of its own.
+func (h Histogram) Clone() Histogram {
+	h.buckets = slices.Clone(h.buckets)
+	return h
+}
+
+func (h *Histogram) Thresholds() []time.Duration {
+	return h.thresholds
+}
+
+// Total is how many samples there are, the overflow included.
+func (h *Histogram) Total() int {
+	return h.total
+}
+
+// Buckets are the counts of the buckets below each threshold, the overflow
+// left out.
+func (h *Histogram) Buckets() []int {
+	return slices.Clone(h.buckets)
+}
+
+// Overflow is how many samples were slower than the last threshold.
+func (h *Histogram) Overflow() int {
+	return h.overflow
+}
+
+// Bucket is the index of the bucket duration goes in.
+func (h *Histogram) Bucket(duration time.Duration) int {
+	for i, threshold := range h.thresholds {
+		if duration <= threshold {
+			return i
+		}
+	}
+
+	return len(h.thresholds)
+}
+
+// Count is how many samples bucket i holds, the overflow included.
+func (h *Histogram) Count(i int) int {
+	if i == len(h.buckets) {
+		return h.overflow
+	}
+
+	return h.buckets[i]
+}
+
+func (h *Histogram) Update(duration time.Duration) {
+	if i := h.Bucket(duration); i < len(h.buckets) {
+		h.buckets[i]++
+	} else {
+		h.overflow++
+	}
+
+	h.total++
+}
+
+func (h *Histogram) Remove(duration time.Duration) {
+	if i := h.Bucket(duration); i < len(h.buckets) && h.buckets[i] > 0 {
+		h.buckets[i]--
+	} else if i == len(h.buckets) && h.overflow > 0 {
+		h.overflow--
+	}
+
+	if h.total > 0 {
+		h.total--
+	}
+}
+
+func (h *Histogram) Reset() {
+	for i := range h.buckets {
+		h.buckets[i] = 0
+	}
+
+	h.overflow = 0
+	h.total = 0
+}
+
+// Fullest is the count of the fullest bucket.
+func (h *Histogram) Fullest() int {
+	return max(slices.Max(h.buckets), h.overflow)
+}
+
+// Scaled is bucket i's count in units, where the fullest bucket gets all of
+// them, for charts of either orientation to draw from.
+func (h *Histogram) Scaled(i int, units int) int {
+	fullest := h.Fullest()
+	if fullest == 0 {
+		return 0
+	}
+
+	return h.Count(i) * units / fullest
+}
+
+// Share is the fraction of all samples bucket i holds.
+func (h *Histogram) Share(i int) float64 {
+	if h.total == 0 {
+		return 0
+	}
+
+	return float64(h.Count(i)) / float64(h.total)
+}
+
+// FullestShare is the fraction of all samples the fullest bucket holds.
+func (h *Histogram) FullestShare() float64 {
+	if h.total == 0 {
+		return 0
+	}
+
+	return float64(h.Fullest()) / float64(h.total)
+}
+
+// Rebin shares h's counts out between new buckets as if the samples were
+// spread evenly within each old one, the overflow reaching as far as high.
+// The total stays the same, with what's left after rounding down going to
+// the buckets that lost the most to it.
+func (h *Histogram) Rebin(thresholds []time.Duration, high time.Duration) Histogram {
+	shares := make([]float64, len(thresholds)+1)
+	lower := time.Duration(0)
+	for i := range len(h.thresholds) + 1 {
+		upper := max(high, lower)
+		if i < len(h.thresholds) {
+			upper = h.thresholds[i]
+		}
+		if count := h.Count(i); count > 0 {
+			spread(shares, thresholds, lower, upper, float64(count))
+		}
+		lower = upper
+	}
+
+	rebinned := NewHistogram(thresholds)
+	rebinned.total = h.total
+	remainders := make([]int, len(shares))
+	left := h.total
+	for i, share := range shares {
+		count := int(share)
+		if i < len(thresholds) {
+			rebinned.buckets[i] = count
+		} else {
+			rebinned.overflow = count
+		}
+		left -= count
+		remainders[i] = i
+	}
+
+	slices.SortStableFunc(remainders, func(a int, b int) int {
+		_, fa := math.Modf(shares[a])
+		_, fb := math.Modf(shares[b])
+		return cmp.Compare(fb, fa)
+	})
+	for _, i := range remainders[:max(min(left, len(remainders)), 0)] {
+		if i < len(thresholds) {
+			rebinned.buckets[i]++
+		} else {
+			rebinned.overflow++
+		}
+	}
+
+	return rebinned
+}
+
+// spread adds count to shares in proportion to how much of lower to upper
+// each bucket covers, all of it to one bucket when the range is a point.
+func spread(shares []float64, thresholds []time.Duration, lower time.Duration, upper time.Duration, count float64) {
+	if upper <= lower {
+		h := Histogram{thresholds: thresholds}
+		shares[h.Bucket(upper)] += count
+		return
+	}
+
+	from := time.Duration(0)
+	for j := range shares {
+		to := time.Duration(math.MaxInt64)
+		if j < len(thresholds) {
+			to = thresholds[j]
+		}
+		if overlap := min(upper, to) - max(lower, from); overlap > 0 {
+			shares[j] += count * float64(overlap) / float64(upper-lower)
+		}
+		from = to
+	}
+}
+
+// Marker is a percentile estimated from the buckets, and the bucket it
+// falls in.
+type Marker struct {
+	Percentile int
+	Value      time.Duration
+	Bucket     int
+	// Overflow is set when it falls among the samples above the last
+	// threshold, and Value is that threshold.
+	Overflow bool
+}
+
+// Percentile estimates the p-th percentile from the bucket counts, assuming
+// samples are spread evenly within each bucket.
+func (h *Histogram) Percentile(p int) Marker {
+	rank := float64(p) / 100 * float64(h.total)
+	last := len(h.thresholds) - 1
+
+	cumulative := 0.0
+	for i, count := range h.buckets {
+		if count == 0 || cumulative+float64(count) < rank {
+			cumulative += float64(count)
+			continue
+		}
+
+		var lower time.Duration
+		if i > 0 {
+			lower = h.thresholds[i-1]
+		}
+		upper := h.thresholds[i]
+
+		return Marker{Percentile: p, Value: lower + time.Duration((rank-cumulative)/float64(count)*float64(upper-lower)), Bucket: i}
+	}
+
+	return Marker{Percentile: p, Value: h.thresholds[last], Bucket: last + 1, Overflow: true}
+}
+
+// Markers places HISTOGRAM_PERCENTILES once there are enough samples for
+// them to mean something.
+func (h *Histogram) Markers() []Marker {
+	if h.total < HISTOGRAM_MARKER_MIN_SAMPLES {
+		return nil
+	}
+
+	markers := make([]Marker, 0, len(HISTOGRAM_PERCENTILES))
+	for _, p := range HISTOGRAM_PERCENTILES {
+		markers = append(markers, h.Percentile(p))
+	}
+
+	return markers
+}
@@ -0,0 +1,172 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	DEFAULT_HISTOGRAM_WIDTH = 25
+	MIN_HISTOGRAM_WIDTH     = 5
+	// HISTOGRAM_ROW_WIDTH is everything on a horizontal row but the two
+	// bars and any marker columns.
+	HISTOGRAM_ROW_WIDTH = 29
+
+	HISTOGRAM_HEIGHT     = 8
+	MIN_HISTOGRAM_COLUMN = 3
+	MAX_HISTOGRAM_COLUMN = 8
+)
+
+// BLOCKS are the partial cells a vertical column is topped with, in eighths.
+var BLOCKS = []rune(" ▁▂▃▄▅▆▇█")
+
+type HistogramLayout struct {
+	// Terminal is the width available, or zero when it isn't known.
+	Terminal int
+	// Limit caps how long a bar, or how tall a column, may get.
+	Limit    int
+	Vertical bool
+}
+
+func (l HistogramLayout) longest(fallback int) int {
+	if l.Limit > 0 {
+		return l.Limit
+	}
+
+	return fallback
+}
+
+// fitsMarkers reports whether there's room for the marker columns beside
+// bars of the minimum width. The legend is shown either way.
+func (l HistogramLayout) fitsMarkers() bool {
+	return l.Terminal <= 0 || l.Terminal >= HISTOGRAM_ROW_WIDTH+2*(HISTOGRAM_MARKER_WIDTH+1+MIN_HISTOGRAM_WIDTH)
+}
+
+// barWidth splits what the terminal has left after the labels between the
+// two bars.
+func (l HistogramLayout) barWidth(marked bool) int {
+	limit := l.longest(DEFAULT_HISTOGRAM_WIDTH)
+	if l.Terminal <= 0 {
+		return limit
+	}
+
+	fixed := HISTOGRAM_ROW_WIDTH
+	if marked {
+		fixed += 2 * (HISTOGRAM_MARKER_WIDTH + 1)
+	}
+
+	return max(MIN_HISTOGRAM_WIDTH, min(limit, (l.Terminal-fixed)/2))
+}
+
+// columns picks a column width for buckets and whether the recent and total
+// charts fit beside each other, or have to be stacked.
+func (l HistogramLayout) columns(buckets int) (int, bool) {
+	terminal := l.Terminal
+	if terminal <= 0 {
+		terminal = DEFAULT_VIEW_WIDTH
+	}
+
+	if width := (terminal - 3) / (2 * buckets); width > MIN_HISTOGRAM_COLUMN {
+		return min(width, MAX_HISTOGRAM_COLUMN), true
+	}
+
+	return max(MIN_HISTOGRAM_COLUMN, min(terminal/buckets, MAX_HISTOGRAM_COLUMN)), false
+}
+
+// shownBuckets is how many buckets are drawn: one per threshold, and one
+// for the overflow once anything's landed in it.
+func (s *Stats) shownBuckets() int {
+	if s.Histogram.Overflow() > 0 || s.Rolling.Overflow() > 0 {
+		return len(s.Histogram.Thresholds()) + 1
+	}
+
+	return len(s.Histogram.Thresholds())
+}
+
+func (s *Stats) verticalHistogram(t theme.Theme, layout HistogramLayout) []string {
+	buckets := s.shownBuckets()
+	width, beside := layout.columns(buckets)
+	height := layout.longest(HISTOGRAM_HEIGHT)
+
+	recent := histogramColumns(&s.Rolling, t, s.Levels, fmt.Sprintf("Last %ds: %d", int(s.WindowSize.Seconds()), s.Rolling.Total()), width, height, buckets, s.Reference)
+	totals := histogramColumns(&s.Histogram, t, s.Levels, fmt.Sprintf("Totals: %d", s.Histogram.Total()), width, height, buckets, s.Reference)
+
+	if !beside {
+		return append(append(recent, ""), totals...)
+	}
+
+	lines := make([]string, len(recent))
+	for i := range recent {
+		lines[i] = recent[i] + " | " + totals[i]
+	}
+
+	return lines
+}
+
+// columns draws one vertical chart, with a column of width cells for each
+// of the first buckets, scaled so the fullest is height cells tall. Every
+// line is padded to the same width so that charts can sit side by side. A
+// reference shows above columns shorter than its own, in a lighter shade, and
+// a bucket past --crit in the levels is tinted.
+func histogramColumns(h *Histogram, t theme.Theme, l Levels, title string, width int, height int, buckets int, reference *ReferenceProfile) []string {
+	chart := width * buckets
+	lines := []string{fmt.Sprintf("%-*s", chart, title)}
+
+	for row := height - 1; row >= 0; row-- {
+		var line strings.Builder
+		for i := range buckets {
+			current, behind := h.Scaled(i, height*8), 0
+			if reference != nil {
+				current, behind = reference.cells(h, i, height*8)
+			}
+
+			eighths := min(max(current-row*8, 0), 8)
+			if eighths == 0 && behind-row*8 >= 4 {
+				line.WriteString(t.Muted.Render(strings.Repeat("░", width-1)) + " ")
+				continue
+			}
+			line.WriteString(barStyle(t, l, h, i).Render(strings.Repeat(string(BLOCKS[eighths]), width-1)) + " ")
+		}
+		lines = append(lines, line.String())
+	}
+
+	var labels, percents strings.Builder
+	for i := range buckets {
+		label := ""
+		if i < len(h.Thresholds()) {
+			label = columnLabel(h.Thresholds()[i], width-1)
+		} else {
+			label = ">" + columnLabel(h.Thresholds()[i-1], width-2)
+		}
+		labels.WriteString(fmt.Sprintf("%*s ", width-1, label))
+
+		percent := ""
+		if h.Total() > 0 {
+			percent = fmt.Sprintf("%.0f%%", h.Share(i)*100)
+		}
+		if len(percent) >= width {
+			percent = ""
+		}
+		percents.WriteString(fmt.Sprintf("%*s ", width-1, percent))
+	}
+
+	return append(lines, labels.String(), percents.String())
+}
+
+// columnLabel fits a bucket's threshold into width cells, dropping the unit
+// and then switching to seconds as the space runs out.
+func columnLabel(threshold time.Duration, width int) string {
+	if label := FormatThreshold(threshold); len(label) <= width {
+		return label
+	}
+
+	if label := strings.TrimSuffix(FormatThreshold(threshold), "ms"); len(label) <= width {
+		return label
+	}
+
+	return strconv.FormatFloat(threshold.Seconds(), 'f', -1, 64) + "s"
+}
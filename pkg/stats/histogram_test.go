@@ -0,0 +1,162 @@
+package stats
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestHistogram checks which bucket samples land in, on and either side of
+// a threshold, and that those past the last are counted as overflow, in the
+// total but in no bucket.
+func TestHistogram(t *testing.T) {
+	ms := func(values ...float64) []time.Duration {
+		durations := make([]time.Duration, len(values))
+		for i, value := range values {
+			durations[i] = time.Duration(value * float64(time.Millisecond))
+		}
+		return durations
+	}
+
+	cases := []struct {
+		name     string
+		samples  []time.Duration
+		buckets  []int
+		overflow int
+	}{
+		{"empty", nil, []int{0, 0, 0}, 0},
+		{"on each threshold", ms(10, 20, 50), []int{1, 1, 1}, 0},
+		{"just past each threshold", ms(10.001, 20.001, 50.001), []int{0, 1, 1}, 1},
+		{"instant", ms(0), []int{1, 0, 0}, 0},
+		{"all overflow", ms(51, 100, 5000), []int{0, 0, 0}, 3},
+		{"mixed", ms(1, 9, 15, 35, 40, 45, 60), []int{2, 1, 3}, 1},
+	}
+
+	for _, c := range cases {
+		h := NewHistogram(MillisecondThresholds(10, 20, 50))
+		for _, sample := range c.samples {
+			h.Update(sample)
+		}
+
+		if buckets := h.Buckets(); !slices.Equal(buckets, c.buckets) {
+			t.Fatalf("%s: buckets: expected %v, got %v", c.name, c.buckets, buckets)
+		}
+		if h.Overflow() != c.overflow {
+			t.Fatalf("%s: overflow: expected %d, got %d", c.name, c.overflow, h.Overflow())
+		}
+		if h.Total() != len(c.samples) {
+			t.Fatalf("%s: total: expected %d, got %d", c.name, len(c.samples), h.Total())
+		}
+
+		counted := 0
+		for i := range len(c.buckets) + 1 {
+			counted += h.Count(i)
+		}
+		if counted != h.Total() {
+			t.Fatalf("%s: buckets and overflow hold %d of %d samples", c.name, counted, h.Total())
+		}
+	}
+}
+
+// TestHistogramMarkers checks the percentile legend and the rows each
+// marker lands on against golden output for a few typical distributions.
+func TestHistogramMarkers(t *testing.T) {
+	repeat := func(value int64, count int) []int64 {
+		values := make([]int64, count)
+		for i := range values {
+			values[i] = value
+		}
+		return values
+	}
+
+	var uniform []int64
+	for i := int64(1); i <= 100; i++ {
+		uniform = append(uniform, i)
+	}
+
+	cases := []struct {
+		name    string
+		samples []int64
+		legend  string
+		rows    string
+	}{
+		{"uniform 1-100ms", uniform, "p50 50.0ms, p90 90.0ms, p99 99.0ms", "[50ms:p50 100ms:p90/99]"},
+		{"tight around 15ms", repeat(15, 100), "p50 15.0ms, p90 19.0ms, p99 19.9ms", "[20ms:p50/90/99]"},
+		{"long tail past the last bucket", append(repeat(8, 95), repeat(2000, 5)...), "p50 7.6ms, p90 9.7ms, p99 >1000.0ms", "[10ms:p50/90 >1000ms:p99]"},
+		{"too few samples", repeat(15, HISTOGRAM_MARKER_MIN_SAMPLES-1), "under 20 samples", "[]"},
+	}
+
+	for _, c := range cases {
+		h := NewHistogram(DEFAULT_THRESHOLDS)
+		for _, sample := range c.samples {
+			h.Update(time.Duration(sample) * time.Millisecond)
+		}
+
+		markers := h.Markers()
+		if legend := markerLegend(markers); legend != c.legend {
+			t.Fatalf("%s: legend: expected %q, got %q", c.name, c.legend, legend)
+		}
+
+		var rows []string
+		thresholds := h.Thresholds()
+		for i := range len(thresholds) + 1 {
+			label := ">" + FormatThreshold(thresholds[len(thresholds)-1])
+			if i < len(thresholds) {
+				label = FormatThreshold(thresholds[i])
+			}
+			if column := strings.TrimSpace(markerColumn(markers, i)); column != "" {
+				rows = append(rows, fmt.Sprintf("%s:%s", label, column))
+			}
+		}
+		if fmt.Sprint(rows) != c.rows {
+			t.Fatalf("%s: marked rows: expected %q, got %v", c.name, c.rows, rows)
+		}
+	}
+}
+
+// TestHistogramLayout renders the same samples in both orientations
+// at several terminal widths against golden output, then checks that bars
+// and columns are drawn from the same counts.
+func TestHistogramLayout(t *testing.T) {
+	s := New(time.Second, time.Minute, MillisecondThresholds(10, 20, 50, 100))
+	for _, sample := range []int64{4, 8, 12, 15, 18, 19, 25, 30, 45, 80, 120} {
+		s.Update(time.Duration(sample) * time.Millisecond)
+	}
+
+	cases := []struct {
+		name   string
+		layout HistogramLayout
+	}{
+		{"horizontal-40", HistogramLayout{Terminal: 40}},
+		{"horizontal-100", HistogramLayout{Terminal: 100}},
+		{"horizontal-100-limit-10", HistogramLayout{Terminal: 100, Limit: 10}},
+		{"vertical-30-stacked", HistogramLayout{Terminal: 30, Limit: 4, Vertical: true}},
+		{"vertical-60", HistogramLayout{Terminal: 60, Limit: 3, Vertical: true}},
+	}
+
+	for _, c := range cases {
+		var lines []string
+		for _, line := range strings.Split(s.PrintHistogram(theme.Theme{}, c.layout), "\n") {
+			lines = append(lines, strings.TrimRight(line, " "))
+		}
+		golden(t, "histogram-"+c.name, strings.Join(lines, "\n")+"\n")
+	}
+
+	height := 5
+	column := histogramColumns(&s.Histogram, theme.Theme{}, Levels{}, "", 2, height, s.shownBuckets(), nil)
+	for i := range s.Histogram.Thresholds() {
+		bar, _ := Bar(&s.Histogram, i, height*8)
+		eighths := 0
+		for _, line := range column[1 : height+1] {
+			eighths += slices.Index(BLOCKS, []rune(line)[i*2])
+		}
+
+		if length := strings.Count(bar, "█"); length != eighths {
+			t.Fatalf("bucket %d drawn from the same counts: expected %v, got %v", i, length, eighths)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package stats
+
+import (
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/history"
+)
+
+// RunP95 is the median of the p95 of each completed window, so a single bad
+// window doesn't dominate the run's summary. Runs shorter than a window fall
+// back to the rolling p95.
+func (s *Stats) RunP95() time.Duration {
+	if len(s.windowP95s) == 0 {
+		return s.WindowPercentile(95)
+	}
+
+	p95s := make([]int64, len(s.windowP95s))
+	for i, p95 := range s.windowP95s {
+		p95s[i] = int64(p95)
+	}
+	return time.Duration(history.Median(p95s))
+}
@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// observeHTTP counts response codes and failed requests, logging an event
+// whenever requests start failing a new way or recover, rather than for
+// every one.
+func (s *Stats) observeHTTP(result ping.Result) {
+	if result.Status > 0 {
+		if s.statuses == nil {
+			s.statuses = map[int]int{}
+		}
+		s.statuses[result.Status]++
+	}
+	if result.Reason == ping.LOSS_ERROR {
+		s.requestErrors++
+	}
+
+	switch {
+	case result.Status == 0 && result.Reason != ping.LOSS_ERROR:
+	case result.Lost:
+		s.noteFailure("http", result.Error)
+	default:
+		s.noteFailure("http", "")
+	}
+}
+
+// noteFailure logs an event when requests start failing a new way, or stop
+// failing, given what the latest one did.
+func (s *Stats) noteFailure(kind string, failure string) {
+	if failure == s.lastFailure {
+		return
+	}
+	if failure == "" {
+		s.AddEvent(kind, "requests succeeding again after: "+s.lastFailure)
+	} else {
+		s.AddEvent(kind, "requests failing: "+failure)
+	}
+	s.lastFailure = failure
+}
+
+// PrintStatuses tallies responses by code, failures first.
+func (s *Stats) PrintStatuses(t theme.Theme) string {
+	if len(s.statuses) == 0 && s.requestErrors == 0 {
+		return "HTTP: no responses yet"
+	}
+
+	var codes []int
+	for code := range s.statuses {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		iOK, jOK := codes[i]/100 == 2, codes[j]/100 == 2
+		if iOK != jOK {
+			return jOK
+		}
+		return codes[i] < codes[j]
+	})
+
+	var parts []string
+	for _, code := range codes {
+		part := fmt.Sprintf("%d x%d", code, s.statuses[code])
+		if code/100 != 2 {
+			part = t.Bad.Render(part)
+		}
+		parts = append(parts, part)
+	}
+	if s.requestErrors > 0 {
+		parts = append(parts, t.Bad.Render(fmt.Sprintf("%d failed requests", s.requestErrors)))
+	}
+
+	line := "HTTP: " + strings.Join(parts, ", ")
+	if s.lastFailure != "" {
+		line += t.Bad.Render(" (failing: " + s.lastFailure + ")")
+	}
+
+	return line
+}
@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestHTTP probes a local server in parallel with each option, taking
+// two results from each: plain successes, a failing status, a redirect both
+// followed and not, and whether connections are reused.
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cases := map[string]ping.HTTPOptions{
+		"ok":         {URL: server.URL + "/", KeepAlive: true},
+		"fresh":      {URL: server.URL + "/"},
+		"down":       {URL: server.URL + "/down", KeepAlive: true},
+		"moved":      {URL: server.URL + "/moved", KeepAlive: true},
+		"redirected": {URL: server.URL + "/moved", KeepAlive: true, FollowRedirects: true},
+	}
+
+	var mu sync.Mutex
+	results := map[string][]ping.Result{}
+	var wg sync.WaitGroup
+	for name, options := range cases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pings, _ := ping.NewPinger("127.0.0.1", time.Second).HTTP(options).Run(ctx)
+			var got []ping.Result
+			for result := range pings {
+				got = append(got, result)
+				if len(got) == 2 {
+					break
+				}
+			}
+			mu.Lock()
+			results[name] = got
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for name := range cases {
+		if len(results[name]) != 2 {
+			t.Fatalf("results from %s: expected 2, got %v", name, len(results[name]))
+		}
+	}
+
+	connect := func(result ping.Result) time.Duration {
+		for _, phase := range result.Phases {
+			if phase.Name == "connect" {
+				return phase.Duration
+			}
+		}
+		return 0
+	}
+
+	ok := results["ok"]
+	if ok[0].Lost || ok[0].Status != http.StatusOK || ok[0].Duration <= 0 || len(ok[0].Phases) != 5 {
+		t.Fatalf("a 200 response: expected not lost, timed, with 5 phases, got %+v", ok[0])
+	}
+	if connect(ok[0]) <= 0 || connect(ok[1]) != 0 {
+		t.Fatalf("connections with keepalive: expected only the first connects, got %s then %s", connect(ok[0]), connect(ok[1]))
+	}
+	if fresh := results["fresh"]; connect(fresh[1]) <= 0 {
+		t.Fatalf("connections without keepalive: expected every request connects, got second took %s to connect", connect(fresh[1]))
+	}
+	if down := results["down"][0]; !down.Lost || down.Reason != ping.LOSS_STATUS || down.Error != "HTTP 503" {
+		t.Fatalf("a 503 response: expected lost, with HTTP 503, got %+v", down)
+	}
+	if moved := results["moved"][0]; !moved.Lost || moved.Status != http.StatusFound {
+		t.Fatalf("a redirect by default: expected lost with 302, not followed, got %+v", moved)
+	}
+	if redirected := results["redirected"][0]; redirected.Lost || redirected.Status != http.StatusOK {
+		t.Fatalf("a redirect with FollowRedirects: expected followed to a 200, got %+v", redirected)
+	}
+
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	s.Observe(results["down"][0])
+	s.Observe(results["down"][1])
+	s.Observe(ok[0])
+	if len(s.Events) != 2 || s.statuses[503] != 2 || !strings.Contains(s.PrintStatuses(theme.Theme{}), "503 x2, 200 x1") {
+		t.Fatalf("statuses after two 503s and a 200: expected 503 x2, 200 x1 and a failing then recovered event, got %s with %d events", s.PrintStatuses(theme.Theme{}), len(s.Events))
+	}
+}
@@ -0,0 +1,98 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+type Incident struct {
+	Kind     string     `json:"kind"`
+	Detail   string     `json:"detail"`
+	Started  time.Time  `json:"started"`
+	Resolved *time.Time `json:"resolved,omitempty"`
+	AckedAt  *time.Time `json:"acked_at,omitempty"`
+	AckNote  string     `json:"ack_note,omitempty"`
+}
+
+func (i *Incident) Active() bool {
+	return i.Resolved == nil
+}
+
+func (i *Incident) Acknowledged() bool {
+	return i.AckedAt != nil
+}
+
+// activeIncident is the most recently opened incident still active, if any.
+func (s *Stats) activeIncident() *Incident {
+	return s.ActiveIncidentOf("")
+}
+
+// ActiveIncidentOf finds the active incident of a kind, or of any kind when
+// it is empty. Each alert criterion has its own kind, so several can be
+// active at once.
+func (s *Stats) ActiveIncidentOf(kind string) *Incident {
+	for i := len(s.Incidents) - 1; i >= 0; i-- {
+		incident := &s.Incidents[i]
+		if incident.Active() && (kind == "" || incident.Kind == kind) {
+			return incident
+		}
+	}
+
+	return nil
+}
+
+func (s *Stats) openIncident(kind string, detail string) {
+	s.Incidents = append(s.Incidents, Incident{Kind: kind, Detail: detail, Started: Stored(s.Now())})
+	s.AddEvent(kind, detail)
+	s.checkBurst()
+}
+
+func (s *Stats) resolveIncident(kind string, detail string) {
+	incident := s.ActiveIncidentOf(kind)
+	if incident == nil {
+		return
+	}
+
+	now := Stored(s.Now())
+	incident.Resolved = &now
+	s.AddEvent(incident.Kind, fmt.Sprintf("%s after %s", detail, now.Sub(incident.Started).Round(time.Second)))
+	s.checkBurst()
+}
+
+// Acknowledge marks the active incident as seen so that notifications about
+// it stop, while its state stays visible until it resolves.
+func (s *Stats) Acknowledge(note string) error {
+	incident := s.activeIncident()
+	if incident == nil {
+		return fmt.Errorf("no active alert to acknowledge")
+	}
+
+	now := Stored(s.Now())
+	incident.AckedAt = &now
+	incident.AckNote = note
+
+	message := "acknowledged " + incident.Kind + " alert"
+	if note != "" {
+		message += ": " + note
+	}
+	s.AddEvent("ack", message)
+
+	return nil
+}
+
+// ExpireAck drops an acknowledgement once ReackAfter has passed so that a
+// long-running incident starts notifying again.
+func (s *Stats) ExpireAck(reackAfter time.Duration) {
+	incident := s.activeIncident()
+	if reackAfter <= 0 || incident == nil || !incident.Acknowledged() {
+		return
+	}
+
+	if s.Now().Sub(*incident.AckedAt) < reackAfter {
+		return
+	}
+
+	incident.AckedAt = nil
+	incident.AckNote = ""
+	s.AddEvent("ack", fmt.Sprintf("acknowledgement of %s alert expired after %s", incident.Kind, reackAfter))
+}
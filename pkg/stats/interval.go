@@ -0,0 +1,31 @@
+package stats
+
+import "math"
+
+// Z95 is the standard score for a two-sided 95% confidence interval.
+const Z95 = 1.96
+
+// WilsonInterval bounds the true proportion of successes given the observed
+// counts. It behaves sensibly for small samples and proportions near 0 or 1,
+// unlike the normal approximation.
+func WilsonInterval(successes int, trials int, z float64) (float64, float64) {
+	if trials <= 0 {
+		return 0, 1
+	}
+
+	if successes < 0 {
+		successes = 0
+	}
+	if successes > trials {
+		successes = trials
+	}
+
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := z * z
+
+	centre := (p + z2/(2*n)) / (1 + z2/n)
+	margin := z / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+
+	return math.Max(0, centre-margin), math.Min(1, centre+margin)
+}
@@ -0,0 +1,419 @@
+package stats
+
+import (
+	"math"
+	"time"
+)
+
+const seqSpace = 1 << 16
+
+type outcome struct {
+	at   time.Time
+	lost bool
+	// weight is the probe interval at the time, so that loss is averaged
+	// over time rather than probes when the rate changes.
+	weight time.Duration
+}
+
+// pendingProbe is a probe missing from the sequence, which may yet be
+// answered until its deadline.
+type pendingProbe struct {
+	deadline time.Time
+	weight   time.Duration
+}
+
+// pace is a change of probe interval, along with the probe the sequence was
+// due to have reached by then. Probes missing since the last reply are
+// inferred from the time spent at each rate in turn.
+type pace struct {
+	at       time.Time
+	seq      int
+	interval time.Duration
+}
+
+// LossTracker derives loss from the sequence numbers of replies. A probe only
+// counts as lost once its timeout has passed, so replies still in flight are
+// neither sent nor lost as far as the totals are concerned.
+type LossTracker struct {
+	interval time.Duration
+	timeout  time.Duration
+	window   time.Duration
+	retain   time.Duration
+	halfLife time.Duration
+
+	started     bool
+	epoch       int
+	highest     int
+	highestAt   time.Time
+	paces       []pace
+	lostThrough int
+	pending     map[int]pendingProbe
+	resolved    map[int]bool
+	next        int
+	streak      int
+	longest     int
+	observers   []func(seq int, lost bool)
+
+	sent     int
+	lost     int
+	sentTime time.Duration
+	lostTime time.Duration
+	recent   []outcome
+	smoothed float64
+	updated  time.Time
+}
+
+func NewLossTracker(interval time.Duration, timeout time.Duration, window time.Duration, halfLife time.Duration) *LossTracker {
+	return &LossTracker{
+		interval: interval,
+		timeout:  timeout,
+		window:   window,
+		retain:   window,
+		halfLife: halfLife,
+		pending:  map[int]pendingProbe{},
+		resolved: map[int]bool{},
+	}
+}
+
+// unwrap turns a 16 bit icmp_seq into a monotonically increasing number,
+// assuming fewer than half the sequence space goes missing at once.
+func (l *LossTracker) unwrap(seq int) int {
+	candidate := l.epoch*seqSpace + seq
+	if l.started && candidate < l.highest-seqSpace/2 {
+		l.epoch++
+		candidate += seqSpace
+	}
+
+	return candidate
+}
+
+func (l *LossTracker) Reply(seq int, at time.Time) {
+	l.record(seq, at, false)
+}
+
+// Unreachable settles a probe as lost straight away, for when a router, or
+// the target itself, has said it won't arrive rather than it just going
+// unanswered.
+func (l *LossTracker) Unreachable(seq int, at time.Time) {
+	l.record(seq, at, true)
+}
+
+func (l *LossTracker) record(seq int, at time.Time, lost bool) {
+	if !l.started {
+		l.started = true
+		l.highest = l.unwrap(seq)
+		l.highestAt = at
+		l.paces = append(l.paces[:0], pace{at: at, seq: l.highest, interval: l.interval})
+		l.lostThrough = l.highest
+		l.next = l.highest
+		l.settle(l.highest, at, lost, l.interval)
+		return
+	}
+
+	seq = l.unwrap(seq)
+
+	switch {
+	case seq > l.highest:
+		for missing := max(l.highest, l.lostThrough) + 1; missing < seq; missing++ {
+			l.pending[missing] = pendingProbe{deadline: at.Add(l.timeout), weight: l.intervalOf(missing)}
+		}
+		if seq > l.lostThrough {
+			l.settle(seq, at, lost, l.interval)
+		}
+		l.highest = seq
+		l.highestAt = at
+		l.paces = append(l.paces[:0], pace{at: at, seq: seq, interval: l.interval})
+	default:
+		if probe, ok := l.pending[seq]; ok {
+			delete(l.pending, seq)
+			l.settle(seq, at, lost, probe.weight)
+		}
+	}
+
+	l.Advance(at)
+}
+
+// Advance declares overdue probes lost. It must be called regularly, since
+// during an outage there are no replies to reveal the gaps.
+func (l *LossTracker) Advance(now time.Time) {
+	for seq, probe := range l.pending {
+		if !now.Before(probe.deadline) {
+			delete(l.pending, seq)
+			l.settle(seq, now, true, probe.weight)
+		}
+	}
+
+	if !l.started || l.interval <= 0 {
+		return
+	}
+
+	overdue := now.Sub(l.highestAt) - l.timeout
+	if overdue < 0 {
+		return
+	}
+
+	through := l.dueBy(now.Add(-l.timeout))
+	for seq := max(l.highest, l.lostThrough) + 1; seq <= through; seq++ {
+		l.settle(seq, now, true, l.intervalOf(seq))
+	}
+	l.lostThrough = max(l.lostThrough, through)
+}
+
+// dueBy is the last probe that should have been sent by t, going through
+// the rates probing has had since the last reply.
+func (l *LossTracker) dueBy(t time.Time) int {
+	from := l.paces[0]
+	for _, p := range l.paces[1:] {
+		if t.Before(p.at) {
+			break
+		}
+		from = p
+	}
+	if from.interval <= 0 {
+		return from.seq
+	}
+
+	return from.seq + int(t.Sub(from.at)/from.interval)
+}
+
+// intervalOf is the interval a probe since the last reply was sent at.
+func (l *LossTracker) intervalOf(seq int) time.Duration {
+	for i := len(l.paces) - 1; i >= 0; i-- {
+		if seq > l.paces[i].seq {
+			return l.paces[i].interval
+		}
+	}
+
+	return l.interval
+}
+
+// SetInterval is told when the probe rate changes, so that probes missing
+// during an outage are still counted at the rate they were sent.
+func (l *LossTracker) SetInterval(now time.Time, interval time.Duration) {
+	if interval <= 0 || interval == l.interval {
+		return
+	}
+
+	if l.started && l.interval > 0 {
+		l.paces = append(l.paces, pace{at: now, seq: l.dueBy(now), interval: interval})
+	}
+	l.interval = interval
+}
+
+// Interval is the probe interval the tracker was last told of.
+func (l *LossTracker) Interval() time.Duration {
+	return l.interval
+}
+
+// settle records a probe's fate, counting it for the interval it was sent
+// at. Probes settle in whatever order their replies or deadlines come, so
+// the run of consecutive losses is followed by walking them back into
+// sequence order as the gaps fill.
+func (l *LossTracker) settle(seq int, at time.Time, lost bool, weight time.Duration) {
+	l.resolved[seq] = lost
+	for {
+		next, ok := l.resolved[l.next]
+		if !ok {
+			break
+		}
+		delete(l.resolved, l.next)
+		for _, observer := range l.observers {
+			observer(l.next, next)
+		}
+		l.next++
+
+		if next {
+			l.streak++
+			l.longest = max(l.longest, l.streak)
+		} else {
+			l.streak = 0
+		}
+	}
+
+	l.sent++
+	l.sentTime += weight
+	if lost {
+		l.lost++
+		l.lostTime += weight
+	}
+
+	l.recent = append(l.recent, outcome{at: at, lost: lost, weight: weight})
+	cutoff := 0
+	for cutoff < len(l.recent) && at.Sub(l.recent[cutoff].at) > l.retain {
+		cutoff++
+	}
+	l.recent = l.recent[cutoff:]
+
+	value := 0.0
+	if lost {
+		value = 1
+	}
+	if l.updated.IsZero() || l.halfLife <= 0 {
+		l.smoothed = value
+	} else if elapsed := at.Sub(l.updated); elapsed > 0 {
+		alpha := 1 - math.Exp2(-elapsed.Seconds()/l.halfLife.Seconds())
+		l.smoothed += alpha * (value - l.smoothed)
+	}
+	l.updated = at
+}
+
+// Restart is called when the probe sequence starts over, e.g. after the
+// prober is replaced, so that the new numbers aren't read as a huge gap.
+// Probes still pending are counted as lost, as are those that would have
+// been sent by the interval in the time it was gone, up to the one the new
+// sequence takes the place of.
+func (l *LossTracker) Restart(now time.Time) {
+	for seq, probe := range l.pending {
+		delete(l.pending, seq)
+		l.settle(seq, now, true, probe.weight)
+	}
+	if l.started && l.interval > 0 {
+		through := l.dueBy(now.Add(-l.interval))
+		for seq := max(l.highest, l.lostThrough) + 1; seq <= through; seq++ {
+			l.settle(seq, now, true, l.intervalOf(seq))
+		}
+	}
+
+	clear(l.resolved)
+	l.started = false
+	l.epoch = 0
+}
+
+// Pause forgets the probes still pending, rather than counting them lost,
+// for when probing is stopped on purpose. Counting starts afresh with the
+// next reply, so the time in between isn't read as a gap either.
+func (l *LossTracker) Pause() {
+	clear(l.pending)
+	clear(l.resolved)
+	l.started = false
+	l.epoch = 0
+}
+
+// ResetTotals starts the cumulative figures over, leaving the rolling and
+// smoothed views and anything in flight alone.
+func (l *LossTracker) ResetTotals() {
+	l.sent = 0
+	l.lost = 0
+	l.sentTime = 0
+	l.lostTime = 0
+}
+
+// LossTotals are the cumulative figures, to carry over to a tracker
+// following the same run.
+type LossTotals struct {
+	Sent     int           `json:"sent"`
+	Lost     int           `json:"lost"`
+	SentTime time.Duration `json:"sent_time"`
+	LostTime time.Duration `json:"lost_time"`
+}
+
+func (l *LossTracker) Totals() LossTotals {
+	return LossTotals{Sent: l.sent, Lost: l.lost, SentTime: l.sentTime, LostTime: l.lostTime}
+}
+
+// Carry takes up the cumulative figures from where another tracker got to,
+// in place of any of its own.
+func (l *LossTracker) Carry(t LossTotals) {
+	l.sent, l.lost, l.sentTime, l.lostTime = t.Sent, t.Lost, t.SentTime, t.LostTime
+}
+
+// Settled returns the number of probes whose fate is known, and how many of
+// them were lost.
+func (l *LossTracker) Settled() (int, int) {
+	return l.sent, l.lost
+}
+
+// LostTime is the probing time the probes lost stood for, each weighted by
+// the interval it was sent at.
+func (l *LossTracker) LostTime() time.Duration {
+	return l.lostTime
+}
+
+// Streak returns the number of probes lost in a row up to the latest one
+// settled in sequence order, and the longest such run since the last call.
+// A burst can start and end between two calls, so alerting should look at
+// the longest rather than the current run.
+func (l *LossTracker) Streak() (int, int) {
+	longest := max(l.longest, l.streak)
+	l.longest = l.streak
+	return l.streak, longest
+}
+
+// Started is whether there's been a reply, or a probe refused, to count the
+// sequence from, since the last restart or pause.
+func (l *LossTracker) Started() bool {
+	return l.started
+}
+
+func (l *LossTracker) InFlight() int {
+	return len(l.pending)
+}
+
+// Retained is how many settled outcomes are kept for windows and alerts to
+// look back over.
+func (l *LossTracker) Retained() int {
+	return len(l.recent)
+}
+
+// Cumulative is the share of the run's probing time lost, which is the
+// share of probes lost while the rate stays the same.
+func (l *LossTracker) Cumulative() float64 {
+	if l.sent == 0 {
+		return 0
+	}
+	if l.sentTime <= 0 {
+		return float64(l.lost) / float64(l.sent)
+	}
+
+	return float64(l.lostTime) / float64(l.sentTime)
+}
+
+// Observe calls fn with each probe's fate in sequence order, along with any
+// earlier observers.
+func (l *LossTracker) Observe(fn func(seq int, lost bool)) {
+	l.observers = append(l.observers, fn)
+}
+
+// Retain keeps settled probes for at least d, so that Over can look back
+// further than the display window.
+func (l *LossTracker) Retain(d time.Duration) {
+	l.retain = max(l.retain, d)
+}
+
+// Rolling returns the loss over the probes settled within the last window,
+// along with the lost and settled counts it was computed from. Each probe
+// counts for the interval it was sent at, so that a burst of fast probes
+// doesn't outweigh the slower ones either side of it.
+func (l *LossTracker) Rolling(now time.Time) (float64, int, int) {
+	return l.Over(now, l.window)
+}
+
+// Over is Rolling for any window up to the retention.
+func (l *LossTracker) Over(now time.Time, window time.Duration) (float64, int, int) {
+	lost, sent := 0, 0
+	var lostTime, sentTime time.Duration
+	for _, o := range l.recent {
+		if now.Sub(o.at) > window {
+			continue
+		}
+		sent++
+		sentTime += o.weight
+		if o.lost {
+			lost++
+			lostTime += o.weight
+		}
+	}
+
+	if sent == 0 {
+		return 0, 0, 0
+	}
+	if sentTime <= 0 {
+		return float64(lost) / float64(sent), lost, sent
+	}
+
+	return float64(lostTime) / float64(sentTime), lost, sent
+}
+
+func (l *LossTracker) Smoothed() float64 {
+	return l.smoothed
+}
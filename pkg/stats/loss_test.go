@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestLoss walks the loss tracker through a late reply, a gap, an
+// outage and a sequence wrap, checking that nothing still in flight is ever
+// counted as lost.
+func TestLoss(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds float64) time.Time {
+		return start.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	loss := NewLossTracker(time.Second, 2*time.Second, time.Minute, time.Minute)
+	steps := []struct {
+		name     string
+		apply    func()
+		sent     int
+		lost     int
+		inFlight int
+	}{
+		{"first replies", func() { loss.Reply(1, at(0)); loss.Reply(2, at(1)) }, 2, 0, 0},
+		{"gap is only pending", func() { loss.Reply(4, at(3)) }, 3, 0, 1},
+		{"late reply within timeout", func() { loss.Reply(3, at(3.5)) }, 4, 0, 0},
+		{"gap before its deadline", func() { loss.Reply(6, at(5)); loss.Advance(at(6.9)) }, 5, 0, 1},
+		{"gap after its deadline", func() { loss.Advance(at(7)) }, 6, 1, 0},
+		{"silent outage", func() { loss.Advance(at(10)) }, 9, 4, 0},
+		{"reply after being counted lost", func() { loss.Reply(8, at(10.5)) }, 9, 4, 0},
+		{"recovery", func() { loss.Reply(10, at(11)) }, 10, 4, 0},
+		{"restart then sequence wrap", func() {
+			loss.Restart(at(12))
+			loss.Reply(65534, at(12))
+			loss.Reply(65535, at(13))
+			loss.Reply(0, at(14))
+		}, 13, 4, 0},
+		{"unreachable settles at once", func() { loss.Reply(2, at(16)); loss.Unreachable(1, at(16)) }, 15, 5, 0},
+	}
+
+	for _, step := range steps {
+		step.apply()
+
+		sent, lost := loss.Settled()
+		actual := fmt.Sprintf("sent %d, lost %d, in flight %d", sent, lost, loss.InFlight())
+		expected := fmt.Sprintf("sent %d, lost %d, in flight %d", step.sent, step.lost, step.inFlight)
+		if actual != expected {
+			t.Fatalf("%s: expected %q, got %q", step.name, expected, actual)
+		}
+	}
+}
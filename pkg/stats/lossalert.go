@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CONSECUTIVE_LOSS = "consecutive-loss"
+	WINDOW_LOSS      = "window-loss"
+)
+
+// LossCriteria are the independent ways loss can raise an alert. A zero
+// threshold disables that criterion.
+type LossCriteria struct {
+	Consecutive int
+	WindowLoss  float64
+	Window      time.Duration
+}
+
+func (c LossCriteria) Enabled() bool {
+	return c.Consecutive > 0 || c.WindowLoss > 0
+}
+
+// ParsePercent reads a threshold such as "1%" or "0.5%" as a fraction.
+func ParsePercent(text string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(text), "%"), 64)
+	if err != nil || value <= 0 || value > 100 {
+		return 0, fmt.Errorf("failed to parse percentage %q, expected something like 1%%", text)
+	}
+
+	return value / 100, nil
+}
+
+// LossTransition is a criterion starting or stopping firing.
+type LossTransition struct {
+	Criterion string
+	Firing    bool
+	Detail    string
+}
+
+// LossAlerts evaluates each criterion over the same LossTracker, keeping a
+// separate state for each so that one firing doesn't mask the other.
+type LossAlerts struct {
+	criteria LossCriteria
+	interval time.Duration
+
+	consecutive bool
+	peak        int
+	window      bool
+}
+
+func NewLossAlerts(criteria LossCriteria, interval time.Duration) *LossAlerts {
+	return &LossAlerts{criteria: criteria, interval: interval}
+}
+
+func (a *LossAlerts) Criteria() LossCriteria {
+	return a.criteria
+}
+
+// Firing reports the state of each criterion.
+func (a *LossAlerts) Firing() (bool, bool) {
+	return a.consecutive, a.window
+}
+
+// Evaluate returns the criteria whose state changed since the last call.
+func (a *LossAlerts) Evaluate(loss *LossTracker, now time.Time) []LossTransition {
+	var transitions []LossTransition
+
+	current, longest := loss.Streak()
+	if n := a.criteria.Consecutive; n > 0 {
+		if !a.consecutive && longest >= n {
+			a.consecutive = true
+			a.peak = longest
+			transitions = append(transitions, LossTransition{CONSECUTIVE_LOSS, true, fmt.Sprintf("%d consecutive probes lost (alert at %d)", longest, n)})
+		}
+
+		if a.consecutive {
+			a.peak = max(a.peak, longest)
+			if current == 0 {
+				a.consecutive = false
+				transitions = append(transitions, LossTransition{CONSECUTIVE_LOSS, false, fmt.Sprintf("%d consecutive losses ended", a.peak)})
+			}
+		}
+	}
+
+	if threshold := a.criteria.WindowLoss; threshold > 0 {
+		pct, lost, sent := loss.Over(now, a.criteria.Window)
+		// Don't judge the window on a handful of probes, or the first loss
+		// of the run would count as total loss.
+		enough := a.interval <= 0 || sent >= int(a.criteria.Window/a.interval)/2
+
+		if !a.window && enough && pct > threshold {
+			a.window = true
+			transitions = append(transitions, LossTransition{WINDOW_LOSS, true, fmt.Sprintf("%.1f%% loss over %s (%d/%d, alert above %.1f%%)", pct*100, a.criteria.Window, lost, sent, threshold*100)})
+		} else if a.window && pct <= threshold {
+			a.window = false
+			transitions = append(transitions, LossTransition{WINDOW_LOSS, false, fmt.Sprintf("loss over %s back to %.1f%%", a.criteria.Window, pct*100)})
+		}
+	}
+
+	return transitions
+}
@@ -0,0 +1,64 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestLossAlerts plays loss patterns through the tracker with alerts
+// at 3 in a row and above 1% over 5 minutes, checking which criteria fire.
+func TestLossAlerts(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		lost     func(seq int) bool
+		expected string
+	}{
+		{"no loss", func(seq int) bool { return false }, "[]"},
+		{"isolated drops", func(seq int) bool { return seq%250 == 0 }, "[]"},
+		{"short burst", func(seq int) bool { return seq >= 400 && seq < 403 }, "[consecutive-loss]"},
+		{"sustained low-grade loss", func(seq int) bool { return seq%40 == 0 }, "[window-loss]"},
+		{"long burst", func(seq int) bool { return seq >= 400 && seq < 410 }, "[consecutive-loss window-loss]"},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, scenario := range scenarios {
+		loss := NewLossTracker(time.Second, 2*time.Second, time.Minute, time.Minute)
+		loss.Retain(5 * time.Minute)
+		alerts := NewLossAlerts(LossCriteria{Consecutive: 3, WindowLoss: 0.01, Window: 5 * time.Minute}, time.Second)
+
+		fired := map[string]bool{}
+		open := map[string]bool{}
+		for seq := 1; seq <= 900; seq++ {
+			now := start.Add(time.Duration(seq) * time.Second)
+			if !scenario.lost(seq) {
+				loss.Reply(seq, now)
+			}
+			loss.Advance(now)
+
+			for _, transition := range alerts.Evaluate(loss, now) {
+				if transition.Firing == open[transition.Criterion] {
+					t.Fatalf("%s: transitions alternate: expected open then resolve, got %s firing=%t twice", scenario.name, transition.Criterion, transition.Firing)
+				}
+				open[transition.Criterion] = transition.Firing
+				if transition.Firing {
+					fired[transition.Criterion] = true
+				}
+			}
+		}
+
+		var actual []string
+		for _, criterion := range []string{CONSECUTIVE_LOSS, WINDOW_LOSS} {
+			if fired[criterion] {
+				actual = append(actual, criterion)
+			}
+		}
+		if fmt.Sprint(actual) != scenario.expected {
+			t.Fatalf("%s: alerts fired: expected %q, got %v", scenario.name, scenario.expected, actual)
+		}
+
+		if open[CONSECUTIVE_LOSS] {
+			t.Fatalf("%s: consecutive alert resolved once replies resume: expected resolved, got still firing", scenario.name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package stats
+
+import "time"
+
+type rttSample struct {
+	at  time.Time
+	rtt time.Duration
+}
+
+// MinRTT tracks the lowest RTT seen within a sliding horizon, the usual
+// estimate of propagation delay. Samples are kept in a monotonic deque so
+// that each one is pushed and popped at most once.
+type MinRTT struct {
+	horizon time.Duration
+	samples []rttSample
+	head    int
+}
+
+func NewMinRTT(horizon time.Duration) *MinRTT {
+	return &MinRTT{horizon: horizon}
+}
+
+func (m *MinRTT) Record(at time.Time, rtt time.Duration) {
+	for len(m.samples) > m.head && m.samples[len(m.samples)-1].rtt >= rtt {
+		m.samples = m.samples[:len(m.samples)-1]
+	}
+	m.samples = append(m.samples, rttSample{at: at, rtt: rtt})
+	m.expire(at)
+}
+
+func (m *MinRTT) expire(now time.Time) {
+	for m.head < len(m.samples) && now.Sub(m.samples[m.head].at) > m.horizon {
+		m.head++
+	}
+
+	if m.head > len(m.samples)/2 {
+		m.samples = append(m.samples[:0], m.samples[m.head:]...)
+		m.head = 0
+	}
+}
+
+// reset forgets every sample, for a baseline to be found afresh.
+func (m *MinRTT) reset() {
+	m.samples, m.head = m.samples[:0], 0
+}
+
+// Min returns the baseline at the time of the most recent sample, or false
+// if nothing has been recorded within the horizon.
+func (m *MinRTT) Min() (time.Duration, bool) {
+	if m.head >= len(m.samples) {
+		return 0, false
+	}
+
+	return m.samples[m.head].rtt, true
+}
+
+// QueueDelay is how far rtt sits above the baseline.
+func (m *MinRTT) QueueDelay(rtt time.Duration) time.Duration {
+	baseline, ok := m.Min()
+	if !ok || rtt < baseline {
+		return 0
+	}
+
+	return rtt - baseline
+}
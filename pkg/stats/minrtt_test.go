@@ -0,0 +1,41 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestMinRTT compares the baseline deque against a brute-force
+// minimum over the same sliding horizon.
+func TestMinRTT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	horizon := 30 * time.Second
+	baseline := NewMinRTT(horizon)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type sample struct {
+		at       time.Time
+		duration time.Duration
+	}
+	var history []sample
+
+	for i := 0; i < 5000; i++ {
+		now = now.Add(time.Duration(1+rng.Intn(3000)) * time.Millisecond)
+		rtt := time.Duration(5+rng.Intn(100)) * time.Millisecond
+		baseline.Record(now, rtt)
+		history = append(history, sample{at: now, duration: rtt})
+
+		expected := time.Duration(math.MaxInt64)
+		for _, h := range history {
+			if now.Sub(h.at) <= horizon && h.duration < expected {
+				expected = h.duration
+			}
+		}
+
+		if actual, _ := baseline.Min(); actual != expected {
+			t.Fatalf("sample %d: windowed minimum: expected %s, got %s", i, expected, actual)
+		}
+	}
+}
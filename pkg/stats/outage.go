@@ -0,0 +1,157 @@
+package stats
+
+import "time"
+
+const DEFAULT_OUTAGE_PROBES = 3
+
+// Outage is a run of probes lost in a row long enough to count as the path
+// being down. End is nil while it's still going.
+type Outage struct {
+	Start time.Time
+	End   *time.Time
+	Lost  int
+}
+
+func (o Outage) Ongoing() bool {
+	return o.End == nil
+}
+
+// Length is how long the outage lasted, or has lasted by now while it's
+// still going.
+func (o Outage) Length(now time.Time) time.Duration {
+	if o.End != nil {
+		return o.End.Sub(o.Start)
+	}
+
+	return now.Sub(o.Start)
+}
+
+// OutageTracker opens an outage once threshold probes in a row are lost,
+// and closes it on the next reply. Each outage starts when the first of
+// those probes went out, taken as an interval after the last reply, or the
+// start of the run when nothing has replied yet.
+type OutageTracker struct {
+	threshold int
+	interval  time.Duration
+	now       func() time.Time
+
+	from    time.Time
+	streak  int
+	outages []Outage
+	// replied is when the first reply not yet settled came in, which is when
+	// an outage it closes ended, however long the probes before it take to.
+	replied time.Time
+}
+
+func NewOutageTracker(threshold int, interval time.Duration, now func() time.Time) *OutageTracker {
+	return &OutageTracker{threshold: threshold, interval: interval, now: now, from: now()}
+}
+
+func (t *OutageTracker) Threshold() int {
+	return t.threshold
+}
+
+func (t *OutageTracker) SetInterval(interval time.Duration) {
+	t.interval = interval
+}
+
+// Outcome takes each probe's fate in sequence order, as a LossTracker
+// observer.
+func (t *OutageTracker) Outcome(seq int, lost bool) {
+	now := t.now()
+	if !lost {
+		if !t.replied.IsZero() && t.replied.Before(now) {
+			now = t.replied
+		}
+		t.replied = time.Time{}
+		if t.streak >= t.threshold {
+			o := &t.outages[len(t.outages)-1]
+			end := later(now, o.Start)
+			o.End = &end
+		}
+		t.streak = 0
+		t.from = now.Add(t.interval)
+		return
+	}
+
+	t.streak++
+	switch {
+	case t.streak == t.threshold:
+		// A probe sent early, or a reply that took longer than usual, can put
+		// the first one lost before it was due.
+		start := t.from
+		if now.Before(start) {
+			start = now
+		}
+		t.outages = append(t.outages, Outage{Start: start, Lost: t.streak})
+	case t.streak > t.threshold:
+		t.outages[len(t.outages)-1].Lost = t.streak
+	}
+}
+
+// Replied is told of each reply as it comes in, before its fate settles.
+func (t *OutageTracker) Replied() {
+	if t.replied.IsZero() {
+		t.replied = t.now()
+	}
+}
+
+// Lost counts a probe lost that no LossTracker will, since it has yet to
+// see a reply to count from.
+func (t *OutageTracker) Lost() {
+	t.Outcome(0, true)
+}
+
+// Interrupt ends any outage now and starts counting afresh, for when
+// probing is paused on purpose, which isn't the path going down.
+func (t *OutageTracker) Interrupt() {
+	now := t.now()
+	if t.streak >= t.threshold {
+		o := &t.outages[len(t.outages)-1]
+		end := later(now, o.Start)
+		o.End = &end
+	}
+	t.streak = 0
+	t.from = now
+}
+
+// Restore takes up the outages another tracker saw over the same run. One
+// still going is left out, to be found again from the probes lost.
+func (t *OutageTracker) Restore(outages []Outage) {
+	for _, o := range outages {
+		if !o.Ongoing() {
+			t.outages = append(t.outages, o)
+		}
+	}
+}
+
+// Open is the outage still going, if there is one.
+func (t *OutageTracker) Open() *Outage {
+	if t.streak < t.threshold {
+		return nil
+	}
+
+	return &t.outages[len(t.outages)-1]
+}
+
+// Outages lists every outage in the run so far, oldest first.
+func (t *OutageTracker) Outages() []Outage {
+	return t.outages
+}
+
+func later(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+// Reset forgets every outage and starts counting afresh, for when the run's
+// figures are started over.
+func (t *OutageTracker) Reset() {
+	t.outages = nil
+	t.streak = 0
+	t.from = t.now()
+	t.replied = time.Time{}
+}
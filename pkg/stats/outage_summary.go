@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// OutageSummary is an outage as the summaries carry it, with one still
+// going at the time measured up to then.
+type OutageSummary struct {
+	Start   time.Time  `json:"start"`
+	End     *time.Time `json:"end,omitempty"`
+	LengthS float64    `json:"length_s"`
+	Lost    int        `json:"probes_lost"`
+	Ongoing bool       `json:"ongoing"`
+}
+
+func (s *Stats) OutageSummaries() []OutageSummary {
+	if s.Outages == nil {
+		return nil
+	}
+
+	now := s.Now()
+	var summaries []OutageSummary
+	for _, o := range s.Outages.Outages() {
+		summary := OutageSummary{Start: Stored(o.Start), LengthS: o.Length(now).Seconds(), Lost: o.Lost, Ongoing: o.Ongoing()}
+		if o.End != nil {
+			end := Stored(*o.End)
+			summary.End = &end
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// lostUncounted counts a timeout towards an outage while the loss tracker
+// has nothing to count it from, as when the host has yet to reply at all.
+func (s *Stats) lostUncounted() {
+	if s.Outages == nil || s.Loss.Started() {
+		return
+	}
+
+	s.Outages.Lost()
+	s.checkOutages()
+}
+
+// checkOutages logs each outage as it opens and again as it closes.
+func (s *Stats) checkOutages() {
+	if s.Outages == nil {
+		return
+	}
+
+	outages := s.Outages.Outages()
+	for ; s.OutagesOpened < len(outages); s.OutagesOpened++ {
+		o := outages[s.OutagesOpened]
+		s.AddEvent("outage", fmt.Sprintf("%d probes lost in a row, down since %s", o.Lost, s.Times.Clock(o.Start)))
+	}
+	for ; s.OutagesClosed < len(outages) && !outages[s.OutagesClosed].Ongoing(); s.OutagesClosed++ {
+		o := outages[s.OutagesClosed]
+		s.AddEvent("outage", fmt.Sprintf("back up after %s, %d probes lost", formatOutage(o.Length(s.Now())), o.Lost))
+	}
+}
+
+func formatOutage(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+
+	return d.Round(time.Second).String()
+}
+
+func (s *Stats) PrintOutage(t theme.Theme, o Outage) string {
+	line := fmt.Sprintf("%s  %10s  %d probes lost", s.Times.Clock(o.Start), formatOutage(o.Length(s.Now())), o.Lost)
+	if o.Ongoing() {
+		return t.Alert.Render(line + ", ongoing")
+	}
+
+	return line
+}
+
+// PrintOutages is the summary tab's line on the outages, or nothing before
+// the first.
+func (s *Stats) PrintOutages(t theme.Theme) string {
+	if s.Outages == nil || len(s.Outages.Outages()) == 0 {
+		return ""
+	}
+
+	outages := s.Outages.Outages()
+	var longest time.Duration
+	for _, o := range outages {
+		longest = max(longest, o.Length(s.Now()))
+	}
+
+	line := fmt.Sprintf("Outages: %d, longest %s", len(outages), formatOutage(longest))
+	if open := s.Outages.Open(); open != nil {
+		return line + ", " + t.Alert.Render(fmt.Sprintf("down since %s (%s)", s.Times.Clock(open.Start), formatOutage(open.Length(s.Now()))))
+	}
+
+	last := outages[len(outages)-1]
+	return line + fmt.Sprintf(", last at %s for %s", s.Times.Clock(last.Start), formatOutage(last.Length(s.Now())))
+}
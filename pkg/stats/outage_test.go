@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// TestOutages runs a host that doesn't answer its first probes, then
+// drops out for 20s, loses two in a row, is paused while down and is down
+// again at the end, checking each outage is timed from its first lost probe
+// and that short runs of loss don't count.
+func TestOutages(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+	s.Loss = NewLossTracker(time.Second, 2*time.Second, 5*time.Second, time.Minute)
+	s.Outages = NewOutageTracker(3, time.Second, s.Clock)
+	s.Loss.Observe(s.Outages.Outcome)
+
+	down := func(second int) bool {
+		return second <= 4 || second >= 100 && second < 120 || second == 150 || second == 151 || second >= 200 && second < 230 || second >= 280
+	}
+	for second := 0; second < 300; second++ {
+		now = start.Add(time.Duration(second) * time.Second)
+		s.AdvanceLoss()
+		switch second {
+		case 210:
+			s.Pause("paused by hand", false)
+		case 220:
+			s.Resume("resumed by hand")
+		}
+		if s.Paused != nil {
+			continue
+		}
+
+		result := ping.Result{Seq: second + 1, Epoch: 1, Duration: 10 * time.Millisecond}
+		if down(second) {
+			result = ping.Result{Seq: second + 1, Epoch: 1, Lost: true, Reason: ping.LOSS_TIMEOUT}
+		}
+		s.Observe(result)
+	}
+	s.AdvanceLoss()
+
+	var got []string
+	for _, o := range s.OutageSummaries() {
+		state := "ended"
+		if o.Ongoing {
+			state = "ongoing"
+		}
+		got = append(got, fmt.Sprintf("%s for %gs, %d lost, %s", o.Start.Sub(start), o.LengthS, o.Lost, state))
+	}
+	// The loss tracker settles a lost probe once its 2s timeout has passed,
+	// so the outage at the end has only seen the probes from before then.
+	want := []string{
+		"0s for 5s, 5 lost, ended",
+		"1m40s for 20s, 20 lost, ended",
+		"3m20s for 10s, 9 lost, ended",
+		"3m40s for 10s, 10 lost, ended",
+		"4m40s for 19s, 18 lost, ongoing",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("outages are timed from the first probe lost, to the next reply or a pause: expected %q, got %q", want, got)
+	}
+
+	var events []string
+	for _, event := range s.Events {
+		if event.Kind == "outage" {
+			events = append(events, event.Message)
+		}
+	}
+	if len(events) != 9 || events[0] != "3 probes lost in a row, down since "+s.Times.Clock(start) || events[1] != "back up after 5s, 5 probes lost" {
+		t.Fatalf("each outage is logged opening, and closing unless still going: expected 9 events, beginning with the first outage opening and closing, got %q", events)
+	}
+}
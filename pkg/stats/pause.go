@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// pauseGap is a stretch of the run when probing was stopped on purpose, so
+// that it isn't taken for an outage. End is nil while it's still going.
+type pauseGap struct {
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	Reason    string     `json:"reason"`
+	Automatic bool       `json:"automatic"`
+	// Skipped counts the results that came in while paused, which are left
+	// out rather than counted as lost.
+	Skipped int `json:"results_skipped,omitempty"`
+}
+
+const (
+	PAUSE_START = "pause_start"
+	PAUSE_END   = "pause_end"
+)
+
+// PauseMark is a pause starting or ending, as the exports record it between
+// the samples either side.
+type PauseMark struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Reason string    `json:"reason"`
+}
+
+// Pause stops counting loss until Resume, forgetting the probes still
+// awaiting a reply, since they were abandoned rather than lost.
+func (s *Stats) Pause(reason string, automatic bool) {
+	if s.Paused != nil {
+		return
+	}
+
+	s.Loss.Pause()
+	if s.Outages != nil {
+		s.Outages.Interrupt()
+		s.checkOutages()
+	}
+	s.Paused = &pauseGap{Start: Stored(s.Now()), Reason: reason, Automatic: automatic}
+	s.Marks = append(s.Marks, PauseMark{Time: s.Paused.Start, Event: PAUSE_START, Reason: reason})
+	s.AddEvent("pause", "probing paused: "+reason)
+}
+
+func (s *Stats) Resume(reason string) {
+	if s.Paused == nil {
+		return
+	}
+
+	if s.Outages != nil {
+		s.Outages.Interrupt()
+	}
+	end := Stored(s.Now())
+	gap := *s.Paused
+	gap.End = &end
+	s.Pauses = append(s.Pauses, gap)
+	s.Paused = nil
+	s.Marks = append(s.Marks, PauseMark{Time: end, Event: PAUSE_END, Reason: reason})
+	s.AddEvent("resume", fmt.Sprintf("probing resumed after %s: %s", end.Sub(gap.Start).Round(time.Second), reason))
+}
+
+// PauseGaps lists the pauses so far, including one still going.
+func (s *Stats) PauseGaps() []pauseGap {
+	gaps := s.Pauses
+	if s.Paused != nil {
+		gaps = append(gaps[:len(gaps):len(gaps)], *s.Paused)
+	}
+
+	return gaps
+}
+
+// PausedTime is how much of from to to probing spent paused.
+func (s *Stats) PausedTime(from time.Time, to time.Time) time.Duration {
+	var paused time.Duration
+	for _, gap := range s.PauseGaps() {
+		end := to
+		if gap.End != nil {
+			end = *gap.End
+		}
+		if start, end := later(gap.Start, from), earlier(end, to); end.After(start) {
+			paused += end.Sub(start)
+		}
+	}
+
+	return paused
+}
+
+func earlier(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// Availability is the share of the time probed that wasn't lost, going by
+// the interval each lost probe stood for. Paused time is neither up nor
+// down, so it's taken out of the time probed rather than counted as up.
+func (s *Stats) Availability(now time.Time) (float64, time.Duration, time.Duration) {
+	paused := s.PausedTime(s.Started, now)
+	probed := now.Sub(s.Started) - paused
+	if probed <= 0 {
+		return 1, 0, paused
+	}
+
+	return max(0, 1-float64(s.Loss.LostTime())/float64(probed)), probed, paused
+}
+
+func (s *Stats) PrintAvailability() string {
+	availability, probed, paused := s.Availability(s.Now())
+	line := fmt.Sprintf("availability %.2f%% over %s probed", availability*100, probed.Round(time.Second))
+	if paused > 0 {
+		line += fmt.Sprintf(", %s paused", paused.Round(time.Second))
+	}
+
+	return line
+}
+
+func (s *Stats) PrintPause(t theme.Theme) string {
+	if s.Paused == nil {
+		return ""
+	}
+
+	line := fmt.Sprintf("Paused for %s: %s", s.Now().Sub(s.Paused.Start).Round(time.Second), s.Paused.Reason)
+	if s.Paused.Skipped > 0 {
+		line += fmt.Sprintf(", %d results skipped", s.Paused.Skipped)
+	}
+	if s.Paused.Automatic {
+		return t.Warn.Render(line + " (any key to resume until the network changes)")
+	}
+
+	return t.Warn.Render(line + " (any key to resume)")
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+const RESERVOIR_SIZE = 4096
+
+// reservoir keeps a uniform sample of every latency in the run however long
+// it goes on, for percentiles finer than the histogram's buckets and that
+// don't stop at its last threshold.
+type reservoir struct {
+	samples []time.Duration
+	seen    int
+}
+
+func (r *reservoir) Add(duration time.Duration) {
+	r.seen++
+	if len(r.samples) < RESERVOIR_SIZE {
+		r.samples = append(r.samples, duration)
+		return
+	}
+
+	if i := rand.Intn(r.seen); i < RESERVOIR_SIZE {
+		r.samples[i] = duration
+	}
+}
+
+func (r *reservoir) Reset() {
+	r.samples = nil
+	r.seen = 0
+}
+
+// Percentile is the q-th percentile, from 0 to 100, of the run's latency,
+// or zero before there's been a reply.
+func (s *Stats) Percentile(q float64) time.Duration {
+	if len(s.reservoir.samples) == 0 {
+		return 0
+	}
+
+	samples := slices.Clone(s.reservoir.samples)
+	slices.Sort(samples)
+
+	index := int(math.Ceil(q/100*float64(len(samples)))) - 1
+	return samples[min(max(index, 0), len(samples)-1)]
+}
+
+// PrintPercentiles goes on the end of the totals line.
+func (s *Stats) PrintPercentiles() string {
+	if len(s.reservoir.samples) == 0 {
+		return fmt.Sprintf(", p50: %8s, p90: %8s, p99: %8s", "-", "-", "-")
+	}
+
+	return fmt.Sprintf(", p50: %8s, p90: %8s, p99: %8s", FormatLatency(s.Percentile(50)), FormatLatency(s.Percentile(90)), FormatLatency(s.Percentile(99)))
+}
@@ -0,0 +1,110 @@
+package stats
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPercentile checks the run's percentiles with no replies, with
+// every reply the same, and with the slowest far past the last histogram
+// bucket, then that the reservoir stays bounded but representative over a
+// long run and comes back with a resumed one.
+func TestPercentile(t *testing.T) {
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	if p := s.Percentile(50); p != 0 || !strings.Contains(s.String(), "p50:        -") {
+		t.Fatalf("there are no percentiles before a reply: expected 0 and a dash, got %s in %q", p, s.String())
+	}
+
+	for range 100 {
+		s.Update(20 * time.Millisecond)
+	}
+	for _, q := range []float64{0, 50, 90, 99, 100} {
+		if p := s.Percentile(q); p != 20*time.Millisecond {
+			t.Fatalf("every percentile of identical samples is that sample: expected p%.0f 20ms, got %q", q, p.String())
+		}
+	}
+
+	s = New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	for i := range 100 {
+		if i%10 == 0 {
+			s.Update(5 * time.Second)
+		} else {
+			s.Update(10 * time.Millisecond)
+		}
+	}
+	largest := DEFAULT_THRESHOLDS[len(DEFAULT_THRESHOLDS)-1]
+	if p50, p90, p99 := s.Percentile(50), s.Percentile(90), s.Percentile(99); p50 != 10*time.Millisecond || p90 != 10*time.Millisecond || p99 != 5*time.Second {
+		t.Fatalf("percentiles aren't capped at the %dms bucket: expected p50 10ms, p90 10ms, p99 5s, got p50 %s, p90 %s, p99 %s", largest, p50, p90, p99)
+	}
+	if line := strings.Split(s.String(), "\n")[1]; !strings.Contains(line, "p50:   10.0ms, p90:   10.0ms, p99:    5.00s") {
+		t.Fatalf("the percentiles are shown beside the totals: expected p50, p90 and p99 on the totals line, got %q", line)
+	}
+
+	s = New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	for i := range 3 * RESERVOIR_SIZE {
+		s.Update(time.Duration(i%1000) * time.Millisecond)
+	}
+	if len(s.reservoir.samples) != RESERVOIR_SIZE {
+		t.Fatalf("the reservoir stays the same size however long the run: expected %d samples, got %d", RESERVOIR_SIZE, len(s.reservoir.samples))
+	}
+	if p50 := s.Percentile(50); p50 < 450*time.Millisecond || p50 > 550*time.Millisecond {
+		t.Fatalf("the reservoir is a fair sample of the whole run: expected p50 within 50ms of 500ms, got %q", p50.String())
+	}
+
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "state.json")
+	if err := SaveState(path, &s); err != nil {
+		t.Fatalf("the state file saves: expected no error, got %v", err)
+	}
+	resumed := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	if err := ResumeState(path, &resumed); err != nil {
+		t.Fatalf("the state file resumes: expected no error, got %v", err)
+	}
+	if resumed.Percentile(99) != s.Percentile(99) || resumed.reservoir.seen != 3*RESERVOIR_SIZE {
+		t.Fatalf("a resumed run keeps its percentiles: expected p99 %s after %d samples, got p99 %s after %d", s.Percentile(99), 3*RESERVOIR_SIZE, resumed.Percentile(99), resumed.reservoir.seen)
+	}
+}
+
+// TestSubMillisecond feeds replies of 350µs through, as from the
+// loopback or a LAN, which whole milliseconds had as zeros, and checks a
+// window and the reservoir keep them through the state file while still
+// reading one written in whole milliseconds.
+func TestSubMillisecond(t *testing.T) {
+	sample := 350 * time.Microsecond
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	for range 10 {
+		s.Update(sample)
+	}
+
+	w := s.Window
+	if w.Min != sample || w.Average() != sample || w.Max != sample {
+		t.Fatalf("min, avg and max keep the microseconds: expected 350µs throughout, got %s, %s, %s", w.Min, w.Average(), w.Max)
+	}
+	if line := RenderWindow(&w, nil, nil); strings.Count(line, "350µs") != 3 {
+		t.Fatalf("the window shows them in microseconds: expected Min, Max and Avg of 350µs, got %q", line)
+	}
+	if s.Histogram.Buckets()[1] != 10 {
+		t.Fatalf("they go in the bucket up to 500µs: expected 10 in bucket 1, got %v", s.Histogram.Buckets())
+	}
+	if p50 := s.Percentile(50); p50 != sample {
+		t.Fatalf("the reservoir keeps the microseconds: expected p50 350µs, got %q", p50.String())
+	}
+
+	var stored Window
+	if data, err := json.Marshal(w); err != nil || json.Unmarshal(data, &stored) != nil || stored != w {
+		t.Fatalf("a window is the same read back: expected %+v, got %+v", w, stored)
+	}
+
+	var old Window
+	if err := json.Unmarshal([]byte(`{"Min":12,"Max":40,"Total":260,"Count":10,"Mean":26,"M2":0,"Last":20,"Swing":50}`), &old); err != nil || old.Min != 12*time.Millisecond || old.Average() != 26*time.Millisecond || old.Jitter() != 50*time.Millisecond/9 {
+		t.Fatalf("a window stored in whole milliseconds still reads: expected 12ms min, 26ms avg, got %+v, %v", old, err)
+	}
+	if reservoir := (RunState{Reservoir: []int64{12, 40}}).reservoir(); !slices.Equal(reservoir, []time.Duration{12 * time.Millisecond, 40 * time.Millisecond}) {
+		t.Fatalf("a reservoir stored in whole milliseconds still reads: expected [12ms 40ms], got %v", reservoir)
+	}
+}
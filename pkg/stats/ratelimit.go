@@ -0,0 +1,117 @@
+package stats
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	RATE_LIMIT_DROPS    = 6
+	RATE_LIMIT_MIN_GAP  = 3
+	RATE_LIMIT_RTTS     = 60
+	RATE_LIMIT_MIN_RTTS = 10
+	RATE_LIMIT_MAX_CV   = 0.25
+)
+
+// RateLimitDetector looks for the loss a router rate-limiting ICMP tends to
+// produce: single drops at a steady spacing, while the probes that do get
+// through see flat latency. Congestion loss comes in bursts at irregular
+// spacing with latency climbing alongside it.
+type RateLimitDetector struct {
+	drops []int
+	last  int
+	seen  int
+	rtts  []float64
+}
+
+func NewRateLimitDetector() *RateLimitDetector {
+	return &RateLimitDetector{last: -1}
+}
+
+// Reset forgets the drops seen so far, for when the sequence starts over.
+func (d *RateLimitDetector) Reset() {
+	d.drops = d.drops[:0]
+	d.last = -1
+}
+
+// Outcome takes each probe's fate in sequence order.
+func (d *RateLimitDetector) Outcome(seq int, lost bool) {
+	d.seen = seq
+	if !lost {
+		return
+	}
+
+	// A loss right after another is a burst, which rate limiting with a
+	// steady probe rate doesn't produce, so start over.
+	if d.last >= 0 && seq == d.last+1 {
+		d.drops = d.drops[:0]
+	}
+	d.last = seq
+
+	d.drops = append(d.drops, seq)
+	if len(d.drops) > RATE_LIMIT_DROPS {
+		d.drops = d.drops[1:]
+	}
+}
+
+func (d *RateLimitDetector) RTT(rtt time.Duration) {
+	d.rtts = append(d.rtts, float64(rtt))
+	if len(d.rtts) > RATE_LIMIT_RTTS {
+		d.rtts = d.rtts[1:]
+	}
+}
+
+// Period returns the spacing of the drops in probes when the recent pattern
+// looks like rate limiting, or zero when it doesn't.
+func (d *RateLimitDetector) Period() int {
+	if len(d.drops) < RATE_LIMIT_DROPS || len(d.rtts) < RATE_LIMIT_MIN_RTTS {
+		return 0
+	}
+
+	gaps := make([]int, 0, len(d.drops)-1)
+	for i := 1; i < len(d.drops); i++ {
+		gaps = append(gaps, d.drops[i]-d.drops[i-1])
+	}
+
+	sorted := slices.Clone(gaps)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	if median < RATE_LIMIT_MIN_GAP {
+		return 0
+	}
+
+	tolerance := max(1, median/10)
+	if sorted[0] < median-tolerance || sorted[len(sorted)-1] > median+tolerance {
+		return 0
+	}
+
+	// The pattern has to still be going on.
+	if d.seen-d.drops[len(d.drops)-1] > median+tolerance {
+		return 0
+	}
+
+	if coefficientOfVariation(d.rtts) > RATE_LIMIT_MAX_CV {
+		return 0
+	}
+
+	return median
+}
+
+func coefficientOfVariation(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(squares/float64(len(values))) / mean
+}
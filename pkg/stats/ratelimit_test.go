@@ -0,0 +1,51 @@
+package stats
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestRateLimit plays synthetic loss patterns through the loss
+// tracker into the rate-limit detector and checks the drop period it reports
+// at the end, zero meaning no rate-limiting suspected.
+func TestRateLimit(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	flat := func() time.Duration { return time.Duration(20000+rng.Intn(2000)) * time.Microsecond }
+	jittery := func() time.Duration { return time.Duration(5+rng.Intn(60)) * time.Millisecond }
+
+	scenarios := []struct {
+		name     string
+		lost     func(seq int) bool
+		rtt      func() time.Duration
+		expected int
+	}{
+		{"every 10th dropped, flat latency", func(seq int) bool { return seq%10 == 0 }, flat, 10},
+		{"every 25th dropped, flat latency", func(seq int) bool { return seq%25 == 0 }, flat, 25},
+		{"random drops", func(seq int) bool { return rng.Intn(10) == 0 }, flat, 0},
+		{"every 10th dropped, jittery latency", func(seq int) bool { return seq%10 == 0 }, jittery, 0},
+		{"periodic pairs", func(seq int) bool { return seq%10 == 0 || seq%10 == 1 }, flat, 0},
+		{"periodic drops that stopped", func(seq int) bool { return seq < 200 && seq%10 == 0 }, flat, 0},
+		{"no loss", func(seq int) bool { return false }, flat, 0},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, scenario := range scenarios {
+		loss := NewLossTracker(time.Second, 2*time.Second, time.Minute, time.Minute)
+		detector := NewRateLimitDetector()
+		loss.Observe(detector.Outcome)
+
+		for seq := 1; seq <= 300; seq++ {
+			now := start.Add(time.Duration(seq) * time.Second)
+			if !scenario.lost(seq) {
+				loss.Reply(seq, now)
+				detector.RTT(scenario.rtt())
+			}
+			loss.Advance(now)
+		}
+
+		if actual := detector.Period(); actual != scenario.expected {
+			t.Fatalf("%s: expected %v, got %v", scenario.name, scenario.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// changeMarker is a change made on purpose, such as toggling a VPN, that the
+// run times the connection's recovery from.
+type changeMarker struct {
+	at   time.Time
+	note string
+	// streak counts replies to consecutive probes, the last of which was
+	// seq.
+	streak int
+	seq    int
+}
+
+type recovery struct {
+	marked time.Time
+	took   time.Duration
+}
+
+// MarkChange starts timing a recovery. A marker made while another is still
+// waiting replaces it, so that recovery is put down to the latest change.
+func (s *Stats) MarkChange(note string) {
+	message := "change marked"
+	if note != "" {
+		message += ": " + note
+	}
+	if s.marker != nil {
+		message += fmt.Sprintf(", replacing the one at %s", s.Times.Clock(s.marker.at))
+	}
+
+	s.marker = &changeMarker{at: s.Now(), note: note}
+	s.AddEvent("change", message)
+}
+
+// recoveryReply counts a reply towards --recovery-probes, starting over
+// whenever it isn't for the probe after the last one, so that a probe that
+// is lost, or still awaiting its reply, breaks the run.
+func (s *Stats) recoveryReply(seq int) {
+	if s.marker == nil || s.RecoveryProbes == 0 {
+		return
+	}
+
+	// icmp_seq wraps at 16 bits.
+	if s.marker.streak > 0 && seq == (s.marker.seq+1)%(1<<16) {
+		s.marker.streak++
+	} else {
+		s.marker.streak = 1
+	}
+	s.marker.seq = seq
+
+	if s.marker.streak >= s.RecoveryProbes {
+		s.recovered(s.Now())
+	}
+}
+
+// recoveryWindow checks a window that has just closed, when recovery is
+// judged by windows. Only windows begun after the change count, so that
+// samples from before it can't make it look recovered.
+func (s *Stats) recoveryWindow(start time.Time, end time.Time) {
+	if s.marker == nil || s.RecoveryProbes > 0 || start.Before(s.marker.at) {
+		return
+	}
+
+	if s.windowGood(end) {
+		s.recovered(end)
+	}
+}
+
+// windowGood reports whether the last window met every threshold the run was
+// given: the window loss alert, the SLO latency and the expected latency.
+// With none given, it only needs to have lost nothing.
+func (s *Stats) windowGood(end time.Time) bool {
+	if s.LastWindow.Count == 0 {
+		return false
+	}
+
+	limit := 0.0
+	if s.LossAlerts != nil {
+		limit = s.LossAlerts.Criteria().WindowLoss
+	}
+	if rolling, _, _ := s.Loss.Rolling(end); rolling > limit {
+		return false
+	}
+
+	if s.SLO != nil && len(s.windowP95s) > 0 && s.windowP95s[len(s.windowP95s)-1] > s.SLO.SLO().Threshold {
+		return false
+	}
+
+	if s.Expected > 0 && s.LastHeadline > s.Expected {
+		return false
+	}
+
+	return true
+}
+
+func (s *Stats) recovered(at time.Time) {
+	took := at.Sub(s.marker.at)
+	s.lastRecovery = &recovery{marked: s.marker.at, took: took}
+	s.AddEvent("recovery", fmt.Sprintf("recovered in %s after the change marked at %s", took.Round(100*time.Millisecond), s.Times.Clock(s.marker.at)))
+	s.marker = nil
+}
+
+func (s *Stats) PrintRecovery(t theme.Theme) string {
+	if s.marker != nil {
+		waiting := "a good window"
+		if s.RecoveryProbes > 0 {
+			waiting = fmt.Sprintf("%d/%d replies in a row", s.marker.streak, s.RecoveryProbes)
+		}
+
+		line := fmt.Sprintf("Recovery: waiting %s since the change at %s", s.Now().Sub(s.marker.at).Round(time.Second), s.Times.Clock(s.marker.at))
+		if s.marker.note != "" {
+			line += " (" + s.marker.note + ")"
+		}
+
+		return t.Warn.Render(line + ", for " + waiting)
+	}
+
+	if s.lastRecovery != nil {
+		return t.Good.Render(fmt.Sprintf("Recovery: recovered in %s after the change at %s", s.lastRecovery.took.Round(100*time.Millisecond), s.Times.Clock(s.lastRecovery.marked)))
+	}
+
+	return ""
+}
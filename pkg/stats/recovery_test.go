@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// TestRecovery marks changes on a run with a fake clock and checks
+// when recovery is reported: not for a window begun before the change, from
+// the latest of two markers, and only after replies in a row once a probe
+// has been lost.
+func TestRecovery(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Times = TimeFormat{mode: TIME_UTC}
+	s.WindowStart = now
+	s.Loss = NewLossTracker(time.Second, 2*time.Second, 5*time.Second, time.Minute)
+	s.SlowWindow = NewTopN(3)
+	s.SlowTotals = NewTopN(3)
+
+	at := func(seconds float64) {
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(seconds * float64(time.Second)))
+	}
+	reply := func(seq int) {
+		at(float64(seq))
+		s.AdvanceLoss()
+		s.Observe(ping.Result{Seq: seq, Epoch: 1, Duration: 10 * time.Millisecond})
+		s.Update(10 * time.Millisecond)
+	}
+	recoveries := func() []string {
+		var messages []string
+		for _, event := range s.Events {
+			if event.Kind == "recovery" {
+				messages = append(messages, event.Message)
+			}
+		}
+		return messages
+	}
+
+	steps := []struct {
+		name     string
+		apply    func()
+		expected string
+	}{
+		{"window begun before the change", func() {
+			reply(1)
+			reply(2)
+			at(2.5)
+			s.MarkChange("wifi")
+			for seq := 3; seq <= 6; seq++ {
+				reply(seq)
+			}
+		}, ""},
+		{"first window after the change", func() {
+			for seq := 7; seq <= 12; seq++ {
+				reply(seq)
+			}
+		}, "recovered in 7.5s after the change marked at 00:00:02 UTC"},
+		{"latest of two markers", func() {
+			s.Events = nil
+			s.RecoveryProbes = 3
+			for seq := 13; seq <= 20; seq++ {
+				reply(seq)
+			}
+			at(20.5)
+			s.MarkChange("")
+			reply(21)
+			at(21.5)
+			s.MarkChange("")
+			reply(22)
+			reply(23)
+			reply(24)
+		}, "recovered in 2.5s after the change marked at 00:00:21 UTC"},
+		{"loss starts the count over", func() {
+			s.Events = nil
+			at(24.5)
+			s.MarkChange("")
+			reply(25)
+			reply(27)
+			reply(28)
+			reply(29)
+		}, "recovered in 4.5s after the change marked at 00:00:24 UTC"},
+	}
+
+	for _, step := range steps {
+		step.apply()
+		if actual := strings.Join(recoveries(), "; "); actual != step.expected {
+			t.Fatalf("%s: expected %q, got %q", step.name, step.expected, actual)
+		}
+	}
+}
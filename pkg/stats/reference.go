@@ -0,0 +1,266 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// ReferenceProfile is the latency distribution of an earlier run, which the
+// histogram is drawn against and each window compared with.
+type ReferenceProfile struct {
+	path      string
+	histogram Histogram
+	// rebucketed is set when the reference's own buckets didn't match and
+	// its samples were sorted into this run's instead.
+	rebucketed bool
+	// Threshold is the divergence past which an incident opens, zero for
+	// never.
+	Threshold  float64
+	divergence float64
+	diverged   bool
+}
+
+// referenceFile is what's read from a reference: a state file or summary
+// has a histogram, and a results file its samples as well.
+type referenceFile struct {
+	Histogram *HistogramState `json:"histogram"`
+	Summary   *ResultsSummary `json:"summary"`
+	Samples   []ResultSample  `json:"samples"`
+}
+
+// LoadReference reads the histogram from a JSON summary, state file or
+// results file of an earlier run. Buckets that differ from thresholds are
+// rebuilt from the raw samples when the file, or the csv a summary sits
+// beside, has them.
+func LoadReference(path string, thresholds []time.Duration) (*ReferenceProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference: %s", err)
+	}
+
+	var file referenceFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		file, err = readReferenceLines(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse reference %s: %s", path, err)
+		}
+	}
+
+	state := file.Histogram
+	if state == nil && file.Summary != nil {
+		state = &file.Summary.Histogram
+	}
+	samples := file.Samples
+	if len(samples) == 0 && strings.HasSuffix(path, ".summary.json") {
+		samples, err = readReferenceCSV(strings.TrimSuffix(path, ".summary.json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	reference := &ReferenceProfile{path: path, histogram: NewHistogram(thresholds)}
+	switch {
+	case state != nil && slices.Equal(state.Bounds(), thresholds) && len(state.Buckets) == len(thresholds):
+		reference.histogram = state.Histogram()
+	case len(samples) > 0:
+		for _, sample := range samples {
+			if !sample.Lost && sample.RTTMs != nil {
+				reference.histogram.Update(time.Duration(*sample.RTTMs * float64(time.Millisecond)))
+			}
+		}
+		reference.rebucketed = state != nil
+	case state == nil:
+		return nil, fmt.Errorf("reference %s has no histogram, expected a JSON summary, state file or results file from an earlier run", path)
+	default:
+		return nil, fmt.Errorf("reference %s buckets latency at %s, not this run's %s, and has no raw samples to re-bucket; use the results file it summarises instead", path, FormatThresholds(state.Bounds()), FormatThresholds(thresholds))
+	}
+
+	if reference.histogram.Total() == 0 {
+		return nil, fmt.Errorf("reference %s has no replies in its histogram", path)
+	}
+
+	return reference, nil
+}
+
+// readReferenceLines reads a jsonl results file: a sample per line, then
+// the summary.
+func readReferenceLines(data []byte) (referenceFile, error) {
+	var file referenceFile
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line struct {
+			ResultSample
+			Summary *ResultsSummary `json:"summary"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return file, err
+		}
+
+		if line.Summary != nil {
+			file.Summary = line.Summary
+		} else {
+			file.Samples = append(file.Samples, line.ResultSample)
+		}
+	}
+
+	return file, scanner.Err()
+}
+
+// readReferenceCSV reads the samples of a csv results file.
+func readReferenceCSV(path string) ([]ResultSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("failed to read reference samples %s: %s", path, err)
+	}
+
+	var samples []ResultSample
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil || len(row) < 4 {
+			return nil, fmt.Errorf("failed to read reference samples %s: %v", path, err)
+		}
+
+		sample := ResultSample{Host: row[1], Lost: row[3] == "true"}
+		if rtt, err := strconv.ParseFloat(row[2], 64); err == nil {
+			sample.RTTMs = &rtt
+		}
+		samples = append(samples, sample)
+	}
+}
+
+func FormatThresholds(thresholds []time.Duration) string {
+	parts := make([]string, len(thresholds))
+	for i, threshold := range thresholds {
+		parts[i] = strconv.FormatFloat(Milliseconds(threshold), 'f', -1, 64)
+	}
+
+	return strings.Join(parts, "/") + "ms"
+}
+
+// divergence is the largest gap between two histograms' cumulative
+// distributions, from 0 when they match to 1 when they don't overlap at all.
+// It compares shares rather than counts, so that a window stands against a
+// whole run fairly.
+func divergence(a *Histogram, b *Histogram) float64 {
+	if a.Total() == 0 || b.Total() == 0 {
+		return 0
+	}
+
+	var below, reference, worst float64
+	for i := range len(a.Thresholds()) + 1 {
+		below += a.Share(i)
+		reference += b.Share(i)
+		worst = max(worst, math.Abs(below-reference))
+	}
+
+	return worst
+}
+
+// compareReference measures the window just ended against the reference,
+// opening an incident while it's further off than the threshold.
+func (s *Stats) compareReference() {
+	r := s.Reference
+	if s.Rolling.Total() < HISTOGRAM_MARKER_MIN_SAMPLES {
+		return
+	}
+
+	r.divergence = divergence(&s.Rolling, &r.histogram)
+	if r.Threshold == 0 {
+		return
+	}
+
+	diverged := r.divergence > r.Threshold
+	if diverged && !r.diverged {
+		s.openIncident("reference", fmt.Sprintf("latency distribution %.0f%% away from the reference, over the %.0f%% allowed", r.divergence*100, r.Threshold*100))
+	}
+	if !diverged && r.diverged {
+		s.resolveIncident("reference", "latency distribution back in line with the reference")
+	}
+
+	r.diverged = diverged
+}
+
+// cells is how many units bucket i of h and of the reference get, both
+// scaled against the larger of their fullest shares so that they compare.
+func (r *ReferenceProfile) cells(h *Histogram, i int, units int) (int, int) {
+	fullest := max(h.FullestShare(), r.histogram.FullestShare())
+	if fullest == 0 {
+		return 0, 0
+	}
+
+	return int(h.Share(i) / fullest * float64(units)), int(r.histogram.Share(i) / fullest * float64(units))
+}
+
+// bar draws bucket i of h with the reference's share showing past its end
+// in a lighter shade.
+func (r *ReferenceProfile) bar(t theme.Theme, h *Histogram, i int, width int) (string, float64) {
+	current, reference := r.cells(h, i, width)
+
+	bar := t.Bar.Render(strings.Repeat("█", current))
+	if reference > current {
+		bar += t.Muted.Render(strings.Repeat("░", reference-current))
+	}
+
+	return bar + strings.Repeat(" ", width-max(current, reference)), h.Share(i) * 100
+}
+
+// PrintReference compares the run's percentiles with the reference's, and
+// the last window's distribution with its.
+func (s *Stats) PrintReference(t theme.Theme) string {
+	r := s.Reference
+	source := r.path
+	if r.rebucketed {
+		source += ", re-bucketed"
+	}
+
+	line := fmt.Sprintf("Reference ░ (%s, %d replies): ", source, r.histogram.Total())
+	if s.Histogram.Total() < HISTOGRAM_MARKER_MIN_SAMPLES {
+		line += markerLegend(r.histogram.Markers())
+	} else {
+		var parts []string
+		for _, p := range HISTOGRAM_PERCENTILES {
+			current, reference := s.Histogram.Percentile(p), r.histogram.Percentile(p)
+			parts = append(parts, fmt.Sprintf("p%d %.1fms (%+.1fms)", p, Milliseconds(reference.Value), Milliseconds(current.Value-reference.Value)))
+		}
+		line += strings.Join(parts, ", ")
+	}
+
+	divergence := fmt.Sprintf("window %.0f%% off", r.divergence*100)
+	if r.Threshold > 0 {
+		divergence += fmt.Sprintf(", alert over %.0f%%", r.Threshold*100)
+	}
+	switch {
+	case r.diverged:
+		divergence = t.Alert.Render(divergence)
+	case r.Threshold > 0 && r.divergence > r.Threshold/2:
+		divergence = t.Warn.Render(divergence)
+	}
+
+	return line + " | " + divergence
+}
@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestReference loads references whose buckets match, which have to
+// be re-bucketed from their samples and which can't be, then checks a run
+// drifting away from one raises an incident that resolves when it returns.
+func TestReference(t *testing.T) {
+	dir := t.TempDir()
+
+	same := NewHistogram(DEFAULT_THRESHOLDS)
+	apart := NewHistogram(DEFAULT_THRESHOLDS)
+	for i := 0; i < 10; i++ {
+		same.Update(15 * time.Millisecond)
+		apart.Update(300 * time.Millisecond)
+	}
+	if d := divergence(&same, &same); d != 0 {
+		t.Fatalf("divergence of a histogram from itself: expected 0, got %v", d)
+	}
+	if d := divergence(&same, &apart); d != 1 {
+		t.Fatalf("divergence of histograms with no bucket in common: expected 1, got %v", d)
+	}
+
+	buckets := make([]int, len(DEFAULT_THRESHOLDS))
+	buckets[6] = 100
+	empty := NewHistogram(DEFAULT_THRESHOLDS)
+	files := map[string]string{
+		"state.json":              fmt.Sprintf(`{"run_id": "a", "histogram": {"thresholds": %s, "buckets": %s, "total": 100}}`, jsonOf(HistogramStateOf(&empty).Thresholds), jsonOf(buckets)),
+		"coarse.json":             `{"histogram": {"thresholds": [10, 100], "buckets": [4, 6], "total": 10}}`,
+		"coarse.jsonl":            "{\"time\": \"2026-01-01T00:00:00Z\", \"host\": \"h\", \"rtt_ms\": 3.5, \"lost\": false}\n{\"time\": \"2026-01-01T00:00:01Z\", \"host\": \"h\", \"rtt_ms\": null, \"lost\": true}\n{\"time\": \"2026-01-01T00:00:02Z\", \"host\": \"h\", \"rtt_ms\": 42.1, \"lost\": false}\n{\"summary\": {\"histogram\": {\"thresholds\": [10, 100], \"buckets\": [1, 1], \"total\": 2}}}\n",
+		"coarse.csv":              "time,host,rtt_ms,lost\n2026-01-01T00:00:00.000Z,h,150.000,false\n2026-01-01T00:00:01.000Z,h,,true\n",
+		"coarse.csv.summary.json": `{"histogram": {"thresholds": [10, 100], "buckets": [0, 0], "total": 1}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: expected no error, got %v", name, err)
+		}
+	}
+
+	matched, err := LoadReference(filepath.Join(dir, "state.json"), DEFAULT_THRESHOLDS)
+	if err != nil || matched.rebucketed || matched.histogram.Total() != 100 || matched.histogram.Buckets()[6] != 100 {
+		t.Fatalf("a state file with the same buckets: expected 100 replies at 20ms, as stored, got %+v, %v", matched, err)
+	}
+
+	if _, err := LoadReference(filepath.Join(dir, "coarse.json"), DEFAULT_THRESHOLDS); err == nil || !strings.Contains(err.Error(), "10/100ms") {
+		t.Fatalf("a summary with other buckets and no samples: expected an error naming both sets of buckets, got %v", err)
+	}
+
+	lines, err := LoadReference(filepath.Join(dir, "coarse.jsonl"), DEFAULT_THRESHOLDS)
+	if err != nil || !lines.rebucketed || lines.histogram.Total() != 2 || lines.histogram.Buckets()[4] != 1 || lines.histogram.Buckets()[7] != 1 {
+		t.Fatalf("a jsonl results file with other buckets: expected its two replies re-bucketed at 5ms and 50ms, got %+v, %v", lines, err)
+	}
+
+	csvSummary, err := LoadReference(filepath.Join(dir, "coarse.csv.summary.json"), DEFAULT_THRESHOLDS)
+	if err != nil || csvSummary.histogram.Total() != 1 || csvSummary.histogram.Buckets()[9] != 1 {
+		t.Fatalf("a csv summary with other buckets: expected the csv beside it re-bucketed, got %+v, %v", csvSummary, err)
+	}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(time.Second, 30*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = now
+	matched.Threshold = 0.3
+	s.Reference = matched
+
+	probe := func(count int, duration time.Duration) {
+		for i := 0; i < count; i++ {
+			now = now.Add(time.Second)
+			s.Update(duration)
+		}
+	}
+
+	probe(35, 60*time.Millisecond)
+	if incident := s.ActiveIncidentOf("reference"); incident == nil || matched.divergence != 1 {
+		t.Fatalf("a window entirely slower than the reference: expected an open reference incident at 100%% divergence, got divergence %.2f, incidents %+v", matched.divergence, s.Incidents)
+	}
+	if view := s.PrintReference(theme.Theme{}); !strings.Contains(view, "p50 15.0ms (+60.0ms)") || !strings.Contains(view, "window 100% off") {
+		t.Fatalf("the reference line: expected the p50 delta and the window's divergence, got %q", view)
+	}
+
+	probe(65, 15*time.Millisecond)
+	if s.ActiveIncidentOf("reference") != nil || matched.divergence != 0 {
+		t.Fatalf("windows back in line with the reference: expected the incident resolved, got divergence %.2f, incidents %+v", matched.divergence, s.Incidents)
+	}
+}
+
+func jsonOf(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"time"
+)
+
+// ResetTotals starts the run's totals over from now: the counts, the
+// histogram with its thresholds as they were, the loss and slowest samples.
+func (s *Stats) ResetTotals(now time.Time) {
+	s.Totals.Reset()
+	s.reservoir.Reset()
+	s.Histogram.Reset()
+	s.Loss.ResetTotals()
+	s.SlowTotals.Reset()
+	s.ttls = nil
+	if s.Call != nil {
+		s.Call.ResetTotals()
+	}
+	s.Started = now
+}
+
+// Reset starts the figures over while probing carries on, for after a change
+// to the network: the totals, the window under way and the one before it,
+// the rolling histogram, the sparkline, the baseline minimum RTT, the
+// outages and the records the worst minutes are held to. The events,
+// incidents and windows kept are left, as the history of the run, and so is
+// the SLO's error budget, which is spent over its period whatever the
+// network.
+func (s *Stats) Reset() {
+	now := s.Now()
+	s.ResetTotals(now)
+
+	s.Window.Reset()
+	s.LastWindow = Window{}
+	s.LastStart, s.lastLoss, s.lastSettled = time.Time{}, 0, 0
+	s.WindowStart = now
+	s.SlowWindow.Reset()
+	s.LastSlow = nil
+	s.Recent = nil
+	s.Rolling.Reset()
+	if s.Spark != nil {
+		s.Spark.reset()
+	}
+	if s.Baseline != nil {
+		s.Baseline.reset()
+	}
+	s.queueDelay = 0
+	s.windowP95s = nil
+	s.worstDeviation = 0
+
+	s.Unreachable, s.refused, s.requestErrors = 0, 0, 0
+	s.fragmented, s.lastFragment = 0, ""
+	s.statuses, s.rcodes = nil, nil
+	s.lastFailure = ""
+
+	if s.Outages != nil {
+		s.Outages.Reset()
+		s.OutagesOpened, s.OutagesClosed = 0, 0
+	}
+	if s.Worst != nil {
+		s.Worst.reset()
+	}
+
+	s.AddEvent("reset", "figures started over")
+}
@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"time"
+)
+
+type ResultSample struct {
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	RTTMs  *float64  `json:"rtt_ms"`
+	Lost   bool      `json:"lost"`
+	Event  string    `json:"event,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+type ResultsSummary struct {
+	Totals      Window         `json:"totals"`
+	Histogram   HistogramState `json:"histogram"`
+	Sent        int            `json:"sent"`
+	Lost        int            `json:"lost"`
+	Unreachable int            `json:"unreachable"`
+	Dropped     int64          `json:"dropped_samples,omitempty"`
+	// TTLs are the distinct TTLs replies came back with, more than one
+	// usually meaning the path changed.
+	TTLs []int `json:"ttls,omitempty"`
+	// Availability is over the time probed, which leaves out the pauses.
+	AvailabilityPct float64 `json:"availability_pct"`
+	ProbedS         float64 `json:"probed_s"`
+	PausedS         float64 `json:"paused_s"`
+
+	Call    *CallSummary    `json:"call,omitempty"`
+	Outages []OutageSummary `json:"outages,omitempty"`
+	// WorstMinutes are the worst windows to set a record, with what was
+	// going on around them.
+	WorstMinutes []WorstMinute `json:"worst_minutes,omitempty"`
+	// Windows are the last windows completed, oldest first, as many as
+	// --window-history keeps.
+	Windows []WindowRecord `json:"windows,omitempty"`
+	// WorstWindow is the worst window of the run, by loss and then average,
+	// whether or not it's still among Windows.
+	WorstWindow *WindowRecord `json:"worst_window,omitempty"`
+
+	Metadata *RunMetadata `json:"metadata,omitempty"`
+}
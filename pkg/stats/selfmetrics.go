@@ -0,0 +1,11 @@
+package stats
+
+// Retained is how many samples and events the run is holding in memory.
+func (s *Stats) Retained() int {
+	retained := len(s.Recent) + len(s.reservoir.samples) + len(s.Events)
+	if s.Loss != nil {
+		retained += s.Loss.Retained()
+	}
+
+	return retained
+}
@@ -0,0 +1,236 @@
+package stats
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/duration"
+)
+
+const sloResolution = time.Minute
+
+// SLO_SPEC splits a definition into its objective, threshold and period. The
+// threshold and period are durations, with bare numbers taken as
+// milliseconds and days.
+var SLO_SPEC = regexp.MustCompile(`^(\d+(?:\.\d+)?)%<([^/]+)/(.+)$`)
+
+type SLO struct {
+	Objective float64
+	Threshold time.Duration
+	Period    time.Duration
+}
+
+// ParseSLO reads a definition such as "99%<80ms/30d".
+func ParseSLO(spec string) (SLO, error) {
+	matches := SLO_SPEC.FindStringSubmatch(strings.ReplaceAll(spec, " ", ""))
+	if len(matches) < 4 {
+		return SLO{}, fmt.Errorf("failed to parse slo %q, expected something like 99%%<80ms/30d", spec)
+	}
+
+	objective, _ := strconv.ParseFloat(matches[1], 64)
+	if objective <= 0 || objective >= 100 {
+		return SLO{}, fmt.Errorf("slo objective must be between 0 and 100%%, got %s%%", matches[1])
+	}
+
+	threshold, err := duration.Parse(matches[2], time.Millisecond)
+	if err != nil {
+		return SLO{}, fmt.Errorf("failed to parse slo threshold %q: %s", matches[2], err)
+	}
+	if threshold <= 0 {
+		return SLO{}, fmt.Errorf("slo threshold must be above 0")
+	}
+
+	period, err := duration.Parse(matches[3], duration.DAY)
+	if err != nil {
+		return SLO{}, fmt.Errorf("failed to parse slo period %q: %s", matches[3], err)
+	}
+	if period < sloResolution {
+		return SLO{}, fmt.Errorf("slo period must be at least %s", sloResolution)
+	}
+
+	return SLO{
+		Objective: objective / 100,
+		Threshold: threshold,
+		Period:    period,
+	}, nil
+}
+
+func (s SLO) String() string {
+	return fmt.Sprintf("%g%% < %s over %s", s.Objective*100, s.Threshold, s.Period)
+}
+
+func (s SLO) ErrorBudget() float64 {
+	return 1 - s.Objective
+}
+
+// BurnRateThreshold is the rate at which 2% of the whole budget is spent in
+// an hour, the usual paging threshold for a 1h/5m multi-window alert.
+func (s SLO) BurnRateThreshold() float64 {
+	return 0.02 * s.Period.Hours()
+}
+
+type sloBucket struct {
+	index int64
+	good  int
+	total int
+}
+
+type SLOTracker struct {
+	slo     SLO
+	buckets []sloBucket
+	// started is the first sample's, from which the samples the whole
+	// period will hold are estimated.
+	started time.Time
+	// good and total are the sums over the period, kept as buckets fill and
+	// expire so that a status doesn't add up every bucket on each sample,
+	// expired being the last bucket index taken off them.
+	good    int
+	total   int
+	expired int64
+}
+
+func NewSLOTracker(slo SLO) *SLOTracker {
+	return &SLOTracker{
+		slo:     slo,
+		buckets: make([]sloBucket, int(slo.Period/sloResolution)),
+	}
+}
+
+func (t *SLOTracker) SLO() SLO {
+	return t.slo
+}
+
+func (t *SLOTracker) bucket(now time.Time) *sloBucket {
+	index := now.UnixNano() / int64(sloResolution)
+	b := &t.buckets[index%int64(len(t.buckets))]
+	if b.index != index {
+		t.good -= b.good
+		t.total -= b.total
+		*b = sloBucket{index: index}
+	}
+
+	return b
+}
+
+// expire takes the buckets that have fallen out of the period by now off
+// the sums. However long the gap since the last, each slot is looked at no
+// more than once, anything in it from before the period being stale.
+func (t *SLOTracker) expire(now time.Time) {
+	size := int64(len(t.buckets))
+	through := now.UnixNano()/int64(sloResolution) - size
+	for index := max(t.expired+1, through-size+1); index <= through; index++ {
+		b := &t.buckets[index%size]
+		if b.index <= through {
+			t.good -= b.good
+			t.total -= b.total
+			*b = sloBucket{}
+		}
+	}
+	t.expired = max(t.expired, through)
+}
+
+func (t *SLOTracker) Record(now time.Time, duration time.Duration) {
+	if t.started.IsZero() {
+		t.started = now
+		t.expired = now.UnixNano()/int64(sloResolution) - int64(len(t.buckets))
+	}
+	b := t.bucket(now)
+	b.total++
+	t.total++
+	if duration <= t.slo.Threshold {
+		b.good++
+		t.good++
+	}
+}
+
+// period is the good and total samples over the whole period to now.
+func (t *SLOTracker) period(now time.Time) (int, int) {
+	t.expire(now)
+	return t.good, t.total
+}
+
+func (t *SLOTracker) counts(now time.Time, window time.Duration) (int, int) {
+	current := now.UnixNano() / int64(sloResolution)
+	span := int64(window / sloResolution)
+	if span < 1 {
+		span = 1
+	}
+	if span > int64(len(t.buckets)) {
+		span = int64(len(t.buckets))
+	}
+
+	good, total := 0, 0
+	for index := current - span + 1; index <= current; index++ {
+		b := t.buckets[index%int64(len(t.buckets))]
+		if b.index != index {
+			continue
+		}
+
+		good += b.good
+		total += b.total
+	}
+
+	return good, total
+}
+
+// BurnRate is how many times faster than sustainable the error budget was
+// spent over the given window.
+func (t *SLOTracker) BurnRate(now time.Time, window time.Duration) float64 {
+	good, total := t.counts(now, window)
+	if total == 0 {
+		return 0
+	}
+
+	return float64(total-good) / float64(total) / t.slo.ErrorBudget()
+}
+
+// BudgetConsumed is the fraction of the period's error budget used so far:
+// the bad samples out of those the budget allows over the whole period, as
+// many as there have been so far at the rate they came in. Early on, it's
+// as far below the burn rate as the period is from over.
+func (t *SLOTracker) BudgetConsumed(now time.Time) float64 {
+	good, total := t.period(now)
+	return t.budgetConsumed(now, good, total)
+}
+
+func (t *SLOTracker) budgetConsumed(now time.Time, good int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	elapsed := min(max(now.Sub(t.started), sloResolution), t.slo.Period)
+	expected := float64(total) * float64(t.slo.Period) / float64(elapsed)
+
+	return float64(total-good) / (t.slo.ErrorBudget() * expected)
+}
+
+type SLOStatus struct {
+	Compliance     float64
+	BudgetConsumed float64
+	ShortBurn      float64
+	LongBurn       float64
+	Breached       bool
+}
+
+func (t *SLOTracker) Status(now time.Time) SLOStatus {
+	good, total := t.period(now)
+	compliance := 1.0
+	if total > 0 {
+		compliance = float64(good) / float64(total)
+	}
+
+	short := t.BurnRate(now, 5*time.Minute)
+	long := t.BurnRate(now, time.Hour)
+	threshold := t.slo.BurnRateThreshold()
+
+	return SLOStatus{
+		Compliance:     compliance,
+		BudgetConsumed: t.budgetConsumed(now, good, total),
+		ShortBurn:      short,
+		LongBurn:       long,
+		Breached:       short >= threshold && long >= threshold,
+	}
+}
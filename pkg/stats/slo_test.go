@@ -0,0 +1,144 @@
+package stats
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSLOBudget spends the budget at a steady rate for part of the period,
+// checking that the share of it used is the burn rate scaled by how much of
+// the period has gone, rather than the burn rate itself.
+func TestSLOBudget(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		elapsed  time.Duration
+		badEvery int
+		burn     float64
+		consumed float64
+	}{
+		{"on budget for half the period", 30 * time.Minute, 100, 1, 0.5},
+		{"ten times over for a tenth of it", 6 * time.Minute, 10, 10, 1},
+		{"twice over for a quarter of it", 15 * time.Minute, 50, 2, 0.5},
+		{"all good", 20 * time.Minute, 0, 0, 0},
+	}
+
+	for _, c := range cases {
+		tracker := NewSLOTracker(SLO{Objective: 0.99, Threshold: 80 * time.Millisecond, Period: time.Hour})
+		now := start
+		for i := range int(c.elapsed / time.Second) {
+			now = start.Add(time.Duration(i) * time.Second)
+			rtt := 20 * time.Millisecond
+			if c.badEvery > 0 && i%c.badEvery == 0 {
+				rtt = 200 * time.Millisecond
+			}
+			tracker.Record(now, rtt)
+		}
+
+		if burn := tracker.BurnRate(now, time.Hour); math.Abs(burn-c.burn) > 0.01 {
+			t.Fatalf("%s: burn rate: expected %.2fx, got %.2fx", c.name, c.burn, burn)
+		}
+		if consumed := tracker.BudgetConsumed(now); math.Abs(consumed-c.consumed) > 0.01 {
+			t.Fatalf("%s: budget used: expected %.0f%%, got %.1f%%", c.name, c.consumed*100, consumed*100)
+		}
+	}
+}
+
+func TestParseSLO(t *testing.T) {
+	cases := []struct {
+		spec string
+		slo  SLO
+		err  string
+	}{
+		{"99%<80ms/30d", SLO{0.99, 80 * time.Millisecond, 30 * 24 * time.Hour}, ""},
+		{"99.9% < 250 / 7", SLO{0.999, 250 * time.Millisecond, 7 * 24 * time.Hour}, ""},
+		{"95%<1s/1h", SLO{0.95, time.Second, time.Hour}, ""},
+		{"99%<80ms", SLO{}, `failed to parse slo "99%<80ms", expected something like 99%<80ms/30d`},
+		{"100%<80ms/30d", SLO{}, "slo objective must be between 0 and 100%, got 100%"},
+		{"0%<80ms/30d", SLO{}, "slo objective must be between 0 and 100%, got 0%"},
+		{"99%<0ms/30d", SLO{}, "slo threshold must be above 0"},
+		{"99%<fast/30d", SLO{}, `failed to parse slo threshold "fast"`},
+		{"99%<80ms/30s", SLO{}, "slo period must be at least 1m0s"},
+	}
+
+	for _, c := range cases {
+		slo, err := ParseSLO(c.spec)
+		if c.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+				t.Fatalf("%s: expected an error starting %q, got %v", c.spec, c.err, err)
+			}
+			continue
+		}
+		if err != nil || math.Abs(slo.Objective-c.slo.Objective) > 1e-9 || slo.Threshold != c.slo.Threshold || slo.Period != c.slo.Period {
+			t.Fatalf("%s: expected %+v, got %+v, %v", c.spec, c.slo, slo, err)
+		}
+	}
+}
+
+// TestSLOBurnRates has the latency go bad for a spell at the end of a run,
+// checking the short and long burn rates and that only both being over the
+// threshold is a breach.
+func TestSLOBurnRates(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		bad      time.Duration
+		short    float64
+		long     float64
+		breached bool
+	}{
+		{"none bad", 0, 0, 0, false},
+		{"the last minute bad", time.Minute, 20, 1.67, false},
+		{"the last ten minutes bad", 10 * time.Minute, 100, 16.67, true},
+		{"the last hour bad", time.Hour, 100, 100, true},
+	}
+
+	for _, c := range cases {
+		// 99% over 30 days, alerting at 14.4x.
+		tracker := NewSLOTracker(SLO{Objective: 0.99, Threshold: 80 * time.Millisecond, Period: 30 * 24 * time.Hour})
+		end := start.Add(2 * time.Hour)
+		for at := start; at.Before(end); at = at.Add(time.Second) {
+			rtt := 20 * time.Millisecond
+			if end.Sub(at) <= c.bad {
+				rtt = 200 * time.Millisecond
+			}
+			tracker.Record(at, rtt)
+		}
+
+		now := end.Add(-time.Second)
+		status := tracker.Status(now)
+		if math.Abs(status.ShortBurn-c.short) > 0.01 || math.Abs(status.LongBurn-c.long) > 0.01 || status.Breached != c.breached {
+			t.Fatalf("%s: expected 5m %.2fx, 1h %.2fx, breached %t, got 5m %.2fx, 1h %.2fx, breached %t", c.name, c.short, c.long, c.breached, status.ShortBurn, status.LongBurn, status.Breached)
+		}
+		if good, total := tracker.counts(now, tracker.slo.Period); status.Compliance != float64(good)/float64(total) {
+			t.Fatalf("%s: the running sums match the buckets: expected %d of %d good, got %.4f compliance", c.name, good, total, status.Compliance)
+		}
+	}
+}
+
+// TestSLOExpiry records across more than a period with gaps in it,
+// checking that the running sums keep to what the buckets hold.
+func TestSLOExpiry(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	tracker := NewSLOTracker(SLO{Objective: 0.99, Threshold: 80 * time.Millisecond, Period: time.Hour})
+	at := start
+	for i := range 500 {
+		// A quiet spell every so often, one of them longer than the period.
+		switch {
+		case i == 300:
+			at = at.Add(90 * time.Minute)
+		case i%40 == 0:
+			at = at.Add(17 * time.Minute)
+		default:
+			at = at.Add(20 * time.Second)
+		}
+		tracker.Record(at, time.Duration(i%100)*time.Millisecond)
+
+		good, total := tracker.counts(at, tracker.slo.Period)
+		if running, sum := tracker.period(at); running != good || sum != total {
+			t.Fatalf("sample %d: expected %d of %d good over the period, got %d of %d", i, good, total, running, sum)
+		}
+	}
+}
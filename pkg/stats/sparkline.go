@@ -0,0 +1,215 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	SPARK_SAMPLES = "samples"
+	SPARK_WINDOWS = "windows"
+
+	SPARK_LOST = 'x'
+	// SPARK_QUEUE is how many replies are held waiting for the loss tracker
+	// to settle them, past which the oldest are given up on.
+	SPARK_QUEUE = 64
+)
+
+var SPARK_MODES = []string{SPARK_SAMPLES, SPARK_WINDOWS}
+
+type sparkPoint struct {
+	rtt  time.Duration
+	lost bool
+}
+
+// sparkRing keeps the last points the sparkline draws, each a sample or a
+// window's average, as many as the terminal is wide. The lines drawn from
+// it are kept until a point is added or the scale changes, since the view
+// is drawn far more often than probes come in.
+type sparkRing struct {
+	Mode    string
+	points  []sparkPoint
+	start   int
+	count   int
+	version int
+
+	// queued are replies waiting to be drawn until the probes before them
+	// settle, and owed the replies settled before their samples came.
+	queued []time.Duration
+	owed   int
+
+	drawn         []string
+	drawnVersion  int
+	drawnFromZero bool
+	cells         []rune
+}
+
+func NewSparkRing(mode string, width int) *sparkRing {
+	return &sparkRing{Mode: mode, points: make([]sparkPoint, max(width, 1)), drawnVersion: -1}
+}
+
+func (r *sparkRing) add(p sparkPoint) {
+	if r.count < len(r.points) {
+		r.points[(r.start+r.count)%len(r.points)] = p
+		r.count++
+	} else {
+		r.points[r.start] = p
+		r.start = (r.start + 1) % len(r.points)
+	}
+	r.version++
+}
+
+// at is the i'th point kept, oldest first.
+func (r *sparkRing) at(i int) sparkPoint {
+	return r.points[(r.start+i)%len(r.points)]
+}
+
+// reset drops the points drawn, keeping the replies still waiting on the
+// loss tracker, which settles them whatever is reset.
+func (r *sparkRing) reset() {
+	r.start, r.count = 0, 0
+	r.version++
+}
+
+// Resize keeps as many points as width, dropping the oldest when it
+// shrinks.
+func (r *sparkRing) Resize(width int) {
+	if r == nil || width <= 0 || width == len(r.points) {
+		return
+	}
+
+	keep := min(r.count, width)
+	points := make([]sparkPoint, width)
+	for i := range keep {
+		points[i] = r.at(r.count - keep + i)
+	}
+	r.points, r.start, r.count = points, 0, keep
+	r.version++
+}
+
+// sample takes a reply, in samples mode. It's drawn once the loss tracker
+// settles it, which is straight away unless probes before it are still
+// waiting on their timeout, so that a lost one is drawn in its place.
+func (r *sparkRing) sample(rtt time.Duration) {
+	if r.Mode != SPARK_SAMPLES {
+		return
+	}
+
+	if r.owed > 0 {
+		r.owed--
+		r.add(sparkPoint{rtt: rtt})
+		return
+	}
+	if len(r.queued) == SPARK_QUEUE {
+		r.queued = r.queued[1:]
+	}
+	r.queued = append(r.queued, rtt)
+}
+
+// Observe takes each probe's fate in sequence order, as a LossTracker
+// observer.
+func (r *sparkRing) Observe(seq int, lost bool) {
+	switch {
+	case r.Mode != SPARK_SAMPLES:
+	case lost:
+		r.add(sparkPoint{lost: true})
+	case len(r.queued) > 0:
+		r.add(sparkPoint{rtt: r.queued[0]})
+		r.queued = r.queued[1:]
+	default:
+		r.owed++
+	}
+}
+
+// window takes a window's average, in windows mode, marking it when the
+// window lost any probes.
+func (r *sparkRing) window(w *Window, loss float64) {
+	if r.Mode == SPARK_WINDOWS && w.Count > 0 {
+		r.add(sparkPoint{rtt: w.Average(), lost: loss > 0})
+	}
+}
+
+// Lines draws the sparkline and its title, scaled from the fastest point
+// kept or from zero.
+func (r *sparkRing) Lines(t theme.Theme, fromZero bool) []string {
+	if r.drawnVersion == r.version && r.drawnFromZero == fromZero {
+		return r.drawn
+	}
+	r.drawnVersion, r.drawnFromZero = r.version, fromZero
+
+	var low, high time.Duration
+	replies, lost := 0, 0
+	for i := range r.count {
+		p := r.at(i)
+		if p.lost && r.Mode == SPARK_SAMPLES {
+			lost++
+			continue
+		}
+		if replies == 0 || p.rtt < low {
+			low = p.rtt
+		}
+		high = max(high, p.rtt)
+		replies++
+	}
+	if fromZero {
+		low = 0
+	}
+
+	what := "samples"
+	if r.Mode == SPARK_WINDOWS {
+		what = "window averages"
+	}
+	if r.count == 0 {
+		r.drawn = []string{fmt.Sprintf("Sparkline: no %s yet", what)}
+		return r.drawn
+	}
+
+	scale := "fastest"
+	if fromZero {
+		scale = "zero"
+	}
+	title := fmt.Sprintf("Sparkline: last %d %s, %s to %s (scaled from %s)", r.count, what, FormatLatency(low), FormatLatency(high), scale)
+	if lost > 0 {
+		title += fmt.Sprintf(", %c %d lost", SPARK_LOST, lost)
+	}
+
+	// Runs of points drawn alike are rendered together, rather than styling
+	// each cell.
+	var line strings.Builder
+	marked := false
+	flush := func() {
+		if len(r.cells) == 0 {
+			return
+		}
+		if marked {
+			line.WriteString(t.Bad.Render(string(r.cells)))
+		} else {
+			line.WriteString(t.Bar.Render(string(r.cells)))
+		}
+		r.cells = r.cells[:0]
+	}
+	for i := range r.count {
+		p := r.at(i)
+		if p.lost != marked {
+			flush()
+			marked = p.lost
+		}
+
+		cell := SPARK_LOST
+		if !p.lost || r.Mode == SPARK_WINDOWS {
+			level := len(BLOCKS) - 1
+			if high > low {
+				level = 1 + int(float64(p.rtt-low)/float64(high-low)*float64(len(BLOCKS)-2))
+			}
+			cell = BLOCKS[level]
+		}
+		r.cells = append(r.cells, cell)
+	}
+	flush()
+
+	r.drawn = []string{title, line.String()}
+	return r.drawn
+}
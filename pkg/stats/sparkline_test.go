@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestSparkline fills a sparkline past its width with a lost probe
+// among the samples, the replies after it held back until it settles, and
+// checks it keeps the newest, draws the loss in its place, redraws only once
+// something has changed and keeps the newest on resizing.
+func TestSparkline(t *testing.T) {
+	r := NewSparkRing(SPARK_SAMPLES, 8)
+	for i := 1; i <= 9; i++ {
+		r.Observe(i, false)
+		r.sample(time.Duration(i) * 10 * time.Millisecond)
+	}
+	r.sample(110 * time.Millisecond)
+	r.sample(120 * time.Millisecond)
+	for i := 10; i <= 12; i++ {
+		r.Observe(i, i == 10)
+	}
+
+	lines := r.Lines(theme.Theme{}, false)
+	if len(lines) != 2 || lines[1] != "▁▂▃▄▅x▇█" {
+		t.Fatalf("the sparkline keeps as many points as it's wide, marking the lost: expected ▁▂▃▄▅x▇█, got %q", lines)
+	}
+	if !strings.Contains(lines[0], "last 8 samples, 50.0ms to 120ms") || !strings.Contains(lines[0], "x 1 lost") {
+		t.Fatalf("the title gives the range and how many were lost: expected last 8 samples, 50.0ms to 120ms, x 1 lost, got %q", lines[0])
+	}
+	if again := r.Lines(theme.Theme{}, false); &again[0] != &lines[0] {
+		t.Fatalf("a frame with nothing new draws nothing: expected the lines drawn before, got drawn again")
+	}
+	if again := r.Lines(theme.Theme{}, true); &again[0] == &lines[0] {
+		t.Fatalf("changing the scale redraws: expected new lines, got the lines drawn before")
+	}
+
+	r.Resize(4)
+	if lines := r.Lines(theme.Theme{}, false); lines[1] != "▁x▅█" {
+		t.Fatalf("shrinking keeps the newest points: expected ▁x▅█, got %q", lines[1])
+	}
+	r.Resize(6)
+	r.Observe(13, false)
+	r.sample(10 * time.Millisecond)
+	if lines := r.Lines(theme.Theme{}, false); lines[1] != "▆x▇█▁" || r.count != 5 {
+		t.Fatalf("growing keeps every point and makes room for more: expected ▆x▇█▁, got %q", lines[1])
+	}
+
+	windows := NewSparkRing(SPARK_WINDOWS, 8)
+	windows.sample(time.Second)
+	windows.Observe(1, true)
+	windows.window(&Window{Total: 40 * time.Millisecond, Count: 2}, 0.1)
+	if lines := windows.Lines(theme.Theme{}, false); windows.count != 1 || !strings.Contains(lines[0], "last 1 window averages, 20.0ms to 20.0ms") {
+		t.Fatalf("windows mode draws only the windows' averages: expected last 1 window averages, 20.0ms to 20.0ms, got %q", lines)
+	}
+}
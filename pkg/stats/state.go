@@ -0,0 +1,231 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/enrich"
+	"ponglehub.co.uk/nettest/pkg/route"
+)
+
+// HistogramState has its thresholds in milliseconds, and Overflow counts
+// the samples slower than the last.
+type HistogramState struct {
+	Thresholds []float64 `json:"thresholds"`
+	Buckets    []int     `json:"buckets"`
+	Overflow   int       `json:"overflow"`
+	Total      int       `json:"total"`
+}
+
+type RunState struct {
+	RunID     string         `json:"run_id"`
+	SavedAt   time.Time      `json:"saved_at"`
+	Samples   int64          `json:"samples"`
+	Totals    Window         `json:"totals"`
+	Histogram HistogramState `json:"histogram"`
+	// ReservoirUs is the reservoir in microseconds, where Reservoir held it
+	// in whole milliseconds before, and is still read from an older file.
+	ReservoirUs []int64    `json:"reservoir_us,omitempty"`
+	Reservoir   []int64    `json:"reservoir,omitempty"`
+	Events      []Event    `json:"events"`
+	Incidents   []Incident `json:"incidents"`
+	// Pauses are when probing was stopped on purpose, which aren't outages.
+	Pauses []pauseGap `json:"pauses,omitempty"`
+
+	Metadata       *RunMetadata `json:"metadata,omitempty"`
+	Target         *enrich.Info `json:"target,omitempty"`
+	Interface      string       `json:"interface,omitempty"`
+	VPN            bool         `json:"vpn"`
+	WorstDeviation float64      `json:"worst_deviation_percent,omitempty"`
+	// RateLimitPeriod is the drop spacing, in probes, last seen looking
+	// like ICMP rate-limiting.
+	RateLimitPeriod int     `json:"rate_limit_period,omitempty"`
+	LossPct         float64 `json:"loss_pct"`
+	// Loss is what LossPct and AvailabilityPct were worked out from, for a
+	// resumed run to carry on counting from. Older files don't have it.
+	Loss *LossTotals `json:"loss,omitempty"`
+	// AvailabilityPct is over the time probed, leaving out the pauses.
+	AvailabilityPct float64 `json:"availability_pct"`
+	ProbedS         float64 `json:"probed_s"`
+	PausedS         float64 `json:"paused_s"`
+	// Times are stored in UTC; these say how they were shown during the run.
+	TimeFormat string `json:"time_format,omitempty"`
+	TimeZone   string `json:"time_zone,omitempty"`
+	// Tab is the one the display was showing, to open on again.
+	Tab string `json:"tab,omitempty"`
+
+	// Checkpoints are written while a run is still going, so are marked
+	// incomplete along with what's needed to finalise them later.
+	Incomplete   bool      `json:"incomplete,omitempty"`
+	CheckpointAt time.Time `json:"checkpoint_at,omitempty"`
+	Crash        string    `json:"crash,omitempty"`
+	Host         string    `json:"host,omitempty"`
+	Started      time.Time `json:"started,omitempty"`
+	WindowS      int       `json:"window_s,omitempty"`
+}
+
+func SaveState(path string, s *Stats) error {
+	return WriteState(path, NewRunState(s))
+}
+
+func NewRunState(s *Stats) RunState {
+	now := s.Now()
+	availability, probed, paused := s.Availability(now)
+	loss := s.Loss.Totals()
+	return RunState{
+		RunID:          s.RunID,
+		SavedAt:        Stored(now),
+		Samples:        s.SampleIndex,
+		Totals:         s.Totals,
+		Histogram:      HistogramStateOf(&s.Histogram),
+		ReservoirUs:    microseconds(s.reservoir.samples),
+		Events:         s.Events,
+		Incidents:      s.Incidents,
+		Pauses:         s.PauseGaps(),
+		Metadata:       s.Metadata,
+		Target:         s.Target,
+		Interface:      s.Route,
+		VPN:            route.IsVPN(s.Route),
+		WorstDeviation: s.worstDeviation,
+
+		RateLimitPeriod: s.rateLimitSeen,
+		LossPct:         s.Loss.Cumulative() * 100,
+		Loss:            &loss,
+		AvailabilityPct: availability * 100,
+		ProbedS:         probed.Seconds(),
+		PausedS:         paused.Seconds(),
+		TimeFormat:      s.Times.mode,
+		TimeZone:        s.Times.Zone(now),
+		Tab:             s.Tab,
+		Started:         Stored(s.Started),
+	}
+}
+
+func microseconds(samples []time.Duration) []int64 {
+	us := make([]int64, len(samples))
+	for i, sample := range samples {
+		us[i] = sample.Microseconds()
+	}
+
+	return us
+}
+
+// reservoir is the saved reservoir, from milliseconds in an older file.
+func (state RunState) reservoir() []time.Duration {
+	stored, unit := state.ReservoirUs, time.Microsecond
+	if stored == nil {
+		stored, unit = state.Reservoir, time.Millisecond
+	}
+	if stored == nil {
+		return nil
+	}
+
+	samples := make([]time.Duration, len(stored))
+	for i, v := range stored {
+		samples[i] = time.Duration(v) * unit
+	}
+	return samples
+}
+
+func WriteState(path string, state RunState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %s", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %s", err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func LoadState(path string) (RunState, error) {
+	var state RunState
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse state file %s: %s", path, err)
+	}
+
+	return state, nil
+}
+
+func ResumeState(path string, s *Stats) error {
+	state, err := LoadState(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no state file to resume at %s", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.RunID != "" && s.RunID != state.RunID {
+		return fmt.Errorf("state file belongs to run %s, not %s", state.RunID, s.RunID)
+	}
+
+	if err := RestoreState(state, s); err != nil {
+		return err
+	}
+
+	// The time it wasn't running is neither up nor down, like a pause.
+	now := Stored(s.Now())
+	if now.After(state.SavedAt) {
+		s.Pauses = append(s.Pauses, pauseGap{Start: state.SavedAt, End: &now, Reason: "not running", Automatic: true})
+	}
+	gap := now.Sub(state.SavedAt).Round(time.Second)
+	s.AddEvent("resumed", fmt.Sprintf("no data from %s for %s", s.Times.Stamp(state.SavedAt), gap))
+
+	return nil
+}
+
+// RestoreState takes up a run from its saved state, with any pause still
+// going taken as ending when it was saved. The loss counts and when the run
+// started are only taken up from files that have them.
+func RestoreState(state RunState, s *Stats) error {
+	thresholds := state.Histogram.Bounds()
+	if len(state.Histogram.Buckets) != len(thresholds) {
+		return fmt.Errorf("state file histogram has %d buckets for %d thresholds", len(state.Histogram.Buckets), len(thresholds))
+	}
+	// Fitted buckets are taken up as they were, and refitted if need be.
+	if s.AutoBuckets != nil && len(thresholds) > 0 {
+		s.AutoBuckets.fitted = true
+		s.Rolling = NewHistogram(thresholds)
+	} else if !slices.Equal(thresholds, s.Histogram.Thresholds()) {
+		return fmt.Errorf("state file histogram buckets (%s) don't match this run's (%s)", FormatThresholds(thresholds), FormatThresholds(s.Histogram.Thresholds()))
+	}
+
+	s.RunID = state.RunID
+	s.SampleIndex = state.Samples
+	s.Totals = state.Totals
+	s.Histogram = state.Histogram.Histogram()
+	s.reservoir = reservoir{samples: state.reservoir(), seen: state.Totals.Count}
+	s.Events = state.Events
+	s.Incidents = state.Incidents
+	s.Pauses = state.Pauses
+	for i := range s.Pauses {
+		if s.Pauses[i].End == nil {
+			s.Pauses[i].End = &state.SavedAt
+		}
+	}
+	s.worstDeviation = state.WorstDeviation
+	s.rateLimitSeen = state.RateLimitPeriod
+	s.Tab = state.Tab
+	if state.Loss != nil {
+		s.Loss.Carry(*state.Loss)
+	}
+	if !state.Started.IsZero() {
+		s.Started = state.Started
+	}
+
+	return nil
+}
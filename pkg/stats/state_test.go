@@ -0,0 +1,54 @@
+package stats
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResume saves a clocked run with some of its probes lost and resumes
+// it an hour later by the same clock, checking the loss, when it started
+// and the gap all come back by that clock rather than the wall's, and that
+// the time it wasn't running isn't counted as up.
+func TestResume(t *testing.T) {
+	start := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC)
+	now := start
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started = start
+	for seq := 1; seq <= 20; seq++ {
+		now = start.Add(time.Duration(seq) * time.Second)
+		if seq%5 == 0 {
+			s.Loss.Unreachable(seq, now)
+		} else {
+			s.Loss.Reply(seq, now)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveState(path, &s); err != nil {
+		t.Fatalf("the state file saves: expected no error, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	resumed := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	resumed.Clock = func() time.Time { return now }
+	resumed.Started = now
+	if err := ResumeState(path, &resumed); err != nil {
+		t.Fatalf("the state file resumes: expected no error, got %v", err)
+	}
+
+	if sent, lost := resumed.Loss.Settled(); sent != 20 || lost != 4 || resumed.Loss.LostTime() != 4*time.Second {
+		t.Fatalf("a resumed run keeps its loss: expected 4 of 20 lost over 4s, got %d of %d over %s", lost, sent, resumed.Loss.LostTime())
+	}
+	if !resumed.Started.Equal(start) {
+		t.Fatalf("a resumed run keeps when it started: expected %s, got %s", start, resumed.Started)
+	}
+	if event := resumed.Events[len(resumed.Events)-1]; event.Kind != "resumed" || !strings.HasSuffix(event.Message, " for 1h0m0s") {
+		t.Fatalf("the gap is by the run's clock: expected a resumed event for 1h0m0s, got %s %q", event.Kind, event.Message)
+	}
+	if availability, probed, paused := resumed.Availability(now); probed != 20*time.Second || paused != time.Hour || availability != 0.8 {
+		t.Fatalf("the time it wasn't running is left out: expected 80%% over 20s probed, 1h paused, got %.0f%% over %s, %s", availability*100, probed, paused)
+	}
+}
@@ -0,0 +1,826 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/enrich"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// FormatMillis is a latency as the files keep it, in milliseconds.
+func FormatMillis(ms float64) string {
+	return FormatLatency(FromMilliseconds(ms))
+}
+
+// DEFAULT_THRESHOLDS start below a millisecond, for round trips across a
+// LAN.
+var DEFAULT_THRESHOLDS = append([]time.Duration{250 * time.Microsecond, 500 * time.Microsecond}, MillisecondThresholds(1, 2, 5, 10, 20, 50, 100, 200, 500, 1000)...)
+
+const HISTOGRAM_MARKER_WIDTH = 9
+
+// markerColumn labels a bucket's row with the percentiles falling in it,
+// e.g. "p50/90".
+func markerColumn(markers []Marker, bucket int) string {
+	var labels []string
+	for _, marker := range markers {
+		if marker.Bucket == bucket {
+			labels = append(labels, strconv.Itoa(marker.Percentile))
+		}
+	}
+
+	label := ""
+	if len(labels) > 0 {
+		label = "p" + strings.Join(labels, "/")
+	}
+
+	return fmt.Sprintf("%-*s", HISTOGRAM_MARKER_WIDTH, label)
+}
+
+func markerLegend(markers []Marker) string {
+	if markers == nil {
+		return fmt.Sprintf("under %d samples", HISTOGRAM_MARKER_MIN_SAMPLES)
+	}
+
+	parts := make([]string, 0, len(markers))
+	for _, marker := range markers {
+		value := fmt.Sprintf("%.1fms", Milliseconds(marker.Value))
+		if marker.Overflow {
+			value = ">" + value
+		}
+		parts = append(parts, fmt.Sprintf("p%d %s", marker.Percentile, value))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+type sample struct {
+	At       time.Time
+	Duration time.Duration
+}
+
+// Stats is everything a run measures: latency by window and over the whole
+// run, loss, the histogram and whichever of the extras the run's flags turn
+// on. It's a value, as the bubbletea model holding it is.
+type Stats struct {
+	Clock       func() time.Time
+	RunID       string
+	Times       TimeFormat
+	Interval    time.Duration
+	WindowSize  time.Duration
+	WindowStart time.Time
+	Window      Window
+	LastWindow  Window
+	// LastStart is when the last window started, zero until one closes,
+	// and lastLoss the loss over the lastSettled probes settled in it.
+	LastStart   time.Time
+	lastLoss    float64
+	lastSettled int
+	Totals      Window
+	reservoir   reservoir
+	Histogram   Histogram
+	AutoBuckets *AutoBuckets
+	Recent      []sample
+	Rolling     Histogram
+	SLO         *SLOTracker
+	sloBreached bool
+
+	// SharedWindow leaves rolling the window to RollWindow's caller, rather
+	// than to CloseWindows.
+	SharedWindow bool
+
+	Levels         Levels
+	Expected       time.Duration
+	worstDeviation float64
+	Reference      *ReferenceProfile
+	// Headline is one of HEADLINES, and LastHeadline the last window's.
+	Headline     string
+	LastHeadline time.Duration
+
+	Baseline   *MinRTT
+	queueDelay time.Duration
+	Call       *CallEstimator
+	Spark      *sparkRing
+	Loss       *LossTracker
+	Outages    *OutageTracker
+	Worst      *worstMinutes
+	History    *windowHistory
+	LossAlerts *LossAlerts
+	Burst      *BurstControl
+	// OutagesOpened and OutagesClosed are how many outages have been logged
+	// as opening and closing.
+	OutagesOpened int
+	OutagesClosed int
+	// Unreachable counts probes a router answered with an ICMP error, and
+	// refused TCP connections the host turned away.
+	Unreachable int
+	refused     int
+	// fragmented counts probes too big for the path, with the last reason
+	// given so that the event log only hears of it when that changes.
+	fragmented   int
+	lastFragment string
+	// statuses counts HTTP responses by code, rcodes DNS answers, and
+	// requestErrors requests that got no response at all.
+	statuses      map[int]int
+	rcodes        map[string]int
+	servers       map[string]*dnsServer
+	requestErrors int
+	lastFailure   string
+
+	RecoveryProbes int
+	marker         *changeMarker
+	lastRecovery   *recovery
+
+	// Started is when the totals did, which availability is taken over.
+	Started time.Time
+	Paused  *pauseGap
+	Pauses  []pauseGap
+	Marks   []PauseMark
+
+	RateLimit       *RateLimitDetector
+	RateLimitPeriod int
+	rateLimitSeen   int
+
+	SlowWindow *TopN
+	SlowTotals *TopN
+	LastSlow   []Slow
+	windowP95s []time.Duration
+
+	Hops         *ping.HopEstimate
+	ttl          int
+	hopCandidate ping.HopEstimate
+	hopStreak    int
+	// ttls counts the replies by the TTL they came back with, lastTTL being
+	// the latest's.
+	ttls       map[int]int
+	lastTTL    int
+	pathChange *pathChange
+
+	SampleIndex int64
+	Epoch       int
+	// Follower is set when the stats are rebuilt from an instance attached
+	// to, whose events are streamed rather than logged here.
+	Follower bool
+
+	Metadata  *RunMetadata
+	Target    *enrich.Info
+	Route     string
+	Tab       string
+	Events    []Event
+	Incidents []Incident
+}
+
+type Event struct {
+	RunID   string    `json:"run_id"`
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+// New counts probes sent every interval into windows of windowSize,
+// bucketing replies by thresholds, which are in ascending order.
+func New(interval time.Duration, windowSize time.Duration, thresholds []time.Duration) Stats {
+	return Stats{
+		Interval:    interval,
+		WindowSize:  windowSize,
+		WindowStart: time.Now(),
+		Started:     time.Now(),
+		Window:      Window{},
+		LastWindow:  Window{},
+		Totals:      Window{},
+		Histogram:   NewHistogram(thresholds),
+		Rolling:     NewHistogram(thresholds),
+		Loss:        NewLossTracker(interval, LossTimeout(interval), windowSize, DEFAULT_LOSS_HALF_LIFE),
+		SlowWindow:  NewTopN(DEFAULT_TOP_N),
+		SlowTotals:  NewTopN(DEFAULT_TOP_N),
+	}
+}
+
+const DEFAULT_TOP_N = 10
+
+const (
+	DEFAULT_LOSS_HALF_LIFE    = 5 * time.Minute
+	DEFAULT_ALERT_LOSS_WINDOW = 5 * time.Minute
+)
+
+// LossTimeout is how long a probe may go unanswered before it counts as lost.
+func LossTimeout(interval time.Duration) time.Duration {
+	return max(2*interval, 2*time.Second)
+}
+
+func (s *Stats) Now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+
+	return time.Now()
+}
+
+func (s *Stats) AddEvent(kind string, message string) {
+	if s.Follower {
+		return
+	}
+
+	s.Events = append(s.Events, Event{
+		RunID:   s.RunID,
+		Time:    Stored(s.Now()),
+		Kind:    kind,
+		Message: message,
+	})
+}
+
+// Update records a sample and reports whether it closed any windows.
+// Everything keeps the latency as it was measured.
+func (s *Stats) Update(latency time.Duration) bool {
+	return len(s.UpdateAt(latency, time.Time{})) > 0
+}
+
+// UpdateAt is Update for a reply that came in at, as the prober saw it,
+// which is when a new min or max is said to have been, however far behind
+// the display is. A zero at is now. It returns the windows it closed.
+func (s *Stats) UpdateAt(latency time.Duration, at time.Time) []ClosedWindow {
+	now := s.Now()
+	if at.IsZero() {
+		at = now
+	}
+	at = Stored(at)
+	// A reply after the window's end belongs to the next, whether or not
+	// the ticker has got to closing it yet.
+	closed := s.CloseWindows(at)
+	weight := s.weight()
+	s.Window.UpdateWeighted(latency, at, weight)
+	s.Totals.UpdateWeighted(latency, at, weight)
+	s.reservoir.Add(latency)
+	s.Histogram.Update(latency)
+	s.updateRolling(now, latency)
+	if s.AutoBuckets != nil {
+		s.AutoBuckets.observe(latency)
+	}
+
+	if s.RateLimit != nil {
+		s.RateLimit.RTT(latency)
+	}
+
+	if s.Baseline != nil {
+		s.Baseline.Record(now, latency)
+		s.queueDelay = s.Baseline.QueueDelay(latency)
+	}
+
+	if s.SLO != nil {
+		s.updateSLO(now, latency)
+	}
+
+	if s.Call != nil {
+		s.Call.Observe(latency)
+	}
+
+	if s.Spark != nil {
+		s.Spark.sample(latency)
+	}
+
+	if s.Burst != nil && s.Burst.Adaptive {
+		s.Burst.slow = s.Burst.slow || Over(latency, s.Levels.Warn)
+		s.checkBurst()
+	}
+
+	return closed
+}
+
+// WindowEnd is when the window under way closes, a --window of probing after
+// it started, so that time spent paused doesn't count towards it. A pause
+// under way holds it open.
+func (s *Stats) WindowEnd(now time.Time) time.Time {
+	end := s.WindowStart.Add(s.WindowSize)
+	// The pauses are in order, so each one begun before the end found so far
+	// puts it back by as much of it as came after the window started.
+	for _, gap := range s.PauseGaps() {
+		if !gap.Start.Before(end) {
+			break
+		}
+		resumed := now
+		if gap.End != nil {
+			resumed = *gap.End
+		}
+		if from := later(gap.Start, s.WindowStart); resumed.After(from) {
+			end = end.Add(resumed.Sub(from))
+		}
+	}
+
+	return end
+}
+
+// MAX_WINDOWS_CLOSED bounds the silent windows CloseWindows keeps at once.
+const MAX_WINDOWS_CLOSED = 100
+
+// ClosedWindow is a window as it closed, for following up after others
+// may have closed since, as when the ticker gets to several at once.
+type ClosedWindow struct {
+	Start    time.Time
+	End      time.Time
+	Window   Window
+	Headline time.Duration
+	Slowest  []Slow
+	Call     *CallSummary
+}
+
+// CloseWindows closes every window that ended before now, each on its own
+// boundary, which a reply on it belongs to, so that one with no replies is
+// kept as silent rather than stretching until the next, and returns them in
+// order. Past MAX_WINDOWS_CLOSED, as after the machine sleeping, the rest
+// are closed as one window up to the last boundary.
+func (s *Stats) CloseWindows(now time.Time) []ClosedWindow {
+	if s.SharedWindow || s.WindowSize <= 0 {
+		return nil
+	}
+
+	var closed []ClosedWindow
+	for end := s.WindowEnd(now); end.Before(now) && s.Paused == nil; end = s.WindowEnd(now) {
+		if len(closed) == MAX_WINDOWS_CLOSED-1 {
+			end = end.Add(now.Sub(end) / s.WindowSize * s.WindowSize)
+		}
+		closed = append(closed, s.RollWindow(end))
+	}
+
+	return closed
+}
+
+// RollWindow closes the window under way at now, which CloseWindows does
+// on its boundary, unless the window is shared with other Stats that have to
+// roll on the same boundaries, where their ticker does instead.
+func (s *Stats) RollWindow(now time.Time) ClosedWindow {
+	s.LastWindow = s.Window
+	s.LastStart = s.WindowStart
+	s.LastHeadline = s.headlineOf(&s.Window)
+	// With no replies since, the rolling samples are all from before the
+	// window, so it has no p95 of its own to go towards the run's.
+	s.evictRolling(now)
+	var p95 time.Duration
+	if s.Window.Count > 0 {
+		p95 = s.WindowPercentile(95)
+		s.windowP95s = append(s.windowP95s, p95)
+	}
+	loss, _, settled := s.Loss.Rolling(now)
+	s.lastLoss, s.lastSettled = loss, settled
+	if s.Worst != nil {
+		s.Worst.window(s, s.WindowStart, now, loss, p95)
+	}
+	s.recordWindow(now, loss)
+	if s.Call != nil {
+		s.scoreCall(now)
+	}
+	if s.Spark != nil {
+		s.Spark.window(&s.LastWindow, loss)
+	}
+	s.recoveryWindow(s.WindowStart, now)
+	if s.Burst != nil {
+		s.Burst.closed = s.WindowStart
+	}
+	if s.AutoBuckets != nil {
+		s.rescaleBuckets()
+	}
+	if s.Reference != nil {
+		s.compareReference()
+	}
+	if s.Expected > 0 {
+		if deviation := s.deviation(s.LastHeadline); math.Abs(deviation) > math.Abs(s.worstDeviation) {
+			s.worstDeviation = deviation
+		}
+	}
+	closed := ClosedWindow{
+		Start:    s.WindowStart,
+		End:      now,
+		Window:   s.Window,
+		Headline: s.LastHeadline,
+		Slowest:  s.SlowWindow.Sorted(),
+		Call:     s.LastCall(),
+	}
+	s.Window.Reset()
+	s.LastSlow = closed.Slowest
+	s.SlowWindow.Reset()
+	s.WindowStart = now
+
+	return closed
+}
+
+func (s *Stats) String() string {
+	return s.PrintWindows(theme.Theme{})
+}
+
+// PrintWindows is the last window and the totals, their averages coloured
+// by the levels.
+func (s *Stats) PrintWindows(t theme.Theme) string {
+	return fmt.Sprintf("%-16s - %s\n%-16s - %s", fmt.Sprintf("Last %d seconds", int(s.WindowSize.Seconds())), s.RenderLastWindow(t), "Totals", s.RenderTotals(t)+s.PrintPercentiles())
+}
+
+// deviation is how far a window's headline is off what was expected.
+func (s *Stats) deviation(headline time.Duration) float64 {
+	return float64(headline-s.Expected) / float64(s.Expected) * 100
+}
+
+// Observe feeds a reply's sequence number to the loss accounting, starting
+// over whenever the prober does, and keeps it if it is among the slowest.
+// It first closes the windows that ended before the result came in, as
+// Update does, so that a late one is counted in the next window rather than
+// the one it closes, and returns those it closed. Lost results only go to
+// the loss accounting.
+func (s *Stats) Observe(result ping.Result) []ClosedWindow {
+	at := result.At
+	if at.IsZero() {
+		at = s.Now()
+	}
+	closed := s.CloseWindows(Stored(at))
+
+	if result.Epoch != s.Epoch {
+		if s.Epoch != 0 {
+			if s.Burst != nil && s.Burst.restarting {
+				s.Loss.Pause()
+			} else {
+				s.Loss.Restart(s.Now())
+			}
+			if s.RateLimit != nil {
+				s.RateLimit.Reset()
+			}
+		}
+		if s.Burst != nil {
+			s.Burst.restarting = false
+		}
+		s.Epoch = result.Epoch
+	}
+
+	if result.Server != "" {
+		s.observeDNS(result)
+	} else {
+		s.observeHTTP(result)
+	}
+
+	if result.Lost {
+		// Timeouts are left to the loss tracker's deadline, since ping
+		// reports them while a late reply could still arrive.
+		switch result.Reason {
+		case ping.LOSS_UNREACHABLE:
+			s.Unreachable++
+		case ping.LOSS_REFUSED:
+			s.refused++
+		case ping.LOSS_FRAGMENTATION:
+			s.fragmented++
+			if result.Error != s.lastFragment {
+				s.lastFragment = result.Error
+				s.AddEvent("fragmentation", fmt.Sprintf("probe %d was too big for the path and not allowed to be split up: %s", result.Seq, result.Error))
+			}
+		case ping.LOSS_STATUS, ping.LOSS_RCODE, ping.LOSS_ERROR:
+		default:
+			s.lostUncounted()
+			return closed
+		}
+		s.Loss.Unreachable(result.Seq, s.Now())
+		s.evaluateLoss()
+		return closed
+	}
+
+	if s.Outages != nil {
+		s.Outages.Replied()
+	}
+	s.Loss.Reply(result.Seq, s.Now())
+	s.evaluateLoss()
+	if s.Worst != nil {
+		s.Worst.reply(result.Seq, result.Duration)
+	}
+	s.recoveryReply(result.Seq)
+
+	slow := Slow{At: s.Now(), RTT: result.Duration, Seq: result.Seq}
+	s.SlowWindow.Add(slow)
+	s.SlowTotals.Add(slow)
+
+	if result.TTL > 0 {
+		s.seeTTL(result.TTL)
+	}
+	if estimate, ok := ping.EstimateHops(result.TTL); ok {
+		s.trackHops(estimate, result.TTL)
+	}
+
+	return closed
+}
+
+// HOP_CHANGE_CONFIRMATIONS is how many replies in a row must agree on a new
+// hop count before it is believed, so a single odd reply isn't reported as a
+// path change.
+const HOP_CHANGE_CONFIRMATIONS = 3
+
+func (s *Stats) trackHops(estimate ping.HopEstimate, ttl int) {
+	if s.Hops == nil {
+		s.Hops = &estimate
+		s.ttl = ttl
+		return
+	}
+
+	if estimate == *s.Hops {
+		s.hopStreak = 0
+		return
+	}
+
+	if estimate != s.hopCandidate {
+		s.hopCandidate = estimate
+		s.hopStreak = 0
+	}
+	s.hopStreak++
+
+	if s.hopStreak >= HOP_CHANGE_CONFIRMATIONS {
+		s.AddEvent("path", fmt.Sprintf("hop estimate changed from %s to %s (ttl %d → %d), the path has likely changed", s.Hops.Range(), estimate.Range(), s.ttl, ttl))
+		s.pathChange = &pathChange{at: s.Now(), from: s.ttl, to: ttl}
+		s.Hops = &estimate
+		s.ttl = ttl
+		s.hopStreak = 0
+	}
+}
+
+// PrintLoss is the loss over the window, smoothed and in total, each
+// coloured by the levels.
+func (s *Stats) PrintLoss(t theme.Theme) string {
+	rolling, lost, sent := s.Loss.Rolling(s.Now())
+	totalSent, totalLost := s.Loss.Settled()
+
+	line := fmt.Sprintf("Loss: window %s (%d/%d), smoothed %s, total %s (%d/%d)", s.RenderLoss(t, rolling), lost, sent, s.RenderLoss(t, s.Loss.Smoothed()), s.RenderLoss(t, s.Loss.Cumulative()), totalLost, totalSent)
+	if pending := s.Loss.InFlight(); pending > 0 {
+		line += fmt.Sprintf(", %d awaiting reply", pending)
+	}
+	if s.Unreachable > 0 {
+		line += fmt.Sprintf(", %d unreachable", s.Unreachable)
+	}
+	if s.refused > 0 {
+		line += fmt.Sprintf(", %d refused", s.refused)
+	}
+	if s.fragmented > 0 {
+		line += fmt.Sprintf(", %d too big for the path", s.fragmented)
+	}
+
+	return line
+}
+
+// AdvanceLoss settles overdue probes, which is when loss alerts usually
+// change during an outage.
+func (s *Stats) AdvanceLoss() {
+	s.Loss.Advance(s.Now())
+	s.evaluateLoss()
+	s.checkBurst()
+}
+
+func (s *Stats) evaluateLoss() {
+	s.checkOutages()
+
+	if s.RateLimit != nil {
+		s.checkRateLimit()
+	}
+
+	if s.LossAlerts == nil {
+		return
+	}
+
+	for _, transition := range s.LossAlerts.Evaluate(s.Loss, s.Now()) {
+		if transition.Firing {
+			s.openIncident(transition.Criterion, transition.Detail)
+		} else {
+			s.resolveIncident(transition.Criterion, transition.Detail)
+		}
+	}
+}
+
+func (s *Stats) checkRateLimit() {
+	period := s.RateLimit.Period()
+	if period > 0 && s.RateLimitPeriod == 0 {
+		s.AddEvent("rate-limit", fmt.Sprintf("one probe in %d dropped at a steady spacing with flat latency, consistent with ICMP rate-limiting", period))
+	}
+	if period == 0 && s.RateLimitPeriod > 0 {
+		s.AddEvent("rate-limit", "loss no longer looks like ICMP rate-limiting")
+	}
+
+	s.RateLimitPeriod = period
+	if period > 0 {
+		s.rateLimitSeen = period
+	}
+}
+
+func (s *Stats) PrintRateLimit(t theme.Theme) string {
+	return t.Warn.Render(fmt.Sprintf("Caution: loss pattern consistent with ICMP rate-limiting (1 in %d probes dropped) - consider --mode tcp", s.RateLimitPeriod))
+}
+
+func (s *Stats) PrintLossAlerts(t theme.Theme) string {
+	criteria := s.LossAlerts.Criteria()
+	consecutive, window := s.LossAlerts.Firing()
+
+	state := func(kind string, firing bool) string {
+		if !firing {
+			return t.Good.Render("OK")
+		}
+		if incident := s.ActiveIncidentOf(kind); incident != nil && incident.Acknowledged() {
+			return t.Warn.Render("FIRING (acknowledged)")
+		}
+		return t.Alert.Render("FIRING")
+	}
+
+	var parts []string
+	if criteria.Consecutive > 0 {
+		parts = append(parts, fmt.Sprintf("%d in a row %s", criteria.Consecutive, state(CONSECUTIVE_LOSS, consecutive)))
+	}
+	if criteria.WindowLoss > 0 {
+		parts = append(parts, fmt.Sprintf("over %.1f%% in %s %s", criteria.WindowLoss*100, criteria.Window, state(WINDOW_LOSS, window)))
+	}
+
+	return "Loss alerts: " + strings.Join(parts, ", ")
+}
+
+func (s *Stats) PrintBaseline() string {
+	baseline, ok := s.Baseline.Min()
+	if !ok {
+		return "Baseline: -"
+	}
+
+	return fmt.Sprintf("Baseline %s, current queue delay ≈ +%s", FormatLatency(baseline), FormatLatency(s.queueDelay))
+}
+
+func (s *Stats) PrintExpectation(t theme.Theme) string {
+	headline, ok := s.WindowHeadline()
+	if !ok {
+		return fmt.Sprintf("Expected %s - waiting for samples", s.Expected)
+	}
+
+	deviation := s.deviation(headline)
+	style := t.Good
+	if deviation > 100 {
+		style = t.Bad
+	} else if deviation > 25 {
+		style = t.Warn
+	}
+
+	return fmt.Sprintf("%s %s, %s vs expected %s (worst %+.0f%%)", HeadlineLabel(s.Headline), FormatLatency(headline), style.Render(fmt.Sprintf("%+.0f%%", deviation)), s.Expected, s.worstDeviation)
+}
+
+// PrintProgress describes the window still being filled. Loss is estimated
+// from how many replies should have arrived by now at the probe interval.
+func (s *Stats) PrintProgress() string {
+	elapsed := s.Now().Sub(s.WindowStart)
+	complete := min(elapsed.Seconds()/s.WindowSize.Seconds(), 1) * 100
+
+	line := fmt.Sprintf("%-16s - %s (%d samples)", fmt.Sprintf("Current %3.0f%%", complete), RenderWindow(&s.Window, nil, nil), s.Window.Count)
+	if s.Interval <= 0 {
+		return line
+	}
+
+	expected := max(s.expectedProbes(s.WindowStart, s.Now()), s.Window.Count)
+	if expected == 0 {
+		return line
+	}
+
+	lo, hi := WilsonInterval(expected-s.Window.Count, expected, Z95)
+	return line + fmt.Sprintf(", est. loss %.0f–%.0f%%", lo*100, hi*100)
+}
+
+func (s *Stats) PrintLastEvent(t theme.Theme) string {
+	if len(s.Events) == 0 {
+		return ""
+	}
+
+	last := s.Events[len(s.Events)-1]
+	return t.Alert.Render(fmt.Sprintf("Last event: %s %s - %s", s.Times.Clock(last.Time), last.Kind, last.Message))
+}
+
+func (s *Stats) updateSLO(now time.Time, duration time.Duration) {
+	s.SLO.Record(now, duration)
+
+	status := s.SLO.Status(now)
+	if status.Breached && !s.sloBreached {
+		s.openIncident("slo", fmt.Sprintf("burn rate breach: 5m %.1fx, 1h %.1fx", status.ShortBurn, status.LongBurn))
+	}
+	if !status.Breached && s.sloBreached {
+		s.resolveIncident("slo", "burn rate back within budget")
+	}
+
+	s.sloBreached = status.Breached
+}
+
+func (s *Stats) PrintSLO(t theme.Theme) string {
+	slo := s.SLO.SLO()
+	status := s.SLO.Status(s.Now())
+
+	state := t.Good.Render("OK")
+	if status.Breached {
+		state = t.Alert.Render("BURNING")
+		if incident := s.ActiveIncidentOf("slo"); incident != nil && incident.Acknowledged() {
+			state = t.Warn.Render("BURNING (acknowledged " + s.Times.Clock(*incident.AckedAt) + ")")
+		}
+	}
+
+	return strings.Join([]string{
+		fmt.Sprintf("SLO: %s - %s", slo.String(), state),
+		fmt.Sprintf("Compliance: %.3f%%, Budget used: %.1f%%", status.Compliance*100, status.BudgetConsumed*100),
+		fmt.Sprintf("Burn rate: 5m %.2fx, 1h %.2fx (alert at %.1fx)", status.ShortBurn, status.LongBurn, slo.BurnRateThreshold()),
+	}, "\n")
+}
+
+// updateRolling keeps the rolling histogram covering only the samples from
+// the last WindowSize.
+func (s *Stats) updateRolling(now time.Time, duration time.Duration) {
+	s.Recent = append(s.Recent, sample{At: now, Duration: duration})
+	s.Rolling.Update(duration)
+	s.evictRolling(now)
+}
+
+// evictRolling drops the samples from before the last WindowSize to now,
+// which windows closing on the ticker do too, so that a quiet spell
+// empties it rather than leaving the last replies in it.
+func (s *Stats) evictRolling(now time.Time) {
+	cutoff := now.Add(-s.WindowSize)
+	evict := 0
+	for evict < len(s.Recent) && s.Recent[evict].At.Before(cutoff) {
+		s.Rolling.Remove(s.Recent[evict].Duration)
+		evict++
+	}
+
+	s.Recent = s.Recent[evict:]
+}
+
+// WindowPercentile is computed exactly over the samples in the rolling
+// window.
+func (s *Stats) WindowPercentile(p float64) time.Duration {
+	if len(s.Recent) == 0 {
+		return 0
+	}
+
+	durations := make([]time.Duration, len(s.Recent))
+	for i, sample := range s.Recent {
+		durations[i] = sample.Duration
+	}
+	slices.Sort(durations)
+
+	index := int(math.Ceil(p/100*float64(len(durations)))) - 1
+	return durations[max(index, 0)]
+}
+
+func (s *Stats) PrintHistogram(t theme.Theme, layout HistogramLayout) string {
+	recentMarkers, totalMarkers := s.Rolling.Markers(), s.Histogram.Markers()
+	marked := recentMarkers != nil || totalMarkers != nil
+
+	var lines []string
+	if layout.Vertical {
+		lines = s.verticalHistogram(t, layout)
+	} else {
+		lines = s.horizontalHistogram(t, layout, recentMarkers, totalMarkers)
+	}
+
+	if marked {
+		lines = append(lines, fmt.Sprintf("Markers: %s | Totals: %s", markerLegend(recentMarkers), markerLegend(totalMarkers)))
+	}
+
+	if s.Reference != nil {
+		lines = append(lines, s.PrintReference(t))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (s *Stats) horizontalHistogram(t theme.Theme, layout HistogramLayout, recentMarkers []Marker, totalMarkers []Marker) []string {
+	marked := (recentMarkers != nil || totalMarkers != nil) && layout.fitsMarkers()
+	width := layout.barWidth(marked)
+
+	// The recent side is the bar, its percentage and any marker column.
+	side := width + 8
+	if marked {
+		side += HISTOGRAM_MARKER_WIDTH + 1
+	}
+
+	lines := []string{fmt.Sprintf("%-10s%-*s | Totals: %d", "Histogram", side, fmt.Sprintf("Last %ds: %d", int(s.WindowSize.Seconds()), s.Rolling.Total()), s.Histogram.Total())}
+
+	for i := range s.shownBuckets() {
+		label := ">" + FormatThreshold(s.Histogram.Thresholds()[len(s.Histogram.Thresholds())-1])
+		if i < len(s.Histogram.Thresholds()) {
+			label = FormatThreshold(s.Histogram.Thresholds()[i])
+		}
+
+		recent, recentPercent := s.drawBar(t, &s.Rolling, i, width)
+		total, totalPercent := s.drawBar(t, &s.Histogram, i, width)
+		if !marked {
+			lines = append(lines, fmt.Sprintf("%7s : %s %6.2f%% | %s %6.2f%%", label, recent, recentPercent, total, totalPercent))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%7s : %s %6.2f%% %s | %s %6.2f%% %s",
+			label, recent, recentPercent, t.Header.Render(markerColumn(recentMarkers, i)),
+			total, totalPercent, t.Header.Render(markerColumn(totalMarkers, i))))
+	}
+
+	return lines
+}
+
+// drawBar draws bucket i of h, over the reference's when there is one.
+func (s *Stats) drawBar(t theme.Theme, h *Histogram, i int, width int) (string, float64) {
+	if s.Reference != nil {
+		return s.Reference.bar(t, h, i, width)
+	}
+
+	bar, percent := Bar(h, i, width)
+	return barStyle(t, s.Levels, h, i).Render(bar), percent
+}
@@ -0,0 +1,302 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// PROPERTY_RUNS is how many random sequences of operations TestProperties
+// plays through.
+const PROPERTY_RUNS = 50
+
+// TestProperties feeds random mixes of replies, losses and resets, both
+// daily-style and after a network change, through a Stats the way the model
+// does, checking the invariants after every operation and stopping each
+// sequence at the first operation that breaks one.
+func TestProperties(t *testing.T) {
+	err := quick.Check(func(seed int64) bool { return holdsInvariants(t, seed) }, &quick.Config{MaxCount: PROPERTY_RUNS})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// holdsInvariants plays the operations seed picks through a Stats, a probe a
+// second with the lost ones left to the loss tracker's deadline, reporting
+// whichever invariant breaks first. The losses it settles are added up
+// across the resets, to come to every one sent once the last have settled.
+func holdsInvariants(t *testing.T, seed int64) bool {
+	ok := true
+	check := func(holds bool, invariant string, expected any, actual any) {
+		if holds || !ok {
+			return
+		}
+		ok = false
+		t.Errorf("seed %d, %s: expected %v, got %v", seed, invariant, expected, actual)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(time.Second, time.Duration(1+rng.Intn(10))*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = now, now
+
+	seq := 0
+	lossesSent, lossesCarried := 0, 0
+	windowCounts := 0
+	reply := func() {
+		seq++
+		var d int64
+		if rng.Intn(10) > 0 {
+			d = int64(rng.ExpFloat64() * 40)
+		}
+		latency := time.Duration(d) * time.Millisecond
+		closed := s.Observe(ping.Result{Seq: seq, Epoch: 1, Duration: latency, At: now})
+		for _, w := range append(closed, s.UpdateAt(latency, now)...) {
+			windowCounts += w.Window.Count
+		}
+	}
+
+	for op := 0; op < 2000 && ok; op++ {
+		// The first probe is answered, since the loss tracker counts
+		// from the first reply.
+		switch r := rng.Intn(100); {
+		case op > 0 && r < 3:
+			_, lost := s.Loss.Settled()
+			lossesCarried += lost
+			if r < 1 {
+				s.Reset()
+				windowCounts = 0
+			} else {
+				s.ResetTotals(s.Now())
+				windowCounts = -s.Window.Count
+			}
+
+			sent, lost := s.Loss.Settled()
+			check(s.Totals == Window{}, fmt.Sprintf("op %d: reset zeroes totals", op), Window{}, s.Totals)
+			check(s.Histogram.Total() == 0, fmt.Sprintf("op %d: reset zeroes histogram", op), 0, s.Histogram.Total())
+			check(sent == 0 && lost == 0, fmt.Sprintf("op %d: reset zeroes the loss", op), "0 of 0 lost", fmt.Sprintf("%d of %d", lost, sent))
+			continue
+		case op > 0 && r < 13:
+			now = now.Add(time.Second)
+			seq++
+			lossesSent++
+			for _, w := range s.Observe(ping.Result{Seq: seq, Epoch: 1, Lost: true, At: now}) {
+				windowCounts += w.Window.Count
+			}
+		default:
+			now = now.Add(time.Second)
+			reply()
+		}
+		s.AdvanceLoss()
+
+		for _, w := range []Window{s.Totals, s.Window, s.LastWindow} {
+			if w.Count == 0 {
+				continue
+			}
+			avg := w.Average()
+			check(w.Min <= avg && avg <= w.Max, fmt.Sprintf("op %d: min <= avg <= max", op), fmt.Sprintf("%s <= avg <= %s", w.Min, w.Max), avg)
+		}
+
+		check(windowCounts+s.Window.Count == s.Totals.Count, fmt.Sprintf("op %d: window counts sum to totals", op), s.Totals.Count, windowCounts+s.Window.Count)
+
+		bucketed := 0
+		for _, count := range s.Histogram.Buckets() {
+			bucketed += count
+		}
+		check(bucketed+s.Histogram.Overflow() == s.Histogram.Total(), fmt.Sprintf("op %d: histogram buckets plus overflow match total", op), s.Histogram.Total(), bucketed+s.Histogram.Overflow())
+		check(s.Histogram.Total() == s.Totals.Count, fmt.Sprintf("op %d: histogram total matches sample count", op), s.Totals.Count, s.Histogram.Total())
+
+		sent, lost := s.Loss.Settled()
+		check(sent-lost == s.Totals.Count, fmt.Sprintf("op %d: probes settled as answered match the replies in the totals", op), s.Totals.Count, sent-lost)
+		check(lossesCarried+lost <= lossesSent, fmt.Sprintf("op %d: no more settled lost than were", op), fmt.Sprintf("at most %d", lossesSent), lossesCarried+lost)
+		loss := s.Loss.Cumulative()
+		check(loss >= 0 && loss <= 1, fmt.Sprintf("op %d: loss within 0-100%%", op), "0 <= loss <= 1", fmt.Sprintf("%.4f", loss))
+	}
+
+	// Enough replies for the deadline of the last lost to pass.
+	for range int(LossTimeout(time.Second)/time.Second) + 1 {
+		now = now.Add(time.Second)
+		reply()
+		s.AdvanceLoss()
+	}
+	_, lost := s.Loss.Settled()
+	check(lossesCarried+lost == lossesSent, "at the end: every probe lost is counted once, across the resets", lossesSent, lossesCarried+lost)
+
+	return ok
+}
+
+// TestTCP times handshakes to a local listener, then closes it and
+// checks the refusals that follow arrive as lost probes, counted as refused,
+// rather than stopping the pinger.
+func TestTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: expected no error, got %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	pinger := ping.NewPinger("127.0.0.1", time.Second).TCP(port)
+	if backend := pinger.Backend(); backend != "tcp" {
+		t.Fatalf("backend for a tcp pinger: expected tcp, got %q", backend)
+	}
+	pings, errs := pinger.Run(ctx)
+
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	for connected, refused := false, false; !refused; {
+		select {
+		case result := <-pings:
+			s.Observe(result)
+			switch {
+			case !result.Lost && !connected:
+				connected = true
+				listener.Close()
+			case result.Lost && connected:
+				if result.Reason != ping.LOSS_REFUSED {
+					t.Fatalf("probe to a closed port: expected %q, got %q", ping.LOSS_REFUSED, result.Reason)
+				}
+				refused = true
+			case result.Lost:
+				t.Fatalf("probe to a listening port: expected a connection, got %q", result.Reason)
+			}
+		case err := <-errs:
+			t.Fatalf("refused connections: expected lost probes, got the pinger stopped: %v", err)
+		case <-ctx.Done():
+			t.Fatalf("probing a local listener: expected a connection then a refusal, got timed out")
+		}
+	}
+
+	if s.refused != 1 || !strings.Contains(s.PrintLoss(theme.Theme{}), "1 refused") {
+		t.Fatalf("refusals in the loss line: expected 1 refused, got %q", s.PrintLoss(theme.Theme{}))
+	}
+}
+
+// TestWindow checks the standard deviation and jitter of empty and
+// single-sample windows, a series small enough to work out by hand, and
+// random samples against a brute-force pass over all of them, including
+// far from zero where a naive sum of squares loses its precision.
+func TestWindow(t *testing.T) {
+	var empty Window
+	if empty.Average() != 0 || empty.StdDev() != 0 || empty.Jitter() != 0 || strings.Count(RenderWindow(&empty, nil, nil), "-") != 5 {
+		t.Fatalf("an empty window: expected zero spread and dashes throughout, got %+v: %s", empty, RenderWindow(&empty, nil, nil))
+	}
+
+	var single Window
+	single.Update(42 * time.Millisecond)
+	if single.Average() != 42*time.Millisecond || single.StdDev() != 0 || single.Jitter() != 0 {
+		t.Fatalf("a single sample: expected avg 42ms, no spread or jitter, got avg %s, sd %s, jitter %s", single.Average(), single.StdDev(), single.Jitter())
+	}
+
+	var steps Window
+	for _, ms := range []time.Duration{10, 20, 10, 20, 40} {
+		steps.Update(ms * time.Millisecond)
+	}
+	if math.Abs(Milliseconds(steps.StdDev())-10.954451) > 1e-6 || steps.Jitter() != 12500*time.Microsecond {
+		t.Fatalf("10, 20, 10, 20, 40ms: expected sd 10.954451ms, jitter 12.5ms, got sd %s, jitter %s", steps.StdDev(), steps.Jitter())
+	}
+
+	steps.Reset()
+	if steps != (Window{}) {
+		t.Fatalf("a reset window: expected nothing left over, got %+v", steps)
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	for _, offset := range []int64{0, 1 << 40} {
+		var w Window
+		var durations []int64
+		for i := 0; i < 5000; i++ {
+			duration := offset + int64(rng.Intn(200))
+			w.Update(time.Duration(duration) * time.Millisecond)
+			durations = append(durations, duration)
+		}
+
+		var sum, swing float64
+		for i, duration := range durations {
+			sum += float64(duration - offset)
+			if i > 0 {
+				swing += math.Abs(float64(duration - durations[i-1]))
+			}
+		}
+		mean := sum / float64(len(durations))
+		var squares float64
+		for _, duration := range durations {
+			squares += (float64(duration-offset) - mean) * (float64(duration-offset) - mean)
+		}
+		stddev, jitter := math.Sqrt(squares/float64(len(durations))), swing/float64(len(durations)-1)
+
+		// Both are kept to the nanosecond, a millionth of a millisecond.
+		if math.Abs(Milliseconds(w.StdDev())-stddev) > 1e-3 || math.Abs(Milliseconds(w.Jitter())-jitter) > 1e-6 {
+			t.Fatalf("5000 random samples offset by %d: expected sd %f, jitter %f, got sd %s, jitter %s", offset, stddev, jitter, w.StdDev(), w.Jitter())
+		}
+	}
+}
+
+// TestSubSecondInterval probes every 100ms into one second windows,
+// checking each holds the samples up to and on its second, and that the system
+// ping is asked for the fractional interval and refused one it won't allow.
+func TestSubSecondInterval(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	s := New(100*time.Millisecond, time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+
+	rollovers := 0
+	for i := 1; i <= 50; i++ {
+		now = start.Add(time.Duration(i) * 100 * time.Millisecond)
+		if !s.Update(20 * time.Millisecond) {
+			continue
+		}
+		rollovers++
+		if s.LastWindow.Count != 10 {
+			t.Fatalf("each window holds the samples up to the one on its second: expected 10 samples, got %d in window %d", s.LastWindow.Count, rollovers)
+		}
+	}
+	if rollovers != 4 {
+		t.Fatalf("50 samples 100ms apart close a window every second: expected 4 rollovers, got %v", rollovers)
+	}
+	if s.Totals.Count != 50 {
+		t.Fatalf("every sample reaches the totals: expected 50, got %v", s.Totals.Count)
+	}
+
+	args := strings.Join(ping.StreamArgs("example.com", "", 200*time.Millisecond, "linux", nil), " ")
+	if !strings.Contains(args, "-i 0.2") {
+		t.Fatalf("a 200ms interval is passed to ping in seconds: expected -i 0.2, got %q", args)
+	}
+
+	if err := ping.CheckInterval(100*time.Millisecond, "exec", "linux", false); err == nil || !strings.Contains(err.Error(), "--native") {
+		t.Fatalf("100ms with the system ping is refused, pointing at --native: expected an error naming --native, got %v", err)
+	}
+	for _, allowed := range []struct {
+		backend string
+		root    bool
+	}{{"native", false}, {"exec", true}, {"tcp", false}} {
+		if err := ping.CheckInterval(100*time.Millisecond, allowed.backend, "linux", allowed.root); err != nil {
+			t.Fatalf("100ms is allowed with %s, root %t: expected no error, got %v", allowed.backend, allowed.root, err)
+		}
+	}
+	if err := ping.CheckInterval(time.Millisecond, "native", "linux", true); err == nil {
+		t.Fatalf("1ms is refused by every backend: expected an error, got none")
+	}
+}
@@ -0,0 +1,14 @@
+package stats
+
+import (
+	"time"
+)
+
+type StatusSample struct {
+	Time  time.Time `json:"time"`
+	Seq   int       `json:"seq"`
+	Lost  bool      `json:"lost"`
+	RTTMs *float64  `json:"rtt_ms,omitempty"`
+	TTL   int       `json:"ttl,omitempty"`
+	Epoch int       `json:"epoch,omitempty"`
+}
@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	DEFAULT_WARN_LATENCY = 80 * time.Millisecond
+	DEFAULT_CRIT_LATENCY = 200 * time.Millisecond
+	DEFAULT_WARN_LOSS    = "1%"
+	DEFAULT_CRIT_LOSS    = "5%"
+)
+
+// Over is whether value is past threshold, a zero threshold being unset.
+// The colours and the exit thresholds both go by it, so that they never
+// disagree on a figure at the threshold.
+func Over[T time.Duration | float64](value T, threshold T) bool {
+	return threshold > 0 && value > threshold
+}
+
+// Levels are what --warn and --crit colour latencies by, and --warn-loss
+// and --crit-loss the loss, a zero one leaving that colour out.
+type Levels struct {
+	Warn     time.Duration
+	Crit     time.Duration
+	WarnLoss float64
+	CritLoss float64
+}
+
+// style is the theme's colour for a figure against its levels, or none when
+// neither is set, as when attached to another instance.
+func (l Levels) style(t theme.Theme, set bool, warn bool, crit bool) lipgloss.Style {
+	switch {
+	case !set:
+		return lipgloss.NewStyle()
+	case crit:
+		return t.Bad
+	case warn:
+		return t.Warn
+	}
+
+	return t.Good
+}
+
+func (l Levels) Latency(t theme.Theme, d time.Duration) lipgloss.Style {
+	return l.style(t, l.Warn > 0 || l.Crit > 0, Over(d, l.Warn), Over(d, l.Crit))
+}
+
+func (l Levels) Loss(t theme.Theme, loss float64) lipgloss.Style {
+	return l.style(t, l.WarnLoss > 0 || l.CritLoss > 0, Over(loss, l.WarnLoss), Over(loss, l.CritLoss))
+}
+
+// critBucket is whether every latency in a bucket starting from lower is
+// past --crit.
+func (l Levels) critBucket(lower time.Duration) bool {
+	return l.Crit > 0 && lower >= l.Crit
+}
+
+// renderWindow is a window with its average coloured by the levels.
+func (s *Stats) renderWindow(t theme.Theme, w *Window) string {
+	return RenderWindow(w, func(avg time.Duration, text string) string { return s.Levels.Latency(t, avg).Render(text) }, nil)
+}
+
+// RenderLastWindow is the last window, which once it closed with no replies
+// says so, with the loss over it if any probes settled, rather than reading
+// as no figures yet.
+func (s *Stats) RenderLastWindow(t theme.Theme) string {
+	switch {
+	case s.LastWindow.Count > 0 || s.LastStart.IsZero():
+	case s.lastSettled == 0:
+		return t.Bad.Render("no data")
+	default:
+		return t.Bad.Render(fmt.Sprintf("no data, %.0f%% loss", s.lastLoss*100))
+	}
+
+	return s.renderWindow(t, &s.LastWindow)
+}
+
+// RenderTotals is the run's totals, as renderWindow, with when the min and
+// max were.
+func (s *Stats) RenderTotals(t theme.Theme) string {
+	return RenderWindow(&s.Totals, func(avg time.Duration, text string) string { return s.Levels.Latency(t, avg).Render(text) }, s.Times.Clock)
+}
+
+// TotalsString is the totals for plain output, which stamps the min and max
+// in full, as it does its lines.
+func (s *Stats) TotalsString() string {
+	return RenderWindow(&s.Totals, nil, s.Times.Stamp)
+}
+
+// RenderLatency is a single latency coloured by the levels.
+func (s *Stats) RenderLatency(t theme.Theme, d time.Duration) string {
+	return s.Levels.Latency(t, d).Render(FormatLatency(d))
+}
+
+func (s *Stats) RenderLoss(t theme.Theme, loss float64) string {
+	return s.Levels.Loss(t, loss).Render(fmt.Sprintf("%.1f%%", loss*100))
+}
+
+// barStyle is how bucket i's bar is drawn, in the theme's Bad once every
+// latency in it is past --crit.
+func barStyle(t theme.Theme, l Levels, h *Histogram, i int) lipgloss.Style {
+	if i > 0 && l.critBucket(h.Thresholds()[i-1]) {
+		return t.Bad
+	}
+
+	return t.Bar
+}
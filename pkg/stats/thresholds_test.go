@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+func TestLevels(t *testing.T) {
+	if Over(80*time.Millisecond, 80*time.Millisecond) || Over(time.Second, 0) || !Over(0.021, 0.02) {
+		t.Fatalf("a figure is only over a threshold that's set and it's past: expected true only for 2.1%% against 2%%, got otherwise")
+	}
+
+	// A run averaging exactly 80ms neither fails --max-avg 80ms nor colours
+	// as a warning at --warn 80ms, and both change together a millisecond on.
+	th := theme.Default()
+	for _, avg := range []int64{80, 81} {
+		s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+		s.Totals.Update(time.Duration(avg) * time.Millisecond)
+		s.Levels = Levels{Warn: 80 * time.Millisecond, Crit: 200 * time.Millisecond}
+		failed := s.Breached(ExitThresholds{MaxAvg: 80 * time.Millisecond}) != ""
+		warned := s.Levels.Latency(th, time.Duration(avg)*time.Millisecond).GetForeground() == th.Warn.GetForeground()
+		if failed != warned || failed != (avg == 81) {
+			t.Fatalf("the colours and the exit thresholds agree: expected %dms failing and warning alike, got failed %th, warned %th", avg, failed, warned)
+		}
+	}
+
+	l := Levels{Warn: 80 * time.Millisecond, Crit: 200 * time.Millisecond, WarnLoss: 0.01, CritLoss: 0.05}
+	for _, c := range []struct {
+		style    lipgloss.Style
+		expected lipgloss.Style
+		name     string
+	}{
+		{l.Latency(th, 12*time.Millisecond), th.Good, "12ms"},
+		{l.Latency(th, 400*time.Millisecond), th.Bad, "400ms"},
+		{l.Loss(th, 0.02), th.Warn, "2% loss"},
+		{l.Loss(th, 0.1), th.Bad, "10% loss"},
+		{Levels{}.Latency(th, 400*time.Millisecond), lipgloss.NewStyle(), "400ms with no levels"},
+	} {
+		if c.style.GetForeground() != c.expected.GetForeground() {
+			t.Fatalf("each figure is coloured by its level: expected %s in %v, got %v", c.name, c.expected.GetForeground(), c.style.GetForeground())
+		}
+	}
+
+	h := NewHistogram(DEFAULT_THRESHOLDS)
+	for i, expected := range map[int]lipgloss.Style{9: th.Bar, 10: th.Bad, len(DEFAULT_THRESHOLDS): th.Bad} {
+		if barStyle(th, l, &h, i).GetForeground() != expected.GetForeground() {
+			t.Fatalf("only buckets wholly past --crit are tinted: expected bucket %d in %v, got %v", i, expected.GetForeground(), barStyle(th, l, &h, i).GetForeground())
+		}
+	}
+
+	w := Window{}
+	w.Update(23 * time.Millisecond)
+	if line := RenderWindow(&w, func(_ time.Duration, text string) string { return "[" + text + "]" }, nil); !strings.Contains(line, "Avg: [  23.0ms], SD:") {
+		t.Fatalf("the average is styled padded to its column: expected Avg: [  23.0ms], SD:, got %q", line)
+	}
+}
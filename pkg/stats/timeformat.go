@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TIME_LOCAL    = "local"
+	TIME_UTC      = "utc"
+	TIME_UNIX     = "unix"
+	TIME_RELATIVE = "relative"
+
+	// STORED_TIME is how timestamps are written to files, always in UTC, so
+	// that they mean the same wherever they're read.
+	STORED_TIME = "2006-01-02T15:04:05.000Z07:00"
+)
+
+var TIME_FORMATS = []string{TIME_LOCAL, TIME_UTC, TIME_UNIX, TIME_RELATIVE}
+
+// TimeFormat is how timestamps are shown, as opposed to how they're stored.
+// The zero value shows local time.
+type TimeFormat struct {
+	mode     string
+	start    time.Time
+	location *time.Location
+}
+
+func NewTimeFormat(mode string, start time.Time, location *time.Location) (TimeFormat, error) {
+	if mode == "" {
+		mode = TIME_LOCAL
+	}
+	if !slices.Contains(TIME_FORMATS, mode) {
+		return TimeFormat{}, fmt.Errorf("unknown time format %q, expected one of: %s", mode, strings.Join(TIME_FORMATS, ", "))
+	}
+
+	return TimeFormat{mode: mode, start: start, location: location}, nil
+}
+
+// Stored is a timestamp as it's kept: in UTC, to the millisecond.
+func Stored(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+func (f TimeFormat) local() *time.Location {
+	if f.location == nil {
+		return time.Local
+	}
+
+	return f.location
+}
+
+// Clock is the short form, for the panes of the display. Local times carry
+// their zone, so that the hour repeated when clocks go back can be told
+// apart.
+func (f TimeFormat) Clock(t time.Time) string {
+	switch f.mode {
+	case TIME_UTC:
+		return t.UTC().Format("15:04:05 MST")
+	case TIME_UNIX, TIME_RELATIVE:
+		return f.Stamp(t)
+	default:
+		return t.In(f.local()).Format("15:04:05 MST")
+	}
+}
+
+// Stamp is the full form, for output read line by line and for reports.
+func (f TimeFormat) Stamp(t time.Time) string {
+	switch f.mode {
+	case TIME_UTC:
+		return t.UTC().Format(STORED_TIME)
+	case TIME_UNIX:
+		return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+	case TIME_RELATIVE:
+		return relativeTime(t.Sub(f.start))
+	default:
+		return t.In(f.local()).Format(STORED_TIME)
+	}
+}
+
+// relativeTime is an offset from the start of the run, such as +1h02m03s.
+func relativeTime(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign, d = "-", -d
+	}
+
+	d = d.Truncate(time.Second)
+	hours, minutes, seconds := int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second)
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%s%dh%02dm%02ds", sign, hours, minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%s%dm%02ds", sign, minutes, seconds)
+	default:
+		return fmt.Sprintf("%s%ds", sign, seconds)
+	}
+}
+
+// Zone names the zone local times are shown in, with its current offset.
+func (f TimeFormat) Zone(now time.Time) string {
+	if f.mode == TIME_UTC || f.mode == TIME_UNIX {
+		return "UTC"
+	}
+
+	location := f.local()
+	abbreviation, offset := now.In(location).Zone()
+	zone := fmt.Sprintf("%s (%s)", abbreviation, formatOffset(offset))
+	if name := location.String(); name != "Local" && name != abbreviation {
+		zone = name + " " + zone
+	}
+
+	return zone
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+
+	return fmt.Sprintf("%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
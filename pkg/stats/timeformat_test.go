@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestTimeFormat shows the same two events under each --time-format,
+// half an hour and an hour and a half into a run that starts just before
+// the UK's clocks go back, so that both are at 01:30 local time. They have
+// to be told apart by their zone, and stored in UTC whatever is shown.
+func TestTimeFormat(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("load Europe/London: expected no error, got %v", err)
+	}
+
+	start := time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)
+	before, after := start.Add(30*time.Minute+123456*time.Microsecond), start.Add(90*time.Minute)
+
+	cases := []struct {
+		mode             string
+		clock, stamp     [2]string
+		zoneBeforeChange string
+	}{
+		{TIME_LOCAL, [2]string{"01:30:00 BST", "01:30:00 GMT"}, [2]string{"2026-10-25T01:30:00.123+01:00", "2026-10-25T01:30:00.000Z"}, "Europe/London BST (+01:00)"},
+		{TIME_UTC, [2]string{"00:30:00 UTC", "01:30:00 UTC"}, [2]string{"2026-10-25T00:30:00.123Z", "2026-10-25T01:30:00.000Z"}, "UTC"},
+		{TIME_UNIX, [2]string{"1792888200.123", "1792891800.000"}, [2]string{"1792888200.123", "1792891800.000"}, "UTC"},
+		{TIME_RELATIVE, [2]string{"+30m00s", "+1h30m00s"}, [2]string{"+30m00s", "+1h30m00s"}, "Europe/London BST (+01:00)"},
+	}
+
+	for _, c := range cases {
+		times, err := NewTimeFormat(c.mode, start, london)
+		if err != nil {
+			t.Fatalf("time format %s: expected no error, got %v", c.mode, err)
+		}
+
+		now := before.In(london)
+		s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+		s.Clock = func() time.Time { return now }
+		s.Times = times
+
+		for i, at := range []time.Time{before, after} {
+			now = at.In(london)
+			s.AddEvent("selftest", "an event")
+
+			event := s.Events[len(s.Events)-1]
+			if event.Time.Location() != time.UTC || !event.Time.Equal(at.Truncate(time.Millisecond)) {
+				t.Fatalf("%s: stored event time: expected UTC to the millisecond, got %q", c.mode, event.Time.String())
+			}
+			if clock := times.Clock(event.Time); clock != c.clock[i] {
+				t.Fatalf("%s: clock time of event %v: expected %q, got %q", c.mode, i+1, c.clock[i], clock)
+			}
+			if stamp := times.Stamp(event.Time); stamp != c.stamp[i] {
+				t.Fatalf("%s: full time of event %v: expected %q, got %q", c.mode, i+1, c.stamp[i], stamp)
+			}
+			if line := s.PrintLastEvent(theme.Theme{}); !strings.Contains(line, c.clock[i]) {
+				t.Fatalf("%s: event pane: expected showing %q, got %q", c.mode, c.clock[i], line)
+			}
+		}
+
+		if zone := times.Zone(before); zone != c.zoneBeforeChange {
+			t.Fatalf("%s: zone recorded: expected %q, got %q", c.mode, c.zoneBeforeChange, zone)
+		}
+	}
+
+	if _, err := NewTimeFormat("iso", start, london); err == nil {
+		t.Fatalf("an unknown time format: expected an error, got accepted")
+	}
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"container/heap"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+type Slow struct {
+	At  time.Time
+	RTT time.Duration
+	Seq int
+}
+
+func (s Slow) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		At    time.Time `json:"at"`
+		RTTMs float64   `json:"rtt_ms"`
+		Seq   int       `json:"seq"`
+	}{s.At, float64(s.RTT.Microseconds()) / 1000, s.Seq})
+}
+
+type slowHeap []Slow
+
+func (h slowHeap) Len() int           { return len(h) }
+func (h slowHeap) Less(i, j int) bool { return h[i].RTT < h[j].RTT }
+func (h slowHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *slowHeap) Push(x any)        { *h = append(*h, x.(Slow)) }
+func (h *slowHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// TopN keeps the n slowest samples seen in a min-heap, so the fastest of
+// them is the one evicted when a slower sample arrives.
+type TopN struct {
+	n     int
+	items slowHeap
+}
+
+func NewTopN(n int) *TopN {
+	return &TopN{n: n}
+}
+
+func (t *TopN) Add(sample Slow) {
+	if t.n <= 0 {
+		return
+	}
+
+	if len(t.items) < t.n {
+		heap.Push(&t.items, sample)
+		return
+	}
+
+	if sample.RTT > t.items[0].RTT {
+		t.items[0] = sample
+		heap.Fix(&t.items, 0)
+	}
+}
+
+// Sorted returns the retained samples, slowest first.
+func (t *TopN) Sorted() []Slow {
+	sorted := append([]Slow{}, t.items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].RTT > sorted[j].RTT })
+	return sorted
+}
+
+func (t *TopN) Reset() {
+	t.items = t.items[:0]
+}
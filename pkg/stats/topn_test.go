@@ -0,0 +1,41 @@
+package stats
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestTopN checks the slowest-samples heap against a full sort after
+// every sample, including ties and resets.
+func TestTopN(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	top := NewTopN(5)
+	var all []time.Duration
+
+	for i := 0; i < 3000; i++ {
+		if i%500 == 499 {
+			top.Reset()
+			all = nil
+		}
+
+		rtt := time.Duration(rng.Intn(50)) * time.Millisecond
+		top.Add(Slow{RTT: rtt, Seq: i})
+		all = append(all, rtt)
+
+		expected := append([]time.Duration{}, all...)
+		sort.Slice(expected, func(a, b int) bool { return expected[a] > expected[b] })
+		expected = expected[:min(5, len(expected))]
+
+		var actual []time.Duration
+		for _, slow := range top.Sorted() {
+			actual = append(actual, slow.RTT)
+		}
+
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Fatalf("sample %d: top 5: expected %v, got %v", i, expected, actual)
+		}
+	}
+}
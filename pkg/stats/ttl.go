@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// PATH_NOTICE_DURATION is how long a change of path is flagged on the summary
+// tab once it's believed.
+const PATH_NOTICE_DURATION = time.Minute
+
+// pathChange is the TTL replies come back with changing, for long enough to
+// be believed, which usually means the route changed or failed over.
+type pathChange struct {
+	at   time.Time
+	from int
+	to   int
+}
+
+// seeTTL counts a reply's TTL over the run.
+func (s *Stats) seeTTL(ttl int) {
+	if s.ttls == nil {
+		s.ttls = map[int]int{}
+	}
+	s.ttls[ttl]++
+	s.lastTTL = ttl
+}
+
+// DistinctTTLs lists the TTLs replies came back with over the run, lowest
+// first.
+func (s *Stats) DistinctTTLs() []int {
+	return slices.Sorted(maps.Keys(s.ttls))
+}
+
+// PrintTTL is the TTL of the last reply and how many have been seen over the
+// run, after a warning about the path changing if it did within
+// PATH_NOTICE_DURATION.
+func (s *Stats) PrintTTL(t theme.Theme) string {
+	if s.lastTTL == 0 {
+		return ""
+	}
+
+	line := fmt.Sprintf("TTL: %d", s.lastTTL)
+	if ttls := s.DistinctTTLs(); len(ttls) > 1 {
+		values := make([]string, len(ttls))
+		for i, ttl := range ttls {
+			values[i] = strconv.Itoa(ttl)
+		}
+		line += fmt.Sprintf(", %d seen over the run (%s)", len(ttls), strings.Join(values, ", "))
+	}
+
+	if change := s.pathChange; change != nil && s.Now().Sub(change.at) < PATH_NOTICE_DURATION {
+		return t.Warn.Render(fmt.Sprintf("Route changed at %s: ttl %d → %d", s.Times.Clock(change.at), change.from, change.to)) + "\n" + line
+	}
+
+	return line
+}
@@ -0,0 +1,66 @@
+package stats
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestTTL feeds replies whose TTL changes partway, once for a single
+// odd reply and then for good, and checks the change is only believed once
+// it holds, that it's logged and flagged, and every TTL is counted.
+func TestTTL(t *testing.T) {
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	s := New(time.Second, time.Minute, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart, s.Started = start, start
+
+	seq := 0
+	reply := func(ttl int) {
+		seq++
+		now = start.Add(time.Duration(seq) * time.Second)
+		s.Observe(ping.Result{Seq: seq, TTL: ttl, Duration: 10 * time.Millisecond, Epoch: 1})
+		s.Update(10 * time.Millisecond)
+	}
+
+	for _, ttl := range []int{57, 57, 57, 58, 57, 57} {
+		reply(ttl)
+	}
+	if s.pathChange != nil || len(s.Events) > 0 {
+		t.Fatalf("a single odd TTL isn't a path change: expected no change, got %v, %d events", s.pathChange, len(s.Events))
+	}
+	if line := s.PrintTTL(theme.Theme{}); line != "TTL: 57, 2 seen over the run (57, 58)" {
+		t.Fatalf("the latest TTL is shown with every one seen: expected TTL: 57, 2 seen over the run (57, 58), got %q", line)
+	}
+
+	for range HOP_CHANGE_CONFIRMATIONS {
+		reply(56)
+	}
+	changedAt := now
+	if s.pathChange == nil || s.pathChange.from != 57 || s.pathChange.to != 56 || !s.pathChange.at.Equal(changedAt) {
+		t.Fatalf("a TTL that holds is a path change: expected 57 → 56, got %v", s.pathChange)
+	}
+	if last := s.Events[len(s.Events)-1]; last.Kind != "path" || !strings.Contains(last.Message, "ttl 57 → 56") {
+		t.Fatalf("the path change is logged: expected a path event, got %s: %s", last.Kind, last.Message)
+	}
+	expected := "Route changed at " + s.Times.Clock(changedAt) + ": ttl 57 → 56\nTTL: 56, 3 seen over the run (56, 57, 58)"
+	if line := s.PrintTTL(theme.Theme{}); line != expected {
+		t.Fatalf("the path change is flagged:\nexpected:\n%s\ngot:\n%s", expected, line)
+	}
+
+	now = changedAt.Add(PATH_NOTICE_DURATION)
+	if line := s.PrintTTL(theme.Theme{}); strings.Contains(line, "Route changed") {
+		t.Fatalf("the flag clears after a while: expected TTL: 56, 3 seen over the run (56, 57, 58), got %q", line)
+	}
+
+	s.Reset()
+	reply(56)
+	if ttls := s.DistinctTTLs(); !slices.Equal(ttls, []int{56}) {
+		t.Fatalf("a reset starts the TTLs over: expected [56], got %v", ttls)
+	}
+}
@@ -0,0 +1,7 @@
+package stats
+
+const (
+	WATERFALL_LABEL_WIDTH = 8
+	WATERFALL_VALUE_WIDTH = 10
+	DEFAULT_VIEW_WIDTH    = 80
+)
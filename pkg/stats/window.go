@@ -0,0 +1,195 @@
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Window keeps the latencies as they were measured, so that a LAN's
+// sub-millisecond round trips don't all come out as zero.
+type Window struct {
+	Min   time.Duration
+	Max   time.Duration
+	Total time.Duration
+	Count int
+	// Mean and M2 are Welford's running mean and sum of squared deviations,
+	// in milliseconds, and Swing the sum of differences between consecutive
+	// samples, so that spread and jitter need no samples kept.
+	Mean  float64
+	M2    float64
+	Last  time.Duration
+	Swing time.Duration
+	// MinAt and MaxAt are when the replies setting Min and Max came in.
+	MinAt time.Time
+	MaxAt time.Time
+	// Weight and Weighted are the sums of the samples' weights and of their
+	// latencies by weight, left at zero until a sample counts for other
+	// than one, when the average goes by them instead.
+	Weight   float64
+	Weighted time.Duration
+}
+
+// windowJSON is a Window as the state and results files have always stored
+// it, in milliseconds, which are fractional now rather than whole.
+type windowJSON struct {
+	Min   float64
+	Max   float64
+	Total float64
+	Count int
+	Mean  float64
+	M2    float64
+	Last  float64
+	Swing float64
+
+	MinAt    *time.Time `json:",omitempty"`
+	MaxAt    *time.Time `json:",omitempty"`
+	Weight   float64    `json:",omitempty"`
+	Weighted float64    `json:",omitempty"`
+}
+
+func (w Window) MarshalJSON() ([]byte, error) {
+	return json.Marshal(windowJSON{
+		Min:   milliseconds(w.Min),
+		Max:   milliseconds(w.Max),
+		Total: milliseconds(w.Total),
+		Count: w.Count,
+		Mean:  w.Mean,
+		M2:    w.M2,
+		Last:  milliseconds(w.Last),
+		Swing: milliseconds(w.Swing),
+		MinAt: StoredAt(w.MinAt),
+		MaxAt: StoredAt(w.MaxAt),
+
+		Weight:   w.Weight,
+		Weighted: milliseconds(w.Weighted),
+	})
+}
+
+func (w *Window) UnmarshalJSON(data []byte) error {
+	var stored windowJSON
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	*w = Window{
+		Min:   fromMilliseconds(stored.Min),
+		Max:   fromMilliseconds(stored.Max),
+		Total: fromMilliseconds(stored.Total),
+		Count: stored.Count,
+		Mean:  stored.Mean,
+		M2:    stored.M2,
+		Last:  fromMilliseconds(stored.Last),
+		Swing: fromMilliseconds(stored.Swing),
+
+		Weight:   stored.Weight,
+		Weighted: fromMilliseconds(stored.Weighted),
+	}
+	if stored.MinAt != nil {
+		w.MinAt = *stored.MinAt
+	}
+	if stored.MaxAt != nil {
+		w.MaxAt = *stored.MaxAt
+	}
+	return nil
+}
+
+// StoredAt is t as files store it, in UTC to the millisecond, or nil for
+// none.
+func StoredAt(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	t = t.UTC().Truncate(time.Millisecond)
+	return &t
+}
+
+func (w *Window) Update(duration time.Duration) {
+	w.UpdateAt(duration, time.Time{})
+}
+
+// UpdateAt is Update for a reply that came in at, which is kept if it sets
+// a new min or max.
+func (w *Window) UpdateAt(duration time.Duration, at time.Time) {
+	w.UpdateWeighted(duration, at, 1)
+}
+
+// UpdateWeighted is UpdateAt for a sample counting for weight in the
+// average, as one sent faster than usual counts for less.
+func (w *Window) UpdateWeighted(duration time.Duration, at time.Time, weight float64) {
+	if w.Weight == 0 && weight != 1 {
+		w.Weight = float64(w.Count)
+		w.Weighted = w.Total
+	}
+	if w.Weight > 0 || weight != 1 {
+		w.Weight += weight
+		w.Weighted += time.Duration(float64(duration) * weight)
+	}
+
+	if w.Count == 0 || duration < w.Min {
+		w.Min = duration
+		w.MinAt = at
+	}
+
+	if duration > w.Max {
+		w.Max = duration
+		w.MaxAt = at
+	}
+
+	if w.Count > 0 {
+		w.Swing += max(duration-w.Last, w.Last-duration)
+	}
+	w.Last = duration
+
+	w.Total += duration
+	w.Count++
+
+	ms := milliseconds(duration)
+	delta := ms - w.Mean
+	w.Mean += delta / float64(w.Count)
+	w.M2 += delta * (ms - w.Mean)
+}
+
+func (w *Window) Reset() {
+	*w = Window{}
+}
+
+func (w *Window) Average() time.Duration {
+	if w.Count == 0 {
+		return 0
+	}
+	if w.Weight > 0 {
+		return time.Duration(float64(w.Weighted) / w.Weight)
+	}
+
+	return w.Total / time.Duration(w.Count)
+}
+
+// StdDev is the population standard deviation of the samples, and zero
+// until there are two of them.
+func (w *Window) StdDev() time.Duration {
+	if w.Count < 2 {
+		return 0
+	}
+
+	return fromMilliseconds(math.Sqrt(max(w.M2, 0) / float64(w.Count)))
+}
+
+// Jitter is the mean absolute difference between consecutive samples, and
+// zero until there are two of them.
+func (w *Window) Jitter() time.Duration {
+	if w.Count < 2 {
+		return 0
+	}
+
+	return w.Swing / time.Duration(w.Count-1)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(math.Round(ms * float64(time.Millisecond)))
+}
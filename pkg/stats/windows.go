@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+const DEFAULT_WINDOW_HISTORY = 120
+
+// WindowRecord is a completed window as the windows tab and the results
+// summary keep it, so that a blip can still be found after the windows since
+// have closed.
+type WindowRecord struct {
+	Start   time.Time  `json:"start"`
+	End     time.Time  `json:"end"`
+	Count   int        `json:"count"`
+	MinMs   float64    `json:"min_ms"`
+	AvgMs   float64    `json:"avg_ms"`
+	MaxMs   float64    `json:"max_ms"`
+	LossPct float64    `json:"loss_pct"`
+	MinAt   *time.Time `json:"min_at,omitempty"`
+	MaxAt   *time.Time `json:"max_at,omitempty"`
+}
+
+// Worse is whether r is a worse window than other: more loss, or as much
+// and slower on average, a window with no replies at all being the worst.
+func (r WindowRecord) Worse(other WindowRecord) bool {
+	switch {
+	case r.LossPct != other.LossPct:
+		return r.LossPct > other.LossPct
+	case (r.Count == 0) != (other.Count == 0):
+		return r.Count == 0
+	}
+
+	return r.AvgMs > other.AvgMs
+}
+
+// WindowHistory keeps the last keep windows completed, oldest first, so that
+// it stays the same size however long the run goes on, and the worst window
+// of the run, kept or not.
+type windowHistory struct {
+	Keep    int
+	Records []WindowRecord
+	worst   *WindowRecord
+}
+
+func NewWindowHistory(keep int) *windowHistory {
+	return &windowHistory{Keep: keep, Records: make([]WindowRecord, 0, keep)}
+}
+
+func (h *windowHistory) Add(record WindowRecord) {
+	if len(h.Records) == h.Keep {
+		copy(h.Records, h.Records[1:])
+		h.Records = h.Records[:h.Keep-1]
+	}
+	h.Records = append(h.Records, record)
+	if h.worst == nil || record.Worse(*h.worst) {
+		h.worst = &record
+	}
+}
+
+// recordWindow keeps the window closing at now, with the loss over it.
+func (s *Stats) recordWindow(now time.Time, loss float64) {
+	if s.History == nil {
+		return
+	}
+
+	s.History.Add(WindowRecord{
+		Start:   Stored(s.WindowStart),
+		End:     Stored(now),
+		Count:   s.Window.Count,
+		MinMs:   Milliseconds(s.Window.Min),
+		AvgMs:   Milliseconds(s.Window.Average()),
+		MaxMs:   Milliseconds(s.Window.Max),
+		LossPct: loss * 100,
+		MinAt:   StoredAt(s.Window.MinAt),
+		MaxAt:   StoredAt(s.Window.MaxAt),
+	})
+}
+
+// WorstWindow is the worst window of the run, which may have been completed
+// too long ago to still be kept.
+func (s *Stats) WorstWindow() *WindowRecord {
+	if s.History == nil || s.History.worst == nil {
+		return nil
+	}
+
+	worst := *s.History.worst
+	return &worst
+}
+
+// Windows are the windows completed that are still kept, oldest first.
+func (s *Stats) Windows() []WindowRecord {
+	if s.History == nil {
+		return nil
+	}
+
+	return s.History.Records
+}
+
+func (s *Stats) PrintWindowRecord(record WindowRecord) string {
+	if record.Count == 0 {
+		return fmt.Sprintf("%s  %8s %8s %8s  %6.1f%%", s.Times.Clock(record.Start), "-", "-", "-", record.LossPct)
+	}
+
+	return fmt.Sprintf("%s  %8s %8s %8s  %6.1f%%", s.Times.Clock(record.Start), FormatMillis(record.MinMs), FormatMillis(record.AvgMs), FormatMillis(record.MaxMs), record.LossPct)
+}
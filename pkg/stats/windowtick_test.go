@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestWindowTicker replies for a window, then goes quiet with the
+// ticker still closing windows, checking the silent ones are kept on their
+// boundaries and shown as such, that sparse replies don't stretch a window
+// and that a pause holds one open for as long as it lasts.
+func TestWindowTicker(t *testing.T) {
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	s := New(time.Second, 5*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+	s.Loss = NewLossTracker(time.Second, 2*time.Second, 5*time.Second, time.Minute)
+	s.SlowWindow = NewTopN(3)
+	s.SlowTotals = NewTopN(3)
+	s.History = NewWindowHistory(10)
+
+	closed := 0
+	tick := func(seconds int) {
+		now = start.Add(time.Duration(seconds) * time.Second)
+		s.AdvanceLoss()
+		closed += len(s.CloseWindows(now))
+	}
+	for seq := 1; seq <= 5; seq++ {
+		now = start.Add(time.Duration(seq) * time.Second)
+		s.Observe(ping.Result{Seq: seq, Epoch: 1, Duration: 10 * time.Millisecond})
+		s.Update(10 * time.Millisecond)
+	}
+	for seconds := 6; seconds <= 20; seconds++ {
+		tick(seconds)
+	}
+	// Just past the end of the fourth window, which the ticker gets to late.
+	tick(21)
+
+	records := s.Windows()
+	if closed != 4 || len(records) != 4 {
+		t.Fatalf("windows close on the ticker with no replies to close them: expected 4 windows, got %d closed, %d kept", closed, len(records))
+	}
+	for i, record := range records {
+		from := start.Add(time.Duration(5*i) * time.Second)
+		count := 0
+		if i == 0 {
+			count = 5
+		}
+		if !record.Start.Equal(from) || !record.End.Equal(from.Add(5*time.Second)) || record.Count != count {
+			t.Fatalf("each window is kept on its boundaries, the silent ones with no replies: expected %s to %s with %d, got %s to %s with %d", from.Format(time.TimeOnly), from.Add(5*time.Second).Format(time.TimeOnly), count, record.Start.Format(time.TimeOnly), record.End.Format(time.TimeOnly), record.Count)
+		}
+	}
+	if last := records[3]; last.LossPct != 100 {
+		t.Fatalf("a silent window is kept as all lost: expected 100%% loss, got %.0f%% loss", last.LossPct)
+	}
+	if window := s.PrintWindows(theme.Theme{}); !strings.Contains(window, "Last 5 seconds   - no data, 100% loss") {
+		t.Fatalf("an empty window shows as no data rather than zeros: expected Last 5 seconds   - no data, 100%% loss, got %q", window)
+	}
+
+	if len(s.Recent) != 0 || s.Rolling.Total() != 0 || s.WindowPercentile(95) != 0 {
+		t.Fatalf("the rolling samples empty as the quiet windows close: expected none, got %d", len(s.Recent))
+	}
+	if len(s.windowP95s) != 1 || s.RunP95() != 10*time.Millisecond {
+		t.Fatalf("a silent window has no p95 towards the run's: expected 1 p95 of 10ms, got %v", s.windowP95s)
+	}
+
+	// A reply after the ticker missed a boundary still goes in the window
+	// by its time, the one before being closed first.
+	now = start.Add(26 * time.Second)
+	if len(s.Observe(ping.Result{Seq: 26, Epoch: 1, Duration: 20 * time.Millisecond})) != 1 || !s.WindowStart.Equal(start.Add(25*time.Second)) {
+		t.Fatalf("a reply closes the windows the ticker hasn't yet before it's counted: expected 1 closed, open from 03:00:25, got open from %s", s.WindowStart.Format(time.TimeOnly))
+	}
+	if len(s.LastSlow) != 0 || s.Windows()[len(s.Windows())-1].Count != 0 {
+		t.Fatalf("a late reply isn't counted in the window it closes: expected the window to 03:00:25 empty, got %d slowest", len(s.LastSlow))
+	}
+	if s.Update(20*time.Millisecond) || s.Window.Count != 1 || len(s.SlowWindow.Sorted()) != 1 {
+		t.Fatalf("a late reply joins the next window: expected a window from 03:00:25 with 1 reply and nothing more closed, got a window from %s with %d", s.WindowStart.Format(time.TimeOnly), s.Window.Count)
+	}
+
+	// Replies every seven seconds into five second windows used to have
+	// each close on the next reply, stretching them to fourteen.
+	for seq := 33; seq <= 61; seq += 7 {
+		now = start.Add(time.Duration(seq) * time.Second)
+		s.Update(10 * time.Millisecond)
+	}
+	for _, record := range s.Windows() {
+		if length := record.End.Sub(record.Start); length != 5*time.Second || record.Start.Sub(start)%(5*time.Second) != 0 {
+			t.Fatalf("sparse replies don't stretch a window: expected 5s windows on 5s boundaries, got %s from %s", length, record.Start.Format(time.TimeOnly))
+		}
+	}
+
+	// The window from 03:01:00 pauses for 10s of it, so runs to 03:01:15.
+	tick(62)
+	s.Pause("selftest", false)
+	tick(72)
+	if len(s.CloseWindows(now)) != 0 {
+		t.Fatalf("no window closes while paused: expected 0 closed, got some closed")
+	}
+	s.Resume("selftest")
+	tick(74)
+	if !s.WindowStart.Equal(start.Add(60 * time.Second)) {
+		t.Fatalf("time paused doesn't count towards a window: expected still open from 03:01:00, got closed at %q", s.WindowStart.Format(time.TimeOnly))
+	}
+	tick(76)
+	if !s.WindowStart.Equal(start.Add(75 * time.Second)) {
+		t.Fatalf("a window paused in closes that much later: expected closed at 03:01:15, got open from %q", s.WindowStart.Format(time.TimeOnly))
+	}
+
+	// After the machine sleeps, the windows missed are closed up to a point
+	// and the rest as one, still ending on a boundary.
+	before := closed
+	tick(76 + 1000*5)
+	if closed := closed - before; closed != MAX_WINDOWS_CLOSED || !s.WindowStart.Equal(start.Add(5075*time.Second)) {
+		t.Fatalf("a long gap closes at most MAX_WINDOWS_CLOSED windows, up to the last boundary: expected %d closed, open from 04:24:35, got %d closed, open from %s", MAX_WINDOWS_CLOSED, closed, s.WindowStart.Format(time.TimeOnly))
+	}
+}
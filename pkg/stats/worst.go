@@ -0,0 +1,183 @@
+package stats
+
+import (
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ifstat"
+)
+
+const (
+	DEFAULT_WORST_MINUTES = 5
+	// WORST_MINUTE_SPAN is how far either side of a record window its
+	// context reaches.
+	WORST_MINUTE_SPAN = time.Minute
+)
+
+// WorstMinute is the context around a window that set a record for the run,
+// for its loss or its p95: the samples from a span before it to a span
+// after, the incidents open and the interface as it was then. The events
+// are those logged over the same stretch, filled in when summarised.
+type WorstMinute struct {
+	Record        string         `json:"record"`
+	WindowStart   time.Time      `json:"window_start"`
+	WindowEnd     time.Time      `json:"window_end"`
+	LossPct       float64        `json:"loss_pct"`
+	P95Ms         float64        `json:"p95_ms"`
+	Interface     string         `json:"interface,omitempty"`
+	WifiQuality   *float64       `json:"wifi_link_quality,omitempty"`
+	WifiSignalDBm *float64       `json:"wifi_signal_dbm,omitempty"`
+	Incidents     []Incident     `json:"incidents,omitempty"`
+	Events        []Event        `json:"events,omitempty"`
+	Samples       []StatusSample `json:"samples"`
+	// Partial is set when the run ended before the span after the window
+	// was over.
+	Partial bool `json:"partial,omitempty"`
+
+	loss float64
+}
+
+// worse ranks by loss, then p95, since a window that lost probes was worse
+// than any that only slowed down.
+func (w *WorstMinute) worse(than *WorstMinute) bool {
+	if w.loss != than.loss {
+		return w.loss > than.loss
+	}
+
+	return w.P95Ms > than.P95Ms
+}
+
+// WorstMinutes keeps the context of the worst windows that set a record,
+// as many as keep, from the samples of the span before each, and gathers
+// the span after for those still within it.
+type worstMinutes struct {
+	keep   int
+	retain time.Duration
+	now    func() time.Time
+
+	recent    []StatusSample
+	minutes   []*WorstMinute
+	worstLoss float64
+	worstP95  time.Duration
+}
+
+func NewWorstMinutes(keep int, window time.Duration, now func() time.Time) *worstMinutes {
+	// A window runs on past its size until the sample that closes it, so
+	// twice its size is kept to be sure of the span before its start.
+	return &worstMinutes{keep: keep, retain: 2*window + WORST_MINUTE_SPAN, now: now}
+}
+
+func (w *worstMinutes) add(sample StatusSample) {
+	cutoff := sample.Time.Add(-w.retain)
+	evict := 0
+	for evict < len(w.recent) && w.recent[evict].Time.Before(cutoff) {
+		evict++
+	}
+	w.recent = append(w.recent[evict:], sample)
+
+	for _, minute := range w.minutes {
+		if minute.Partial && !sample.Time.After(minute.WindowEnd.Add(WORST_MINUTE_SPAN)) {
+			minute.Samples = append(minute.Samples, sample)
+		} else {
+			minute.Partial = false
+		}
+	}
+}
+
+func (w *worstMinutes) reply(seq int, rtt time.Duration) {
+	ms := float64(rtt.Microseconds()) / 1000
+	w.add(StatusSample{Time: Stored(w.now()), Seq: seq, RTTMs: &ms})
+}
+
+// Observe takes each probe's fate from the loss tracker, for the losses,
+// timed as they're settled.
+func (w *worstMinutes) Observe(seq int, lost bool) {
+	if lost {
+		w.add(StatusSample{Time: Stored(w.now()), Seq: seq, Lost: true})
+	}
+}
+
+// window captures a window just closed if it set a record, for loss only
+// once it lost any, keeping it if it's among the worst.
+func (w *worstMinutes) window(s *Stats, start time.Time, end time.Time, loss float64, p95 time.Duration) {
+	record := ""
+	if loss > w.worstLoss {
+		w.worstLoss = loss
+		record = "loss"
+	}
+	if p95 > w.worstP95 {
+		w.worstP95 = p95
+		if record == "" {
+			record = "p95"
+		} else {
+			record += " and p95"
+		}
+	}
+	if record == "" {
+		return
+	}
+
+	minute := &WorstMinute{
+		Record:      record,
+		WindowStart: Stored(start),
+		WindowEnd:   Stored(end),
+		LossPct:     loss * 100,
+		P95Ms:       Milliseconds(p95),
+		Interface:   s.Route,
+		Partial:     true,
+		loss:        loss,
+	}
+	from := minute.WindowStart.Add(-WORST_MINUTE_SPAN)
+	for _, sample := range w.recent {
+		if !sample.Time.Before(from) {
+			minute.Samples = append(minute.Samples, sample)
+		}
+	}
+	for _, incident := range s.Incidents {
+		if incident.Active() {
+			minute.Incidents = append(minute.Incidents, incident)
+		}
+	}
+	if s.Route != "" {
+		if wifi, err := ifstat.ReadWireless(s.Route); err == nil {
+			minute.WifiQuality, minute.WifiSignalDBm = &wifi.LinkQuality, &wifi.SignalDBm
+		}
+	}
+
+	at := len(w.minutes)
+	for at > 0 && minute.worse(w.minutes[at-1]) {
+		at--
+	}
+	if at < w.keep {
+		w.minutes = append(w.minutes[:at], append([]*WorstMinute{minute}, w.minutes[at:]...)...)
+		w.minutes = w.minutes[:min(len(w.minutes), w.keep)]
+	}
+}
+
+// reset forgets the minutes kept and the records, keeping the samples for the
+// next record's span before it.
+func (w *worstMinutes) reset() {
+	w.minutes = nil
+	w.worstLoss, w.worstP95 = 0, 0
+}
+
+// WorstMinuteSummaries lists the minutes kept, worst first, each with the
+// events logged over its stretch.
+func (s *Stats) WorstMinuteSummaries() []WorstMinute {
+	if s.Worst == nil {
+		return nil
+	}
+
+	var summaries []WorstMinute
+	for _, minute := range s.Worst.minutes {
+		summary := *minute
+		from, to := minute.WindowStart.Add(-WORST_MINUTE_SPAN), minute.WindowEnd.Add(WORST_MINUTE_SPAN)
+		for _, event := range s.Events {
+			if !event.Time.Before(from) && !event.Time.After(to) {
+				summary.Events = append(summary.Events, event)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// TestWorstMinutes checks a record window is captured with the
+// samples from a minute either side of it, losses among them, and that the
+// minutes kept are the worst by loss then p95, evicting the least bad.
+func TestWorstMinutes(t *testing.T) {
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	s := New(time.Second, 10*time.Second, DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart, s.Started = start, start
+	s.Worst = NewWorstMinutes(DEFAULT_WORST_MINUTES, s.WindowSize, s.Clock)
+	s.Loss.Observe(s.Worst.Observe)
+
+	for second := range 400 {
+		now = start.Add(time.Duration(second) * time.Second)
+		s.AdvanceLoss()
+		if second >= 150 && second < 153 {
+			continue
+		}
+		rtt := 20 * time.Millisecond
+		if second >= 100 && second < 110 {
+			rtt = 80 * time.Millisecond
+		}
+		s.Observe(ping.Result{Seq: second, Duration: rtt, Epoch: 1})
+		s.Update(rtt)
+	}
+
+	var slow *WorstMinute
+	for _, minute := range s.WorstMinuteSummaries() {
+		if minute.P95Ms == 80 {
+			slow = &minute
+		}
+	}
+	if slow == nil || slow.Record != "p95" || slow.Partial {
+		t.Fatalf("the slow window sets a p95 record and is captured in full: expected a p95 record of 80ms, got %+v", s.WorstMinuteSummaries())
+	}
+	from, to := slow.WindowStart.Add(-WORST_MINUTE_SPAN), slow.WindowEnd.Add(WORST_MINUTE_SPAN)
+	first, last := slow.Samples[0], slow.Samples[len(slow.Samples)-1]
+	if !first.Time.Equal(from) || !last.Time.Equal(to) {
+		t.Fatalf("the capture runs from a minute before the window to a minute after: expected %s to %s, got %s to %s", from, to, first.Time, last.Time)
+	}
+	lost := 0
+	for _, sample := range slow.Samples {
+		if sample.Lost {
+			lost++
+		}
+	}
+	if lost != 3 || len(slow.Samples) != int(to.Sub(from)/time.Second)+1 {
+		t.Fatalf("every probe of the stretch is captured, with the losses after the window as they're settled: expected %d samples, 3 lost, got %d samples, %d lost", int(to.Sub(from)/time.Second)+1, len(slow.Samples), lost)
+	}
+
+	// Windows fed by hand, as loss and p95, each followed by the records
+	// and p95s of the minutes kept.
+	w := NewWorstMinutes(3, 10*time.Second, s.Clock)
+	steps := []struct {
+		loss float64
+		p95  time.Duration
+		want string
+	}{
+		{0, 20, "p95 20"},
+		{0, 30, "p95 30, p95 20"},
+		{0.1, 25, "loss 25, p95 30, p95 20"},
+		{0.05, 40, "loss 25, p95 40, p95 30"},
+		{0.2, 10, "loss 10, loss 25, p95 40"},
+		{0.2, 40, "loss 10, loss 25, p95 40"},
+		{0, 41, "loss 10, loss 25, p95 40"},
+		{0.3, 50, "loss and p95 50, loss 10, loss 25"},
+	}
+	for _, step := range steps {
+		w.window(&s, now, now.Add(10*time.Second), step.loss, step.p95*time.Millisecond)
+		var got []string
+		for _, minute := range w.minutes {
+			got = append(got, fmt.Sprintf("%s %g", minute.Record, minute.P95Ms))
+		}
+		if strings.Join(got, ", ") != step.want {
+			t.Fatalf("after a window with %.0f%% loss and a %s p95, the worst records are kept, worst first: expected %q, got %q", step.loss*100, step.p95*time.Millisecond, step.want, strings.Join(got, ", "))
+		}
+	}
+}
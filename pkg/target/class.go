@@ -0,0 +1,61 @@
+package target
+
+import "net/netip"
+
+const (
+	LOOPBACK   = "loopback"
+	PRIVATE    = "private"
+	LINK_LOCAL = "link-local"
+	CGNAT      = "cgnat"
+	RESERVED   = "reserved"
+	GLOBAL     = "global"
+)
+
+var (
+	CGNAT_PREFIX = netip.MustParsePrefix("100.64.0.0/10")
+	// RESERVED_PREFIXES aren't routed on the internet, but aren't anyone's
+	// local network either. Some interception proxies hand out addresses
+	// from the benchmarking range.
+	RESERVED_PREFIXES = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("240.0.0.0/4"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+)
+
+// Classify says what kind of network an address belongs to, so that a run
+// that has quietly been measuring the local machine or LAN can say so.
+// IPv4-mapped IPv6 addresses are classified as IPv4.
+func Classify(addr netip.Addr) string {
+	addr = addr.Unmap()
+
+	switch {
+	case !addr.IsValid():
+		return RESERVED
+	case addr.IsLoopback():
+		return LOOPBACK
+	case addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast():
+		return LINK_LOCAL
+	case addr.IsPrivate():
+		return PRIVATE
+	case CGNAT_PREFIX.Contains(addr):
+		return CGNAT
+	}
+
+	for _, prefix := range RESERVED_PREFIXES {
+		if prefix.Contains(addr) {
+			return RESERVED
+		}
+	}
+
+	if !addr.IsGlobalUnicast() {
+		return RESERVED
+	}
+
+	return GLOBAL
+}
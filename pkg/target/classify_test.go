@@ -0,0 +1,52 @@
+package target
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// TestClassify classifies an address from each class, over both address
+// families, and an invalid one.
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		address string
+		class   string
+	}{
+		{"127.0.0.1", LOOPBACK},
+		{"127.255.0.9", LOOPBACK},
+		{"::1", LOOPBACK},
+		{"::ffff:127.0.0.1", LOOPBACK},
+		{"10.1.2.3", PRIVATE},
+		{"172.16.0.1", PRIVATE},
+		{"172.31.255.254", PRIVATE},
+		{"192.168.1.1", PRIVATE},
+		{"fd00::1", PRIVATE},
+		{"169.254.10.1", LINK_LOCAL},
+		{"fe80::1", LINK_LOCAL},
+		{"100.64.0.1", CGNAT},
+		{"100.127.255.254", CGNAT},
+		{"0.0.0.0", RESERVED},
+		{"::", RESERVED},
+		{"198.18.0.1", RESERVED},
+		{"192.0.2.1", RESERVED},
+		{"2001:db8::1", RESERVED},
+		{"224.0.0.1", LINK_LOCAL},
+		{"239.1.1.1", RESERVED},
+		{"255.255.255.255", RESERVED},
+		{"1.1.1.1", GLOBAL},
+		{"100.128.0.1", GLOBAL},
+		{"172.32.0.1", GLOBAL},
+		{"2606:4700::1111", GLOBAL},
+		{"::ffff:8.8.8.8", GLOBAL},
+	}
+
+	for _, c := range cases {
+		if class := Classify(netip.MustParseAddr(c.address)); class != c.class {
+			t.Fatalf("class of %s: expected %q, got %q", c.address, c.class, class)
+		}
+	}
+
+	if class := Classify(netip.Addr{}); class != RESERVED {
+		t.Fatalf("class of an invalid address: expected %q, got %q", RESERVED, class)
+	}
+}
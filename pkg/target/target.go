@@ -0,0 +1,192 @@
+package target
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	ICMP = "icmp"
+	TCP  = "tcp"
+	UDP  = "udp"
+	HTTP = "http"
+	DNS  = "dns"
+)
+
+var MODES = []string{ICMP, TCP, UDP, HTTP, DNS}
+
+type Target struct {
+	Mode string
+	Host string
+	Port int
+	URL  string
+}
+
+// Parse interprets a positional target argument, inferring the probe mode
+// from its shape: URLs probe over http, host:port over tcp, and anything
+// else is pinged. Link-local IPv6 addresses take a zone, as in fe80::1%eth0.
+func Parse(arg string) (Target, error) {
+	t, err := parse(arg)
+	if err != nil {
+		return t, err
+	}
+
+	return t, CheckZone(t.Host)
+}
+
+func parse(arg string) (Target, error) {
+	if arg == "" {
+		return Target{}, fmt.Errorf("empty target")
+	}
+
+	if strings.Contains(arg, "://") {
+		return parseURL(arg)
+	}
+
+	if addr, err := netip.ParseAddr(arg); err == nil {
+		return Target{Mode: ICMP, Host: addr.String()}, nil
+	}
+
+	if strings.HasPrefix(arg, "[") {
+		if strings.HasSuffix(arg, "]") {
+			return parseBracketed(strings.TrimSuffix(strings.TrimPrefix(arg, "["), "]"))
+		}
+
+		return parseHostPort(arg)
+	}
+
+	switch strings.Count(arg, ":") {
+	case 0:
+		return Target{Mode: ICMP, Host: arg}, nil
+	case 1:
+		return parseHostPort(arg)
+	default:
+		return Target{}, fmt.Errorf("ambiguous target %q: wrap IPv6 addresses in brackets to add a port, e.g. [::1]:443 or [fe80::1%%eth0]:443", arg)
+	}
+}
+
+func parseBracketed(inner string) (Target, error) {
+	addr, err := netip.ParseAddr(inner)
+	if err != nil || !addr.Is6() {
+		return Target{}, fmt.Errorf("invalid IPv6 address in brackets: %s", inner)
+	}
+
+	return Target{Mode: ICMP, Host: addr.String()}, nil
+}
+
+func parseHostPort(arg string) (Target, error) {
+	host, portText, err := net.SplitHostPort(arg)
+	if err != nil {
+		return Target{}, fmt.Errorf("failed to parse target %q: %s", arg, err)
+	}
+
+	if host == "" {
+		return Target{}, fmt.Errorf("missing host in target %q", arg)
+	}
+
+	port, err := parsePort(portText)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return Target{Mode: TCP, Host: host, Port: port}, nil
+}
+
+func parsePort(text string) (int, error) {
+	port, err := strconv.Atoi(text)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", text)
+	}
+
+	return port, nil
+}
+
+func parseURL(arg string) (Target, error) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return Target{}, fmt.Errorf("failed to parse url %q: %s", arg, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Target{}, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return Target{}, fmt.Errorf("missing host in url %q", arg)
+	}
+
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+
+	if u.Port() != "" {
+		port, err = parsePort(u.Port())
+		if err != nil {
+			return Target{}, err
+		}
+	}
+
+	return Target{Mode: HTTP, Host: u.Hostname(), Port: port, URL: u.String()}, nil
+}
+
+// WithMode applies an explicit --mode over whatever was inferred.
+func (t Target) WithMode(mode string) (Target, error) {
+	if mode == "" || mode == t.Mode {
+		return t, nil
+	}
+
+	switch mode {
+	case ICMP:
+		t.Port = 0
+		t.URL = ""
+	case TCP:
+		if t.Port == 0 {
+			return t, fmt.Errorf("tcp mode needs a port, e.g. %s", net.JoinHostPort(t.Host, "443"))
+		}
+		t.URL = ""
+	case UDP:
+		if t.Port == 0 {
+			return t, fmt.Errorf("udp mode needs the port network-test reflect listens on, e.g. --port 9999")
+		}
+		t.URL = ""
+	case DNS:
+		t.Port = 0
+		t.URL = ""
+	case HTTP:
+		if t.URL == "" {
+			u := url.URL{Scheme: "http", Host: t.Host, Path: "/"}
+			if t.Port != 0 {
+				u.Host = net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+			}
+			if t.Port == 443 {
+				u.Scheme = "https"
+			}
+			t.URL = u.String()
+		}
+	default:
+		return t, fmt.Errorf("unknown mode %q, expected one of: %s", mode, strings.Join(MODES, ", "))
+	}
+
+	t.Mode = mode
+	return t, nil
+}
+
+func (t Target) String() string {
+	switch t.Mode {
+	case TCP:
+		return "tcp " + net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	case UDP:
+		return "udp " + net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	case HTTP:
+		return "http " + t.URL
+	case DNS:
+		return "dns " + t.Host
+	default:
+		return "icmp " + t.Host
+	}
+}
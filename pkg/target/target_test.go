@@ -0,0 +1,40 @@
+package target
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestZones parses zoned and unzoned IPv6 targets in each form they're
+// given in, and refuses link-local ones without a zone.
+func TestZones(t *testing.T) {
+	cases := []struct {
+		arg    string
+		target Target
+	}{
+		{"fe80::1%eth0", Target{Mode: ICMP, Host: "fe80::1%eth0"}},
+		{"[fe80::1%eth0]", Target{Mode: ICMP, Host: "fe80::1%eth0"}},
+		{"[fe80::1%eth0]:443", Target{Mode: TCP, Host: "fe80::1%eth0", Port: 443}},
+		{"http://[fe80::1%25eth0]:8080/", Target{Mode: HTTP, Host: "fe80::1%eth0", Port: 8080, URL: "http://[fe80::1%25eth0]:8080/"}},
+		{"ff02::1%2", Target{Mode: ICMP, Host: "ff02::1%2"}},
+		{"2606:4700::1111", Target{Mode: ICMP, Host: "2606:4700::1111"}},
+		{"[::1]:22", Target{Mode: TCP, Host: "::1", Port: 22}},
+	}
+	for _, c := range cases {
+		if parsed, err := Parse(c.arg); err != nil || parsed != c.target {
+			t.Fatalf("target %s: expected %+v, got %+v, %v", c.arg, c.target, parsed, err)
+		}
+	}
+
+	for _, arg := range []string{"fe80::1", "[fe80::1]:443", "http://[fe80::1]/", "ff02::1"} {
+		if _, err := Parse(arg); err == nil || !strings.Contains(err.Error(), "needs a zone") {
+			t.Fatalf("link-local %s without a zone: expected refused for want of a zone, got %v", arg, err)
+		}
+	}
+	if err := CheckZone("fe80::1"); err == nil {
+		t.Fatalf("--host fe80::1 without a zone: expected refused, got accepted")
+	}
+	if zone := Zone("fe80::1%eth0"); zone != "eth0" {
+		t.Fatalf("zone of fe80::1%%eth0: expected eth0, got %q", zone)
+	}
+}
@@ -0,0 +1,33 @@
+package target
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Zone is the interface a scoped IPv6 address is reached through, such as
+// eth0 for fe80::1%eth0, and empty for any other host.
+func Zone(host string) string {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+
+	return addr.Zone()
+}
+
+// CheckZone refuses link-local IPv6 addresses without a zone, since the same
+// address can be on every interface and which one to probe through has to be
+// given.
+func CheckZone(host string) error {
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !addr.Is6() || addr.Zone() != "" {
+		return nil
+	}
+
+	if addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() {
+		return fmt.Errorf("link-local address %s needs a zone naming the interface to reach it through, such as %s%%eth0", host, host)
+	}
+
+	return nil
+}
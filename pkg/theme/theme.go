@@ -0,0 +1,76 @@
+package theme
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+type Theme struct {
+	Name   string
+	Header lipgloss.Style
+	Good   lipgloss.Style
+	Warn   lipgloss.Style
+	Bad    lipgloss.Style
+	Alert  lipgloss.Style
+	Bar    lipgloss.Style
+	Muted  lipgloss.Style
+}
+
+var themes = map[string]Theme{
+	"default": {
+		Name:   "default",
+		Header: lipgloss.NewStyle().Bold(true),
+		Good:   lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+		Warn:   lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		Bad:    lipgloss.NewStyle().Foreground(lipgloss.Color("1")),
+		Alert:  lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("1")),
+		Bar:    lipgloss.NewStyle().Foreground(lipgloss.Color("4")),
+		Muted:  lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+	},
+	"colourblind": {
+		Name:   "colourblind",
+		Header: lipgloss.NewStyle().Bold(true),
+		Good:   lipgloss.NewStyle().Foreground(lipgloss.Color("#0072B2")),
+		Warn:   lipgloss.NewStyle().Foreground(lipgloss.Color("#F0E442")),
+		Bad:    lipgloss.NewStyle().Foreground(lipgloss.Color("#E69F00")),
+		Alert:  lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#D55E00")),
+		Bar:    lipgloss.NewStyle().Foreground(lipgloss.Color("#56B4E9")),
+		Muted:  lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+	},
+	"mono": {
+		Name:   "mono",
+		Header: lipgloss.NewStyle().Bold(true),
+		Good:   lipgloss.NewStyle(),
+		Warn:   lipgloss.NewStyle().Underline(true),
+		Bad:    lipgloss.NewStyle().Bold(true),
+		Alert:  lipgloss.NewStyle().Bold(true).Underline(true),
+		Bar:    lipgloss.NewStyle(),
+		Muted:  lipgloss.NewStyle().Faint(true),
+	},
+}
+
+func Names() []string {
+	var names []string
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func Get(name string) (Theme, error) {
+	theme, ok := themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q, expected one of: %s", name, strings.Join(Names(), ", "))
+	}
+
+	return theme, nil
+}
+
+func Default() Theme {
+	return themes["default"]
+}
@@ -0,0 +1,76 @@
+package theme
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// SGR picks out the styling escape sequences, whose parameters say what
+// each turns on.
+var SGR = regexp.MustCompile(`\x1b\[([0-9;]*)m`)
+
+// styling splits the parameters of the escape sequences in text into the
+// colours, foreground or background of any palette, and the rest.
+func styling(text string) ([]string, []string) {
+	var colours, attributes []string
+	for _, match := range SGR.FindAllStringSubmatch(text, -1) {
+		for _, param := range strings.Split(match[1], ";") {
+			if len(param) == 2 && strings.ContainsRune("3489", rune(param[0])) || len(param) == 3 && strings.HasPrefix(param, "10") {
+				colours = append(colours, param)
+			} else {
+				attributes = append(attributes, param)
+			}
+		}
+	}
+
+	return colours, attributes
+}
+
+// TestThemes renders a line in every style of each theme on a terminal
+// that takes any colour, checking the mono theme uses none, only bold and
+// underline, and that the others do colour it.
+func TestThemes(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	defer lipgloss.SetColorProfile(profile)
+
+	if names := Names(); !slices.Equal(names, []string{"colourblind", "default", "mono"}) {
+		t.Fatalf("the built in themes are listed in order: expected [colourblind default mono], got %v", names)
+	}
+
+	for _, name := range Names() {
+		theme, err := Get(name)
+		if err != nil {
+			t.Fatalf("%s: expected the theme, got %v", name, err)
+		}
+
+		var sample []string
+		for _, style := range []lipgloss.Style{theme.Header, theme.Good, theme.Warn, theme.Bad, theme.Alert, theme.Bar, theme.Muted} {
+			sample = append(sample, style.Render("12.3ms"))
+		}
+		rendered := strings.Join(sample, " ")
+
+		found, attributes := styling(rendered)
+		if name == "mono" {
+			if len(found) > 0 {
+				t.Fatalf("mono emits no colour: expected no colour escapes, got %v in %q", found, rendered)
+			}
+			if !slices.Contains(attributes, "1") || !slices.Contains(attributes, "4") {
+				t.Fatalf("mono stands levels apart with bold and underline: expected both, got %q", rendered)
+			}
+			continue
+		}
+		if len(found) == 0 {
+			t.Fatalf("%s is coloured: expected colour escapes, got %q", name, rendered)
+		}
+	}
+
+	if _, err := Get("dark"); err == nil || err.Error() != `unknown theme "dark", expected one of: colourblind, default, mono` {
+		t.Fatalf("an unknown theme lists those there are: expected an error, got %v", err)
+	}
+}
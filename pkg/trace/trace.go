@@ -0,0 +1,123 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// MAX_HOPS is as far as a trace goes before giving up on reaching the host.
+const MAX_HOPS = 30
+
+// HOP_LINE is a line of traceroute, tracepath or tracert output for one TTL,
+// which all begin with it, tracepath following it with a colon or a "?:".
+var HOP_LINE = regexp.MustCompile(`^\s*(\d+)\??:?\s+(.*)$`)
+
+// Hop is a TTL on the way to the host and the router that answered probes
+// expiring there, with no address when none did.
+type Hop struct {
+	TTL     int
+	Address string
+}
+
+func (h Hop) String() string {
+	if h.Address == "" {
+		return "*"
+	}
+
+	return h.Address
+}
+
+// Run traces the route to host with whichever of traceroute and tracepath is
+// installed, or tracert on Windows, in the family given when it isn't empty.
+// It is a variable so that callers can substitute a fake.
+var Run = func(ctx context.Context, host string, family string) ([]Hop, error) {
+	name, args, err := command(host, family)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %s", name, err)
+	}
+
+	hops := Parse(string(out))
+	if len(hops) == 0 {
+		return nil, fmt.Errorf("unexpected %s output: %s", name, strings.TrimSpace(string(out)))
+	}
+
+	return hops, nil
+}
+
+func command(host string, family string) (string, []string, error) {
+	var familyArgs []string
+	switch family {
+	case "ipv4":
+		familyArgs = []string{"-4"}
+	case "ipv6":
+		familyArgs = []string{"-6"}
+	}
+
+	if runtime.GOOS == "windows" {
+		return "tracert", append(familyArgs, "-d", "-h", strconv.Itoa(MAX_HOPS), "-w", "2000", host), nil
+	}
+	if _, err := exec.LookPath("traceroute"); err == nil {
+		return "traceroute", append(familyArgs, "-n", "-q", "1", "-w", "2", "-m", strconv.Itoa(MAX_HOPS), host), nil
+	}
+	if _, err := exec.LookPath("tracepath"); err == nil {
+		return "tracepath", append(familyArgs, "-n", "-m", strconv.Itoa(MAX_HOPS), host), nil
+	}
+
+	return "", nil, fmt.Errorf("neither traceroute nor tracepath is installed")
+}
+
+// Parse reads the hops from traceroute, tracepath or tracert output, taking
+// the first address given for each TTL. tracepath repeats a TTL when it
+// finds the path MTU, and its local hop has no address, so a TTL is only
+// left without one when no line for it had any.
+func Parse(output string) []Hop {
+	var hops []Hop
+	for _, line := range strings.Split(output, "\n") {
+		matches := HOP_LINE.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if matches == nil {
+			continue
+		}
+		ttl, err := strconv.Atoi(matches[1])
+		if err != nil || ttl < 1 || ttl > MAX_HOPS {
+			continue
+		}
+
+		address := ""
+		for _, field := range strings.Fields(matches[2]) {
+			if addr, err := netip.ParseAddr(strings.Trim(field, "()[]")); err == nil {
+				address = addr.String()
+				break
+			}
+		}
+
+		switch last := len(hops) - 1; {
+		case last >= 0 && hops[last].TTL == ttl:
+			if hops[last].Address == "" {
+				hops[last].Address = address
+			}
+		case last < 0 || ttl > hops[last].TTL:
+			// A TTL skipped had no line at all, so nothing answered it either.
+			next := 1
+			if last >= 0 {
+				next = hops[last].TTL + 1
+			}
+			for ; next < ttl; next++ {
+				hops = append(hops, Hop{TTL: next})
+			}
+			hops = append(hops, Hop{TTL: ttl, Address: address})
+		}
+	}
+
+	return hops
+}
@@ -0,0 +1,11 @@
+package tui
+
+import (
+	"time"
+)
+
+const (
+	AGGREGATE_MAX_DOCUMENT = 1 << 20
+	AGGREGATE_TIMEOUT      = 5 * time.Second
+	AGGREGATE_SITE_LABEL   = "site"
+)
@@ -0,0 +1,185 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	ALERT_OK   = "ok"
+	ALERT_WARN = "warn"
+	ALERT_CRIT = "crit"
+
+	// ALERT_QUEUE is how many runs of --alert-cmd may wait on the one before,
+	// past which an alert is dropped rather than holding up the display.
+	ALERT_QUEUE = 8
+	// ALERT_CMD_TIMEOUT is how long --alert-cmd is given before it's killed.
+	ALERT_CMD_TIMEOUT = 30 * time.Second
+)
+
+// alertHook pokes whoever is running this, with the terminal bell, a
+// command or both, as each window moves between ok, warn and crit by
+// --warn, --crit and --max-loss. It only goes off when the state changes, and
+// the command is run from a goroutine of its own, so that a slow one never
+// holds up probing or the display.
+type alertHook struct {
+	command string
+	bell    bool
+	out     io.Writer
+	levels  stats.Levels
+	maxLoss float64
+
+	state string
+	runs  chan []string
+
+	mu      sync.Mutex
+	lastErr error
+	dropped int
+}
+
+func newAlertHook(command string, bell bool, l stats.Levels, maxLoss float64) *alertHook {
+	return &alertHook{command: command, bell: bell, out: os.Stderr, levels: l, maxLoss: maxLoss, state: ALERT_OK, runs: make(chan []string, ALERT_QUEUE)}
+}
+
+// assess is the state a window's figures put the run in, and why. A window
+// with no replies is crit, as the worst there is.
+func (a *alertHook) assess(count int, avg time.Duration, loss float64) (string, string) {
+	switch {
+	case count == 0:
+		return ALERT_CRIT, "no replies over the window"
+	case stats.Over(loss, a.maxLoss):
+		return ALERT_CRIT, fmt.Sprintf("loss %.1f%% over the --max-loss of %.1f%%", loss*100, a.maxLoss*100)
+	case stats.Over(avg, a.levels.Crit):
+		return ALERT_CRIT, fmt.Sprintf("average %s over the --crit of %s", stats.FormatLatency(avg), stats.FormatLatency(a.levels.Crit))
+	case stats.Over(avg, a.levels.Warn):
+		return ALERT_WARN, fmt.Sprintf("average %s over the --warn of %s", stats.FormatLatency(avg), stats.FormatLatency(a.levels.Warn))
+	}
+
+	return ALERT_OK, fmt.Sprintf("average %s, loss %.1f%%", stats.FormatLatency(avg), loss*100)
+}
+
+// alertWindow checks the window just closed.
+func (m *Model) alertWindow(closed stats.ClosedWindow) {
+	if m.alerts == nil {
+		return
+	}
+
+	w := &closed.Window
+	loss, _, _ := m.Stats.Loss.Rolling(closed.End)
+	state, reason := m.alerts.assess(w.Count, w.Average(), loss)
+	m.alert(state, reason, w.Average(), loss)
+}
+
+// alertSilence goes crit once twice a window has passed without one closing,
+// as following a run, where windows only close on the replies. Elsewhere the
+// ticker closes an empty window, which alertWindow judges.
+func (m *Model) alertSilence(now time.Time) {
+	if m.alerts == nil || m.Stats.Paused != nil || m.alerts.state == ALERT_CRIT {
+		return
+	}
+
+	if silent := now.Sub(m.Stats.WindowStart); silent > 2*m.Stats.WindowSize {
+		loss, _, _ := m.Stats.Loss.Rolling(now)
+		m.alert(ALERT_CRIT, fmt.Sprintf("no replies for %s", silent.Round(time.Second)), 0, loss)
+	}
+}
+
+// alert moves to state, going off if it's a change, and logs any command
+// that failed since the last.
+func (m *Model) alert(state string, reason string, avg time.Duration, loss float64) {
+	a := m.alerts
+	dropped, err := a.taken()
+	if err != nil {
+		m.Stats.AddEvent("alert", fmt.Sprintf("--alert-cmd failed: %s", err))
+	}
+	if dropped > 0 {
+		m.Stats.AddEvent("alert", fmt.Sprintf("%d alerts dropped waiting on --alert-cmd", dropped))
+	}
+	if state == a.state {
+		return
+	}
+
+	previous := a.state
+	a.state = state
+	m.Stats.AddEvent("alert", fmt.Sprintf("%s to %s: %s", previous, state, reason))
+
+	if a.bell {
+		fmt.Fprint(a.out, "\a")
+	}
+	if a.command == "" {
+		return
+	}
+
+	env := []string{
+		"NT_HOST=" + m.Host,
+		"NT_RUN_ID=" + m.Stats.RunID,
+		"NT_STATE=" + state,
+		"NT_PREVIOUS_STATE=" + previous,
+		"NT_REASON=" + reason,
+		"NT_AVG_MS=" + strconv.FormatFloat(stats.Milliseconds(avg), 'f', 1, 64),
+		"NT_LOSS_PCT=" + strconv.FormatFloat(loss*100, 'f', 1, 64),
+	}
+	select {
+	case a.runs <- env:
+	default:
+		a.mu.Lock()
+		a.dropped++
+		a.mu.Unlock()
+	}
+}
+
+// taken is how many alerts were dropped, and the last command error, since
+// they were last taken.
+func (a *alertHook) taken() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dropped, err := a.dropped, a.lastErr
+	a.dropped, a.lastErr = 0, nil
+	return dropped, err
+}
+
+// Run runs the command for each alert in turn until ctx is done.
+func (a *alertHook) Run(ctx context.Context) {
+	for {
+		select {
+		case env := <-a.runs:
+			if err := a.run(ctx, env); err != nil {
+				a.mu.Lock()
+				a.lastErr = err
+				a.mu.Unlock()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *alertHook) run(ctx context.Context, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, ALERT_CMD_TIMEOUT)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", a.command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", a.command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); lines[len(lines)-1] != "" {
+			return fmt.Errorf("%s: %s", err, lines[len(lines)-1])
+		}
+		return err
+	}
+
+	return nil
+}
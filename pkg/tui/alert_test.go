@@ -0,0 +1,88 @@
+package tui
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+func TestAlertHook(t *testing.T) {
+	alerts := newAlertHook("", true, stats.Levels{Warn: 80 * time.Millisecond, Crit: 200 * time.Millisecond}, 0.02)
+	for _, c := range []struct {
+		count    int
+		avg      time.Duration
+		loss     float64
+		expected string
+	}{
+		{10, 80 * time.Millisecond, 0.02, ALERT_OK},
+		{10, 81 * time.Millisecond, 0, ALERT_WARN},
+		{10, 201 * time.Millisecond, 0, ALERT_CRIT},
+		{10, 12 * time.Millisecond, 0.03, ALERT_CRIT},
+		{0, 0, 1, ALERT_CRIT},
+	} {
+		if state, reason := alerts.assess(c.count, c.avg, c.loss); state != c.expected {
+			t.Fatalf("a window is judged by the same thresholds as the colours and exit code: expected %s for %d replies averaging %s with %.0f%% loss, got %q: %q", c.expected, c.count, c.avg, c.loss*100, state, reason)
+		}
+	}
+
+	var bells strings.Builder
+	alerts.out = &bells
+	alerts.command = "selftest"
+	m := Model{Host: "example.com", Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS), alerts: alerts}
+	for _, state := range []string{ALERT_WARN, ALERT_WARN, ALERT_WARN, ALERT_OK, ALERT_OK} {
+		m.alert(state, "selftest", 90*time.Millisecond, 0.015)
+	}
+	if bells.String() != "\a\a" || len(alerts.runs) != 2 {
+		t.Fatalf("an alert only goes off on a change of state, into the bad one and out of it: expected 2 bells and 2 commands, got %d bells and %d commands", len(bells.String()), len(alerts.runs))
+	}
+	env := <-alerts.runs
+	for _, expected := range []string{"NT_HOST=example.com", "NT_STATE=warn", "NT_PREVIOUS_STATE=ok", "NT_AVG_MS=90.0", "NT_LOSS_PCT=1.5"} {
+		if !slices.Contains(env, expected) {
+			t.Fatalf("the command is told what changed: expected %q, got %q", expected, strings.Join(env, " "))
+		}
+	}
+
+	// A command still running holds up the ones after it rather than the
+	// display, and past the queue they're dropped and counted.
+	for i := range ALERT_QUEUE + 2 {
+		state := ALERT_WARN
+		if i%2 == 0 {
+			state = ALERT_CRIT
+		}
+		m.alert(state, "selftest", 0, 0)
+	}
+	m.alert(alerts.state, "selftest", 0, 0)
+	dropped := 0
+	for _, event := range m.Stats.Events {
+		if strings.HasSuffix(event.Message, "alerts dropped waiting on --alert-cmd") {
+			dropped++
+		}
+	}
+	if len(alerts.runs) != ALERT_QUEUE || dropped != 3 {
+		t.Fatalf("alerts past the queue are dropped without blocking, and logged: expected %d queued and 3 logged as dropped, got %d queued and %d logged", ALERT_QUEUE, len(alerts.runs), dropped)
+	}
+
+	m.Stats.WindowStart = time.Now().Add(-11 * time.Second)
+	alerts.state = ALERT_OK
+	m.alertSilence(time.Now())
+	if alerts.state != ALERT_CRIT {
+		t.Fatalf("no reply for two windows goes crit without a window closing: expected %q, got %q", ALERT_CRIT, alerts.state)
+	}
+
+	if _, err := exec.LookPath("sh"); err != nil || runtime.GOOS == "windows" {
+		return
+	}
+	alerts.command = `test "$NT_STATE" = crit || { echo "state was $NT_STATE"; exit 3; }`
+	if err := alerts.run(context.Background(), []string{"NT_STATE=crit"}); err != nil {
+		t.Fatalf("the command runs with the alert's environment: expected no error, got %v", err)
+	}
+	if err := alerts.run(context.Background(), []string{"NT_STATE=ok"}); err == nil || !strings.Contains(err.Error(), "state was ok") {
+		t.Fatalf("a failing command says why: expected exit status 3: state was ok, got %v", err)
+	}
+}
@@ -0,0 +1,464 @@
+package tui
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/control"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	// SUBSCRIBE_COMMAND asks the control socket for the run as a stream: a
+	// snapshot, then status frames as they happen.
+	SUBSCRIBE_COMMAND = "subscribe"
+
+	ATTACH_RETRY     = time.Second
+	ATTACH_RETRY_MAX = 30 * time.Second
+)
+
+// FOLLOW_CONTROLS are the actions that change the run, which a follower
+// only passes on to the instance with --allow-control.
+var FOLLOW_CONTROLS = []string{"ack", "mark-change", "pause"}
+
+// attachSnapshot is what a follower needs to rebuild the run: how it's
+// probing, along with its state and what the state file leaves out.
+type attachSnapshot struct {
+	Mode           string           `json:"mode"`
+	Host           string           `json:"host"`
+	Port           int              `json:"port,omitempty"`
+	URL            string           `json:"url,omitempty"`
+	IntervalS      float64          `json:"interval_s"`
+	Sparkline      string           `json:"sparkline,omitempty"`
+	OutageAfter    int              `json:"outage_after,omitempty"`
+	CallCodec      string           `json:"call_codec,omitempty"`
+	JitterBufferMs float64          `json:"jitter_buffer_ms,omitempty"`
+	Loss           stats.LossTotals `json:"loss"`
+	// LastSeq is of the last reply, for the follower to count the probes
+	// lost after it from, under the prober's epoch.
+	LastSeq *int           `json:"last_seq,omitempty"`
+	Epoch   int            `json:"epoch,omitempty"`
+	Outages []stats.Outage `json:"outages,omitempty"`
+	State   stats.RunState `json:"state"`
+}
+
+func (m *Model) attachSnapshot() attachSnapshot {
+	state := stats.NewRunState(&m.Stats)
+	state.WindowS = int(m.Stats.WindowSize.Seconds())
+
+	snapshot := attachSnapshot{
+		Mode:      m.Target.Mode,
+		Host:      m.Target.Host,
+		Port:      m.Target.Port,
+		URL:       m.Target.URL,
+		IntervalS: m.interval.Seconds(),
+		Loss:      m.Stats.Loss.Totals(),
+		State:     state,
+	}
+	if m.received {
+		snapshot.LastSeq = &m.last.Seq
+		snapshot.Epoch = m.last.Epoch
+	}
+	if m.Stats.Spark != nil {
+		snapshot.Sparkline = m.Stats.Spark.Mode
+	}
+	if m.Stats.Outages != nil {
+		snapshot.OutageAfter = m.Stats.Outages.Threshold()
+		snapshot.Outages = m.Stats.Outages.Outages()
+	}
+	if m.Stats.Call != nil {
+		snapshot.CallCodec = m.Stats.Call.Codec().Name
+		snapshot.JitterBufferMs = float64(m.Stats.Call.Buffer().Microseconds()) / 1000
+	}
+
+	return snapshot
+}
+
+// attachHub streams the run to each follower attached over the control
+// socket, through a strict status feed of its own, so that one falling
+// behind is cut off to start over from a fresh snapshot rather than miss
+// frames.
+type attachHub struct {
+	feeds []*statusFeed
+}
+
+func (m *Model) subscribe(command control.Command) {
+	conn := command.Stream()
+	if m.attached == nil {
+		m.attached = &attachHub{}
+		m.Stats.Loss.Observe(m.attached.observe)
+	}
+
+	f := newStatusFeed(func() (io.WriteCloser, error) { return conn, nil })
+	f.strict = true
+	f.send("snapshot", m.attachSnapshot())
+	f.published, f.marked = len(m.Stats.Events), len(m.Stats.Marks)
+	m.attached.feeds = append(m.attached.feeds, f)
+}
+
+func (h *attachHub) observe(seq int, lost bool) {
+	for _, f := range h.feeds {
+		f.observe(seq, lost)
+	}
+}
+
+// publish sends each follower what's happened since the last call, with
+// the incidents again whenever there were events, since every change to
+// one logs an event.
+func (h *attachHub) publish(s *stats.Stats, result *ping.Result) {
+	if h == nil {
+		return
+	}
+
+	feeds := h.feeds[:0]
+	for _, f := range h.feeds {
+		if f.broken.Load() {
+			f.Close()
+			continue
+		}
+
+		published := f.published
+		f.publish(s, result)
+		if f.published != published {
+			f.send("incidents", s.Incidents)
+		}
+		feeds = append(feeds, f)
+	}
+	h.feeds = feeds
+}
+
+func (h *attachHub) Close() {
+	if h == nil {
+		return
+	}
+
+	for _, f := range h.feeds {
+		f.Close()
+	}
+	h.feeds = nil
+}
+
+type followSnapshot attachSnapshot
+
+type followEvent stats.Event
+
+type followIncidents []stats.Incident
+
+type followPause stats.PauseMark
+
+type followLost struct {
+	err   error
+	retry time.Duration
+}
+
+type followReply string
+
+// Follower takes the run from the control socket in a goroutine of its own,
+// handing it to the display as messages: a snapshot, then the replies,
+// pauses and events as they happen, and a fresh snapshot on reconnecting.
+type Follower struct {
+	socket       string
+	allowControl bool
+	times        string
+	retry        time.Duration
+	msgs         chan tea.Msg
+
+	connected bool
+	since     time.Time
+	lost      error
+	retrying  time.Duration
+	notice    string
+}
+
+func NewFollower(socket string, allowControl bool, times string) *Follower {
+	return &Follower{socket: socket, allowControl: allowControl, times: times, retry: ATTACH_RETRY, msgs: make(chan tea.Msg, STATUS_BUFFER)}
+}
+
+func (f *Follower) next(ctx context.Context) tea.Msg {
+	select {
+	case msg := <-f.msgs:
+		return msg
+	case <-ctx.Done():
+		return tea.Quit
+	}
+}
+
+func (f *Follower) send(ctx context.Context, msg tea.Msg) bool {
+	select {
+	case f.msgs <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run streams until ctx is done, reconnecting each time the stream ends and
+// backing off while the instance can't be reached.
+func (f *Follower) Run(ctx context.Context) {
+	retry := f.retry
+	for {
+		attached, err := f.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if attached {
+			retry = f.retry
+		}
+		if !f.send(ctx, followLost{err: err, retry: retry}) {
+			return
+		}
+
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return
+		}
+		retry = min(2*retry, ATTACH_RETRY_MAX)
+	}
+}
+
+// stream reads frames until the connection ends, reporting whether it got
+// as far as a snapshot.
+func (f *Follower) stream(ctx context.Context) (bool, error) {
+	conn, err := control.Subscribe(f.socket, SUBSCRIBE_COMMAND)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	attached := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return attached, fmt.Errorf("the instance closed the connection")
+		}
+		if err != nil {
+			return attached, fmt.Errorf("failed to read from control socket: %s", err)
+		}
+
+		msg, err := decodeFollow(line)
+		if err != nil {
+			return attached, err
+		}
+		if _, ok := msg.(followSnapshot); ok {
+			attached = true
+		}
+		if msg != nil && !f.send(ctx, msg) {
+			return attached, ctx.Err()
+		}
+	}
+}
+
+// decodeFollow turns a frame into the message for it, or nil for one a
+// follower has no use for. Lost probes are left to be found again from the
+// gaps, as the instance found them.
+func decodeFollow(line []byte) (tea.Msg, error) {
+	var frame struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(line, &frame); err != nil {
+		return nil, fmt.Errorf("the instance didn't stream its run, but replied: %s", strings.TrimSpace(string(line)))
+	}
+
+	var msg tea.Msg
+	var err error
+	switch frame.Type {
+	case "snapshot":
+		var snapshot followSnapshot
+		err = json.Unmarshal(frame.Data, &snapshot)
+		msg = snapshot
+	case "sample":
+		var sample stats.StatusSample
+		err = json.Unmarshal(frame.Data, &sample)
+		if !sample.Lost && sample.RTTMs != nil {
+			msg = ping.Result{Seq: sample.Seq, Duration: time.Duration(*sample.RTTMs * float64(time.Millisecond)), TTL: sample.TTL, Epoch: sample.Epoch, At: sample.Time}
+		}
+	case "pause":
+		var mark followPause
+		err = json.Unmarshal(frame.Data, &mark)
+		msg = mark
+	case "event":
+		var event followEvent
+		err = json.Unmarshal(frame.Data, &event)
+		msg = event
+	case "incidents":
+		var incidents followIncidents
+		err = json.Unmarshal(frame.Data, &incidents)
+		msg = incidents
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s frame: %s", frame.Type, err)
+	}
+
+	return msg, nil
+}
+
+// NewFollowModel waits for the first snapshot, so that an instance that
+// can't be reached to begin with is an error rather than a retry.
+func NewFollowModel(ctx context.Context, f *Follower, t theme.Theme, keys KeyMap) (Model, error) {
+	switch msg := f.next(ctx).(type) {
+	case followSnapshot:
+		m := Model{ctx: ctx, theme: t, tabs: newTabSet(false), keys: keys, follow: f}
+		return m, m.applyFollow(msg)
+	case followLost:
+		return Model{}, msg.err
+	}
+
+	return Model{}, ctx.Err()
+}
+
+// applyFollow takes what the follower streamed in.
+func (m *Model) applyFollow(msg tea.Msg) error {
+	f := m.follow
+	switch msg := msg.(type) {
+	case followSnapshot:
+		if err := m.followRun(attachSnapshot(msg)); err != nil {
+			return err
+		}
+		f.connected, f.since, f.lost = true, time.Now(), nil
+	case followEvent:
+		m.Stats.Events = append(m.Stats.Events, stats.Event(msg))
+	case followIncidents:
+		m.Stats.Incidents = msg
+	case followPause:
+		switch msg.Event {
+		case stats.PAUSE_START:
+			m.Stats.Pause(msg.Reason, false)
+		case stats.PAUSE_END:
+			m.Stats.Resume(msg.Reason)
+		}
+	case followLost:
+		f.connected, f.lost, f.retrying = false, msg.err, msg.retry
+	case followReply:
+		f.notice = string(msg)
+	}
+
+	return nil
+}
+
+// followRun rebuilds the run from a snapshot, each time one comes in, so
+// that whatever was missed while cut off, or an instance restarted with a
+// new run, is taken up whole.
+func (m *Model) followRun(snapshot attachSnapshot) error {
+	state := snapshot.State
+	times, err := stats.NewTimeFormat(m.follow.times, state.Started, time.Local)
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(snapshot.IntervalS * float64(time.Second))
+	s := stats.New(interval, time.Duration(state.WindowS)*time.Second, state.Histogram.Bounds())
+	s.Follower = true
+	s.Times = times
+	s.Started = state.Started
+	// Taken before there are observers, who'd otherwise count it again.
+	if snapshot.LastSeq != nil {
+		s.Loss.Reply(*snapshot.LastSeq, time.Now())
+		s.Epoch = snapshot.Epoch
+	}
+	s.Loss.Carry(snapshot.Loss)
+	if snapshot.CallCodec != "" {
+		s.Call, err = ParseCallEstimator(snapshot.CallCodec, time.Duration(snapshot.JitterBufferMs*float64(time.Millisecond)))
+		if err != nil {
+			return err
+		}
+	}
+	if snapshot.Sparkline != "" {
+		s.Spark = stats.NewSparkRing(snapshot.Sparkline, stats.DEFAULT_VIEW_WIDTH)
+		s.Spark.Resize(m.width)
+		s.Loss.Observe(s.Spark.Observe)
+	}
+	if snapshot.OutageAfter > 0 {
+		s.Outages = stats.NewOutageTracker(snapshot.OutageAfter, interval, time.Now)
+		s.Outages.Restore(snapshot.Outages)
+		s.OutagesOpened = len(s.Outages.Outages())
+		s.OutagesClosed = s.OutagesOpened
+		s.Loss.Observe(s.Outages.Outcome)
+	}
+
+	ongoing := len(state.Pauses) > 0 && state.Pauses[len(state.Pauses)-1].End == nil
+	if err := stats.RestoreState(state, &s); err != nil {
+		return err
+	}
+	if ongoing {
+		gap := s.Pauses[len(s.Pauses)-1]
+		gap.End = nil
+		s.Paused = &gap
+		s.Pauses = s.Pauses[:len(s.Pauses)-1]
+	}
+	s.Metadata = state.Metadata
+	if s.Metadata != nil {
+		s.Headline = s.Metadata.Headline
+	}
+	s.Target = state.Target
+	s.Route = state.Interface
+
+	m.Target = target.Target{Mode: snapshot.Mode, Host: snapshot.Host, Port: snapshot.Port, URL: snapshot.URL}
+	m.Host = snapshot.Host
+	m.interval = interval
+	m.window = int64(state.WindowS)
+	m.received = s.Totals.Count > 0
+	m.Stats = s
+
+	return nil
+}
+
+// control passes an action that changes the run on to the instance, or
+// says why it can't.
+func (f *Follower) control(action string, paused bool) tea.Cmd {
+	if !f.allowControl {
+		f.notice = "read-only, attach with --allow-control to " + action
+		return nil
+	}
+	if !f.connected {
+		f.notice = "not connected, so can't " + action
+		return nil
+	}
+
+	command := action
+	if action == "pause" && paused {
+		command = "resume"
+	}
+	socket := f.socket
+
+	return func() tea.Msg {
+		reply, err := control.Send(socket, command)
+		if err != nil {
+			return followReply(err.Error())
+		}
+
+		return followReply(command + ": " + reply)
+	}
+}
+
+func (f *Follower) line(t theme.Theme, times stats.TimeFormat) string {
+	if !f.connected {
+		return t.Alert.Render(fmt.Sprintf("Lost %s (%s), retrying in %s", f.socket, f.lost, f.retrying))
+	}
+
+	line := fmt.Sprintf("Attached to %s since %s", f.socket, times.Clock(f.since))
+	if f.allowControl {
+		line += ", passing ack, pause and mark-change on"
+	} else {
+		line += ", read-only"
+	}
+	if f.notice != "" {
+		line += " - " + f.notice
+	}
+
+	return line
+}
@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/control"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestAttach attaches a follower to an instance over its control
+// socket, checks it rebuilds the run from the snapshot and keeps up with
+// the replies and events after it, refuses the keys that change the run
+// when read-only, and takes up the new run once the instance restarts.
+func TestAttach(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "control.sock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	instance := func(runID string) (*control.Server, Model, error) {
+		server, err := control.Listen(path)
+		if err != nil {
+			return nil, Model{}, err
+		}
+		go server.Serve(ctx)
+
+		m := Model{ctx: ctx, Target: target.Target{Mode: target.ICMP, Host: "192.0.2.1"}, Host: "192.0.2.1", interval: time.Second, window: 5, Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)}
+		m.Stats.RunID = runID
+		m.Stats.Outages = stats.NewOutageTracker(stats.DEFAULT_OUTAGE_PROBES, time.Second, time.Now)
+		m.Stats.Loss.Observe(m.Stats.Outages.Outcome)
+		return server, m, nil
+	}
+	reply := func(m Model, seq int) Model {
+		next, _ := m.Update(ping.Result{Seq: seq, Duration: 20 * time.Millisecond, TTL: 57, Epoch: 1})
+		return next.(Model)
+	}
+	accept := func(server *control.Server, m *Model) bool {
+		select {
+		case command := <-server.Commands():
+			m.handleControl(command)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	server, d, err := instance("run-one")
+	if err != nil {
+		t.Fatalf("the instance listens on its control socket: expected no error, got %v", err)
+	}
+	for seq := 1; seq <= 3; seq++ {
+		d = reply(d, seq)
+	}
+
+	f := NewFollower(path, false, stats.TIME_UTC)
+	f.retry = 10 * time.Millisecond
+	go f.Run(ctx)
+	if !accept(server, &d) {
+		t.Fatalf("the follower subscribes: expected a subscribe command, got none")
+	}
+	keys, _ := NewKeyMap(nil)
+	c, err := NewFollowModel(ctx, f, theme.Theme{}, keys)
+	if err != nil {
+		t.Fatalf("the follower takes the snapshot: expected no error, got %v", err)
+	}
+	if c.Stats.RunID != "run-one" || c.Stats.Totals.Count != 3 || c.Host != "192.0.2.1" {
+		t.Fatalf("the snapshot rebuilds the run: expected run-one with 3 samples, got %s with %d", c.Stats.RunID, c.Stats.Totals.Count)
+	}
+
+	// Only a reply or event changes anything the follower is waited on for.
+	follow := func(done func() bool) bool {
+		for !done() {
+			msg := f.next(ctx)
+			if ctx.Err() != nil {
+				return false
+			}
+			next, _ := c.Update(msg)
+			c = next.(Model)
+		}
+		return true
+	}
+
+	d = reply(d, 4)
+	d = reply(d, 6)
+	d.Stats.AddEvent("route", "now via wg0 (VPN)")
+	d.publishStatus(nil)
+	if !follow(func() bool { return len(c.Stats.Events) > 0 && c.Stats.Totals.Count == 5 }) {
+		t.Fatalf("the follower keeps up with the run: expected 5 samples and the route event, got %d samples and %d events", c.Stats.Totals.Count, len(c.Stats.Events))
+	}
+	if c.Stats.Events[0].Message != "now via wg0 (VPN)" || c.last.Seq != 6 || c.Stats.Loss.InFlight() != 1 {
+		t.Fatalf("the follower shows the instance's events, and finds the gap left by the probe lost: expected the route event, seq 6 last and seq 5 awaited, got %q, seq %d, %d awaited", c.Stats.Events[0].Message, c.last.Seq, c.Stats.Loss.InFlight())
+	}
+
+	next, cmd := c.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	c = next.(Model)
+	if cmd != nil || c.Stats.Paused != nil || !strings.Contains(c.follow.notice, "--allow-control") {
+		t.Fatalf("a read-only follower turns the keys that change the run off: expected no command, with a notice, got %q", c.follow.notice)
+	}
+
+	// The instance restarts, with a new run.
+	d.attached.Close()
+	server.Close()
+	server, d, err = instance("run-two")
+	if err != nil {
+		t.Fatalf("the restarted instance listens on its control socket: expected no error, got %v", err)
+	}
+	defer server.Close()
+	lost := false
+	if !follow(func() bool { lost = lost || !c.follow.connected; return lost }) {
+		t.Fatalf("the follower sees the instance go: expected the connection lost, got still connected")
+	}
+	if !accept(server, &d) {
+		t.Fatalf("the follower subscribes again: expected a subscribe command, got none")
+	}
+	if !follow(func() bool { return c.follow.connected }) || c.Stats.RunID != "run-two" || c.Stats.Totals.Count != 0 || len(c.Stats.Events) != 0 {
+		t.Fatalf("the follower reconnects and takes up the new run: expected run-two, empty, got %s with %d samples and %d events", c.Stats.RunID, c.Stats.Totals.Count, len(c.Stats.Events))
+	}
+	d.attached.Close()
+}
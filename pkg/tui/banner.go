@@ -0,0 +1,144 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+var (
+	PROXY_VARIABLES = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy"}
+	LOCAL_SUFFIXES  = []string{".local", ".lan", ".home.arpa", ".internal", ".localdomain"}
+)
+
+func collectMetadata(ctx context.Context, m Model) stats.RunMetadata {
+	pinger := m.newPinger()
+	payload := 0
+	if m.Target.Mode == target.ICMP {
+		payload = pinger.PayloadSize()
+	}
+	metadata := stats.RunMetadata{
+		Target:       m.describeTarget(),
+		Mode:         m.Target.Mode,
+		Backend:      pinger.Backend(),
+		IntervalS:    m.interval.Seconds(),
+		TimeoutMs:    stats.LossTimeout(m.Stats.Interval).Milliseconds(),
+		PayloadBytes: payload,
+		DontFragment: m.dontFragment,
+		MaxInFlight:  pinger.Probes().Max(),
+		Headline:     headlineName(m.Stats.Headline),
+	}
+	build := CurrentBuild()
+	metadata.Build = &build
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	addrs, err := ping.ResolveAll(ctx, m.Host, m.family)
+	if err != nil {
+		metadata.Caveats = append(metadata.Caveats, fmt.Sprintf("%s doesn't resolve yet, so nothing is known about where probes will go", m.Host))
+	} else {
+		addr := addrs[0]
+		metadata.Address = addr.String()
+		if len(addrs) > 1 {
+			metadata.Addresses = AddressStrings(addrs)
+		}
+		metadata.Family = ping.FamilyOf(addr)
+		metadata.AddressClass = target.Classify(addr)
+		if iface, err := route.Lookup(ctx, metadata.Address); err == nil {
+			metadata.Interface = iface
+		}
+	}
+	// Probes bound to an interface leave by it whatever the route says.
+	if m.binding.Interface != "" {
+		metadata.Interface = m.binding.Interface
+	}
+	if m.binding.Source.IsValid() {
+		metadata.Source = m.binding.Source.String()
+	}
+
+	metadata.Caveats = append(metadata.Caveats, detectCaveats(metadata, m.Host, ping.Unprivileged(), os.Getenv)...)
+	return metadata
+}
+
+func detectCaveats(metadata stats.RunMetadata, host string, unprivileged bool, getenv func(string) string) []string {
+	var caveats []string
+
+	if unprivileged {
+		caveats = append(caveats, "ping is using an unprivileged ICMP socket (net.ipv4.ping_group_range)")
+	}
+
+	if route.IsVPN(metadata.Interface) {
+		caveats = append(caveats, fmt.Sprintf("the route to the target goes over %s, which looks like a VPN, so this measures the tunnel too", metadata.Interface))
+	}
+
+	for _, name := range PROXY_VARIABLES {
+		if getenv(name) != "" {
+			caveats = append(caveats, fmt.Sprintf("%s is set, but icmp probes don't use it, so they may take a different path to web traffic", name))
+			break
+		}
+	}
+
+	if suspectCaptivePortal(&metadata, host) {
+		caveats = append(caveats, fmt.Sprintf("%s resolves to %s, a %s address - check /etc/hosts, or a captive portal or DNS interception may be answering", host, metadata.Address, metadata.AddressClass))
+	}
+
+	return caveats
+}
+
+// looksPublic is true of hostnames that ought to resolve to an internet
+// address, rather than literal addresses or names on the local network.
+func looksPublic(host string) bool {
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return false
+	}
+
+	for _, suffix := range LOCAL_SUFFIXES {
+		if strings.HasSuffix(strings.ToLower(host), suffix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// suspectCaptivePortal flags run metadata where a public-looking hostname
+// resolved somewhere that isn't on the internet.
+func suspectCaptivePortal(metadata *stats.RunMetadata, host string) bool {
+	return metadata != nil && metadata.AddressClass != "" && metadata.AddressClass != target.GLOBAL && looksPublic(host)
+}
+
+func (m Model) printBanner() string {
+	lines := m.Stats.Metadata.Banner()
+	if abandoned := m.printAbandoned(); abandoned != "" {
+		lines = append(lines, "", abandoned)
+	}
+	lines = append(lines, "(enter to dismiss)")
+
+	return strings.Join(lines, "\n")
+}
+
+// describePayload is the icmp payload for the header, saying when the probes
+// can't be fragmented.
+func (m Model) describePayload() string {
+	if m.Target.Mode != target.ICMP {
+		return ""
+	}
+
+	size := m.size
+	if size == 0 {
+		size = ping.DEFAULT_PAYLOAD_SIZE
+	}
+	if m.dontFragment {
+		return fmt.Sprintf(", payload: %dB DF", size)
+	}
+	return fmt.Sprintf(", payload: %dB", size)
+}
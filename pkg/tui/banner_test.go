@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestBanner saves a run whose metadata triggers every caveat, reads
+// the state file back and checks the banner rendered from it is unchanged.
+func TestBanner(t *testing.T) {
+	metadata := stats.RunMetadata{
+		Target:       "icmp example.com",
+		Address:      "10.0.0.1",
+		Mode:         "icmp",
+		Backend:      "exec",
+		IntervalS:    1,
+		TimeoutMs:    2000,
+		PayloadBytes: ping.DEFAULT_PAYLOAD_SIZE,
+		Interface:    "wg0",
+	}
+	metadata.AddressClass = target.Classify(netip.MustParseAddr(metadata.Address))
+	metadata.Caveats = detectCaveats(metadata, "example.com", true, func(name string) string {
+		if name == "HTTPS_PROXY" {
+			return "http://proxy:3128"
+		}
+		return ""
+	})
+	if len(metadata.Caveats) != 4 {
+		t.Fatalf("caveats detected: expected 4, got %v", len(metadata.Caveats))
+	}
+
+	dir := t.TempDir()
+
+	s := stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS)
+	s.Metadata = &metadata
+	path := filepath.Join(dir, "state.json")
+	if err := stats.SaveState(path, &s); err != nil {
+		t.Fatalf("save state: expected no error, got %v", err)
+	}
+
+	state, err := stats.LoadState(path)
+	if err != nil {
+		t.Fatalf("load state: expected no error, got %v", err)
+	}
+	if state.Metadata == nil {
+		t.Fatalf("metadata saved: expected metadata, got none")
+	}
+
+	expected, actual := strings.Join(metadata.Banner(), "\n"), strings.Join(state.Metadata.Banner(), "\n")
+	if expected != actual {
+		t.Fatalf("banner from saved metadata: expected %q, got %q", expected, actual)
+	}
+}
+
+// TestAddressClass checks which hostnames warn about where they point,
+// going by the class of address they resolved to.
+func TestAddressClass(t *testing.T) {
+	warnings := []struct {
+		host  string
+		class string
+		warn  bool
+	}{
+		{"example.com", target.LOOPBACK, true},
+		{"example.com", target.CGNAT, true},
+		{"example.com", target.GLOBAL, false},
+		{"printer.local", target.PRIVATE, false},
+		{"router.home.arpa", target.PRIVATE, false},
+		{"localhost", target.LOOPBACK, false},
+		{"10.0.0.1", target.PRIVATE, false},
+	}
+
+	for _, w := range warnings {
+		if warn := suspectCaptivePortal(&stats.RunMetadata{AddressClass: w.class}, w.host); warn != w.warn {
+			t.Fatalf("warning for %s resolving to a %s address: expected %v, got %v", w.host, w.class, w.warn, warn)
+		}
+	}
+}
+
+// TestPacketSizeLoss checks probes too big for the path are counted lost as
+// such and logged once, and that the header shows the payload asked for.
+func TestPacketSizeLoss(t *testing.T) {
+	now := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	s := stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart, s.Started = now, now
+	for seq := 1; seq <= 3; seq++ {
+		now = now.Add(time.Second)
+		s.Observe(ping.Result{Seq: seq, Epoch: 1, Lost: true, Reason: ping.LOSS_FRAGMENTATION, Error: "Frag needed and DF set (mtu = 1400)"})
+	}
+	if line := s.PrintLoss(theme.Theme{}); !strings.HasSuffix(line, ", 3 too big for the path") {
+		t.Fatalf("probes too big for the path are counted as such: expected , 3 too big for the path, got %q", line)
+	}
+	if len(s.Events) != 1 || s.Events[0].Kind != "fragmentation" || !strings.Contains(s.Events[0].Message, "mtu = 1400") {
+		t.Fatalf("the first is logged with why, and not the rest: expected one fragmentation event, got %+v", s.Events)
+	}
+	if _, lost, _ := s.Loss.Rolling(now); lost != 3 {
+		t.Fatalf("they count as lost: expected 3 lost, got %d lost", lost)
+	}
+
+	m := Model{Target: target.Target{Mode: target.ICMP}, interval: time.Second, size: 1400, dontFragment: true}
+	if header := m.describePayload(); header != ", payload: 1400B DF" {
+		t.Fatalf("the header shows the payload: expected , payload: 1400B DF, got %q", header)
+	}
+}
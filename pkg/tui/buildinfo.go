@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const HEALTHZ_PATH = "/healthz"
+
+// feature is an optional part of the build, with the platforms it works on,
+// none meaning all of them.
+type feature struct {
+	name      string
+	platforms []string
+}
+
+// FEATURES are the optional parts of the build, as listed by --version. One
+// left out of a build, or only working on some platforms, says so here.
+var FEATURES = []feature{
+	{"tui", nil},
+	{"native-icmp", nil},
+	{"route-lookup", []string{"linux", "darwin", "freebsd", "openbsd"}},
+	{"interface-counters", []string{"linux", "darwin", "freebsd", "openbsd"}},
+	{"wifi-readings", []string{"linux"}},
+	{"metered-detection", nil},
+	{"control-socket", nil},
+	{"stats-api", nil},
+	{"webhooks", nil},
+	{"forwarding", nil},
+	{"evidence-signing", nil},
+}
+
+var VERSION_COLUMNS = []ExportColumn{
+	{"version", "string", "the module version, a pseudo-version for a build from a checkout, or (devel) when Go stamped none"},
+	{"revision", "string", "the VCS revision built, when the build recorded one"},
+	{"dirty", "boolean", "whether the checkout had changes that weren't committed"},
+	{"go_version", "string", "the Go release it was built with"},
+	{"os", "string", "the GOOS it was built for"},
+	{"arch", "string", "the GOARCH it was built for"},
+	{"features", "array", "the optional features built in that work on this platform"},
+	{"backends", "array", "each probe backend, with whether it can probe from here and, if not, why"},
+}
+
+// CurrentBuild is read once, since finding the backends opens a socket.
+var CurrentBuild = sync.OnceValue(readBuild)
+
+func readBuild() stats.BuildInfo {
+	info := stats.BuildInfo{Version: "(devel)", GoVersion: runtime.Version(), OS: runtime.GOOS, Arch: runtime.GOARCH, Backends: ping.Available()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if build.Main.Version != "" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.modified":
+				info.Dirty = setting.Value == "true"
+			}
+		}
+	}
+
+	info.Features = []string{}
+	for _, f := range FEATURES {
+		if len(f.platforms) == 0 || slices.Contains(f.platforms, runtime.GOOS) {
+			info.Features = append(info.Features, f.name)
+		}
+	}
+
+	return info
+}
+
+// ServeHealth answers HEALTHZ_PATH with the build, for anything checking the
+// process is up to say what it is too.
+func ServeHealth(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(struct {
+		Status string          `json:"status"`
+		Build  stats.BuildInfo `json:"build"`
+	}{"ok", CurrentBuild()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,23 @@
+package tui
+
+import (
+	"fmt"
+)
+
+// describeInterval is the probe interval for the header, saying so when
+// it's been shortened for an incident, and with --adaptive whether it's
+// bursting.
+func (m Model) describeInterval() string {
+	normal := m.interval.String()
+	b := m.Stats.Burst
+	switch {
+	case b != nil && b.Adaptive && b.Active:
+		return fmt.Sprintf("%s burst, normally %s", b.Interval, normal)
+	case b != nil && b.Adaptive:
+		return fmt.Sprintf("%s normal, bursting to %s", normal, b.Interval)
+	case b == nil || !b.Active:
+		return normal
+	}
+
+	return fmt.Sprintf("%s during incident, normally %s", b.Interval, normal)
+}
@@ -0,0 +1,224 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestBurst takes a 10s prober through an outage with a fake clock:
+// the loss alert should drop the interval to 1s, and the end of the tail
+// after it resolves should bring it back. Every probe sent should settle
+// exactly once across the changes of rate, and the loss should come out as
+// the share of time the outage took rather than of probes.
+func TestBurst(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := 10 * time.Second
+	s := stats.New(interval, time.Minute, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = now
+	s.Loss = stats.NewLossTracker(interval, stats.LossTimeout(interval), time.Hour, time.Minute)
+	s.Loss.Retain(time.Hour)
+	s.LossAlerts = stats.NewLossAlerts(stats.LossCriteria{Consecutive: 3}, interval)
+
+	var err error
+	s.Burst, err = stats.NewBurstControl(time.Second, 30*time.Second, interval)
+	if err != nil {
+		t.Fatalf("create burst control: expected no error, got %v", err)
+	}
+	if _, err := stats.NewBurstControl(interval, time.Minute, interval); err == nil {
+		t.Fatalf("a burst interval no faster than normal: expected an error, got none")
+	}
+
+	// The prober sends whenever a probe is due at the current rate, and
+	// straight away when the rate goes up, as the pinger's pacer does.
+	seq := 0
+	next := now
+	probe := func(up bool) {
+		seq++
+		next = now.Add(s.ProbeInterval())
+		if up {
+			s.Observe(ping.Result{Seq: seq, Epoch: 1, Duration: 20 * time.Millisecond})
+			s.Update(20 * time.Millisecond)
+		}
+	}
+	run := func(seconds int, up bool) {
+		for i := 0; i < seconds; i++ {
+			now = now.Add(time.Second)
+			if !now.Before(next) {
+				probe(up)
+			}
+
+			rate := s.ProbeInterval()
+			s.AdvanceLoss()
+			if s.ProbeInterval() < rate {
+				probe(up)
+			} else if s.ProbeInterval() > rate {
+				next = now.Add(s.ProbeInterval())
+			}
+		}
+	}
+
+	run(100, true)
+	if s.ProbeInterval() != interval || s.ActiveIncidentOf("") != nil {
+		t.Fatalf("a steady connection: expected no incident, probing every 10s, got every %s, incidents %+v", s.ProbeInterval(), s.Incidents)
+	}
+
+	run(100, false)
+	if s.ProbeInterval() != time.Second || s.Loss.Interval() != time.Second {
+		t.Fatalf("an outage raising a loss alert: expected probing every 1s, got every %s, loss tracker at %s, events %+v", s.ProbeInterval(), s.Loss.Interval(), s.Events)
+	}
+	if view := (Model{interval: 10 * time.Second, Stats: s}).describeInterval(); view != "1s during incident, normally 10s" {
+		t.Fatalf("the header's interval during an incident: expected 1s during incident, normally 10s, got %q", view)
+	}
+
+	// The probes sent in the outage's last 20s are given their full timeout
+	// before the alert can resolve.
+	run(30, true)
+	if s.ActiveIncidentOf("") != nil || s.ProbeInterval() != time.Second {
+		t.Fatalf("the alert resolving: expected still probing every 1s for the tail, got every %s, incidents %+v", s.ProbeInterval(), s.Incidents)
+	}
+
+	run(70, true)
+	if s.ProbeInterval() != interval || s.Loss.Interval() != interval {
+		t.Fatalf("the tail running out: expected back to probing every 10s, got every %s, events %+v", s.ProbeInterval(), s.Events)
+	}
+
+	var changes []string
+	for _, event := range s.Events {
+		if event.Kind == "rate" {
+			changes = append(changes, event.Message)
+		}
+	}
+	if len(changes) != 2 {
+		t.Fatalf("rate changes logged: expected 2 rate events, got %q", strings.Join(changes, "; "))
+	}
+
+	sent, lost := s.Loss.Settled()
+	if sent+s.Loss.InFlight() != seq {
+		t.Fatalf("probes settled across the changes of rate: expected %v, got %d settled, %d in flight", seq, sent, s.Loss.InFlight())
+	}
+
+	// The outage took 100s of the run's 300, whatever the rate was.
+	if share := s.Loss.Cumulative(); math.Abs(share-1.0/3) > 0.05 {
+		t.Fatalf("loss weighted by time: expected about 33%%, got %.1f%% (%d of %d probes)", share*100, lost, sent)
+	}
+}
+
+// TestAdaptive has a reply over --warn and then a probe lost set off
+// --adaptive, checking it holds the fast rate past a clean window only once
+// ADAPTIVE_HOLD is up, and that the burst's replies don't outweigh the rest
+// in the averages.
+func TestAdaptive(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := time.Second
+	s := stats.New(interval, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = now
+	s.Levels = stats.Levels{Warn: 80 * time.Millisecond}
+	s.Loss = stats.NewLossTracker(interval, stats.LossTimeout(interval), 5*time.Second, time.Minute)
+
+	var err error
+	s.Burst, err = stats.NewAdaptiveControl(stats.DEFAULT_BURST_INTERVAL, interval)
+	if err != nil {
+		t.Fatalf("create adaptive control: expected no error, got %v", err)
+	}
+	s.Loss.Observe(s.Burst.Observe)
+
+	seq := 0
+	next := now
+	run := func(d time.Duration, reply func(seq int) (time.Duration, bool)) {
+		for end := now.Add(d); now.Before(end); {
+			now = now.Add(100 * time.Millisecond)
+			if !now.Before(next) {
+				seq++
+				next = now.Add(s.ProbeInterval())
+				if latency, ok := reply(seq); ok {
+					s.Observe(ping.Result{Seq: seq, Epoch: 1, Duration: latency})
+					s.UpdateAt(latency, now)
+				}
+			}
+			s.AdvanceLoss()
+		}
+	}
+	steady := func(int) (time.Duration, bool) { return 20 * time.Millisecond, true }
+	m := Model{interval: interval}
+
+	run(10*time.Second, steady)
+	m.Stats = s
+	if s.ProbeInterval() != interval || m.describeInterval() != "1s normal, bursting to 200ms" {
+		t.Fatalf("a steady connection is probed at the normal rate: expected 1s normal, bursting to 200ms, got %q", m.describeInterval())
+	}
+
+	glitch := seq + 1
+	run(time.Second, func(seq int) (time.Duration, bool) {
+		if seq == glitch {
+			return 150 * time.Millisecond, true
+		}
+		return 20 * time.Millisecond, true
+	})
+	m.Stats = s
+	if s.ProbeInterval() != stats.DEFAULT_BURST_INTERVAL || s.Loss.Interval() != stats.DEFAULT_BURST_INTERVAL || m.describeInterval() != "200ms burst, normally 1s" {
+		t.Fatalf("a reply over --warn bursts at once: expected 200ms burst, normally 1s, got %s, loss tracker at %s", m.describeInterval(), s.Loss.Interval())
+	}
+
+	// Windows close clean well before the hold is up.
+	run(25*time.Second, steady)
+	if s.ProbeInterval() != stats.DEFAULT_BURST_INTERVAL {
+		t.Fatalf("the burst holds for ADAPTIVE_HOLD after the glitch: expected still every 200ms, got %q", s.ProbeInterval().String())
+	}
+	run(12*time.Second, steady)
+	if s.ProbeInterval() != interval || s.Loss.Interval() != interval {
+		t.Fatalf("a clean window past the hold ends the burst: expected back to every 1s, got every %s, events %+v", s.ProbeInterval(), s.Events)
+	}
+
+	lost := seq + 2
+	run(5*time.Second, func(seq int) (time.Duration, bool) { return 20 * time.Millisecond, seq != lost })
+	if s.ProbeInterval() != stats.DEFAULT_BURST_INTERVAL {
+		t.Fatalf("a probe lost bursts once it's settled: expected every 200ms, got every %s, events %+v", s.ProbeInterval(), s.Events)
+	}
+	sent, missed := s.Loss.Settled()
+	if missed != 1 {
+		t.Fatalf("changing rate loses nothing on its own: expected 1 lost, got %d of %d", missed, sent)
+	}
+
+	var changes []string
+	for _, event := range s.Events {
+		if event.Kind == "rate" {
+			changes = append(changes, event.Message)
+		}
+	}
+	if len(changes) != 3 || !strings.HasPrefix(changes[0], "a reply over the 80ms --warn") || !strings.HasPrefix(changes[1], "a whole window clean") || !strings.HasPrefix(changes[2], "a probe lost") {
+		t.Fatalf("each change of rate is logged with why: expected over --warn, clean, lost, got %q", strings.Join(changes, "; "))
+	}
+
+	// A second's worth of normal replies and of burst ones count the same,
+	// however many more of the burst's there are.
+	var w stats.Window
+	for range 5 {
+		w.UpdateWeighted(10*time.Millisecond, time.Time{}, 1)
+	}
+	for range 25 {
+		w.UpdateWeighted(40*time.Millisecond, time.Time{}, 0.2)
+	}
+	if w.Average() != 25*time.Millisecond || w.Count != 30 {
+		t.Fatalf("the average weighs each reply by the interval it stands for: expected 25ms over 30 replies, got %s over %d", w.Average(), w.Count)
+	}
+	data, err := json.Marshal(w)
+	var back stats.Window
+	if err == nil {
+		err = json.Unmarshal(data, &back)
+	}
+	if err != nil || back.Average() != w.Average() {
+		t.Fatalf("the weights are kept in the state file: expected %s, got %q", w.Average(), fmt.Sprint(back.Average(), err))
+	}
+	if data, _ := json.Marshal(stats.Window{Count: 1, Total: time.Millisecond}); strings.Contains(string(data), "Weight") {
+		t.Fatalf("a window all at the normal rate stores no weights: expected no Weight, got %q", string(data))
+	}
+}
@@ -0,0 +1,17 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+func ParseCallEstimator(codec string, buffer time.Duration) (*stats.CallEstimator, error) {
+	c, err := stats.ParseCodec(codec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --call-codec: %s", err)
+	}
+
+	return stats.NewCallEstimator(c, buffer), nil
+}
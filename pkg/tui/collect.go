@@ -0,0 +1,18 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// SOURCE_NAME is what a source can be called, which has to be safe to name
+// its file after.
+var SOURCE_NAME = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func CheckSource(source string) error {
+	if !SOURCE_NAME.MatchString(source) {
+		return fmt.Errorf("invalid source name %q, expected letters, digits, dots, dashes and underscores, set with --label %s=name", source, AGGREGATE_SITE_LABEL)
+	}
+
+	return nil
+}
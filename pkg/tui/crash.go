@@ -0,0 +1,211 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/history"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	CHECKPOINT_DIR = "checkpoints"
+	// A live run rewrites its checkpoint every window, so one left alone
+	// for this many windows belongs to a run that was killed outright.
+	CHECKPOINT_STALE_WINDOWS = 2
+)
+
+// crashGuard keeps the latest stats of a run where a panic handler can reach
+// them, and checkpoints them every window so that a run killed without the
+// chance to clean up still leaves its measurements behind.
+type crashGuard struct {
+	path    string
+	state   string
+	host    string
+	started time.Time
+
+	latest   stats.Stats
+	recorded bool
+	// release hands the terminal back if the TUI was running.
+	release func()
+}
+
+func newCrashGuard(dir string, state string, host string, started time.Time) *crashGuard {
+	g := &crashGuard{state: state, host: host, started: started}
+	if dir != "" {
+		g.path = filepath.Join(dir, fmt.Sprintf("%d.json", started.UnixNano()))
+	}
+
+	return g
+}
+
+func (g *crashGuard) record(s stats.Stats) {
+	if g == nil {
+		return
+	}
+
+	g.latest = s
+	g.recorded = true
+}
+
+func (g *crashGuard) checkpoint(s *stats.Stats, crash string) error {
+	if g == nil || g.path == "" {
+		return nil
+	}
+
+	state := stats.NewRunState(s)
+	state.Incomplete = true
+	state.CheckpointAt = time.Now()
+	state.Crash = crash
+	state.Host = g.host
+	state.Started = g.started
+	state.WindowS = int(s.WindowSize.Seconds())
+
+	if err := os.MkdirAll(filepath.Dir(g.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %s", err)
+	}
+
+	return stats.WriteState(g.path, state)
+}
+
+// handle is deferred around the whole run. A normal exit removes the
+// checkpoint, while a panic saves the latest stats to it and the state file
+// before carrying on panicking. Deferred sinks, such as the webhook spool,
+// have been flushed by the time it runs.
+func (g *crashGuard) handle() {
+	r := recover()
+	if r == nil {
+		if g.path != "" {
+			os.Remove(g.path)
+		}
+		return
+	}
+
+	if g.release != nil {
+		g.release()
+	}
+
+	if g.recorded {
+		if g.state != "" {
+			if err := stats.SaveState(g.state, &g.latest); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to save state after panic: %s\n", err)
+			}
+		}
+
+		if err := g.checkpoint(&g.latest, fmt.Sprint(r)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to save checkpoint after panic: %s\n", err)
+		} else if g.path != "" {
+			fmt.Fprintf(os.Stderr, "saved the run so far to %s, run `network-test recover` to finalise it\n", g.path)
+		}
+	}
+
+	panic(r)
+}
+
+type checkpoint struct {
+	Path  string
+	State stats.RunState
+}
+
+// abandoned reports whether nothing is still writing to the checkpoint.
+func (c checkpoint) abandoned(now time.Time) bool {
+	if c.State.Crash != "" {
+		return true
+	}
+
+	window := time.Duration(max(c.State.WindowS, 1)) * time.Second
+	return now.Sub(c.State.CheckpointAt) > CHECKPOINT_STALE_WINDOWS*window
+}
+
+func (c checkpoint) String() string {
+	s := c.State
+	target := s.Host
+	if s.Metadata != nil {
+		target = s.Metadata.Target
+	}
+
+	ended := "killed"
+	if s.Crash != "" {
+		ended = "panicked: " + s.Crash
+	}
+
+	return fmt.Sprintf("%s from %s, last checkpoint %s, %d samples (%s)",
+		target, s.Started.In(time.Local).Format(time.DateTime), s.CheckpointAt.In(time.Local).Format(time.DateTime), s.Totals.Count, ended)
+}
+
+func (c checkpoint) HistoryRun() history.Run {
+	s := c.State
+	h := s.Histogram.Histogram()
+
+	run := history.Run{
+		RunID:      s.RunID,
+		Host:       s.Host,
+		Start:      s.Started,
+		End:        s.CheckpointAt,
+		Count:      s.Totals.Count,
+		MinMs:      history.Milliseconds(s.Totals.Min),
+		AvgMs:      history.Milliseconds(s.Totals.Average()),
+		MaxMs:      history.Milliseconds(s.Totals.Max),
+		LossPct:    s.LossPct,
+		Incomplete: true,
+	}
+	if s.Metadata != nil {
+		run.Mode = s.Metadata.Mode
+	}
+	if h.Total() > 0 && len(h.Thresholds()) > 0 && len(h.Buckets()) == len(h.Thresholds()) {
+		run.P95Ms = min(history.Milliseconds(h.Percentile(95).Value), history.Milliseconds(s.Totals.Max))
+	}
+
+	return run
+}
+
+// AbandonedCheckpoints lists the checkpoints in dir left by runs that are no
+// longer going, oldest first. A missing directory has none.
+func AbandonedCheckpoints(dir string, now time.Time) ([]checkpoint, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint directory: %s", err)
+	}
+
+	var found []checkpoint
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		state, err := stats.LoadState(path)
+		if err != nil || !state.Incomplete {
+			continue
+		}
+
+		c := checkpoint{Path: path, State: state}
+		if c.abandoned(now) {
+			found = append(found, c)
+		}
+	}
+
+	slices.SortFunc(found, func(a, b checkpoint) int { return a.State.Started.Compare(b.State.Started) })
+	return found, nil
+}
+
+func (m Model) printAbandoned() string {
+	if len(m.abandoned) == 0 {
+		return ""
+	}
+
+	lines := []string{fmt.Sprintf("Found %d unfinished run(s), which `network-test recover` adds to the history:", len(m.abandoned))}
+	for _, c := range m.abandoned {
+		lines = append(lines, "  "+c.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
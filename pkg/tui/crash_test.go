@@ -0,0 +1,75 @@
+package tui
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestCrashRecovery panics partway through a simulated run under the
+// crash guard, then checks the panic still propagates and that the checkpoint
+// it left loads, is marked incomplete and is offered for recovery.
+func TestCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	started := time.Now().Add(-time.Minute)
+	guard := newCrashGuard(dir, filepath.Join(dir, "state.json"), "example.com", started)
+	s := stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS)
+
+	recovered := func() (r any) {
+		defer func() { r = recover() }()
+		defer guard.handle()
+
+		for i := int64(1); i <= 30; i++ {
+			s.Update(time.Duration(10+i) * time.Millisecond)
+			guard.record(s)
+		}
+		panic("synthetic panic")
+	}()
+	if recovered != "synthetic panic" {
+		t.Fatalf("panic carries on past the guard: expected synthetic panic, got %v", recovered)
+	}
+
+	if _, err := stats.LoadState(filepath.Join(dir, "state.json")); err != nil {
+		t.Fatalf("state file saved on panic: expected no error, got %v", err)
+	}
+
+	found, err := AbandonedCheckpoints(dir, time.Now())
+	if err != nil {
+		t.Fatalf("list checkpoints: expected no error, got %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("checkpoints offered for recovery: expected 1, got %v", len(found))
+	}
+
+	state := found[0].State
+	if !state.Incomplete || state.Crash != "synthetic panic" || state.CheckpointAt.IsZero() {
+		t.Fatalf("checkpoint marked incomplete with the panic: expected incomplete, synthetic panic, got %t, %q, %s", state.Incomplete, state.Crash, state.CheckpointAt)
+	}
+
+	run := found[0].HistoryRun()
+	if run.Count != 30 || run.MinMs != 11 || run.MaxMs != 40 || !run.Incomplete || !run.Start.Equal(started) {
+		t.Fatalf("recovered run: expected 30 samples, 11-40ms, incomplete, got %d samples, %g-%gms, %t", run.Count, run.MinMs, run.MaxMs, run.Incomplete)
+	}
+
+	// A checkpoint still being written to belongs to a live run.
+	live := newCrashGuard(dir, "", "example.com", time.Now())
+	if err := live.checkpoint(&s, ""); err != nil {
+		t.Fatalf("write checkpoint: expected no error, got %v", err)
+	}
+	if found, _ := AbandonedCheckpoints(dir, time.Now()); len(found) != 1 {
+		t.Fatalf("live run left alone: expected 1 to recover, got %v", len(found))
+	}
+	if found, _ := AbandonedCheckpoints(dir, time.Now().Add(3*time.Minute)); len(found) != 2 {
+		t.Fatalf("run killed without panicking: expected 2 to recover, got %v", len(found))
+	}
+
+	func() {
+		defer live.handle()
+	}()
+	if found, _ := AbandonedCheckpoints(dir, time.Now().Add(3*time.Minute)); len(found) != 1 {
+		t.Fatalf("checkpoint removed on a clean exit: expected 1 left, got %v", len(found))
+	}
+}
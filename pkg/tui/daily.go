@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+type dailySummary struct {
+	RunID     string               `json:"run_id"`
+	Date      string               `json:"date"`
+	From      time.Time            `json:"from"`
+	To        time.Time            `json:"to"`
+	Totals    stats.Window         `json:"totals"`
+	Histogram stats.HistogramState `json:"histogram"`
+	Slowest   []stats.Slow         `json:"slowest,omitempty"`
+	Call      *stats.CallSummary   `json:"call,omitempty"`
+	Metadata  *stats.RunMetadata   `json:"metadata,omitempty"`
+}
+
+type dailyReset struct {
+	hour   int
+	minute int
+	dir    string
+	// location is the one hour:minute is the wall clock time of, time.Local
+	// but for tests.
+	location    *time.Location
+	periodStart time.Time
+	next        time.Time
+}
+
+func parseClock(text string) (int, int, error) {
+	t, err := time.Parse("15:04", text)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse time of day %q, expected HH:MM", text)
+	}
+
+	return t.Hour(), t.Minute(), nil
+}
+
+func NewDailyReset(at string, dir string, now time.Time) (*dailyReset, error) {
+	hour, minute, err := parseClock(at)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dailyReset{hour: hour, minute: minute, dir: dir, location: time.Local}
+	d.start(now)
+	return d, nil
+}
+
+// start begins the first period at now, which the model does again by its
+// own clock once it has one, so that a replay rolls over by the recording's.
+func (d *dailyReset) start(now time.Time) {
+	d.periodStart = now
+	d.next = nextBoundary(now, d.hour, d.minute, d.location)
+}
+
+// nextBoundary finds the first hour:minute in the location strictly after t.
+// Building the candidate with time.Date keeps it on the wall clock across
+// DST changes.
+func nextBoundary(t time.Time, hour int, minute int, location *time.Location) time.Time {
+	local := t.In(location)
+	candidate := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, location)
+	for !candidate.After(t) {
+		local = local.AddDate(0, 0, 1)
+		candidate = time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, location)
+	}
+
+	return candidate
+}
+
+// check snapshots and resets the totals once a boundary has passed. If the
+// process slept through one or more boundaries the summary is attributed to
+// the day the period started and covers up to the first missed boundary.
+func (d *dailyReset) check(now time.Time, s *stats.Stats) {
+	if now.Before(d.next) {
+		return
+	}
+
+	summary := dailySummary{
+		RunID:     s.RunID,
+		Date:      d.periodStart.In(d.location).Format(time.DateOnly),
+		From:      d.periodStart,
+		To:        d.next,
+		Totals:    s.Totals,
+		Histogram: stats.HistogramStateOf(&s.Histogram),
+		Slowest:   s.SlowTotals.Sorted(),
+		Call:      s.CallTotals(),
+		Metadata:  s.Metadata,
+	}
+
+	late := now.Sub(d.next)
+	d.periodStart = d.next
+	d.next = nextBoundary(now, d.hour, d.minute, d.location)
+
+	s.ResetTotals(now)
+
+	path, err := writeDailySummary(d.dir, summary)
+	if err != nil {
+		s.AddEvent("rollover", fmt.Sprintf("failed to write summary for %s: %s", summary.Date, err))
+		return
+	}
+
+	message := fmt.Sprintf("totals for %s written to %s", summary.Date, path)
+	if late > time.Minute {
+		message += fmt.Sprintf(" (%s late)", late.Round(time.Second))
+	}
+	s.AddEvent("rollover", message)
+}
+
+func writeDailySummary(dir string, summary dailySummary) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("network-test-%s.json", summary.Date))
+	return path, os.WriteFile(path, data, 0o644)
+}
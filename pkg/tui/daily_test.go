@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestNextBoundary finds the next reset in London either side of the
+// clocks changing, when the days between resets are 23 and 25 hours
+// long, and at a reset, which is counted as already past.
+func TestNextBoundary(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("load Europe/London: expected no error, got %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		from     time.Time
+		hour     int
+		minute   int
+		expected time.Time
+	}{
+		{"later the same day", time.Date(2026, 3, 28, 12, 0, 0, 0, london), 18, 30, time.Date(2026, 3, 28, 18, 30, 0, 0, london)},
+		{"at the reset", time.Date(2026, 3, 28, 18, 30, 0, 0, london), 18, 30, time.Date(2026, 3, 29, 18, 30, 0, 0, london)},
+		{"the clocks going forward", time.Date(2026, 3, 29, 0, 0, 0, 0, london), 0, 0, time.Date(2026, 3, 29, 23, 0, 0, 0, time.UTC)},
+		{"the clocks going back", time.Date(2026, 10, 25, 0, 0, 0, 0, london), 0, 0, time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC)},
+		{"past the change", time.Date(2026, 10, 25, 3, 0, 0, 0, london), 2, 0, time.Date(2026, 10, 26, 2, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		if next := nextBoundary(c.from, c.hour, c.minute, london); !next.Equal(c.expected) {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.expected.In(london), next.In(london))
+		}
+	}
+}
+
+// TestDailyCheck runs a model by a clock of its own through a suspend of
+// several days with no replies coming in, checking that the loss tick rolls the
+// totals over once for the day the period started, late, and again at the
+// next reset for the days slept through.
+func TestDailyCheck(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("load Europe/London: expected no error, got %v", err)
+	}
+
+	start := time.Date(2026, 3, 27, 12, 0, 0, 0, london)
+	now := start
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+	for range 5 {
+		s.Update(20 * time.Millisecond)
+	}
+
+	dir := t.TempDir()
+	daily := &dailyReset{hour: 0, minute: 0, dir: dir, location: london}
+	daily.start(start)
+	m := NewModel(nil, s)
+	m.daily = daily
+	tick := func(at time.Time) {
+		now = at
+		updated, _ := m.Update(LossMsg{})
+		m = updated.(Model)
+	}
+	read := func(date string) dailySummary {
+		var summary dailySummary
+		data, err := os.ReadFile(filepath.Join(dir, "network-test-"+date+".json"))
+		if err != nil || json.Unmarshal(data, &summary) != nil {
+			t.Fatalf("the summary for %s: expected it written, got %v", date, err)
+		}
+		return summary
+	}
+
+	tick(time.Date(2026, 3, 27, 23, 59, 0, 0, london))
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 0 || m.Stats.Totals.Count != 5 {
+		t.Fatalf("before the reset: expected no summary and 5 samples, got %q and %d", files, m.Stats.Totals.Count)
+	}
+
+	woke := time.Date(2026, 3, 31, 9, 0, 0, 0, london)
+	tick(woke)
+	first := read("2026-03-27")
+	if !first.From.Equal(start) || !first.To.Equal(time.Date(2026, 3, 28, 0, 0, 0, 0, london)) || first.Totals.Count != 5 || m.Stats.Totals.Count != 0 {
+		t.Fatalf("waking days later: expected the 27th's 5 samples up to midnight and the totals reset, got %s to %s with %d and %d left", first.From, first.To, first.Totals.Count, m.Stats.Totals.Count)
+	}
+	if event := m.Stats.Events[len(m.Stats.Events)-1]; event.Kind != "rollover" || !strings.HasSuffix(event.Message, "(80h0m0s late)") {
+		t.Fatalf("waking days later: expected a rollover 80h late, got %s %q", event.Kind, event.Message)
+	}
+
+	tick(woke.Add(time.Minute))
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 1 {
+		t.Fatalf("a boundary is only rolled over once: expected 1 summary, got %q", files)
+	}
+
+	tick(time.Date(2026, 4, 1, 0, 0, 1, 0, london))
+	second := read("2026-03-28")
+	if !second.From.Equal(first.To) || !second.To.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, london)) {
+		t.Fatalf("the next reset: expected the days slept through from the 28th to April, got %s to %s", second.From, second.To)
+	}
+}
@@ -0,0 +1,224 @@
+package tui
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	DASHBOARD_API = "/api/stats"
+	// DASHBOARD_EVENTS is how many of the latest events the API gives.
+	DASHBOARD_EVENTS = 20
+	// DASHBOARD_SHUTDOWN_TIMEOUT is how long requests under way are given to
+	// finish once the run ends.
+	DASHBOARD_SHUTDOWN_TIMEOUT = 2 * time.Second
+)
+
+var DASHBOARD_COLUMNS = []ExportColumn{
+	{"run_id", "string", "the run's ID"},
+	{"target", "string", "what's probed, as in the header"},
+	{"interval", "string", "the interval between probes, as in the header"},
+	{"updated", "RFC 3339 time", "when the document was last replaced"},
+	{"paused", "bool", "whether probing is paused"},
+	{"last_ms", "float", "the last reply's latency, left out until there is one"},
+	{"totals", "object", "the run's count, min_ms, avg_ms, max_ms, sd_ms and jitter_ms"},
+	{"window", "object", "the same for the window last completed"},
+	{"loss", "object", "window_pct, smoothed_pct and total_pct, and the probes sent and lost over the run"},
+	{"histogram", "object", "the thresholds in milliseconds, the count in each bucket below them, the overflow past the last and the total"},
+	{"outages", "array", "each run of probes lost in a row counted as an outage, as at /stats under --stats-listen"},
+	{"windows", "array", "the windows completed that are kept, oldest first, as in the windows tab"},
+	{"events", "array", "the latest events, oldest first"},
+	{"worst_window", "object", "the worst window of the run, by loss and then average, kept or not"},
+}
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// dashboardWindow is a window's figures, in milliseconds.
+type dashboardWindow struct {
+	Count    int     `json:"count"`
+	MinMs    float64 `json:"min_ms"`
+	AvgMs    float64 `json:"avg_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	SDMs     float64 `json:"sd_ms"`
+	JitterMs float64 `json:"jitter_ms"`
+}
+
+func newDashboardWindow(w *stats.Window) dashboardWindow {
+	return dashboardWindow{
+		Count:    w.Count,
+		MinMs:    stats.Milliseconds(w.Min),
+		AvgMs:    stats.Milliseconds(w.Average()),
+		MaxMs:    stats.Milliseconds(w.Max),
+		SDMs:     stats.Milliseconds(w.StdDev()),
+		JitterMs: stats.Milliseconds(w.Jitter()),
+	}
+}
+
+type dashboardLoss struct {
+	WindowPct   float64 `json:"window_pct"`
+	SmoothedPct float64 `json:"smoothed_pct"`
+	TotalPct    float64 `json:"total_pct"`
+	Sent        int     `json:"sent"`
+	Lost        int     `json:"lost"`
+}
+
+// dashboardDocument is what --serve gives at DASHBOARD_API: the run as the
+// TUI shows it, as of the last sample.
+type dashboardDocument struct {
+	RunID    string    `json:"run_id"`
+	Target   string    `json:"target"`
+	Interval string    `json:"interval"`
+	Updated  time.Time `json:"updated"`
+	Paused   bool      `json:"paused"`
+
+	LastMs    *float64             `json:"last_ms,omitempty"`
+	Totals    dashboardWindow      `json:"totals"`
+	Window    dashboardWindow      `json:"window"`
+	Loss      dashboardLoss        `json:"loss"`
+	Histogram stats.HistogramState `json:"histogram"`
+
+	Outages []stats.OutageSummary `json:"outages"`
+	Windows []stats.WindowRecord  `json:"windows"`
+	Events  []stats.Event         `json:"events"`
+
+	WorstWindow *stats.WindowRecord `json:"worst_window,omitempty"`
+}
+
+// dashboardServer serves --serve: a page that polls DASHBOARD_API, and the
+// API itself. The model is a value bubbletea copies on every update, so
+// rather than handlers reaching into it, it hands over a document of its
+// own after each sample, which they read under the mutex.
+type dashboardServer struct {
+	server  *http.Server
+	address string
+
+	mu       sync.Mutex
+	document *dashboardDocument
+}
+
+// listenDashboard starts serving on address, shutting down when ctx is done
+// so that quitting isn't held up by a browser still polling.
+func listenDashboard(ctx context.Context, address string) (*dashboardServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for --serve: %s", err)
+	}
+
+	d := &dashboardServer{address: listener.Addr().String()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.page)
+	mux.HandleFunc("GET "+DASHBOARD_API, d.stats)
+	mux.HandleFunc("GET "+HEALTHZ_PATH, ServeHealth)
+	d.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go d.server.Serve(listener)
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), DASHBOARD_SHUTDOWN_TIMEOUT)
+		defer cancel()
+		d.server.Shutdown(shutdown)
+	}()
+
+	return d, nil
+}
+
+func (d *dashboardServer) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func (d *dashboardServer) stats(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	document := d.document
+	var data []byte
+	var err error
+	if document != nil {
+		data, err = json.Marshal(document)
+	}
+	d.mu.Unlock()
+
+	switch {
+	case document == nil:
+		http.Error(w, "no stats yet", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+func (d *dashboardServer) publish(document *dashboardDocument) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.document = document
+}
+
+func (d *dashboardServer) Close() {
+	if d == nil {
+		return
+	}
+
+	d.server.Close()
+}
+
+// publishDashboard hands --serve the run as it stands. Everything in the
+// document is copied out of the model, which goes on changing after.
+func (m *Model) publishDashboard() {
+	if m.dashboard == nil {
+		return
+	}
+
+	m.dashboard.publish(m.dashboardDocument(time.Now()))
+}
+
+func (m *Model) dashboardDocument(now time.Time) *dashboardDocument {
+	s := &m.Stats
+	rolling, _, _ := s.Loss.Rolling(now)
+	sent, lost := s.Loss.Settled()
+
+	document := &dashboardDocument{
+		RunID:    s.RunID,
+		Target:   m.describeTarget(),
+		Interval: m.describeInterval(),
+		Updated:  stats.Stored(now),
+		Paused:   s.Paused != nil,
+
+		Totals: newDashboardWindow(&s.Totals),
+		Window: newDashboardWindow(&s.LastWindow),
+		Loss: dashboardLoss{
+			WindowPct:   rolling * 100,
+			SmoothedPct: s.Loss.Smoothed() * 100,
+			TotalPct:    s.Loss.Cumulative() * 100,
+			Sent:        sent,
+			Lost:        lost,
+		},
+		Histogram: stats.HistogramStateOf(&s.Histogram),
+
+		Outages: s.OutageSummaries(),
+		Windows: slices.Clone(s.Windows()),
+		Events:  slices.Clone(s.Events[max(len(s.Events)-DASHBOARD_EVENTS, 0):]),
+
+		WorstWindow: s.WorstWindow(),
+	}
+	if s.Totals.Count > 0 {
+		last := stats.Milliseconds(m.last.Duration)
+		document.LastMs = &last
+	}
+
+	return document
+}
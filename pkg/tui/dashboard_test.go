@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+func TestDashboard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := listenDashboard(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("the dashboard listens: expected no error, got %v", err)
+	}
+	defer d.Close()
+	base := "http://" + d.address
+
+	get := func(path string) (int, []byte, error) {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, body, err
+	}
+
+	if status, _, err := get(DASHBOARD_API); err != nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("the API has nothing to give before the first document: expected 503, got %q", fmt.Sprint(status, err))
+	}
+	if status, body, err := get("/"); err != nil || status != http.StatusOK || !bytes.Contains(body, []byte(`fetch("api/stats"`)) {
+		t.Fatalf("the page is served at /, polling the API: expected 200 with the page, got %q", fmt.Sprint(status, err))
+	}
+
+	m := Model{Stats: stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS), Target: target.Target{Mode: target.ICMP, Host: "192.0.2.1"}, interval: time.Second}
+	m.Stats.History = stats.NewWindowHistory(stats.DEFAULT_WINDOW_HISTORY)
+	m.dashboard = d
+
+	// Samples go on arriving while the page polls, which the race detector
+	// holds to the document being handed over rather than shared.
+	polled := make(chan error)
+	go func() {
+		for range 20 {
+			if _, _, err := get(DASHBOARD_API); err != nil {
+				polled <- err
+				return
+			}
+		}
+		polled <- nil
+	}()
+	for i := range 30 {
+		m.last = ping.Result{Seq: i + 1, Duration: time.Duration(i%5+1) * time.Millisecond}
+		m.Stats.Update(m.last.Duration)
+		m.Stats.AddEvent("note", fmt.Sprintf("sample %d", i+1))
+		m.publishDashboard()
+	}
+	if err := <-polled; err != nil {
+		t.Fatalf("the API answers while samples arrive: expected no error, got %v", err)
+	}
+
+	_, body, err := get(DASHBOARD_API)
+	var document dashboardDocument
+	if err == nil {
+		err = json.Unmarshal(body, &document)
+	}
+	if err != nil {
+		t.Fatalf("the API gives the document as JSON: expected no error, got %v", err)
+	}
+	if document.Target != "icmp 192.0.2.1" || document.Totals.Count != 30 || document.LastMs == nil || *document.LastMs != 5 || document.Histogram.Total != 30 {
+		t.Fatalf("the API gives the stats as of the last sample: expected 30 samples, last 5ms, got %q", string(body))
+	}
+	if len(document.Events) != DASHBOARD_EVENTS || document.Events[DASHBOARD_EVENTS-1].Message != "sample 30" {
+		t.Fatalf("the API gives the latest events: expected %d ending with sample 30, got %v", DASHBOARD_EVENTS, len(document.Events))
+	}
+
+	cancel()
+	deadline := time.Now().Add(DASHBOARD_SHUTDOWN_TIMEOUT + time.Second)
+	for {
+		if _, _, err := get(DASHBOARD_API); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the dashboard shuts down with the run: expected requests refused, got still serving")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,17 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+// describeTarget adds what's asked and of whom to a dns target.
+func (m Model) describeTarget() string {
+	if m.Target.Mode != target.DNS {
+		return m.Target.String()
+	}
+
+	return fmt.Sprintf("%s %s from %s", m.Target.String(), m.dnsOptions.Record, strings.Join(m.dnsOptions.Servers, ", "))
+}
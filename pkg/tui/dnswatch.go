@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// resolveAll is how --re-resolve looks the host up, replaced by the
+// selftest.
+var resolveAll = ping.ResolveAll
+
+// dnsWatch is --re-resolve: the host looked up again every so often over a
+// long run, to catch its answers changing under it, as an anycast name does
+// failing over to another site, and with follow to move probing to them.
+type dnsWatch struct {
+	every  time.Duration
+	follow bool
+	// answers are what the host last resolved to, in the order it's
+	// preferred, and failing is set while looking it up again fails.
+	answers []netip.Addr
+	failing bool
+}
+
+type answersMsg struct {
+	addrs []netip.Addr
+	err   error
+}
+
+// newDNSWatch starts from the addresses the run started out resolving to.
+func newDNSWatch(every time.Duration, follow bool, metadata *stats.RunMetadata) *dnsWatch {
+	w := &dnsWatch{every: every, follow: follow}
+	addresses := metadata.Addresses
+	if len(addresses) == 0 && metadata.Address != "" {
+		addresses = []string{metadata.Address}
+	}
+	for _, address := range addresses {
+		if addr, err := netip.ParseAddr(address); err == nil {
+			w.answers = append(w.answers, addr)
+		}
+	}
+
+	return w
+}
+
+func (m Model) checkAnswers() tea.Msg {
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := resolveAll(ctx, m.Host, m.family)
+	return answersMsg{addrs: addrs, err: err}
+}
+
+func (m Model) answersTick() tea.Cmd {
+	return tea.Tick(m.answers.every, func(time.Time) tea.Msg { return m.checkAnswers() })
+}
+
+// applyAnswers logs the host's answers changing, or failing to come, which
+// carries on with the last ones rather than ending the run. Following them
+// only moves probing once the address probed is no longer among them, so
+// that a resolver handing the same ones out in turn doesn't keep it moving.
+func (m *Model) applyAnswers(msg answersMsg) {
+	w := m.answers
+	if msg.err != nil {
+		if !w.failing {
+			w.failing = true
+			m.Stats.AddEvent("dns", fmt.Sprintf("%s, carrying on with %s", msg.err, describeAddresses(w.answers)))
+		}
+		return
+	}
+
+	recovered := w.failing
+	w.failing = false
+	if sameAddresses(w.answers, msg.addrs) {
+		if recovered {
+			m.Stats.AddEvent("dns", fmt.Sprintf("%s resolves again, to the same %s", m.Host, describeAddresses(w.answers)))
+		}
+		return
+	}
+
+	m.Stats.AddEvent("dns", fmt.Sprintf("%s now resolves to %s, was %s", m.Host, describeAddresses(msg.addrs), describeAddresses(w.answers)))
+	w.answers = msg.addrs
+	if !w.follow || m.pinger == nil || slices.Contains(msg.addrs, m.pinger.Pinned()) {
+		return
+	}
+
+	from := m.pinger.Pinned()
+	if m.pinger.Repin(msg.addrs[0]) {
+		if from.IsValid() {
+			m.Stats.AddEvent("dns", fmt.Sprintf("following %s from %s to %s", m.Host, from, msg.addrs[0]))
+		} else {
+			m.Stats.AddEvent("dns", fmt.Sprintf("following %s to %s", m.Host, msg.addrs[0]))
+		}
+	}
+}
+
+// probedAddress is the address the header gives as the one probed, which
+// is the one followed to once --follow-dns has moved.
+func (m Model) probedAddress() string {
+	if m.pinger != nil && m.answers != nil && m.answers.follow {
+		if pinned := m.pinger.Pinned(); pinned.IsValid() {
+			return pinned.String()
+		}
+	}
+	if m.Stats.Metadata == nil {
+		return ""
+	}
+
+	return m.Stats.Metadata.Address
+}
+
+// candidates are all the host resolves to, as --re-resolve last found or
+// else as it did at the start.
+func (m Model) candidates() []string {
+	if m.answers != nil && len(m.answers.answers) > 0 {
+		return AddressStrings(m.answers.answers)
+	}
+	if m.Stats.Metadata == nil {
+		return nil
+	}
+
+	return m.Stats.Metadata.Addresses
+}
+
+// sameAddresses compares answers as sets, since a resolver may rotate the
+// order it gives them in with every query.
+func sameAddresses(a []netip.Addr, b []netip.Addr) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.SortFunc(a, netip.Addr.Compare)
+	slices.SortFunc(b, netip.Addr.Compare)
+
+	return slices.Equal(a, b)
+}
+
+func AddressStrings(addrs []netip.Addr) []string {
+	strs := make([]string, len(addrs))
+	for i, addr := range addrs {
+		strs[i] = addr.String()
+	}
+
+	return strs
+}
+
+func describeAddresses(addrs []netip.Addr) string {
+	if len(addrs) == 0 {
+		return "nothing"
+	}
+
+	return strings.Join(AddressStrings(addrs), ", ")
+}
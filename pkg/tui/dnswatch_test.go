@@ -0,0 +1,114 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+// answerResolver gives every name the same answers, in the order given.
+type answerResolver []netip.Addr
+
+func (r answerResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	return r, nil
+}
+
+// TestDNSAnswers checks every address a host has is found in the
+// order it's preferred, and that --re-resolve logs the answers changing and
+// failing, following them only once the address probed is gone.
+func TestDNSAnswers(t *testing.T) {
+	v4a, v4b, v6 := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("2001:db8::1")
+	resolver := answerResolver{v6, v4a, netip.AddrFrom16(v4b.As16()), v4a}
+	addrs, err := ping.ResolveAllWith(context.Background(), resolver, "example.com", "")
+	if err != nil || !slices.Equal(addrs, []netip.Addr{v4a, v4b, v6}) {
+		t.Fatalf("every address, IPv4 first, once each: expected [192.0.2.1 192.0.2.2 2001:db8::1], got %q", fmt.Sprint(addrs, err))
+	}
+	if addr, err := ping.ResolveWith(context.Background(), resolver, "example.com", ping.IPV6); err != nil || addr != v6 {
+		t.Fatalf("the address probed is the first of the family's: expected %s, got %q", v6, fmt.Sprint(addr, err))
+	}
+
+	metadata := stats.RunMetadata{Target: "icmp example.com", Address: v4a.String(), Addresses: AddressStrings(addrs), Family: "IPv4", AddressClass: target.GLOBAL}
+	expected := "Target:   icmp example.com (192.0.2.1, also 192.0.2.2 2001:db8::1, IPv4, global)"
+	if line := metadata.Banner()[0]; line != expected {
+		t.Fatalf("the banner lists the other candidates:\nexpected:\n%s\ngot:\n%s", expected, line)
+	}
+
+	pinger := ping.NewPinger("example.com", time.Second).Pin(v4a)
+	m := Model{
+		ctx:     context.Background(),
+		Host:    "example.com",
+		Target:  target.Target{Mode: target.ICMP, Host: "example.com"},
+		Stats:   stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS),
+		tabs:    newTabSet(false),
+		pinger:  pinger,
+		answers: newDNSWatch(5*time.Minute, true, &metadata),
+	}
+	m.Stats.Metadata = &metadata
+	m.tabs.show("help")
+
+	defer func(saved func(context.Context, string, string) ([]netip.Addr, error)) { resolveAll = saved }(resolveAll)
+	answer := func(addrs []netip.Addr, err error) {
+		resolveAll = func(context.Context, string, string) ([]netip.Addr, error) { return addrs, err }
+		m.applyAnswers(m.checkAnswers().(answersMsg))
+	}
+	messages := func() []string {
+		var messages []string
+		for _, event := range m.Stats.Events {
+			if event.Kind == "dns" {
+				messages = append(messages, event.Message)
+			}
+		}
+		return messages
+	}
+
+	answer([]netip.Addr{v6, v4b, v4a}, nil)
+	answer(nil, fmt.Errorf("failed to resolve example.com: server misbehaving"))
+	answer(nil, fmt.Errorf("failed to resolve example.com: server misbehaving"))
+	answer([]netip.Addr{v4b, v4a, v6}, nil)
+	expectedEvents := []string{
+		"failed to resolve example.com: server misbehaving, carrying on with 192.0.2.1, 192.0.2.2, 2001:db8::1",
+		"example.com resolves again, to the same 192.0.2.1, 192.0.2.2, 2001:db8::1",
+	}
+	if events := messages(); !slices.Equal(events, expectedEvents) {
+		t.Fatalf("answers given in another order are no change, and failures are logged once: expected %q, got %q", strings.Join(expectedEvents, "; "), strings.Join(events, "; "))
+	}
+	if m.Err != nil || pinger.Pinned() != v4a {
+		t.Fatalf("failing to resolve carries on probing: expected %s, got %q", v4a, fmt.Sprint(pinger.Pinned(), m.Err))
+	}
+
+	answer([]netip.Addr{v4a, v6}, nil)
+	if pinger.Pinned() != v4a {
+		t.Fatalf("probing stays while its address is still an answer: expected %s, got %s", v4a, pinger.Pinned())
+	}
+	v4c := netip.MustParseAddr("192.0.2.3")
+	answer([]netip.Addr{v4c, v4b}, nil)
+	if pinger.Pinned() != v4c {
+		t.Fatalf("--follow-dns moves to the first answer once the address probed is gone: expected %s, got %s", v4c, pinger.Pinned())
+	}
+	events := messages()
+	expectedEvents = []string{
+		"example.com now resolves to 192.0.2.1, 2001:db8::1, was 192.0.2.1, 192.0.2.2, 2001:db8::1",
+		"example.com now resolves to 192.0.2.3, 192.0.2.2, was 192.0.2.1, 2001:db8::1",
+		"following example.com from 192.0.2.1 to 192.0.2.3",
+	}
+	if !slices.Equal(events[2:], expectedEvents) {
+		t.Fatalf("each change of answers is logged, and following them: expected %q, got %q", strings.Join(expectedEvents, "; "), strings.Join(events, "; "))
+	}
+
+	header := strings.SplitN(m.View(), "\n", 2)[0]
+	if !strings.HasPrefix(header, "PING: icmp example.com (192.0.2.3, also 192.0.2.2, IPv4, global)") {
+		t.Fatalf("the header shows the address followed to and the latest answers: expected (192.0.2.3, also 192.0.2.2, IPv4, global), got %q", header)
+	}
+
+	if pinger.Repin(v4c) {
+		t.Fatalf("repinning to the same address: expected no restart, got restarted")
+	}
+}
@@ -0,0 +1,96 @@
+package tui
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"ponglehub.co.uk/nettest/pkg/evidence"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	EVIDENCE_SUMMARY = "summary.json"
+	EVIDENCE_WINDOWS = "windows.csv"
+	EVIDENCE_EVENTS  = "events.jsonl"
+)
+
+// evidenceLog keeps every window of a signed run for its bundle.
+type evidenceLog struct {
+	key     ed25519.PrivateKey
+	path    string
+	windows []windowSummary
+}
+
+func newEvidenceLog(keyPath string, bundlePath string, runID string) (*evidenceLog, error) {
+	key, err := evidence.LoadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if bundlePath == "" {
+		bundlePath = "evidence-" + runID + ".zip"
+	}
+
+	return &evidenceLog{key: key, path: bundlePath}, nil
+}
+
+func evidenceWindows(windows []windowSummary) ([]byte, error) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Write([]string{"start", "end", "count", "min_ms", "max_ms", "avg_ms", "loss_window_pct", "loss_total_pct", "paused_s"})
+
+	for _, summary := range windows {
+		w.Write([]string{
+			summary.Start.UTC().Format(stats.STORED_TIME),
+			summary.End.UTC().Format(stats.STORED_TIME),
+			strconv.Itoa(summary.Count),
+			strconv.FormatFloat(summary.MinMs, 'f', 3, 64),
+			strconv.FormatFloat(summary.MaxMs, 'f', 3, 64),
+			strconv.FormatFloat(summary.AvgMs, 'f', 3, 64),
+			strconv.FormatFloat(summary.LossWindowPct, 'f', 3, 64),
+			strconv.FormatFloat(summary.LossTotalPct, 'f', 3, 64),
+			strconv.FormatFloat(summary.PausedS, 'f', 0, 64),
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write windows: %s", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// write signs the summary, every window and the event log into one
+// bundle.
+func (e *evidenceLog) write(s *stats.Stats) error {
+	summary, err := json.Marshal(stats.NewRunState(s))
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %s", err)
+	}
+
+	windows, err := evidenceWindows(e.windows)
+	if err != nil {
+		return err
+	}
+
+	var events bytes.Buffer
+	encoder := json.NewEncoder(&events)
+	for _, event := range s.Events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode events: %s", err)
+		}
+	}
+
+	files := map[string][]byte{
+		EVIDENCE_SUMMARY: summary,
+		EVIDENCE_WINDOWS: windows,
+		EVIDENCE_EVENTS:  events.Bytes(),
+	}
+
+	return evidence.Write(e.path, s.RunID, files, e.key)
+}
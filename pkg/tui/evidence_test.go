@@ -0,0 +1,153 @@
+package tui
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/evidence"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// rewriteBundle copies a bundle with change applied to each file's contents,
+// as someone editing it after signing would.
+func rewriteBundle(from string, to string, change func(name string, data []byte) []byte) error {
+	archive, err := zip.OpenReader(from)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	file, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out := zip.NewWriter(file)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		w, err := out.Create(f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(change(f.Name, data)); err != nil {
+			return err
+		}
+	}
+
+	return out.Close()
+}
+
+// TestEvidence signs a bundle and checks that it verifies as written,
+// and that changing a window, the manifest or the key it's checked against
+// each make it fail. It also checks that canonical JSON doesn't depend on key
+// order or spacing.
+func TestEvidence(t *testing.T) {
+	a, err := evidence.Canonicalize([]byte(`{"b": [1, 2.50, {"d": "<x>", "c": null}], "a": 1e3}`))
+	if err != nil {
+		t.Fatalf("canonicalise: expected no error, got %v", err)
+	}
+	b, err := evidence.Canonicalize([]byte("{\n  \"a\":1e3,\n  \"b\":[1,2.50,{\"c\":null,\"d\":\"<x>\"}]\n}\n"))
+	if err != nil {
+		t.Fatalf("canonicalise: expected no error, got %v", err)
+	}
+	if expected := `{"a":1e3,"b":[1,2.50,{"c":null,"d":"<x>"}]}`; string(a) != expected || string(b) != expected {
+		t.Fatalf("canonical JSON of reordered, respaced documents: expected %q, got %q and %q", expected, string(a), string(b))
+	}
+
+	dir := t.TempDir()
+
+	public, private, err := evidence.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: expected no error, got %v", err)
+	}
+	keyPath := filepath.Join(dir, "nettest.key")
+	if err := evidence.WriteKeys(keyPath, public, private); err != nil {
+		t.Fatalf("write keys: expected no error, got %v", err)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("stat private key: expected no error, got %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("private key permissions: expected 0600, got %v", info.Mode().Perm())
+	}
+
+	log, err := newEvidenceLog(keyPath, filepath.Join(dir, "bundle.zip"), "selftest")
+	if err != nil {
+		t.Fatalf("load key: expected no error, got %v", err)
+	}
+
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.RunID = "selftest"
+	for _, ms := range []int64{10, 12, 30, 11, 14} {
+		s.SampleIndex++
+		s.Update(time.Duration(ms) * time.Millisecond)
+	}
+	s.AddEvent("selftest", "an event to sign")
+	log.windows = append(log.windows, windowSummary{RunID: "selftest", Start: time.Now().Add(-5 * time.Second), End: time.Now(), Count: 5, MinMs: 10, MaxMs: 30, AvgMs: 15})
+
+	if err := log.write(&s); err != nil {
+		t.Fatalf("write bundle: expected no error, got %v", err)
+	}
+
+	bundle, err := evidence.Verify(log.path, public)
+	if err != nil {
+		t.Fatalf("verify an untouched bundle: expected no error, got %v", err)
+	}
+	var state stats.RunState
+	if err := json.Unmarshal(bundle.Files[EVIDENCE_SUMMARY], &state); err != nil || state.Totals.Count != 5 || len(state.Events) != 1 {
+		t.Fatalf("the signed summary: expected 5 samples and 1 event, got %q", string(bundle.Files[EVIDENCE_SUMMARY]))
+	}
+	if lines := strings.Count(string(bundle.Files[EVIDENCE_WINDOWS]), "\n"); lines != 2 {
+		t.Fatalf("the signed windows: expected a header and 1 window, got %q", string(bundle.Files[EVIDENCE_WINDOWS]))
+	}
+
+	tampered := filepath.Join(dir, "tampered.zip")
+	edits := map[string]func(name string, data []byte) []byte{
+		"a window's max changed": func(name string, data []byte) []byte {
+			if name == EVIDENCE_WINDOWS {
+				return []byte(strings.Replace(string(data), ",30.000,", ",13.000,", 1))
+			}
+			return data
+		},
+		"the manifest changed to match": func(name string, data []byte) []byte {
+			if name == evidence.MANIFEST {
+				return []byte(strings.Replace(string(data), `"run_id":"selftest"`, `"run_id":"other"`, 1))
+			}
+			return data
+		},
+	}
+	for what, edit := range edits {
+		if err := rewriteBundle(log.path, tampered, edit); err != nil {
+			t.Fatalf("rewrite bundle: expected no error, got %v", err)
+		}
+		if _, err := evidence.Verify(tampered, public); err == nil {
+			t.Fatalf("verify a bundle with %s: expected an error, got verified", what)
+		}
+	}
+
+	other, _, err := evidence.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: expected no error, got %v", err)
+	}
+	if _, err := evidence.Verify(log.path, other); err == nil {
+		t.Fatalf("verify against a different trusted key: expected an error, got verified")
+	}
+}
@@ -0,0 +1,156 @@
+package tui
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// fakeStep is one result a fakeProber replays: a reply taking rtt, or a
+// probe lost, after the given delay since the one before.
+type fakeStep struct {
+	after time.Duration
+	rtt   time.Duration
+	lost  bool
+}
+
+// fakeProber stands in for the pinger, replaying a script of results in
+// sequence and then giving up with err, or waiting to be stopped when err is
+// nil. Stepped, each result waits for step rather than its delay, so that the
+// order of everything else is the test's to choose. A pause holds its place
+// in the script, and each run carries on from where the last left off in a
+// new epoch, as the pinger's do.
+type fakeProber struct {
+	steps   []fakeStep
+	err     error
+	stepped bool
+	next    chan struct{}
+	notices chan ping.Notice
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	played  int
+	epoch   int
+}
+
+func newFakeProber(err error, steps ...fakeStep) *fakeProber {
+	return &fakeProber{steps: steps, err: err, next: make(chan struct{}), notices: make(chan ping.Notice, 1), resumed: make(chan struct{})}
+}
+
+// step releases the next result of a stepped prober, reporting false if ctx
+// was done first.
+func (f *fakeProber) step(ctx context.Context) bool {
+	select {
+	case f.next <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (f *fakeProber) Notices() <-chan ping.Notice {
+	return f.notices
+}
+
+func (f *fakeProber) Pause() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.paused = true
+}
+
+func (f *fakeProber) Resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.paused {
+		f.paused = false
+		close(f.resumed)
+		f.resumed = make(chan struct{})
+	}
+}
+
+// waitResumed blocks while paused, reporting whether ctx let it go on.
+func (f *fakeProber) waitResumed(ctx context.Context) bool {
+	for {
+		f.mu.Lock()
+		paused, resumed := f.paused, f.resumed
+		f.mu.Unlock()
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (f *fakeProber) Run(ctx context.Context) (<-chan ping.Result, <-chan error) {
+	pings := make(chan ping.Result, ping.BUFFER_SIZE)
+	errs := make(chan error, 1)
+
+	f.mu.Lock()
+	f.epoch++
+	epoch := f.epoch
+	f.mu.Unlock()
+
+	go func() {
+		defer close(pings)
+		defer close(errs)
+
+		seq := 0
+		for {
+			f.mu.Lock()
+			played := f.played
+			f.mu.Unlock()
+			if played == len(f.steps) {
+				if f.err == nil {
+					<-ctx.Done()
+				}
+				errs <- f.err
+				return
+			}
+
+			step := f.steps[played]
+			if f.stepped {
+				select {
+				case <-f.next:
+				case <-ctx.Done():
+					return
+				}
+			} else {
+				select {
+				case <-time.After(step.after):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if !f.waitResumed(ctx) {
+				return
+			}
+
+			f.mu.Lock()
+			f.played++
+			f.mu.Unlock()
+			seq++
+			result := ping.Result{Seq: seq, Epoch: epoch, Duration: step.rtt}
+			if step.lost {
+				result = ping.Result{Seq: seq, Epoch: epoch, Lost: true, Reason: ping.LOSS_TIMEOUT}
+			}
+
+			select {
+			case pings <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return pings, errs
+}
@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+const (
+	// FORWARD_SCHEMA is the version of ForwardBatch, checked by the collector
+	// like STATS_SCHEMA is by the aggregate command.
+	FORWARD_SCHEMA = 1
+	FORWARD_PATH   = "/ingest"
+	// FORWARD_MAX_SAMPLES is how many samples a batch carries at most, with
+	// any more counted as dropped rather than growing it without limit.
+	FORWARD_MAX_SAMPLES = 4096
+)
+
+var FORWARD_COLUMNS = []ExportColumn{
+	{"schema", "int", "version of this batch, which the collector checks"},
+	{"source", "string", "the instance's site label, or otherwise its host name"},
+	{"stats", "object", "the run's stats, as --stats-listen serves them"},
+	{"samples", "array", "with --forward-samples, each sample and pause record since the last batch, as in the --results file"},
+	{"dropped_samples", "int", "samples left out for going over the most a batch carries"},
+}
+
+// ForwardBatch is what --forward posts to a collector after every window:
+// the stats as --stats-listen serves them, then with --forward-samples each
+// sample since the batch before.
+type ForwardBatch struct {
+	Schema  int                  `json:"schema"`
+	Source  string               `json:"source"`
+	Stats   StatsDocument        `json:"stats"`
+	Samples []stats.ResultSample `json:"samples,omitempty"`
+	Dropped int                  `json:"dropped_samples,omitempty"`
+}
+
+// forwarder batches the run up for a collector. Batches are queued and
+// spooled by a webhook sender, so that a collector that's down only delays
+// them.
+type forwarder struct {
+	collector string
+	source    string
+	Sender    *webhook.Sender
+	samples   bool
+
+	batch   []stats.ResultSample
+	lost    []lostProbe
+	marked  int
+	dropped int
+	// droppedRun is dropped over the whole run, for the diagnostics tab.
+	droppedRun int64
+}
+
+// NewForwarder posts to address, taken as a collector URL with /ingest
+// added to a bare address, under the name source.
+func NewForwarder(address string, secret []byte, spool string, source string, samples bool) (*forwarder, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid --forward %q, expected a collector address such as collector:9400", address)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = FORWARD_PATH
+	}
+
+	if err := CheckSource(source); err != nil {
+		return nil, err
+	}
+
+	if spool == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find a forwarding spool directory, set --forward-spool: %s", err)
+		}
+		spool = filepath.Join(dir, "network-test", "forward-spool")
+	}
+
+	return &forwarder{collector: u.Host, source: source, Sender: webhook.NewSender(u.String(), secret, spool), samples: samples}, nil
+}
+
+func (f *forwarder) Observe(seq int, lost bool) {
+	if f.samples && lost {
+		f.lost = append(f.lost, lostProbe{seq: seq, at: time.Now()})
+	}
+}
+
+func (f *forwarder) add(sample stats.ResultSample) {
+	if len(f.batch) >= FORWARD_MAX_SAMPLES {
+		f.dropped++
+		f.droppedRun++
+		return
+	}
+
+	f.batch = append(f.batch, sample)
+}
+
+// forwardSamples keeps each probe's fate, and each pause, for the next
+// batch, as recordResults does for the results file.
+func (m *Model) forwardSamples(result *ping.Result) {
+	f := m.Forward
+	if f == nil || !f.samples {
+		return
+	}
+
+	for _, probe := range f.lost {
+		f.add(stats.ResultSample{Time: probe.at, Host: m.Host, Lost: true})
+	}
+	f.lost = f.lost[:0]
+
+	for _, mark := range m.Stats.Marks[f.marked:] {
+		f.add(pauseSample(m.Host, mark))
+	}
+	f.marked = len(m.Stats.Marks)
+
+	if result != nil {
+		rtt := float64(result.Duration.Microseconds()) / 1000
+		f.add(stats.ResultSample{Time: time.Now(), Host: m.Host, RTTMs: &rtt})
+	}
+}
+
+// forwardWindow queues the batch for the window just completed.
+func (m *Model) forwardWindow(window *windowSummary) {
+	f := m.Forward
+	if f == nil {
+		return
+	}
+
+	batch := ForwardBatch{Schema: FORWARD_SCHEMA, Source: f.source, Stats: m.statsDocument(window), Samples: f.batch, Dropped: f.dropped}
+	f.batch, f.dropped = nil, 0
+	if err := f.Sender.Send(batch); err != nil {
+		m.Stats.AddEvent("forward", err.Error())
+	}
+}
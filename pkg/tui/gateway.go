@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// gatewayPairing matches target samples to gateway samples from the same
+// interval-sized time bucket, since the two probers aren't synchronised and
+// pairing by arrival order would drift.
+type gatewayPairing struct {
+	interval time.Duration
+	buckets  map[int64]time.Duration
+	clamped  int
+}
+
+func newGatewayPairing(interval time.Duration) *gatewayPairing {
+	return &gatewayPairing{
+		interval: interval,
+		buckets:  map[int64]time.Duration{},
+	}
+}
+
+func (g *gatewayPairing) bucket(at time.Time) int64 {
+	return at.UnixNano() / int64(g.interval)
+}
+
+func (g *gatewayPairing) AddGateway(at time.Time, rtt time.Duration) {
+	b := g.bucket(at)
+	g.buckets[b] = rtt
+
+	for old := range g.buckets {
+		if old < b-10 {
+			delete(g.buckets, old)
+		}
+	}
+}
+
+// Upstream subtracts the gateway RTT measured in the same or the previous
+// bucket. Noise can make the difference negative, which clamps to zero.
+func (g *gatewayPairing) Upstream(at time.Time, rtt time.Duration) (time.Duration, bool) {
+	b := g.bucket(at)
+
+	gateway, ok := g.buckets[b]
+	if !ok {
+		gateway, ok = g.buckets[b-1]
+	}
+	if !ok {
+		return 0, false
+	}
+
+	if rtt < gateway {
+		g.clamped++
+		return 0, true
+	}
+
+	return rtt - gateway, true
+}
+
+type gatewayStarted struct {
+	address string
+	pings   <-chan ping.Result
+}
+
+type gatewayResult ping.Result
+
+type gatewayFailed struct {
+	err error
+}
+
+func (m Model) startGateway() tea.Msg {
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	address, err := route.Gateway(ctx)
+	cancel()
+	if err != nil {
+		return gatewayFailed{err: err}
+	}
+
+	pings, _ := ping.NewPinger(address, m.interval).Native(m.native).Run(m.ctx)
+	return gatewayStarted{address: address, pings: pings}
+}
+
+func (m Model) tickGateway() tea.Msg {
+	select {
+	case result, ok := <-m.gatewayPings:
+		if !ok {
+			return nil
+		}
+		return gatewayResult(result)
+	case <-m.ctx.Done():
+		return nil
+	}
+}
+
+func (m Model) printGateway() string {
+	if m.gatewayAddress == "" {
+		if m.gatewayErr != nil {
+			return m.theme.Warn.Render(fmt.Sprintf("Gateway unavailable: %s", m.gatewayErr))
+		}
+		return "Gateway - looking up the default gateway..."
+	}
+
+	line := fmt.Sprintf("%-16s - %s\n%-16s - %s", "Gateway "+m.gatewayAddress, stats.RenderWindow(&m.gatewayStats.Totals, nil, nil), "Upstream only", stats.RenderWindow(&m.upstreamStats.Totals, nil, nil))
+	if m.pairing.clamped > 0 {
+		line += fmt.Sprintf(" (%d clamped to 0)", m.pairing.clamped)
+	}
+
+	return line
+}
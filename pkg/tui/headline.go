@@ -0,0 +1,14 @@
+package tui
+
+import (
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// headlineName is the headline as it's recorded, the mean when unset.
+func headlineName(headline string) string {
+	if headline == "" {
+		return stats.HEADLINE_MEAN
+	}
+
+	return headline
+}
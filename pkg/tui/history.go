@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/history"
+)
+
+func (m Model) historyRun(start time.Time, end time.Time) history.Run {
+	return history.Run{
+		RunID:   m.Stats.RunID,
+		Host:    m.Host,
+		Mode:    m.Target.Mode,
+		Start:   start,
+		End:     end,
+		Count:   m.Stats.Totals.Count,
+		MinMs:   history.Milliseconds(m.Stats.Totals.Min),
+		AvgMs:   history.Milliseconds(m.Stats.Totals.Average()),
+		MaxMs:   history.Milliseconds(m.Stats.Totals.Max),
+		P95Ms:   history.Milliseconds(m.Stats.RunP95()),
+		LossPct: m.Stats.Loss.Cumulative() * 100,
+	}
+}
+
+func (m Model) printHistory() string {
+	if m.history == nil || m.history.Runs == 0 {
+		return ""
+	}
+
+	return "History: " + m.history.String()
+}
@@ -0,0 +1,247 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/settings"
+)
+
+const (
+	// RESERVED_KEY always quits, so that a bad config can't leave the TUI
+	// with no way out.
+	RESERVED_KEY = "ctrl+c"
+
+	// Scopes an action applies in: KEYS_ANYWHERE on every screen, KEYS_MAIN
+	// on every tab of the main display, KEYS_CATALOG on the catalogue, and
+	// otherwise the tab named.
+	KEYS_ANYWHERE = ""
+	KEYS_MAIN     = "main"
+	KEYS_CATALOG  = "catalog"
+
+	SHOW_TAB_ACTION = "show-"
+)
+
+// keyAction is something a key can be bound to in the TUI.
+type keyAction struct {
+	name        string
+	scope       string
+	description string
+	defaults    []string
+}
+
+var KEY_ACTIONS = append(append([]keyAction{
+	{"quit", KEYS_ANYWHERE, "quit", []string{"q", "esc"}},
+	{"ack", KEYS_MAIN, "acknowledge the open incident", []string{"a"}},
+	{"mark-change", KEYS_MAIN, "mark a change, to time the recovery from it", []string{"t"}},
+	{"pause", KEYS_MAIN, "pause probing, which any key resumes", []string{"p", " "}},
+	{"reset", KEYS_MAIN, "start the figures over, probing carrying on", []string{"r"}},
+	{"next-tab", KEYS_MAIN, "next tab", []string{"tab"}},
+	{"previous-tab", KEYS_MAIN, "previous tab", []string{"shift+tab"}},
+}, showTabActions()...), []keyAction{
+	{"waterfall", "summary", "request waterfall: last request or window average", []string{"w"}},
+	{"dismiss-banner", "summary", "dismiss the banner", []string{"enter"}},
+	{"orientation", "histogram", "bars or columns", []string{"v"}},
+	{"scale", "sparkline", "scale from zero or from the fastest sample", []string{"z"}},
+	{"scroll-up", "events", "scroll back", []string{"up", "k"}},
+	{"scroll-down", "events", "scroll forward", []string{"down", "j"}},
+	{"page-up", "events", "scroll back a page", []string{"pgup"}},
+	{"page-down", "events", "scroll forward a page", []string{"pgdown"}},
+	{"oldest", "events", "scroll to the oldest event", []string{"home"}},
+	{"newest", "events", "scroll to the newest event", []string{"end"}},
+	{"filter", "events", "show one kind of event at a time", []string{"f"}},
+	{"outage-back", "outages", "scroll back", []string{"up", "k"}},
+	{"outage-forward", "outages", "scroll forward", []string{"down", "j"}},
+	{"outage-oldest", "outages", "scroll to the oldest outage", []string{"home"}},
+	{"outage-newest", "outages", "scroll to the newest outage", []string{"end"}},
+	{"window-back", "windows", "scroll back", []string{"up", "k"}},
+	{"window-forward", "windows", "scroll forward", []string{"down", "j"}},
+	{"window-oldest", "windows", "scroll to the oldest window", []string{"home"}},
+	{"window-newest", "windows", "scroll to the newest window", []string{"end"}},
+	{"sort", KEYS_CATALOG, "change the order endpoints are listed in", []string{"s"}},
+	{"collapse", KEYS_CATALOG, "collapse or expand the groups", []string{"g"}},
+}...)
+
+// showTabActions is an action for each tab, bound by default to its number.
+func showTabActions() []keyAction {
+	var actions []keyAction
+	for i, t := range newTabSet(false).tabs {
+		actions = append(actions, keyAction{SHOW_TAB_ACTION + t.name(), KEYS_MAIN, "show the " + t.name() + " tab", []string{fmt.Sprint(i + 1)}})
+	}
+
+	return actions
+}
+
+// KEY_NAMES are the keys with names, such as enter, ctrl+q or f2, rather
+// than a character.
+var KEY_NAMES = func() []string {
+	var names []string
+	for k := tea.KeyType(-256); k < 256; k++ {
+		if name := k.String(); name != "" && utf8.RuneCountInString(name) > 1 {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}()
+
+func findKeyAction(name string) (keyAction, bool) {
+	i := slices.IndexFunc(KEY_ACTIONS, func(a keyAction) bool { return a.name == name })
+	if i < 0 {
+		return keyAction{}, false
+	}
+
+	return KEY_ACTIONS[i], true
+}
+
+// overlaps is whether a and b can be triggered on the same screen, when
+// they can't share a key.
+func (a keyAction) overlaps(b keyAction) bool {
+	tab := func(scope string) bool { return scope != KEYS_ANYWHERE && scope != KEYS_MAIN && scope != KEYS_CATALOG }
+
+	switch {
+	case a.scope == b.scope, a.scope == KEYS_ANYWHERE, b.scope == KEYS_ANYWHERE:
+		return true
+	case a.scope == KEYS_MAIN:
+		return tab(b.scope)
+	case b.scope == KEYS_MAIN:
+		return tab(a.scope)
+	}
+
+	return false
+}
+
+// KeyMap is the keys bound to each action the config file rebinds. Actions
+// it doesn't name keep their defaults, so the zero KeyMap is the defaults.
+type KeyMap map[string][]string
+
+// NewKeyMap checks the keys section of the config file: every action has
+// to be one there is, every key one the terminal can send, and no key can
+// trigger two actions on the same screen.
+func NewKeyMap(keys map[string]settings.KeyList) (KeyMap, error) {
+	k := KeyMap{}
+	for name, list := range keys {
+		if _, ok := findKeyAction(name); !ok {
+			names := make([]string, len(KEY_ACTIONS))
+			for i, a := range KEY_ACTIONS {
+				names[i] = a.name
+			}
+			return nil, fmt.Errorf("unknown action %q in the keys of the config file, expected one of: %s", name, strings.Join(names, ", "))
+		}
+
+		for _, key := range list {
+			if key == RESERVED_KEY {
+				return nil, fmt.Errorf("%s can't be bound to %s, it's reserved for quitting", RESERVED_KEY, name)
+			}
+			if !validKey(key) {
+				return nil, fmt.Errorf("invalid key %q for %s, expected a single character or a key name such as ctrl+q, f2 or pgup", key, name)
+			}
+		}
+		k[name] = slices.Clone(list)
+	}
+
+	for i, a := range KEY_ACTIONS {
+		for _, b := range KEY_ACTIONS[i+1:] {
+			if !a.overlaps(b) {
+				continue
+			}
+			for _, key := range k.bound(a.name) {
+				if slices.Contains(k.bound(b.name), key) {
+					return nil, fmt.Errorf("%s is bound to both %s and %s in the keys of the config file", key, a.name, b.name)
+				}
+			}
+		}
+	}
+
+	return k, nil
+}
+
+// validKey is whether key is one bubbletea can report: a character or a
+// key name, either with alt+ in front.
+func validKey(key string) bool {
+	key = strings.TrimPrefix(key, "alt+")
+	return utf8.RuneCountInString(key) == 1 || slices.Contains(KEY_NAMES, key)
+}
+
+func (k KeyMap) bound(action string) []string {
+	if keys, ok := k[action]; ok {
+		return keys
+	}
+
+	a, _ := findKeyAction(action)
+	return a.defaults
+}
+
+// Action is what key does in scope, or nothing when it's bound to nothing
+// there.
+func (k KeyMap) Action(scope string, key string) string {
+	for _, a := range KEY_ACTIONS {
+		if (a.scope == scope || a.scope == KEYS_ANYWHERE) && slices.Contains(k.bound(a.name), key) {
+			return a.name
+		}
+	}
+
+	return ""
+}
+
+// Label is how an action's keys are shown in the help and footers.
+func (k KeyMap) Label(action string) string {
+	keys := slices.Clone(k.bound(action))
+	if len(keys) == 0 {
+		return "unbound"
+	}
+	for i, key := range keys {
+		if key == " " {
+			keys[i] = "space"
+		}
+	}
+
+	return strings.Join(keys, "/")
+}
+
+// help is a line for each action in scope, its keys then what it does.
+func (k KeyMap) help(scope string) []string {
+	var lines []string
+	for _, a := range KEY_ACTIONS {
+		if a.scope == scope && !strings.HasPrefix(a.name, SHOW_TAB_ACTION) {
+			lines = append(lines, k.Label(a.name)+"  "+a.description)
+		}
+	}
+
+	return lines
+}
+
+// tabsLabel is the keys that show each tab: 1-9 as they are by default, or
+// otherwise each tab's keys in turn.
+func (k KeyMap) tabsLabel(tabs []tab) string {
+	labels := make([]string, len(tabs))
+	numbered := true
+	for i, t := range tabs {
+		labels[i] = k.Label(SHOW_TAB_ACTION + t.name())
+		numbered = numbered && labels[i] == fmt.Sprint(i+1)
+	}
+	if numbered {
+		return fmt.Sprintf("1-%d", len(tabs))
+	}
+
+	return strings.Join(labels, ", ")
+}
+
+// Show is the config file as the config command prints it: the keys
+// section with every action and the keys it ends up bound to, in the order
+// the help lists them.
+// Each list is written quoted, as keys such as ? and space would otherwise
+// read as something else.
+func (k KeyMap) Show() string {
+	lines := []string{"keys:"}
+	for _, a := range KEY_ACTIONS {
+		keys, _ := json.Marshal(append([]string{}, k.bound(a.name)...))
+		lines = append(lines, fmt.Sprintf("  %s: %s", a.name, strings.ReplaceAll(string(keys), `","`, `", "`)))
+	}
+
+	return strings.Join(lines, "\n")
+}
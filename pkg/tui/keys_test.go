@@ -0,0 +1,96 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+	"ponglehub.co.uk/nettest/pkg/settings"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+func TestKeys(t *testing.T) {
+	invalid := []struct {
+		keys     map[string]settings.KeyList
+		expected string
+	}{
+		{map[string]settings.KeyList{"quit": {"f"}}, "f is bound to both quit and filter in the keys of the config file"},
+		{map[string]settings.KeyList{"next-tab": {"v"}}, "v is bound to both next-tab and orientation in the keys of the config file"},
+		{map[string]settings.KeyList{"pause": {"ctrl+c"}}, "ctrl+c can't be bound to pause, it's reserved for quitting"},
+		{map[string]settings.KeyList{"quit": {"ctlr+q"}}, `invalid key "ctlr+q" for quit, expected a single character or a key name such as ctrl+q, f2 or pgup`},
+		{map[string]settings.KeyList{"qiut": {"x"}}, `unknown action "qiut" in the keys of the config file, expected one of: quit, ack,`},
+	}
+	for _, c := range invalid {
+		_, err := NewKeyMap(c.keys)
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("%v is refused: expected %q, got %v", c.keys, c.expected, err)
+		}
+	}
+
+	if _, err := NewKeyMap(map[string]settings.KeyList{"sort": {"p"}, "waterfall": {"f"}}); err != nil {
+		t.Fatalf("keys can be shared by actions never on the same screen: expected no error, got %v", err)
+	}
+
+	var file settings.File
+	if err := yaml.Unmarshal([]byte("keys:\n  quit: ctrl+q\n  pause: [P, alt+p]\n  show-summary: F\n  filter: []\n"), &file); err != nil {
+		t.Fatalf("a key or a list of keys parses: expected no error, got %v", err)
+	}
+	keys, err := NewKeyMap(file.Keys)
+	if err != nil {
+		t.Fatalf("the rebound keys are accepted: expected no error, got %v", err)
+	}
+
+	m := Model{Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS), tabs: newTabSet(false), keys: keys}
+	m.Stats.AddEvent("loss", "event")
+	press := func(key tea.KeyMsg) tea.Cmd {
+		updated, cmd := m.Update(key)
+		m = updated.(Model)
+		return cmd
+	}
+	runes := func(key string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)} }
+
+	press(runes("5"))
+	press(runes("f"))
+	if events := m.tabs.tabs[4].(*eventsTab); events.filter != "" {
+		t.Fatalf("an action bound to nothing does nothing: expected no filter, got %q", events.filter)
+	}
+	press(runes("F"))
+	if m.tabs.current().name() != "summary" {
+		t.Fatalf("a rebound key shows its tab: expected summary, got %q", m.tabs.current().name())
+	}
+	if cmd := press(runes("q")); cmd != nil {
+		t.Fatalf("a key rebound away from quit no longer quits: expected no command, got a command")
+	}
+	if cmd := press(tea.KeyMsg{Type: tea.KeyCtrlQ}); cmd == nil || cmd() != tea.Quit() {
+		t.Fatalf("the key rebound to quit quits: expected tea.Quit, got no quit")
+	}
+	if cmd := press(tea.KeyMsg{Type: tea.KeyCtrlC}); cmd == nil || cmd() != tea.Quit() {
+		t.Fatalf("ctrl+c always quits: expected tea.Quit, got no quit")
+	}
+
+	m.tabs.show("help")
+	help := strings.Join(m.tabs.current().view(m), "\n")
+	for _, line := range []string{"F, 2, 3, 4, 5, 6, 7, 8, 9  switch tab", "P/alt+p  pause probing, which any key resumes", "ctrl+q  quit", "unbound  show one kind of event at a time"} {
+		if !strings.Contains(help, line) {
+			t.Fatalf("the help shows the keys bound: expected %q, got %q", line, help)
+		}
+	}
+	if bar := m.tabs.bar(m.theme, m.keys); !strings.Contains(bar, " F summary ") || !strings.Contains(bar, " 2 histogram ") {
+		t.Fatalf("the tab bar labels tabs with their keys: expected F summary, 2 histogram, got %q", bar)
+	}
+	if help := strings.Join(m.tabs.current().view(Model{tabs: m.tabs}), "\n"); !strings.Contains(help, "1-9  switch tab") || !strings.Contains(help, "q/esc  quit") {
+		t.Fatalf("the defaults are shown as before: expected 1-9  switch tab, q/esc  quit, got %q", help)
+	}
+
+	shown := keys.Show()
+	var reread settings.File
+	if err := yaml.Unmarshal([]byte(shown), &reread); err != nil || len(reread.Keys) != len(KEY_ACTIONS) {
+		t.Fatalf("config show prints every action as a config file: expected %d actions, got %q", len(KEY_ACTIONS), shown)
+	}
+	if again, err := NewKeyMap(reread.Keys); err != nil || again.Show() != shown {
+		t.Fatalf("what config show prints reads back the same: expected %q, got %q", shown, fmt.Sprint(again.Show(), err))
+	}
+}
@@ -0,0 +1,78 @@
+package tui
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// lowPowerMinute plays a minute of probing once a second through the model
+// as bubbletea would deliver it, saving state to state where the mode does,
+// and counts the wakeups it took: the renderer's frames and each message
+// from the model's own timers.
+func lowPowerMinute(lowPower bool, state string) (stats.Stats, int) {
+	start := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC)
+	now := start
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+
+	m := NewModel(nil, s)
+	m.lowPower, m.state = lowPower, state
+	fps, checks := DEFAULT_FPS, ROUTE_CHECK_INTERVAL
+	if lowPower {
+		fps, checks = LOW_POWER_FPS, LOW_POWER_ROUTE_CHECK_INTERVAL
+	}
+
+	wakeups := 0
+	wake := func(msg tea.Msg) {
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+		m.View()
+		wakeups++
+	}
+	for second := range 60 {
+		now = start.Add(time.Duration(second) * time.Second)
+		wakeups += fps
+		wake(ping.Result{Seq: second, Epoch: 1, Duration: time.Duration(10+second%7) * time.Millisecond, At: now})
+		wake(LossMsg{})
+		if second%5 == 0 {
+			wake(windowMsg{})
+		}
+		if time.Duration(second)*time.Second%checks == 0 {
+			wake(routeMsg{})
+		}
+	}
+
+	return m.Stats, wakeups
+}
+
+// BenchmarkLowPower compares a minute of the normal display with one under
+// --low-power, reporting the wakeups and, per minute, the allocations, and
+// checks the figures come out the same either way.
+func BenchmarkLowPower(b *testing.B) {
+	state := filepath.Join(b.TempDir(), "state.json")
+	normal, _ := lowPowerMinute(false, state)
+	low, _ := lowPowerMinute(true, state)
+	if normal.Totals != low.Totals || normal.Histogram.Total() != low.Histogram.Total() || len(normal.Windows()) != len(low.Windows()) {
+		b.Fatalf("low power measures the same: expected %s, got %s", normal.TotalsString(), low.TotalsString())
+	}
+
+	for _, mode := range []struct {
+		name     string
+		lowPower bool
+	}{{"normal", false}, {"low-power", true}} {
+		b.Run(mode.name, func(b *testing.B) {
+			b.ReportAllocs()
+			wakeups := 0
+			for range b.N {
+				_, wakeups = lowPowerMinute(mode.lowPower, state)
+			}
+			b.ReportMetric(float64(wakeups), "wakeups/min")
+		})
+	}
+}
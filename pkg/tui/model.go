@@ -0,0 +1,1367 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/control"
+	"ponglehub.co.uk/nettest/pkg/enrich"
+	"ponglehub.co.uk/nettest/pkg/history"
+	"ponglehub.co.uk/nettest/pkg/ifstat"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/probe"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+func printSlowest(times stats.TimeFormat, label string, slowest []stats.Slow) string {
+	var parts []string
+	for _, slow := range slowest[:min(3, len(slowest))] {
+		parts = append(parts, fmt.Sprintf("%s at %s (seq %d)", stats.FormatLatency(slow.RTT), times.Clock(slow.At), slow.Seq))
+	}
+
+	return fmt.Sprintf("%-16s - %s", label, strings.Join(parts, ", "))
+}
+
+// Config is how a run is set up, from the command line or a profile.
+type Config struct {
+	Target    target.Target
+	Host      string
+	Interval  time.Duration
+	Window    int64
+	RunID     string
+	StatePath string
+	Resume    bool
+	SLO       *stats.SLO
+	Call      *stats.CallEstimator
+	Outages   int
+	Sparkline string
+	Theme     theme.Theme
+	Expect    time.Duration
+	Headline  string
+	Baseline  time.Duration
+	Counters  bool
+	RateLimit bool
+	HalfLife  time.Duration
+	TopN      int
+	Enrich    bool
+	Daily     *dailyReset
+
+	ResolveEach   bool
+	ReResolve     time.Duration
+	FollowDNS     bool
+	WithGateway   bool
+	LowPower      bool
+	NoFailover    bool
+	MaxRestarts   int
+	Native        bool
+	Family        string
+	MaxInFlight   int
+	Size          int
+	DontFragment  bool
+	Binding       ping.Binding
+	ReackAfter    time.Duration
+	ControlSocket string
+	ForceTUI      bool
+	Output        string
+	HistWidth     int
+	HistVertical  bool
+	Keys          KeyMap
+	WideCSV       string
+	StatusFD      string
+	StatsListen   string
+	Serve         string
+	MemoryBudget  int
+	Count         int
+	Duration      time.Duration
+	Exit          stats.ExitThresholds
+	ResultsPath   string
+	ResultsFormat string
+	ResultsAppend bool
+	SignKey       string
+	BundlePath    string
+	RecoverAfter  int
+	WorstMinutes  int
+	Levels        stats.Levels
+	WindowHistory int
+	AlertCmd      string
+	Bell          bool
+	PauseMetered  bool
+
+	HTTPOptions ping.HTTPOptions
+	DNSOptions  ping.DNSOptions
+	TimeFormat  stats.TimeFormat
+	Reference   *stats.ReferenceProfile
+	Burst       *stats.BurstControl
+	Thresholds  []time.Duration
+	AutoBuckets bool
+
+	Webhook *webhook.Sender
+	Forward *forwarder
+	Labels  map[string]string
+
+	HistoryPath   string
+	CheckpointDir string
+	LossAlerts    stats.LossCriteria
+
+	// RecordPath is --record-to, and replay set when playing a recording back
+	// instead of probing.
+	RecordPath string
+	Replay     *ReplayProber
+}
+
+// Model is the display of a run, probing from Init until the run ends or
+// it's quit.
+type Model struct {
+	ctx      context.Context
+	Target   target.Target
+	Host     string
+	interval time.Duration
+	window   int64
+	state    string
+	theme    theme.Theme
+	enrich   bool
+	daily    *dailyReset
+	dnsStats *stats.Stats
+
+	lowPower    bool
+	failover    bool
+	native      bool
+	family      string
+	maxInFlight int
+	httpOptions ping.HTTPOptions
+	dnsOptions  ping.DNSOptions
+	// size is the icmp payload, zero for the system ping's default.
+	size         int
+	dontFragment bool
+	binding      ping.Binding
+
+	histWidth  int
+	tabs       *tabSet
+	keys       KeyMap
+	reackAfter time.Duration
+	webhook    *webhook.Sender
+	alerts     *alertHook
+	Labels     map[string]string
+	counters   *ifstat.Sampler
+	history    *history.Baseline
+	crash      *crashGuard
+	wide       *wideExport
+	status     *statusFeed
+	attached   *attachHub
+	follow     *Follower
+	statsAPI   *StatsServer
+	dashboard  *dashboardServer
+	Forward    *forwarder
+	self       *selfMetrics
+	limit      *runLimit
+	results    *resultsFile
+	evidence   *evidenceLog
+	abandoned  []checkpoint
+
+	pairing        *gatewayPairing
+	gatewayAddress string
+	gatewayErr     error
+	gatewayPings   <-chan ping.Result
+	gatewayStats   *stats.Stats
+	upstreamStats  *stats.Stats
+
+	control      chan control.Command
+	received     bool
+	graceExpired bool
+	last         ping.Result
+	Err          error
+
+	bannerDismissed bool
+	width           int
+	rows            int
+	phases          phaseWindow
+
+	// pauseOverride is set when probing was resumed by hand over an
+	// automatic pause, and holds until the network changes.
+	pauseMetered  bool
+	pauseOverride bool
+	network       string
+	// answers is set under --re-resolve.
+	answers *dnsWatch
+	// recording is set under --record-to, and replay when playing one back.
+	recording *recordingFile
+	Replay    *ReplayProber
+
+	// prober is what's run for the results, pinger the same when it's the
+	// real thing, for the figures only it keeps.
+	prober probe.Prober
+	pinger *ping.Pinger
+	pings  <-chan ping.Result
+	errs   <-chan error
+	// restart is set while waiting to run the pinger again after it gave
+	// up, retryDelay being how long it was left for.
+	restart    *pingerRestart
+	retryDelay time.Duration
+	// restarts are those of the prober since the last reply, past
+	// MaxRestarts of which the run gives up.
+	restarts    int
+	maxRestarts int
+	Stats       stats.Stats
+}
+
+// NewModel shows the results of prober, counted into s, with the display
+// otherwise as it is without flags, for a program of its own to run. The
+// run command sets up the rest from its flags.
+func NewModel(prober probe.Prober, s stats.Stats) Model {
+	return Model{
+		ctx:      context.Background(),
+		interval: s.Interval,
+		window:   int64(s.WindowSize / time.Second),
+		tabs:     newTabSet(false),
+		prober:   prober,
+		Stats:    s,
+	}
+}
+
+type initParams struct {
+	pings <-chan ping.Result
+	errs  <-chan error
+}
+
+func (m Model) tick() tea.Msg {
+	if m.follow != nil {
+		return m.follow.next(m.ctx)
+	}
+
+	select {
+	// Why the prober gave up is only taken once the results before it are,
+	// when pings is closed.
+	case result, ok := <-m.pings:
+		if !ok {
+			return pingerExited{<-m.errs}
+		}
+		return result
+	case notice := <-m.prober.Notices():
+		return notice
+	case <-m.ctx.Done():
+		return tea.Quit
+	}
+}
+
+// newPinger probes the target with its mode's backend.
+func (m Model) newPinger() *ping.Pinger {
+	pinger := ping.NewPinger(m.Host, m.interval).ResolveEach(m.dnsStats != nil).Failover(m.failover).Native(m.native).Family(m.family).Bind(m.binding)
+	if m.Stats.Burst != nil {
+		pinger.Burst(m.Stats.Burst.Interval)
+	}
+	pinger.MaxInFlight(m.maxInFlight).Size(m.size).DontFragment(m.dontFragment)
+	switch m.Target.Mode {
+	case target.TCP:
+		pinger.TCP(m.Target.Port)
+	case target.UDP:
+		pinger.UDP(m.Target.Port)
+	case target.HTTP:
+		pinger.HTTP(m.httpOptions)
+	case target.DNS:
+		pinger.DNS(m.dnsOptions)
+	}
+
+	return pinger
+}
+
+// startProbing runs the prober, paused first if the run is, for the results
+// the display ticks over.
+func (m Model) startProbing() tea.Cmd {
+	if m.Stats.Paused != nil {
+		m.prober.Pause()
+	}
+	pings, errs := m.prober.Run(m.ctx)
+
+	return func() tea.Msg {
+		return initParams{pings: pings, errs: errs}
+	}
+}
+
+func (m Model) Init() tea.Cmd {
+	if m.follow != nil {
+		return tea.Batch(m.tick, m.lossTick())
+	}
+
+	cmds := []tea.Cmd{m.startProbing(), m.waitControl}
+	// The route taken now says nothing of the one a recording was made over.
+	if m.Replay == nil {
+		cmds = append(cmds, m.checkRoute)
+	}
+	if m.pauseMetered {
+		cmds = append(cmds, m.networkTick())
+	}
+	if m.answers != nil {
+		cmds = append(cmds, m.answersTick())
+	}
+	if m.pairing != nil {
+		cmds = append(cmds, m.startGateway)
+	}
+	cmds = append(cmds, tea.Tick(m.startupGrace(), func(time.Time) tea.Msg { return graceMsg{} }), m.lossTick(), m.windowTick(), m.limitTick())
+	if m.enrich {
+		cmds = append(cmds, m.lookup)
+	}
+
+	return tea.Batch(cmds...)
+}
+
+const (
+	ROUTE_CHECK_INTERVAL           = 30 * time.Second
+	LOW_POWER_ROUTE_CHECK_INTERVAL = 5 * time.Minute
+	// DEFAULT_FPS is how often bubbletea's renderer wakes to redraw unless
+	// told otherwise, and LOW_POWER_FPS the slowest it allows.
+	DEFAULT_FPS   = 60
+	LOW_POWER_FPS = 1
+)
+
+type graceMsg struct{}
+
+type LossMsg struct{}
+
+// lossTick settles overdue probes even when nothing is arriving, which is
+// exactly when it matters.
+func (m Model) lossTick() tea.Cmd {
+	return tea.Tick(m.Stats.ProbeInterval(), func(time.Time) tea.Msg { return LossMsg{} })
+}
+
+func (m Model) startupGrace() time.Duration {
+	return max(5*time.Second, 3*m.interval)
+}
+
+type routeMsg struct {
+	iface string
+}
+
+func (m Model) checkRoute() tea.Msg {
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+
+	addr, err := ping.Resolve(ctx, m.Host, m.family)
+	if err != nil {
+		return routeMsg{}
+	}
+
+	iface, err := route.Lookup(ctx, addr.String())
+	if err != nil {
+		return routeMsg{}
+	}
+
+	return routeMsg{iface: iface}
+}
+
+type countersMsg struct {
+	iface    string
+	counters ifstat.Counters
+	at       time.Time
+}
+
+// readCounters samples the interface off the update loop, since on some
+// platforms it means running netstat. Failures are dropped so that hosts
+// without counter support just don't show throughput.
+func (m Model) readCounters(iface string) tea.Cmd {
+	return func() tea.Msg {
+		counters, err := ifstat.Read(m.ctx, iface)
+		if err != nil {
+			return nil
+		}
+
+		return countersMsg{iface: iface, counters: counters, at: time.Now()}
+	}
+}
+
+func (m Model) lookup() tea.Msg {
+	info, err := enrich.Lookup(m.ctx, m.Host)
+	if err != nil {
+		return nil
+	}
+
+	return info
+}
+
+type controlMsg control.Command
+
+func (m Model) waitControl() tea.Msg {
+	if m.control == nil {
+		return nil
+	}
+
+	select {
+	case command := <-m.control:
+		return controlMsg(command)
+	case <-m.ctx.Done():
+		return nil
+	}
+}
+
+func (m *Model) handleControl(command control.Command) {
+	switch command.Name {
+	case "ack":
+		if err := m.Stats.Acknowledge(command.Args); err != nil {
+			command.Reply("error: " + err.Error())
+			return
+		}
+		command.Reply("ok")
+	case "mark-change":
+		m.Stats.MarkChange(command.Args)
+		command.Reply("ok")
+	case "pause":
+		if m.Stats.Paused != nil {
+			command.Reply("error: already paused")
+			return
+		}
+		reason := command.Args
+		if reason == "" {
+			reason = "paused over the control socket"
+		}
+		m.pause(reason, false)
+		command.Reply("ok")
+	case "resume":
+		if m.Stats.Paused == nil {
+			command.Reply("error: not paused")
+			return
+		}
+		if m.Stats.Paused.Automatic {
+			m.pauseOverride = true
+		}
+		reason := command.Args
+		if reason == "" {
+			reason = "resumed over the control socket"
+		}
+		m.resume(reason)
+		command.Reply("ok")
+	case SUBSCRIBE_COMMAND:
+		m.subscribe(command)
+	default:
+		command.Reply(fmt.Sprintf("error: unknown command %q", command.Name))
+	}
+}
+
+func describeRoute(iface string) string {
+	if route.IsVPN(iface) {
+		return "via VPN (" + iface + ")"
+	}
+
+	return "via " + iface
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == RESERVED_KEY {
+			return m, tea.Quit
+		}
+		action := m.keys.Action(KEYS_MAIN, msg.String())
+		// Any key resumes, rather than doing what it's bound to.
+		if m.Stats.Paused != nil && action != "quit" {
+			action = "pause"
+		}
+		if m.follow != nil && slices.Contains(FOLLOW_CONTROLS, action) {
+			return m, m.follow.control(action, m.Stats.Paused != nil)
+		}
+		switch action {
+		case "quit":
+			return m, tea.Quit
+		case "ack":
+			m.Stats.Acknowledge("")
+		case "mark-change":
+			m.Stats.MarkChange("")
+		case "pause":
+			m.togglePause()
+			return m, nil
+		case "reset":
+			m.Stats.Reset()
+		}
+		m.tabs.key(&m, msg.String())
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.rows = msg.Height
+		m.Stats.Spark.Resize(msg.Width)
+	case controlMsg:
+		m.handleControl(control.Command(msg))
+		return m, m.waitControl
+	case followSnapshot, followEvent, followIncidents, followPause, followLost, followReply:
+		if err := m.applyFollow(msg); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+		if _, ok := msg.(followReply); ok {
+			return m, nil
+		}
+		return m, m.tick
+	case networkMsg:
+		m.applyNetwork(msg)
+		return m, m.networkTick()
+	case answersMsg:
+		m.applyAnswers(msg)
+		return m, m.answersTick()
+	case initParams:
+		m.pings = msg.pings
+		m.errs = msg.errs
+		return m, m.tick
+	case ping.Notice:
+		if err := m.noticed(msg); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+		return m, m.tick
+	case pingerExited:
+		delay, err := m.pingerStopped(msg.err, time.Now())
+		if err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+		if delay == 0 {
+			return m, nil
+		}
+		return m, tea.Tick(delay, func(time.Time) tea.Msg { return restartPinger{} })
+	case restartPinger:
+		m.rerunPinger(m.ctx)
+		return m, m.tick
+	case gatewayStarted:
+		m.gatewayAddress = msg.address
+		m.gatewayPings = msg.pings
+		return m, m.tickGateway
+	case gatewayFailed:
+		m.gatewayErr = msg.err
+		return m, nil
+	case gatewayResult:
+		if msg.Lost {
+			return m, m.tickGateway
+		}
+		m.gatewayStats.Update(msg.Duration)
+		m.pairing.AddGateway(time.Now(), msg.Duration)
+		return m, m.tickGateway
+	case enrich.Info:
+		m.Stats.Target = &msg
+		return m, nil
+	case routeMsg:
+		if msg.iface != "" && msg.iface != m.Stats.Route {
+			if m.Stats.Route != "" || route.IsVPN(msg.iface) {
+				m.Stats.AddEvent("route", fmt.Sprintf("now %s", describeRoute(msg.iface)))
+			}
+			m.Stats.Route = msg.iface
+		}
+		every := ROUTE_CHECK_INTERVAL
+		if m.lowPower {
+			every = LOW_POWER_ROUTE_CHECK_INTERVAL
+		}
+		return m, tea.Tick(every, func(time.Time) tea.Msg { return m.checkRoute() })
+	case graceMsg:
+		m.graceExpired = true
+		return m, nil
+	case LossMsg:
+		// Nothing streams in while a follower is cut off, which isn't loss.
+		if m.follow == nil || m.follow.connected {
+			m.Stats.AdvanceLoss()
+			m.alertSilence(time.Now())
+		}
+		// Checked on the tick rather than a reply, so that the totals still
+		// roll over while every probe is being lost.
+		if m.daily != nil {
+			m.daily.check(m.Stats.Now(), &m.Stats)
+		}
+		m.sampleSelf(time.Now())
+		if err := m.ExportSamples(nil); err != nil {
+			return m, func() tea.Msg { return err }
+		}
+		return m, m.orStop(m.lossTick())
+	case limitMsg:
+		return m, tea.Quit
+	case windowMsg:
+		if closed := m.Stats.CloseWindows(m.Stats.Now()); len(closed) > 0 {
+			if err := m.windowsClosed(closed); err != nil {
+				return m, func() tea.Msg { return err }
+			}
+		}
+		return m, m.orStop(m.windowTick())
+	case ping.Result:
+		// Replies already queued when probing paused belong to no window.
+		if m.Stats.Paused != nil {
+			m.Stats.Paused.Skipped++
+			return m, m.tick
+		}
+		if msg.Lost {
+			if closed := m.Stats.Observe(msg); len(closed) > 0 {
+				if err := m.windowsClosed(closed); err != nil {
+					return m, func() tea.Msg { return err }
+				}
+			}
+			if err := m.ExportSamples(nil); err != nil {
+				return m, func() tea.Msg { return err }
+			}
+			return m, m.orStop(m.tick)
+		}
+		if m.pairing != nil {
+			if upstream, ok := m.pairing.Upstream(time.Now(), msg.Duration); ok {
+				m.upstreamStats.Update(upstream)
+			}
+		}
+		m.received = true
+		m.replied()
+		m.Stats.SampleIndex++
+		msg.Index = m.Stats.SampleIndex
+		closed := m.Stats.Observe(msg)
+		m.last = msg
+		if m.dnsStats != nil && msg.DNS > 0 {
+			m.dnsStats.Update(msg.DNS)
+		}
+		if len(msg.Phases) > 0 {
+			m.phases.Update(msg.Phases)
+		}
+		if closed = append(closed, m.Stats.UpdateAt(msg.Duration, msg.At)...); len(closed) > 0 {
+			if err := m.windowsClosed(closed); err != nil {
+				return m, func() tea.Msg { return err }
+			}
+		}
+		m.crash.record(m.Stats)
+		if err := m.ExportSamples(&msg); err != nil {
+			return m, func() tea.Msg { return err }
+		}
+		m.Stats.ExpireAck(m.reackAfter)
+		if m.counters != nil && m.Stats.Route != "" {
+			return m, m.orStop(tea.Batch(m.tick, m.readCounters(m.Stats.Route)))
+		}
+		return m, m.orStop(m.tick)
+	case countersMsg:
+		m.counters.Add(msg.iface, msg.counters, msg.at)
+		return m, nil
+	case error:
+		m.Err = msg
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+func (m Model) View() string {
+	header := "PING: " + m.describeTarget()
+	if metadata := m.Stats.Metadata; metadata != nil && metadata.AddressClass != "" {
+		var about []string
+		address := m.probedAddress()
+		if address != "" && address != m.Host {
+			about = append(about, address)
+		}
+		if others := stats.DescribeOthers(address, m.candidates()); others != "" {
+			about = append(about, others)
+		}
+		if metadata.Family != "" {
+			about = append(about, metadata.Family)
+		}
+		class := metadata.AddressClass
+		if zone := target.Zone(m.Host); zone != "" {
+			class += " via " + zone
+		}
+		header += " (" + strings.Join(append(about, class), ", ") + ")"
+	}
+	if !m.binding.IsZero() {
+		header += " " + m.binding.String()
+	}
+	if m.Stats.Target != nil {
+		header += " [" + m.Stats.Target.String() + "]"
+	}
+	if m.Stats.Hops != nil {
+		header += " " + m.Stats.Hops.String()
+	}
+	if m.Stats.Route != "" && route.IsVPN(m.Stats.Route) {
+		header += " " + describeRoute(m.Stats.Route)
+	}
+	header += " (interval: " + m.describeInterval() + m.describePayload() + ", run: " + m.Stats.RunID + ")"
+
+	lines := []string{m.theme.Header.Render(header)}
+	if m.follow != nil {
+		lines = append(lines, m.follow.line(m.theme, m.Stats.Times))
+	}
+	if m.Replay != nil {
+		lines = append(lines, m.Replay.line(m.theme, m.Stats.Times))
+	}
+	if line := m.printResolution(time.Now()); line != "" {
+		lines = append(lines, line)
+	}
+	lines = append(lines, m.tabs.bar(m.theme, m.keys), "")
+
+	if m.Err != nil {
+		lines = append(lines, m.theme.Alert.Render(m.Err.Error()), "")
+	}
+	if line := m.printRestart(m.theme, time.Now()); line != "" {
+		lines = append(lines, line, "")
+	}
+
+	lines = append(lines, m.tabs.current().view(m)...)
+
+	return strings.Join(lines, "\n")
+}
+
+// printSummary is the summary tab: how the run is going, and anything
+// that needs attention.
+func (m Model) printSummary(average bool) []string {
+	var lines []string
+	if suspectCaptivePortal(m.Stats.Metadata, m.Host) {
+		lines = append(lines, m.theme.Warn.Render(fmt.Sprintf("%s resolved to %s, a %s address, so this may not be testing the internet", m.Host, m.Stats.Metadata.Address, m.Stats.Metadata.AddressClass)), "")
+	}
+
+	if m.Stats.Metadata != nil && !m.bannerDismissed {
+		lines = append(lines, m.printBanner(), "")
+	}
+
+	if m.graceExpired && !m.received && m.Target.Mode == target.TCP {
+		lines = append(lines,
+			m.theme.Alert.Render(fmt.Sprintf("No connections made after %s - the port may be closed or filtered.", m.startupGrace())),
+			"Check the host resolves and that something is listening on port "+strconv.Itoa(m.Target.Port)+".",
+			"",
+		)
+	} else if m.graceExpired && !m.received && m.Target.Mode == target.UDP {
+		lines = append(lines,
+			m.theme.Alert.Render(fmt.Sprintf("No echoes received after %s - the reflector may not be running or the port may be filtered.", m.startupGrace())),
+			"Check network-test reflect is listening on port "+strconv.Itoa(m.Target.Port)+" there and that udp gets through to it.",
+			"",
+		)
+	} else if m.graceExpired && !m.received && m.Target.Mode == target.HTTP {
+		lines = append(lines,
+			m.theme.Alert.Render(fmt.Sprintf("No successful responses after %s - see the status line below for what came back instead.", m.startupGrace())),
+			"Check "+m.Target.URL+" is right, and add --follow-redirects if it redirects.",
+			"",
+		)
+	} else if m.graceExpired && !m.received {
+		lines = append(lines,
+			m.theme.Alert.Render(fmt.Sprintf("No replies received after %s - the target may be unreachable or ICMP may be filtered.", m.startupGrace())),
+			"Try a tcp target instead (e.g. "+net.JoinHostPort(m.Host, "443")+"), or check the host resolves and routes as expected.",
+			"",
+		)
+	}
+
+	if m.received {
+		seq := "icmp_seq"
+		if m.Target.Mode != target.ICMP {
+			seq = "seq"
+		}
+		lines = append(lines, m.Stats.PrintHeadline(m.theme), fmt.Sprintf("Last sample: #%d %s=%d %s", m.last.Index, seq, m.last.Seq, m.Stats.RenderLatency(m.theme, m.last.Duration)))
+		if line := m.Stats.PrintTTL(m.theme); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	lines = append(lines,
+		m.Stats.PrintProgress(),
+		m.Stats.PrintWindows(m.theme),
+		m.Stats.PrintLoss(m.theme),
+	)
+
+	switch m.Target.Mode {
+	case target.HTTP:
+		lines = append(lines, m.Stats.PrintStatuses(m.theme))
+	case target.DNS:
+		lines = append(lines, m.Stats.PrintDNS(m.theme))
+	}
+
+	if m.Stats.Expected > 0 {
+		lines = append(lines, m.Stats.PrintExpectation(m.theme))
+	}
+
+	if m.Stats.Baseline != nil {
+		lines = append(lines, m.Stats.PrintBaseline())
+	}
+
+	if m.Stats.Call != nil {
+		lines = append(lines, m.Stats.PrintCall(m.theme))
+	}
+
+	if line := m.Stats.PrintOutages(m.theme); line != "" {
+		lines = append(lines, line)
+	}
+
+	if line := m.printHistory(); line != "" {
+		lines = append(lines, line)
+	}
+
+	if m.pairing != nil {
+		lines = append(lines, m.printGateway())
+	}
+
+	if m.dnsStats != nil {
+		lines = append(lines, fmt.Sprintf("p95: DNS %s / path %s", stats.FormatLatency(m.dnsStats.WindowPercentile(95)), stats.FormatLatency(m.Stats.WindowPercentile(95))))
+	}
+
+	if len(m.phases.last) > 0 {
+		lines = append(lines, "", m.printWaterfall(average), "")
+	}
+
+	if slowest := m.Stats.SlowTotals.Sorted(); len(slowest) > 0 {
+		if len(m.Stats.LastSlow) > 0 {
+			lines = append(lines, m.theme.Muted.Render(printSlowest(m.Stats.Times, "Slowest, window", m.Stats.LastSlow)))
+		}
+		lines = append(lines, m.theme.Muted.Render(printSlowest(m.Stats.Times, "Slowest, run", slowest)))
+	}
+
+	if event := m.Stats.PrintLastEvent(m.theme); event != "" {
+		lines = append(lines, event)
+	}
+
+	lines = append(lines, "")
+
+	if m.Stats.SLO != nil {
+		lines = append(lines, m.Stats.PrintSLO(m.theme), "")
+	}
+
+	if m.Stats.LossAlerts != nil {
+		lines = append(lines, m.Stats.PrintLossAlerts(m.theme), "")
+	}
+
+	if line := m.Stats.PrintRecovery(m.theme); line != "" {
+		lines = append(lines, line, "")
+	}
+
+	if line := m.Stats.PrintPause(m.theme); line != "" {
+		lines = append(lines, line, "")
+	}
+
+	if m.Stats.RateLimitPeriod > 0 {
+		lines = append(lines, m.Stats.PrintRateLimit(m.theme), "")
+	}
+
+	return lines
+}
+
+// printDiagnostics is the diagnostics tab: how the prober and everything
+// fed from it is keeping up.
+func (m Model) printDiagnostics() []string {
+	var lines []string
+	if line := m.printInFlight(); line != "" {
+		lines = append(lines, line, "")
+	}
+
+	if m.pinger != nil && m.pinger.Dropped() > 0 {
+		lines = append(lines, m.theme.Warn.Render(fmt.Sprintf("Dropped samples: %d (display fell behind)", m.pinger.Dropped())), "")
+	}
+
+	if m.pinger != nil {
+		if ignored := m.pinger.Ignored(); ignored.Total() > 0 {
+			line := fmt.Sprintf("Ignored replies: %d from other senders, %d unexpected, %d malformed", ignored.Foreign, ignored.Unexpected, ignored.Malformed)
+			if ignored.Late > 0 || ignored.Duplicate > 0 {
+				line += fmt.Sprintf(", %d late, %d duplicated", ignored.Late, ignored.Duplicate)
+			}
+			lines = append(lines, m.theme.Muted.Render(line), "")
+		}
+	}
+
+	if line := m.printResolutionFailures(); line != "" {
+		lines = append(lines, line, "")
+	}
+
+	if m.counters != nil && m.counters.Interface() != "" {
+		lines = append(lines, m.theme.Muted.Render(fmt.Sprintf("Interface %s: rx %s, tx %s", m.counters.Interface(), ifstat.FormatRate(m.counters.RxRate), ifstat.FormatRate(m.counters.TxRate))), "")
+	}
+
+	if m.webhook != nil {
+		lines = append(lines, m.printWebhook(), "")
+	}
+
+	if m.Forward != nil {
+		lines = append(lines, m.printDelivery("Forwarding to "+m.Forward.collector, m.Forward.Sender), "")
+	}
+
+	if m.results != nil {
+		if line := m.printResults(); line != "" {
+			lines = append(lines, line, "")
+		}
+	}
+	if line := m.printRecording(); line != "" {
+		lines = append(lines, line, "")
+	}
+
+	if self := m.printSelf(); len(self) > 0 {
+		lines = append(lines, self...)
+		lines = append(lines, "")
+	}
+
+	return lines
+}
+
+// Run probes and shows a run set up by cfg until it ends, ctx is done or
+// it's quit, then saves and summarises it as cfg asks.
+func Run(ctx context.Context, cfg Config) error {
+	guard := newCrashGuard(cfg.CheckpointDir, cfg.StatePath, cfg.Host, time.Now())
+	defer guard.handle()
+
+	// Cancelled once the display exits however it does, since nothing else
+	// would stop the ping process.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runID := cfg.RunID
+	if runID == "" && !cfg.Resume {
+		runID = uuid.NewString()
+	}
+
+	m := Model{
+		ctx:      ctx,
+		Target:   cfg.Target,
+		Host:     cfg.Host,
+		interval: cfg.Interval,
+		window:   cfg.Window,
+		state:    cfg.StatePath,
+		theme:    cfg.Theme,
+		enrich:   cfg.Enrich,
+		daily:    cfg.Daily,
+		lowPower: cfg.LowPower,
+		failover: !cfg.NoFailover,
+		native:   cfg.Native,
+		family:   cfg.Family,
+
+		maxInFlight: cfg.MaxInFlight,
+		maxRestarts: cfg.MaxRestarts,
+		httpOptions: cfg.HTTPOptions,
+		dnsOptions:  cfg.DNSOptions,
+
+		size:         cfg.Size,
+		dontFragment: cfg.DontFragment,
+		binding:      cfg.Binding,
+
+		histWidth: cfg.HistWidth,
+		tabs:      newTabSet(cfg.HistVertical),
+		keys:      cfg.Keys,
+
+		pauseMetered: cfg.PauseMetered,
+
+		reackAfter: cfg.ReackAfter,
+		webhook:    cfg.Webhook,
+		Forward:    cfg.Forward,
+		Labels:     cfg.Labels,
+		crash:      guard,
+		self:       newSelfMetrics(cfg.MemoryBudget),
+		Stats:      stats.New(cfg.Interval, time.Duration(cfg.Window)*time.Second, cfg.Thresholds),
+	}
+
+	m.Stats.RunID = runID
+	m.Stats.Times = cfg.TimeFormat
+	now := time.Now
+	if cfg.Replay != nil {
+		// Timed by the recording rather than the wall clock, so that the
+		// figures come out as they did however fast it's played.
+		now = cfg.Replay.Clock.Now
+		m.Stats.Clock = now
+		m.Stats.Started, m.Stats.WindowStart = now(), now()
+		m.Replay, m.prober = cfg.Replay, cfg.Replay
+	}
+	if m.daily != nil {
+		m.daily.start(now())
+	}
+	m.Stats.Expected = cfg.Expect
+	m.Stats.Levels = cfg.Levels
+	if cfg.AlertCmd != "" || cfg.Bell {
+		m.alerts = newAlertHook(cfg.AlertCmd, cfg.Bell, cfg.Levels, cfg.Exit.MaxLoss)
+	}
+	m.Stats.Headline = cfg.Headline
+	m.Stats.Reference = cfg.Reference
+	m.Stats.Burst = cfg.Burst
+	if cfg.AutoBuckets {
+		m.Stats.AutoBuckets = &stats.AutoBuckets{}
+	}
+	m.Stats.RecoveryProbes = cfg.RecoverAfter
+	if cfg.Baseline > 0 {
+		m.Stats.Baseline = stats.NewMinRTT(cfg.Baseline)
+	}
+	if cfg.Counters {
+		m.counters = &ifstat.Sampler{}
+	}
+	m.Stats.Loss = stats.NewLossTracker(m.Stats.Interval, stats.LossTimeout(m.Stats.Interval), m.Stats.WindowSize, cfg.HalfLife)
+	if cfg.Burst != nil && cfg.Burst.Adaptive {
+		m.Stats.Loss.Observe(cfg.Burst.Observe)
+	}
+	m.Stats.SlowWindow = stats.NewTopN(cfg.TopN)
+	m.Stats.SlowTotals = stats.NewTopN(cfg.TopN)
+
+	if cfg.WithGateway {
+		gatewayStats := stats.New(m.Stats.Interval, m.Stats.WindowSize, cfg.Thresholds)
+		upstreamStats := stats.New(m.Stats.Interval, m.Stats.WindowSize, cfg.Thresholds)
+		m.gatewayStats = &gatewayStats
+		m.upstreamStats = &upstreamStats
+		m.pairing = newGatewayPairing(m.Stats.Interval)
+	}
+
+	if cfg.ResolveEach {
+		dnsStats := stats.New(m.Stats.Interval, m.Stats.WindowSize, cfg.Thresholds)
+		m.dnsStats = &dnsStats
+	}
+
+	if cfg.SLO != nil {
+		m.Stats.SLO = stats.NewSLOTracker(*cfg.SLO)
+	}
+	m.Stats.Call = cfg.Call
+
+	m.Stats.Spark = stats.NewSparkRing(cfg.Sparkline, stats.DEFAULT_VIEW_WIDTH)
+	m.Stats.Loss.Observe(m.Stats.Spark.Observe)
+
+	if cfg.Outages > 0 {
+		m.Stats.Outages = stats.NewOutageTracker(cfg.Outages, m.Stats.Interval, now)
+		m.Stats.Loss.Observe(m.Stats.Outages.Outcome)
+	}
+
+	if cfg.WorstMinutes > 0 {
+		m.Stats.Worst = stats.NewWorstMinutes(cfg.WorstMinutes, m.Stats.WindowSize, now)
+		m.Stats.Loss.Observe(m.Stats.Worst.Observe)
+	}
+
+	if cfg.WindowHistory > 0 {
+		m.Stats.History = stats.NewWindowHistory(cfg.WindowHistory)
+	}
+
+	if cfg.RateLimit {
+		m.Stats.RateLimit = stats.NewRateLimitDetector()
+		m.Stats.Loss.Observe(m.Stats.RateLimit.Outcome)
+	}
+
+	if cfg.LossAlerts.Enabled() {
+		m.Stats.LossAlerts = stats.NewLossAlerts(cfg.LossAlerts, m.Stats.Interval)
+		m.Stats.Loss.Retain(cfg.LossAlerts.Window)
+	}
+
+	if cfg.WideCSV != "" {
+		export, err := newWideExport(cfg.WideCSV)
+		if err != nil {
+			return err
+		}
+		defer export.Close()
+
+		m.wide = export
+		m.Stats.Loss.Observe(export.observe)
+	}
+
+	if cfg.StatusFD != "" {
+		feed, err := openStatus(cfg.StatusFD)
+		if err != nil {
+			return err
+		}
+		defer feed.Close()
+
+		m.status = feed
+		m.Stats.Loss.Observe(feed.observe)
+	}
+
+	if cfg.StatsListen != "" {
+		server, err := listenStats(cfg.StatsListen)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		m.statsAPI = server
+	}
+
+	if cfg.Serve != "" {
+		server, err := listenDashboard(ctx, cfg.Serve)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		fmt.Fprintf(os.Stderr, "dashboard at http://%s/\n", server.address)
+		m.dashboard = server
+		m.publishDashboard()
+	}
+
+	if cfg.ResultsPath != "" {
+		results, err := openResults(cfg.ResultsPath, cfg.ResultsFormat, cfg.ResultsAppend)
+		if err != nil {
+			return err
+		}
+		// Deferred so the summary reflects the final model.
+		defer func() {
+			if err := m.results.Close(&m.Stats); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if dropped := m.results.dropped.Load(); dropped > 0 {
+				fmt.Fprintf(os.Stderr, "warning: %d samples were left out of %s because it couldn't keep up\n", dropped, cfg.ResultsPath)
+			}
+		}()
+
+		m.results = results
+		m.Stats.Loss.Observe(results.observe)
+	}
+
+	if cfg.SignKey != "" {
+		log, err := newEvidenceLog(cfg.SignKey, cfg.BundlePath, runID)
+		if err != nil {
+			return err
+		}
+		m.evidence = log
+	}
+
+	if cfg.ControlSocket != "" {
+		server, err := control.Listen(cfg.ControlSocket)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		go server.Serve(ctx)
+		m.control = server.Commands()
+	}
+
+	if cfg.Webhook != nil {
+		// Stop the sender once the UI exits so anything still queued is
+		// spooled rather than lost.
+		sendCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			cfg.Webhook.Run(sendCtx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if m.alerts != nil {
+		alertCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			m.alerts.Run(alertCtx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if cfg.Forward != nil {
+		m.Stats.Loss.Observe(cfg.Forward.Observe)
+
+		sendCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			cfg.Forward.Sender.Run(sendCtx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if cfg.Resume {
+		if cfg.StatePath == "" {
+			return fmt.Errorf("--resume requires a --state file")
+		}
+
+		if err := stats.ResumeState(cfg.StatePath, &m.Stats); err != nil {
+			return err
+		}
+		m.tabs.show(m.Stats.Tab)
+	}
+
+	var runs []history.Run
+	if cfg.HistoryPath != "" {
+		var err error
+		runs, err = history.Load(cfg.HistoryPath)
+		if err != nil {
+			return err
+		}
+
+		baseline := history.Compare(runs, m.Host, m.Target.Mode, time.Now(), history.BASELINE_HORIZON)
+		m.history = &baseline
+	}
+
+	if cfg.CheckpointDir != "" {
+		var err error
+		m.abandoned, err = AbandonedCheckpoints(cfg.CheckpointDir, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if m.Replay == nil {
+		pinger := m.newPinger()
+		if err := pinger.CheckInterval(); err != nil {
+			return err
+		}
+		if err := pinger.CheckPacket(); err != nil {
+			return err
+		}
+		if err := pinger.CheckBinding(); err != nil {
+			return err
+		}
+		m.Stats.Burst.Attach(pinger)
+		m.prober, m.pinger = pinger, pinger
+	}
+
+	started := time.Now()
+	m.limit = newRunLimit(cfg.Count, cfg.Duration, &m.Stats, started)
+
+	var options []tea.ProgramOption
+	if cfg.LowPower {
+		// Nothing changes between probes, so redraw at the slowest rate
+		// bubbletea allows rather than the default 60fps.
+		options = append(options, tea.WithFPS(LOW_POWER_FPS))
+	}
+
+	info := DetectTerminal()
+	output := cfg.Output
+	if output == "line" && !info.StdoutTTY {
+		fmt.Fprintln(os.Stderr, "using plain output: stdout is not a terminal")
+		output = "plain"
+	}
+
+	var metadata stats.RunMetadata
+	if m.Replay == nil {
+		metadata = collectMetadata(ctx, m)
+	} else if recorded := m.Replay.recording.Header.Metadata; recorded != nil {
+		metadata = *recorded
+	}
+	m.Stats.Metadata = &metadata
+	if cfg.ReResolve > 0 {
+		m.answers = newDNSWatch(cfg.ReResolve, cfg.FollowDNS, &metadata)
+		// Followed from the start, so that it's known which address is
+		// probed rather than left to the system ping to pick.
+		if cfg.FollowDNS && len(m.answers.answers) > 0 {
+			m.pinger.Pin(m.answers.answers[0])
+		}
+	}
+	if cfg.RecordPath != "" {
+		recording, err := CreateRecording(cfg.RecordPath, newRecordingHeader(&m, started))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := recording.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+		m.recording = recording
+		m.prober = newRecordingProber(ctx, m.prober, recording)
+	}
+	m.status.send("start", metadata)
+	m.publishStats(nil)
+
+	// Check before the first probe, so a metered connection gets none.
+	if m.pauseMetered {
+		m.applyNetwork(m.checkNetwork().(networkMsg))
+	}
+
+	if output != "tui" {
+		fmt.Fprintln(os.Stderr, strings.Join(metadata.Banner(), "\n"))
+		if line := m.printHistory(); line != "" {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		if line := m.printAbandoned(); line != "" {
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}
+
+	var err error
+	if output == "line" {
+		m, err = runLine(ctx, m, os.Stdout, info.Width)
+	} else if output == "plain" {
+		m, err = runPlain(ctx, m, os.Stdout)
+	} else if ok, reason := UseTUI(info, cfg.ForceTUI); ok {
+		// Panics are left for the crash guard, which hands the terminal back
+		// before saving what it can.
+		p := tea.NewProgram(m, append(options, tea.WithoutCatchPanics())...)
+		guard.release = func() { p.ReleaseTerminal() }
+
+		var final tea.Model
+		final, err = p.Run()
+		if final != nil {
+			m = final.(Model)
+		}
+		if err == nil {
+			err = m.Err
+		}
+		// The TUI has handed the terminal back by now, so the summary is
+		// left behind on stdout like the plain output's, whatever ended the
+		// run, as the alternate screen took the figures with it.
+		plainLines(os.Stdout).done(&m)
+	} else {
+		fmt.Fprintf(os.Stderr, "using plain output: %s\n", reason)
+		m, err = runPlain(ctx, m, os.Stdout)
+	}
+	cancel()
+	m.awaitPinger()
+	if err != nil {
+		return err
+	}
+
+	m.publishStatus(nil)
+	m.status.send("summary", stats.NewRunState(&m.Stats))
+	m.attached.Close()
+
+	if m.evidence != nil {
+		if err := m.evidence.write(&m.Stats); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "signed evidence bundle saved to %s\n", m.evidence.path)
+	}
+
+	if cfg.StatePath != "" {
+		if err := stats.SaveState(cfg.StatePath, &m.Stats); err != nil {
+			return err
+		}
+	}
+
+	if cfg.HistoryPath != "" && m.Stats.Totals.Count > 0 {
+		run := m.historyRun(started, time.Now())
+		if m.history.Runs > 0 {
+			fmt.Println(m.history.Deviation(run.P95Ms))
+		}
+
+		if err := history.Append(cfg.HistoryPath, run); err != nil {
+			return err
+		}
+	}
+
+	if reason := m.Stats.Breached(cfg.Exit); reason != "" {
+		return cli.Exit(reason, 1)
+	}
+
+	return nil
+}
+
+// PINGER_STOP_TIMEOUT allows for the second the ping process is given to exit
+// once it's killed, and a little more.
+const PINGER_STOP_TIMEOUT = 3 * time.Second
+
+// awaitPinger waits for the pinger to wind down once its context is
+// cancelled, so that the ping process is gone before the program is, giving
+// up after PINGER_STOP_TIMEOUT.
+func (m Model) awaitPinger() {
+	if m.pings == nil {
+		return
+	}
+
+	timeout := time.After(PINGER_STOP_TIMEOUT)
+	for {
+		select {
+		case _, ok := <-m.pings:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func (m Model) printInFlight() string {
+	if m.pinger == nil {
+		return ""
+	}
+
+	probes := m.pinger.Probes()
+	if probes.Active() == 0 && probes.Skipped() == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("In flight: %d/%d, ticks skipped at the cap: %d (not counted as loss)", probes.Active(), probes.Max(), probes.Skipped())
+}
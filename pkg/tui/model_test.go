@@ -0,0 +1,402 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestZones checks the header of a zoned target, and that the system ping
+// is asked for IPv6 with the zone kept on the address.
+func TestZones(t *testing.T) {
+	m := Model{Host: "fe80::1%eth0", Stats: stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS), Target: target.Target{Mode: target.ICMP, Host: "fe80::1%eth0"}, tabs: newTabSet(false)}
+	m.Stats.Metadata = &stats.RunMetadata{AddressClass: target.LINK_LOCAL}
+	m.tabs.show("help")
+	if header := m.View(); !strings.HasPrefix(header, "PING: icmp fe80::1%eth0 (link-local via eth0)") {
+		t.Fatalf("header for a zoned target: expected PING: icmp fe80::1%%eth0 (link-local via eth0), got %q", strings.SplitN(header, "\n", 2)[0])
+	}
+
+	argv := []struct {
+		args     []string
+		expected []string
+	}{
+		{ping.StreamArgs("fe80::1%eth0", "", time.Second, "linux", nil), []string{"ping", "-6", "fe80::1%eth0", "-i", "1", "-O"}},
+		{ping.StreamArgs("2606:4700::1111", "", 500*time.Millisecond, "linux", nil), []string{"ping", "-6", "2606:4700::1111", "-i", "0.5", "-O"}},
+		{ping.StreamArgs("192.168.1.1", "", time.Second, "linux", nil), []string{"ping", "192.168.1.1", "-i", "1", "-O"}},
+		{ping.StreamArgs("example.com", "", time.Second, "linux", nil), []string{"ping", "example.com", "-i", "1", "-O"}},
+		{ping.OnceArgs("fe80::1%eth0", "", 2, "linux", nil), []string{"ping", "-6", "-c", "1", "-W", "2", "fe80::1%eth0"}},
+		{ping.OnceArgs("::ffff:10.0.0.1", "", 1, "linux", nil), []string{"ping", "-c", "1", "-W", "1", "::ffff:10.0.0.1"}},
+	}
+	for _, c := range argv {
+		if !slices.Equal(c.args, c.expected) {
+			t.Fatalf("system ping arguments: expected %q, got %q", strings.Join(c.expected, " "), strings.Join(c.args, " "))
+		}
+	}
+
+	if index, err := ping.ZoneIndex("3"); err != nil || index != "3" {
+		t.Fatalf("a numeric zone is the interface index: expected 3, got %s, %v", index, err)
+	}
+	if _, err := ping.ZoneIndex("no-such-interface0"); err == nil {
+		t.Fatalf("a zone naming no interface: expected an error, got accepted")
+	}
+	if ifaces, err := net.Interfaces(); err == nil && len(ifaces) > 0 {
+		if index, err := ping.ZoneIndex(ifaces[0].Name); err != nil || index != strconv.Itoa(ifaces[0].Index) {
+			t.Fatalf("zone %s as an interface index: expected %q, got %s, %v", ifaces[0].Name, strconv.Itoa(ifaces[0].Index), index, err)
+		}
+	}
+}
+
+// TestFamily forces each address family on addresses and names,
+// checking how the system ping is asked for it on linux and macOS, and that
+// the header says which address and family are being probed.
+func TestFamily(t *testing.T) {
+	resolves := []struct {
+		host     string
+		family   string
+		expected string
+	}{
+		{"1.1.1.1", ping.IPV4, "1.1.1.1"},
+		{"::ffff:1.1.1.1", ping.IPV4, "1.1.1.1"},
+		{"2606:4700::1111", ping.IPV6, "2606:4700::1111"},
+		{"fe80::1%eth0", ping.IPV6, "fe80::1%eth0"},
+		{"1.1.1.1", ping.IPV6, "1.1.1.1 is an IPv4 address, so can't be probed with --ipv6"},
+		{"2606:4700::1111", ping.IPV4, "2606:4700::1111 is an IPv6 address, so can't be probed with --ipv4"},
+		{"localhost", ping.IPV4, "127.0.0.1"},
+	}
+	for _, c := range resolves {
+		actual := ""
+		addr, err := ping.Resolve(context.Background(), c.host, c.family)
+		var familyErr *ping.FamilyError
+		switch {
+		case errors.As(err, &familyErr):
+			actual = err.Error()
+		case err != nil:
+			actual = "unexpected error: " + err.Error()
+		default:
+			actual = addr.String()
+		}
+		if actual != c.expected {
+			t.Fatalf("%s with --%s: expected %q, got %q", c.host, c.family, c.expected, actual)
+		}
+	}
+	if err := (&ping.FamilyError{Host: "example.com", Has: "IPv4", Wanted: ping.IPV6}).Error(); err != "example.com only has IPv4 addresses, so can't be probed with --ipv6" {
+		t.Fatalf("a name with no address in the family: expected example.com only has IPv4 addresses, so can't be probed with --ipv6, got %q", err)
+	}
+
+	argv := []struct {
+		args     []string
+		expected []string
+	}{
+		{ping.StreamArgs("example.com", ping.IPV6, time.Second, "linux", nil), []string{"ping", "-6", "example.com", "-i", "1", "-O"}},
+		{ping.StreamArgs("example.com", ping.IPV4, time.Second, "linux", nil), []string{"ping", "-4", "example.com", "-i", "1", "-O"}},
+		{ping.StreamArgs("example.com", ping.IPV6, time.Second, "darwin", nil), []string{"ping6", "example.com", "-i", "1"}},
+		{ping.StreamArgs("example.com", ping.IPV4, time.Second, "darwin", nil), []string{"ping", "example.com", "-i", "1"}},
+		{ping.StreamArgs("2606:4700::1111", "", time.Second, "darwin", nil), []string{"ping6", "2606:4700::1111", "-i", "1"}},
+		{ping.OnceArgs("example.com", ping.IPV6, 1, "linux", nil), []string{"ping", "-6", "-c", "1", "-W", "1", "example.com"}},
+		{ping.OnceArgs("example.com", ping.IPV6, 1, "darwin", nil), []string{"ping6", "-c", "1", "-W", "1", "example.com"}},
+	}
+	for _, c := range argv {
+		if !slices.Equal(c.args, c.expected) {
+			t.Fatalf("system ping command: expected %q, got %q", strings.Join(c.expected, " "), strings.Join(c.args, " "))
+		}
+	}
+
+	header := func(host string, metadata stats.RunMetadata) string {
+		m := Model{Host: host, Stats: stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS), Target: target.Target{Mode: target.ICMP, Host: host}, tabs: newTabSet(false)}
+		m.Stats.Metadata = &metadata
+		m.tabs.show("help")
+		return strings.SplitN(m.View(), "\n", 2)[0]
+	}
+	if line := header("example.com", stats.RunMetadata{Address: "2606:2800:21f:cb07:6820:80da:af6b:8b2c", Family: "IPv6", AddressClass: target.GLOBAL}); !strings.HasPrefix(line, "PING: icmp example.com (2606:2800:21f:cb07:6820:80da:af6b:8b2c, IPv6, global)") {
+		t.Fatalf("header for a name: expected the address it resolved to and its family, got %q", line)
+	}
+	if line := header("1.1.1.1", stats.RunMetadata{Address: "1.1.1.1", Family: "IPv4", AddressClass: target.GLOBAL}); !strings.HasPrefix(line, "PING: icmp 1.1.1.1 (IPv4, global)") {
+		t.Fatalf("header for an address: expected its family, without the address again, got %q", line)
+	}
+	if line := (stats.RunMetadata{Target: "icmp example.com", Address: "93.184.215.14", Family: "IPv4", AddressClass: target.GLOBAL}).Banner()[0]; line != "Target:   icmp example.com (93.184.215.14, IPv4, global)" {
+		t.Fatalf("banner target line: expected Target:   icmp example.com (93.184.215.14, IPv4, global), got %q", line)
+	}
+}
+
+// TestScriptedProbes drives the model's Update with a scripted prober
+// in place of the pinger, a result at a time, through a pause, a window
+// closing and the prober giving up, and checks the histogram drawn from it.
+func TestScriptedProbes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Ten 10ms replies, a 120ms one and a probe lost, then the process
+	// exiting.
+	var script []fakeStep
+	for i := range 12 {
+		switch i {
+		case 4:
+			script = append(script, fakeStep{lost: true})
+		case 7:
+			script = append(script, fakeStep{rtt: 120 * time.Millisecond})
+		default:
+			script = append(script, fakeStep{rtt: 10 * time.Millisecond})
+		}
+	}
+	prober := newFakeProber(errors.New("exit status 2"), script...)
+	prober.stepped = true
+
+	keys, err := NewKeyMap(nil)
+	if err != nil {
+		t.Fatalf("the default keys are accepted: expected no error, got %v", err)
+	}
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	m := Model{ctx: ctx, prober: prober, tabs: newTabSet(false), keys: keys, Stats: stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS)}
+	m.Stats.Clock = func() time.Time { return now }
+	m.Stats.WindowStart, m.Stats.Started = start, start
+
+	var cmd tea.Cmd
+	update := func(msg tea.Msg) {
+		var updated tea.Model
+		updated, cmd = m.Update(msg)
+		m = updated.(Model)
+	}
+	// tick waits on the prober with nothing else to wake it, so a result
+	// it never delivers would hang the selftest.
+	next := func() (tea.Msg, bool) {
+		msg := make(chan tea.Msg, 1)
+		go func() { msg <- m.tick() }()
+		select {
+		case got := <-msg:
+			return got, true
+		case <-time.After(time.Second):
+			cancel()
+			return nil, false
+		}
+	}
+
+	update(m.startProbing()())
+	for i := range script {
+		if i == 2 {
+			update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+			if m.Stats.Paused == nil {
+				t.Fatalf("the pause key pauses probing: expected paused, got running")
+			}
+		}
+		if !prober.step(ctx) {
+			t.Fatalf("the prober takes each step: expected step %d, got cancelled", i+1)
+		}
+		if i == 2 {
+			update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+			if m.Stats.Paused != nil {
+				t.Fatalf("any key resumes probing: expected running, got paused")
+			}
+		}
+
+		now = now.Add(time.Second)
+		msg, ok := next()
+		if !ok {
+			t.Fatalf("each step is delivered: expected result %d, got nothing within a second", i+1)
+		}
+		result, ok := msg.(ping.Result)
+		if !ok || result.Seq != i+1 || result.Epoch != 1 {
+			t.Fatalf("the script is replayed in order: expected result %d of epoch 1, got %#v", i+1, msg)
+		}
+		update(result)
+	}
+
+	if m.Stats.Totals.Count != 11 || m.Stats.Totals.Max != 120*time.Millisecond {
+		t.Fatalf("every reply reaches the totals: expected 11 replies, the slowest 120ms, got %d replies, the slowest %s", m.Stats.Totals.Count, m.Stats.Totals.Max)
+	}
+	if m.Stats.LastWindow.Count == 0 || m.Stats.Window.Count == 0 {
+		t.Fatalf("the window rolls over ten seconds in: expected a closed window and one under way, got %d replies closed, %d under way", m.Stats.LastWindow.Count, m.Stats.Window.Count)
+	}
+	if m.Stats.LastWindow.Count+m.Stats.Window.Count != 11 {
+		t.Fatalf("the windows share the replies: expected 11, got %d", m.Stats.LastWindow.Count+m.Stats.Window.Count)
+	}
+
+	histogram := m.Stats.PrintHistogram(theme.Theme{}, stats.HistogramLayout{Limit: 40})
+	rows := map[string]string{}
+	for _, line := range strings.Split(histogram, "\n") {
+		if label, row, ok := strings.Cut(strings.TrimSpace(line), " :"); ok {
+			rows[label] = row
+		}
+	}
+	for label, share := range map[string]string{"10ms": "90.91%", "200ms": "9.09%", "100ms": "0.00%"} {
+		if !strings.HasSuffix(rows[label], share) {
+			t.Fatalf("the histogram counts the replies over the run: expected %s: %s, got %q", label, share, histogram)
+		}
+	}
+
+	msg, ok := next()
+	if !ok {
+		t.Fatalf("the prober giving up is noticed: expected pingerExited, got nothing within a second")
+	}
+	update(msg)
+	if m.restart == nil || cmd == nil || m.Err != nil {
+		t.Fatalf("an exited prober is run again in a while: expected a restart pending, got %v, %v", m.restart, m.Err)
+	}
+	if !strings.Contains(m.View(), "ping exited: exit status 2 - reconnecting in") {
+		t.Fatalf("the restart is shown: expected ping exited: exit status 2 - reconnecting in ..., got %q", m.View())
+	}
+
+	// The script's played out, so the second run gives up straight away,
+	// and is left longer.
+	update(restartPinger{})
+	if m.restart != nil {
+		t.Fatalf("the prober is run again: expected no restart pending, got %v", m.restart)
+	}
+	if msg, ok := next(); !ok || msg != (pingerExited{prober.err}) {
+		t.Fatalf("the second run is listened to: expected pingerExited, got %#v", msg)
+	}
+	update(pingerExited{prober.err})
+	if m.retryDelay != 2*PINGER_RETRY_MIN {
+		t.Fatalf("a prober giving up again is left longer: expected %s, got %s", (2 * PINGER_RETRY_MIN), m.retryDelay)
+	}
+}
+
+// TestBinding checks --source and --interface are asked of each
+// platform's ping in its own way, and that a binding this machine can't
+// send from is refused before the run starts, using its loopback interface
+// as the one that's sure to be there.
+func TestBinding(t *testing.T) {
+	source := netip.MustParseAddr("192.168.1.50")
+	args := []struct {
+		host     string
+		binding  ping.Binding
+		goos     string
+		expected string
+	}{
+		{"1.1.1.1", ping.Binding{}, "linux", ""},
+		{"1.1.1.1", ping.Binding{Source: source}, "linux", "-I 192.168.1.50"},
+		{"1.1.1.1", ping.Binding{Interface: "wlan0"}, "linux", "-I wlan0"},
+		{"1.1.1.1", ping.Binding{Source: source, Interface: "wlan0"}, "linux", "-I wlan0"},
+		{"1.1.1.1", ping.Binding{Source: source, Interface: "en0"}, "darwin", "-b en0 -S 192.168.1.50"},
+		{"2606:4700::1111", ping.Binding{Interface: "en0"}, "darwin", "-I en0"},
+		{"1.1.1.1", ping.Binding{Source: source}, "windows", "-S 192.168.1.50"},
+		{"1.1.1.1", ping.Binding{Interface: "em0"}, "freebsd", "error: --interface isn't supported by the system ping on freebsd"},
+		{"1.1.1.1", ping.Binding{Source: source}, "plan9", "error: --source and --interface aren't supported by the system ping on plan9"},
+	}
+	for _, c := range args {
+		bind, err := ping.BindArgs(c.host, "", c.binding, c.goos)
+		actual := strings.Join(bind, " ")
+		if err != nil {
+			actual = "error: " + err.Error()
+		}
+		if !strings.HasPrefix(actual, c.expected) || (c.expected == "" && actual != "") {
+			t.Fatalf("%q to %s on %s: expected %q, got %q", c.binding.String(), c.host, c.goos, c.expected, actual)
+		}
+	}
+
+	var loopback net.Interface
+	var local netip.Addr
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if prefix, ok := addr.(*net.IPNet); ok && prefix.IP.To4() != nil {
+				loopback, local = iface, netip.AddrFrom4([4]byte(prefix.IP.To4()))
+			}
+		}
+	}
+	if !local.IsValid() {
+		t.Fatalf("there's a loopback interface to bind to: expected an IPv4 loopback address, got none")
+	}
+
+	checks := []struct {
+		name     string
+		pinger   *ping.Pinger
+		expected string
+	}{
+		{"the loopback address", ping.NewPinger(local.String(), time.Second).Native(true).Bind(ping.Binding{Source: local}), ""},
+		{"the loopback address on its interface", ping.NewPinger(local.String(), time.Second).Native(true).Bind(ping.Binding{Source: local, Interface: loopback.Name}), ""},
+		{"an interface that isn't there", ping.NewPinger(local.String(), time.Second).Bind(ping.Binding{Interface: "nettest-none0"}), `no interface named "nettest-none0", expected one of: `},
+		{"an address that isn't this machine's", ping.NewPinger("192.0.2.1", time.Second).Bind(ping.Binding{Source: netip.MustParseAddr("198.51.100.77")}), "198.51.100.77 isn't an address of this machine"},
+		{"an address on another interface", ping.NewPinger("192.0.2.1", time.Second).Bind(ping.Binding{Source: netip.MustParseAddr("198.51.100.77"), Interface: loopback.Name}), "198.51.100.77 isn't an address of " + loopback.Name},
+		{"a source in the other family", ping.NewPinger("example.com", time.Second).Family(ping.IPV6).Bind(ping.Binding{Source: local}), "--source " + local.String() + " is an IPv4 address, so can't be used with --ipv6"},
+		{"a host in the other family", ping.NewPinger("::1", time.Second).Bind(ping.Binding{Source: local}), "::1 is an IPv6 address, so can't be reached from " + local.String()},
+		{"over tcp", ping.NewPinger(local.String(), time.Second).TCP(443).Bind(ping.Binding{Source: local}), "--source and --interface only apply to icmp for now"},
+	}
+	for _, c := range checks {
+		actual := ""
+		if err := c.pinger.CheckBinding(); err != nil {
+			actual = err.Error()
+		}
+		if !strings.HasPrefix(actual, c.expected) || (c.expected == "" && actual != "") {
+			t.Fatalf("binding to %s: expected %q, got %q", c.name, c.expected, actual)
+		}
+	}
+	if !ping.Fatal(&ping.BindError{Message: "interface wlan0 has no IPv6 address to send from"}) {
+		t.Fatalf("an interface with nothing to send from is given up on: expected fatal, got retried")
+	}
+
+	m := Model{Host: "1.1.1.1", Stats: stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS), Target: target.Target{Mode: target.ICMP, Host: "1.1.1.1"}, tabs: newTabSet(false), binding: ping.Binding{Source: source, Interface: "wlan0"}}
+	m.tabs.show("help")
+	if header := strings.SplitN(m.View(), "\n", 2)[0]; !strings.HasPrefix(header, "PING: icmp 1.1.1.1 from 192.168.1.50 via wlan0 (") {
+		t.Fatalf("the header says where probes are sent from: expected PING: icmp 1.1.1.1 from 192.168.1.50 via wlan0 (..., got %q", header)
+	}
+}
+
+// TestVPNRoute looks the route up through a tunnel, then not, then through
+// it again, checking each change is logged and the header and state file
+// only mention the VPN while the route goes through it.
+func TestVPNRoute(t *testing.T) {
+	iface := "wg0"
+	lookup := route.Lookup
+	defer func() { route.Lookup = lookup }()
+	route.Lookup = func(ctx context.Context, address string) (string, error) {
+		if address != "192.0.2.1" {
+			return "", fmt.Errorf("unexpected address %s", address)
+		}
+		return iface, nil
+	}
+
+	m := NewModel(nil, stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS))
+	m.Host, m.Target = "192.0.2.1", target.Target{Mode: target.ICMP, Host: "192.0.2.1"}
+	m.tabs.show("help")
+
+	cases := []struct {
+		iface  string
+		event  string
+		header string
+		vpn    bool
+	}{
+		{"wg0", "now via VPN (wg0)", "PING: icmp 192.0.2.1 via VPN (wg0)", true},
+		{"eth0", "now via eth0", "PING: icmp 192.0.2.1", false},
+		{"eth0", "", "PING: icmp 192.0.2.1", false},
+		{"wg0", "now via VPN (wg0)", "PING: icmp 192.0.2.1 via VPN (wg0)", true},
+	}
+
+	for i, c := range cases {
+		iface = c.iface
+		events := len(m.Stats.Events)
+		updated, _ := m.Update(m.checkRoute())
+		m = updated.(Model)
+
+		switch {
+		case c.event == "" && len(m.Stats.Events) != events:
+			t.Fatalf("check %d, still via %s: expected no route event, got %q", i+1, c.iface, m.Stats.Events[events].Message)
+		case c.event != "" && (len(m.Stats.Events) != events+1 || m.Stats.Events[events].Kind != "route" || m.Stats.Events[events].Message != c.event):
+			t.Fatalf("check %d, now via %s: expected a route event %q, got %+v", i+1, c.iface, c.event, m.Stats.Events[events:])
+		}
+		if header := strings.SplitN(m.View(), "\n", 2)[0]; !strings.HasPrefix(header, c.header+" (interval") {
+			t.Fatalf("check %d, via %s: expected the header %q, got %q", i+1, c.iface, c.header, header)
+		}
+		if state := stats.NewRunState(&m.Stats); state.Interface != c.iface || state.VPN != c.vpn {
+			t.Fatalf("check %d, via %s: expected the state file to say %s, VPN %t, got %s, VPN %t", i+1, c.iface, c.iface, c.vpn, state.Interface, state.VPN)
+		}
+	}
+}
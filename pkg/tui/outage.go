@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"fmt"
+)
+
+// outagesTab lists the outages, newest at the bottom, scrolled back from
+// the newest by scroll.
+type outagesTab struct {
+	scroll int
+}
+
+func (t *outagesTab) name() string { return "outages" }
+
+func (t *outagesTab) view(m Model) []string {
+	if m.Stats.Outages == nil {
+		return []string{"Outages: not tracked, with --outage-after 0"}
+	}
+
+	outages := m.Stats.Outages.Outages()
+	if len(outages) == 0 {
+		return []string{fmt.Sprintf("Outages: none, counting %d probes lost in a row as one", m.Stats.Outages.Threshold())}
+	}
+
+	end := len(outages) - t.scroll
+	start := max(end-m.eventRows(), 0)
+	lines := []string{m.theme.Header.Render(fmt.Sprintf("Outages: %d-%d of %d", start+1, end, len(outages)))}
+	for _, o := range outages[start:end] {
+		lines = append(lines, m.Stats.PrintOutage(m.theme, o))
+	}
+
+	return lines
+}
+
+func (t *outagesTab) key(m *Model, action string) bool {
+	count := 0
+	if m.Stats.Outages != nil {
+		count = len(m.Stats.Outages.Outages())
+	}
+
+	switch action {
+	case "outage-back":
+		t.scroll++
+	case "outage-forward":
+		t.scroll--
+	case "outage-oldest":
+		t.scroll = count
+	case "outage-newest":
+		t.scroll = 0
+	default:
+		return false
+	}
+
+	t.scroll = max(min(t.scroll, count-m.eventRows()), 0)
+	return true
+}
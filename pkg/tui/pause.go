@@ -0,0 +1,99 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+const NETWORK_CHECK_INTERVAL = 10 * time.Second
+
+func (m *Model) pause(reason string, automatic bool) {
+	m.Stats.Pause(reason, automatic)
+	if m.prober != nil {
+		m.prober.Pause()
+	}
+}
+
+func (m *Model) resume(reason string) {
+	m.Stats.Resume(reason)
+	if m.prober != nil {
+		m.prober.Resume()
+	}
+}
+
+// togglePause is the pause key, and any other key while paused. Resuming over an automatic pause holds until
+// the network changes, so that a metered connection the user is happy to
+// use isn't paused again at the next check.
+func (m *Model) togglePause() {
+	if m.Stats.Paused == nil {
+		m.pause("paused by hand", false)
+		return
+	}
+
+	if m.Stats.Paused.Automatic {
+		m.pauseOverride = true
+	}
+	m.resume("resumed by hand")
+}
+
+type networkMsg struct {
+	// network identifies the connection by interface and gateway, to tell
+	// when it changes.
+	network string
+	// reason says why probing should pause, empty when it needn't.
+	reason string
+}
+
+func (m Model) checkNetwork() tea.Msg {
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+
+	var reason, iface string
+	if addr, err := ping.Resolve(ctx, m.Host, m.family); err == nil {
+		if class := target.Classify(addr); class != target.GLOBAL && looksPublic(m.Host) {
+			reason = fmt.Sprintf("a captive portal is suspected, %s resolves to %s, a %s address", m.Host, addr, class)
+		}
+		iface, _ = route.Lookup(ctx, addr.String())
+	}
+
+	gateway, _ := route.Gateway(ctx)
+	if reason == "" {
+		if metered, how, err := route.Metered(ctx, iface, gateway); err == nil && metered {
+			reason = "the connection is metered: " + how
+		}
+	}
+
+	return networkMsg{network: iface + " via " + gateway, reason: reason}
+}
+
+func (m Model) networkTick() tea.Cmd {
+	every := NETWORK_CHECK_INTERVAL
+	if m.lowPower {
+		every = LOW_POWER_ROUTE_CHECK_INTERVAL
+	}
+
+	return tea.Tick(every, func(time.Time) tea.Msg { return m.checkNetwork() })
+}
+
+// applyNetwork pauses on a metered or captive connection and resumes once
+// it's gone, leaving pauses made by hand alone. A change of network ends any
+// override made with the pause key.
+func (m *Model) applyNetwork(msg networkMsg) {
+	if msg.network != m.network {
+		m.network = msg.network
+		m.pauseOverride = false
+	}
+
+	switch paused := m.Stats.Paused; {
+	case msg.reason != "" && paused == nil && !m.pauseOverride:
+		m.pause(msg.reason, true)
+	case msg.reason == "" && paused != nil && paused.Automatic:
+		m.resume("the connection no longer looks metered or captive")
+	}
+}
@@ -0,0 +1,178 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestPause pauses a run with a fake clock and checks that the time
+// paused isn't counted as loss, that an automatic pause resumed by hand
+// stays resumed until the network changes, and that a pause made by hand
+// outlasts the network going back to normal.
+func TestPause(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := Model{Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)}
+	s := &m.Stats
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = now
+	s.Loss = stats.NewLossTracker(time.Second, 2*time.Second, 5*time.Second, time.Minute)
+
+	reply := func(seconds int, epoch int, seq int) {
+		now = time.Date(2024, 1, 1, 0, 0, seconds, 0, time.UTC)
+		s.AdvanceLoss()
+		s.Observe(ping.Result{Seq: seq, Epoch: epoch, Duration: 10 * time.Millisecond})
+		s.Update(10 * time.Millisecond)
+	}
+
+	for seq := 1; seq <= 3; seq++ {
+		reply(seq, 1, seq)
+	}
+	m.applyNetwork(networkMsg{network: "wlan0 via 172.20.10.1", reason: "the connection is metered"})
+	if s.Paused == nil || !s.Paused.Automatic {
+		t.Fatalf("a metered network pauses probing: expected an automatic pause, got %+v", s.Paused)
+	}
+
+	// A minute passes with nothing sent, then probing starts again from a
+	// new epoch.
+	now = now.Add(time.Minute)
+	s.AdvanceLoss()
+	m.togglePause()
+	for seq := 1; seq <= 3; seq++ {
+		reply(64+seq, 2, seq)
+	}
+
+	if sent, lost := s.Loss.Settled(); lost != 0 {
+		t.Fatalf("time paused isn't counted as loss: expected nothing lost, got %d of %d lost", lost, sent)
+	}
+	if gaps := s.PauseGaps(); len(gaps) != 1 || gaps[0].End == nil || gaps[0].End.Sub(gaps[0].Start) != time.Minute {
+		t.Fatalf("the pause is kept as a gap: expected one closed gap a minute long, got %+v", gaps)
+	}
+
+	steps := []struct {
+		name   string
+		msg    *networkMsg
+		toggle bool
+		paused string
+	}{
+		{"resumed by hand on the same metered network", &networkMsg{network: "wlan0 via 172.20.10.1", reason: "metered"}, false, ""},
+		{"another metered network ends the override", &networkMsg{network: "wwan0 via 10.0.0.1", reason: "metered"}, false, "automatic"},
+		{"a network that isn't metered resumes", &networkMsg{network: "eth0 via 192.168.1.1"}, false, ""},
+		{"paused by hand", nil, true, "manual"},
+		{"a pause by hand outlasts a normal network", &networkMsg{network: "eth0 via 192.168.1.1"}, false, "manual"},
+	}
+	for _, step := range steps {
+		if step.toggle {
+			m.togglePause()
+		}
+		if step.msg != nil {
+			m.applyNetwork(*step.msg)
+		}
+		paused := ""
+		if s.Paused != nil {
+			paused = "manual"
+			if s.Paused.Automatic {
+				paused = "automatic"
+			}
+		}
+		if paused != step.paused {
+			t.Fatalf("%s: expected paused %q, got paused %q", step.name, step.paused, paused)
+		}
+	}
+
+	if metered, _, _ := route.Metered(context.Background(), "", "172.20.10.1"); !metered {
+		t.Fatalf("a phone hotspot's gateway counts as metered: expected metered, got not metered")
+	}
+}
+
+// TestPauseExports runs for ten minutes with two of them paused and
+// half a minute lost, checking availability is over the eight minutes
+// probed, windows count the time paused in them, and the results file marks
+// where the pause started and ended.
+func TestPauseExports(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m := Model{Host: "example.com", Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)}
+	s := &m.Stats
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+	s.Loss = stats.NewLossTracker(time.Second, 2*time.Second, 5*time.Second, time.Minute)
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("nettest-pauses-%d.jsonl", os.Getpid()))
+	defer os.Remove(path)
+	results, err := openResults(path, "", false)
+	if err != nil {
+		t.Fatalf("open the results file: expected no error, got %v", err)
+	}
+	m.results = results
+
+	epoch, seq := 1, 0
+	for second := 1; second <= 600; second++ {
+		now = start.Add(time.Duration(second) * time.Second)
+		s.AdvanceLoss()
+		switch {
+		case second == 120:
+			m.pause("paused by hand", false)
+		case second == 240:
+			m.resume("resumed by hand")
+			epoch, seq = 2, 0
+		}
+		m.ExportSamples(nil)
+		if s.Paused != nil {
+			continue
+		}
+
+		seq++
+		if second >= 300 && second < 330 {
+			continue
+		}
+		result := ping.Result{Seq: seq, Epoch: epoch, Duration: 10 * time.Millisecond}
+		s.Observe(result)
+		s.Update(result.Duration)
+	}
+	s.AdvanceLoss()
+
+	availability, probed, paused := s.Availability(now)
+	if probed != 8*time.Minute || paused != 2*time.Minute || math.Abs(availability-0.9375) > 1e-9 {
+		t.Fatalf("availability leaves the pause out of the time probed: expected 93.75%% over 8m0s probed, 2m0s paused, got %.2f%% over %s probed, %s paused", availability*100, probed, paused)
+	}
+	if window := s.PausedTime(start.Add(100*time.Second), start.Add(200*time.Second)); window != 80*time.Second {
+		t.Fatalf("a window overlapping the start of the pause: expected 80s paused, got %q", window.String())
+	}
+
+	if err := results.Close(s); err != nil {
+		t.Fatalf("close the results file: expected no error, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read the results file: expected no error, got %v", err)
+	}
+	var marks []string
+	var summary struct {
+		Summary stats.ResultsSummary `json:"summary"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var sample stats.ResultSample
+		if json.Unmarshal([]byte(line), &sample); sample.Event != "" {
+			marks = append(marks, fmt.Sprintf("%s %s at %s", sample.Event, sample.Reason, sample.Time.Sub(start)))
+		}
+		json.Unmarshal([]byte(line), &summary)
+	}
+	if want := []string{"pause_start paused by hand at 2m0s", "pause_end resumed by hand at 4m0s"}; !slices.Equal(marks, want) {
+		t.Fatalf("the results file records the pause starting and ending: expected %q, got %q", want, marks)
+	}
+	if summary.Summary.ProbedS != 480 || summary.Summary.PausedS != 120 || math.Abs(summary.Summary.AvailabilityPct-93.75) > 1e-9 {
+		t.Fatalf("the results summary has the availability: expected 93.75%% over 480s, 120s paused, got %+v", summary.Summary)
+	}
+}
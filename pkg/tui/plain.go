@@ -0,0 +1,360 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"ponglehub.co.uk/nettest/pkg/ifstat"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	MIN_TUI_WIDTH  = 60
+	MIN_TUI_HEIGHT = 15
+)
+
+type terminalInfo struct {
+	StdoutTTY bool
+	// stdinTTY is whether keys can be read, the interactive UI's
+	// only input.
+	stdinTTY bool
+	term     string
+	emacs    bool
+	Width    int
+	height   int
+}
+
+func DetectTerminal() terminalInfo {
+	info := terminalInfo{
+		StdoutTTY: term.IsTerminal(os.Stdout.Fd()),
+		stdinTTY:  term.IsTerminal(os.Stdin.Fd()),
+		term:      os.Getenv("TERM"),
+		emacs:     os.Getenv("INSIDE_EMACS") != "",
+	}
+
+	if info.StdoutTTY {
+		info.Width, info.height, _ = term.GetSize(os.Stdout.Fd())
+	}
+
+	return info
+}
+
+// UseTUI decides whether the terminal can host the interactive UI. When it
+// can't, the reason is returned so that the fallback can be explained.
+func UseTUI(info terminalInfo, force bool) (bool, string) {
+	if force {
+		return true, ""
+	}
+
+	switch {
+	case !info.StdoutTTY:
+		return false, "stdout is not a terminal"
+	case !info.stdinTTY:
+		return false, "stdin is not a terminal, so keys can't be read"
+	case info.term == "" || info.term == "dumb":
+		return false, fmt.Sprintf("TERM=%q does not support the interactive display", info.term)
+	case info.emacs:
+		return false, "running inside an Emacs shell"
+	case info.Width > 0 && info.height > 0 && (info.Width < MIN_TUI_WIDTH || info.height < MIN_TUI_HEIGHT):
+		return false, fmt.Sprintf("terminal is %dx%d, smaller than the %dx%d needed (use --force-tui to try anyway)", info.Width, info.height, MIN_TUI_WIDTH, MIN_TUI_HEIGHT)
+	}
+
+	return true, ""
+}
+
+// plainOutput is how a display without bubbletea reports what happens.
+type plainOutput struct {
+	sample func(m *Model, result ping.Result)
+	window func(m *Model)
+	notice func(m *Model, notice ping.Notice)
+	done   func(m *Model)
+}
+
+func plainLines(out io.Writer) plainOutput {
+	stamp := func(m *Model) string { return m.Stats.Times.Stamp(m.Stats.Now()) }
+
+	return plainOutput{
+		sample: func(m *Model, result ping.Result) {
+			fmt.Fprintf(out, "%s %s %s\n", stamp(m), m.Host, stats.FormatLatency(result.Duration))
+		},
+		window: func(m *Model) {
+			line := fmt.Sprintf("%s %s window %s, %s", stamp(m), m.Host, m.Stats.RenderLastWindow(theme.Theme{}), m.Stats.PrintLoss(theme.Theme{}))
+			// The mean is the window's Avg already.
+			if stats.HeadlinePercentile(m.Stats.Headline) > 0 {
+				line += fmt.Sprintf(", %s %s", m.Stats.Headline, stats.FormatLatency(m.Stats.LastHeadline))
+			}
+			if call := m.Stats.LastCall(); call != nil {
+				line += fmt.Sprintf(", call %.1f (%s)", call.MOS, call.Rating)
+			}
+			if m.pinger != nil && m.pinger.Probes().Skipped() > 0 {
+				line += fmt.Sprintf(", %d ticks skipped", m.pinger.Probes().Skipped())
+			}
+			fmt.Fprintln(out, line)
+		},
+		notice: func(m *Model, notice ping.Notice) {
+			fmt.Fprintf(out, "%s %s %s %s\n", stamp(m), m.Host, notice.Kind, notice.Message)
+		},
+		done: func(m *Model) {
+			fmt.Fprintf(out, "%s %s totals %s%s, %s, %s\n", stamp(m), m.Host, m.Stats.TotalsString(), m.Stats.PrintPercentiles(), m.Stats.PrintLoss(theme.Theme{}), m.Stats.PrintAvailability())
+			if call := m.Stats.CallTotals(); call != nil {
+				fmt.Fprintf(out, "%s %s est. call quality %.1f (%s), R %.0f\n", stamp(m), m.Host, call.MOS, call.Rating, call.R)
+			}
+			if ttls := m.Stats.DistinctTTLs(); len(ttls) > 1 {
+				fmt.Fprintf(out, "%s %s %d distinct TTLs seen: %v\n", stamp(m), m.Host, len(ttls), ttls)
+			}
+			if m.Stats.Outages != nil {
+				for _, o := range m.Stats.Outages.Outages() {
+					fmt.Fprintf(out, "%s %s outage %s\n", stamp(m), m.Host, m.Stats.PrintOutage(theme.Theme{}, o))
+				}
+			}
+			if m.pinger != nil && m.pinger.Resolution().Failures > 0 {
+				fmt.Fprintf(out, "%s %s %d lookups of the host failed\n", stamp(m), m.Host, m.pinger.Resolution().Failures)
+			}
+			if m.Stats.Totals.Count > 0 {
+				fmt.Fprintln(out, m.Stats.PrintHistogram(theme.Theme{}, stats.HistogramLayout{Limit: m.histWidth}))
+			}
+		},
+	}
+}
+
+// singleLine keeps rewriting one line in place with a carriage return, so
+// that scrollback is left alone, and ends it with a newline on exit.
+func singleLine(out io.Writer, width int) plainOutput {
+	previous := 0
+	write := func(line string) {
+		line = truncate(line, width-1)
+		length := len([]rune(line))
+		fmt.Fprint(out, "\r"+line+strings.Repeat(" ", max(previous-length, 0)))
+		previous = length
+	}
+
+	render := func(m *Model) {
+		figure := "-"
+		if headline, ok := m.Stats.WindowHeadline(); ok {
+			figure = stats.FormatLatency(headline)
+		}
+
+		rolling, _, _ := m.Stats.Loss.Rolling(m.Stats.Now())
+		write(fmt.Sprintf("%s  last %s  %s %s  loss %.1f%%  (%d samples)", m.Host, stats.FormatLatency(m.last.Duration), stats.HeadlineLabel(m.Stats.Headline), figure, rolling*100, m.Stats.Totals.Count))
+	}
+
+	return plainOutput{
+		sample: func(m *Model, result ping.Result) { render(m) },
+		window: render,
+		notice: func(m *Model, notice ping.Notice) {},
+		done: func(m *Model) {
+			render(m)
+			fmt.Fprintln(out)
+		},
+	}
+}
+
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if width <= 0 || len(runes) <= width {
+		return line
+	}
+	if width == 1 {
+		return "…"
+	}
+
+	return string(runes[:width-1]) + "…"
+}
+
+// runPlain prints a line per sample and per completed window, driving the
+// same Stats as the TUI so that both report the same numbers.
+func runPlain(ctx context.Context, m Model, out io.Writer) (Model, error) {
+	return drivePlain(ctx, m, plainLines(out))
+}
+
+func runLine(ctx context.Context, m Model, out io.Writer, width int) (Model, error) {
+	return drivePlain(ctx, m, singleLine(out, width))
+}
+
+func drivePlain(ctx context.Context, m Model, output plainOutput) (Model, error) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer output.done(&m)
+
+	if m.counters != nil {
+		m.Stats.Route = m.checkRoute().(routeMsg).iface
+	}
+
+	if m.Stats.Paused != nil {
+		m.prober.Pause()
+	}
+	m.pings, m.errs = m.prober.Run(ctx)
+
+	interval := m.Stats.ProbeInterval()
+	ticker := time.NewTicker(max(interval, time.Second))
+	defer ticker.Stop()
+
+	var network <-chan time.Time
+	if m.pauseMetered {
+		check := time.NewTicker(NETWORK_CHECK_INTERVAL)
+		defer check.Stop()
+		network = check.C
+	}
+
+	var answers <-chan time.Time
+	if m.answers != nil {
+		check := time.NewTicker(m.answers.every)
+		defer check.Stop()
+		answers = check.C
+	}
+
+	// Events are reported as they are logged, whether they came from the
+	// prober or from the stats, such as alerts opening and closing.
+	reported := len(m.Stats.Events)
+	report := func() {
+		for _, event := range m.Stats.Events[reported:] {
+			output.notice(&m, ping.Notice{Kind: event.Kind, Message: event.Message})
+		}
+		reported = len(m.Stats.Events)
+	}
+
+	deadline, stopDeadline := m.limit.timer()
+	defer stopDeadline()
+
+	// Windows close on a timer of their own as well as on the replies, so
+	// that one with none still closes, and then again as the next ends.
+	windows := time.NewTimer(m.untilWindowEnd())
+	defer windows.Stop()
+	closed := func(windows []stats.ClosedWindow) error {
+		for _, w := range windows {
+			m.WindowComplete(w)
+		}
+		output.window(&m)
+
+		if m.state != "" {
+			if err := stats.SaveState(m.state, &m.Stats); err != nil {
+				return err
+			}
+		}
+		return m.crash.checkpoint(&m.Stats, "")
+	}
+
+	// The pinger giving up on an error it may get past is run again once
+	// retry fires.
+	var retry <-chan time.Time
+	exited := func(err error) error {
+		delay, err := m.pingerStopped(err, time.Now())
+		if err == nil && delay > 0 {
+			report()
+			m.pings, m.errs = nil, nil
+			retry = time.After(delay)
+		}
+		return err
+	}
+
+	for {
+		if m.limit.reached(&m.Stats, time.Now()) {
+			return m, nil
+		}
+
+		select {
+		case <-deadline:
+			return m, nil
+		case <-ticker.C:
+			m.Stats.AdvanceLoss()
+			m.alertSilence(time.Now())
+			m.sampleSelf(time.Now())
+			if m.Stats.ProbeInterval() != interval {
+				interval = m.Stats.ProbeInterval()
+				ticker.Reset(max(interval, time.Second))
+			}
+			report()
+			if err := m.ExportSamples(nil); err != nil {
+				return m, err
+			}
+		case <-windows.C:
+			if windows := m.Stats.CloseWindows(m.Stats.Now()); len(windows) > 0 {
+				report()
+				if err := closed(windows); err != nil {
+					return m, err
+				}
+			}
+			windows.Reset(m.untilWindowEnd())
+		case <-network:
+			m.applyNetwork(m.checkNetwork().(networkMsg))
+			report()
+		case <-answers:
+			m.applyAnswers(m.checkAnswers().(answersMsg))
+			report()
+		case <-retry:
+			retry = nil
+			m.rerunPinger(ctx)
+		case result, ok := <-m.pings:
+			if !ok {
+				if err := exited(<-m.errs); err != nil || retry == nil {
+					return m, err
+				}
+				continue
+			}
+
+			if m.Stats.Paused != nil {
+				m.Stats.Paused.Skipped++
+				continue
+			}
+
+			if result.Lost {
+				if windows := m.Stats.Observe(result); len(windows) > 0 {
+					report()
+					if err := closed(windows); err != nil {
+						return m, err
+					}
+				}
+				if err := m.ExportSamples(nil); err != nil {
+					return m, err
+				}
+				continue
+			}
+
+			m.Stats.SampleIndex++
+			result.Index = m.Stats.SampleIndex
+			m.last = result
+			m.received = true
+			m.replied()
+			windows := m.Stats.Observe(result)
+			if m.counters != nil && m.Stats.Route != "" {
+				if counters, err := ifstat.Read(ctx, m.Stats.Route); err == nil {
+					m.counters.Add(m.Stats.Route, counters, time.Now())
+				}
+			}
+
+			// The reply is the next window's, so comes after the line for
+			// the one it closed.
+			if windows = append(windows, m.Stats.UpdateAt(result.Duration, result.At)...); len(windows) > 0 {
+				if err := closed(windows); err != nil {
+					return m, err
+				}
+			}
+			output.sample(&m, result)
+			report()
+			m.crash.record(m.Stats)
+			if err := m.ExportSamples(&result); err != nil {
+				return m, err
+			}
+		case notice := <-m.prober.Notices():
+			err := m.noticed(notice)
+			report()
+			if err != nil {
+				return m, err
+			}
+		case command := <-m.control:
+			m.handleControl(command)
+			report()
+		case <-ctx.Done():
+			return m, nil
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestUseTUI checks each reason the interactive display is given up for a
+// plain one, and that --force-tui overrides them all.
+func TestUseTUI(t *testing.T) {
+	usable := terminalInfo{StdoutTTY: true, stdinTTY: true, term: "xterm-256color", Width: 120, height: 40}
+	with := func(change func(info *terminalInfo)) terminalInfo {
+		info := usable
+		change(&info)
+		return info
+	}
+
+	cases := []struct {
+		name   string
+		info   terminalInfo
+		force  bool
+		ok     bool
+		reason string
+	}{
+		{"a terminal", usable, false, true, ""},
+		{"stdout not a terminal", with(func(i *terminalInfo) { i.StdoutTTY, i.Width, i.height = false, 0, 0 }), false, false, "stdout is not a terminal"},
+		{"stdin not a terminal", with(func(i *terminalInfo) { i.stdinTTY = false }), false, false, "stdin is not a terminal"},
+		{"TERM dumb", with(func(i *terminalInfo) { i.term = "dumb" }), false, false, `TERM="dumb"`},
+		{"TERM unset", with(func(i *terminalInfo) { i.term = "" }), false, false, `TERM=""`},
+		{"inside Emacs", with(func(i *terminalInfo) { i.emacs = true }), false, false, "Emacs"},
+		{"too narrow", with(func(i *terminalInfo) { i.Width = MIN_TUI_WIDTH - 1 }), false, false, "terminal is 59x40, smaller than the 60x15 needed"},
+		{"too short", with(func(i *terminalInfo) { i.height = MIN_TUI_HEIGHT - 1 }), false, false, "terminal is 120x14"},
+		{"the smallest", with(func(i *terminalInfo) { i.Width, i.height = MIN_TUI_WIDTH, MIN_TUI_HEIGHT }), false, true, ""},
+		{"no size", with(func(i *terminalInfo) { i.Width, i.height = 0, 0 }), false, true, ""},
+		{"forced", terminalInfo{term: "dumb", emacs: true, Width: 10, height: 5}, true, true, ""},
+	}
+
+	for _, c := range cases {
+		ok, reason := UseTUI(c.info, c.force)
+		if ok != c.ok || (c.reason == "") != (reason == "") || !strings.Contains(reason, c.reason) {
+			t.Fatalf("%s: expected %t with %q, got %t with %q", c.name, c.ok, c.reason, ok, reason)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package tui
+
+import (
+	"context"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/probe"
+)
+
+// recordingProber passes another prober's results and notices on as they
+// come, writing each to the recording on the way.
+type recordingProber struct {
+	probe.Prober
+	recording *recordingFile
+	notices   chan ping.Notice
+}
+
+func newRecordingProber(ctx context.Context, inner probe.Prober, recording *recordingFile) *recordingProber {
+	r := &recordingProber{Prober: inner, recording: recording, notices: make(chan ping.Notice, ping.NOTICE_BUFFER_SIZE)}
+	go func() {
+		for {
+			select {
+			case notice := <-inner.Notices():
+				recording.Notice(notice, time.Now())
+				select {
+				case r.notices <- notice:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return r
+}
+
+func (r *recordingProber) Run(ctx context.Context) (<-chan ping.Result, <-chan error) {
+	pings, errs := r.Prober.Run(ctx)
+	recorded := make(chan ping.Result, ping.BUFFER_SIZE)
+	recordedErrs := make(chan error, 1)
+	go func() {
+		defer close(recorded)
+		defer close(recordedErrs)
+
+		for result := range pings {
+			r.recording.Result(result)
+			recorded <- result
+		}
+		if err := <-errs; err != nil {
+			recordedErrs <- err
+		}
+	}()
+
+	return recorded, recordedErrs
+}
+
+func (r *recordingProber) Notices() <-chan ping.Notice {
+	return r.notices
+}
+
+func (m Model) printRecording() string {
+	if m.recording == nil {
+		return ""
+	}
+	if err := m.recording.failed(); err != nil {
+		return m.theme.Alert.Render(err.Error())
+	}
+
+	return ""
+}
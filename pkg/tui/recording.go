@@ -0,0 +1,334 @@
+package tui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+const (
+	RECORDING_FORMAT = "network-test recording"
+	// RECORDING_VERSION is the version of the format written. Recordings in
+	// any version up to it can be replayed.
+	RECORDING_VERSION = 1
+	// RECORDING_FLUSH_INTERVAL bounds how much of a recording a crash can
+	// take with it.
+	RECORDING_FLUSH_INTERVAL = 2 * time.Second
+)
+
+// RecordingHeader is the first line of a recording: the run as it was set
+// up, for the replay to be set up the same.
+type RecordingHeader struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	RunID   string    `json:"run_id"`
+	Started time.Time `json:"started"`
+
+	Mode string `json:"mode"`
+	Host string `json:"host"`
+	Port int    `json:"port,omitempty"`
+	URL  string `json:"url,omitempty"`
+
+	IntervalS    float64   `json:"interval_s"`
+	WindowS      float64   `json:"window_s"`
+	ThresholdsMs []float64 `json:"thresholds_ms"`
+	Headline     string    `json:"headline"`
+	WarnMs       float64   `json:"warn_ms,omitempty"`
+	CritMs       float64   `json:"crit_ms,omitempty"`
+	WarnLossPct  float64   `json:"warn_loss_pct,omitempty"`
+	CritLossPct  float64   `json:"crit_loss_pct,omitempty"`
+
+	Metadata *stats.RunMetadata `json:"metadata,omitempty"`
+}
+
+// recordingEntry is each line after the header: a result as the prober
+// gave it or a notice of something it did, T nanoseconds into the run.
+type recordingEntry struct {
+	T      int64           `json:"t"`
+	Result *recordedResult `json:"result,omitempty"`
+	Notice *recordedNotice `json:"notice,omitempty"`
+}
+
+type recordedResult struct {
+	Epoch  int             `json:"epoch"`
+	Seq    int             `json:"seq"`
+	RTTNs  int64           `json:"rtt_ns,omitempty"`
+	TTL    int             `json:"ttl,omitempty"`
+	DNSNs  int64           `json:"dns_ns,omitempty"`
+	Phases []recordedPhase `json:"phases,omitempty"`
+	Lost   bool            `json:"lost,omitempty"`
+	Reason string          `json:"reason,omitempty"`
+	Status int             `json:"status,omitempty"`
+	Rcode  string          `json:"rcode,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Server string          `json:"server,omitempty"`
+}
+
+type recordedPhase struct {
+	Name string `json:"name"`
+	Ns   int64  `json:"ns"`
+}
+
+type recordedNotice struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+func newRecordedResult(result ping.Result) *recordedResult {
+	r := &recordedResult{
+		Epoch:  result.Epoch,
+		Seq:    result.Seq,
+		RTTNs:  int64(result.Duration),
+		TTL:    result.TTL,
+		DNSNs:  int64(result.DNS),
+		Lost:   result.Lost,
+		Reason: result.Reason,
+		Status: result.Status,
+		Rcode:  result.Rcode,
+		Error:  result.Error,
+		Server: result.Server,
+	}
+	for _, phase := range result.Phases {
+		r.Phases = append(r.Phases, recordedPhase{Name: phase.Name, Ns: int64(phase.Duration)})
+	}
+
+	return r
+}
+
+// result is the recorded result as the prober would give it at at.
+func (r *recordedResult) result(at time.Time) ping.Result {
+	result := ping.Result{
+		Epoch:    r.Epoch,
+		Seq:      r.Seq,
+		TTL:      r.TTL,
+		Duration: time.Duration(r.RTTNs),
+		DNS:      time.Duration(r.DNSNs),
+		At:       at,
+		Lost:     r.Lost,
+		Reason:   r.Reason,
+		Status:   r.Status,
+		Rcode:    r.Rcode,
+		Error:    r.Error,
+		Server:   r.Server,
+	}
+	for _, phase := range r.Phases {
+		result.Phases = append(result.Phases, ping.Phase{Name: phase.Name, Duration: time.Duration(phase.Ns)})
+	}
+
+	return result
+}
+
+// recordingFile writes a recording a line at a time, flushing every
+// RECORDING_FLUSH_INTERVAL so that a recording cut short by a crash is
+// still one that replays.
+type recordingFile struct {
+	path    string
+	started time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	buffer  *bufio.Writer
+	flushed time.Time
+	err     error
+}
+
+func CreateRecording(path string, header RecordingHeader) (*recordingFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %s", err)
+	}
+
+	header.Format, header.Version = RECORDING_FORMAT, RECORDING_VERSION
+	r := &recordingFile{path: path, started: header.Started, file: file, buffer: bufio.NewWriter(file), flushed: time.Now()}
+	r.write(header)
+	if err := r.failed(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *recordingFile) Result(result ping.Result) {
+	at := result.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	r.write(recordingEntry{T: int64(at.Sub(r.started)), Result: newRecordedResult(result)})
+}
+
+func (r *recordingFile) Notice(notice ping.Notice, at time.Time) {
+	r.write(recordingEntry{T: int64(at.Sub(r.started)), Notice: &recordedNotice{Kind: notice.Kind, Message: notice.Message}})
+}
+
+func (r *recordingFile) write(line any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	data, err := json.Marshal(line)
+	if err == nil {
+		_, err = r.buffer.Write(append(data, '\n'))
+	}
+	if err == nil && time.Since(r.flushed) >= RECORDING_FLUSH_INTERVAL {
+		err = r.buffer.Flush()
+		r.flushed = time.Now()
+	}
+	if err != nil {
+		r.err = fmt.Errorf("failed to write recording: %s", err)
+	}
+}
+
+func (r *recordingFile) failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func (r *recordingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.buffer.Flush(); err != nil && r.err == nil {
+		r.err = fmt.Errorf("failed to write recording: %s", err)
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = fmt.Errorf("failed to write recording: %s", err)
+	}
+
+	return r.err
+}
+
+// newRecordingHeader describes the run about to be recorded.
+func newRecordingHeader(m *Model, started time.Time) RecordingHeader {
+	s := &m.Stats
+	header := RecordingHeader{
+		RunID:   s.RunID,
+		Started: stats.Stored(started),
+
+		Mode: m.Target.Mode,
+		Host: m.Target.Host,
+		Port: m.Target.Port,
+		URL:  m.Target.URL,
+
+		IntervalS:   m.interval.Seconds(),
+		WindowS:     s.WindowSize.Seconds(),
+		Headline:    s.Headline,
+		WarnMs:      stats.Milliseconds(s.Levels.Warn),
+		CritMs:      stats.Milliseconds(s.Levels.Crit),
+		WarnLossPct: s.Levels.WarnLoss * 100,
+		CritLossPct: s.Levels.CritLoss * 100,
+
+		Metadata: s.Metadata,
+	}
+	for _, threshold := range s.Histogram.Thresholds() {
+		header.ThresholdsMs = append(header.ThresholdsMs, stats.Milliseconds(threshold))
+	}
+
+	return header
+}
+
+// Recording is a recording read back whole.
+type Recording struct {
+	Header  RecordingHeader
+	Entries []recordingEntry
+}
+
+func (r *Recording) Target() target.Target {
+	return target.Target{Mode: r.Header.Mode, Host: r.Header.Host, Port: r.Header.Port, URL: r.Header.URL}
+}
+
+func (r *Recording) Levels() stats.Levels {
+	h := r.Header
+	return stats.Levels{
+		Warn:     time.Duration(h.WarnMs * float64(time.Millisecond)),
+		Crit:     time.Duration(h.CritMs * float64(time.Millisecond)),
+		WarnLoss: h.WarnLossPct / 100,
+		CritLoss: h.CritLossPct / 100,
+	}
+}
+
+func (r *Recording) Thresholds() []time.Duration {
+	thresholds := make([]time.Duration, len(r.Header.ThresholdsMs))
+	for i, ms := range r.Header.ThresholdsMs {
+		thresholds[i] = time.Duration(ms * float64(time.Millisecond))
+	}
+
+	return thresholds
+}
+
+// Length is how far into the run the last entry is.
+func (r *Recording) Length() time.Duration {
+	if len(r.Entries) == 0 {
+		return 0
+	}
+
+	return time.Duration(r.Entries[len(r.Entries)-1].T)
+}
+
+func LoadRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %s", err)
+	}
+	defer file.Close()
+
+	return ReadRecording(file, path)
+}
+
+// ReadRecording reads a recording in any version of the format up to
+// RECORDING_VERSION. A last line cut short, by the recorder being killed
+// mid-write, is left out rather than failing the whole replay.
+func ReadRecording(in io.Reader, name string) (*Recording, error) {
+	reader := bufio.NewReader(in)
+	line, err := reader.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read recording: %s", err)
+	}
+
+	r := &Recording{}
+	if err := json.Unmarshal(line, &r.Header); err != nil || r.Header.Format != RECORDING_FORMAT {
+		return nil, fmt.Errorf("%s isn't a network-test recording", name)
+	}
+	switch {
+	case r.Header.Version > RECORDING_VERSION:
+		return nil, fmt.Errorf("%s is in version %d of the recording format, newer than the %d this build reads, so needs a newer network-test", name, r.Header.Version, RECORDING_VERSION)
+	case r.Header.Version < 1:
+		return nil, fmt.Errorf("%s has no valid recording format version", name)
+	}
+
+	for number := 2; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry recordingEntry
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("failed to read recording: line %d: %s", number, jsonErr)
+			}
+			r.Entries = append(r.Entries, entry)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %s", err)
+		}
+	}
+
+	return r, nil
+}
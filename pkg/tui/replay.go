@@ -0,0 +1,259 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// replayClock is the recording's time as the replay has it, running on
+// from at, as of wall, at speed, and standing still while paused.
+type replayClock struct {
+	speed float64
+
+	mu     sync.Mutex
+	at     time.Time
+	wall   time.Time
+	paused bool
+}
+
+func newReplayClock(at time.Time, speed float64) *replayClock {
+	return &replayClock{speed: speed, at: at, wall: time.Now()}
+}
+
+func (c *replayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now()
+}
+
+func (c *replayClock) now() time.Time {
+	if c.paused {
+		return c.at
+	}
+
+	return c.at.Add(time.Duration(float64(time.Since(c.wall)) * c.speed))
+}
+
+func (c *replayClock) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.at, c.paused = c.now(), true
+}
+
+func (c *replayClock) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wall, c.paused = time.Now(), false
+}
+
+// until is how long to wait, by the wall clock, for the recording to get
+// to at.
+func (c *replayClock) until(at time.Time) time.Duration {
+	return time.Duration(float64(at.Sub(c.Now())) / c.speed)
+}
+
+// ReplayProber stands in for the pinger, giving the recording's results and
+// notices at the times they came, by its clock. Pausing it stops the clock,
+// so that nothing is skipped, and each resume starts a new epoch, as the
+// pinger's backend starting again would.
+type ReplayProber struct {
+	recording *Recording
+	path      string
+	Clock     *replayClock
+	notices   chan ping.Notice
+
+	mu      sync.Mutex
+	next    int
+	paused  bool
+	resumed chan struct{}
+	// epoch counts the epochs given out, a new one with each of the
+	// recording's and after each pause.
+	epoch    int
+	recorded int
+	fresh    bool
+}
+
+func NewReplayProber(r *Recording, path string, speed float64, seek time.Duration) *ReplayProber {
+	next, _ := slices.BinarySearchFunc(r.Entries, int64(seek), func(entry recordingEntry, t int64) int {
+		return int(min(max(entry.T-t, -1), 1))
+	})
+
+	return &ReplayProber{
+		recording: r,
+		path:      path,
+		Clock:     newReplayClock(r.Header.Started.Add(seek), speed),
+		notices:   make(chan ping.Notice, ping.NOTICE_BUFFER_SIZE),
+		next:      next,
+		resumed:   make(chan struct{}),
+	}
+}
+
+func (p *ReplayProber) Notices() <-chan ping.Notice {
+	return p.notices
+}
+
+func (p *ReplayProber) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		p.paused = true
+		p.Clock.pause()
+	}
+}
+
+func (p *ReplayProber) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		p.paused, p.fresh = false, true
+		p.Clock.resume()
+		close(p.resumed)
+		p.resumed = make(chan struct{})
+	}
+}
+
+// waitResumed blocks while paused, reporting whether ctx let it go on.
+func (p *ReplayProber) waitResumed(ctx context.Context) bool {
+	for {
+		p.mu.Lock()
+		paused, resumed := p.paused, p.resumed
+		p.mu.Unlock()
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Finished is whether the whole recording has been played.
+func (p *ReplayProber) Finished() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.next == len(p.recording.Entries)
+}
+
+// take is the next entry, once it's due, and the epoch its result goes in.
+func (p *ReplayProber) take() (recordingEntry, int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next == len(p.recording.Entries) {
+		return recordingEntry{}, 0, false
+	}
+
+	entry := p.recording.Entries[p.next]
+	p.next++
+	if result := entry.Result; result != nil && (p.epoch == 0 || p.fresh || result.Epoch != p.recorded) {
+		p.epoch++
+		p.recorded, p.fresh = result.Epoch, false
+	}
+
+	return entry, p.epoch, true
+}
+
+func (p *ReplayProber) due() (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next == len(p.recording.Entries) {
+		return time.Time{}, false
+	}
+
+	return p.recording.Header.Started.Add(time.Duration(p.recording.Entries[p.next].T)), true
+}
+
+// Run plays the recording from where it's got to, closing the channels once
+// it's all been played, as a pinger stopping for no reason does, which
+// leaves the display as it ended.
+func (p *ReplayProber) Run(ctx context.Context) (<-chan ping.Result, <-chan error) {
+	pings := make(chan ping.Result, ping.BUFFER_SIZE)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(pings)
+		defer close(errs)
+
+		for {
+			if !p.waitResumed(ctx) {
+				return
+			}
+			at, ok := p.due()
+			if !ok {
+				return
+			}
+			if wait := p.Clock.until(at); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			entry, epoch, ok := p.take()
+			if !ok {
+				return
+			}
+			if entry.Notice != nil {
+				select {
+				case p.notices <- ping.Notice{Kind: entry.Notice.Kind, Message: entry.Notice.Message}:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			if entry.Result == nil {
+				continue
+			}
+
+			result := entry.Result.result(at)
+			result.Epoch = epoch
+			select {
+			case pings <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return pings, errs
+}
+
+// line is the replay's progress, for under the header.
+func (p *ReplayProber) line(t theme.Theme, times stats.TimeFormat) string {
+	started := p.recording.Header.Started
+	now := p.Clock.Now()
+	if end := started.Add(p.recording.Length()); now.After(end) {
+		now = end
+	}
+	done := 1.0
+	if length := p.recording.Length(); length > 0 {
+		done = float64(now.Sub(started)) / float64(length)
+	}
+
+	state := fmt.Sprintf("at %s, %.0f%% through", times.Clock(now), done*100)
+	if p.Finished() {
+		state = "finished, at " + times.Clock(now)
+	}
+
+	return t.Muted.Render(fmt.Sprintf("Replay of %s, recorded %s, at %sx: %s", p.path, times.Stamp(started), strconv.FormatFloat(p.Clock.speed, 'f', -1, 64), state))
+}
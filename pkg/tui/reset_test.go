@@ -0,0 +1,103 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestReset checks the reset key starts the figures over, the rolling ones,
+// sparkline and baseline too, keeping the histogram's thresholds, the SLO's
+// budget and probing carrying on, and that while paused the results that
+// come in are skipped and any key resumes.
+func TestReset(t *testing.T) {
+	now := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	thresholds := []time.Duration{5 * time.Millisecond, 50 * time.Millisecond}
+	m := Model{Stats: stats.New(time.Second, 5*time.Second, thresholds), tabs: newTabSet(false)}
+	s := &m.Stats
+	s.Clock = func() time.Time { return now }
+	s.WindowStart, s.Started = now, now
+	s.Outages = stats.NewOutageTracker(stats.DEFAULT_OUTAGE_PROBES, time.Second, s.Clock)
+	s.Loss.Observe(s.Outages.Outcome)
+	s.Baseline = stats.NewMinRTT(time.Hour)
+	s.Spark = stats.NewSparkRing(stats.SPARK_SAMPLES, stats.DEFAULT_VIEW_WIDTH)
+	s.Loss.Observe(s.Spark.Observe)
+	slo, err := stats.ParseSLO("99%<80ms/30d")
+	if err != nil {
+		t.Fatalf("parse the SLO: expected no error, got %v", err)
+	}
+	s.SLO = stats.NewSLOTracker(slo)
+
+	seq := 0
+	probe := func(lost bool) {
+		now = now.Add(time.Second)
+		seq++
+		s.AdvanceLoss()
+		if !lost {
+			s.Observe(ping.Result{Seq: seq, Duration: 20 * time.Millisecond, Epoch: 1})
+			s.Update(20 * time.Millisecond)
+		}
+	}
+	key := func(k string) {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+		m = updated.(Model)
+		s = &m.Stats
+	}
+
+	for i := range 20 {
+		probe(i >= 5 && i < 9)
+	}
+	s.Update(100 * time.Millisecond)
+	budget := s.SLO.Status(now)
+	if s.Totals.Count == 0 || len(s.Outages.Outages()) != 1 {
+		t.Fatalf("the run has figures to reset: expected replies and an outage, got %d replies, %d outages", s.Totals.Count, len(s.Outages.Outages()))
+	}
+
+	events := len(s.Events)
+	key("r")
+	if s.Totals.Count != 0 || s.Histogram.Total() != 0 || s.Window.Count != 0 || len(s.Outages.Outages()) != 0 {
+		t.Fatalf("r starts the totals, the histogram, the window and the outages over: expected all empty, got %d replies, %d in the histogram, %d in the window, %d outages", s.Totals.Count, s.Histogram.Total(), s.Window.Count, len(s.Outages.Outages()))
+	}
+	if len(s.Recent) != 0 || s.Rolling.Total() != 0 || s.PrintBaseline() != "Baseline: -" || s.Spark.Lines(theme.Theme{}, false)[0] != "Sparkline: no samples yet" {
+		t.Fatalf("r starts the rolling figures, the baseline and the sparkline over: expected all empty, got %d recent, %d rolling, %q, %q", len(s.Recent), s.Rolling.Total(), s.PrintBaseline(), s.Spark.Lines(theme.Theme{}, false)[0])
+	}
+	if status := s.SLO.Status(now); status != budget || status.Compliance == 1 {
+		t.Fatalf("the SLO's budget is kept over a reset: expected %+v, got %+v", budget, status)
+	}
+	if !slices.Equal(s.Histogram.Thresholds(), thresholds) || len(s.Histogram.Buckets()) != len(thresholds) {
+		t.Fatalf("the histogram keeps its thresholds over a reset: expected %v, got %v", thresholds, s.Histogram.Thresholds())
+	}
+	if len(s.Events) != events+1 || s.Events[events].Kind != "reset" {
+		t.Fatalf("the events are kept, with the reset logged: expected %d events, the last a reset, got %+v", events+1, s.Events)
+	}
+
+	for range 3 {
+		probe(false)
+	}
+	if sent, lost := s.Loss.Settled(); s.Totals.Count != 3 || lost != 0 || sent != 3 {
+		t.Fatalf("probing carries on, counted from the reset: expected 3 replies, 3 sent, none lost, got %d replies, %d sent, %d lost", s.Totals.Count, sent, lost)
+	}
+
+	key(" ")
+	if s.Paused == nil {
+		t.Fatalf("space pauses: expected paused, got not paused")
+	}
+	updated, _ := m.Update(ping.Result{Seq: seq + 1, Duration: 20 * time.Millisecond, Epoch: 1})
+	m = updated.(Model)
+	s = &m.Stats
+	if s.Paused.Skipped != 1 || s.Totals.Count != 3 {
+		t.Fatalf("a result while paused is skipped, not counted: expected 1 skipped, 3 replies, got %d skipped, %d replies", s.Paused.Skipped, s.Totals.Count)
+	}
+	key("r")
+	if s.Paused != nil || s.Totals.Count != 3 {
+		t.Fatalf("any key resumes, rather than doing what it's bound to: expected resumed, 3 replies, got paused %v, %d replies", s.Paused != nil, s.Totals.Count)
+	}
+	if gaps := s.PauseGaps(); len(gaps) != 1 || gaps[0].Skipped != 1 {
+		t.Fatalf("the pause is kept with the results it skipped: expected one gap, 1 skipped, got %+v", gaps)
+	}
+}
@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+)
+
+// printResolution flags the host failing to resolve under the header: while
+// it has yet to resolve, when the next attempt is, and once it has, the
+// address probing carries on at.
+func (m Model) printResolution(now time.Time) string {
+	if m.pinger == nil {
+		return ""
+	}
+
+	r := m.pinger.Resolution()
+	switch {
+	case !r.Failing:
+		return ""
+	case !r.Address.IsValid():
+		line := r.Err
+		if !r.Retry.IsZero() {
+			line += fmt.Sprintf(", retrying in %s", max(r.Retry.Sub(now), 0).Round(time.Second))
+		}
+		return m.theme.Alert.Render(line)
+	default:
+		return m.theme.Warn.Render(fmt.Sprintf("%s, still probing %s where it last resolved", r.Err, r.Address))
+	}
+}
+
+// printResolutionFailures is the diagnostics tab's count of failed lookups,
+// or nothing when there have been none.
+func (m Model) printResolutionFailures() string {
+	if m.pinger == nil {
+		return ""
+	}
+
+	r := m.pinger.Resolution()
+	if r.Failures == 0 {
+		return ""
+	}
+
+	line := fmt.Sprintf("Resolution failures: %d", r.Failures)
+	if r.Failing {
+		return m.theme.Warn.Render(line + ", failing now: " + r.Err)
+	}
+
+	return m.theme.Muted.Render(line)
+}
@@ -0,0 +1,102 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	PINGER_RETRY_MIN = 5 * time.Second
+	PINGER_RETRY_MAX = time.Minute
+)
+
+// pingerExited is the pinger giving up, with what it gave up on, or nil when
+// it was stopped.
+type pingerExited struct {
+	err error
+}
+
+type restartPinger struct{}
+
+// pingerRestart is the pinger having given up on an error it may get past,
+// to be run again at the given time.
+type pingerRestart struct {
+	err error
+	at  time.Time
+}
+
+// pingerStopped decides what's done about the pinger giving up: nothing once
+// it was stopped, and quitting on the error for one that running it again
+// won't change, or once --max-restarts have gone without a reply. Anything
+// else is retried after the delay returned, which doubles with each attempt
+// until probes are answered again.
+func (m *Model) pingerStopped(err error, now time.Time) (time.Duration, error) {
+	if err == nil || ping.Fatal(err) {
+		return 0, err
+	}
+	if exhausted := m.restarted(); exhausted != nil {
+		return 0, fmt.Errorf("%s: %s", exhausted, err)
+	}
+
+	if m.retryDelay == 0 {
+		m.retryDelay = PINGER_RETRY_MIN
+	} else {
+		m.retryDelay = min(2*m.retryDelay, PINGER_RETRY_MAX)
+	}
+	m.restart = &pingerRestart{err: err, at: now.Add(m.retryDelay)}
+	m.Stats.AddEvent("restart", fmt.Sprintf("probing stopped (%s), starting again in %s", err, m.retryDelay))
+
+	return m.retryDelay, nil
+}
+
+// restarted counts a restart of the prober, by itself or by running it
+// again, and is the error of one past --max-restarts.
+func (m *Model) restarted() error {
+	m.restarts++
+	if m.maxRestarts > 0 && m.restarts > m.maxRestarts {
+		return fmt.Errorf("gave up after %d restarts without a reply", m.maxRestarts)
+	}
+
+	return nil
+}
+
+// noticed logs what the prober did by itself, counting its restarts.
+func (m *Model) noticed(notice ping.Notice) error {
+	m.Stats.AddEvent(notice.Kind, notice.Message)
+	if notice.Kind == "restart" || notice.Kind == "stall" {
+		return m.restarted()
+	}
+
+	return nil
+}
+
+// rerunPinger runs the pinger again after it gave up, in a new epoch so the
+// sequence numbers it starts over from aren't taken for old ones.
+func (m *Model) rerunPinger(ctx context.Context) {
+	m.restart = nil
+	m.pings, m.errs = m.prober.Run(ctx)
+}
+
+// replied is told of each probe answered, which ends the backoff of a
+// restarted pinger.
+func (m *Model) replied() {
+	m.retryDelay = 0
+	m.restarts = 0
+}
+
+// printRestart is the line shown from the prober restarting until it's
+// answered again.
+func (m Model) printRestart(t theme.Theme, now time.Time) string {
+	switch {
+	case m.restart != nil:
+		return t.Alert.Render(fmt.Sprintf("ping exited: %s - reconnecting in %s (attempt %d)", m.restart.err, max(m.restart.at.Sub(now), 0).Round(time.Second), m.restarts))
+	case m.restarts > 0:
+		return t.Alert.Render(fmt.Sprintf("reconnecting (attempt %d)", m.restarts))
+	}
+
+	return ""
+}
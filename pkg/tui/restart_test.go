@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+// TestPingerRestart checks the pinger giving up quits only on an error
+// running it again won't change, and is otherwise retried with a backoff that
+// an answered probe ends.
+func TestPingerRestart(t *testing.T) {
+	now := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	m := Model{Stats: stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS)}
+
+	if delay, err := m.pingerStopped(nil, now); delay != 0 || err != nil || m.restart != nil {
+		t.Fatalf("a pinger stopped on purpose is left stopped: expected no retry, got retry in %s, %v", delay, err)
+	}
+	for _, fatal := range []error{&ping.PermissionError{Detail: "no"}, fmt.Errorf("failed to start: %w", &ping.FamilyError{Host: "example.com", Has: "IPv4", Wanted: "IPv6"})} {
+		if delay, err := m.pingerStopped(fatal, now); err != fatal || delay != 0 {
+			t.Fatalf("a fatal error quits: expected %v, got retry in %s, %v", fatal, delay, err)
+		}
+	}
+
+	exited := errors.New("exit status 2")
+	for _, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		delay, err := m.pingerStopped(exited, now)
+		if err != nil || delay != expected {
+			t.Fatalf("a transient error is retried, backing off up to a minute: expected %q, got %s, %v", expected.String(), delay, err)
+		}
+	}
+	if line := m.printRestart(theme.Theme{}, now.Add(15*time.Second)); line != "ping exited: exit status 2 - reconnecting in 45s (attempt 6)" {
+		t.Fatalf("the restart is shown, counting down: expected ping exited: exit status 2 - reconnecting in 45s (attempt 6), got %q", line)
+	}
+	if last := m.Stats.Events[len(m.Stats.Events)-1]; last.Kind != "restart" || !strings.Contains(last.Message, "exit status 2") {
+		t.Fatalf("the restart is logged: expected a restart event, got %s: %s", last.Kind, last.Message)
+	}
+
+	m.replied()
+	if delay, _ := m.pingerStopped(exited, now); delay != PINGER_RETRY_MIN {
+		t.Fatalf("an answered probe ends the backoff: expected %s, got %s", PINGER_RETRY_MIN, delay)
+	}
+}
+
+// TestReconnect checks the prober's restarts back off, are shown and
+// counted until a reply, give up past --max-restarts, and that the probes
+// missed while it was gone count as lost.
+func TestReconnect(t *testing.T) {
+	var delays []string
+	for attempt := 1; attempt <= 7; attempt++ {
+		delays = append(delays, ping.RestartDelay(attempt).String())
+	}
+	if got := strings.Join(delays, " "); got != "1s 2s 4s 8s 16s 30s 30s" {
+		t.Fatalf("restarts back off, doubling up to a cap: expected 1s 2s 4s 8s 16s 30s 30s, got %q", got)
+	}
+
+	m := Model{Stats: stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS), maxRestarts: 2}
+	restart := ping.Notice{Kind: "restart", Message: "exec backend stopped (exit status 2), restarting in 2s"}
+	for range 2 {
+		if err := m.noticed(restart); err != nil {
+			t.Fatalf("restarts up to --max-restarts carry on: expected no error, got %v", err)
+		}
+	}
+	if line := m.printRestart(theme.Theme{}, time.Now()); line != "reconnecting (attempt 2)" {
+		t.Fatalf("the restart is shown until a reply: expected reconnecting (attempt 2), got %q", line)
+	}
+	if last := m.Stats.Events[len(m.Stats.Events)-1]; last.Kind != "restart" || last.Message != restart.Message {
+		t.Fatalf("the restart is logged: expected %q, got %s: %s", restart.Message, last.Kind, last.Message)
+	}
+	if _, err := m.pingerStopped(errors.New("exit status 2"), time.Now()); err == nil || err.Error() != "gave up after 2 restarts without a reply: exit status 2" {
+		t.Fatalf("the run gives up past --max-restarts: expected gave up after 2 restarts without a reply: exit status 2, got %v", err)
+	}
+
+	m.replied()
+	if err := m.noticed(restart); err != nil || m.printRestart(theme.Theme{}, time.Now()) != "reconnecting (attempt 1)" {
+		t.Fatalf("a reply starts the count over: expected reconnecting (attempt 1), got %q", fmt.Sprint(m.printRestart(theme.Theme{}, time.Now()), err))
+	}
+	m.maxRestarts = 0
+	for range 100 {
+		if err := m.noticed(restart); err != nil {
+			t.Fatalf("with no --max-restarts it never gives up: expected no error, got %v", err)
+		}
+	}
+
+	// Replies to 1 to 5 a second apart, then ping gone for ten seconds:
+	// the probes due from 6 up to the one the new sequence starts at are
+	// lost, whether they were declared on the way or only at the restart.
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	loss := stats.NewLossTracker(time.Second, 2*time.Second, 10*time.Second, 0)
+	for seq := 1; seq <= 5; seq++ {
+		loss.Reply(seq, start.Add(time.Duration(seq)*time.Second))
+	}
+	back := start.Add(15 * time.Second)
+	loss.Advance(back)
+	loss.Restart(back)
+	loss.Reply(1, back)
+	if sent, lost := loss.Settled(); sent != 15 || lost != 9 {
+		t.Fatalf("the probes missed while ping was gone are lost: expected 9 of 15 lost, got %d of %d lost", lost, sent)
+	}
+}
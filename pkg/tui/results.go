@@ -0,0 +1,305 @@
+package tui
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	RESULTS_BUFFER         = 4096
+	RESULTS_FLUSH_INTERVAL = 2 * time.Second
+)
+
+var RESULTS_FORMATS = []string{"csv", "json", "jsonl"}
+
+var RESULTS_COLUMNS = []ExportColumn{
+	{"time", "timestamp", "when the reply arrived, or when the probe was given up on, in RFC 3339"},
+	{"host", "string", "target host"},
+	{"rtt_ms", "number, nullable", "round trip time, empty for lost probes"},
+	{"lost", "boolean", "true when no reply arrived in time"},
+	{"summary", "object", "written on exit: totals, histogram, loss counts, availability, outages, the worst minutes, the last windows completed and the worst of the run, the distinct TTLs, the call quality with --call-quality and the run metadata with the build, as in --version --json; the last line in jsonl, beside samples in json, and a .summary.json file beside csv"},
+	{"event", "string, nullable", "pause_start or pause_end on a record of probing pausing or resuming, with no rtt_ms, and empty for samples"},
+	{"reason", "string, nullable", "why probing paused or resumed, on a pause_start or pause_end record"},
+}
+
+// pauseSample is a pause starting or ending as a record among the samples.
+func pauseSample(host string, mark stats.PauseMark) stats.ResultSample {
+	return stats.ResultSample{Time: mark.Time, Host: host, Event: mark.Event, Reason: mark.Reason}
+}
+
+// resultsFile streams samples to a file from a goroutine of its own, so that
+// a slow disk can only cost samples, which are counted, and never holds up
+// probing or the display.
+type resultsFile struct {
+	path    string
+	format  string
+	file    *os.File
+	buffer  *bufio.Writer
+	csv     *csv.Writer
+	samples chan stats.ResultSample
+	done    chan struct{}
+	dropped atomic.Int64
+	written int
+
+	mu  sync.Mutex
+	err error
+
+	lost   []lostProbe
+	marked int
+}
+
+// ResultsFormat takes the format from the file's extension when none is
+// given.
+func resultsFormat(path string, format string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+		if !slices.Contains(RESULTS_FORMATS, format) {
+			format = "jsonl"
+		}
+	}
+
+	if !slices.Contains(RESULTS_FORMATS, format) {
+		return "", fmt.Errorf("unknown results format %q, expected one of: %s", format, strings.Join(RESULTS_FORMATS, ", "))
+	}
+
+	return format, nil
+}
+
+func openResults(path string, format string, appending bool) (*resultsFile, error) {
+	format, err := resultsFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	if appending && format == "json" {
+		return nil, fmt.Errorf("--results-append can't add to a json document, use jsonl or csv")
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results file: %s", err)
+	}
+
+	r := &resultsFile{
+		path:    path,
+		format:  format,
+		file:    file,
+		buffer:  bufio.NewWriter(file),
+		samples: make(chan stats.ResultSample, RESULTS_BUFFER),
+		done:    make(chan struct{}),
+	}
+
+	switch format {
+	case "csv":
+		r.csv = csv.NewWriter(r.buffer)
+		// Appending to a file that already has rows keeps its header.
+		if info, err := file.Stat(); err != nil || info.Size() == 0 {
+			r.csv.Write([]string{"time", "host", "rtt_ms", "lost", "event", "reason"})
+		}
+	case "json":
+		r.buffer.WriteString(`{"samples": [`)
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+func (r *resultsFile) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(RESULTS_FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sample, ok := <-r.samples:
+			if !ok {
+				return
+			}
+			r.write(sample)
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+func (r *resultsFile) write(sample stats.ResultSample) {
+	if r.failed() != nil {
+		return
+	}
+
+	var err error
+	switch r.format {
+	case "csv":
+		rtt := ""
+		if sample.RTTMs != nil {
+			rtt = strconv.FormatFloat(*sample.RTTMs, 'f', 3, 64)
+		}
+		err = r.csv.Write([]string{sample.Time.UTC().Format(stats.STORED_TIME), sample.Host, rtt, strconv.FormatBool(sample.Lost), sample.Event, sample.Reason})
+	default:
+		var line []byte
+		line, err = json.Marshal(sample)
+		if err == nil && r.format == "json" && r.written > 0 {
+			line = append([]byte(", "), line...)
+		}
+		if err == nil && r.format == "jsonl" {
+			line = append(line, '\n')
+		}
+		if err == nil {
+			_, err = r.buffer.Write(line)
+		}
+	}
+
+	r.written++
+	r.fail(err)
+}
+
+func (r *resultsFile) flush() {
+	if r.csv != nil {
+		r.csv.Flush()
+		r.fail(r.csv.Error())
+	}
+	r.fail(r.buffer.Flush())
+}
+
+func (r *resultsFile) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = fmt.Errorf("failed to write results file: %s", err)
+	}
+}
+
+func (r *resultsFile) failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// send never blocks: with the buffer full, the sample is dropped and
+// counted instead.
+func (r *resultsFile) send(sample stats.ResultSample) {
+	select {
+	case r.samples <- sample:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// observe takes each probe's fate from the loss tracker, keeping the losses
+// for the next record like the wide export does.
+func (r *resultsFile) observe(seq int, lost bool) {
+	if lost {
+		r.lost = append(r.lost, lostProbe{seq: seq, at: time.Now()})
+	}
+}
+
+// Close writes the summary, waiting for the samples still queued first.
+func (r *resultsFile) Close(s *stats.Stats) error {
+	close(r.samples)
+	<-r.done
+
+	sent, lost := s.Loss.Settled()
+	availability, probed, paused := s.Availability(s.Now())
+	summary := stats.ResultsSummary{
+		Totals:      s.Totals,
+		Histogram:   stats.HistogramStateOf(&s.Histogram),
+		Sent:        sent,
+		Lost:        lost,
+		Unreachable: s.Unreachable,
+		TTLs:        s.DistinctTTLs(),
+		Dropped:     r.dropped.Load(),
+
+		AvailabilityPct: availability * 100,
+		ProbedS:         probed.Seconds(),
+		PausedS:         paused.Seconds(),
+
+		Call:    s.CallTotals(),
+		Outages: s.OutageSummaries(),
+
+		WorstMinutes: s.WorstMinuteSummaries(),
+		Windows:      s.Windows(),
+		WorstWindow:  s.WorstWindow(),
+
+		Metadata: s.Metadata,
+	}
+
+	data, err := json.Marshal(summary)
+	r.fail(err)
+	if r.failed() == nil {
+		switch r.format {
+		case "csv":
+			r.fail(os.WriteFile(r.path+".summary.json", data, 0o644))
+		case "json":
+			_, err := fmt.Fprintf(r.buffer, `], "summary": %s}`+"\n", data)
+			r.fail(err)
+		default:
+			_, err := fmt.Fprintf(r.buffer, `{"summary": %s}`+"\n", data)
+			r.fail(err)
+		}
+	}
+
+	r.flush()
+	r.fail(r.file.Close())
+
+	return r.failed()
+}
+
+// recordResults queues the probes given up on and the pauses since the last
+// call, then result if there is one.
+func (m *Model) recordResults(result *ping.Result) {
+	r := m.results
+	if r == nil {
+		return
+	}
+
+	for _, probe := range r.lost {
+		r.send(stats.ResultSample{Time: probe.at, Host: m.Host, Lost: true})
+	}
+	r.lost = r.lost[:0]
+
+	for _, mark := range m.Stats.Marks[r.marked:] {
+		r.send(pauseSample(m.Host, mark))
+	}
+	r.marked = len(m.Stats.Marks)
+
+	if result != nil {
+		rtt := float64(result.Duration.Microseconds()) / 1000
+		r.send(stats.ResultSample{Time: time.Now(), Host: m.Host, RTTMs: &rtt})
+	}
+}
+
+func (m Model) printResults() string {
+	r := m.results
+	if err := r.failed(); err != nil {
+		return m.theme.Alert.Render(err.Error())
+	}
+
+	if dropped := r.dropped.Load(); dropped > 0 {
+		return m.theme.Warn.Render(fmt.Sprintf("Results file: %d samples dropped, the disk is falling behind", dropped))
+	}
+
+	return ""
+}
@@ -0,0 +1,65 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestResultsFile writes results into a pipe nobody is reading yet,
+// standing in for a disk that can't keep up, and checks that sending never
+// blocks, that what couldn't be queued is counted, and that the summary
+// still ends the file once the reader catches up.
+func TestResultsFile(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("create pipe: expected no error, got %v", err)
+	}
+	defer r.Close()
+
+	results, err := openResults(fmt.Sprintf("/dev/fd/%d", w.Fd()), "jsonl", true)
+	w.Close()
+	if err != nil {
+		t.Fatalf("open results: expected no error, got %v", err)
+	}
+
+	start := time.Now()
+	rtt := 12.5
+	for i := 0; i < 4*RESULTS_BUFFER; i++ {
+		results.send(stats.ResultSample{Time: start, Host: "selftest", RTTMs: &rtt})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("sending while the disk is behind: expected no blocking, got took %s", elapsed)
+	}
+	if results.dropped.Load() == 0 {
+		t.Fatalf("samples that can't be queued: expected dropped and counted, got none dropped")
+	}
+
+	read := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		read <- data
+	}()
+
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	if err := results.Close(&s); err != nil {
+		t.Fatalf("close results: expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(<-read)), "\n")
+	var last struct {
+		Summary stats.ResultsSummary `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil || last.Summary.Dropped != results.dropped.Load() {
+		t.Fatalf("the last line: expected a summary counting %d dropped, got %q", results.dropped.Load(), lines[len(lines)-1])
+	}
+	if written := len(lines) - 1; int64(written)+results.dropped.Load() != 4*RESULTS_BUFFER {
+		t.Fatalf("every sample is written or counted dropped: expected %v, got %d written, %d dropped", 4*RESULTS_BUFFER, written, results.dropped.Load())
+	}
+}
@@ -0,0 +1,7 @@
+package tui
+
+type ExportColumn struct {
+	Name        string
+	Type        string
+	Description string
+}
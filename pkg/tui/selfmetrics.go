@@ -0,0 +1,227 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+const (
+	SELF_SAMPLE_INTERVAL = 5 * time.Second
+	// SELF_WARN_AT is how full the heap budget or a queue gets before it's
+	// logged, and SELF_CLEAR_AT how far it has to fall again before it's
+	// logged as easing, so that one hovering at the line isn't logged on
+	// every sample.
+	SELF_WARN_AT  = 0.9
+	SELF_CLEAR_AT = 0.75
+
+	METRIC_HEAP       = "/memory/classes/heap/objects:bytes"
+	METRIC_GOROUTINES = "/sched/goroutines:goroutines"
+	METRIC_GC_CYCLES  = "/gc/cycles/total:gc-cycles"
+	METRIC_GC_PAUSES  = "/sched/pauses/total/gc:seconds"
+)
+
+// selfReport is what the process reports on itself: its memory, what it
+// keeps of the run and how far behind its sinks are.
+type selfReport struct {
+	At         time.Time        `json:"at"`
+	HeapBytes  uint64           `json:"heap_bytes"`
+	GCCycles   uint64           `json:"gc_cycles"`
+	GCPauseMs  float64          `json:"gc_pause_ms"`
+	Goroutines uint64           `json:"goroutines"`
+	Retained   int              `json:"retained_samples"`
+	Queues     []queueDepth     `json:"queues,omitempty"`
+	Dropped    map[string]int64 `json:"dropped,omitempty"`
+	BudgetMiB  int              `json:"budget_mib,omitempty"`
+}
+
+type queueDepth struct {
+	Name     string `json:"name"`
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+}
+
+func (q queueDepth) fill() float64 {
+	return float64(q.Depth) / float64(q.Capacity)
+}
+
+// selfMetrics samples the process every SELF_SAMPLE_INTERVAL, keeping the
+// last report and which warnings are open.
+type selfMetrics struct {
+	budget int
+	last   selfReport
+	warned map[string]bool
+}
+
+func newSelfMetrics(budget int) *selfMetrics {
+	return &selfMetrics{budget: budget, warned: map[string]bool{}}
+}
+
+// readRuntime reads the runtime's own figures. The GC pause total is only
+// as close as the histogram the runtime keeps of pauses allows.
+func readRuntime(report *selfReport) {
+	samples := []metrics.Sample{{Name: METRIC_HEAP}, {Name: METRIC_GOROUTINES}, {Name: METRIC_GC_CYCLES}, {Name: METRIC_GC_PAUSES}}
+	metrics.Read(samples)
+
+	for _, sample := range samples {
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			switch sample.Name {
+			case METRIC_HEAP:
+				report.HeapBytes = sample.Value.Uint64()
+			case METRIC_GOROUTINES:
+				report.Goroutines = sample.Value.Uint64()
+			case METRIC_GC_CYCLES:
+				report.GCCycles = sample.Value.Uint64()
+			}
+		case metrics.KindFloat64Histogram:
+			report.GCPauseMs = histogramTotal(sample.Value.Float64Histogram()) * 1000
+		}
+	}
+}
+
+// histogramTotal sums a runtime histogram, taking each count at the middle
+// of its bucket, or at its one finite edge for the buckets at either end.
+func histogramTotal(h *metrics.Float64Histogram) float64 {
+	var total float64
+	for i, count := range h.Counts {
+		low, high := h.Buckets[i], h.Buckets[i+1]
+		value := (low + high) / 2
+		switch {
+		case math.IsInf(low, -1):
+			value = high
+		case math.IsInf(high, 1):
+			value = low
+		}
+		total += float64(count) * value
+	}
+
+	return total
+}
+
+func (m *Model) selfReport(now time.Time) selfReport {
+	report := selfReport{At: now, Retained: m.Stats.Retained(), Dropped: map[string]int64{}, BudgetMiB: m.self.budget}
+	readRuntime(&report)
+	for _, s := range []*stats.Stats{m.gatewayStats, m.upstreamStats, m.dnsStats} {
+		if s != nil {
+			report.Retained += s.Retained()
+		}
+	}
+
+	if m.pinger != nil {
+		report.Dropped["display"] = m.pinger.Dropped()
+	}
+	if m.status != nil {
+		report.Queues = append(report.Queues, queueDepth{"status feed", len(m.status.frames), STATUS_BUFFER})
+		report.Dropped["status feed"] = m.status.dropped.Load()
+	}
+	if m.results != nil {
+		report.Queues = append(report.Queues, queueDepth{"results", len(m.results.samples), RESULTS_BUFFER})
+		report.Dropped["results"] = m.results.dropped.Load()
+	}
+	if m.webhook != nil {
+		report.Queues = append(report.Queues, queueDepth{"webhook", m.webhook.Queued(), webhook.QUEUE_SIZE})
+	}
+	if m.Forward != nil {
+		report.Queues = append(report.Queues, queueDepth{"forward", m.Forward.Sender.Queued(), webhook.QUEUE_SIZE})
+		report.Dropped["forward"] = m.Forward.droppedRun
+	}
+
+	return report
+}
+
+// sampleSelf reports on the process once SELF_SAMPLE_INTERVAL has passed
+// since it last did, logging the heap nearing its budget or a queue nearing
+// full, and each easing off again.
+func (m *Model) sampleSelf(now time.Time) {
+	if m.self == nil || now.Sub(m.self.last.At) < SELF_SAMPLE_INTERVAL {
+		return
+	}
+
+	report := m.selfReport(now)
+	m.self.last = report
+
+	if m.self.budget > 0 {
+		budget := float64(m.self.budget) * (1 << 20)
+		m.self.threshold(&m.Stats, "heap", float64(report.HeapBytes)/budget, fmt.Sprintf("of the %dMiB budget", m.self.budget))
+	}
+	for _, queue := range report.Queues {
+		m.self.threshold(&m.Stats, queue.Name+" queue", queue.fill(), fmt.Sprintf("of its %d", queue.Capacity))
+	}
+}
+
+func (sm *selfMetrics) threshold(s *stats.Stats, name string, fill float64, of string) {
+	switch {
+	case fill >= SELF_WARN_AT && !sm.warned[name]:
+		sm.warned[name] = true
+		s.AddEvent("memory", fmt.Sprintf("%s at %.0f%% %s", name, fill*100, of))
+	case fill < SELF_CLEAR_AT && sm.warned[name]:
+		delete(sm.warned, name)
+		s.AddEvent("memory", fmt.Sprintf("%s back down to %.0f%% %s", name, fill*100, of))
+	}
+}
+
+// printSelf is the diagnostics tab's report on the process, with anything
+// over the warning line picked out.
+func (m Model) printSelf() []string {
+	if m.self == nil || m.self.last.At.IsZero() {
+		return nil
+	}
+	report := m.self.last
+
+	heap := fmt.Sprintf("heap %s", formatBytes(report.HeapBytes))
+	if m.self.budget > 0 {
+		heap += fmt.Sprintf(" of %dMiB", m.self.budget)
+	}
+	lines := []string{
+		m.theme.Header.Render(fmt.Sprintf("Process (%s)", m.Stats.Times.Clock(report.At))),
+		fmt.Sprintf("  %s, %d GC cycles pausing %.1fms in all, %d goroutines", heap, report.GCCycles, report.GCPauseMs, report.Goroutines),
+		fmt.Sprintf("  %d samples and events retained", report.Retained),
+	}
+	if m.self.warned["heap"] {
+		lines[1] = m.theme.Warn.Render(lines[1])
+	}
+
+	if len(report.Queues) > 0 {
+		parts := make([]string, len(report.Queues))
+		for i, queue := range report.Queues {
+			parts[i] = fmt.Sprintf("%s %d/%d", queue.Name, queue.Depth, queue.Capacity)
+		}
+		line := "  queued: " + strings.Join(parts, ", ")
+		for _, queue := range report.Queues {
+			if m.self.warned[queue.Name+" queue"] {
+				line = m.theme.Warn.Render(line)
+				break
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	var dropped []string
+	for _, name := range []string{"display", "status feed", "results", "forward"} {
+		if count, ok := report.Dropped[name]; ok {
+			dropped = append(dropped, fmt.Sprintf("%s %d", name, count))
+		}
+	}
+	if len(dropped) > 0 {
+		lines = append(lines, "  dropped: "+strings.Join(dropped, ", "))
+	}
+
+	return lines
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.0fKiB", float64(n)/(1<<10))
+	}
+}
@@ -0,0 +1,61 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	m := Model{Stats: stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS), self: newSelfMetrics(1)}
+	m.status = &statusFeed{frames: make(chan []byte, STATUS_BUFFER)}
+	for range STATUS_BUFFER * 95 / 100 {
+		m.status.frames <- nil
+	}
+	m.Stats.Update(20 * time.Millisecond)
+
+	now := time.Now()
+	m.sampleSelf(now)
+	report := m.self.last
+	if report.HeapBytes == 0 || report.Goroutines == 0 {
+		t.Fatalf("the runtime's figures are read: expected heap and goroutines above zero, got heap %d, goroutines %d", report.HeapBytes, report.Goroutines)
+	}
+	if report.Retained == 0 {
+		t.Fatalf("retained samples are counted: expected above zero, got 0")
+	}
+
+	var messages []string
+	for _, event := range m.Stats.Events {
+		if event.Kind == "memory" {
+			messages = append(messages, event.Message)
+		}
+	}
+	expected := []string{"heap at", "status feed queue at 95% of its 1024"}
+	if len(messages) != 2 || !strings.HasPrefix(messages[0], expected[0]) || !strings.HasSuffix(messages[0], "of the 1MiB budget") || messages[1] != expected[1] {
+		t.Fatalf("crossing the warning line is logged once for each: expected %q, got %q", strings.Join(expected, "; "), strings.Join(messages, "; "))
+	}
+
+	logged := len(m.Stats.Events)
+	m.sampleSelf(now.Add(time.Second))
+	if len(m.Stats.Events) != logged || m.self.last.At != now {
+		t.Fatalf("sampling waits for SELF_SAMPLE_INTERVAL: expected %d events, sampled at %s, got %d events, sampled at %s", logged, now, len(m.Stats.Events), m.self.last.At)
+	}
+
+	for len(m.status.frames) > 0 {
+		<-m.status.frames
+	}
+	m.sampleSelf(now.Add(SELF_SAMPLE_INTERVAL))
+	last := m.Stats.Events[len(m.Stats.Events)-1]
+	if last.Message != "status feed queue back down to 0% of its 1024" {
+		t.Fatalf("a queue draining is logged: expected status feed queue back down to 0%% of its 1024, got %q", last.Message)
+	}
+
+	lines := strings.Join(m.printDiagnostics(), "\n")
+	for _, part := range []string{"Process", "goroutines", "retained", "status feed 0/1024", "dropped: status feed 0"} {
+		if !strings.Contains(lines, part) {
+			t.Fatalf("the diagnostics tab reports on the process:\nexpected:\n%s\ngot:\n%s", part, lines)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	// STATS_SCHEMA is the version of the document served at STATS_PATH,
+	// raised whenever a field changes meaning or goes away so that the
+	// aggregate command can refuse what it would misread.
+	STATS_SCHEMA = 1
+	STATS_PATH   = "/stats"
+)
+
+var STATS_COLUMNS = []ExportColumn{
+	{"schema", "int", "version of this document, which the aggregate command checks"},
+	{"run_id", "string", "the run's ID"},
+	{"target", "string", "what's probed, as in the header"},
+	{"labels", "object", "the --label values, with site naming the instance to the aggregate command"},
+	{"updated", "RFC 3339 time", "when the document was last replaced"},
+	{"count", "int", "replies over the run"},
+	{"avg_ms", "float", "average latency over the run"},
+	{"sent", "int", "probes whose fate is known"},
+	{"lost", "int", "of them, how many were lost"},
+	{"loss_pct", "float", "loss over the run"},
+	{"window", "object", "the last window's summary, as sent to --window-webhook"},
+	{"alerts", "array", "the incidents open, as in the incidents of the --state file"},
+	{"process", "object", "the process's heap, GC pauses, goroutines, retained samples, queue depths and dropped samples, as in the diagnostics tab"},
+	{"call", "object", "with --call-quality, the estimated call quality over the run"},
+	{"outages", "array", "each run of probes lost in a row counted as an outage, with its start, end and length"},
+	{"worst_minutes", "array", "the worst windows to set a record for loss or p95, each with its samples, events, open incidents and Wi-Fi reading from a minute either side"},
+}
+
+// StatsDocument is what --stats-listen serves: the run so far and the window
+// last completed.
+type StatsDocument struct {
+	Schema  int               `json:"schema"`
+	RunID   string            `json:"run_id"`
+	Target  string            `json:"target"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Updated time.Time         `json:"updated"`
+
+	Count   int     `json:"count"`
+	AvgMs   float64 `json:"avg_ms"`
+	Sent    int     `json:"sent"`
+	Lost    int     `json:"lost"`
+	LossPct float64 `json:"loss_pct"`
+	// Call is the call quality estimate for the run, with each window's in
+	// Window.
+	Call    *stats.CallSummary    `json:"call,omitempty"`
+	Outages []stats.OutageSummary `json:"outages,omitempty"`
+
+	WorstMinutes []stats.WorstMinute `json:"worst_minutes,omitempty"`
+
+	Window *windowSummary   `json:"window,omitempty"`
+	Alerts []stats.Incident `json:"alerts,omitempty"`
+
+	Process *selfReport `json:"process,omitempty"`
+}
+
+// StatsServer serves the latest StatsDocument, swapped in whole each window
+// so that requests never see the model mid-update.
+type StatsServer struct {
+	server   *http.Server
+	document atomic.Pointer[[]byte]
+}
+
+func listenStats(address string) (*StatsServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for --stats-listen: %s", err)
+	}
+
+	s := &StatsServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+STATS_PATH, s.Handle)
+	mux.HandleFunc("GET "+HEALTHZ_PATH, ServeHealth)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+func (s *StatsServer) Handle(w http.ResponseWriter, r *http.Request) {
+	document := s.document.Load()
+	if document == nil {
+		http.Error(w, "no stats yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(*document)
+}
+
+func (s *StatsServer) Publish(document StatsDocument) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return
+	}
+
+	s.document.Store(&data)
+}
+
+func (s *StatsServer) Close() {
+	if s == nil {
+		return
+	}
+
+	s.server.Close()
+}
+
+// publishStats updates what --stats-listen serves, with the window just
+// completed if there is one.
+func (m *Model) publishStats(window *windowSummary) {
+	if m.statsAPI == nil {
+		return
+	}
+
+	m.statsAPI.Publish(m.statsDocument(window))
+}
+
+func (m *Model) statsDocument(window *windowSummary) StatsDocument {
+	sent, lost := m.Stats.Loss.Settled()
+	document := StatsDocument{
+		Schema:  STATS_SCHEMA,
+		RunID:   m.Stats.RunID,
+		Target:  m.describeTarget(),
+		Labels:  m.Labels,
+		Updated: time.Now(),
+
+		Count:   m.Stats.Totals.Count,
+		AvgMs:   stats.Milliseconds(m.Stats.Totals.Average()),
+		Sent:    sent,
+		Lost:    lost,
+		LossPct: m.Stats.Loss.Cumulative() * 100,
+		Call:    m.Stats.CallTotals(),
+		Outages: m.Stats.OutageSummaries(),
+
+		WorstMinutes: m.Stats.WorstMinuteSummaries(),
+
+		Window: window,
+	}
+	for _, incident := range m.Stats.Incidents {
+		if incident.Active() {
+			document.Alerts = append(document.Alerts, incident)
+		}
+	}
+	if m.self != nil && !m.self.last.At.IsZero() {
+		report := m.self.last
+		document.Process = &report
+	}
+
+	return document
+}
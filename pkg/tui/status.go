@@ -0,0 +1,175 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	STATUS_BUFFER = 1024
+	// STATUS_DRAIN_TIMEOUT is how long exiting waits for a slow reader to
+	// take the frames still queued.
+	STATUS_DRAIN_TIMEOUT = time.Second
+)
+
+var STATUS_COLUMNS = []ExportColumn{
+	{"type", "string", "start, sample, pause, window, event or summary"},
+	{"data", "object", "the frame's contents, which depend on its type, as below"},
+	{"start", "data", "run metadata, as in the metadata of the --state file"},
+	{"sample", "data", "one probe, with the time, seq, lost, rtt_ms and ttl columns of --wide-csv, and the epoch, which goes up each time the prober starts its sequence over"},
+	{"pause", "data", "probing pausing or resuming, as time, event (pause_start or pause_end) and reason, between the samples either side"},
+	{"window", "data", "a window summary, as sent to --window-webhook"},
+	{"event", "data", "an event, as in the events of the --state file"},
+	{"summary", "data", "the final --state file, sent on a clean exit"},
+}
+
+type statusFrame struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// statusFeed writes NDJSON frames for a wrapping program from a goroutine of
+// its own, so that a slow or absent reader can only cost frames. Once a
+// write fails, because the reader closed its end, the feed goes quiet. A
+// strict feed goes quiet rather than drop a frame, for a reader that needs
+// every one and would sooner start over.
+type statusFeed struct {
+	frames  chan []byte
+	done    chan struct{}
+	broken  atomic.Bool
+	dropped atomic.Int64
+	strict  bool
+
+	lost      []lostProbe
+	published int
+	marked    int
+}
+
+// openStatus takes a file descriptor number, or the path of a named pipe or
+// file. A named pipe is opened once there's a reader, without holding up
+// the run until then.
+func openStatus(target string) (*statusFeed, error) {
+	open := func() (io.WriteCloser, error) {
+		return os.OpenFile(target, os.O_WRONLY|os.O_APPEND, 0)
+	}
+
+	if fd, err := strconv.Atoi(target); err == nil {
+		file := os.NewFile(uintptr(fd), "status")
+		if file == nil {
+			return nil, fmt.Errorf("--status-fd %d isn't a valid file descriptor", fd)
+		}
+		if _, err := file.Stat(); err != nil {
+			return nil, fmt.Errorf("--status-fd %d isn't open: %s", fd, err)
+		}
+		open = func() (io.WriteCloser, error) { return file, nil }
+	} else if _, err := os.Stat(target); err != nil {
+		return nil, fmt.Errorf("failed to find status pipe: %s", err)
+	}
+
+	return newStatusFeed(open), nil
+}
+
+func newStatusFeed(open func() (io.WriteCloser, error)) *statusFeed {
+	f := &statusFeed{frames: make(chan []byte, STATUS_BUFFER), done: make(chan struct{})}
+
+	go func() {
+		defer close(f.done)
+
+		file, err := open()
+		if err != nil {
+			f.broken.Store(true)
+		} else {
+			defer file.Close()
+		}
+
+		for frame := range f.frames {
+			if f.broken.Load() {
+				continue
+			}
+			if _, err := file.Write(frame); err != nil {
+				f.broken.Store(true)
+			}
+		}
+	}()
+
+	return f
+}
+
+func (f *statusFeed) send(kind string, data any) {
+	if f == nil || f.broken.Load() {
+		return
+	}
+
+	frame, err := json.Marshal(statusFrame{Type: kind, Data: data})
+	if err != nil {
+		return
+	}
+
+	select {
+	case f.frames <- append(frame, '\n'):
+	default:
+		f.dropped.Add(1)
+		if f.strict {
+			f.broken.Store(true)
+		}
+	}
+}
+
+// observe takes each probe's fate from the loss tracker, keeping the losses
+// for the next publish like the wide export does.
+func (f *statusFeed) observe(seq int, lost bool) {
+	if lost {
+		f.lost = append(f.lost, lostProbe{seq: seq, at: time.Now()})
+	}
+}
+
+func (f *statusFeed) Close() {
+	if f == nil {
+		return
+	}
+
+	close(f.frames)
+	select {
+	case <-f.done:
+	case <-time.After(STATUS_DRAIN_TIMEOUT):
+	}
+}
+
+// publishStatus sends the probes given up on, the pauses and the events
+// logged since the last call, then result if there is one.
+func (m *Model) publishStatus(result *ping.Result) {
+	if m.status != nil {
+		m.status.publish(&m.Stats, result)
+	}
+	m.attached.publish(&m.Stats, result)
+}
+
+func (f *statusFeed) publish(s *stats.Stats, result *ping.Result) {
+	for _, probe := range f.lost {
+		f.send("sample", stats.StatusSample{Time: probe.at, Seq: probe.seq, Lost: true})
+	}
+	f.lost = f.lost[:0]
+
+	for _, mark := range s.Marks[f.marked:] {
+		f.send("pause", mark)
+	}
+	f.marked = len(s.Marks)
+
+	for _, event := range s.Events[min(f.published, len(s.Events)):] {
+		f.send("event", event)
+	}
+	f.published = len(s.Events)
+
+	if result != nil {
+		rtt := float64(result.Duration.Microseconds()) / 1000
+		f.send("sample", stats.StatusSample{Time: time.Now(), Seq: result.Seq, RTTMs: &rtt, TTL: result.TTL, Epoch: result.Epoch})
+	}
+}
@@ -0,0 +1,58 @@
+package tui
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestStatusFeed reads a frame from the status feed over a pipe, then
+// closes the reading end and checks that sending carries on without blocking.
+// The pipe is passed by path so that the feed has a descriptor of its own.
+func TestStatusFeed(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("create pipe: expected no error, got %v", err)
+	}
+	defer w.Close()
+
+	feed, err := openStatus(fmt.Sprintf("/dev/fd/%d", w.Fd()))
+	if err != nil {
+		r.Close()
+		t.Fatalf("open feed: expected no error, got %v", err)
+	}
+
+	feed.send("event", stats.Event{Kind: "selftest", Message: "hello"})
+	line, err := bufio.NewReader(r).ReadString('\n')
+	r.Close()
+	if err != nil {
+		t.Fatalf("read frame: expected no error, got %v", err)
+	}
+
+	var frame struct {
+		Type string      `json:"type"`
+		Data stats.Event `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(line), &frame); err != nil || frame.Type != "event" || frame.Data.Message != "hello" {
+		t.Fatalf("frame contents: expected an event saying \"hello\", got %q", strings.TrimSpace(line))
+	}
+
+	start := time.Now()
+	for i := 0; i < 4*STATUS_BUFFER; i++ {
+		feed.send("sample", stats.StatusSample{Time: start, Seq: i})
+	}
+	feed.Close()
+
+	if elapsed := time.Since(start); elapsed > STATUS_DRAIN_TIMEOUT+time.Second {
+		t.Fatalf("sending after the reader closed: expected no blocking, got took %s", elapsed)
+	}
+	if !feed.broken.Load() {
+		t.Fatalf("feed after the reader closed: expected broken, got still writing")
+	}
+}
@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// runLimit ends the run after --count probes have settled, replied to or
+// lost, or once --duration has passed, whichever comes first.
+type runLimit struct {
+	count    int
+	deadline time.Time
+	// from is how many probes had settled when the run started, so that
+	// those resumed from the --state file don't count.
+	from int
+}
+
+type limitMsg struct{}
+
+func newRunLimit(count int, duration time.Duration, s *stats.Stats, now time.Time) *runLimit {
+	if count <= 0 && duration <= 0 {
+		return nil
+	}
+
+	l := &runLimit{count: count}
+	if duration > 0 {
+		l.deadline = now.Add(duration)
+	}
+	if s.Loss != nil {
+		l.from, _ = s.Loss.Settled()
+	}
+
+	return l
+}
+
+func (l *runLimit) reached(s *stats.Stats, now time.Time) bool {
+	if l == nil {
+		return false
+	}
+
+	if !l.deadline.IsZero() && !now.Before(l.deadline) {
+		return true
+	}
+	if l.count > 0 && s.Loss != nil {
+		sent, _ := s.Loss.Settled()
+		return sent-l.from >= l.count
+	}
+
+	return false
+}
+
+// timer fires at the deadline, for the plain output's loop, or never when
+// there isn't one.
+func (l *runLimit) timer() (<-chan time.Time, func()) {
+	if l == nil || l.deadline.IsZero() {
+		return nil, func() {}
+	}
+
+	t := time.NewTimer(time.Until(l.deadline))
+	return t.C, func() { t.Stop() }
+}
+
+// limitTick wakes the TUI at the deadline, since nothing else may arrive
+// then to notice it.
+func (m Model) limitTick() tea.Cmd {
+	if m.limit == nil || m.limit.deadline.IsZero() {
+		return nil
+	}
+
+	return tea.Tick(time.Until(m.limit.deadline), func(time.Time) tea.Msg { return limitMsg{} })
+}
+
+// orStop is next, or quitting once the limit is reached.
+func (m Model) orStop(next tea.Cmd) tea.Cmd {
+	if m.limit.reached(&m.Stats, time.Now()) {
+		return tea.Quit
+	}
+
+	return next
+}
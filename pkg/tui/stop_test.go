@@ -0,0 +1,41 @@
+package tui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestRunLimit checks that --count counts replies and losses alike,
+// but not those resumed from before the run, and that --duration ends the
+// run at its deadline.
+func TestRunLimit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds float64) time.Time { return start.Add(time.Duration(seconds * float64(time.Second))) }
+
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Loss.Reply(1, at(0))
+	s.Loss.Reply(2, at(1))
+
+	counted := newRunLimit(3, 0, &s, at(1))
+	s.Loss.Reply(3, at(2))
+	s.Loss.Reply(5, at(4))
+	if counted.reached(&s, at(4)) {
+		t.Fatalf("probes settled before the run started don't count: expected 2 of 3, got reached")
+	}
+	s.Loss.Advance(at(10))
+	if !counted.reached(&s, at(10)) {
+		t.Fatalf("a probe lost counts towards --count: expected reached at 3, got not reached")
+	}
+
+	timed := newRunLimit(0, time.Minute, &s, start)
+	if timed.reached(&s, at(59)) || !timed.reached(&s, at(60)) {
+		t.Fatalf("--duration ends the run at its deadline: expected reached at 60s and not before, got %q", fmt.Sprint(timed.reached(&s, at(59)), timed.reached(&s, at(60))))
+	}
+
+	if newRunLimit(0, 0, &s, start).reached(&s, at(3600)) {
+		t.Fatalf("with neither flag the run goes on: expected never reached, got reached")
+	}
+}
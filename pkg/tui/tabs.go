@@ -0,0 +1,376 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+const (
+	DEFAULT_VIEW_HEIGHT = 24
+	// TAB_CHROME is the header, tab bar and spacing above a tab's own lines.
+	TAB_CHROME = 4
+
+	HEATMAP_LABEL_WIDTH = 9
+)
+
+// HEAT is how full a heatmap cell is, as a share of its column.
+var HEAT = []rune(" ░▒▓█")
+
+// tab is one page of the display. Each draws its own lines and takes the
+// actions meant for it, keeping whatever it's scrolled to or filtered on to
+// itself. Its actions are the KEY_ACTIONS scoped to its name.
+type tab interface {
+	name() string
+	view(m Model) []string
+	// key handles the action of a key pressed while the tab is showing,
+	// reporting whether it was one of its own.
+	key(m *Model, action string) bool
+}
+
+// tabSet is the tabs and which is showing. It's shared by pointer, so that
+// tab state outlasts the model being copied.
+type tabSet struct {
+	tabs   []tab
+	active int
+}
+
+func newTabSet(vertical bool) *tabSet {
+	return &tabSet{tabs: []tab{
+		&summaryTab{},
+		&histogramTab{vertical: vertical},
+		&sparklineTab{},
+		&heatmapTab{},
+		&eventsTab{},
+		&outagesTab{},
+		&windowsTab{},
+		&diagnosticsTab{},
+		&helpTab{},
+	}}
+}
+
+func (s *tabSet) current() tab {
+	return s.tabs[s.active]
+}
+
+// show switches to the named tab, leaving things as they are for a name
+// that isn't one.
+func (s *tabSet) show(name string) bool {
+	i := slices.IndexFunc(s.tabs, func(t tab) bool { return t.name() == name })
+	if i < 0 {
+		return false
+	}
+
+	s.active = i
+	return true
+}
+
+// key switches tabs on the keys bound to doing so, and otherwise passes
+// the key's action to the tab showing.
+func (s *tabSet) key(m *Model, key string) bool {
+	switch action := m.keys.Action(KEYS_MAIN, key); {
+	case action == "next-tab":
+		s.active = (s.active + 1) % len(s.tabs)
+	case action == "previous-tab":
+		s.active = (s.active + len(s.tabs) - 1) % len(s.tabs)
+	case strings.HasPrefix(action, SHOW_TAB_ACTION):
+		s.show(strings.TrimPrefix(action, SHOW_TAB_ACTION))
+	default:
+		return s.current().key(m, m.keys.Action(s.current().name(), key))
+	}
+
+	m.Stats.Tab = s.current().name()
+	return true
+}
+
+// bar labels each tab with the first key that shows it.
+func (s *tabSet) bar(t theme.Theme, keys KeyMap) string {
+	parts := make([]string, len(s.tabs))
+	for i, tab := range s.tabs {
+		label := " " + tab.name() + " "
+		if bound := keys.bound(SHOW_TAB_ACTION + tab.name()); len(bound) > 0 {
+			label = " " + bound[0] + label
+		}
+		if i == s.active {
+			parts[i] = t.Header.Reverse(true).Render(label)
+		} else {
+			parts[i] = t.Muted.Render(label)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// height is how many lines a tab has to itself.
+func (m Model) height() int {
+	height := m.rows
+	if height <= 0 {
+		height = DEFAULT_VIEW_HEIGHT
+	}
+
+	return max(height-TAB_CHROME, 1)
+}
+
+func (m Model) viewWidth() int {
+	if m.width <= 0 {
+		return stats.DEFAULT_VIEW_WIDTH
+	}
+
+	return m.width
+}
+
+type summaryTab struct {
+	average bool
+}
+
+func (t *summaryTab) name() string { return "summary" }
+
+func (t *summaryTab) view(m Model) []string { return m.printSummary(t.average) }
+
+func (t *summaryTab) key(m *Model, action string) bool {
+	switch action {
+	case "waterfall":
+		t.average = !t.average
+	case "dismiss-banner":
+		m.bannerDismissed = true
+	default:
+		return false
+	}
+
+	return true
+}
+
+type histogramTab struct {
+	vertical bool
+}
+
+func (t *histogramTab) name() string { return "histogram" }
+
+func (t *histogramTab) view(m Model) []string {
+	return strings.Split(m.Stats.PrintHistogram(m.theme, stats.HistogramLayout{Terminal: m.width, Limit: m.histWidth, Vertical: t.vertical}), "\n")
+}
+
+func (t *histogramTab) key(m *Model, action string) bool {
+	if action != "orientation" {
+		return false
+	}
+
+	t.vertical = !t.vertical
+	return true
+}
+
+// sparklineTab draws the last samples or window averages, as many as fit
+// across the terminal, newest on the right.
+type sparklineTab struct {
+	// fromZero scales from 0ms rather than the fastest sample, which shows
+	// how large a change is rather than that there was one.
+	fromZero bool
+}
+
+func (t *sparklineTab) name() string { return "sparkline" }
+
+func (t *sparklineTab) view(m Model) []string {
+	if m.Stats.Spark == nil {
+		return []string{"Sparkline: not drawn for this run"}
+	}
+
+	return m.Stats.Spark.Lines(m.theme, t.fromZero)
+}
+
+func (t *sparklineTab) key(m *Model, action string) bool {
+	if action != "scale" {
+		return false
+	}
+
+	t.fromZero = !t.fromZero
+	return true
+}
+
+// heatmapTab splits the rolling window into columns of time, shading each
+// bucket by its share of the samples in the column.
+type heatmapTab struct{}
+
+func (t *heatmapTab) name() string { return "heatmap" }
+
+func (t *heatmapTab) view(m Model) []string {
+	s := &m.Stats
+	if len(s.Recent) == 0 {
+		return []string{"Heatmap: no samples in the window yet"}
+	}
+
+	columns := max(min(m.viewWidth()-HEATMAP_LABEL_WIDTH, len(s.Recent)), 1)
+	thresholds := s.Histogram.Thresholds()
+	from, span := s.Recent[0].At, s.Recent[len(s.Recent)-1].At.Sub(s.Recent[0].At)
+
+	// The last row is for samples slower than every bucket.
+	counts := make([][]int, len(thresholds)+1)
+	for i := range counts {
+		counts[i] = make([]int, columns)
+	}
+	totals := make([]int, columns)
+	for _, sample := range s.Recent {
+		column := columns - 1
+		if span > 0 {
+			column = min(int(float64(sample.At.Sub(from))/float64(span)*float64(columns)), columns-1)
+		}
+		counts[s.Histogram.Bucket(sample.Duration)][column]++
+		totals[column]++
+	}
+
+	lines := []string{fmt.Sprintf("Heatmap: last %ds, %d samples", int(s.WindowSize.Seconds()), len(s.Recent))}
+	for row := len(counts) - 1; row >= 0; row-- {
+		label := ">" + stats.FormatThreshold(thresholds[len(thresholds)-1])
+		if row < len(thresholds) {
+			label = stats.FormatThreshold(thresholds[row])
+		}
+		label = fmt.Sprintf("%7s :", label)
+
+		var cells strings.Builder
+		for column, count := range counts[row] {
+			level := 0
+			if count > 0 {
+				level = max(1, count*(len(HEAT)-1)/totals[column])
+			}
+			cells.WriteRune(HEAT[level])
+		}
+		lines = append(lines, fmt.Sprintf("%-*s%s", HEATMAP_LABEL_WIDTH, label, m.theme.Bar.Render(cells.String())))
+	}
+
+	return lines
+}
+
+func (t *heatmapTab) key(m *Model, action string) bool { return false }
+
+// eventsTab lists every event, newest at the bottom, scrolled back from the
+// newest by scroll and showing only filter's kind when it's set.
+type eventsTab struct {
+	scroll int
+	filter string
+}
+
+func (t *eventsTab) name() string { return "events" }
+
+func (t *eventsTab) shown(s *stats.Stats) []stats.Event {
+	if t.filter == "" {
+		return s.Events
+	}
+
+	var events []stats.Event
+	for _, event := range s.Events {
+		if event.Kind == t.filter {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+func (t *eventsTab) view(m Model) []string {
+	events := t.shown(&m.Stats)
+	end := len(events) - t.scroll
+	start := max(end-m.eventRows(), 0)
+
+	filter := "all"
+	if t.filter != "" {
+		filter = t.filter
+	}
+	lines := []string{m.theme.Header.Render(fmt.Sprintf("Events: %d-%d of %d, showing %s", min(start+1, end), end, len(events), filter))}
+	for _, event := range events[start:end] {
+		lines = append(lines, fmt.Sprintf("%s %-10s %s", m.Stats.Times.Clock(event.Time), event.Kind, event.Message))
+	}
+
+	return lines
+}
+
+// kinds are the kinds of event logged so far, in the order first seen.
+func (t *eventsTab) kinds(s *stats.Stats) []string {
+	var kinds []string
+	for _, event := range s.Events {
+		if !slices.Contains(kinds, event.Kind) {
+			kinds = append(kinds, event.Kind)
+		}
+	}
+
+	return kinds
+}
+
+// eventRows is how many events fit under the events tab's title.
+func (m Model) eventRows() int {
+	return max(m.height()-1, 1)
+}
+
+func (t *eventsTab) key(m *Model, action string) bool {
+	page := m.eventRows()
+	switch action {
+	case "scroll-up":
+		t.scroll++
+	case "scroll-down":
+		t.scroll--
+	case "page-up":
+		t.scroll += page
+	case "page-down":
+		t.scroll -= page
+	case "oldest":
+		t.scroll = len(m.Stats.Events)
+	case "newest":
+		t.scroll = 0
+	case "filter":
+		// Cycles through each kind, then back to all of them.
+		kinds := append(t.kinds(&m.Stats), "")
+		t.filter = kinds[(slices.Index(kinds, t.filter)+1)%len(kinds)]
+		t.scroll = 0
+	default:
+		return false
+	}
+
+	// Scrolling stops with the oldest event at the top.
+	t.scroll = max(min(t.scroll, len(t.shown(&m.Stats))-page), 0)
+	return true
+}
+
+type diagnosticsTab struct{}
+
+func (t *diagnosticsTab) name() string { return "diagnostics" }
+
+func (t *diagnosticsTab) view(m Model) []string {
+	if lines := m.printDiagnostics(); len(lines) > 0 {
+		return lines
+	}
+
+	return []string{"Diagnostics: nothing to report"}
+}
+
+func (t *diagnosticsTab) key(m *Model, action string) bool { return false }
+
+type helpTab struct{}
+
+func (t *helpTab) name() string { return "help" }
+
+func (t *helpTab) view(m Model) []string {
+	lines := []string{
+		m.theme.Header.Render("Keys"),
+		"  " + m.keys.tabsLabel(m.tabs.tabs) + "  switch tab",
+	}
+	for _, key := range append(m.keys.help(KEYS_MAIN), m.keys.help(KEYS_ANYWHERE)...) {
+		lines = append(lines, "  "+key)
+	}
+
+	for _, tab := range m.tabs.tabs {
+		keys := m.keys.help(tab.name())
+		if len(keys) == 0 {
+			continue
+		}
+
+		lines = append(lines, "", m.theme.Header.Render(tab.name()))
+		for _, key := range keys {
+			lines = append(lines, "  "+key)
+		}
+	}
+
+	return lines
+}
+
+func (t *helpTab) key(m *Model, action string) bool { return false }
@@ -0,0 +1,97 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestTabs switches between tabs by number and with tab/shift+tab,
+// checking that each keeps what it's scrolled to or filtered on while
+// others are used, that a tab's keys do nothing elsewhere, and that the tab
+// showing is saved with the state file and opened on again.
+func TestTabs(t *testing.T) {
+	m := Model{Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS), tabs: newTabSet(false), rows: 10}
+	for i := range 20 {
+		kind := "loss"
+		if i%2 == 1 {
+			kind = "route"
+		}
+		m.Stats.AddEvent(kind, fmt.Sprintf("event %d", i))
+	}
+
+	press := func(keys ...tea.KeyMsg) {
+		for _, key := range keys {
+			updated, _ := m.Update(key)
+			m = updated.(Model)
+		}
+	}
+	runes := func(key string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)} }
+	events := m.tabs.tabs[4].(*eventsTab)
+	histogram := m.tabs.tabs[1].(*histogramTab)
+	summary := m.tabs.tabs[0].(*summaryTab)
+
+	press(runes("5"), runes("k"), runes("k"), runes("k"))
+	if m.tabs.current() != events || m.Stats.Tab != "events" {
+		t.Fatalf("5 shows the events tab: expected events, got %s, saved as %q", m.tabs.current().name(), m.Stats.Tab)
+	}
+	view := m.View()
+	if events.scroll != 3 || !strings.Contains(view, "event 12") || !strings.Contains(view, "event 16") || strings.Contains(view, "event 17") || strings.Contains(view, "event 11") {
+		t.Fatalf("k scrolls the events back one at a time: expected events 12 to 16 after scrolling back 3, got %q", view)
+	}
+
+	press(runes("f"), runes("k"))
+	if events.filter != "loss" || events.scroll != 1 || strings.Contains(m.View(), "route") {
+		t.Fatalf("f filters to the first kind logged and starts at the newest: expected loss events, scrolled back 1, got %q, scrolled back %d", events.filter, events.scroll)
+	}
+
+	press(runes("2"), runes("k"), runes("f"), runes("v"))
+	if events.scroll != 1 || events.filter != "loss" || !histogram.vertical {
+		t.Fatalf("keys go to the tab showing and no other: expected events unchanged and the histogram turned to columns, got events %q scrolled back %d, vertical %t", events.filter, events.scroll, histogram.vertical)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyTab}, tea.KeyMsg{Type: tea.KeyTab})
+	if m.tabs.current().name() != "heatmap" {
+		t.Fatalf("tab moves to the next tab: expected heatmap, two on from histogram, got %q", m.tabs.current().name())
+	}
+	press(tea.KeyMsg{Type: tea.KeyShiftTab}, tea.KeyMsg{Type: tea.KeyShiftTab}, tea.KeyMsg{Type: tea.KeyShiftTab})
+	if m.tabs.current() != summary {
+		t.Fatalf("shift+tab moves to the one before: expected summary, three back from heatmap, got %q", m.tabs.current().name())
+	}
+	press(tea.KeyMsg{Type: tea.KeyShiftTab})
+	if m.tabs.current().name() != "help" {
+		t.Fatalf("shift+tab wraps around from the first tab: expected help, got %q", m.tabs.current().name())
+	}
+
+	press(runes("5"), runes("w"), runes("v"))
+	if summary.average || !histogram.vertical || events.scroll != 1 || events.filter != "loss" {
+		t.Fatalf("other tabs' keys do nothing on the events tab: expected summary and histogram unchanged, events still scrolled back 1, got average %t, vertical %t, scrolled back %d", summary.average, histogram.vertical, events.scroll)
+	}
+
+	press(runes("f"), runes("f"), tea.KeyMsg{Type: tea.KeyPgUp}, tea.KeyMsg{Type: tea.KeyPgUp}, tea.KeyMsg{Type: tea.KeyPgUp}, tea.KeyMsg{Type: tea.KeyPgUp})
+	if events.filter != "" || events.scroll != 15 {
+		t.Fatalf("f cycles back to every kind, and scrolling stops at the oldest: expected all 20 events, scrolled back 15 with 5 showing, got %q, scrolled back %d", events.filter, events.scroll)
+	}
+
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "state.json")
+	if err := stats.SaveState(path, &m.Stats); err != nil {
+		t.Fatalf("the state file saves: expected no error, got %v", err)
+	}
+	resumed := Model{Stats: stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS), tabs: newTabSet(false)}
+	if err := stats.ResumeState(path, &resumed.Stats); err != nil {
+		t.Fatalf("the state file resumes: expected no error, got %v", err)
+	}
+	if !resumed.tabs.show(resumed.Stats.Tab) || resumed.tabs.current().name() != "events" {
+		t.Fatalf("a resumed run opens on the tab it was showing: expected events, got %q", resumed.tabs.current().name())
+	}
+	if resumed.tabs.show("table") || resumed.tabs.current().name() != "events" {
+		t.Fatalf("a tab that doesn't exist is ignored: expected still events, got %q", resumed.tabs.current().name())
+	}
+}
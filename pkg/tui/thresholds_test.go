@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+)
+
+func TestMinMaxTimes(t *testing.T) {
+	start := time.Date(2026, 3, 1, 14, 32, 0, 0, time.UTC)
+	now := start
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = start
+	s.History = stats.NewWindowHistory(2)
+	s.Times, _ = stats.NewTimeFormat(stats.TIME_UTC, start, nil)
+
+	// The display lags the replies by a minute, which the times mustn't.
+	now = start.Add(time.Minute)
+	s.UpdateAt(40*time.Millisecond, start.Add(5*time.Second))
+	s.UpdateAt(1403*time.Millisecond, start.Add(7*time.Second))
+	s.UpdateAt(12*time.Millisecond, start.Add(9*time.Second))
+	if !s.Totals.MinAt.Equal(start.Add(9*time.Second)) || !s.Totals.MaxAt.Equal(start.Add(7*time.Second)) {
+		t.Fatalf("the min and max are timed by the replies, not when they're counted: expected 14:32:09 and 14:32:07, got %s and %s", s.Totals.MinAt, s.Totals.MaxAt)
+	}
+	if text := s.TotalsString(); !strings.Contains(text, "12.0ms at 2026-03-01T14:32:09.000Z") || !strings.Contains(text, "1.40s at 2026-03-01T14:32:07.000Z") {
+		t.Fatalf("the totals say when the min and max were: expected 12.0ms at 2026-03-01T14:32:09.000Z and 1.40s at 2026-03-01T14:32:07.000Z, got %q", text)
+	}
+	if text := s.RenderTotals(theme.Default()); !strings.Contains(text, "1.40s at 14:32:07 UTC") {
+		t.Fatalf("the display gives the min and max times by the clock: expected 1.40s at 14:32:07 UTC, got %q", text)
+	}
+
+	data, err := json.Marshal(s.Totals)
+	var back stats.Window
+	if err == nil {
+		err = json.Unmarshal(data, &back)
+	}
+	if err != nil || !back.MaxAt.Equal(s.Totals.MaxAt) || !back.MinAt.Equal(s.Totals.MinAt) {
+		t.Fatalf("the summary keeps the min and max times: expected %q, got %q", fmt.Sprint(s.Totals.MinAt, s.Totals.MaxAt), fmt.Sprint(string(data), err))
+	}
+	data, _ = json.Marshal(stats.Window{})
+	if strings.Contains(string(data), "At") {
+		t.Fatalf("a window with no replies has no times to give: expected no MinAt or MaxAt, got %q", string(data))
+	}
+	s.Totals.Reset()
+	if !s.Totals.MinAt.IsZero() || !s.Totals.MaxAt.IsZero() {
+		t.Fatalf("a reset forgets the times with the figures: expected zero times, got %q", fmt.Sprint(s.Totals.MinAt, s.Totals.MaxAt))
+	}
+
+	// Losing more outranks being slower, and a window lost outright is the
+	// worst of those losing as much.
+	slow := stats.WindowRecord{Count: 5, AvgMs: 90}
+	lossy := stats.WindowRecord{Count: 4, AvgMs: 20, LossPct: 20}
+	silent := stats.WindowRecord{LossPct: 20}
+	if !lossy.Worse(slow) || slow.Worse(lossy) || !silent.Worse(lossy) || !slow.Worse(stats.WindowRecord{Count: 5, AvgMs: 30}) {
+		t.Fatalf("windows rank by loss, then replies, then average: expected silent over lossy over slow over quick, got otherwise")
+	}
+
+	h := stats.NewWindowHistory(2)
+	for i, record := range []stats.WindowRecord{slow, lossy, {Count: 5, AvgMs: 10}, {Count: 5, AvgMs: 11}} {
+		record.Start = start.Add(time.Duration(5*i) * time.Second)
+		h.Add(record)
+	}
+	lossy.Start = start.Add(5 * time.Second)
+	s.History = h
+	if worst := s.WorstWindow(); worst == nil || *worst != lossy {
+		t.Fatalf("the worst window is remembered after it's no longer kept: expected %v, got %v", lossy, worst)
+	}
+
+	keys, _ := NewKeyMap(nil)
+	m := Model{Stats: s, tabs: newTabSet(false), keys: keys, rows: TAB_CHROME + 4}
+	m.tabs.show("windows")
+	if lines := m.tabs.current().view(m); !strings.Contains(strings.Join(lines, "\n"), "worst of the run, no longer kept") {
+		t.Fatalf("the windows tab says the worst window has gone: expected worst of the run, no longer kept, got %q", strings.Join(lines, "\n"))
+	}
+	silent.Start = start.Add(20 * time.Second)
+	h.Add(silent)
+	if lines := m.tabs.current().view(m); !strings.Contains(strings.Join(lines, "\n"), "← worst of the run") || strings.Contains(strings.Join(lines, "\n"), "no longer kept") {
+		t.Fatalf("the windows tab marks the worst window among those kept: expected ← worst of the run, got %q", strings.Join(lines, "\n"))
+	}
+}
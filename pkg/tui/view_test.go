@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+)
+
+// TestView plays a couple of windows of replies, with a loss and a slow
+// one, through a model from NewModel and checks each tab drawn from them
+// against golden output.
+func TestView(t *testing.T) {
+	start := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC)
+	now := start
+	s := stats.New(time.Second, 5*time.Second, stats.MillisecondThresholds(10, 20, 50, 100))
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+	s.History = stats.NewWindowHistory(10)
+
+	m := NewModel(nil, s)
+	m.Host, m.Target = "example.com", target.Target{Mode: target.ICMP, Host: "example.com"}
+	update := func(msg tea.Msg) {
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	update(tea.WindowSizeMsg{Width: 100, Height: 40})
+
+	for seq, ms := range []int{4, 8, 12, 15, 0, 19, 25, 30, 45, 120, 18} {
+		now = start.Add(time.Duration(seq+1) * time.Second)
+		result := ping.Result{Seq: seq + 1, Epoch: 1, Duration: time.Duration(ms) * time.Millisecond, At: now}
+		if ms == 0 {
+			result = ping.Result{Seq: seq + 1, Epoch: 1, Lost: true, At: now}
+		}
+		update(result)
+	}
+
+	for i, tab := range m.tabs.tabs {
+		update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(fmt.Sprint(i + 1))})
+		if m.tabs.current() != tab {
+			t.Fatalf("key %d: expected the %s tab, got %s", i+1, tab.name(), m.tabs.current().name())
+		}
+		golden(t, "view-"+tab.name(), m.View())
+	}
+}
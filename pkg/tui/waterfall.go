@@ -0,0 +1,97 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// phaseWindow keeps the latest per-phase timings and their running totals
+// over the current window.
+type phaseWindow struct {
+	last   []ping.Phase
+	totals []ping.Phase
+	count  int
+}
+
+func (w *phaseWindow) Update(phases []ping.Phase) {
+	if len(w.totals) != len(phases) {
+		w.totals = make([]ping.Phase, len(phases))
+		w.count = 0
+	}
+
+	for i, phase := range phases {
+		w.totals[i].Name = phase.Name
+		w.totals[i].Duration += phase.Duration
+	}
+
+	w.last = phases
+	w.count++
+}
+
+func (w *phaseWindow) Reset() {
+	w.totals = nil
+	w.count = 0
+}
+
+func (w *phaseWindow) Average() []ping.Phase {
+	if w.count == 0 {
+		return nil
+	}
+
+	average := make([]ping.Phase, len(w.totals))
+	for i, phase := range w.totals {
+		average[i] = ping.Phase{Name: phase.Name, Duration: phase.Duration / time.Duration(w.count)}
+	}
+
+	return average
+}
+
+// renderWaterfall draws each phase as a bar starting where the previous one
+// ended, scaled so the whole request spans the available width. A phase too
+// short to fill a cell still gets one, with its exact time beside it.
+func renderWaterfall(phases []ping.Phase, width int) []string {
+	var total time.Duration
+	for _, phase := range phases {
+		total += phase.Duration
+	}
+
+	area := max(width-stats.WATERFALL_LABEL_WIDTH-stats.WATERFALL_VALUE_WIDTH-2, 10)
+	lines := make([]string, 0, len(phases))
+
+	var elapsed time.Duration
+	for _, phase := range phases {
+		offset, length := 0, 1
+		if total > 0 {
+			offset = min(int(elapsed*time.Duration(area)/total), area-1)
+			length = max(int(phase.Duration*time.Duration(area)/total), 1)
+			length = min(length, area-offset)
+		}
+		elapsed += phase.Duration
+
+		bar := strings.Repeat(" ", offset) + strings.Repeat("█", length) + strings.Repeat(" ", area-offset-length)
+		lines = append(lines, fmt.Sprintf("%-*s %s %*s", stats.WATERFALL_LABEL_WIDTH, phase.Name, bar, stats.WATERFALL_VALUE_WIDTH, stats.FormatLatency(phase.Duration)))
+	}
+
+	return lines
+}
+
+func (m Model) printWaterfall(average bool) string {
+	phases, title := m.phases.last, "Last request"
+	if average {
+		phases, title = m.phases.Average(), "Window average"
+	}
+
+	width := m.width
+	if width <= 0 {
+		width = stats.DEFAULT_VIEW_WIDTH
+	}
+
+	lines := []string{m.theme.Header.Render(title + " (w to toggle)")}
+	lines = append(lines, renderWaterfall(phases, width)...)
+
+	return strings.Join(lines, "\n")
+}
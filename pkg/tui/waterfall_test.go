@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+)
+
+// TestWaterfall renders a request's phases at a few terminal widths,
+// including a phase too short for a cell of its own and a request that took
+// no time at all.
+func TestWaterfall(t *testing.T) {
+	phases := []ping.Phase{
+		{Name: "dns", Duration: 4 * time.Millisecond},
+		{Name: "connect", Duration: 12 * time.Millisecond},
+		{Name: "tls", Duration: 25 * time.Millisecond},
+		{Name: "request", Duration: 300 * time.Microsecond},
+		{Name: "ttfb", Duration: 61 * time.Millisecond},
+	}
+	instant := []ping.Phase{{Name: "connect"}, {Name: "ttfb"}}
+
+	for _, width := range []int{40, 80, 120} {
+		t.Run(fmt.Sprint(width), func(t *testing.T) {
+			golden(t, fmt.Sprintf("waterfall-%d", width), strings.Join(renderWaterfall(phases, width), "\n")+"\n")
+		})
+	}
+	golden(t, "waterfall-instant", strings.Join(renderWaterfall(instant, 80), "\n")+"\n")
+}
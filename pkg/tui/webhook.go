@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+type windowSummary struct {
+	RunID  string            `json:"run_id"`
+	Host   string            `json:"host"`
+	Start  time.Time         `json:"start"`
+	End    time.Time         `json:"end"`
+	Count  int               `json:"count"`
+	MinMs  float64           `json:"min_ms"`
+	MaxMs  float64           `json:"max_ms"`
+	AvgMs  float64           `json:"avg_ms"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Headline names the statistic HeadlineMs is, as --headline chose it.
+	Headline   string  `json:"headline"`
+	HeadlineMs float64 `json:"headline_ms"`
+
+	Slowest []stats.Slow `json:"slowest,omitempty"`
+
+	LossWindowPct   float64 `json:"loss_window_pct"`
+	LossSmoothedPct float64 `json:"loss_smoothed_pct"`
+	LossTotalPct    float64 `json:"loss_total_pct"`
+	// PausedS is how much of the window probing was paused for.
+	PausedS float64 `json:"paused_s"`
+
+	BaselineMs   *float64 `json:"baseline_ms,omitempty"`
+	QueueDelayMs *float64 `json:"queue_delay_ms,omitempty"`
+
+	Call *stats.CallSummary `json:"call,omitempty"`
+
+	Interface string   `json:"interface,omitempty"`
+	RxBps     *float64 `json:"rx_bps,omitempty"`
+	TxBps     *float64 `json:"tx_bps,omitempty"`
+}
+
+// WindowComplete is called by both the TUI and plain output for each window
+// that rolls over, with the window as it closed.
+func (m *Model) WindowComplete(closed stats.ClosedWindow) {
+	start, end := closed.Start, closed.End
+	m.alertWindow(closed)
+	if m.webhook == nil && m.status == nil && m.evidence == nil && m.statsAPI == nil && m.Forward == nil {
+		return
+	}
+
+	w := closed.Window
+	summary := windowSummary{
+		RunID:  m.Stats.RunID,
+		Host:   m.Host,
+		Start:  start,
+		End:    end,
+		Count:  w.Count,
+		MinMs:  stats.Milliseconds(w.Min),
+		MaxMs:  stats.Milliseconds(w.Max),
+		AvgMs:  stats.Milliseconds(w.Average()),
+		Labels: m.Labels,
+
+		Headline:   headlineName(m.Stats.Headline),
+		HeadlineMs: stats.Milliseconds(closed.Headline),
+
+		Slowest: closed.Slowest,
+		PausedS: m.Stats.PausedTime(start, end).Seconds(),
+		Call:    closed.Call,
+	}
+
+	rolling, _, _ := m.Stats.Loss.Rolling(end)
+	summary.LossWindowPct = rolling * 100
+	summary.LossSmoothedPct = m.Stats.Loss.Smoothed() * 100
+	summary.LossTotalPct = m.Stats.Loss.Cumulative() * 100
+
+	if m.Stats.Baseline != nil {
+		if baseline, ok := m.Stats.Baseline.Min(); ok {
+			baselineMs := stats.Milliseconds(baseline)
+			queueDelayMs := math.Max(0, stats.Milliseconds(w.Average())-baselineMs)
+			summary.BaselineMs = &baselineMs
+			summary.QueueDelayMs = &queueDelayMs
+		}
+	}
+
+	if m.counters != nil {
+		if rx, tx, ok := m.counters.TakeWindow(); ok {
+			summary.Interface = m.counters.Interface()
+			summary.RxBps = &rx
+			summary.TxBps = &tx
+		}
+	}
+
+	m.status.send("window", summary)
+	m.publishStats(&summary)
+	m.forwardWindow(&summary)
+	if m.evidence != nil {
+		m.evidence.windows = append(m.evidence.windows, summary)
+	}
+
+	if m.webhook == nil {
+		return
+	}
+
+	if err := m.webhook.Send(summary); err != nil {
+		m.Stats.AddEvent("webhook", err.Error())
+	}
+}
+
+func (m *Model) printWebhook() string {
+	return m.printDelivery("Webhook", m.webhook)
+}
+
+func (m *Model) printDelivery(name string, sender *webhook.Sender) string {
+	delivery := sender.Stats()
+
+	line := fmt.Sprintf("%s: %d sent, %d failed attempts, %d spooled, %d recovered", name, delivery.Sent, delivery.Failed, delivery.Spooled, delivery.Recovered)
+	if delivery.LastError != "" {
+		line += " (last error: " + delivery.LastError + ")"
+	}
+
+	if delivery.Spooled > delivery.Recovered {
+		return m.theme.Warn.Render(line)
+	}
+
+	return m.theme.Muted.Render(line)
+}
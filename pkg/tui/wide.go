@@ -0,0 +1,243 @@
+package tui
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ifstat"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/route"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+const (
+	WIFI_READ_INTERVAL = 5 * time.Second
+	WIFI_STALE_AFTER   = 15 * time.Second
+	// COUNTERS_STALE_INTERVALS is how many probe intervals old interface
+	// rates can be before they're left out of a row.
+	COUNTERS_STALE_INTERVALS = 3
+)
+
+var WIDE_COLUMNS = []ExportColumn{
+	{"time", "timestamp", "when the reply arrived, or when the probe was given up on, in RFC 3339"},
+	{"run_id", "string", "run the probe belongs to"},
+	{"host", "string", "target host"},
+	{"seq", "integer", "probe sequence number, which starts over when the prober restarts"},
+	{"lost", "boolean", "true when no reply arrived in time"},
+	{"rtt_ms", "number, nullable", "round trip time, empty for lost probes"},
+	{"ttl", "integer, nullable", "TTL of the reply, empty when lost or not reported"},
+	{"interface", "string, nullable", "interface the route to the target goes over"},
+	{"wifi_signal_dbm", "number, nullable", fmt.Sprintf("Wi-Fi signal level, empty off Wi-Fi or when the last reading is over %s old", WIFI_STALE_AFTER)},
+	{"wifi_link_quality", "number, nullable", "Wi-Fi link quality as the driver reports it, empty like wifi_signal_dbm"},
+	{"rx_bps", "number, nullable", fmt.Sprintf("interface receive rate in bits per second, with --interface-counters, empty when over %d intervals old", COUNTERS_STALE_INTERVALS)},
+	{"tx_bps", "number, nullable", "interface transmit rate in bits per second, empty like rx_bps"},
+	{"outage_open", "boolean", "an incident, such as an SLO breach or loss alert, was open"},
+	{"vpn_active", "boolean", "the route to the target goes over a VPN"},
+	{"captive_portal_suspected", "boolean", "the target's name resolved to an address that isn't on the internet"},
+	{"annotations", "string, nullable", "events logged since the previous row, as kind: message, separated by \"; \""},
+	{"after_pause", "boolean", "the first probe since probing was paused on purpose, so the gap before it isn't an outage"},
+	{"event", "string, nullable", "pause_start or pause_end on a row recording probing pausing or resuming, with only time, run_id, host and annotations besides, and empty for probes"},
+	{"mos", "number, nullable", "with --call-quality, the estimated MOS of the last window completed, empty before the first"},
+}
+
+// wideExport writes every probe as one CSV row, joined with whatever the
+// other samplers last knew at the time. Values past their staleness limit
+// are left empty rather than repeated.
+type wideExport struct {
+	file   *os.File
+	writer *csv.Writer
+
+	lost      []lostProbe
+	annotated int
+	pauses    int
+	marked    int
+
+	wifi   ifstat.Wireless
+	wifiOK bool
+	wifiAt time.Time
+	readAt time.Time
+}
+
+type lostProbe struct {
+	seq int
+	at  time.Time
+}
+
+func newWideExport(path string) (*wideExport, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wide export: %s", err)
+	}
+
+	e := &wideExport{file: file, writer: csv.NewWriter(file)}
+
+	header := make([]string, len(WIDE_COLUMNS))
+	for i, column := range WIDE_COLUMNS {
+		header[i] = column.Name
+	}
+	if err := e.writer.Write(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write wide export: %s", err)
+	}
+
+	return e, nil
+}
+
+// observe takes each probe's fate from the loss tracker. Replies are written
+// as they arrive, so only the losses are kept for the next write.
+func (e *wideExport) observe(seq int, lost bool) {
+	if lost {
+		e.lost = append(e.lost, lostProbe{seq: seq, at: time.Now()})
+	}
+}
+
+func (e *wideExport) Close() error {
+	e.writer.Flush()
+	if err := e.writer.Error(); err != nil {
+		e.file.Close()
+		return fmt.Errorf("failed to write wide export: %s", err)
+	}
+
+	return e.file.Close()
+}
+
+// ExportSamples writes rows for the probes given up on and the pauses since
+// the last call, then one for result if there is one, and publishes them to
+// the status feed and the results file.
+func (m *Model) ExportSamples(result *ping.Result) error {
+	m.publishStatus(result)
+	m.publishDashboard()
+	m.recordResults(result)
+	m.forwardSamples(result)
+
+	e := m.wide
+	if e == nil {
+		return nil
+	}
+
+	now := time.Now()
+	e.readWireless(m.Stats.Route, now)
+
+	for _, probe := range e.lost {
+		if err := e.writer.Write(m.wideRow(probe.at, probe.seq, nil)); err != nil {
+			return fmt.Errorf("failed to write wide export: %s", err)
+		}
+	}
+	e.lost = e.lost[:0]
+
+	for _, mark := range m.Stats.Marks[e.marked:] {
+		if err := e.writer.Write(m.wideMark(mark)); err != nil {
+			return fmt.Errorf("failed to write wide export: %s", err)
+		}
+	}
+	e.marked = len(m.Stats.Marks)
+
+	if result != nil {
+		if err := e.writer.Write(m.wideRow(now, result.Seq, result)); err != nil {
+			return fmt.Errorf("failed to write wide export: %s", err)
+		}
+	}
+
+	e.writer.Flush()
+	if err := e.writer.Error(); err != nil {
+		return fmt.Errorf("failed to write wide export: %s", err)
+	}
+
+	return nil
+}
+
+func (e *wideExport) readWireless(iface string, now time.Time) {
+	if iface == "" || now.Sub(e.readAt) < WIFI_READ_INTERVAL {
+		return
+	}
+	e.readAt = now
+
+	wifi, err := ifstat.ReadWireless(iface)
+	if err != nil {
+		return
+	}
+
+	e.wifi, e.wifiOK, e.wifiAt = wifi, true, now
+}
+
+// wideRow fills in WIDE_COLUMNS for one probe, with a nil result for a lost
+// one.
+func (m *Model) wideRow(at time.Time, seq int, result *ping.Result) []string {
+	e := m.wide
+	values := map[string]string{
+		"time":                     at.UTC().Format(stats.STORED_TIME),
+		"run_id":                   m.Stats.RunID,
+		"host":                     m.Host,
+		"seq":                      strconv.Itoa(seq),
+		"lost":                     strconv.FormatBool(result == nil),
+		"interface":                m.Stats.Route,
+		"outage_open":              strconv.FormatBool(m.Stats.ActiveIncidentOf("") != nil),
+		"vpn_active":               strconv.FormatBool(route.IsVPN(m.Stats.Route)),
+		"captive_portal_suspected": strconv.FormatBool(suspectCaptivePortal(m.Stats.Metadata, m.Host)),
+	}
+
+	if result != nil {
+		values["rtt_ms"] = strconv.FormatFloat(float64(result.Duration.Microseconds())/1000, 'f', 3, 64)
+		if result.TTL > 0 {
+			values["ttl"] = strconv.Itoa(result.TTL)
+		}
+	}
+
+	if e.wifiOK && at.Sub(e.wifiAt) <= WIFI_STALE_AFTER {
+		values["wifi_signal_dbm"] = strconv.FormatFloat(e.wifi.SignalDBm, 'f', -1, 64)
+		values["wifi_link_quality"] = strconv.FormatFloat(e.wifi.LinkQuality, 'f', -1, 64)
+	}
+
+	stale := COUNTERS_STALE_INTERVALS * max(m.interval, time.Second)
+	if m.counters != nil && !m.counters.Updated().IsZero() && at.Sub(m.counters.Updated()) <= stale {
+		values["rx_bps"] = strconv.FormatFloat(m.counters.RxRate, 'f', 0, 64)
+		values["tx_bps"] = strconv.FormatFloat(m.counters.TxRate, 'f', 0, 64)
+	}
+
+	if call := m.Stats.LastCall(); call != nil {
+		values["mos"] = strconv.FormatFloat(call.MOS, 'f', 2, 64)
+	}
+
+	values["annotations"] = m.wideAnnotations()
+	values["after_pause"] = strconv.FormatBool(len(m.Stats.Pauses) > e.pauses)
+	e.pauses = len(m.Stats.Pauses)
+
+	return wideValues(values)
+}
+
+// wideMark is the row for a pause starting or ending, which has no probe to
+// describe.
+func (m *Model) wideMark(mark stats.PauseMark) []string {
+	return wideValues(map[string]string{
+		"time":        mark.Time.UTC().Format(stats.STORED_TIME),
+		"run_id":      m.Stats.RunID,
+		"host":        m.Host,
+		"annotations": m.wideAnnotations(),
+		"event":       mark.Event,
+	})
+}
+
+// wideAnnotations is the events logged since the previous row.
+func (m *Model) wideAnnotations() string {
+	e := m.wide
+	var annotations []string
+	for _, event := range m.Stats.Events[min(e.annotated, len(m.Stats.Events)):] {
+		annotations = append(annotations, event.Kind+": "+event.Message)
+	}
+	e.annotated = len(m.Stats.Events)
+
+	return strings.Join(annotations, "; ")
+}
+
+func wideValues(values map[string]string) []string {
+	row := make([]string, len(WIDE_COLUMNS))
+	for i, column := range WIDE_COLUMNS {
+		row[i] = values[column.Name]
+	}
+
+	return row
+}
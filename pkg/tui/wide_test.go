@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ifstat"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestWideExport joins probes with a fake Wi-Fi reading and interface
+// counters, checking that each is dropped once past its staleness limit and
+// that events annotate only the row after them.
+func TestWideExport(t *testing.T) {
+	dir := t.TempDir()
+
+	export, err := newWideExport(filepath.Join(dir, "wide.csv"))
+	if err != nil {
+		t.Fatalf("create export: expected no error, got %v", err)
+	}
+	defer export.Close()
+
+	read := ifstat.ReadWireless
+	defer func() { ifstat.ReadWireless = read }()
+	ifstat.ReadWireless = func(string) (ifstat.Wireless, error) {
+		return ifstat.Wireless{LinkQuality: 60, SignalDBm: -55}, nil
+	}
+
+	start := time.Now()
+	m := Model{Host: "example.com", interval: time.Second, wide: export, counters: &ifstat.Sampler{}, Stats: stats.New(time.Second, time.Minute, stats.DEFAULT_THRESHOLDS)}
+	m.Stats.Route = "wlan0"
+	m.counters.Add("wlan0", ifstat.Counters{}, start.Add(-time.Second))
+	m.counters.Add("wlan0", ifstat.Counters{RxBytes: 1000, TxBytes: 500}, start)
+	export.readWireless(m.Stats.Route, start)
+	m.Stats.AddEvent("route", "switched to wlan0")
+
+	column := func(row []string, name string) string {
+		for i, c := range WIDE_COLUMNS {
+			if c.Name == name {
+				return row[i]
+			}
+		}
+		return "missing"
+	}
+
+	result := &ping.Result{Seq: 1, Duration: 12500 * time.Microsecond, TTL: 57}
+	rows := []struct {
+		name   string
+		row    []string
+		column string
+		value  string
+	}{
+		{"fresh", m.wideRow(start, 1, result), "wifi_signal_dbm", "-55"},
+		{"fresh", m.wideRow(start, 1, result), "rx_bps", "8000"},
+		{"fresh", m.wideRow(start, 1, result), "rtt_ms", "12.500"},
+		{"lost", m.wideRow(start, 2, nil), "rtt_ms", ""},
+		{"lost", m.wideRow(start, 2, nil), "lost", "true"},
+		{"counters stale", m.wideRow(start.Add(4*time.Second), 3, result), "rx_bps", ""},
+		{"counters stale", m.wideRow(start.Add(4*time.Second), 3, result), "wifi_signal_dbm", "-55"},
+		{"wi-fi stale", m.wideRow(start.Add(WIFI_STALE_AFTER+time.Second), 4, result), "wifi_signal_dbm", ""},
+	}
+
+	for _, r := range rows {
+		if actual := column(r.row, r.column); actual != r.value {
+			t.Fatalf("%s: %s: expected %q, got %q", r.name, r.column, r.value, actual)
+		}
+	}
+
+	export.annotated = 0
+	first, second := m.wideRow(start, 5, result), m.wideRow(start, 6, result)
+	if column(first, "annotations") != "route: switched to wlan0" || column(second, "annotations") != "" {
+		t.Fatalf("event annotates the next row only: expected route: switched to wlan0, then nothing, got %q, then %q", column(first, "annotations"), column(second, "annotations"))
+	}
+}
@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"fmt"
+)
+
+// windowsTab lists the windows kept, newest at the bottom, scrolled back from
+// the newest by scroll.
+type windowsTab struct {
+	scroll int
+}
+
+func (t *windowsTab) name() string { return "windows" }
+
+func (t *windowsTab) view(m Model) []string {
+	if m.Stats.History == nil {
+		return []string{"Windows: not kept, with --window-history 0"}
+	}
+
+	records := m.Stats.Windows()
+	if len(records) == 0 {
+		return []string{fmt.Sprintf("Windows: none completed yet, keeping the last %d", m.Stats.History.Keep)}
+	}
+
+	// A line goes to the column headings under the title, and another to the
+	// worst window of the run once it's no longer kept.
+	worst := m.Stats.WorstWindow()
+	gone := worst != nil && worst.Start.Before(records[0].Start)
+	rows := m.windowRows()
+	if gone {
+		rows = max(rows-1, 1)
+	}
+	end := len(records) - t.scroll
+	start := max(end-rows, 0)
+	lines := []string{
+		m.theme.Header.Render(fmt.Sprintf("Windows: %d-%d of %d, keeping the last %d", start+1, end, len(records), m.Stats.History.Keep)),
+		m.theme.Muted.Render(fmt.Sprintf("%-*s  %8s %8s %8s  %7s", len(m.Stats.Times.Clock(records[0].Start)), "Start", "Min", "Avg", "Max", "Loss")),
+	}
+	for _, record := range records[start:end] {
+		line := m.Stats.PrintWindowRecord(record)
+		if worst != nil && record.Start.Equal(worst.Start) {
+			line = m.theme.Bad.Render(line + " ← worst of the run")
+		} else if record.LossPct > 0 {
+			line = m.theme.Warn.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if gone {
+		lines = append(lines, m.theme.Bad.Render(m.Stats.PrintWindowRecord(*worst)+" ← worst of the run, no longer kept"))
+	}
+
+	return lines
+}
+
+func (m Model) windowRows() int {
+	return max(m.eventRows()-1, 1)
+}
+
+func (t *windowsTab) key(m *Model, action string) bool {
+	count := len(m.Stats.Windows())
+	switch action {
+	case "window-back":
+		t.scroll++
+	case "window-forward":
+		t.scroll--
+	case "window-oldest":
+		t.scroll = count
+	case "window-newest":
+		t.scroll = 0
+	default:
+		return false
+	}
+
+	t.scroll = max(min(t.scroll, count-m.windowRows()), 0)
+	return true
+}
@@ -0,0 +1,62 @@
+package tui
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+func TestWindowHistory(t *testing.T) {
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = start
+	s.History = stats.NewWindowHistory(3)
+
+	// Each window is five seconds, holding the sample on its end, and is
+	// closed by the one after at 6s, 11s and so on.
+	for seq := 1; seq <= 30; seq++ {
+		now = start.Add(time.Duration(seq) * time.Second)
+		s.Update(time.Duration(10+seq) * time.Millisecond)
+	}
+
+	records := s.Windows()
+	if len(records) != 3 || cap(s.History.Records) != 3 {
+		t.Fatalf("only the last windows are kept, in the room given at the start: expected 3 in a capacity of 3, got %d in a capacity of %d", len(records), cap(s.History.Records))
+	}
+	for i, record := range records {
+		from := start.Add(time.Duration(10+5*i) * time.Second)
+		if !record.Start.Equal(from) || !record.End.Equal(from.Add(5*time.Second)) {
+			t.Fatalf("the windows kept are the newest, oldest first: expected %s to %s, got %s to %s", from, from.Add(5*time.Second), record.Start, record.End)
+		}
+	}
+	if last := records[2]; last.Count != 5 || last.MinMs != 31 || last.MaxMs != 35 || last.AvgMs != 33 {
+		t.Fatalf("each window is kept with its figures: expected 5 samples, 31ms to 35ms, 33ms avg, got %d samples, %gms to %gms, %gms avg", last.Count, last.MinMs, last.MaxMs, last.AvgMs)
+	}
+
+	data, err := json.Marshal(stats.ResultsSummary{Windows: records})
+	if err != nil || !strings.Contains(string(data), `"windows":[{"start":"2026-03-01T03:00:10Z","end":"2026-03-01T03:00:15Z","count":5,"min_ms":21,"avg_ms":23,"max_ms":25,"loss_pct":0,"min_at":"2026-03-01T03:00:11Z","max_at":"2026-03-01T03:00:15Z"}`) {
+		t.Fatalf("the results summary carries the windows: expected \"windows\":[{\"start\":\"2026-03-01T03:00:10Z\",..., got %q", string(data))
+	}
+
+	keys, _ := NewKeyMap(nil)
+	m := Model{Stats: s, tabs: newTabSet(false), keys: keys, rows: TAB_CHROME + 4}
+	m.tabs.show("windows")
+	if lines := m.tabs.current().view(m); len(lines) != 4 || !strings.Contains(lines[0], "Windows: 2-3 of 3") {
+		t.Fatalf("the windows tab shows the newest that fit: expected Windows: 2-3 of 3 and two rows, got %q", strings.Join(lines, "\n"))
+	}
+	m.tabs.key(&m, "home")
+	m.tabs.key(&m, "k")
+	if lines := m.tabs.current().view(m); !strings.Contains(lines[0], "Windows: 1-2 of 3") {
+		t.Fatalf("scrolling stops at the oldest window: expected Windows: 1-2 of 3, got %q", lines[0])
+	}
+
+	m.Stats.Reset()
+	if len(m.Stats.Windows()) != 3 {
+		t.Fatalf("a reset leaves the windows kept, as the history of the run: expected 3, got %v", len(m.Stats.Windows()))
+	}
+}
@@ -0,0 +1,53 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// WINDOW_TICK_MIN keeps the window ticker from spinning while a pause holds
+// a window open. Waking late costs nothing, since windows close on their
+// boundaries however late CloseWindows gets to them.
+const WINDOW_TICK_MIN = 100 * time.Millisecond
+
+type windowMsg struct{}
+
+// windowTick fires as the window under way ends, so that it closes even
+// when no reply comes to close it, which is when the display most needs to
+// stop showing the last good window.
+func (m Model) windowTick() tea.Cmd {
+	return tea.Tick(m.untilWindowEnd(), func(time.Time) tea.Msg { return windowMsg{} })
+}
+
+// untilWindowEnd is how long to wait, by the wall clock, for the window
+// under way to end by the stats' clock.
+func (m Model) untilWindowEnd() time.Duration {
+	now := m.Stats.Now()
+	end := m.Stats.WindowEnd(now)
+	if m.Replay != nil {
+		return max(m.Replay.Clock.until(end), WINDOW_TICK_MIN)
+	}
+
+	return max(end.Sub(now), WINDOW_TICK_MIN)
+}
+
+// windowsClosed follows up the windows that closed, from a reply or the
+// ticker, by handing each of them on in turn and saving the state.
+func (m *Model) windowsClosed(closed []stats.ClosedWindow) error {
+	for _, w := range closed {
+		m.WindowComplete(w)
+	}
+	m.phases.Reset()
+	if m.lowPower {
+		return nil
+	}
+	if m.state != "" {
+		if err := stats.SaveState(m.state, &m.Stats); err != nil {
+			return err
+		}
+	}
+
+	return m.crash.checkpoint(&m.Stats, "")
+}
@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+// TestWindowsClosed has the ticker get to several windows at once, checking
+// that each is handed on as it closed rather than only the last.
+func TestWindowsClosed(t *testing.T) {
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	now := start
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.Started, s.WindowStart = start, start
+
+	m := NewModel(nil, s)
+	m.evidence = &evidenceLog{}
+	update := func(msg tea.Msg) {
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	for seq := 1; seq <= 4; seq++ {
+		now = start.Add(time.Duration(seq) * time.Second)
+		update(ping.Result{Seq: seq, Epoch: 1, Duration: 10 * time.Millisecond, At: now})
+	}
+
+	now = start.Add(16 * time.Second)
+	update(windowMsg{})
+
+	windows := m.evidence.windows
+	if len(windows) != 3 {
+		t.Fatalf("each window the ticker closes is handed on: expected 3 windows, got %d", len(windows))
+	}
+	for i, w := range windows {
+		from := start.Add(time.Duration(5*i) * time.Second)
+		count := 0
+		if i == 0 {
+			count = 4
+		}
+		if !w.Start.Equal(from) || !w.End.Equal(from.Add(5*time.Second)) || w.Count != count {
+			t.Fatalf("each window is handed on with its own figures: expected %s with %d replies, got %s with %d", from.Format(time.TimeOnly), count, w.Start.Format(time.TimeOnly), w.Count)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	QUEUE_SIZE       = 64
+	MAX_ATTEMPTS     = 3
+	FIRST_BACKOFF    = time.Second
+	REQUEST_TIMEOUT  = 10 * time.Second
+	SIGNATURE_HEADER = "X-Signature-256"
+)
+
+type Stats struct {
+	Sent      int64
+	Failed    int64
+	Spooled   int64
+	Recovered int64
+	LastError string
+}
+
+type Sender struct {
+	url    string
+	secret []byte
+	spool  string
+	client *http.Client
+	queue  chan []byte
+	// backoff is the wait before the first retry, doubling after each.
+	backoff time.Duration
+
+	sent      atomic.Int64
+	failed    atomic.Int64
+	spooled   atomic.Int64
+	recovered atomic.Int64
+	lastError atomic.Value
+	spoolLock sync.Mutex
+}
+
+func NewSender(url string, secret []byte, spool string) *Sender {
+	return &Sender{
+		url:     url,
+		secret:  secret,
+		spool:   spool,
+		client:  &http.Client{Timeout: REQUEST_TIMEOUT},
+		queue:   make(chan []byte, QUEUE_SIZE),
+		backoff: FIRST_BACKOFF,
+	}
+}
+
+// Send queues a payload without blocking. If the queue is full the payload
+// goes straight to the spool so that nothing is lost.
+func (s *Sender) Send(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %s", err)
+	}
+
+	select {
+	case s.queue <- body:
+	default:
+		s.toSpool(body)
+	}
+
+	return nil
+}
+
+func (s *Sender) Stats() Stats {
+	stats := Stats{
+		Sent:      s.sent.Load(),
+		Failed:    s.failed.Load(),
+		Spooled:   s.spooled.Load(),
+		Recovered: s.recovered.Load(),
+	}
+
+	if err, ok := s.lastError.Load().(string); ok {
+		stats.LastError = err
+	}
+
+	return stats
+}
+
+// Queued is how many payloads are waiting to be sent, out of QUEUE_SIZE.
+func (s *Sender) Queued() int {
+	return len(s.queue)
+}
+
+// Run delivers queued payloads until the context ends, starting with any
+// left in the spool by an earlier run.
+func (s *Sender) Run(ctx context.Context) {
+	s.drainSpool(ctx)
+
+	for {
+		select {
+		case body := <-s.queue:
+			if s.deliverWithRetry(ctx, body) {
+				s.drainSpool(ctx)
+			} else {
+				s.toSpool(body)
+			}
+		case <-ctx.Done():
+			for {
+				select {
+				case body := <-s.queue:
+					s.toSpool(body)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Sender) deliverWithRetry(ctx context.Context, body []byte) bool {
+	backoff := s.backoff
+
+	for attempt := 1; attempt <= MAX_ATTEMPTS; attempt++ {
+		err := s.deliver(ctx, body)
+		if err == nil {
+			s.sent.Add(1)
+			return true
+		}
+
+		s.failed.Add(1)
+		s.lastError.Store(err.Error())
+
+		if attempt == MAX_ATTEMPTS {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return false
+}
+
+func (s *Sender) deliver(ctx context.Context, body []byte) error {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(body)
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if len(s.secret) > 0 {
+		req.Header.Set(SIGNATURE_HEADER, "sha256="+Sign(s.secret, compressed.Bytes()))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+
+	return nil
+}
+
+// Sign is the hex HMAC-SHA256 of the body exactly as sent on the wire.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Sender) toSpool(body []byte) {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	if err := os.MkdirAll(s.spool, 0o755); err != nil {
+		s.lastError.Store(fmt.Sprintf("failed to create spool: %s", err))
+		return
+	}
+
+	name := filepath.Join(s.spool, fmt.Sprintf("%d.json", time.Now().UnixNano()))
+	if err := os.WriteFile(name, body, 0o644); err != nil {
+		s.lastError.Store(fmt.Sprintf("failed to spool payload: %s", err))
+		return
+	}
+
+	s.spooled.Add(1)
+}
+
+type spooled struct {
+	file string
+	body []byte
+}
+
+// drainSpool resends spooled payloads oldest first, stopping at the first
+// failure so that order is kept. Only the reading is done under the lock,
+// so that Send can still spool while a slow webhook is being waited on.
+func (s *Sender) drainSpool(ctx context.Context) {
+	for _, payload := range s.readSpool() {
+		if err := s.deliver(ctx, payload.body); err != nil {
+			s.lastError.Store(err.Error())
+			return
+		}
+
+		os.Remove(payload.file)
+		s.sent.Add(1)
+		s.recovered.Add(1)
+	}
+}
+
+func (s *Sender) readSpool() []spooled {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.spool, "*.json"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(files)
+
+	var payloads []spooled
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		payloads = append(payloads, spooled{file: file, body: body})
+	}
+
+	return payloads
+}
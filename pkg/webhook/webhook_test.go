@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint answering each request with the next of
+// its statuses, or 200 once they run out, and keeping what it was sent.
+type receiver struct {
+	lock     sync.Mutex
+	statuses []int
+	bodies   []int
+	times    []time.Time
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reader, err := gzip.NewReader(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var body struct{ N int }
+	if err := json.NewDecoder(reader).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.bodies = append(r.bodies, body.N)
+	r.times = append(r.times, time.Now())
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() ([]int, []time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]int(nil), r.bodies...), append([]time.Time(nil), r.times...)
+}
+
+func eventually(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !done(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: expected it within 5s, got still waiting", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func spooledFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatalf("listing the spool: expected no error, got %v", err)
+	}
+	return files
+}
+
+// TestRetry checks that a failed delivery is retried with the backoff
+// doubling each time, and that one failing every attempt is spooled.
+func TestRetry(t *testing.T) {
+	r := &receiver{statuses: []int{500, 503, 200, 500, 500, 500}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	s := NewSender(server.URL, nil, dir)
+	s.backoff = 20 * time.Millisecond
+	go s.Run(ctx)
+
+	s.Send(map[string]int{"n": 1})
+	eventually(t, "a payload delivered at the third attempt", func() bool { return s.Stats().Sent == 1 })
+
+	_, times := r.received()
+	if first, second := times[1].Sub(times[0]), times[2].Sub(times[1]); first < 20*time.Millisecond || second < 40*time.Millisecond {
+		t.Fatalf("the backoff doubles: expected waits of at least 20ms then 40ms, got %s then %s", first, second)
+	}
+	if stats := s.Stats(); stats.Failed != 2 || stats.Spooled != 0 || stats.LastError != "webhook returned 503 Service Unavailable" {
+		t.Fatalf("two failed attempts: expected 2 failed, none spooled, the last error kept, got %+v", stats)
+	}
+
+	s.Send(map[string]int{"n": 2})
+	eventually(t, "a payload failing every attempt spooled", func() bool { return s.Stats().Spooled == 1 })
+
+	if bodies, _ := r.received(); len(bodies) != 3+MAX_ATTEMPTS {
+		t.Fatalf("a payload is tried MAX_ATTEMPTS times: expected %d requests, got %d", 3+MAX_ATTEMPTS, len(bodies))
+	}
+	if files := spooledFiles(t, dir); len(files) != 1 {
+		t.Fatalf("the undelivered payload is kept: expected a file in the spool, got %q", files)
+	}
+}
+
+// TestSpool checks that payloads sent while the queue is full are spooled,
+// and that a sender started on the spool later delivers them oldest first
+// with nothing new to send.
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	full := NewSender("http://127.0.0.1:0", nil, dir)
+	for n := 1; n <= QUEUE_SIZE+3; n++ {
+		if err := full.Send(map[string]int{"n": n}); err != nil {
+			t.Fatalf("sending to a full queue: expected no error, got %v", err)
+		}
+	}
+
+	if full.Queued() != QUEUE_SIZE || full.Stats().Spooled != 3 {
+		t.Fatalf("a full queue: expected %d queued and 3 spooled, got %d and %d", QUEUE_SIZE, full.Queued(), full.Stats().Spooled)
+	}
+	if files := spooledFiles(t, dir); len(files) != 3 {
+		t.Fatalf("a full queue: expected 3 files in the spool, got %q", files)
+	}
+
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restarted := NewSender(server.URL, nil, dir)
+	go restarted.Run(ctx)
+
+	eventually(t, "a restart draining the spool", func() bool { return restarted.Stats().Recovered == 3 })
+
+	if bodies, _ := r.received(); len(bodies) != 3 || bodies[0] != QUEUE_SIZE+1 || bodies[2] != QUEUE_SIZE+3 {
+		t.Fatalf("the spool is drained oldest first: expected %d to %d, got %v", QUEUE_SIZE+1, QUEUE_SIZE+3, bodies)
+	}
+	if files := spooledFiles(t, dir); len(files) != 0 {
+		t.Fatalf("delivered payloads leave the spool: expected it empty, got %q", files)
+	}
+}
+
+// TestSlowDrain holds the spool's redelivery up on the webhook and checks
+// that a payload can still be spooled meanwhile.
+func TestSlowDrain(t *testing.T) {
+	requested, release := make(chan struct{}, 1), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1.json"), []byte(`{"n": 0}`), 0o644); err != nil {
+		t.Fatalf("writing a spooled payload: expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewSender(server.URL, nil, dir)
+	go s.Run(ctx)
+	<-requested
+
+	spooled := make(chan struct{})
+	go func() {
+		for n := 1; n <= QUEUE_SIZE+1; n++ {
+			s.Send(map[string]int{"n": n})
+		}
+		close(spooled)
+	}()
+
+	select {
+	case <-spooled:
+	case <-time.After(time.Second):
+		t.Fatalf("Send while the spool drains: expected the overflow spooled straight away, got it waiting on the webhook")
+	}
+	if s.Stats().Spooled != 1 {
+		t.Fatalf("Send while the spool drains: expected 1 spooled, got %d", s.Stats().Spooled)
+	}
+}
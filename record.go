@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+func recordCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "record",
+		Usage: "run as usual, writing every probe result to a file for replay to play back",
+		UsageText: `network-test record --file path [options] [host | host:port | url]
+
+Takes every option a run does, alongside --file, the recording to write,
+which is the same as running with --record-to path. Each result is written as
+the prober gave it, with when it came, and so is each restart, failover or
+lookup failure it noticed, after a first line describing the run.
+
+Examples:
+   network-test record --file evening.ntr --interval 500ms google.co.uk
+   network-test replay --speed 10x evening.ntr`,
+		SkipFlagParsing: true,
+		Action: func(c *cli.Context) error {
+			path, args, err := recordArgs(c.Args().Slice())
+			if err != nil {
+				return err
+			}
+
+			return c.App.RunContext(c.Context, append([]string{c.App.Name, "--record-to", path}, args...))
+		},
+	}
+}
+
+// recordArgs takes --file out of the record command's arguments, leaving the
+// rest for the run.
+func recordArgs(args []string) (string, []string, error) {
+	var path string
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			rest = append(rest, args[i:]...)
+			i = len(args)
+		case arg == "--file" || arg == "-file":
+			if i+1 == len(args) {
+				return "", nil, fmt.Errorf("--file needs the path to record to")
+			}
+			path = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--file=") || strings.HasPrefix(arg, "-file="):
+			path = arg[strings.Index(arg, "=")+1:]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if path == "" {
+		return "", nil, fmt.Errorf("record needs --file, the path to record to")
+	}
+
+	return path, rest, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/target"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// TestRecording writes a recording of two epochs, a loss and a
+// restart notice, reads it back, and plays it back fast, checking results
+// come out as they went in, at the times they came, and that seeking and
+// pausing leave the recording's time where they should.
+func TestRecording(t *testing.T) {
+	dir := t.TempDir()
+
+	started := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC)
+	path := filepath.Join(dir, "session.ntr")
+	file, err := tui.CreateRecording(path, tui.RecordingHeader{RunID: "recorded", Started: started, Mode: target.ICMP, Host: "example.com", IntervalS: 0.1, WindowS: 5})
+	if err != nil {
+		t.Fatalf("recording is created: expected no error, got %v", err)
+	}
+	for i := 1; i <= 6; i++ {
+		epoch := 1 + (i-1)/3
+		result := ping.Result{Epoch: epoch, Seq: i, Duration: time.Duration(i) * time.Millisecond, TTL: 57, At: started.Add(time.Duration(i) * 100 * time.Millisecond)}
+		if i == 2 {
+			result = ping.Result{Epoch: epoch, Seq: i, Lost: true, Reason: ping.LOSS_TIMEOUT, At: result.At}
+		}
+		file.Result(result)
+		if i == 3 {
+			file.Notice(ping.Notice{Kind: "restart", Message: "ping exited, restarting"}, started.Add(350*time.Millisecond))
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("recording is written: expected no error, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("recording is written: expected readable file, got %v", err)
+	}
+	cut := append(slices.Clone(data), []byte(`{"t":900000000,"result":{"ep`)...)
+	for _, variant := range []struct {
+		name string
+		data []byte
+	}{{"whole", data}, {"cut short", cut}} {
+		r, err := tui.ReadRecording(bytes.NewReader(variant.data), "session.ntr")
+		if err != nil {
+			t.Fatalf("a recording %s reads back: expected no error, got %v", variant.name, err)
+		}
+		if len(r.Entries) != 7 || r.Length() != 600*time.Millisecond || r.Header.Host != "example.com" {
+			t.Fatalf("a recording %s reads back: expected 7 entries over 600ms of example.com, got %d entries over %s of %s", variant.name, len(r.Entries), r.Length(), r.Header.Host)
+		}
+	}
+
+	newer := bytes.Replace(data, []byte(`"version":1`), []byte(`"version":2`), 1)
+	if _, err := tui.ReadRecording(bytes.NewReader(newer), "session.ntr"); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("a recording in a newer version is refused: expected an error saying so, got %v", err)
+	}
+	if _, err := tui.ReadRecording(strings.NewReader("PING example.com\n"), "session.ntr"); err == nil {
+		t.Fatalf("something else is refused: expected an error, got none")
+	}
+
+	for text, expected := range map[string]float64{"10x": 10, "2.5": 2.5, "max": MAX_REPLAY_SPEED, "0": 0, "fast": 0} {
+		speed, err := parseSpeed(text)
+		if speed != expected || (err == nil) != (expected > 0) {
+			t.Fatalf("--speed %s: expected %v, got %v (%v)", text, expected, speed, err)
+		}
+	}
+
+	r, err := tui.LoadRecording(path)
+	if err != nil {
+		t.Fatalf("recording loads: expected no error, got %v", err)
+	}
+	for text, expected := range map[string]time.Duration{"250ms": 250 * time.Millisecond, "21:00": 0, "2026-03-01T21:00:00.5Z": 500 * time.Millisecond, "1m": -1, "20:59": -1} {
+		seek, err := parseSeek(text, r, time.UTC)
+		if (expected < 0) != (err != nil) || (err == nil && seek != expected) {
+			t.Fatalf("--seek %s: expected %v, got %s (%v)", text, expected, seek, err)
+		}
+	}
+
+	play := func(p *tui.ReplayProber, each func(ping.Result)) []ping.Result {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var results []ping.Result
+		pings, errs := p.Run(ctx)
+		for result := range pings {
+			results = append(results, result)
+			each(result)
+		}
+		<-errs
+		return results
+	}
+
+	p := tui.NewReplayProber(r, path, MAX_REPLAY_SPEED, 0)
+	results := play(p, func(ping.Result) {})
+	var seqs, epochs []int
+	for _, result := range results {
+		seqs, epochs = append(seqs, result.Seq), append(epochs, result.Epoch)
+		if expected := started.Add(time.Duration(result.Seq) * 100 * time.Millisecond); !result.At.Equal(expected) {
+			t.Fatalf("each result is given at the time it came: expected %q, got %q", expected.Format(time.RFC3339Nano), result.At.Format(time.RFC3339Nano))
+		}
+	}
+	if !slices.Equal(seqs, []int{1, 2, 3, 4, 5, 6}) || !slices.Equal(epochs, []int{1, 1, 1, 2, 2, 2}) {
+		t.Fatalf("results replay in order, a new epoch with each of the recording's: expected seqs [1 2 3 4 5 6], epochs [1 1 1 2 2 2], got seqs %v, epochs %v", seqs, epochs)
+	}
+	if !results[1].Lost || results[1].Reason != ping.LOSS_TIMEOUT || results[2].Duration != 3*time.Millisecond || results[2].TTL != 57 {
+		t.Fatalf("results replay as recorded: expected seq 2 lost to a timeout, seq 3 3ms at ttl 57, got %+v, %+v", results[1], results[2])
+	}
+	select {
+	case notice := <-p.Notices():
+		if notice.Kind != "restart" {
+			t.Fatalf("notices replay as recorded: expected restart, got %q", notice.Kind)
+		}
+	default:
+		t.Fatalf("notices replay as recorded: expected the restart notice, got none")
+	}
+	if !p.Finished() {
+		t.Fatalf("the replay finishes with the recording: expected finished, got still playing")
+	}
+	m := tui.NewModel(p, stats.New(100*time.Millisecond, 5*time.Second, r.Thresholds()))
+	m.Host, m.Target, m.Replay = "example.com", r.Target(), p
+	m.Stats.Clock = p.Clock.Now
+	if line := strings.Split(m.View(), "\n")[1]; !strings.Contains(line, "Replay of "+path+", recorded 2026-03-01T21:00:00.000Z, at 1000x: finished, at 21:00:00") {
+		t.Fatalf("the header says how far the replay has got: expected finished, at the end of the recording, got %q", line)
+	}
+
+	// Played in real time, so that what's after the pause isn't yet due.
+	p = tui.NewReplayProber(r, path, 1, 350*time.Millisecond)
+	var frozen []time.Time
+	results = play(p, func(result ping.Result) {
+		if result.Seq != 4 {
+			return
+		}
+		p.Pause()
+		frozen = append(frozen, p.Clock.Now())
+		time.Sleep(20 * time.Millisecond)
+		frozen = append(frozen, p.Clock.Now())
+		p.Resume()
+	})
+	seqs, epochs = nil, nil
+	for _, result := range results {
+		seqs, epochs = append(seqs, result.Seq), append(epochs, result.Epoch)
+	}
+	if !slices.Equal(seqs, []int{4, 5, 6}) {
+		t.Fatalf("--seek starts from the first result after it: expected seqs [4 5 6], got %v", seqs)
+	}
+	if len(frozen) != 2 || !frozen[0].Equal(frozen[1]) {
+		t.Fatalf("the recording's time stands still while paused: expected the same time twice, got %v", frozen)
+	}
+	if !slices.Equal(epochs, []int{1, 2, 2}) {
+		t.Fatalf("resuming starts a new epoch, as a restart would: expected [1 2 2], got %v", epochs)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/echo"
+)
+
+const DEFAULT_REFLECT_ADDRESS = ":9999"
+
+func reflectCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "reflect",
+		Usage: "echo the datagrams of --mode udp back to where they came from, to run on a box at the far end",
+		UsageText: `network-test reflect [--listen address]
+
+Examples:
+   network-test reflect --listen :9999
+   network-test --mode udp --port 9999 reflector.example.com`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: DEFAULT_REFLECT_ADDRESS,
+				Usage: "address to listen for datagrams on, such as :9999 or 192.0.2.1:9999",
+			},
+			&cli.Float64Flag{
+				Name:  "max-rate",
+				Value: echo.DEFAULT_UDP_LIMITS.PerClient,
+				Usage: "echoes a second sent to any one client address, past which its datagrams are dropped, 0 for no limit",
+			},
+			&cli.Float64Flag{
+				Name:  "max-total-rate",
+				Value: echo.DEFAULT_UDP_LIMITS.Total,
+				Usage: "echoes a second sent in all, so that datagrams spoofed from many addresses can't make a flood of it either, 0 for no limit",
+			},
+			&cli.StringFlag{
+				Name:  "access-log",
+				Usage: "file to append the access log to instead of stdout",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			limits := echo.UDPLimits{PerClient: c.Float64("max-rate"), Total: c.Float64("max-total-rate")}
+			if limits.PerClient < 0 || limits.Total < 0 {
+				return fmt.Errorf("--max-rate and --max-total-rate can't be negative")
+			}
+
+			out, closeLog, err := openAccessLog(c.String("access-log"))
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			address := c.String("listen")
+			log := accessLog(out)
+			log("udp", address, "listening")
+
+			return echo.ServeUDP(ctx, address, limits, log)
+		},
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// MAX_REPLAY_SPEED keeps a replay slow enough for the display to keep up.
+const MAX_REPLAY_SPEED = 1000
+
+func replayCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "play a recording back through the display as if it were happening now",
+		UsageText: `network-test replay [options] recording
+
+The recording, made with record or --record-to, is played back through the
+same figures and display as the run it came from, with the interval,
+window, buckets and levels it was made with, and the gaps between results
+kept as they were, scaled by --speed. Times shown are those of the
+recording. The pause key pauses the replay, and --seek starts it part of
+the way through, as if the run had begun there.
+
+Examples:
+   network-test replay evening.ntr
+   network-test replay --speed 10x --seek 21:30 evening.ntr
+   network-test replay --plain --speed max --seek 45m evening.ntr`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "speed",
+				Value: "1x",
+				Usage: "how much faster than it happened to play the recording, e.g. 10x or 0.5x, or max for as fast as it will go",
+			},
+			&cli.StringFlag{
+				Name:  "seek",
+				Usage: "start from this point of the recording: a time of day such as 21:30, an RFC 3339 time, or how far in, such as 45m",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Value: "tui",
+				Usage: "how results are shown, one of: " + strings.Join(OUTPUTS, ", "),
+			},
+			&cli.BoolFlag{
+				Name:  "plain",
+				Usage: "print a line per result rather than drawing the display, the same as --output plain",
+			},
+			&cli.BoolFlag{
+				Name:  "force-tui",
+				Usage: "use the interactive display even if the terminal looks unsuitable",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "config file to read the keys section from (default: network-test/config.yaml in the XDG config dir)",
+			},
+			&cli.StringFlag{
+				Name:  "theme",
+				Value: "default",
+				Usage: "colour theme, one of: " + strings.Join(theme.Names(), ", "),
+			},
+			&cli.StringFlag{
+				Name:  "time-format",
+				Value: stats.TIME_LOCAL,
+				Usage: "how times are shown, one of: " + strings.Join(stats.TIME_FORMATS, ", ") + " (relative counts from the start of the recording)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			switch {
+			case c.NArg() > 1 && strings.HasPrefix(c.Args().Get(1), "-"):
+				return fmt.Errorf("options go before the recording, as in network-test replay %s %s", strings.Join(c.Args().Tail(), " "), c.Args().First())
+			case c.NArg() != 1:
+				return fmt.Errorf("replay takes the one recording to play")
+			}
+			r, err := tui.LoadRecording(c.Args().First())
+			if err != nil {
+				return err
+			}
+
+			speed, err := parseSpeed(c.String("speed"))
+			if err != nil {
+				return err
+			}
+			seek, err := parseSeek(c.String("seek"), r, time.Local)
+			if err != nil {
+				return err
+			}
+
+			output := c.String("output")
+			if c.Bool("plain") {
+				if c.IsSet("output") && output != "plain" {
+					return fmt.Errorf("--plain can't be used with --output %s", output)
+				}
+				output = "plain"
+			}
+			if !slices.Contains(OUTPUTS, output) {
+				return fmt.Errorf("unknown output %q, expected one of: %s", output, strings.Join(OUTPUTS, ", "))
+			}
+
+			file, err := loadSettings(c.String("config"))
+			if err != nil {
+				return err
+			}
+			keys, err := tui.NewKeyMap(file.Keys)
+			if err != nil {
+				return err
+			}
+			t, err := theme.Get(c.String("theme"))
+			if err != nil {
+				return err
+			}
+
+			replay := tui.NewReplayProber(r, c.Args().First(), speed, seek)
+			times, err := stats.NewTimeFormat(c.String("time-format"), r.Header.Started, time.Local)
+			if err != nil {
+				return err
+			}
+
+			h := r.Header
+			return tui.Run(c.Context, tui.Config{
+				Target:        r.Target(),
+				Host:          h.Host,
+				Interval:      time.Duration(h.IntervalS * float64(time.Second)),
+				Window:        int64(h.WindowS),
+				RunID:         h.RunID,
+				HalfLife:      stats.DEFAULT_LOSS_HALF_LIFE,
+				TopN:          stats.DEFAULT_TOP_N,
+				Outages:       stats.DEFAULT_OUTAGE_PROBES,
+				WorstMinutes:  stats.DEFAULT_WORST_MINUTES,
+				WindowHistory: stats.DEFAULT_WINDOW_HISTORY,
+				Theme:         t,
+				Headline:      h.Headline,
+				Levels:        r.Levels(),
+				Thresholds:    r.Thresholds(),
+				Keys:          keys,
+				Output:        output,
+				ForceTUI:      c.Bool("force-tui"),
+				TimeFormat:    times,
+				Sparkline:     stats.SPARK_SAMPLES,
+				Replay:        replay,
+			})
+		},
+	}
+}
+
+// parseSpeed reads --speed as a multiple, with or without the x.
+func parseSpeed(text string) (float64, error) {
+	if text == "max" {
+		return MAX_REPLAY_SPEED, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(text), "x"), 64)
+	if err != nil || speed <= 0 || speed > MAX_REPLAY_SPEED {
+		return 0, fmt.Errorf("invalid --speed %q, expected a multiple up to %dx, such as 10x, or max", text, MAX_REPLAY_SPEED)
+	}
+
+	return speed, nil
+}
+
+// parseSeek reads --seek as how far into the recording to start: given as
+// that, as a time, or as a time of day, taken as the first one after the
+// recording starts.
+func parseSeek(text string, r *tui.Recording, location *time.Location) (time.Duration, error) {
+	if text == "" {
+		return 0, nil
+	}
+
+	var seek time.Duration
+	started := r.Header.Started.In(location)
+	if d, err := time.ParseDuration(text); err == nil {
+		seek = d
+	} else if at, err := time.Parse(time.RFC3339, text); err == nil {
+		seek = at.Sub(started)
+	} else {
+		var clock time.Time
+		for _, layout := range []string{"15:04:05", "15:04"} {
+			if clock, err = time.ParseInLocation(layout, text, location); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid --seek %q, expected a time of day such as 21:30, an RFC 3339 time or how far in, such as 45m", text)
+		}
+
+		at := time.Date(started.Year(), started.Month(), started.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, location)
+		if at.Before(started) {
+			at = at.AddDate(0, 0, 1)
+		}
+		seek = at.Sub(started)
+	}
+
+	if seek < 0 || seek > r.Length() {
+		return 0, fmt.Errorf("--seek %s is outside the recording, which runs from %s for %s", text, started.Format(time.RFC3339), r.Length().Round(time.Second))
+	}
+
+	return seek, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+type exportSchema struct {
+	Flag    string
+	About   string
+	Columns []tui.ExportColumn
+}
+
+// EXPORT_SCHEMAS are the machine-readable outputs whose columns are kept
+// stable. Columns may be added at the end, but never renamed or reordered.
+var EXPORT_SCHEMAS = []exportSchema{
+	{"--wide-csv", "one row per probe: replies as they arrive and losses when they're given up on", tui.WIDE_COLUMNS},
+	{"--status-fd", "one JSON frame per line, as {\"type\": ..., \"data\": ...}; frames are dropped rather than held up for a slow reader", tui.STATUS_COLUMNS},
+	{"--results", "one sample per line in csv and jsonl, or a samples array in json, then a summary on exit", tui.RESULTS_COLUMNS},
+	{"--stats-listen", "a JSON object served at /stats, replaced as each window completes; schema is raised whenever a field changes", tui.STATS_COLUMNS},
+	{"--serve", "a JSON object served at " + tui.DASHBOARD_API + " for the dashboard page, replaced after each sample", tui.DASHBOARD_COLUMNS},
+	{"--forward", "a gzipped JSON batch POSTed after each window, signed with the shared secret in X-Signature-256", tui.FORWARD_COLUMNS},
+	{"--version --json", "the build, also in the run metadata of the --state file and summaries, and as build beside a status of ok at /healthz under --stats-listen and collect", tui.VERSION_COLUMNS},
+}
+
+func schemaCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "schema",
+		Usage: "describe the columns of the machine-readable exports",
+		Action: func(c *cli.Context) error {
+			for i, schema := range EXPORT_SCHEMAS {
+				if i > 0 {
+					fmt.Println()
+				}
+
+				fmt.Printf("%s: %s\n", schema.Flag, schema.About)
+				for _, column := range schema.Columns {
+					fmt.Printf("  %-26s %-18s %s\n", column.Name, column.Type, column.Description)
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,231 @@
+//go:build !minimal
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+type selftestSample struct {
+	duration time.Duration
+	lost     bool
+}
+
+type selftestDataset struct {
+	name     string
+	samples  []selftestSample
+	expected stats.Window
+}
+
+type selftestFailure struct {
+	invariant string
+	expected  string
+	actual    string
+}
+
+func selftestCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "selftest",
+		Usage: "run the stats pipeline against synthetic data with known answers",
+		UsageText: `network-test selftest
+
+A build with -tags=minimal leaves this command out.
+
+Examples:
+   network-test selftest && echo "stats pipeline OK"`,
+		Action: func(c *cli.Context) error {
+			failed := 0
+
+			for _, dataset := range selftestDatasets() {
+				failures := runSelftest(dataset)
+				if len(failures) == 0 {
+					fmt.Printf("PASS %s\n", dataset.name)
+					continue
+				}
+
+				failed++
+				fmt.Printf("FAIL %s\n", dataset.name)
+				for _, f := range failures {
+					fmt.Printf("     %s\n       expected: %s\n       actual:   %s\n", f.invariant, f.expected, f.actual)
+				}
+			}
+
+			if failed > 0 {
+				return cli.Exit(fmt.Sprintf("%d datasets failed", failed), 1)
+			}
+
+			return nil
+		},
+	}
+}
+
+func selftestDatasets() []selftestDataset {
+	var datasets []selftestDataset
+
+	fixed := selftestDataset{name: "fixed latency"}
+	for i := 0; i < 600; i++ {
+		fixed.samples = append(fixed.samples, selftestSample{duration: 20 * time.Millisecond})
+	}
+	fixed.expected = stats.Window{Min: 20 * time.Millisecond, Max: 20 * time.Millisecond, Total: 20 * 600 * time.Millisecond, Count: 600}
+	datasets = append(datasets, fixed)
+
+	rng := rand.New(rand.NewSource(1))
+	uniform := selftestDataset{name: "uniform distribution"}
+	for i := 0; i < 10000; i++ {
+		d := time.Duration(1+rng.Intn(200)) * time.Millisecond
+		uniform.samples = append(uniform.samples, selftestSample{duration: d})
+		uniform.expected.Update(d)
+	}
+	datasets = append(datasets, uniform)
+
+	bursty := selftestDataset{name: "bursty loss"}
+	for i := 0; i < 1000; i++ {
+		lost := i%100 >= 90
+		bursty.samples = append(bursty.samples, selftestSample{duration: 35 * time.Millisecond, lost: lost})
+		if !lost {
+			bursty.expected.Update(35 * time.Millisecond)
+		}
+	}
+	datasets = append(datasets, bursty)
+
+	loopback := selftestDataset{name: "sub-millisecond samples"}
+	for i := 0; i < 300; i++ {
+		loopback.samples = append(loopback.samples, selftestSample{duration: time.Duration(250+500*(i%2)) * time.Microsecond})
+	}
+	loopback.expected = stats.Window{Min: 250 * time.Microsecond, Max: 750 * time.Microsecond, Total: 150 * time.Millisecond, Count: 300}
+	datasets = append(datasets, loopback)
+
+	return datasets
+}
+
+// selftestRun is what replaying a dataset left behind, for the invariants
+// to check.
+type selftestRun struct {
+	dataset      selftestDataset
+	stats        *stats.Stats
+	sent         int
+	windowCounts int
+	state        stats.RunState
+}
+
+// lost is how many probes the run went without a reply to.
+func (r selftestRun) lost() int {
+	return r.sent - r.stats.Totals.Count
+}
+
+// overflow is how many of the dataset's replies were slower than the last
+// threshold.
+func (r selftestRun) overflow() int {
+	overflow := 0
+	for _, sample := range r.dataset.samples {
+		if !sample.lost && sample.duration > stats.DEFAULT_THRESHOLDS[len(stats.DEFAULT_THRESHOLDS)-1] {
+			overflow++
+		}
+	}
+
+	return overflow
+}
+
+// bucketed is how many replies the histogram's buckets hold.
+func (r selftestRun) bucketed() int {
+	bucketed := 0
+	for _, count := range r.stats.Histogram.Buckets() {
+		bucketed += count
+	}
+
+	return bucketed
+}
+
+// SELFTEST_INVARIANTS are checked against every dataset, each giving what
+// it expected of the run and what the run came to.
+var SELFTEST_INVARIANTS = []struct {
+	name  string
+	check func(r selftestRun) (expected, actual any)
+}{
+	{"sample count", func(r selftestRun) (any, any) { return r.dataset.expected.Count, r.stats.Totals.Count }},
+	{"minimum", func(r selftestRun) (any, any) { return r.dataset.expected.Min, r.stats.Totals.Min }},
+	{"maximum", func(r selftestRun) (any, any) { return r.dataset.expected.Max, r.stats.Totals.Max }},
+	{"average", func(r selftestRun) (any, any) { return r.dataset.expected.Average(), r.stats.Totals.Average() }},
+	{"min <= avg <= max", func(r selftestRun) (any, any) {
+		totals := r.stats.Totals
+		return true, totals.Average() >= totals.Min && totals.Average() <= totals.Max
+	}},
+	{"window counts sum to totals", func(r selftestRun) (any, any) { return r.stats.Totals.Count, r.windowCounts }},
+	{"loss counted exactly", func(r selftestRun) (any, any) { return len(r.dataset.samples) - r.dataset.expected.Count, r.lost() }},
+	{"histogram total matches sample count", func(r selftestRun) (any, any) { return r.stats.Totals.Count, r.stats.Histogram.Total() }},
+	{"histogram buckets plus overflow match total", func(r selftestRun) (any, any) { return r.stats.Histogram.Total(), r.bucketed() + r.overflow() }},
+	{"overflow bucket counts samples past the last threshold", func(r selftestRun) (any, any) { return r.overflow(), r.stats.Histogram.Overflow() }},
+	{"rolling histogram only holds the last window", func(r selftestRun) (any, any) {
+		limit := int(r.stats.WindowSize/time.Second) + 1
+		return true, r.stats.Rolling.Total() <= limit
+	}},
+	{"state file keeps run id", func(r selftestRun) (any, any) { return r.stats.RunID, r.state.RunID }},
+	{"state file keeps totals", func(r selftestRun) (any, any) { return r.stats.Totals, r.state.Totals }},
+	{"state file keeps histogram", func(r selftestRun) (any, any) { return r.stats.Histogram.Total(), r.state.Histogram.Total }},
+}
+
+// runSelftest replays a dataset at one sample per second through a Stats
+// with a fake clock and a state file round trip, then checks the run
+// against every invariant.
+func runSelftest(dataset selftestDataset) []selftestFailure {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := stats.New(time.Second, 5*time.Second, stats.DEFAULT_THRESHOLDS)
+	s.Clock = func() time.Time { return now }
+	s.WindowStart = now
+	s.RunID = "selftest"
+
+	run := selftestRun{dataset: dataset, stats: &s}
+	for _, sample := range dataset.samples {
+		now = now.Add(time.Second)
+		run.sent++
+		if sample.lost {
+			continue
+		}
+
+		// Of the windows a reply closes, only the first can have had any.
+		open := s.Window.Count
+		if s.Update(sample.duration) {
+			run.windowCounts += open
+		}
+	}
+	run.windowCounts += s.Window.Count
+
+	state, err := roundTrip(&s)
+	if err != nil {
+		return []selftestFailure{{"state file round trip", "saved and loaded state", err.Error()}}
+	}
+	run.state = state
+
+	var failures []selftestFailure
+	for _, invariant := range SELFTEST_INVARIANTS {
+		expected, actual := invariant.check(run)
+		if fmt.Sprint(expected) != fmt.Sprint(actual) {
+			failures = append(failures, selftestFailure{invariant.name, fmt.Sprint(expected), fmt.Sprint(actual)})
+		}
+	}
+
+	return failures
+}
+
+// roundTrip saves the stats to a state file and loads them back.
+func roundTrip(s *stats.Stats) (stats.RunState, error) {
+	dir, err := os.MkdirTemp("", "network-test-selftest")
+	if err != nil {
+		return stats.RunState{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	if err := stats.SaveState(path, s); err != nil {
+		return stats.RunState{}, err
+	}
+
+	return stats.LoadState(path)
+}
@@ -0,0 +1,19 @@
+//go:build minimal
+
+package main
+
+import "github.com/urfave/cli/v2"
+
+// selftestCommand is left out of a build with -tags=minimal, for a device
+// with little room to spare, along with its synthetic datasets. It's hidden
+// from --help there and only says how to get it back.
+func selftestCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "selftest",
+		Usage:  "not compiled in",
+		Hidden: true,
+		Action: func(c *cli.Context) error {
+			return cli.Exit("selftest is not compiled in: rebuild without -tags=minimal", 1)
+		},
+	}
+}
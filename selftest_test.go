@@ -0,0 +1,17 @@
+//go:build !minimal
+
+package main
+
+import "testing"
+
+// TestSelftest runs the datasets the selftest command does, each against
+// every invariant.
+func TestSelftest(t *testing.T) {
+	for _, dataset := range selftestDatasets() {
+		t.Run(dataset.name, func(t *testing.T) {
+			for _, f := range runSelftest(dataset) {
+				t.Errorf("%s: expected %s, got %s", f.invariant, f.expected, f.actual)
+			}
+		})
+	}
+}
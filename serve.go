@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/echo"
+)
+
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "run echo responders to use as targets for the tcp, udp and http modes",
+		UsageText: `network-test serve [--tcp port] [--udp port] [--http port]
+
+Examples:
+   network-test serve --tcp 9000 --udp 9000 --http 9001
+   network-test serve --http 8080 --max-per-client 2 --access-log access.log`,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "tcp",
+				Usage: "port to run the tcp echo responder on",
+			},
+			&cli.IntFlag{
+				Name:  "udp",
+				Usage: "port to run the udp reflector on, limited as network-test reflect is by default",
+			},
+			&cli.IntFlag{
+				Name:  "http",
+				Usage: "port to run the http 204 responder on",
+			},
+			&cli.IntFlag{
+				Name:  "max-per-client",
+				Value: 8,
+				Usage: "concurrent tcp connections or http requests allowed per client address, 0 for no limit",
+			},
+			&cli.StringFlag{
+				Name:  "access-log",
+				Usage: "file to append the access log to instead of stdout",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Int("tcp") == 0 && c.Int("udp") == 0 && c.Int("http") == 0 {
+				return fmt.Errorf("nothing to serve, give at least one of --tcp, --udp or --http")
+			}
+
+			out, closeLog, err := openAccessLog(c.String("access-log"))
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return serve(ctx, c.Int("tcp"), c.Int("udp"), c.Int("http"), c.Int("max-per-client"), out)
+		},
+	}
+}
+
+// openAccessLog is the file to append the access log to, or stdout when
+// there's no path.
+func openAccessLog(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return os.Stdout, func() {}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open access log: %s", err)
+	}
+
+	return file, func() { file.Close() }, nil
+}
+
+// accessLog writes the responders' lines to out, a whole line at a time.
+func accessLog(out io.Writer) echo.Logger {
+	var lock sync.Mutex
+	return func(proto string, client string, message string) {
+		lock.Lock()
+		defer lock.Unlock()
+		fmt.Fprintf(out, "%s %s %s %s\n", time.Now().UTC().Format(time.RFC3339), proto, client, message)
+	}
+}
+
+// serve runs the requested responders until the context ends or any one of
+// them fails, which stops the rest.
+func serve(ctx context.Context, tcpPort int, udpPort int, httpPort int, perClient int, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	log := accessLog(out)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	run := func(name string, port int, responder func(address string) error) {
+		if port == 0 {
+			return
+		}
+
+		address := fmt.Sprintf(":%d", port)
+		log(name, address, "listening")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := responder(address); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+	run("tcp", tcpPort, func(address string) error { return echo.ServeTCP(ctx, address, perClient, log) })
+	run("udp", udpPort, func(address string) error { return echo.ServeUDP(ctx, address, echo.DEFAULT_UDP_LIMITS, log) })
+	run("http", httpPort, func(address string) error { return echo.ServeHTTP(ctx, address, perClient, log) })
+
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
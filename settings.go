@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/settings"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// loadSettings reads the config file at path, or the default one if there
+// is one when path isn't set.
+func loadSettings(path string) (settings.File, error) {
+	if path != "" {
+		return settings.Load(path, true)
+	}
+
+	path, err := settings.DefaultPath()
+	if err != nil {
+		return settings.File{}, err
+	}
+
+	return settings.Load(path, false)
+}
+
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "check and show the config file",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "show",
+				Usage: "check the config file and print it as it's applied, with every key binding, defaults included",
+				UsageText: `network-test config show [--config path]
+
+Each action in the keys section is bound to a key or a list of them, such as
+quit: [ctrl+q] or pause: P. Actions left out keep their defaults, and an
+empty list leaves one unbound. ctrl+c always quits.`,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Usage: "config file to read (default: network-test/config.yaml in the XDG config dir)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					file, err := loadSettings(c.String("config"))
+					if err != nil {
+						return err
+					}
+					keys, err := tui.NewKeyMap(file.Keys)
+					if err != nil {
+						return err
+					}
+
+					fmt.Println(keys.Show())
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// applyProfile gives the flags of the --profile named the values it sets
+// for them, as if they'd been on the command line, leaving those that were.
+// A target given as an argument, or by --url or --compare, replaces the
+// profile's hosts and their mode.
+func applyProfile(c *cli.Context, file settings.File) error {
+	name := c.String("profile")
+	if name == "" {
+		return nil
+	}
+	profile, err := file.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	targeted := c.Args().Present() || c.IsSet("url") || c.IsSet("compare")
+	isSet := func(flag string) bool {
+		if targeted && (flag == "host" || flag == "mode") {
+			return true
+		}
+		return c.IsSet(flag)
+	}
+	for _, setting := range settings.Unset(profile.Settings(), isSet) {
+		for _, value := range setting.Values {
+			if err := c.Set(setting.Flag, value); err != nil {
+				return fmt.Errorf("profile %q: invalid --%s %q: %s", name, setting.Flag, value, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func profilesCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "profiles",
+		Usage: "list the profiles the config file defines, with the flags each sets",
+		UsageText: `network-test profiles [--config path]
+
+Profiles are in the profiles section of the config file, each named and
+setting any of the hosts, mode, port, interval, window, buckets, warn, crit,
+warn_loss, crit_loss, max_avg, max_p99, max_loss, alert_consecutive_loss,
+alert_window_loss, alert_loss_window, slo, theme, output and results, as the
+flags of the same name would:
+
+   profiles:
+     home-wifi:
+       hosts: [router.local, 1.1.1.1]
+       interval: 500ms
+       warn: 30ms
+
+Run one with --profile home-wifi, where flags on the command line take
+precedence over the profile's.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "config file to read (default: network-test/config.yaml in the XDG config dir)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			file, err := loadSettings(c.String("config"))
+			if err != nil {
+				return err
+			}
+			if len(file.Profiles) == 0 {
+				fmt.Println("No profiles defined")
+				return nil
+			}
+
+			for _, name := range file.ProfileNames() {
+				var flags []string
+				for _, setting := range file.Profiles[name].Settings() {
+					flags = append(flags, setting.String())
+				}
+				fmt.Printf("%s: %s\n", name, strings.Join(flags, " "))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/duration"
+)
+
+// TestApplyProfile runs a profile through the flags, checking its values go
+// in as if typed, there for anything asking IsSet, and that the command line
+// and a target argument still take precedence.
+func TestApplyProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	config := "profiles:\n  home:\n    hosts: [192.0.2.1, 192.0.2.2]\n    window: 4\n"
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatalf("a config file can be written: expected no error, got %v", err)
+	}
+	var hosts []string
+	var window time.Duration
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "host", Value: cli.NewStringSlice("google.co.uk")},
+			&cli.GenericFlag{Name: "window", Value: duration.New(5*time.Second, time.Second)},
+			&cli.StringFlag{Name: "config"},
+			&cli.StringFlag{Name: "profile"},
+		},
+		Action: func(c *cli.Context) error {
+			file, err := loadSettings(c.String("config"))
+			if err != nil {
+				return err
+			}
+			if err := applyProfile(c, file); err != nil {
+				return err
+			}
+			hosts, window = c.StringSlice("host"), durationOf(c, "window")
+			return nil
+		},
+	}
+	if err := app.Run([]string{"network-test", "--config", path, "--profile", "home"}); err != nil {
+		t.Fatalf("a profile applies: expected no error, got %v", err)
+	}
+	if got := fmt.Sprintf("%s %s", strings.Join(hosts, ","), window); got != "192.0.2.1,192.0.2.2 4s" {
+		t.Fatalf("a profile's hosts replace the default, and its bare numbers read as the flag's unit: expected 192.0.2.1,192.0.2.2 4s, got %q", got)
+	}
+	if err := app.Run([]string{"network-test", "--config", path, "--profile", "home", "--window", "10s"}); err != nil || window != 10*time.Second {
+		t.Fatalf("a flag on the command line beats the profile: expected 10s, got %q", fmt.Sprint(window, err))
+	}
+	if err := app.Run([]string{"network-test", "--config", path, "--profile", "home", "192.0.2.9"}); err != nil || strings.Join(hosts, ",") != "google.co.uk" {
+		t.Fatalf("a target argument replaces the profile's hosts: expected google.co.uk, got %q", fmt.Sprint(hosts, err))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/nettest/pkg/stats"
+)
+
+func levelsOf(c *cli.Context) (stats.Levels, error) {
+	l := stats.Levels{Warn: durationOf(c, "warn"), Crit: durationOf(c, "crit")}
+	if stats.Over(l.Warn, l.Crit) {
+		return stats.Levels{}, fmt.Errorf("--warn %s is over --crit %s", l.Warn, l.Crit)
+	}
+
+	// Loss is a percentage, with 0 turning its colour off.
+	percent := func(name string) (float64, error) {
+		if text := strings.TrimSuffix(c.String(name), "%"); text == "" || text == "0" {
+			return 0, nil
+		}
+		return stats.ParsePercent(c.String(name))
+	}
+	var err error
+	if l.WarnLoss, err = percent("warn-loss"); err != nil {
+		return stats.Levels{}, err
+	}
+	if l.CritLoss, err = percent("crit-loss"); err != nil {
+		return stats.Levels{}, err
+	}
+	if stats.Over(l.WarnLoss, l.CritLoss) {
+		return stats.Levels{}, fmt.Errorf("--warn-loss %s is over --crit-loss %s", c.String("warn-loss"), c.String("crit-loss"))
+	}
+
+	return l, nil
+}
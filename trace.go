@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"ponglehub.co.uk/nettest/pkg/ping"
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/theme"
+	"ponglehub.co.uk/nettest/pkg/trace"
+	"ponglehub.co.uk/nettest/pkg/tui"
+)
+
+// TRACE_EVENTS is how many of the route's events the trace view shows.
+const TRACE_EVENTS = 5
+
+// traceRow is one hop of a --trace run, pinged as if it were a host of its
+// own while it has an address.
+type traceRow struct {
+	hop     trace.Hop
+	panel   *hostPanel
+	ctx     context.Context
+	stop    context.CancelFunc
+	started time.Time
+}
+
+// tracer follows the route to a host, pinging every hop on it, and starts a
+// hop's row over whenever a re-trace finds a different router there.
+type tracer struct {
+	ctx    context.Context
+	cfg    hostsConfig
+	host   string
+	every  time.Duration
+	rows   []*traceRow
+	events []stats.Event
+	traced bool
+	// beyond is how many hops the last trace went past the rows without a
+	// reply, as it does when the host doesn't answer traceroute's probes.
+	beyond int
+	err    error
+
+	newPanel func(ctx context.Context, address string) (*hostPanel, error)
+}
+
+type traceMsg struct {
+	hops []trace.Hop
+	err  error
+}
+
+type retraceMsg struct{}
+
+// hopMsg tags what a hop's pinger produced with its panel, which a re-trace
+// may have dropped since.
+type hopMsg struct {
+	panel *hostPanel
+	msg   tea.Msg
+}
+
+func newTracer(ctx context.Context, cfg hostsConfig, every time.Duration) *tracer {
+	return &tracer{
+		ctx:   ctx,
+		cfg:   cfg,
+		host:  cfg.hosts[0],
+		every: every,
+		newPanel: func(ctx context.Context, address string) (*hostPanel, error) {
+			return newHostPanel(ctx, cfg, address, ping.Binding{})
+		},
+	}
+}
+
+func (t *tracer) event(now time.Time, kind string, message string) {
+	t.events = append(t.events, stats.Event{Time: stats.Stored(now), Kind: kind, Message: message})
+}
+
+func (r *traceRow) close() {
+	if r.stop != nil {
+		r.stop()
+	}
+}
+
+// apply takes the hops of a trace, starting a row for each found at a TTL
+// for the first time or with a different router there than before. A hop
+// that didn't answer this time keeps its row, since that's more often a
+// probe lost than the path changing, and the hops the trace went on past
+// without a reply are left out. It returns the rows started.
+func (t *tracer) apply(hops []trace.Hop, now time.Time) ([]*traceRow, error) {
+	end := len(hops)
+	for end > 0 && hops[end-1].Address == "" {
+		end--
+	}
+
+	var started []*traceRow
+	start := func(hop trace.Hop) (*traceRow, error) {
+		row := &traceRow{hop: hop, started: now}
+		if hop.Address == "" {
+			return row, nil
+		}
+		row.ctx, row.stop = context.WithCancel(t.ctx)
+		p, err := t.newPanel(row.ctx, hop.Address)
+		if err != nil {
+			row.stop()
+			return nil, fmt.Errorf("failed to ping hop %d: %s", hop.TTL, err)
+		}
+		row.panel = p
+		started = append(started, row)
+		return row, nil
+	}
+
+	for i, hop := range hops {
+		if i >= len(t.rows) {
+			if i >= end {
+				break
+			}
+			row, err := start(hop)
+			if err != nil {
+				return started, err
+			}
+			if t.traced {
+				t.event(now, "route", fmt.Sprintf("hop %d added: %s", hop.TTL, hop))
+			}
+			t.rows = append(t.rows, row)
+			continue
+		}
+
+		old := t.rows[i]
+		if hop.Address == "" || hop.Address == old.hop.Address {
+			continue
+		}
+		row, err := start(hop)
+		if err != nil {
+			return started, err
+		}
+		old.close()
+		t.rows[i] = row
+		t.event(now, "route", fmt.Sprintf("hop %d changed from %s to %s", hop.TTL, old.hop, hop))
+	}
+
+	if len(hops) < len(t.rows) {
+		for _, row := range t.rows[len(hops):] {
+			row.close()
+		}
+		t.event(now, "route", fmt.Sprintf("the path is %d hops now, from %d", len(hops), len(t.rows)))
+		t.rows = t.rows[:len(hops)]
+	}
+	t.beyond = len(hops) - len(t.rows)
+	if !t.traced {
+		t.event(now, "route", fmt.Sprintf("traced %d hops to %s", len(t.rows), t.host))
+	}
+	t.traced = true
+
+	return started, nil
+}
+
+// retraced takes a re-trace's hops, or logs why there are none and keeps
+// the path as it was.
+func (t *tracer) retraced(msg traceMsg, now time.Time) ([]*traceRow, error) {
+	if msg.err != nil {
+		if t.ctx.Err() == nil {
+			t.event(now, "route", fmt.Sprintf("re-trace failed, keeping the last path: %s", msg.err))
+		}
+		return nil, nil
+	}
+
+	return t.apply(msg.hops, now)
+}
+
+func (t *tracer) rowOf(p *hostPanel) *traceRow {
+	for _, row := range t.rows {
+		if row.panel == p {
+			return row
+		}
+	}
+
+	return nil
+}
+
+// receive takes what a hop's pinger produced, reporting its row, or nil for
+// a hop a re-trace has dropped, and whether it closed a window.
+func (t *tracer) receive(msg hopMsg, now time.Time) (*traceRow, bool) {
+	row := t.rowOf(msg.panel)
+	if row == nil {
+		return nil, false
+	}
+
+	switch inner := msg.msg.(type) {
+	case ping.Result:
+		return row, row.panel.receive(inner)
+	case ping.Notice:
+		t.event(now, inner.Kind, fmt.Sprintf("hop %d: %s", row.hop.TTL, inner.Message))
+	case error:
+		row.panel.err = inner
+		t.event(now, "error", fmt.Sprintf("hop %d stopped: %s", row.hop.TTL, inner))
+	}
+
+	return row, false
+}
+
+// wait returns a command that waits on this hop's pinger alone.
+func (r *traceRow) wait() tea.Cmd {
+	wait := r.panel.wait(r.ctx, 0)
+	return func() tea.Msg {
+		if msg, ok := wait().(hostMsg); ok {
+			return hopMsg{r.panel, msg.msg}
+		}
+		return nil
+	}
+}
+
+func (t *tracer) retrace() tea.Cmd {
+	return func() tea.Msg {
+		hops, err := trace.Run(t.ctx, t.host, t.cfg.family)
+		return traceMsg{hops, err}
+	}
+}
+
+func (t *tracer) tick() tea.Cmd {
+	if t.every <= 0 {
+		return nil
+	}
+
+	return tea.Tick(t.every, func(time.Time) tea.Msg { return retraceMsg{} })
+}
+
+// status is what a hop's row shows in place of its figures, if anything. A
+// hop that doesn't answer pings, as many routers don't, is shown as such
+// rather than as losing every one.
+func (r *traceRow) status(now time.Time, interval time.Duration) string {
+	switch {
+	case r.panel == nil:
+		return "no reply"
+	case r.panel.err != nil:
+		return fmt.Sprintf("stopped: %s", r.panel.err)
+	case r.panel.stats.Totals.Count > 0:
+		return ""
+	case now.Sub(r.started) < stats.LossTimeout(interval):
+		return "waiting"
+	}
+
+	return "no reply"
+}
+
+func (t *tracer) answering(now time.Time) []*traceRow {
+	var rows []*traceRow
+	for _, row := range t.rows {
+		if row.status(now, t.cfg.interval) == "" {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// onset is where trouble starts along the path: the first hop losing probes
+// whose loss carries on through every hop after it that answers, since a
+// router that only drops the probes aimed at itself forwards traffic fine,
+// and the hop adding the most to the average over the one before it.
+func (t *tracer) onset(now time.Time) (loss *traceRow, jump *traceRow, added time.Duration) {
+	rows := t.answering(now)
+	for i := len(rows) - 1; i >= 0 && rows[i].panel.stats.Loss.Cumulative() > 0; i-- {
+		loss = rows[i]
+	}
+
+	var before time.Duration
+	for _, row := range rows {
+		average := row.panel.stats.Totals.Average()
+		if jump == nil || average-before > added {
+			jump, added = row, average-before
+		}
+		before = average
+	}
+
+	return loss, jump, added
+}
+
+func (t *tracer) addressWidth() int {
+	width := len("Address")
+	for _, row := range t.rows {
+		width = max(width, len(row.hop.String()))
+	}
+
+	return width
+}
+
+func (t *tracer) headings(th theme.Theme) string {
+	return th.Muted.Render(fmt.Sprintf("%3s  %-*s  %8s %8s %8s %8s %7s", "Hop", t.addressWidth(), "Address", "Last", "Window", "Average", "Worst", "Loss"))
+}
+
+// line is a hop's row, its figures coloured by the levels so that where they
+// turn is plain to see.
+func (t *tracer) line(th theme.Theme, row *traceRow, now time.Time) string {
+	prefix := fmt.Sprintf("%3d  %-*s  ", row.hop.TTL, t.addressWidth(), row.hop)
+	if status := row.status(now, t.cfg.interval); status != "" {
+		if row.panel != nil && row.panel.err != nil {
+			return prefix + th.Bad.Render(status)
+		}
+		return prefix + th.Muted.Render(status)
+	}
+
+	s := row.panel.stats
+	latency := func(d time.Duration) string {
+		return s.Levels.Latency(th, d).Render(fmt.Sprintf("%8s", stats.FormatLatency(d)))
+	}
+	window := fmt.Sprintf("%8s", "-")
+	if s.LastWindow.Count > 0 {
+		window = latency(s.LastWindow.Average())
+	}
+	loss := s.Loss.Cumulative()
+
+	return prefix + strings.Join([]string{
+		latency(row.panel.last.Duration),
+		window,
+		latency(s.Totals.Average()),
+		latency(s.Totals.Max),
+		s.Levels.Loss(th, loss).Render(fmt.Sprintf("%6.1f%%", loss*100)),
+	}, " ")
+}
+
+// table is the hops' rows, with where latency and loss start under them.
+func (t *tracer) table(th theme.Theme, now time.Time) []string {
+	lines := []string{t.headings(th)}
+	for _, row := range t.rows {
+		lines = append(lines, t.line(th, row, now))
+	}
+	if t.beyond > 0 {
+		lines = append(lines, th.Muted.Render(fmt.Sprintf("     the trace went on %d more without a reply", t.beyond)))
+	}
+
+	loss, jump, added := t.onset(now)
+	if jump == nil {
+		return lines
+	}
+	lines = append(lines, "", fmt.Sprintf("Most latency added at hop %d (%s): %s", jump.hop.TTL, jump.hop, signed(stats.Milliseconds(added))))
+	if loss != nil {
+		lines = append(lines, th.Warn.Render(fmt.Sprintf("Loss starts at hop %d (%s), carrying on to the end", loss.hop.TTL, loss.hop)))
+	}
+
+	return lines
+}
+
+func (t *tracer) printEvent(e stats.Event) string {
+	return fmt.Sprintf("%s %s - %s", t.cfg.timeFormat.Clock(e.Time), e.Kind, e.Message)
+}
+
+type traceModel struct {
+	tracer  *tracer
+	cancel  context.CancelFunc
+	theme   theme.Theme
+	keys    tui.KeyMap
+	tracing bool
+}
+
+func (m traceModel) Init() tea.Cmd {
+	cmds := []tea.Cmd{m.lossTick(), m.tracer.tick()}
+	for _, row := range m.tracer.rows {
+		if row.panel != nil {
+			cmds = append(cmds, row.wait())
+		}
+	}
+
+	return tea.Batch(cmds...)
+}
+
+func (m traceModel) lossTick() tea.Cmd {
+	return tea.Tick(m.tracer.cfg.interval, func(time.Time) tea.Msg { return tui.LossMsg{} })
+}
+
+func (m traceModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == tui.RESERVED_KEY || m.keys.Action(tui.KEYS_ANYWHERE, msg.String()) == "quit" {
+			m.cancel()
+			return m, tea.Quit
+		}
+	case tui.LossMsg:
+		for _, row := range m.tracer.rows {
+			if row.panel != nil {
+				row.panel.stats.AdvanceLoss()
+			}
+		}
+		return m, m.lossTick()
+	case retraceMsg:
+		m.tracing = true
+		return m, m.tracer.retrace()
+	case traceMsg:
+		m.tracing = false
+		started, err := m.tracer.retraced(msg, time.Now())
+		if err != nil {
+			m.tracer.err = err
+			m.cancel()
+			return m, tea.Quit
+		}
+		cmds := []tea.Cmd{m.tracer.tick()}
+		for _, row := range started {
+			cmds = append(cmds, row.wait())
+		}
+		return m, tea.Batch(cmds...)
+	case hopMsg:
+		row, _ := m.tracer.receive(msg, time.Now())
+		if _, failed := msg.msg.(error); row == nil || failed {
+			return m, nil
+		}
+		return m, row.wait()
+	}
+
+	return m, nil
+}
+
+func (m traceModel) View() string {
+	t := m.tracer
+	title := fmt.Sprintf("TRACE: %s (interval: %s)", t.host, t.cfg.interval)
+	if t.every > 0 {
+		title = fmt.Sprintf("TRACE: %s (interval: %s, re-traced every %s)", t.host, t.cfg.interval, t.every)
+	}
+	if m.tracing {
+		title += " re-tracing..."
+	}
+
+	lines := []string{m.theme.Header.Render(title), m.theme.Muted.Render(m.keys.Label("quit") + " to quit"), ""}
+	lines = append(lines, t.table(m.theme, time.Now())...)
+
+	events := t.events[max(len(t.events)-TRACE_EVENTS, 0):]
+	if len(events) > 0 {
+		lines = append(lines, "", m.theme.Header.Render("Events"))
+	}
+	for _, e := range events {
+		lines = append(lines, t.printEvent(e))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// runTracePlain prints a line per completed window for every hop, and the
+// route's events as they happen, with the table at the end.
+func runTracePlain(ctx context.Context, t *tracer, out io.Writer) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stamp := func() string { return t.cfg.timeFormat.Stamp(time.Now()) }
+
+	msgs := make(chan hopMsg)
+	forward := func(rows []*traceRow) {
+		for _, row := range rows {
+			if row.panel == nil {
+				continue
+			}
+			wait := row.wait()
+			go func() {
+				for {
+					msg, ok := wait().(hopMsg)
+					if !ok {
+						return
+					}
+					select {
+					case msgs <- msg:
+					case <-row.ctx.Done():
+						return
+					}
+					if _, failed := msg.msg.(error); failed {
+						return
+					}
+				}
+			}()
+		}
+	}
+	forward(t.rows)
+
+	printed := 0
+	flush := func() {
+		for _, e := range t.events[printed:] {
+			fmt.Fprintf(out, "%s %s %s\n", t.cfg.timeFormat.Stamp(e.Time), e.Kind, e.Message)
+		}
+		printed = len(t.events)
+	}
+	flush()
+
+	ticker := time.NewTicker(max(t.cfg.interval, time.Second))
+	defer ticker.Stop()
+
+	var retraces <-chan time.Time
+	if t.every > 0 {
+		retraceTicker := time.NewTicker(t.every)
+		defer retraceTicker.Stop()
+		retraces = retraceTicker.C
+	}
+	traces := make(chan traceMsg)
+	tracing := false
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, row := range t.rows {
+				if row.panel != nil {
+					row.panel.stats.AdvanceLoss()
+				}
+			}
+		case <-retraces:
+			if tracing {
+				continue
+			}
+			tracing = true
+			retrace := t.retrace()
+			go func() {
+				select {
+				case traces <- retrace().(traceMsg):
+				case <-ctx.Done():
+				}
+			}()
+		case msg := <-traces:
+			tracing = false
+			started, err := t.retraced(msg, time.Now())
+			flush()
+			if err != nil {
+				return err
+			}
+			forward(started)
+		case msg := <-msgs:
+			row, rolled := t.receive(msg, time.Now())
+			flush()
+			if rolled {
+				fmt.Fprintf(out, "%s hop %d %s window %s, %s\n", stamp(), row.hop.TTL, row.hop, row.panel.stats.RenderLastWindow(theme.Theme{}), row.panel.stats.PrintLoss(theme.Theme{}))
+			}
+		case <-ctx.Done():
+			fmt.Fprintln(out, strings.Join(t.table(theme.Theme{}, time.Now()), "\n"))
+			return nil
+		}
+	}
+}
+
+func runTrace(ctx context.Context, cfg hostsConfig, every time.Duration) error {
+	if !slices.Contains(OUTPUTS, cfg.output) {
+		return fmt.Errorf("unknown output %q, expected one of: %s", cfg.output, strings.Join(OUTPUTS, ", "))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "tracing the route to %s...\n", cfg.hosts[0])
+	hops, err := trace.Run(ctx, cfg.hosts[0], cfg.family)
+	if err != nil {
+		return err
+	}
+	t := newTracer(ctx, cfg, every)
+	if _, err := t.apply(hops, time.Now()); err != nil {
+		return err
+	}
+	if len(t.rows) == 0 {
+		return fmt.Errorf("no hop on the way to %s answered the trace", cfg.hosts[0])
+	}
+
+	info := tui.DetectTerminal()
+	if cfg.output != "tui" {
+		return runTracePlain(ctx, t, os.Stdout)
+	}
+	if ok, reason := tui.UseTUI(info, cfg.forceTUI); !ok {
+		fmt.Fprintf(os.Stderr, "using plain output: %s\n", reason)
+		return runTracePlain(ctx, t, os.Stdout)
+	}
+
+	m := traceModel{tracer: t, cancel: cancel, theme: cfg.theme, keys: cfg.keys}
+	if _, err := tea.NewProgram(m).Run(); err != nil {
+		return err
+	}
+
+	return t.err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ponglehub.co.uk/nettest/pkg/stats"
+	"ponglehub.co.uk/nettest/pkg/trace"
+)
+
+func TestTrace(t *testing.T) {
+	parsed := map[string]string{
+		"traceroute to 8.8.8.8 (8.8.8.8), 30 hops max, 60 byte packets\n" +
+			" 1  192.168.1.1  1.123 ms\n" +
+			" 2  *\n" +
+			" 3  10.0.0.1  5.104 ms\n" +
+			" 4  8.8.8.8  9.012 ms\n": "1:192.168.1.1 2:* 3:10.0.0.1 4:8.8.8.8",
+		" 1?: [LOCALHOST]                      pmtu 1500\n" +
+			" 1:  192.168.1.1                                           1.208ms \n" +
+			" 1:  192.168.1.1                                           1.023ms \n" +
+			" 2:  no reply\n" +
+			" 3:  2001:db8::1                                           5.1ms asymm  4\n" +
+			"     Too many hops: pmtu 1500\n" +
+			"     Resume: pmtu 1500\n": "1:192.168.1.1 2:* 3:2001:db8::1",
+		"Tracing route to dns.google [8.8.8.8]\r\nover a maximum of 30 hops:\r\n\r\n" +
+			"  1    <1 ms    <1 ms    <1 ms  192.168.1.1\r\n" +
+			"  2     *        *        *     Request timed out.\r\n" +
+			"  3    12 ms    11 ms    12 ms  8.8.8.8\r\n\r\nTrace complete.\r\n": "1:192.168.1.1 2:* 3:8.8.8.8",
+	}
+	for output, expected := range parsed {
+		var hops []string
+		for _, hop := range trace.Parse(output) {
+			hops = append(hops, fmt.Sprintf("%d:%s", hop.TTL, hop))
+		}
+		if got := strings.Join(hops, " "); got != expected {
+			t.Fatalf("traceroute, tracepath and tracert output give a hop per TTL: expected %q, got %q", expected, got)
+		}
+	}
+
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	tr := newTracer(context.Background(), hostsConfig{hosts: []string{"8.8.8.8"}, interval: time.Second, window: 10}, 0)
+	tr.newPanel = func(ctx context.Context, address string) (*hostPanel, error) {
+		s := stats.New(time.Second, 10*time.Second, stats.DEFAULT_THRESHOLDS)
+		return &hostPanel{host: address, stats: &s}, nil
+	}
+	hop := func(ttl int, address string) trace.Hop { return trace.Hop{TTL: ttl, Address: address} }
+	if _, err := tr.apply([]trace.Hop{hop(1, "192.168.1.1"), hop(2, ""), hop(3, "10.0.0.1"), hop(4, "8.8.8.8"), hop(5, "")}, start); err != nil {
+		t.Fatalf("the first trace starts a row per hop: expected no error, got %v", err)
+	}
+	if len(tr.rows) != 4 || tr.beyond != 1 {
+		t.Fatalf("the hops after the last to answer are left out: expected 4 rows, 1 beyond, got %d rows, %d beyond", len(tr.rows), tr.beyond)
+	}
+	for _, i := range []int{0, 3} {
+		tr.rows[i].panel.stats.Update(10 * time.Millisecond)
+	}
+	later := start.Add(time.Minute)
+	var statuses []string
+	for _, row := range tr.rows {
+		statuses = append(statuses, fmt.Sprintf("%q", row.status(later, time.Second)))
+	}
+	if got := strings.Join(statuses, " "); got != `"" "no reply" "no reply" ""` {
+		t.Fatalf("hops that don'tr answer the trace or pings are shown as no reply: expected \"\" \"no reply\" \"no reply\" \"\", got %q", got)
+	}
+	if loss := tr.rows[2].panel.stats.Loss.Cumulative(); loss != 0 {
+		t.Fatalf("a hop that never answers pings isn'tr counted as losing them: expected 0.0%%, got %.1f%%", loss*100)
+	}
+
+	// Hop 2 not answering again is a probe lost rather than a change, but a
+	// different router at hop 3 starts its row over.
+	first, fourth := tr.rows[0], tr.rows[3]
+	started, err := tr.apply([]trace.Hop{hop(1, "192.168.1.1"), hop(2, ""), hop(3, "10.0.0.2"), hop(4, "8.8.8.8")}, later)
+	if err != nil || len(started) != 1 || started[0].hop != hop(3, "10.0.0.2") {
+		t.Fatalf("a re-trace only starts the rows of hops that changed: expected hop 3 started, got %q", fmt.Sprint(len(started), err))
+	}
+	if tr.rows[0] != first || tr.rows[3] != fourth || tr.rows[3].panel.stats.Totals.Count != 1 || tr.rows[2].panel.stats.Totals.Count != 0 {
+		t.Fatalf("a re-trace leaves the rows of hops that didn'tr change as they were: expected hops 1 and 4 kept, got rows replaced")
+	}
+	if last := tr.events[len(tr.events)-1]; last.Kind != "route" || last.Message != "hop 3 changed from 10.0.0.1 to 10.0.0.2" {
+		t.Fatalf("a changed hop is logged: expected route: hop 3 changed from 10.0.0.1 to 10.0.0.2, got %s: %s", last.Kind, last.Message)
+	}
+	if len(tr.answering(later)) != 2 {
+		t.Fatalf("a row started over waits for its first reply: expected 2 answering, got %v", len(tr.answering(later)))
+	}
+
+	if _, err := tr.apply([]trace.Hop{hop(1, "192.168.1.1"), hop(2, "10.1.1.1")}, later); err != nil || len(tr.rows) != 2 || tr.rows[1].hop.Address != "10.1.1.1" {
+		t.Fatalf("a shorter path drops the rows past its end: expected 2 rows, got %q", fmt.Sprint(len(tr.rows), err))
+	}
+	if last := tr.events[len(tr.events)-1]; last.Message != "the path is 2 hops now, from 4" {
+		t.Fatalf("a shorter path is logged: expected the path is 2 hops now, from 4, got %q", last.Message)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ponglehub.co.uk/nettest/pkg/webhook"
+)
+
+func parseLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := map[string]string{}
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", value)
+		}
+		labels[key] = val
+	}
+
+	return labels, nil
+}
+
+func newWindowWebhook(url string, secretEnv string, spool string) (*webhook.Sender, error) {
+	var secret []byte
+	if secretEnv != "" {
+		value := os.Getenv(secretEnv)
+		if value == "" {
+			return nil, fmt.Errorf("--webhook-secret-env names %s, but it is not set", secretEnv)
+		}
+		secret = []byte(value)
+	}
+
+	if spool == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find a webhook spool directory, set --webhook-spool: %s", err)
+		}
+		spool = filepath.Join(dir, "network-test", "webhook-spool")
+	}
+
+	return webhook.NewSender(url, secret, spool), nil
+}